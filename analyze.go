@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/analysis"
+	"github.com/hammertrack/tracker/internal/bot"
+)
+
+func analyze(args []string) error {
+	if len(args) == 0 || args[0] != "evasion" {
+		return ErrBadArguments
+	}
+	return analyzeEvasion(args[1:])
+}
+
+func analyzeEvasion(args []string) error {
+	fs := flag.NewFlagSet("analyze evasion", flag.ExitOnError)
+	channel := fs.String("channel", "", "channel to analyze")
+	from := fs.String("from", "", "first day of the window, as YYYY-MM-DD")
+	to := fs.String("to", time.Now().UTC().Format(dayLayout), "last day of the window, as YYYY-MM-DD")
+	distance := fs.Int("distance", 2, "maximum edit distance between similar usernames")
+	similarity := fs.Float64("similarity", .6, "minimum similarity between the messages of two accounts")
+	dryRun := fs.Bool("dry-run", false, "print the clusters without storing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *channel == "" || *from == "" {
+		return ErrBadArguments
+	}
+	fromDay, err := time.Parse(dayLayout, *from)
+	if err != nil {
+		return err
+	}
+	toDay, err := time.Parse(dayLayout, *to)
+	if err != nil {
+		return err
+	}
+	toDay = toDay.Add(24*time.Hour - time.Millisecond)
+
+	sto := openStorage()
+	defer sto.Stop()
+
+	var accounts []*analysis.Account
+	err = sto.ChannelModerations(bot.Channel(*channel), fromDay, toDay, func(m *bot.Moderation) error {
+		accounts = append(accounts, &analysis.Account{Username: m.Username, Messages: m.Messages})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	found := analysis.Evasion(accounts, analysis.EvasionOptions{
+		MaxDistance:       *distance,
+		MinUsernameLength: 5,
+		MinSimilarity:     *similarity,
+		MinWords:          3,
+	})
+	log.Printf("%d moderations, %d clusters", len(accounts), len(found))
+
+	now := time.Now()
+	clusters := make([]*bot.EvasionCluster, len(found))
+	for i, c := range found {
+		log.Printf("  [%s] %s", strings.Join(c.Reasons, ","), strings.Join(c.Usernames, " "))
+		clusters[i] = &bot.EvasionCluster{
+			Channel:    strings.ToLower(*channel),
+			DetectedAt: now,
+			ID:         i,
+			Usernames:  c.Usernames,
+			Reasons:    c.Reasons,
+			WindowFrom: fromDay,
+			WindowTo:   toDay,
+		}
+	}
+	if *dryRun || len(clusters) == 0 {
+		return nil
+	}
+	return sto.SaveEvasionClusters(clusters)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/bot"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/justlog"
+)
+
+const dayLayout = "2006-01-02"
+
+func backfill(args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	channel := fs.String("channel", "", "channel to backfill")
+	from := fs.String("from", "", "first day to backfill, as YYYY-MM-DD")
+	to := fs.String("to", time.Now().UTC().Format(dayLayout), "last day to backfill, as YYYY-MM-DD")
+	url := fs.String("url", cfg.BackfillURL, "base URL of the justlog compatible log archive")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *channel == "" || *from == "" || *url == "" {
+		return ErrBadArguments
+	}
+	fromDay, err := time.Parse(dayLayout, *from)
+	if err != nil {
+		return err
+	}
+	toDay, err := time.Parse(dayLayout, *to)
+	if err != nil {
+		return err
+	}
+
+	sto := openStorage()
+	defer sto.Stop()
+
+	report, err := bot.Backfill(context.Background(), sto, justlog.New(*url), bot.Channel(*channel), fromDay, toDay)
+	log.Printf("channel: %s", report.Channel)
+	log.Printf("days: %d, entries: %d", report.Days, report.Entries)
+	log.Printf("moderations: %d, duplicates: %d, stored: %d", report.Moderations, report.Duplicates, report.Stored)
+	return err
+}
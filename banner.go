@@ -20,5 +20,6 @@ func printBanner() {
 	}
 	fmt.Print(utils.ByteToStr(b))
 	fmt.Printf("v%s\n\n", config.Version)
+	log.Printf("Running as %s", config.UserAgent())
 	log.Print("Initializing server tracker...")
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/bot"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/helix"
+)
+
+func channels(args []string) error {
+	if len(args) == 0 || args[0] != "import" {
+		return ErrBadArguments
+	}
+	return importChannels(args[1:])
+}
+
+func importChannels(args []string) error {
+	fs := flag.NewFlagSet("channels import", flag.ExitOnError)
+	team := fs.String("team", "", "twitch team whose members are imported")
+	file := fs.String("file", "", "file with a channel per line, lines starting with # are ignored")
+	shard := fs.Int("shard", 0, "shard of the imported channels, spread across SHARD_COUNT shards if 0")
+	dryRun := fs.Bool("dry-run", false, "validate the channels without importing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*team == "") == (*file == "") {
+		return ErrBadArguments
+	}
+
+	ctx := context.Background()
+	h := helix.New(cfg.HelixClientID, cfg.HelixToken)
+	var (
+		logins []string
+		err    error
+	)
+	if *team != "" {
+		logins, err = h.TeamMembers(ctx, *team)
+	} else {
+		logins, err = readChannels(*file)
+	}
+	if err != nil {
+		return err
+	}
+
+	// validate that every channel exists
+	users, err := h.Users(ctx, logins)
+	if err != nil {
+		return err
+	}
+	found := make(map[string]bool, len(users))
+	for _, u := range users {
+		found[u.Login] = true
+	}
+	for _, login := range logins {
+		if !found[strings.ToLower(login)] {
+			log.Printf("skipping %s: user not found", login)
+		}
+	}
+	if *dryRun {
+		log.Printf("dry-run, %d of %d channels would be imported", len(users), len(logins))
+		return nil
+	}
+
+	sto := openStorage()
+	defer sto.Stop()
+	for _, u := range users {
+		ch := bot.Channel(u.Login)
+		s := *shard
+		if s == 0 {
+			s = bot.ShardOf(ch, cfg.ShardCount)
+		}
+		if err := sto.ImportChannel(ch, s, "cli"); err != nil {
+			if errors.Is(err, bot.ErrChannelTracked) {
+				log.Printf("skipping %s: already tracked", ch)
+				continue
+			}
+			return err
+		}
+		log.Printf("imported %s in shard %d", ch, s)
+	}
+	return nil
+}
+
+// readChannels reads a file with a channel per line, without duplicates
+func readChannels(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	defer f.Close()
+
+	var (
+		logins []string
+		seen   = make(map[string]bool)
+	)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		login := strings.ToLower(strings.TrimSpace(s.Text()))
+		if login == "" || strings.HasPrefix(login, "#") || seen[login] {
+			continue
+		}
+		seen[login] = true
+		logins = append(logins, login)
+	}
+	if err := s.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return logins, nil
+}
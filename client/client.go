@@ -0,0 +1,279 @@
+// Package client is a Go client of the tenant API of the tracker. It follows
+// the OpenAPI spec served by the tracker at /openapi.json, one method by
+// operation, and must be updated along with it.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+// Error is a response of the API with an error status
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("tracker API: %d %s", e.Status, e.Message)
+}
+
+// Health is the status of the tracker: ok, degraded or "degraded,
+// intentional" while the ingestion is paused
+type Health struct {
+	Status string `json:"status"`
+}
+
+type ActiveBan struct {
+	Channel  string    `json:"channel"`
+	Username string    `json:"username"`
+	UserID   string    `json:"user_id"`
+	At       time.Time `json:"at"`
+}
+
+type SharedBan struct {
+	Channel  string    `json:"channel"`
+	Username string    `json:"username"`
+	At       time.Time `json:"at"`
+	Tags     []string  `json:"tags"`
+}
+
+type FeedSubscription struct {
+	ID       string `json:"id"`
+	Channel  string `json:"channel"`
+	TenantID string `json:"tenant_id"`
+	URL      string `json:"url"`
+	// Secret signs the deliveries of the subscription
+	Secret    string    `json:"secret"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Moderation struct {
+	Channel  string    `json:"channel"`
+	Username string    `json:"username"`
+	UserID   string    `json:"user_id,omitempty"`
+	At       time.Time `json:"at"`
+	// Type is ban, timeout, deletion, automod or warning, empty for the oldest
+	// moderations
+	Type     string `json:"type,omitempty"`
+	Duration int    `json:"duration,omitempty"`
+	// Messages of the user before the moderation, the most recent first
+	Messages []string `json:"messages"`
+	// Sub is 0 not subscribed, 1 subscribed or 2 unknown
+	Sub              int        `json:"sub"`
+	SubMonths        int        `json:"sub_months,omitempty"`
+	Toxicity         *float64   `json:"toxicity,omitempty"`
+	Tags             []string   `json:"tags"`
+	AutomodStatus    string     `json:"automod_status,omitempty"`
+	AutomodCategory  string     `json:"automod_category,omitempty"`
+	AccountCreatedAt *time.Time `json:"account_created_at,omitempty"`
+	FollowedAt       *time.Time `json:"followed_at,omitempty"`
+	SharedSession    bool       `json:"shared_session,omitempty"`
+	SourceChannelID  string     `json:"source_channel_id,omitempty"`
+	TenantID         string     `json:"tenant_id,omitempty"`
+	Reason           string     `json:"reason,omitempty"`
+	// TimeToAction is the seconds between the most recent message and the
+	// moderation
+	TimeToAction *float64 `json:"time_to_action,omitempty"`
+	// Channels are the other channels of a collapsed mass ban
+	Channels []string `json:"channels,omitempty"`
+	Deleted  bool     `json:"deleted,omitempty"`
+	Note     string   `json:"note,omitempty"`
+}
+
+// UserModerationsOptions filter the moderations of UserModerations. The zero
+// value returns the most recent moderations of every channel
+type UserModerationsOptions struct {
+	Channel string
+	Tag     string
+	// Limit is 50 by default, up to 500
+	Limit int
+}
+
+// SharedBansOptions filter the bans of SharedBans. The zero value returns the
+// bans of the last week
+type SharedBansOptions struct {
+	Since time.Time
+	// Limit is 50 by default, up to 500
+	Limit int
+}
+
+// Client calls the API of a tracker with the API key of a tenant. It is safe
+// for concurrent use
+type Client struct {
+	baseURL string
+	apiKey  string
+	// HTTP is the client of the requests, http.DefaultClient by default
+	HTTP *http.Client
+}
+
+// Health returns the status of the tracker. A degraded tracker is not an
+// error
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	var h Health
+	err := c.do(ctx, http.MethodGet, "/healthz", nil, nil, &h)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusServiceUnavailable {
+		return &Health{Status: "degraded"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// Channels returns the channels of the tenant
+func (c *Client) Channels(ctx context.Context) ([]string, error) {
+	var chs []string
+	if err := c.do(ctx, http.MethodGet, "/v1/channels", nil, nil, &chs); err != nil {
+		return nil, err
+	}
+	return chs, nil
+}
+
+// SetBanSharing shares the bans of a channel of the tenant in its ban feed, or
+// stops sharing them
+func (c *Client) SetBanSharing(ctx context.Context, channel string, enabled bool) error {
+	body := struct {
+		Enabled bool `json:"enabled"`
+	}{enabled}
+	return c.do(ctx, http.MethodPut, "/v1/channels/"+url.PathEscape(channel)+"/ban-sharing", nil, body, nil)
+}
+
+// ActiveBans returns the users currently banned in a channel of the tenant
+func (c *Client) ActiveBans(ctx context.Context, channel string) ([]*ActiveBan, error) {
+	var bans []*ActiveBan
+	if err := c.do(ctx, http.MethodGet, "/v1/channels/"+url.PathEscape(channel)+"/active-bans", nil, nil, &bans); err != nil {
+		return nil, err
+	}
+	return bans, nil
+}
+
+// UserModerations returns the most recent moderations of a user in the
+// channels of the tenant, the most recent first
+func (c *Client) UserModerations(ctx context.Context, username string, opts UserModerationsOptions) ([]*Moderation, error) {
+	q := url.Values{}
+	if opts.Channel != "" {
+		q.Set("channel", opts.Channel)
+	}
+	if opts.Tag != "" {
+		q.Set("tag", opts.Tag)
+	}
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	var mods []*Moderation
+	if err := c.do(ctx, http.MethodGet, "/v1/users/"+url.PathEscape(username)+"/moderations", q, nil, &mods); err != nil {
+		return nil, err
+	}
+	return mods, nil
+}
+
+// SharedBans returns the ban feed of a channel sharing its bans
+func (c *Client) SharedBans(ctx context.Context, channel string, opts SharedBansOptions) ([]*SharedBan, error) {
+	q := url.Values{}
+	if !opts.Since.IsZero() {
+		q.Set("since", opts.Since.UTC().Format(time.RFC3339))
+	}
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	var bans []*SharedBan
+	if err := c.do(ctx, http.MethodGet, "/v1/feeds/"+url.PathEscape(channel)+"/bans", q, nil, &bans); err != nil {
+		return nil, err
+	}
+	return bans, nil
+}
+
+// SubscribeFeed subscribes the webhook `webhookURL` to the ban feed of a
+// channel
+func (c *Client) SubscribeFeed(ctx context.Context, channel, webhookURL string) (*FeedSubscription, error) {
+	body := struct {
+		URL string `json:"url"`
+	}{webhookURL}
+	var sub FeedSubscription
+	if err := c.do(ctx, http.MethodPost, "/v1/feeds/"+url.PathEscape(channel)+"/subscriptions", nil, body, &sub); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// UnsubscribeFeed removes a subscription of the tenant to the ban feed of a
+// channel
+func (c *Client) UnsubscribeFeed(ctx context.Context, channel, id string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/feeds/"+url.PathEscape(channel)+"/subscriptions/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// do sends the request and decodes the response into `out` if not nil. The
+// responses with an error status are returned as *Error
+func (c *Client) do(ctx context.Context, method, path string, q url.Values, in, out interface{}) error {
+	u := c.baseURL + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return errors.Wrap(err)
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	httpClient := c.HTTP
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		apiErr := &Error{Status: res.StatusCode, Message: http.StatusText(res.StatusCode)}
+		var e struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&e); err == nil && e.Error != "" {
+			apiErr.Message = e.Error
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// New creates a client of the tracker at `baseURL`, e.g.
+// https://tracker.example.com, with the API key of a tenant
+func New(baseURL, apiKey string) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+	}
+}
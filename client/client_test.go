@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+type operation struct {
+	method string
+	// path matches the paths of the operation with any params
+	path *regexp.Regexp
+}
+
+// specOperations returns the operations of the OpenAPI spec of the tracker by
+// operationId
+func specOperations(t *testing.T) map[string]operation {
+	t.Helper()
+	b, err := os.ReadFile("../internal/api/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec struct {
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(b, &spec); err != nil {
+		t.Fatal(err)
+	}
+	ops := make(map[string]operation)
+	for path, methods := range spec.Paths {
+		for method, op := range methods {
+			if op.OperationID == "" {
+				t.Errorf("%s %s has no operationId", method, path)
+			}
+			segments := strings.Split(path, "/")
+			for i, s := range segments {
+				if strings.HasPrefix(s, "{") {
+					segments[i] = "[^/]+"
+				} else {
+					segments[i] = regexp.QuoteMeta(s)
+				}
+			}
+			ops[op.OperationID] = operation{
+				method: strings.ToUpper(method),
+				path:   regexp.MustCompile("^" + strings.Join(segments, "/") + "$"),
+			}
+		}
+	}
+	return ops
+}
+
+func TestClientFollowsSpec(t *testing.T) {
+	t.Parallel()
+	ops := specOperations(t)
+	tests := []struct {
+		operationID string
+		call        func(c *Client) error
+	}{
+		{"health", func(c *Client) error { _, err := c.Health(context.Background()); return err }},
+		{"channels", func(c *Client) error { _, err := c.Channels(context.Background()); return err }},
+		{"setBanSharing", func(c *Client) error { return c.SetBanSharing(context.Background(), "ch", true) }},
+		{"activeBans", func(c *Client) error { _, err := c.ActiveBans(context.Background(), "ch"); return err }},
+		{"userModerations", func(c *Client) error {
+			_, err := c.UserModerations(context.Background(), "user", UserModerationsOptions{Tag: "spam", Limit: 10})
+			return err
+		}},
+		{"sharedBans", func(c *Client) error {
+			_, err := c.SharedBans(context.Background(), "ch", SharedBansOptions{})
+			return err
+		}},
+		{"subscribeFeed", func(c *Client) error {
+			_, err := c.SubscribeFeed(context.Background(), "ch", "https://example.com")
+			return err
+		}},
+		{"unsubscribeFeed", func(c *Client) error { return c.UnsubscribeFeed(context.Background(), "ch", "id") }},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.operationID, func(t *testing.T) {
+			t.Parallel()
+			var gotMethod, gotPath string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotMethod, gotPath = r.Method, r.URL.Path
+				if r.Header.Get("Authorization") != "Bearer key" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				if r.URL.Path == "/healthz" {
+					w.Write([]byte(`{"status":"ok"}`))
+					return
+				}
+				if r.Method == http.MethodGet {
+					w.Write([]byte(`[]`))
+					return
+				}
+				w.Write([]byte(`{}`))
+			}))
+			defer srv.Close()
+
+			if err := tt.call(New(srv.URL, "key")); err != nil {
+				t.Fatal(err)
+			}
+			op, ok := ops[tt.operationID]
+			if !ok {
+				t.Fatalf("got: %s %s, want: an operation of the spec", gotMethod, gotPath)
+			}
+			if gotMethod != op.method || !op.path.MatchString(gotPath) {
+				t.Errorf("got: %s %s, want: %s %s", gotMethod, gotPath, op.method, op.path)
+			}
+		})
+	}
+	// every operation of the spec has a method
+	for id := range ops {
+		found := false
+		for _, tt := range tests {
+			found = found || tt.operationID == id
+		}
+		if !found {
+			t.Errorf("got: no method of the client, want: a method for the operation %s", id)
+		}
+	}
+}
+
+func TestClientError(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"channel not sharing its bans"}`))
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL+"/", "key").SharedBans(context.Background(), "ch", SharedBansOptions{})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("got: %v, want: *Error", err)
+	}
+	want := Error{Status: http.StatusNotFound, Message: "channel not sharing its bans"}
+	if *apiErr != want {
+		t.Errorf("got: %v, want: %v", *apiErr, want)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/bot"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/service"
+	"github.com/hammertrack/tracker/tracker"
+)
+
+var ErrBadArguments = errors.New("bad arguments, see usage")
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+// commands are the subcommands of the binary. Running the binary without a
+// subcommand is the same as running `serve`
+var commands = []*command{
+	{
+		name:  "serve",
+		usage: "serve [-demo [-channels <channel,...>]]\n\tStart tracking the channels (default), with no database and the given channels if -demo",
+		run:   serve,
+	},
+	{
+		name:  "purge-user",
+		usage: "purge-user [-dry-run] <username>\n\tDelete all the stored data of a user",
+		run:   purgeUser,
+	},
+	{
+		name:  "backfill",
+		usage: "backfill -channel <channel> -from <YYYY-MM-DD> [-to <YYYY-MM-DD>] [-url <url>]\n\tStore the moderations of a channel from a justlog compatible log archive",
+		run:   backfill,
+	},
+	{
+		name:  "export",
+		usage: "export -dir <dir> -from <YYYY-MM-DD> [-to <YYYY-MM-DD>] [-channel <channel>] [-workers <n>] [-resume]\n\tExport the stored moderations as Parquet files partitioned by channel and day, resuming an interrupted export with -resume",
+		run:   exportModerations,
+	},
+	{
+		name:  "analyze",
+		usage: "analyze evasion -channel <channel> -from <YYYY-MM-DD> [-to <YYYY-MM-DD>] [-distance <n>] [-similarity <0-1>] [-dry-run]\n\tFind clusters of moderated accounts likely evading bans",
+		run:   analyze,
+	},
+	{
+		name:  "decisions",
+		usage: "decisions [-file <path>] [-channel <channel>] [-user <user>]\n\tPrint why the moderations in a decisions log were stored or not",
+		run:   decisions,
+	},
+	{
+		name:  "channels",
+		usage: "channels import (-team <name> | -file <path>) [-shard <n>] [-dry-run]\n\tTrack the channels of a twitch team or of a file with a channel per line",
+		run:   channels,
+	},
+	{
+		name: "tenants",
+		usage: "tenants create [-name <name>] [-retention-days <n>] <tenant>\n" +
+			"\ttenants list\n" +
+			"\ttenants add-channel <tenant> <channel>\n" +
+			"\ttenants remove-channel <tenant> <channel>\n" +
+			"\ttenants create-key [-name <name>] [-role viewer|moderator|admin] [-channels <ch1,ch2>] <tenant>\n" +
+			"\ttenants revoke-key <key id>\n" +
+			"\ttenants add-webhook <tenant> <url>\n" +
+			"\ttenants remove-webhook <tenant> <webhook id>\n" +
+			"\tManage the tenants, their channels, API keys and webhooks",
+		run: tenants,
+	},
+	{
+		name: "import",
+		usage: "import [-dry-run] <channels.csv | watchlist.json>\n" +
+			"\tTrack the channels of a CSV with a channel and an optional shard per row, or\n" +
+			"\treplace the users of a watchlist {\"name\": \"...\", \"users\": [\"...\"]}, reporting every row",
+		run: importFile,
+	},
+	{
+		name:  "renames",
+		usage: "renames detect [-dry-run]\n\tRecord the users renamed since their moderations were stored",
+		run:   renames,
+	},
+	{
+		name:  "compress",
+		usage: "compress -channel <channel> -from <YYYY-MM-DD> [-to <YYYY-MM-DD>] [-dry-run]\n\tCompress the messages of the moderations stored before COMPRESS_MESSAGES was enabled",
+		run:   compressMessages,
+	},
+	{
+		name:  "repair",
+		usage: "repair -channel <channel> -from <YYYY-MM-DD> [-to <YYYY-MM-DD>] [-dry-run]\n\tCopy the moderations missing from one of the two tables where they are stored",
+		run:   repair,
+	},
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: tracker <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %s\n", cmd.usage)
+	}
+	fmt.Fprintf(os.Stderr, "  help\n\tPrint this help\n")
+}
+
+// openStorage connects to the database and creates the storage on top of it,
+// or keeps the moderations in memory if STORAGE_DRIVER is memory
+func openStorage() *bot.Storage {
+	log.Print("initializing storage...")
+	d, err := tracker.NewDriver(cfg.StorageDriver)
+	if err != nil {
+		errors.WrapFatal(err)
+	}
+	return bot.NewStorage(d)
+}
+
+func serve(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	demo := fs.Bool("demo", false, "keep the moderations in memory, with no database")
+	channels := fs.String("channels", "", "comma-separated channels tracked in the demo")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *channels != "" && !*demo {
+		return ErrBadArguments
+	}
+	conf := tracker.DefaultConfig()
+	if *demo {
+		conf.Storage = "memory"
+		conf.Channels = strings.Split(*channels, ",")
+	}
+	if err := service.WritePIDFile(cfg.PIDFile); err != nil {
+		return err
+	}
+	defer func() {
+		if err := service.RemovePIDFile(cfg.PIDFile); err != nil {
+			errors.WrapAndLog(err)
+		}
+	}()
+	l, err := service.Listener()
+	if err != nil {
+		return err
+	}
+
+	var opts []tracker.Option
+	if l != nil {
+		opts = append(opts, tracker.WithListener(l))
+	}
+	t := tracker.New(conf, opts...)
+	if err := t.Start(); err != nil {
+		return err
+	}
+	go func() {
+		<-t.Ready()
+		if err := service.Notify(service.StateReady); err != nil {
+			errors.WrapAndLog(err)
+		}
+		if err := service.Status(fmt.Sprintf("tracking %d channels", t.Health().Channels)); err != nil {
+			errors.WrapAndLog(err)
+		}
+	}()
+
+	err = waitSignInt(t.Failed())
+	if err := service.Notify(service.StateStopping); err != nil {
+		errors.WrapAndLog(err)
+	}
+	if stopErr := t.Stop(); err == nil {
+		err = stopErr
+	}
+	return err
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/bot"
+)
+
+func compressMessages(args []string) error {
+	fs := flag.NewFlagSet("compress", flag.ExitOnError)
+	channel := fs.String("channel", "", "channel whose moderations are compressed")
+	from := fs.String("from", "", "first day to compress, as YYYY-MM-DD")
+	to := fs.String("to", time.Now().UTC().Format(dayLayout), "last day to compress, as YYYY-MM-DD")
+	dryRun := fs.Bool("dry-run", false, "report how many moderations would be compressed without compressing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *channel == "" || *from == "" {
+		return ErrBadArguments
+	}
+	fromDay, err := time.Parse(dayLayout, *from)
+	if err != nil {
+		return err
+	}
+	toDay, err := time.Parse(dayLayout, *to)
+	if err != nil {
+		return err
+	}
+
+	// include the whole last day
+	toDay = toDay.Add(24*time.Hour - time.Millisecond)
+
+	sto := openStorage()
+	defer sto.Stop()
+
+	n, err := sto.CompressMessages(bot.Channel(*channel), fromDay, toDay, *dryRun)
+	if *dryRun {
+		log.Print("dry-run, nothing was compressed")
+	}
+	log.Printf("channel: %s, moderations compressed: %d", *channel, n)
+	return err
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/bot"
+	cfg "github.com/hammertrack/tracker/internal/config"
+)
+
+func decisions(args []string) error {
+	fs := flag.NewFlagSet("decisions", flag.ExitOnError)
+	file := fs.String("file", cfg.DecisionsLog, "decisions log to read")
+	channel := fs.String("channel", "", "only the decisions of the channel")
+	user := fs.String("user", "", "only the decisions of the user")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return ErrBadArguments
+	}
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return bot.ReadDecisions(f, func(d *bot.Decision) error {
+		if *channel != "" && !strings.EqualFold(d.Channel, *channel) {
+			return nil
+		}
+		if *user != "" && !strings.EqualFold(d.Username, *user) {
+			return nil
+		}
+		log.Printf("%s %s %s %s: %s, not compliant with [%s]", d.At.Format(time.RFC3339), d.Channel, d.Username, d.Type, d.Outcome, strings.Join(d.Violated(), ", "))
+		return nil
+	})
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/bot"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/export"
+)
+
+func exportModerations(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dir := fs.String("dir", cfg.ExportDir, "directory where the files are written")
+	channel := fs.String("channel", "", "channel to export, all the tracked channels if empty")
+	from := fs.String("from", "", "first day to export, as YYYY-MM-DD")
+	to := fs.String("to", time.Now().UTC().Format(dayLayout), "last day to export, as YYYY-MM-DD")
+	workers := fs.Int("workers", 4, "channels exported at once")
+	resume := fs.Bool("resume", false, "continue an interrupted export of the same days from its checkpoint")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" || *from == "" || *workers <= 0 {
+		return ErrBadArguments
+	}
+	fromDay, err := time.Parse(dayLayout, *from)
+	if err != nil {
+		return err
+	}
+	toDay, err := time.Parse(dayLayout, *to)
+	if err != nil {
+		return err
+	}
+
+	sto := openStorage()
+	defer sto.Stop()
+
+	chs := []bot.Channel{bot.Channel(*channel)}
+	if *channel == "" {
+		if chs, err = sto.Channels(); err != nil {
+			return err
+		}
+	}
+
+	e, err := export.New(*dir, cfg.ExportBatchSize)
+	if err != nil {
+		return err
+	}
+	var cp *export.Checkpoint
+	if *resume {
+		cp, err = export.ResumeCheckpoint(*dir, fromDay, toDay)
+	} else {
+		cp, err = export.NewCheckpoint(*dir, fromDay, toDay)
+	}
+	if err != nil {
+		return err
+	}
+
+	queue := make(chan bot.Channel)
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		total int
+		first error
+		stop  = make(chan struct{})
+	)
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ch := range queue {
+				n, err := exportChannel(sto, e, cp, ch, fromDay, toDay)
+				mu.Lock()
+				total += n
+				if err != nil && first == nil {
+					first = err
+					close(stop)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, ch := range chs {
+		select {
+		case queue <- ch:
+		case <-stop:
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+	if first != nil {
+		log.Printf("exported %d moderations before failing, export again with -resume to continue", total)
+		return first
+	}
+	log.Printf("exported %d moderations of %d channels", total, len(chs))
+	return nil
+}
+
+// exportChannel exports the days of the channel from `from` to `to` not
+// exported yet, a partition per day, recording every completed one in the
+// checkpoint. It returns the number of exported moderations
+func exportChannel(sto *bot.Storage, e *export.Exporter, cp *export.Checkpoint, ch bot.Channel, from, to time.Time) (int, error) {
+	total := 0
+	for day := cp.Next(string(ch), from); !day.After(to); day = day.AddDate(0, 0, 1) {
+		var rows []*export.Row
+		// include the whole day
+		err := sto.ChannelModerations(ch, day, day.Add(24*time.Hour-time.Millisecond), func(m *bot.Moderation) error {
+			r, err := sto.ExportRow(m)
+			if err != nil {
+				return err
+			}
+			rows = append(rows, r)
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+		if err := e.WritePartition(string(ch), day, rows); err != nil {
+			return total, err
+		}
+		if err := cp.Complete(string(ch), day); err != nil {
+			return total, err
+		}
+		total += len(rows)
+	}
+	return total, nil
+}
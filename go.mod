@@ -5,16 +5,19 @@ go 1.18
 require (
 	github.com/davecgh/go-spew v1.1.1
 	github.com/gempir/go-twitch-irc/v3 v3.0.0
+	github.com/gocql/gocql v1.0.0
+	github.com/golang-migrate/migrate/v4 v4.15.1
+	github.com/golang/snappy v0.0.4
+	github.com/gorilla/websocket v1.5.0
+	github.com/joho/godotenv v1.4.0
+	golang.org/x/sys v0.7.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/gocql/gocql v1.0.0 // indirect
-	github.com/golang-migrate/migrate/v4 v4.15.1 // indirect
-	github.com/golang/snappy v0.0.4 // indirect
 	github.com/hailocab/go-hostpool v0.0.0-20160125115350-e80d13ce29ed // indirect
 	github.com/hashicorp/errwrap v1.0.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.0 // indirect
-	github.com/joho/godotenv v1.4.0 // indirect
 	github.com/lib/pq v1.10.4 // indirect
 	go.uber.org/atomic v1.6.0 // indirect
 	gopkg.in/inf.v0 v0.9.1 // indirect
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/bot"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/helix"
+)
+
+var (
+	ErrImportFormat = errors.New("unsupported file, expected a .csv of channels or a .json watchlist")
+	ErrImportRows   = errors.New("some rows were not imported, see the report")
+	ErrWatchlist    = errors.New("invalid watchlist, expected {\"name\": \"...\", \"users\": [\"...\"]}")
+)
+
+var (
+	// loginPattern are the valid twitch logins
+	loginPattern = regexp.MustCompile(`^[a-z0-9_]{1,25}$`)
+	// watchlistPattern are the valid names of the watchlists
+	watchlistPattern = regexp.MustCompile(`^[a-z0-9_-]{1,50}$`)
+)
+
+// importReport logs the result of every row of an imported file and counts
+// them
+type importReport struct {
+	succeeded int
+	failed    int
+}
+
+func (r *importReport) ok(row int, value, format string, args ...interface{}) {
+	r.succeeded++
+	log.Printf("row %d %s: %s", row, value, fmt.Sprintf(format, args...))
+}
+
+func (r *importReport) fail(row int, value, format string, args ...interface{}) {
+	r.failed++
+	log.Printf("row %d %s: failed: %s", row, value, fmt.Sprintf(format, args...))
+}
+
+// done logs the totals and returns ErrImportRows if any row failed
+func (r *importReport) done() error {
+	log.Printf("%d rows ok, %d failed", r.succeeded, r.failed)
+	if r.failed > 0 {
+		return ErrImportRows
+	}
+	return nil
+}
+
+func importFile(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "validate the rows without importing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return ErrBadArguments
+	}
+	path := fs.Arg(0)
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return importChannelsCSV(f, *dryRun)
+	case ".json":
+		return importWatchlist(f, *dryRun)
+	default:
+		return ErrImportFormat
+	}
+}
+
+// channelRow is a valid row of a CSV of channels
+type channelRow struct {
+	row   int
+	ch    bot.Channel
+	shard int
+}
+
+// importChannelsCSV tracks the channels of a CSV with a channel and an
+// optional shard per row, spread across SHARD_COUNT shards if empty. The
+// header, if any, and the rows starting with # are skipped
+func importChannelsCSV(in io.Reader, dryRun bool) error {
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+
+	var (
+		report importReport
+		rows   []*channelRow
+		seen   = make(map[bot.Channel]int)
+	)
+	for first := true; ; first = false {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err)
+		}
+		line, _ := r.FieldPos(0)
+		login := strings.ToLower(strings.TrimSpace(record[0]))
+		if first && login == "channel" {
+			continue
+		}
+		if !loginPattern.MatchString(login) {
+			report.fail(line, record[0], "invalid channel login")
+			continue
+		}
+		ch := bot.Channel(login)
+		if prev, ok := seen[ch]; ok {
+			report.fail(line, login, "duplicate of row %d", prev)
+			continue
+		}
+		seen[ch] = line
+		shard := bot.ShardOf(ch, cfg.ShardCount)
+		if len(record) > 1 && strings.TrimSpace(record[1]) != "" {
+			shard, err = strconv.Atoi(strings.TrimSpace(record[1]))
+			if err != nil || shard < 1 || shard > cfg.ShardCount {
+				report.fail(line, login, "invalid shard %q, expected 1 to %d", record[1], cfg.ShardCount)
+				continue
+			}
+		}
+		rows = append(rows, &channelRow{row: line, ch: ch, shard: shard})
+	}
+
+	rows, err := existingChannels(rows, &report)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		for _, row := range rows {
+			report.ok(row.row, string(row.ch), "would be imported in shard %d", row.shard)
+		}
+		return report.done()
+	}
+
+	sto := openStorage()
+	defer sto.Stop()
+	for _, row := range rows {
+		if err := sto.ImportChannel(row.ch, row.shard, "cli"); err != nil {
+			report.fail(row.row, string(row.ch), "%v", err)
+			continue
+		}
+		report.ok(row.row, string(row.ch), "imported in shard %d", row.shard)
+	}
+	return report.done()
+}
+
+// existingChannels returns the rows whose channel exists in twitch, reporting
+// the rest. Every row is kept if the Helix API is not configured
+func existingChannels(rows []*channelRow, report *importReport) ([]*channelRow, error) {
+	if len(rows) == 0 {
+		return rows, nil
+	}
+	if cfg.HelixClientID == "" {
+		log.Print("HELIX_CLIENT_ID is not set, the channels are not checked against twitch")
+		return rows, nil
+	}
+	logins := make([]string, len(rows))
+	for i, row := range rows {
+		logins[i] = string(row.ch)
+	}
+	users, err := helix.New(cfg.HelixClientID, cfg.HelixToken).Users(context.Background(), logins)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool, len(users))
+	for _, u := range users {
+		found[u.Login] = true
+	}
+	existing := rows[:0]
+	for _, row := range rows {
+		if !found[string(row.ch)] {
+			report.fail(row.row, string(row.ch), "%v", bot.ErrChannelNotFound)
+			continue
+		}
+		existing = append(existing, row)
+	}
+	return existing, nil
+}
+
+// watchlist is the format of an imported watchlist
+type watchlist struct {
+	Name  string   `json:"name"`
+	Users []string `json:"users"`
+}
+
+// importWatchlist replaces the users of a watchlist and tags their stored
+// bans, see bot.Storage.ImportWatchlist. The rows are the users, from 1
+func importWatchlist(in io.Reader, dryRun bool) error {
+	var list watchlist
+	if err := json.NewDecoder(in).Decode(&list); err != nil {
+		return errors.WrapWithContext(ErrWatchlist, struct{ Cause string }{err.Error()})
+	}
+	list.Name = strings.ToLower(strings.TrimSpace(list.Name))
+	if !watchlistPattern.MatchString(list.Name) {
+		return errors.WrapWithContext(ErrWatchlist, struct{ Name string }{list.Name})
+	}
+
+	var (
+		report importReport
+		users  []string
+		rows   = make(map[string]int)
+	)
+	for i, u := range list.Users {
+		row := i + 1
+		login := strings.ToLower(strings.TrimSpace(u))
+		if !loginPattern.MatchString(login) {
+			report.fail(row, u, "invalid user login")
+			continue
+		}
+		if prev, ok := rows[login]; ok {
+			report.fail(row, login, "duplicate of row %d", prev)
+			continue
+		}
+		rows[login] = row
+		users = append(users, login)
+	}
+	if dryRun {
+		for _, u := range users {
+			report.ok(rows[u], u, "would be added to %s%s", bot.WatchlistPrefix, list.Name)
+		}
+		return report.done()
+	}
+
+	sto := openStorage()
+	defer sto.Stop()
+	failed, err := sto.ImportWatchlist(list.Name, users, "cli")
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		if err, ok := failed[u]; ok {
+			report.fail(rows[u], u, "%v", err)
+			continue
+		}
+		report.ok(rows[u], u, "added to %s%s", bot.WatchlistPrefix, list.Name)
+	}
+	return report.done()
+}
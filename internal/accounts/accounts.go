@@ -0,0 +1,193 @@
+// Package accounts enriches the stored bans with the age of the account of the
+// banned user and, optionally, how long the user had followed the channel, so
+// throwaway accounts can be told apart from established users.
+package accounts
+
+import (
+	"container/list"
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/helix"
+)
+
+const (
+	// QueueSize is the number of jobs waiting to be enriched before new ones
+	// are dropped
+	QueueSize = 1000
+	// BatchInterval is the maximum time a job waits to be enriched with the
+	// rest of its batch
+	BatchInterval = 5 * time.Second
+	// CacheSize is the number of accounts whose creation date is kept in memory
+	CacheSize = 10000
+)
+
+// Source gets the accounts from twitch. helix.Client implements it
+type Source interface {
+	Users(ctx context.Context, logins []string) ([]*helix.User, error)
+	FollowedAt(ctx context.Context, broadcasterID, userID string) (*time.Time, error)
+}
+
+// Job is a stored ban to be enriched
+type Job struct {
+	Username  string
+	Channel   string
+	ChannelID string
+	At        time.Time
+}
+
+// Age is the enrichment of a ban
+type Age struct {
+	CreatedAt time.Time
+	// FollowedAt is nil if the user didn't follow the channel or the follow age
+	// is disabled
+	FollowedAt *time.Time
+}
+
+type account struct {
+	id        string
+	createdAt time.Time
+}
+
+// cache is a least recently used cache of the accounts by login
+type cache struct {
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type entry struct {
+	login string
+	acc   account
+}
+
+func (c *cache) get(login string) (account, bool) {
+	el, ok := c.items[login]
+	if !ok {
+		return account{}, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*entry).acc, true
+}
+
+func (c *cache) add(login string, acc account) {
+	if el, ok := c.items[login]; ok {
+		el.Value.(*entry).acc = acc
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[login] = c.order.PushFront(&entry{login, acc})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry).login)
+	}
+}
+
+func newCache(size int) *cache {
+	return &cache{size: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Enricher gets the age of the accounts of the stored bans in batches in the
+// background and passes the results to a store function. Like the link
+// enrichment, it is best-effort: jobs are dropped rather than slowing down the
+// ingestion.
+type Enricher struct {
+	src     Source
+	follows bool
+	store   func(job *Job, age *Age) error
+	jobs    chan *Job
+	// cache is only accessed from the goroutine of Start
+	cache *cache
+}
+
+// Enqueue schedules the job. It never blocks, and reports whether the job was
+// scheduled
+func (e *Enricher) Enqueue(job *Job) bool {
+	select {
+	case e.jobs <- job:
+		return true
+	default:
+		log.Printf("account enrichment queue full, dropping :%s", job.Username)
+		return false
+	}
+}
+
+// Start enriches the jobs until ctx is done
+func (e *Enricher) Start(ctx context.Context) {
+	t := time.NewTicker(BatchInterval)
+	defer t.Stop()
+	batch := make([]*Job, 0, helix.MaxUsersPerRequest)
+	for {
+		select {
+		case job := <-e.jobs:
+			batch = append(batch, job)
+			if len(batch) < helix.MaxUsersPerRequest {
+				continue
+			}
+		case <-t.C:
+			if len(batch) == 0 {
+				continue
+			}
+		case <-ctx.Done():
+			return
+		}
+		e.process(ctx, batch)
+		batch = batch[:0]
+	}
+}
+
+// process enriches a batch of jobs with a single request for the accounts not
+// cached
+func (e *Enricher) process(ctx context.Context, batch []*Job) {
+	var missing []string
+	for _, job := range batch {
+		if _, ok := e.cache.get(strings.ToLower(job.Username)); !ok {
+			missing = append(missing, strings.ToLower(job.Username))
+		}
+	}
+	if len(missing) > 0 {
+		users, err := e.src.Users(ctx, missing)
+		if err != nil {
+			errors.WrapAndLog(err)
+			return
+		}
+		for _, u := range users {
+			e.cache.add(strings.ToLower(u.Login), account{id: u.ID, createdAt: u.CreatedAt})
+		}
+	}
+
+	for _, job := range batch {
+		acc, ok := e.cache.get(strings.ToLower(job.Username))
+		if !ok {
+			// the account doesn't exist anymore, e.g. it was suspended
+			continue
+		}
+		age := &Age{CreatedAt: acc.createdAt}
+		if e.follows && job.ChannelID != "" {
+			followedAt, err := e.src.FollowedAt(ctx, job.ChannelID, acc.id)
+			if err != nil {
+				errors.WrapAndLog(err)
+			}
+			age.FollowedAt = followedAt
+		}
+		if err := e.store(job, age); err != nil {
+			errors.WrapAndLog(err)
+		}
+	}
+}
+
+// NewEnricher creates an enricher that gets the accounts from `src`, and the
+// follow age too if `follows` is true, and stores the results with `store`
+func NewEnricher(src Source, follows bool, store func(job *Job, age *Age) error) *Enricher {
+	return &Enricher{
+		src:     src,
+		follows: follows,
+		store:   store,
+		jobs:    make(chan *Job, QueueSize),
+		cache:   newCache(CacheSize),
+	}
+}
@@ -0,0 +1,85 @@
+package accounts
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/helix"
+)
+
+type fakeSource struct {
+	created  time.Time
+	followed time.Time
+	// requested are the logins of every Users call
+	requested [][]string
+}
+
+func (f *fakeSource) Users(ctx context.Context, logins []string) ([]*helix.User, error) {
+	f.requested = append(f.requested, logins)
+	var users []*helix.User
+	for _, l := range logins {
+		if l != "suspended" {
+			users = append(users, &helix.User{ID: "id-" + l, Login: l, CreatedAt: f.created})
+		}
+	}
+	return users, nil
+}
+
+func (f *fakeSource) FollowedAt(ctx context.Context, broadcasterID, userID string) (*time.Time, error) {
+	if userID != "id-follower" {
+		return nil, nil
+	}
+	return &f.followed, nil
+}
+
+func TestEnricher(t *testing.T) {
+	t.Parallel()
+	src := &fakeSource{
+		created:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		followed: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	stored := make(map[string]*Age)
+	e := NewEnricher(src, true, func(job *Job, age *Age) error {
+		stored[job.Username] = age
+		return nil
+	})
+
+	ctx := context.Background()
+	e.process(ctx, []*Job{
+		{Username: "Foo", ChannelID: "1"},
+		{Username: "follower", ChannelID: "1"},
+		{Username: "suspended", ChannelID: "1"},
+	})
+	e.process(ctx, []*Job{{Username: "foo", ChannelID: "1"}, {Username: "bar"}})
+
+	if len(src.requested) != 2 || len(src.requested[1]) != 1 || src.requested[1][0] != "bar" {
+		t.Fatalf("expected the cached accounts not to be requested again, got %v", src.requested)
+	}
+	if _, ok := stored["suspended"]; ok {
+		t.Fatal("expected missing accounts not to be stored")
+	}
+	if age := stored["Foo"]; age == nil || !age.CreatedAt.Equal(src.created) || age.FollowedAt != nil {
+		t.Fatalf("unexpected age of Foo: %+v", age)
+	}
+	if age := stored["follower"]; age == nil || age.FollowedAt == nil || !age.FollowedAt.Equal(src.followed) {
+		t.Fatalf("unexpected age of follower: %+v", age)
+	}
+}
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+	c := newCache(2)
+	c.add("a", account{id: "1"})
+	c.add("b", account{id: "2"})
+	c.get("a")
+	c.add("c", account{id: "3"})
+	if _, ok := c.get("b"); ok {
+		t.Fatal("expected the least recently used entry to be evicted")
+	}
+	for _, login := range []string{"a", "c"} {
+		if _, ok := c.get(login); !ok {
+			t.Fatalf("expected %s to be cached", login)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Package analysis implements the offline analyses over the stored
+// moderations.
+package analysis
+
+import (
+	"sort"
+	"strings"
+)
+
+// Reasons why two accounts are clustered together
+const (
+	ReasonUsername = "username"
+	ReasonMessages = "messages"
+)
+
+// Account is a moderated user with its moderated messages
+type Account struct {
+	Username string
+	Messages []string
+}
+
+type EvasionOptions struct {
+	// MaxDistance is the maximum edit distance between two similar usernames
+	MaxDistance int
+	// MinUsernameLength is the minimum length of the usernames compared by
+	// edit distance, short usernames are too close to each other by chance
+	MinUsernameLength int
+	// MinSimilarity is the minimum Jaccard similarity between the words of the
+	// messages of two accounts
+	MinSimilarity float64
+	// MinWords is the minimum number of distinct words of the messages of an
+	// account to compare them
+	MinWords int
+}
+
+// Cluster is a group of accounts likely owned by the same person
+type Cluster struct {
+	Usernames []string
+	Reasons   []string
+}
+
+// Levenshtein returns the edit distance between a and b
+func Levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// words returns the distinct lowercased words of the messages
+func words(msgs []string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, m := range msgs {
+		for _, w := range strings.Fields(strings.ToLower(m)) {
+			set[w] = struct{}{}
+		}
+	}
+	return set
+}
+
+// Jaccard returns the Jaccard similarity of two sets
+func Jaccard(a, b map[string]struct{}) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+	inter := 0
+	for w := range a {
+		if _, ok := b[w]; ok {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
+
+// unionFind is a disjoint-set of the indexes of the accounts
+type unionFind []int
+
+func (u unionFind) find(i int) int {
+	for u[i] != i {
+		u[i] = u[u[i]]
+		i = u[i]
+	}
+	return i
+}
+
+func (u unionFind) union(i, j int) {
+	u[u.find(i)] = u.find(j)
+}
+
+// Evasion clusters the accounts by the similarity of their usernames and of
+// their messages. Only clusters of two or more accounts are returned, sorted
+// by their first username. It compares every pair of accounts, so it is meant
+// for the moderations of a channel within a time window.
+func Evasion(accounts []*Account, opts EvasionOptions) []*Cluster {
+	// the same user may be moderated more than once
+	byName := make(map[string]*Account, len(accounts))
+	for _, a := range accounts {
+		name := strings.ToLower(a.Username)
+		if prev, ok := byName[name]; ok {
+			prev.Messages = append(prev.Messages, a.Messages...)
+			continue
+		}
+		byName[name] = &Account{Username: name, Messages: append([]string(nil), a.Messages...)}
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bags := make([]map[string]struct{}, len(names))
+	for i, name := range names {
+		bags[i] = words(byName[name].Messages)
+	}
+
+	uf := make(unionFind, len(names))
+	for i := range uf {
+		uf[i] = i
+	}
+	// reasons by the root of the pair when it was merged, resolved at the end
+	type edge struct {
+		i      int
+		reason string
+	}
+	var edges []edge
+	for i := 0; i < len(names); i++ {
+		for j := i + 1; j < len(names); j++ {
+			a, b := names[i], names[j]
+			if len(a) >= opts.MinUsernameLength && len(b) >= opts.MinUsernameLength &&
+				abs(len(a)-len(b)) <= opts.MaxDistance &&
+				Levenshtein(a, b) <= opts.MaxDistance {
+				uf.union(i, j)
+				edges = append(edges, edge{i, ReasonUsername})
+			}
+			if len(bags[i]) >= opts.MinWords && len(bags[j]) >= opts.MinWords &&
+				Jaccard(bags[i], bags[j]) >= opts.MinSimilarity {
+				uf.union(i, j)
+				edges = append(edges, edge{i, ReasonMessages})
+			}
+		}
+	}
+
+	groups := make(map[int]*Cluster)
+	reasons := make(map[int]map[string]bool)
+	for i, name := range names {
+		root := uf.find(i)
+		c, ok := groups[root]
+		if !ok {
+			c = &Cluster{}
+			groups[root] = c
+			reasons[root] = make(map[string]bool)
+		}
+		c.Usernames = append(c.Usernames, name)
+	}
+	for _, e := range edges {
+		reasons[uf.find(e.i)][e.reason] = true
+	}
+
+	clusters := make([]*Cluster, 0)
+	for root, c := range groups {
+		if len(c.Usernames) < 2 {
+			continue
+		}
+		for _, r := range []string{ReasonUsername, ReasonMessages} {
+			if reasons[root][r] {
+				c.Reasons = append(c.Reasons, r)
+			}
+		}
+		clusters = append(clusters, c)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Usernames[0] < clusters[j].Usernames[0]
+	})
+	return clusters
+}
@@ -0,0 +1,76 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"spammer1", "spammer2", 1},
+		{"spammer", "spammer_99", 3},
+	}
+	for _, tt := range tests {
+		if got := Levenshtein(tt.a, tt.b); got != tt.want {
+			t.Fatalf("Levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestEvasion(t *testing.T) {
+	t.Parallel()
+	opts := EvasionOptions{MaxDistance: 2, MinUsernameLength: 5, MinSimilarity: .6, MinWords: 3}
+	tests := []struct {
+		name     string
+		accounts []*Account
+		want     []*Cluster
+	}{
+		{
+			name: "similar usernames",
+			accounts: []*Account{
+				{Username: "trollface1"},
+				{Username: "TrollFace22"},
+				{Username: "someoneelse"},
+			},
+			want: []*Cluster{{Usernames: []string{"trollface1", "trollface22"}, Reasons: []string{ReasonUsername}}},
+		},
+		{
+			name: "short usernames are not compared",
+			accounts: []*Account{
+				{Username: "abc"},
+				{Username: "abd"},
+			},
+			want: []*Cluster{},
+		},
+		{
+			name: "similar messages and transitive clusters",
+			accounts: []*Account{
+				{Username: "alpha", Messages: []string{"buy cheap followers at my site"}},
+				{Username: "omega", Messages: []string{"BUY cheap followers at my site now"}},
+				{Username: "omega1"},
+				{Username: "unrelated", Messages: []string{"what a play by the streamer"}},
+			},
+			want: []*Cluster{{Usernames: []string{"alpha", "omega", "omega1"}, Reasons: []string{ReasonUsername, ReasonMessages}}},
+		},
+		{
+			name: "repeated moderations of the same user",
+			accounts: []*Account{
+				{Username: "repeat", Messages: []string{"a"}},
+				{Username: "repeat", Messages: []string{"b"}},
+			},
+			want: []*Cluster{},
+		},
+	}
+	for _, tt := range tests {
+		if got := Evasion(tt.accounts, opts); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
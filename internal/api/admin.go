@@ -0,0 +1,225 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/bot"
+	"github.com/hammertrack/tracker/logger"
+)
+
+// handleAdminUsers routes the admin operations over a single user:
+//
+// POST /admin/users/{username}/purge?dry_run=true
+func (s *Server) handleAdminUsers(w http.ResponseWriter, r *http.Request) {
+	params := pathParams(r.URL.Path, "/admin/users/")
+	if len(params) != 2 || params[1] != "purge" {
+		writeError(w, http.StatusNotFound, ErrNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	s.handlePurgeUser(w, r, params[0])
+}
+
+func (s *Server) handlePurgeUser(w http.ResponseWriter, r *http.Request, username string) {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	report, err := s.sto.PurgeUser(username, "api:"+r.RemoteAddr, dryRun)
+	if err != nil {
+		if errors.Is(err, bot.ErrUnsupported) {
+			writeError(w, http.StatusNotImplemented, err)
+			return
+		}
+		errors.WrapAndLog(err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !dryRun {
+		s.bot.ForgetUser(report.Username)
+		for _, alias := range report.Aliases {
+			s.bot.ForgetUser(alias)
+		}
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleAdminModerations routes the corrections of the stored moderations:
+//
+// GET /admin/moderations/{username}?channel=foo&limit=50&region=eu
+// PUT /admin/moderations/{username}/{channel}/{at} {"deleted": true, "note": "misclick"}
+//
+// `at` is the RFC 3339 time of the moderation, as returned by the GET, which
+// unlike the default queries includes the soft-deleted moderations
+func (s *Server) handleAdminModerations(w http.ResponseWriter, r *http.Request) {
+	params := pathParams(r.URL.Path, "/admin/moderations/")
+	switch {
+	case len(params) == 1 && r.Method == http.MethodGet:
+		ch := bot.Channel(r.URL.Query().Get("channel"))
+		mods, err := s.sto.AuditModerations(params[0], ch, limit(r))
+		if err != nil {
+			writeCorrectionError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, fromRegion(r, mods))
+	case len(params) == 3 && r.Method == http.MethodPut:
+		s.handleCorrectModeration(w, r, params[0], bot.Channel(params[1]), params[2])
+	case len(params) == 1 || len(params) == 3:
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+	default:
+		writeError(w, http.StatusNotFound, ErrNotFound)
+	}
+}
+
+func (s *Server) handleCorrectModeration(w http.ResponseWriter, r *http.Request, username string, ch bot.Channel, rawAt string) {
+	at, err := time.Parse(time.RFC3339Nano, rawAt)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err))
+		return
+	}
+	var c bot.Correction
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&c); err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err))
+		return
+	}
+	if err := s.sto.CorrectModeration(username, ch, at, &c, "api:"+r.RemoteAddr); err != nil {
+		writeCorrectionError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+func writeCorrectionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, bot.ErrUnsupported):
+		writeError(w, http.StatusNotImplemented, err)
+	case errors.Is(err, bot.ErrModerationNotFound):
+		writeError(w, http.StatusNotFound, err)
+	default:
+		errors.WrapAndLog(err)
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// handleChatSilence turns on and off the kill switch of the messages of the
+// bot in chat:
+//
+// GET /admin/chat/silence
+// POST /admin/chat/silence
+// DELETE /admin/chat/silence
+func (s *Server) handleChatSilence(w http.ResponseWriter, r *http.Request) {
+	actor := "api:" + r.RemoteAddr
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		s.bot.SilenceChat(true, actor)
+	case http.MethodDelete:
+		s.bot.SilenceChat(false, actor)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Silenced bool `json:"silenced"`
+	}{s.bot.ChatSilenced()})
+}
+
+type logging struct {
+	Level string `json:"level"`
+	// Debug are the subsystems with debug logs, see logger.Subsystems
+	Debug []string `json:"debug"`
+}
+
+// handleLogging returns and changes the verbosity of the logs at runtime,
+// without a restart that would lose the in-memory history of the channels:
+//
+// GET /admin/logging
+// PUT /admin/logging {"level": "info", "debug": {"irc": true, "storage": false}}
+//
+// The omitted level and subsystems are left as they are
+func (s *Server) handleLogging(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var body struct {
+			Level string          `json:"level"`
+			Debug map[string]bool `json:"debug"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, errors.Wrap(err))
+			return
+		}
+		// validated first, so a bad request changes nothing
+		for subsystem := range body.Debug {
+			if !logger.IsSubsystem(subsystem) {
+				writeError(w, http.StatusBadRequest, logger.ErrSubsystem)
+				return
+			}
+		}
+		if body.Level != "" {
+			if err := logger.SetLevel(body.Level); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		for subsystem, on := range body.Debug {
+			if err := logger.SetDebug(subsystem, on); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		log.Printf("logs set to level %s with debug of %v by api:%s", logger.Level(), logger.Debugging(), r.RemoteAddr)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, &logging{Level: logger.Level(), Debug: logger.Debugging()})
+}
+
+// handleMaintenance pauses and resumes the ingestion, e.g. during a
+// maintenance of the database:
+//
+// GET /admin/maintenance
+// POST /admin/maintenance {"reason": "database upgrade"}
+// DELETE /admin/maintenance
+//
+// The moderations received while paused are held in memory and stored on the
+// resume, see bot.Storage.Pause
+func (s *Server) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	actor := "api:" + r.RemoteAddr
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.sto.Maintenance())
+	case http.MethodPost:
+		var body struct {
+			Reason string `json:"reason"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, http.StatusBadRequest, errors.Wrap(err))
+			return
+		}
+		if err := s.sto.Pause(body.Reason, actor); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.sto.Maintenance())
+	case http.MethodDelete:
+		held, err := s.sto.Resume(actor)
+		if err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, struct {
+			Held int `json:"held"`
+		}{held})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+	}
+}
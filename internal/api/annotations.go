@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/bot"
+)
+
+// handleAnnotations lists the notes of the moderators about the user in the
+// channel, or adds one, about one of their moderations if `moderation_at` is
+// set:
+//
+// GET /channels/{channel}/users/{username}/annotations
+// POST /channels/{channel}/users/{username}/annotations {"note": "ban appealed and upheld", "moderation_at": "2023-07-01T00:00:00Z"}
+//
+// The author of the note is the API key, or the address of the admin
+func (s *Server) handleAnnotations(w http.ResponseWriter, r *http.Request, ch bot.Channel, username string) {
+	t := tenantOf(r)
+	if r.Method == http.MethodGet {
+		var (
+			all []*bot.Annotation
+			err error
+		)
+		if t != nil {
+			all, err = s.sto.TenantAnnotations(t.ID, username, ch)
+		} else {
+			all, err = s.sto.Annotations(username, ch)
+		}
+		if err != nil {
+			writeAnnotationError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, all)
+		return
+	}
+	a := &bot.Annotation{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(a); err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err))
+		return
+	}
+	a.Channel, a.Username = string(ch), username
+	author := "api:" + r.RemoteAddr
+	var err error
+	if t != nil {
+		author = "key:" + accessOf(r).KeyID
+		err = s.sto.TenantAnnotate(t.ID, a, author)
+	} else {
+		err = s.sto.Annotate(a, author)
+	}
+	if err != nil {
+		writeAnnotationError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, a)
+}
+
+func writeAnnotationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, bot.ErrAnnotationNote):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, bot.ErrModerationNotFound):
+		writeError(w, http.StatusNotFound, err)
+	default:
+		writeFeedError(w, err)
+	}
+}
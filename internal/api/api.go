@@ -0,0 +1,258 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/bot"
+	"github.com/hammertrack/tracker/internal/bus"
+	"github.com/hammertrack/tracker/internal/cache"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/metrics"
+	"github.com/hammertrack/tracker/internal/stream"
+	"github.com/hammertrack/tracker/logger"
+)
+
+const (
+	// Time given to the in-flight requests to finish when stopping the server
+	ShutdownTimeout = 5 * time.Second
+	ReadTimeout     = 10 * time.Second
+	WriteTimeout    = 30 * time.Second
+)
+
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrMethodNotAllowed = errors.New("method not allowed")
+	ErrUnauthorized     = errors.New("unauthorized")
+	ErrForbidden        = errors.New("the API key lacks the role or the channel")
+	ErrAdminDisabled    = errors.New("admin endpoints are disabled, set ADMIN_TOKEN to enable them")
+)
+
+// TokenCookie is the cookie holding the token of the dashboard, set when it is
+// opened with a token query parameter, so that the browser authenticates the
+// requests of the dashboard to /stats and /stream
+const TokenCookie = "tracker_token"
+
+// Server is the HTTP API of the tracker. It exposes the stored data and the
+// administrative operations of a running tracker.
+type Server struct {
+	srv *http.Server
+	mux *http.ServeMux
+	sto *bot.Storage
+	bot *bot.Bot
+	// hub streams the stored moderations
+	hub *stream.Hub
+	// debug streams the results of the processed moderations
+	debug *stream.Hub
+	// statsCache is by tenant, timesToAction by channel and query. They are nil
+	// if disabled
+	statsCache    *cache.Cache[*stats]
+	timesToAction *cache.Cache[metrics.Summary]
+	// searches is nil if the searches of the API keys are unlimited
+	searches *searchQuota
+}
+
+// Start listens and serves the API until Stop is called. It serves on `l`
+// instead if not nil, e.g. a socket passed by systemd
+func (s *Server) Start(l net.Listener) error {
+	var err error
+	if l != nil {
+		log.Printf("API listening on %s", l.Addr())
+		err = s.srv.Serve(l)
+	} else {
+		log.Printf("API listening on %s", s.srv.Addr)
+		err = s.srv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Stop gracefully shuts down the server, waiting up to ShutdownTimeout for the
+// in-flight requests
+func (s *Server) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	return s.srv.Shutdown(ctx)
+}
+
+// admin wraps a handler so it is only accessible with the admin token
+func (s *Server) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg.AdminToken == "" {
+			writeError(w, http.StatusForbidden, ErrAdminDisabled)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) != 1 {
+			writeError(w, http.StatusUnauthorized, ErrUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// credentials returns the token of the request: the bearer token, or else the
+// token query parameter or the TokenCookie, as browsers cannot set headers
+// when navigating or with EventSource
+func credentials(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	if c, err := r.Cookie(TokenCookie); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// viewer wraps a handler so it is only accessible with the admin token or with
+// an API key of a tenant, see credentials. The access of the key is available
+// to the handler with accessOf and its tenant with tenantOf, nil for the
+// admin, who sees every channel
+func (s *Server) viewer(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := credentials(r)
+		if cfg.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) == 1 {
+			next(w, r.WithContext(context.WithValue(r.Context(), accessKey{}, (*bot.Access)(nil))))
+			return
+		}
+		a, err := s.sto.Authenticate(token)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), accessKey{}, a)))
+	}
+}
+
+func (s *Server) routes() {
+	s.mux.HandleFunc("/admin/users/", s.admin(s.handleAdminUsers))
+	s.mux.HandleFunc("/admin/channels/", s.admin(s.handleAdminChannels))
+	s.mux.HandleFunc("/admin/moderations/", s.admin(s.handleAdminModerations))
+	s.mux.HandleFunc("/admin/debug/pipeline", s.admin(s.handleDebugStream))
+	s.mux.HandleFunc("/admin/maintenance", s.admin(s.handleMaintenance))
+	s.mux.HandleFunc("/admin/chat/silence", s.admin(s.handleChatSilence))
+	s.mux.HandleFunc("/admin/logging", s.admin(s.handleLogging))
+	s.mux.HandleFunc("/healthz", s.handleHealthz)
+	s.mux.HandleFunc("/openapi.json", s.handleOpenAPI)
+	s.mux.HandleFunc("/v1/channels", s.tenant(s.handleTenantChannels))
+	s.mux.HandleFunc("/v1/channels/", s.tenant(s.handleTenantChannel))
+	s.mux.HandleFunc("/v1/users/", s.tenant(s.handleTenantUsers))
+	s.mux.HandleFunc("/v1/feeds/", s.tenant(s.handleFeeds))
+	s.mux.Handle("/metrics", metrics.Default.Handler())
+	s.mux.HandleFunc("/stream", s.viewer(s.handleStream))
+	s.mux.HandleFunc("/stats", s.viewer(s.handleStats))
+	s.mux.HandleFunc("/channels/", s.viewer(s.handleChannels))
+	s.mux.HandleFunc("/groups", s.viewer(s.handleGroups))
+	s.mux.HandleFunc("/groups/", s.viewer(s.handleGroups))
+	s.mux.HandleFunc("/users/lookup", s.viewer(s.handleLookupUsers))
+	s.mux.HandleFunc("/search", s.viewer(s.handleSearch))
+	s.mux.HandleFunc("/ui/", s.viewer(s.handleUI()))
+}
+
+// handleHealthz returns the status of the tracker, with no authentication for
+// the probes of load balancers and orchestrators:
+//
+// GET /healthz
+//
+// The status code is 503 while the tracker is degraded, but not when the
+// ingestion was paused on purpose, see bot.StatusMaintenance
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	h := s.bot.Health()
+	code := http.StatusOK
+	if h.Status == bot.StatusDegraded {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, struct {
+		Status string `json:"status"`
+	}{h.Status})
+}
+
+// identify sets the Server header of every response to the identity of the
+// instance, see cfg.UserAgent
+func identify(next http.Handler) http.Handler {
+	server := cfg.UserAgent()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", server)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// logRequests writes the requests to the debug logs of the api
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !logger.Enabled(logger.API) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		logger.Debugf(logger.API, "%s %s from %s in %s", r.Method, r.URL.Path, r.RemoteAddr, time.Since(start))
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		errors.WrapAndLog(err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
+// pathParams splits the path after `prefix` into its segments, e.g.
+// pathParams("/admin/users/foo/purge", "/admin/users/") = ["foo", "purge"]
+func pathParams(path, prefix string) []string {
+	path = strings.Trim(strings.TrimPrefix(path, prefix), "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// New creates the API server. The server is not started until Start is called.
+// It must be created before starting the bot, see bot.Storage.Stored
+func New(addr string, sto *bot.Storage, b *bot.Bot) *Server {
+	s := &Server{
+		mux:   http.NewServeMux(),
+		sto:   sto,
+		bot:   b,
+		hub:   stream.New(StreamBacklog, StreamBuffer),
+		debug: stream.New(StreamBacklog, StreamBuffer),
+
+		statsCache:    newCache[*stats]("stats", cfg.StatsCacheSeconds),
+		timesToAction: newCache[metrics.Summary]("time-to-action", cfg.TimeToActionCacheSeconds),
+		searches:      newSearchQuota(),
+	}
+	// the streams drop the events of their slow clients anyway
+	sto.Stored().Subscribe("stream", StreamBuffer, bus.Drop, s.publish)
+	sto.Results().Subscribe("debug-stream", StreamBuffer, bus.Drop, s.publishResult)
+	s.srv = &http.Server{
+		Addr:         addr,
+		Handler:      identify(logRequests(s.mux)),
+		ReadTimeout:  ReadTimeout,
+		WriteTimeout: WriteTimeout,
+	}
+	s.routes()
+	return s
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"time"
+
+	"github.com/hammertrack/tracker/internal/cache"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/metrics"
+)
+
+// CacheSize is the maximum number of results cached by endpoint
+const CacheSize = 1000
+
+var cacheResults = metrics.NewCounterVec(
+	"hammertrack_api_cache_total",
+	"Requests of the cached endpoints and failed refreshes, by endpoint and result: hit, stale, miss or refresh_error.",
+	"endpoint", "result",
+)
+
+// newCache creates the cache of the results of an endpoint, served for
+// `ttlSeconds` and then for cfg.APICacheStaleSeconds more while they are
+// refreshed. It returns nil, which caches nothing, if ttlSeconds is 0
+func newCache[V any](endpoint string, ttlSeconds int) *cache.Cache[V] {
+	ttl := time.Duration(ttlSeconds) * time.Second
+	stale := time.Duration(cfg.APICacheStaleSeconds) * time.Second
+	return cache.New[V](ttl, stale, CacheSize, func(r cache.Result) {
+		cacheResults.Inc(endpoint, string(r))
+	})
+}
@@ -0,0 +1,270 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/bot"
+	"github.com/hammertrack/tracker/internal/metrics"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+// DefaultTimeToActionWindow is the period of the time to action returned
+// without `from`
+const DefaultTimeToActionWindow = 7 * 24 * time.Hour
+
+// DefaultBansWindow is the period of the bans returned without `from`
+const DefaultBansWindow = 30 * 24 * time.Hour
+
+// handleAdminChannels routes the admin operations over a single channel:
+//
+// GET /admin/channels/{channel}/evasion-clusters?limit=50
+// GET /admin/channels/{channel}/time-to-action?from=2023-07-01T00:00:00Z&to=2023-07-31T00:00:00Z
+// GET /admin/channels/{channel}/active-bans
+func (s *Server) handleAdminChannels(w http.ResponseWriter, r *http.Request) {
+	params := pathParams(r.URL.Path, "/admin/channels/")
+	if len(params) != 2 {
+		writeError(w, http.StatusNotFound, ErrNotFound)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	switch params[1] {
+	case "evasion-clusters":
+		s.handleEvasionClusters(w, r, bot.Channel(params[0]))
+	case "time-to-action":
+		s.handleTimeToAction(w, r, bot.Channel(params[0]))
+	case "active-bans":
+		s.handleActiveBans(w, r, bot.Channel(params[0]))
+	default:
+		writeError(w, http.StatusNotFound, ErrNotFound)
+	}
+}
+
+// handleTimeToAction summarizes the stored times to action of the channel. The
+// summaries are cached by query, see cfg.TimeToActionCacheSeconds
+func (s *Server) handleTimeToAction(w http.ResponseWriter, r *http.Request, ch bot.Channel) {
+	from, to, err := timeRange(r, DefaultTimeToActionWindow)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	key := strings.ToLower(string(ch)) + "?" + r.URL.RawQuery
+	summary, err := s.timesToAction.Get(key, func() (metrics.Summary, error) {
+		return s.sto.TimeToAction(ch, from, to)
+	})
+	if err != nil {
+		if errors.Is(err, bot.ErrUnsupported) {
+			writeError(w, http.StatusNotImplemented, err)
+			return
+		}
+		errors.WrapAndLog(err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// timeRange returns the `from` and `to` query parameters, by default the last
+// `window` until now
+func timeRange(r *http.Request, window time.Duration) (from, to time.Time, err error) {
+	to = time.Now()
+	from = to.Add(-window)
+	for name, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		v := r.URL.Query().Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return from, to, errors.Wrap(err)
+		}
+		*dst = t
+	}
+	return from, to, nil
+}
+
+// handleChannels routes the operations over a channel for the viewers. Tenants
+// only see their own channels, and the API keys the ones they are scoped to.
+// The timelines and the annotations of the users are for the moderators:
+//
+// GET /channels/{channel}/active-bans
+// GET /channels/{channel}/bans?subscribers=true&from=2023-07-01T00:00:00Z&to=2023-07-31T00:00:00Z&limit=50
+// GET /channels/{channel}/chat-clears?from=2023-07-01T00:00:00Z&to=2023-07-31T00:00:00Z
+// GET /channels/{channel}/users/{username}/timeline?before=2023-07-01T00:00:00Z&limit=50
+// GET, POST /channels/{channel}/users/{username}/annotations
+func (s *Server) handleChannels(w http.ResponseWriter, r *http.Request) {
+	params := pathParams(r.URL.Path, "/channels/")
+	user := ""
+	if len(params) == 4 && params[1] == "users" {
+		user = params[3]
+	}
+	if len(params) != 2 && user != "timeline" && user != "annotations" {
+		writeError(w, http.StatusNotFound, ErrNotFound)
+		return
+	}
+	if r.Method != http.MethodGet && !(user == "annotations" && r.Method == http.MethodPost) {
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	ch := bot.Channel(params[0])
+	role := bot.RoleViewer
+	if user != "" {
+		role = bot.RoleModerator
+	}
+	if !authorize(w, r, role, ch) {
+		return
+	}
+	switch user {
+	case "timeline":
+		s.handleTimeline(w, r, ch, params[2])
+		return
+	case "annotations":
+		s.handleAnnotations(w, r, ch, params[2])
+		return
+	}
+	switch params[1] {
+	case "active-bans":
+		if tenantOf(r) != nil {
+			s.handleTenantActiveBans(w, r, ch)
+			return
+		}
+		s.handleActiveBans(w, r, ch)
+	case "bans":
+		s.handleBans(w, r, ch)
+	case "chat-clears":
+		s.handleChatClears(w, r, ch)
+	default:
+		writeError(w, http.StatusNotFound, ErrNotFound)
+	}
+}
+
+// handleBans lists the most recent bans of the channel, only of the
+// subscribers or of the non-subscribers with `subscribers`
+func (s *Server) handleBans(w http.ResponseWriter, r *http.Request, ch bot.Channel) {
+	from, to, err := timeRange(r, DefaultBansWindow)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var subscribed *bool
+	if v := r.URL.Query().Get("subscribers"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.Wrap(err))
+			return
+		}
+		subscribed = &b
+	}
+	var bans []*bot.Moderation
+	if t := tenantOf(r); t != nil {
+		bans, err = s.sto.TenantChannelBans(t.ID, ch, from, to, subscribed, limit(r))
+	} else {
+		bans, err = s.sto.ChannelBans(ch, from, to, subscribed, limit(r))
+	}
+	if err != nil {
+		writeFeedError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, bans)
+}
+
+// handleTimeline pages through the moderations of the user in the channel,
+// the most recent first. `before` is the `next` cursor of the previous page
+func (s *Server) handleTimeline(w http.ResponseWriter, r *http.Request, ch bot.Channel, username string) {
+	var before time.Time
+	if v := r.URL.Query().Get("before"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.Wrap(err))
+			return
+		}
+		before = t
+	}
+	var (
+		timeline *bot.Timeline
+		err      error
+	)
+	if t := tenantOf(r); t != nil {
+		timeline, err = s.sto.TenantTimeline(t.ID, username, ch, before, limit(r))
+	} else {
+		timeline, err = s.sto.Timeline(username, ch, before, limit(r))
+	}
+	if err != nil {
+		writeFeedError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, timeline)
+}
+
+// handleActiveBans lists the users currently banned in the channel
+func (s *Server) handleActiveBans(w http.ResponseWriter, r *http.Request, ch bot.Channel) {
+	bans, err := s.sto.ActiveBans(ch)
+	if err != nil {
+		if errors.Is(err, bot.ErrUnsupported) || errors.Is(err, bot.ErrActiveBansDisabled) {
+			writeError(w, http.StatusNotImplemented, err)
+			return
+		}
+		errors.WrapAndLog(err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, bans)
+}
+
+func (s *Server) handleEvasionClusters(w http.ResponseWriter, r *http.Request, ch bot.Channel) {
+	clusters, err := s.sto.EvasionClusters(ch, limit(r))
+	if err != nil {
+		if errors.Is(err, bot.ErrUnsupported) {
+			writeError(w, http.StatusNotImplemented, err)
+			return
+		}
+		errors.WrapAndLog(err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, clusters)
+}
+
+// handleChatClears lists the clears of all the messages of the chat of the
+// channel, the most recent first
+func (s *Server) handleChatClears(w http.ResponseWriter, r *http.Request, ch bot.Channel) {
+	from, to, err := timeRange(r, DefaultBansWindow)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var clears []*bot.ChatClear
+	if t := tenantOf(r); t != nil {
+		clears, err = s.sto.TenantChatClears(t.ID, ch, from, to)
+	} else {
+		clears, err = s.sto.ChatClears(ch, from, to)
+	}
+	if err != nil {
+		writeFeedError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, clears)
+}
+
+// limit returns the limit query parameter, DefaultLimit if missing or invalid
+// and at most MaxLimit
+func limit(r *http.Request) int {
+	n, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || n <= 0 {
+		return DefaultLimit
+	}
+	if n > MaxLimit {
+		return MaxLimit
+	}
+	return n
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/bot"
+)
+
+// DefaultFeedWindow is the period of the ban feed returned without `since`
+const DefaultFeedWindow = 7 * 24 * time.Hour
+
+// handleFeeds routes the ban feeds of the channels sharing their bans. The
+// subscriptions of the tenant are for the admins:
+//
+// GET /v1/feeds/{channel}/bans?since=2023-07-19T00:00:00Z&limit=50
+// POST /v1/feeds/{channel}/subscriptions {"url": "https://..."}
+// DELETE /v1/feeds/{channel}/subscriptions/{id}
+func (s *Server) handleFeeds(w http.ResponseWriter, r *http.Request) {
+	params := pathParams(r.URL.Path, "/v1/feeds/")
+	switch {
+	case len(params) == 2 && params[1] == "bans":
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+			return
+		}
+		s.handleSharedBans(w, r, bot.Channel(params[0]))
+	case len(params) == 2 && params[1] == "subscriptions":
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+			return
+		}
+		if !authorize(w, r, bot.RoleAdmin, "") {
+			return
+		}
+		s.handleSubscribeFeed(w, r, bot.Channel(params[0]))
+	case len(params) == 3 && params[1] == "subscriptions":
+		if r.Method != http.MethodDelete {
+			writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+			return
+		}
+		if !authorize(w, r, bot.RoleAdmin, "") {
+			return
+		}
+		t := tenantOf(r)
+		if err := s.sto.UnsubscribeBanFeed(t.ID, bot.Channel(params[0]), params[2], "api:"+t.ID); err != nil {
+			writeFeedError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, ErrNotFound)
+	}
+}
+
+func (s *Server) handleSharedBans(w http.ResponseWriter, r *http.Request, ch bot.Channel) {
+	since := time.Now().Add(-DefaultFeedWindow)
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.Wrap(err))
+			return
+		}
+		since = t
+	}
+	bans, err := s.sto.SharedBans(ch, since, limit(r))
+	if err != nil {
+		writeFeedError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, bans)
+}
+
+func (s *Server) handleSubscribeFeed(w http.ResponseWriter, r *http.Request, ch bot.Channel) {
+	var body struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err))
+		return
+	}
+	t := tenantOf(r)
+	sub, err := s.sto.SubscribeBanFeed(t.ID, ch, body.URL, "api:"+t.ID)
+	if err != nil {
+		writeFeedError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, sub)
+}
+
+// handleTenantChannel routes the operations over a channel of the tenant. The
+// ban sharing is for the admins of the channel:
+//
+// PUT /v1/channels/{channel}/ban-sharing {"enabled": true}
+// GET /v1/channels/{channel}/active-bans
+func (s *Server) handleTenantChannel(w http.ResponseWriter, r *http.Request) {
+	params := pathParams(r.URL.Path, "/v1/channels/")
+	if len(params) == 2 && params[1] == "active-bans" {
+		if authorize(w, r, bot.RoleViewer, bot.Channel(params[0])) {
+			s.handleTenantActiveBans(w, r, bot.Channel(params[0]))
+		}
+		return
+	}
+	if len(params) != 2 || params[1] != "ban-sharing" {
+		writeError(w, http.StatusNotFound, ErrNotFound)
+		return
+	}
+	if r.Method != http.MethodPut {
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	if !authorize(w, r, bot.RoleAdmin, bot.Channel(params[0])) {
+		return
+	}
+	var body struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err))
+		return
+	}
+	t := tenantOf(r)
+	if err := s.sto.SetBanSharing(t.ID, bot.Channel(params[0]), body.Enabled, "api:"+t.ID); err != nil {
+		writeFeedError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// handleTenantActiveBans lists the users currently banned in a channel of the
+// tenant:
+//
+// GET /v1/channels/{channel}/active-bans
+func (s *Server) handleTenantActiveBans(w http.ResponseWriter, r *http.Request, ch bot.Channel) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	bans, err := s.sto.TenantActiveBans(tenantOf(r).ID, ch)
+	if err != nil {
+		writeFeedError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, bans)
+}
+
+func writeFeedError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, bot.ErrSharingDisabled), errors.Is(err, bot.ErrSubscriptionNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, bot.ErrNotChannelOwner):
+		writeError(w, http.StatusForbidden, err)
+	case errors.Is(err, bot.ErrInvalidWebhookURL):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, bot.ErrUnsupported), errors.Is(err, bot.ErrActiveBansDisabled):
+		writeError(w, http.StatusNotImplemented, err)
+	default:
+		errors.WrapAndLog(err)
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
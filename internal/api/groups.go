@@ -0,0 +1,131 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/bot"
+)
+
+type groupStats struct {
+	Group    string   `json:"group"`
+	Channels []string `json:"channels"`
+	// Moderations received by type, of every channel of the group
+	Moderations map[string]int `json:"moderations"`
+	// Moderations stored by sub status of the user, of every channel of the
+	// group
+	SubStatus map[string]int `json:"sub_status"`
+	// Timeouts stored by bucket of their duration, of every channel of the
+	// group
+	TimeoutBuckets map[string]int `json:"timeout_buckets"`
+	// ByChannel are the moderations received by channel and type
+	ByChannel map[string]map[string]int `json:"by_channel"`
+	At        time.Time                 `json:"at"`
+}
+
+// groupChannels returns the channels of the group visible to the request, all
+// of them for the admin and the ones of the tenant for the tenants
+func (s *Server) groupChannels(r *http.Request, g *bot.Group) ([]string, error) {
+	chs := make([]string, len(g.Channels))
+	for i, ch := range g.Channels {
+		chs[i] = string(ch)
+	}
+	tenantChs, err := s.tenantChannels(r)
+	if err != nil || tenantChs == nil {
+		return chs, err
+	}
+	owned := make(map[string]bool, len(tenantChs))
+	for _, ch := range tenantChs {
+		owned[ch] = true
+	}
+	visible := chs[:0]
+	for _, ch := range chs {
+		if owned[ch] {
+			visible = append(visible, ch)
+		}
+	}
+	return visible, nil
+}
+
+// handleGroups lists the groups of channels and returns the stats of a group,
+// aggregated over its channels. The tenants only see the channels they own:
+//
+// GET /groups
+// GET /groups/{group}/stats
+func (s *Server) handleGroups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	params := pathParams(r.URL.Path, "/groups")
+	switch {
+	case len(params) == 0:
+		var groups []*bot.Group
+		for _, g := range s.sto.Groups() {
+			chs, err := s.groupChannels(r, g)
+			if err != nil {
+				errors.WrapAndLog(err)
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			if len(chs) == 0 {
+				continue
+			}
+			visible := *g
+			visible.Channels = make([]bot.Channel, len(chs))
+			for i, ch := range chs {
+				visible.Channels[i] = bot.Channel(ch)
+			}
+			groups = append(groups, &visible)
+		}
+		writeJSON(w, http.StatusOK, groups)
+	case len(params) == 2 && params[1] == "stats":
+		s.handleGroupStats(w, r, params[0])
+	default:
+		writeError(w, http.StatusNotFound, ErrNotFound)
+	}
+}
+
+func (s *Server) handleGroupStats(w http.ResponseWriter, r *http.Request, name string) {
+	g, err := s.sto.Group(name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	chs, err := s.groupChannels(r, g)
+	if err != nil {
+		errors.WrapAndLog(err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(chs) == 0 {
+		writeError(w, http.StatusNotFound, bot.ErrGroupNotFound)
+		return
+	}
+	st := &groupStats{
+		Group:          g.Name,
+		Channels:       chs,
+		Moderations:    make(map[string]int),
+		SubStatus:      make(map[string]int),
+		TimeoutBuckets: make(map[string]int),
+		ByChannel:      onlyChannels(bot.ModerationCounts(), chs),
+		At:             time.Now(),
+	}
+	for _, byType := range st.ByChannel {
+		for typ, n := range byType {
+			st.Moderations[typ] += n
+		}
+	}
+	for _, bySub := range onlyChannels(bot.SubStatusCounts(), chs) {
+		for sub, n := range bySub {
+			st.SubStatus[sub] += n
+		}
+	}
+	for _, byBucket := range onlyChannels(bot.TimeoutBucketCounts(), chs) {
+		for bucket, n := range byBucket {
+			st.TimeoutBuckets[bucket] += n
+		}
+	}
+	writeJSON(w, http.StatusOK, st)
+}
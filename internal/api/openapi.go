@@ -0,0 +1,31 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+// openAPI is the spec of the tenant API. It is written by hand and must be
+// updated along with the handlers of /v1 and the client package, whose tests
+// check it
+//
+//go:embed openapi.json
+var openAPI []byte
+
+// handleOpenAPI returns the OpenAPI 3 spec of the tenant API, without
+// authentication:
+//
+// GET /openapi.json
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(openAPI); err != nil {
+		errors.WrapAndLog(err)
+	}
+}
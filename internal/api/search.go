@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/bot"
+	cfg "github.com/hammertrack/tracker/internal/config"
+)
+
+var ErrSearchQuota = errors.New("the API key went over its daily quota of searches")
+
+// searchQuota counts the searches of every API key in the current UTC day. It
+// is safe for concurrent use
+type searchQuota struct {
+	max int
+
+	mu  sync.Mutex
+	day time.Time
+	// used is by API key id
+	used map[string]int
+}
+
+// use counts a search of the key on the day of `now`. It reports whether the
+// key is within its quota
+func (q *searchQuota) use(key string, now time.Time) bool {
+	day := now.UTC().Truncate(24 * time.Hour)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !day.Equal(q.day) {
+		q.day = day
+		q.used = make(map[string]int)
+	}
+	if q.used[key] >= q.max {
+		return false
+	}
+	q.used[key]++
+	return true
+}
+
+// newSearchQuota returns nil if the searches of the API keys are unlimited
+func newSearchQuota() *searchQuota {
+	if cfg.SearchQuota <= 0 {
+		return nil
+	}
+	return &searchQuota{max: cfg.SearchQuota}
+}
+
+// handleSearch returns the moderations with a message containing a phrase,
+// whatever its case, in `channel` if not empty, and in the channels of the API
+// key for the tenants:
+//
+// GET /search?q=free+bits&channel=foo&limit=50&region=eu
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	a := accessOf(r)
+	if a != nil && !a.Role.Allows(bot.RoleModerator) {
+		writeError(w, http.StatusForbidden, ErrForbidden)
+		return
+	}
+	if a != nil && s.searches != nil && !s.searches.use(a.KeyID, time.Now()) {
+		writeError(w, http.StatusTooManyRequests, ErrSearchQuota)
+		return
+	}
+	chs, err := s.lookupChannels(r, bot.Channel(r.URL.Query().Get("channel")))
+	if err != nil {
+		errors.WrapAndLog(err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	mods, err := s.sto.SearchModerations(r.URL.Query().Get("q"), chs, limit(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, bot.ErrSearchQuery):
+			writeError(w, http.StatusBadRequest, err)
+		case errors.Is(err, bot.ErrUnsupported):
+			writeError(w, http.StatusNotImplemented, err)
+		default:
+			errors.WrapAndLog(err)
+			writeError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, fromRegion(r, mods))
+}
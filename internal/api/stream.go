@@ -0,0 +1,157 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/bot"
+	"github.com/hammertrack/tracker/internal/message"
+	"github.com/hammertrack/tracker/internal/stream"
+)
+
+const (
+	// StreamBacklog is the number of recent events replayed to the clients
+	// that reconnect with a Last-Event-ID
+	StreamBacklog = 100
+	// StreamBuffer is the number of events buffered per client before they are
+	// dropped for that client
+	StreamBuffer = 32
+	// StreamKeepAlive is the interval of the comments sent to keep the
+	// connection alive
+	StreamKeepAlive = 10 * time.Second
+	// StreamDuration is how long a stream lasts before the server ends it. It
+	// is less than WriteTimeout, the clients reconnect and resume from the
+	// last event they received
+	StreamDuration = WriteTimeout - 5*time.Second
+)
+
+var ErrStreamUnsupported = errors.New("streaming unsupported")
+
+// streamModeration is a moderation sent to the stream
+type streamModeration struct {
+	Channel  string    `json:"channel"`
+	Username string    `json:"username"`
+	Type     string    `json:"type"`
+	At       time.Time `json:"at"`
+	Duration int       `json:"duration,omitempty"`
+	Messages []string  `json:"messages"`
+	Toxicity *float64  `json:"toxicity,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+
+	AutomodStatus   string `json:"automod_status,omitempty"`
+	AutomodCategory string `json:"automod_category,omitempty"`
+}
+
+// publish sends the stored moderation to the clients of the stream
+func (s *Server) publish(msg *message.Message) {
+	m := &streamModeration{
+		Channel:  msg.Channel,
+		Username: msg.Username,
+		Type:     string(msg.Type),
+		At:       msg.At,
+		Duration: msg.Duration,
+		Messages: make([]string, len(msg.LastMessages)),
+		Toxicity: msg.Toxicity,
+		Tags:     msg.Tags,
+
+		AutomodStatus:   msg.AutomodStatus,
+		AutomodCategory: msg.AutomodCategory,
+	}
+	for i, privmsg := range msg.LastMessages {
+		m.Messages[i] = privmsg.Body
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		errors.WrapAndLog(err)
+		return
+	}
+	s.hub.Publish(msg.Channel, data)
+}
+
+// publishResult sends the result of a processed moderation to the clients of
+// the debug stream
+func (s *Server) publishResult(res *bot.PipelineResult) {
+	data, err := json.Marshal(res)
+	if err != nil {
+		errors.WrapAndLog(err)
+		return
+	}
+	s.debug.Publish(res.Channel, data)
+}
+
+func writeEvent(w http.ResponseWriter, name string, e *stream.Event) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, name, e.Data)
+}
+
+// handleStream streams the stored moderations as server-sent events, only of
+// the channels of the tenant for the tenants:
+//
+// GET /stream
+//
+// The channels of the tenant are read when connecting, the clients reconnect
+// every StreamDuration anyway
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	chs, err := s.tenantChannels(r)
+	if err != nil {
+		errors.WrapAndLog(err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.serveStream(w, r, s.hub, chs, "moderation")
+}
+
+// handleDebugStream streams the results of every processed moderation, stored
+// or not, as server-sent events:
+//
+// GET /admin/debug/pipeline
+func (s *Server) handleDebugStream(w http.ResponseWriter, r *http.Request) {
+	s.serveStream(w, r, s.debug, nil, "result")
+}
+
+// serveStream streams the events of the hub of the topics `only`, see
+// stream.Hub.Subscribe, as server-sent events of type `name`
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request, hub *stream.Hub, only []string, name string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, ErrStreamUnsupported)
+		return
+	}
+	lastID, _ := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+	events, missed := hub.Subscribe(lastID, only)
+	defer hub.Unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: 1000\n\n")
+	for _, e := range missed {
+		writeEvent(w, name, e)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(StreamKeepAlive)
+	defer keepAlive.Stop()
+	end := time.NewTimer(StreamDuration)
+	defer end.Stop()
+	for {
+		select {
+		case e := <-events:
+			writeEvent(w, name, e)
+		case <-keepAlive.C:
+			fmt.Fprintf(w, ": keep-alive\n\n")
+		case <-end.C:
+			return
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/bot"
+)
+
+type accessKey struct{}
+
+// tenant wraps a handler so it is only accessible with an API key of a tenant.
+// The access of the key is available to the handler with accessOf and its
+// tenant with tenantOf
+func (s *Server) tenant(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		a, err := s.sto.Authenticate(key)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), accessKey{}, a)))
+	}
+}
+
+// authorize returns whether the API key of the request has the role over the
+// channel, or over the whole tenant if empty, see bot.Access.Allows. If not,
+// it writes ErrForbidden. The admin token is always authorized
+func authorize(w http.ResponseWriter, r *http.Request, role bot.Role, ch bot.Channel) bool {
+	if a := accessOf(r); a != nil && !a.Allows(role, ch) {
+		writeError(w, http.StatusForbidden, ErrForbidden)
+		return false
+	}
+	return true
+}
+
+// writeAuthError writes the error of bot.Storage.Authenticate
+func writeAuthError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, bot.ErrInvalidAPIKey), errors.Is(err, bot.ErrTenantNotFound):
+		writeError(w, http.StatusUnauthorized, ErrUnauthorized)
+	case errors.Is(err, bot.ErrUnsupported):
+		writeError(w, http.StatusNotImplemented, err)
+	default:
+		errors.WrapAndLog(err)
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// tenantChannels returns the channels the API key of the request can see, nil
+// for all of them, see viewer
+func (s *Server) tenantChannels(r *http.Request) ([]string, error) {
+	a := accessOf(r)
+	if a == nil {
+		return nil, nil
+	}
+	chs, err := s.sto.TenantChannels(a.Tenant.ID)
+	if err != nil {
+		return nil, err
+	}
+	chs = a.Scope(chs)
+	names := make([]string, len(chs))
+	for i, ch := range chs {
+		names[i] = string(ch)
+	}
+	return names, nil
+}
+
+func accessOf(r *http.Request) *bot.Access {
+	return r.Context().Value(accessKey{}).(*bot.Access)
+}
+
+func tenantOf(r *http.Request) *bot.Tenant {
+	if a := accessOf(r); a != nil {
+		return a.Tenant
+	}
+	return nil
+}
+
+// handleTenantChannels lists the channels of the tenant the API key is scoped
+// to:
+//
+// GET /v1/channels
+func (s *Server) handleTenantChannels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	chs, err := s.tenantChannels(r)
+	if err != nil {
+		errors.WrapAndLog(err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, chs)
+}
+
+// handleTenantUsers returns the moderations of a user in the channels of the
+// tenant the API key is scoped to, for the moderators:
+//
+// GET /v1/users/{username}/moderations?channel=foo&limit=50&tag=caps&region=eu
+func (s *Server) handleTenantUsers(w http.ResponseWriter, r *http.Request) {
+	params := pathParams(r.URL.Path, "/v1/users/")
+	if len(params) != 2 || params[1] != "moderations" {
+		writeError(w, http.StatusNotFound, ErrNotFound)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	a := accessOf(r)
+	if !a.Role.Allows(bot.RoleModerator) {
+		writeError(w, http.StatusForbidden, ErrForbidden)
+		return
+	}
+	ch := bot.Channel(r.URL.Query().Get("channel"))
+	mods, err := s.sto.TenantModerations(a, params[0], ch, r.URL.Query().Get("tag"), limit(r))
+	if err != nil {
+		if errors.Is(err, bot.ErrUnsupported) {
+			writeError(w, http.StatusNotImplemented, err)
+			return
+		}
+		errors.WrapAndLog(err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, fromRegion(r, mods))
+}
+
+// fromRegion returns the moderations stored by the trackers of the region query
+// parameter, all of them if missing. They are filtered after the limit, so
+// fewer may be returned
+func fromRegion(r *http.Request, mods []*bot.Moderation) []*bot.Moderation {
+	region := r.URL.Query().Get("region")
+	if region == "" {
+		return mods
+	}
+	filtered := make([]*bot.Moderation, 0, len(mods))
+	for _, m := range mods {
+		if strings.EqualFold(m.Region, region) {
+			filtered = append(filtered, m)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/bot"
+	"github.com/hammertrack/tracker/internal/metrics"
+)
+
+//go:embed ui
+var uiFiles embed.FS
+
+// handleUI serves the dashboard:
+//
+// GET /ui/?token=...
+//
+// The token is kept in the TokenCookie for the next requests of the dashboard
+func (s *Server) handleUI() http.HandlerFunc {
+	files, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		// the files are embedded, it cannot fail
+		panic(err)
+	}
+	fileServer := http.StripPrefix("/ui/", http.FileServer(http.FS(files)))
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("token"); token != "" {
+			http.SetCookie(w, &http.Cookie{
+				Name:     TokenCookie,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+		fileServer.ServeHTTP(w, r)
+	}
+}
+
+type stats struct {
+	// Health is only returned to the admin, it is about the whole tracker
+	Health *bot.Health `json:"health,omitempty"`
+	// Moderations received by channel and type
+	Moderations map[string]map[string]int `json:"moderations"`
+	// Moderations stored by channel and sub status of the user
+	SubStatus map[string]map[string]int `json:"sub_status"`
+	// Timeouts stored by channel and bucket of their duration
+	TimeoutBuckets map[string]map[string]int `json:"timeout_buckets"`
+	// Recent seconds between the messages and their moderation by channel
+	TimesToAction map[string]metrics.Summary `json:"times_to_action"`
+	At            time.Time                  `json:"at"`
+}
+
+// handleStats returns the state of the tracker and its counters, only of the
+// channels of the tenant for the tenants:
+//
+// GET /stats
+//
+// The stats are cached by tenant and channels of the API key, `at` is when they were computed. See
+// cfg.StatsCacheSeconds
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	key := ""
+	if a := accessOf(r); a != nil {
+		// the API keys scoped to some channels only see their stats
+		key = fmt.Sprint(a.Tenant.ID, a.Channels)
+	}
+	st, err := s.statsCache.Get(key, func() (*stats, error) {
+		return s.stats(r)
+	})
+	if err != nil {
+		errors.WrapAndLog(err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+// stats computes the stats of the tenant of the request, see handleStats
+func (s *Server) stats(r *http.Request) (*stats, error) {
+	st := &stats{
+		Moderations:    bot.ModerationCounts(),
+		SubStatus:      bot.SubStatusCounts(),
+		TimeoutBuckets: bot.TimeoutBucketCounts(),
+		TimesToAction:  bot.TimesToAction(),
+		At:             time.Now(),
+	}
+	chs, err := s.tenantChannels(r)
+	if err != nil {
+		return nil, err
+	}
+	if chs == nil {
+		st.Health = s.bot.Health()
+	} else {
+		st.Moderations = onlyChannels(st.Moderations, chs)
+		st.SubStatus = onlyChannels(st.SubStatus, chs)
+		st.TimeoutBuckets = onlyChannels(st.TimeoutBuckets, chs)
+		st.TimesToAction = onlyChannels(st.TimesToAction, chs)
+	}
+	return st, nil
+}
+
+// onlyChannels returns the entries of the channels `chs`
+func onlyChannels[T any](byChannel map[string]T, chs []string) map[string]T {
+	filtered := make(map[string]T, len(chs))
+	for _, ch := range chs {
+		if v, ok := byChannel[ch]; ok {
+			filtered[ch] = v
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,93 @@
+"use strict";
+
+const MaxFeedItems = 200;
+const StatsInterval = 5000;
+
+function el(tag, attrs, ...children) {
+  const e = document.createElement(tag);
+  Object.assign(e, attrs);
+  e.append(...children);
+  return e;
+}
+
+function since(at) {
+  const t = new Date(at);
+  if (t.getFullYear() < 2000) {
+    return "never";
+  }
+  const s = Math.round((Date.now() - t) / 1000);
+  return `${t.toLocaleTimeString()} (${s}s ago)`;
+}
+
+function renderStats(stats) {
+  const h = stats.health;
+  // only the admin sees the health of the tracker
+  document.getElementById("health").hidden = !h;
+  if (h) {
+    renderHealth(h);
+  }
+
+  const rows = Object.entries(stats.moderations)
+    .map(([channel, c]) => [channel, c.ban || 0, c.timeout || 0, c.deletion || 0])
+    .sort((a, b) => (b[1] + b[2] + b[3]) - (a[1] + a[2] + a[3]));
+  document.getElementById("counters-body").replaceChildren(
+    ...rows.map((r) => el("tr", {}, ...r.map((v) => el("td", { textContent: v })))),
+  );
+}
+
+function renderHealth(h) {
+  document.getElementById("source").textContent =
+    `${h.source} (${h.connected ? "connected" : "disconnected"})`;
+  document.getElementById("connected-at").textContent = since(h.connected_at);
+  document.getElementById("last-message-at").textContent = since(h.last_message_at);
+  document.getElementById("channels").textContent = h.channels;
+  document.getElementById("queue").textContent = `${h.queue} / ${h.queue_cap}`;
+}
+
+async function pollStats() {
+  try {
+    const res = await fetch("../stats");
+    if (!res.ok) {
+      throw new Error(`stats: ${res.status}`);
+    }
+    renderStats(await res.json());
+  } catch (err) {
+    console.error(err);
+  }
+}
+
+function renderModeration(m) {
+  const list = document.getElementById("feed-list");
+  let what = m.type;
+  if (m.duration) {
+    what += ` ${m.duration}s`;
+  }
+  const item = el("li", {},
+    el("span", { className: `type type-${m.type}`, textContent: what }),
+    el("strong", { textContent: m.username }),
+    ` in #${m.channel} at ${new Date(m.at).toLocaleTimeString()}`,
+    el("p", { className: "messages", textContent: (m.messages || []).join(" | ") }),
+  );
+  list.prepend(item);
+  while (list.children.length > MaxFeedItems) {
+    list.lastChild.remove();
+  }
+}
+
+function stream() {
+  const status = document.getElementById("stream-status");
+  const source = new EventSource("../stream");
+  source.onopen = () => {
+    status.textContent = "live";
+    status.className = "status ok";
+  };
+  source.onerror = () => {
+    status.textContent = "reconnecting";
+    status.className = "status error";
+  };
+  source.addEventListener("moderation", (e) => renderModeration(JSON.parse(e.data)));
+}
+
+stream();
+pollStats();
+setInterval(pollStats, StatsInterval);
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/bot"
+)
+
+// MaxLookupUsers is the maximum number of users looked up at once, see
+// ErrTooManyUsers
+const MaxLookupUsers = 100
+
+var ErrTooManyUsers = errors.New("at most 100 users can be looked up at once")
+
+// handleLookupUsers returns the summaries of the moderations of many users at
+// once, e.g. the current chatters of a channel, in the order they were given.
+// The usernames go first, then the user ids. The summaries only count the
+// moderations in `channel` if not empty, and in the channels of the API key
+// for the tenants:
+//
+// POST /users/lookup {"usernames": ["foo"], "user_ids": ["123"], "channel": "bar"}
+func (s *Server) handleLookupUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	var body struct {
+		Usernames []string    `json:"usernames"`
+		UserIDs   []string    `json:"user_ids"`
+		Channel   bot.Channel `json:"channel"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err))
+		return
+	}
+	if len(body.Usernames)+len(body.UserIDs) > MaxLookupUsers {
+		writeError(w, http.StatusBadRequest, ErrTooManyUsers)
+		return
+	}
+	if a := accessOf(r); a != nil && !a.Role.Allows(bot.RoleModerator) {
+		writeError(w, http.StatusForbidden, ErrForbidden)
+		return
+	}
+	chs, err := s.lookupChannels(r, body.Channel)
+	if err != nil {
+		errors.WrapAndLog(err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	summaries, err := s.sto.LookupUsers(body.Usernames, body.UserIDs, chs)
+	if err != nil {
+		if errors.Is(err, bot.ErrUnsupported) {
+			writeError(w, http.StatusNotImplemented, err)
+			return
+		}
+		errors.WrapAndLog(err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, summaries)
+}
+
+// lookupChannels returns the channels whose moderations are looked up: `ch`
+// if visible to the request, or every visible channel if empty, nil for all
+// of them
+func (s *Server) lookupChannels(r *http.Request, ch bot.Channel) ([]bot.Channel, error) {
+	visible, err := s.tenantChannels(r)
+	if err != nil {
+		return nil, err
+	}
+	if visible == nil {
+		if ch == "" {
+			return nil, nil
+		}
+		return []bot.Channel{ch}, nil
+	}
+	chs := []bot.Channel{}
+	for _, vch := range visible {
+		if ch == "" || strings.EqualFold(vch, string(ch)) {
+			chs = append(chs, bot.Channel(vch))
+		}
+	}
+	return chs, nil
+}
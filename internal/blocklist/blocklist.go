@@ -0,0 +1,133 @@
+// Package blocklist reads the community blocklists of known ban-bots and keeps
+// the users listed in them. A blocklist is a CSV with the login of a user in
+// the first column of every row, read from a file or an URL.
+package blocklist
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+var ErrUnexpectedStatus = errors.New("unexpected status code fetching the blocklist")
+
+// Tag is the tag of the stored bans of the listed users
+const Tag = "blocklisted"
+
+// MaxSize is the maximum size in bytes of a blocklist read from an URL
+const MaxSize = 32 << 20
+
+// headers are the names of the first column of the blocklists with a header
+var headers = map[string]bool{"login": true, "username": true, "user_name": true}
+
+// Parse returns the users of a blocklist, in lowercase. Empty rows, comments
+// starting with # and the header are skipped
+func Parse(r io.Reader) ([]string, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	var users []string
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err)
+		}
+		user := strings.ToLower(strings.TrimSpace(record[0]))
+		if user == "" || (len(users) == 0 && headers[user]) {
+			continue
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// Fetch returns the users of the blocklist at `source`, an http(s) URL or the
+// path of a file
+func Fetch(ctx context.Context, client *http.Client, source string) ([]string, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, errors.Wrap(err)
+		}
+		defer f.Close()
+		return Parse(f)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.WrapWithContext(ErrUnexpectedStatus, struct {
+			URL    string
+			Status int
+		}{source, res.StatusCode})
+	}
+	return Parse(io.LimitReader(res.Body, MaxSize))
+}
+
+// Set is the set of the users of every blocklist. It is safe for concurrent
+// use.
+type Set struct {
+	mu    sync.RWMutex
+	lists map[string]map[string]struct{}
+}
+
+// Replace sets the users of the blocklist `list` and returns the ones that were
+// not listed in it before
+func (s *Set) Replace(list string, users []string) []string {
+	listed := make(map[string]struct{}, len(users))
+	for _, u := range users {
+		listed[u] = struct{}{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before := s.lists[list]
+	var added []string
+	for u := range listed {
+		if _, ok := before[u]; !ok {
+			added = append(added, u)
+		}
+	}
+	s.lists[list] = listed
+	return added
+}
+
+// Known reports whether the users of the blocklist `list` were ever set
+func (s *Set) Known(list string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.lists[list]
+	return ok
+}
+
+// Has reports whether the user is in any blocklist
+func (s *Set) Has(username string) bool {
+	username = strings.ToLower(username)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, listed := range s.lists {
+		if _, ok := listed[username]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func NewSet() *Set {
+	return &Set{lists: make(map[string]map[string]struct{})}
+}
@@ -0,0 +1,86 @@
+package blocklist
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		desc string
+		csv  string
+		want []string
+	}{
+		{"one per line", "foo\nBar\n", []string{"foo", "bar"}},
+		{"header and columns", "username,reason\nfoo,spam\nbar,follow bot\n", []string{"foo", "bar"}},
+		{"comments and empty rows", "# community list\n\nfoo\n  \nbar\n", []string{"foo", "bar"}},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		got, err := Parse(strings.NewReader(tt.csv))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.desc, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%s: got %v, want %v", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/list.csv" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("login\nfoo\n"))
+	}))
+	defer srv.Close()
+	client := &http.Client{Timeout: time.Second}
+
+	got, err := Fetch(context.Background(), client, srv.URL+"/list.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []string{"foo"}) {
+		t.Fatalf("got %v, want %v", got, []string{"foo"})
+	}
+	if _, err := Fetch(context.Background(), client, srv.URL+"/missing.csv"); !errors.Is(err, ErrUnexpectedStatus) {
+		t.Fatalf("got %v, want %v", err, ErrUnexpectedStatus)
+	}
+}
+
+func TestSet(t *testing.T) {
+	t.Parallel()
+	s := NewSet()
+	if s.Known("a") {
+		t.Fatal("unknown list reported as known")
+	}
+	added := s.Replace("a", []string{"foo", "bar"})
+	sort.Strings(added)
+	if !reflect.DeepEqual(added, []string{"bar", "foo"}) {
+		t.Fatalf("got %v, want %v", added, []string{"bar", "foo"})
+	}
+	if added := s.Replace("a", []string{"foo", "baz"}); !reflect.DeepEqual(added, []string{"baz"}) {
+		t.Fatalf("got %v, want %v", added, []string{"baz"})
+	}
+	s.Replace("b", []string{"qux"})
+	if !s.Known("a") || !s.Known("b") {
+		t.Fatal("lists not reported as known")
+	}
+	for user, want := range map[string]bool{"foo": true, "FOO": true, "bar": false, "baz": true, "qux": true} {
+		if got := s.Has(user); got != want {
+			t.Fatalf("%s: got %v, want %v", user, got, want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package bot
+
+import (
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// ErrActiveBansDisabled is returned when reading the active bans with the IRC
+// source. The IRC has no unban messages, so bans would stay active forever
+var ErrActiveBansDisabled = errors.New("the active bans need the unbans of the eventsub source")
+
+// ActiveBan is a user currently banned in a channel
+type ActiveBan struct {
+	Channel  string    `json:"channel"`
+	Username string    `json:"username"`
+	UserID   string    `json:"user_id,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+// ActiveBanStore is implemented by drivers that can keep the users currently
+// banned in every channel, so their current state doesn't need to be rebuilt
+// from the stored moderations.
+type ActiveBanStore interface {
+	// SetActiveBan inserts the ban, replacing the previous ban of the user in
+	// the channel
+	SetActiveBan(ban *ActiveBan) error
+	RemoveActiveBan(ch Channel, username string) error
+	ActiveBans(ch Channel) ([]*ActiveBan, error)
+}
+
+// activeBans reports whether the active bans are kept. They are only with the
+// EventSub source, the only one that receives the unbans
+func activeBans() bool {
+	return cfg.Source == SourceEventSub
+}
+
+// activateBan adds the user of a ban to the active bans of the channel. Every
+// ban is active, whether it is compliant with the heuristics or not
+func (s *Storage) activateBan(msg *message.Message) {
+	if msg.Type != message.MessageBan || !activeBans() {
+		return
+	}
+	a, ok := s.driver.(ActiveBanStore)
+	if !ok {
+		return
+	}
+	if err := a.SetActiveBan(&ActiveBan{
+		Channel:  strings.ToLower(msg.Channel),
+		Username: strings.ToLower(msg.Username),
+		UserID:   msg.UserID,
+		At:       msg.At,
+	}); err != nil {
+		storageErrors.Inc("set_active_ban")
+		errors.WrapAndLog(err)
+	}
+}
+
+// Unban removes the user of an unban from the active bans of the channel.
+// Unbans are only received from EventSub, the IRC has no unban messages
+func (s *Storage) Unban(msg *message.Message) {
+	if s.grace != nil {
+		s.grace.revert(msg)
+	}
+	a, ok := s.driver.(ActiveBanStore)
+	if !ok {
+		return
+	}
+	if err := a.RemoveActiveBan(Channel(strings.ToLower(msg.Channel)), strings.ToLower(msg.Username)); err != nil {
+		storageErrors.Inc("remove_active_ban")
+		errors.WrapAndLog(err)
+	}
+}
+
+// ActiveBans returns the users currently banned in the channel. See
+// ActiveBanStore and ErrActiveBansDisabled
+func (s *Storage) ActiveBans(ch Channel) ([]*ActiveBan, error) {
+	if !activeBans() {
+		return nil, ErrActiveBansDisabled
+	}
+	a, ok := s.driver.(ActiveBanStore)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return a.ActiveBans(Channel(strings.ToLower(string(ch))))
+}
+
+// TenantActiveBans returns the users currently banned in a channel of the
+// tenant
+func (s *Storage) TenantActiveBans(tenantID string, ch Channel) ([]*ActiveBan, error) {
+	ch = Channel(strings.ToLower(string(ch)))
+	if err := s.owns(tenantID, ch); err != nil {
+		return nil, err
+	}
+	return s.ActiveBans(ch)
+}
+
+func init() {
+	RegisterHandler(message.MessageUnban, func(t *channelTracker, msg *message.Message) {
+		t.sto.Unban(msg)
+	})
+}
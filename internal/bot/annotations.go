@@ -0,0 +1,152 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+// MaxAnnotationLength is the maximum number of characters of the note of an
+// annotation
+const MaxAnnotationLength = 2000
+
+var ErrAnnotationNote = errors.New("the note of an annotation must have between 1 and 2000 characters")
+
+// Annotation is a note of a moderator about a user in a channel, e.g. "ban
+// appealed and upheld", attached to one of their stored moderations or, if
+// ModerationAt is nil, to the user themself
+type Annotation struct {
+	Channel  string `json:"channel"`
+	Username string `json:"username"`
+	// ModerationAt is the time of the annotated moderation, nil if the note is
+	// about the user
+	ModerationAt *time.Time `json:"moderation_at,omitempty"`
+	Note         string     `json:"note"`
+	// Author is who wrote the note, e.g. the id of an API key
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AnnotationStore is implemented by drivers that can keep the annotations of
+// the moderators.
+type AnnotationStore interface {
+	InsertAnnotation(a *Annotation) error
+	// Annotations returns the annotations of `username` in `ch`, the most
+	// recent first
+	Annotations(username string, ch Channel) ([]*Annotation, error)
+}
+
+// Annotate stores the note of a moderator about a user in a channel, or about
+// one of their moderations if a.ModerationAt is not nil, which must be stored.
+// The author and the time of the note are set here. See AnnotationStore
+func (s *Storage) Annotate(a *Annotation, author string) error {
+	st, ok := s.driver.(AnnotationStore)
+	if !ok {
+		return ErrUnsupported
+	}
+	a.Note = strings.TrimSpace(a.Note)
+	if n := utf8.RuneCountInString(a.Note); n == 0 || n > MaxAnnotationLength {
+		return ErrAnnotationNote
+	}
+	a.Channel = strings.ToLower(a.Channel)
+	a.Username = strings.ToLower(a.Username)
+	if a.ModerationAt != nil {
+		stored, err := s.HasModeration(a.Username, Channel(a.Channel), *a.ModerationAt)
+		if err != nil {
+			return err
+		}
+		if !stored {
+			return ErrModerationNotFound
+		}
+	}
+	a.Author = author
+	a.CreatedAt = s.clock.Now()
+	if err := st.InsertAnnotation(a); err != nil {
+		storageErrors.Inc("insert_annotation")
+		return err
+	}
+	details := fmt.Sprintf("channel=%s", a.Channel)
+	if a.ModerationAt != nil {
+		details += " at=" + a.ModerationAt.Format(time.RFC3339Nano)
+	}
+	if err := s.Audit(&AuditEntry{
+		Action:  "annotate",
+		Actor:   author,
+		Target:  a.Username,
+		Details: details,
+		At:      a.CreatedAt,
+	}); err != nil && !errors.Is(err, ErrUnsupported) {
+		errors.WrapAndLog(err)
+	}
+	return nil
+}
+
+// TenantAnnotate is Annotate in a channel of the tenant
+func (s *Storage) TenantAnnotate(tenantID string, a *Annotation, author string) error {
+	if err := s.owns(tenantID, Channel(strings.ToLower(a.Channel))); err != nil {
+		return err
+	}
+	return s.Annotate(a, author)
+}
+
+// Annotations returns the annotations of `username` in `ch` and of their
+// previous and later logins, the most recent first. See AnnotationStore
+func (s *Storage) Annotations(username string, ch Channel) ([]*Annotation, error) {
+	st, ok := s.driver.(AnnotationStore)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	ch = Channel(strings.ToLower(string(ch)))
+	logins, err := s.aliases(strings.ToLower(username))
+	if err != nil {
+		return nil, err
+	}
+	var all []*Annotation
+	for _, login := range logins {
+		as, err := st.Annotations(login, ch)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, as...)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].CreatedAt.After(all[j].CreatedAt)
+	})
+	return all, nil
+}
+
+// TenantAnnotations is Annotations of a channel of the tenant
+func (s *Storage) TenantAnnotations(tenantID, username string, ch Channel) ([]*Annotation, error) {
+	ch = Channel(strings.ToLower(string(ch)))
+	if err := s.owns(tenantID, ch); err != nil {
+		return nil, err
+	}
+	return s.Annotations(username, ch)
+}
+
+// annotate sets the annotations of a page of a timeline: the ones about its
+// moderations, and the ones about the user on the first page. Nothing is set
+// if the driver doesn't keep annotations
+func (s *Storage) annotate(t *Timeline, username string, ch Channel, first bool) error {
+	all, err := s.Annotations(username, ch)
+	if err != nil {
+		if errors.Is(err, ErrUnsupported) {
+			return nil
+		}
+		return err
+	}
+	entries := make(map[int64]bool, len(t.Entries))
+	for _, m := range t.Entries {
+		entries[m.At.UnixNano()] = true
+	}
+	for _, a := range all {
+		if (a.ModerationAt == nil && first) || (a.ModerationAt != nil && entries[a.ModerationAt.UnixNano()]) {
+			t.Annotations = append(t.Annotations, a)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestAnnotate(t *testing.T) {
+	t.Parallel()
+	s := NewStorage(NewMemoryStorage(10))
+	defer s.Stop()
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		s.Save(&message.Message{
+			Type:     message.MessageBan,
+			Channel:  "channel",
+			Username: "user",
+			At:       now.Add(-time.Duration(i) * time.Hour),
+		})
+	}
+	older := now.Add(-2 * time.Hour)
+	missing := now.Add(-time.Minute)
+	tests := []struct {
+		desc string
+		a    *Annotation
+		want error
+	}{
+		{"about the user", &Annotation{Channel: "Channel", Username: "User", Note: "known spammer"}, nil},
+		{"about a moderation", &Annotation{Channel: "channel", Username: "user", ModerationAt: &now, Note: "ban appealed and upheld"}, nil},
+		{"about an older moderation", &Annotation{Channel: "channel", Username: "user", ModerationAt: &older, Note: "first offense"}, nil},
+		{"empty", &Annotation{Channel: "channel", Username: "user", Note: "  "}, ErrAnnotationNote},
+		{"not stored", &Annotation{Channel: "channel", Username: "user", ModerationAt: &missing, Note: "note"}, ErrModerationNotFound},
+	}
+	for _, tt := range tests {
+		if err := s.Annotate(tt.a, "key:1"); !errors.Is(err, tt.want) {
+			t.Fatalf("%s got: %v, want: %v", tt.desc, err, tt.want)
+		}
+	}
+
+	all, err := s.Annotations("user", "channel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || all[0].Author != "key:1" {
+		t.Fatalf("got: %+v, want: 3 annotations by key:1", all)
+	}
+
+	// the first page has the notes about the user and its entries, the second
+	// one only the notes of its entries
+	page, err := s.Timeline("user", "channel", time.Time{}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Annotations) != 2 || page.Next == nil {
+		t.Fatalf("got: %+v, want: 2 annotations and a next page", page)
+	}
+	page, err = s.Timeline("user", "channel", *page.Next, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Annotations) != 1 || page.Annotations[0].Note != "first offense" {
+		t.Fatalf("got: %+v, want: the note of the older moderation", page.Annotations)
+	}
+}
@@ -0,0 +1,45 @@
+package bot
+
+import (
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// AutomodStore is implemented by drivers that can update the status of the
+// messages held by AutoMod once the hold is resolved, in the row stored when
+// the message was held.
+type AutomodStore interface {
+	// SetAutomodStatus sets the status of the hold of the message
+	// `messageID`. Holds that were not stored are ignored
+	SetAutomodStatus(messageID, status string) error
+}
+
+// isAutomodUpdate reports whether msg resolves a hold stored before, rather
+// than holding a message
+func isAutomodUpdate(msg *message.Message) bool {
+	return msg.Type == message.MessageAutomod && msg.AutomodStatus != message.AutomodHeld
+}
+
+// UpdateAutomod sets the status of the stored hold of an AutoMod update. The
+// update is not a moderation of its own, see AutomodStore
+func (s *Storage) UpdateAutomod(msg *message.Message) {
+	a, ok := s.driver.(AutomodStore)
+	if !ok || len(msg.LastMessages) == 0 {
+		return
+	}
+	if err := a.SetAutomodStatus(msg.LastMessages[0].ID, msg.AutomodStatus); err != nil {
+		storageErrors.Inc("automod_status")
+		errors.WrapAndLog(err)
+	}
+}
+
+func init() {
+	RegisterHandler(message.MessageAutomod, func(t *channelTracker, msg *message.Message) {
+		if isAutomodUpdate(msg) {
+			t.sto.UpdateAutomod(msg)
+			return
+		}
+		// the caught message is in the event itself
+		t.save(msg)
+	})
+}
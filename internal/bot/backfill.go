@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gempir/go-twitch-irc/v3"
+	"github.com/hammertrack/tracker/internal/justlog"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// BackfillReport summarizes a backfill of a channel
+type BackfillReport struct {
+	Channel Channel
+	Days    int
+	// Entries is the number of log entries read
+	Entries int
+	// Moderations is the number of tracked moderations found, see
+	// tracksModeration
+	Moderations int
+	// Duplicates is the number of moderations skipped because they were
+	// already stored
+	Duplicates int
+	// Stored is the number of moderations that passed the heuristics
+	Stored int
+}
+
+// Backfill replays the archived logs of `ch` from the day of `from` to the day
+// of `to`, both inclusive, through the same history, filters and heuristics
+// used when tracking, and stores the moderations with their original
+// timestamps. Moderations already stored are skipped, so it is safe to
+// backfill the same days more than once. See message.Message.Backfilled
+func Backfill(ctx context.Context, sto *Storage, logs *justlog.Client, ch Channel, from, to time.Time) (*BackfillReport, error) {
+	return backfill(ctx, sto, logs, ch, from, to, false)
+}
+
+// backfill replays the logs of the days of `from` to `to`. If exact, only the
+// moderations between `from` and `to` are stored, the messages of the rest of
+// the days still fill the history of the channel
+func backfill(ctx context.Context, sto *Storage, logs *justlog.Client, ch Channel, from, to time.Time, exact bool) (*BackfillReport, error) {
+	ch = Channel(strings.ToLower(string(ch)))
+	report := &BackfillReport{Channel: ch}
+
+	var saveErr error
+	t := newChannelTracker(sto, func(msg *message.Message) bool {
+		if saveErr != nil {
+			return false
+		}
+		report.Moderations++
+		dup, err := sto.HasModeration(msg.Username, ch, msg.At)
+		if err != nil {
+			saveErr = err
+			return false
+		}
+		if dup {
+			report.Duplicates++
+			return false
+		}
+		if sto.Save(msg) {
+			report.Stored++
+			return true
+		}
+		return false
+	})
+
+	for day := from.UTC().Truncate(24 * time.Hour); !day.After(to); day = day.AddDate(0, 0, 1) {
+		entries, err := logs.Day(ctx, string(ch), day)
+		if err != nil {
+			return report, err
+		}
+		for _, e := range entries {
+			msg := backfillMessage(e)
+			if msg == nil {
+				continue
+			}
+			if exact && msg.Type != message.MessagePrivmsg && (msg.At.Before(from) || msg.At.After(to)) {
+				continue
+			}
+			t.process(msg)
+			if saveErr != nil {
+				return report, saveErr
+			}
+		}
+		report.Days++
+		report.Entries += len(entries)
+		log.Printf("backfilled #%s %s: %d entries", ch, day.Format("2006-01-02"), len(entries))
+	}
+	return report, nil
+}
+
+// backfillMessage converts a log entry into a message. Entries of types not
+// tracked return nil, as well as the moderations that are not tracked live
+func backfillMessage(e *justlog.Entry) *message.Message {
+	var msg *message.Message
+	switch m := e.Message.(type) {
+	case *twitch.PrivateMessage:
+		msg = privmsgMessage(m)
+	case *twitch.ClearChatMessage:
+		msg = clearChatModeration(m)
+	case *twitch.ClearMessage:
+		msg = clearMessageDeletion(m, e.At)
+	}
+	if msg == nil || (msg.Type != message.MessagePrivmsg && !tracksModeration(msg)) {
+		return nil
+	}
+	msg.Backfilled = true
+	if msg.At.IsZero() {
+		msg.At = e.At
+	}
+	if msg.Type == message.MessagePrivmsg && msg.LastMessages[0].At.IsZero() {
+		msg.LastMessages[0].At = e.At
+	}
+	return msg
+}
@@ -0,0 +1,172 @@
+package bot
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/blocklist"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// BlocklistFetchTimeout is how long fetching a single blocklist may take
+const BlocklistFetchTimeout = time.Minute
+
+// WatchlistPrefix prefixes the names of the watchlists among the blocklists.
+// Watchlists are imported by the operators rather than fetched, see
+// ImportWatchlist
+const WatchlistPrefix = "watchlist:"
+
+// BlocklistStore is implemented by drivers that can keep the users of the
+// community blocklists and tag their stored bans.
+type BlocklistStore interface {
+	// Blocklist returns the users of the list as of its last sync
+	Blocklist(list string) ([]string, error)
+	// SetBlocklist replaces the users of the list
+	SetBlocklist(list string, users []string, at time.Time) error
+	// TagBans adds `tag` to the stored bans of the user
+	TagBans(username, tag string) error
+}
+
+// blocklists keeps the community blocklists in sync and tags the bans of their
+// users, the ones already stored included
+type blocklists struct {
+	sources []string
+	users   *blocklist.Set
+	http    *http.Client
+	store   BlocklistStore
+}
+
+// Start syncs the blocklists every `interval` until ctx is done
+func (b *blocklists) Start(ctx context.Context, interval time.Duration) {
+	b.sync(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.sync(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sync fetches every blocklist and tags the stored bans of the users added to
+// them. A list that cannot be fetched keeps its previous users
+func (b *blocklists) sync(ctx context.Context) {
+	for _, source := range b.sources {
+		if err := b.syncList(ctx, source); err != nil {
+			storageErrors.Inc("sync_blocklist")
+			errors.WrapAndLogWithContext(err, struct{ List string }{source})
+		}
+	}
+}
+
+func (b *blocklists) syncList(ctx context.Context, source string) error {
+	if strings.HasPrefix(source, WatchlistPrefix) {
+		// the stored bans are tagged when the watchlist is imported
+		users, err := b.store.Blocklist(source)
+		if err != nil {
+			return err
+		}
+		b.users.Replace(source, users)
+		return nil
+	}
+	if !b.users.Known(source) {
+		// the users stored in the last run are already tagged
+		stored, err := b.store.Blocklist(source)
+		if err != nil {
+			return err
+		}
+		b.users.Replace(source, stored)
+	}
+	fetchCtx, cancel := context.WithTimeout(ctx, BlocklistFetchTimeout)
+	defer cancel()
+	users, err := blocklist.Fetch(fetchCtx, b.http, source)
+	if err != nil {
+		return err
+	}
+	added := b.users.Replace(source, users)
+	if err := b.store.SetBlocklist(source, users, time.Now()); err != nil {
+		return err
+	}
+	for _, u := range added {
+		if err := b.store.TagBans(u, blocklist.Tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportWatchlist replaces the users of the watchlist `name` and tags their
+// stored bans like the ones of the blocklists. It returns the users whose bans
+// could not be tagged. Their new bans are only tagged if the watchlist is one
+// of cfg.Blocklists, see WatchlistPrefix
+func (s *Storage) ImportWatchlist(name string, users []string, actor string) (map[string]error, error) {
+	store, ok := s.driver.(BlocklistStore)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	list := WatchlistPrefix + strings.ToLower(name)
+	if err := store.SetBlocklist(list, users, s.clock.Now()); err != nil {
+		return nil, err
+	}
+	s.auditTenant("watchlist-import", actor, list)
+	failed := make(map[string]error)
+	for _, u := range users {
+		if err := store.TagBans(u, blocklist.Tag); err != nil {
+			failed[u] = err
+		}
+	}
+	return failed, nil
+}
+
+// blocklisted reports whether the user is in any community blocklist
+func (s *Storage) blocklisted(username string) bool {
+	return s.blocklists != nil && s.blocklists.users.Has(username)
+}
+
+// excluded reports whether the moderations of the user are left out of the
+// stats of the channels. See cfg.BlocklistsExcludeStats
+func (s *Storage) excluded(username string) bool {
+	return cfg.BlocklistsExcludeStats && s.blocklisted(username)
+}
+
+// unlessExcluded returns fn, skipping the moderations left out of the stats
+func (s *Storage) unlessExcluded(fn func(*message.Message)) func(*message.Message) {
+	return func(msg *message.Message) {
+		if !s.excluded(msg.Username) {
+			fn(msg)
+		}
+	}
+}
+
+// newBlocklists creates the sync of the community blocklists from the
+// configuration. It returns nil if the blocklists are disabled or the driver
+// cannot keep them
+func newBlocklists(d Driver) *blocklists {
+	if cfg.Blocklists == "" {
+		return nil
+	}
+	store, ok := d.(BlocklistStore)
+	if !ok {
+		errors.WrapAndLog(ErrUnsupported)
+		return nil
+	}
+	var sources []string
+	for _, source := range strings.Split(cfg.Blocklists, ",") {
+		if source = strings.TrimSpace(source); source != "" {
+			sources = append(sources, source)
+		}
+	}
+	return &blocklists{
+		sources: sources,
+		users:   blocklist.NewSet(),
+		http:    &http.Client{Timeout: BlocklistFetchTimeout},
+		store:   store,
+	}
+}
@@ -1,18 +1,42 @@
 package bot
 
 import (
+	"context"
 	"log"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/gempir/go-twitch-irc/v3"
 	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/clock"
 	cfg "github.com/hammertrack/tracker/internal/config"
-	"github.com/hammertrack/tracker/internal/database"
+	"github.com/hammertrack/tracker/internal/eventsub"
+	"github.com/hammertrack/tracker/internal/fixtures"
+	"github.com/hammertrack/tracker/internal/helix"
+	"github.com/hammertrack/tracker/internal/intern"
 	"github.com/hammertrack/tracker/internal/message"
+	"github.com/hammertrack/tracker/internal/sketch"
+	"github.com/hammertrack/tracker/internal/tap"
+	"github.com/hammertrack/tracker/logger"
 )
 
+// Sources of messages, see cfg.Source
+const (
+	SourceIRC      = "irc"
+	SourceEventSub = "eventsub"
+)
+
+// OriginLookupTimeout is how long resolving the origin channel of a shared chat
+// moderation may take before it is kept in the channel where it was received
+const OriginLookupTimeout = 5 * time.Second
+
+var ErrTapEncrypted = errors.New("the tap writes the messages in plaintext, it cannot be enabled with ENCRYPTION_KEY")
+
 // noopPrivmsg is used as default
 var noopPrivmsg = &message.PrivateMessage{
 	ID:       "",
@@ -20,96 +44,507 @@ var noopPrivmsg = &message.PrivateMessage{
 	Body:     "",
 }
 
-// tracked is a hashtable which contains each go-channel for each twitch
-// tracked channel
-var tracked map[string]chan *message.Message
-
-// handleClearChat is called when a new timeout or ban message is received
-func handleClearChat(msg twitch.ClearChatMessage) {
-	var (
-		d        = msg.BanDuration
-		ch       = msg.Channel
-		typ      = message.MessageBan
-		username = msg.TargetUsername
-	)
-	if username == "" {
-		// ignore a CLEARCHAT of all messages with no specific user
-		return
+// clearChatModeration converts a CLEARCHAT into a ban or a timeout. It returns
+// nil for a CLEARCHAT of all messages with no specific user, see
+// chatClearMessage
+func clearChatModeration(msg *twitch.ClearChatMessage) *message.Message {
+	if msg.TargetUsername == "" {
+		return nil
 	}
-	if d != 0 {
-		// ignore everything but bans
-		return
+	typ := message.MessageBan
+	if msg.BanDuration != 0 {
+		typ = message.MessageTimeout
+	}
+	m := &message.Message{
+		Type:      typ,
+		Duration:  msg.BanDuration,
+		Username:  msg.TargetUsername,
+		UserID:    msg.TargetUserID,
+		Channel:   msg.Channel,
+		ChannelID: msg.RoomID,
+		// twitch stopped sending the reasons, but the old logs of the backfill
+		// and other IRC servers still have them
+		Reason: msg.Tags["ban-reason"],
+		At:     msg.Time,
 	}
+	// during a shared chat session, the moderations of every channel in the
+	// session are received in all of them, tagged with the room where they
+	// originated
+	if src := msg.Tags["source-room-id"]; src != "" && src != msg.RoomID {
+		m.SharedSession = true
+		m.SourceChannelID = src
+	}
+	return m
+}
 
-	log.Printf("->[#%s] :%s", msg.Channel, msg.TargetUsername)
-	tracked[ch] <- &message.Message{
-		Type:     typ,
-		Duration: d,
-		Username: msg.TargetUsername,
-		Channel:  ch,
-		At:       msg.Time,
+// chatClearMessage converts a CLEARCHAT of all messages into a chat clear. The
+// IRC doesn't tell the moderator
+func chatClearMessage(msg *twitch.ClearChatMessage) *message.Message {
+	return &message.Message{
+		Type:      message.MessageChatClear,
+		Channel:   msg.Channel,
+		ChannelID: msg.RoomID,
+		At:        msg.Time,
 	}
 }
 
-// handleClearChat is called when a new deletion is received
-func handleClear(msg twitch.ClearMessage) {
-	tracked[msg.Channel] <- &message.Message{
-		TargetMsgID: msg.TargetMsgID,
-		Type:        message.MessageDeletion,
-		Username:    msg.Login,
-		Channel:     msg.Channel,
-		At:          time.Now(),
+// clearMessageDeletion converts a CLEARMSG received at `at` into a deletion
+func clearMessageDeletion(msg *twitch.ClearMessage, at time.Time) *message.Message {
+	return &message.Message{
+		TargetMsgID:   msg.TargetMsgID,
+		TargetMsgBody: msg.Message,
+		Type:          message.MessageDeletion,
+		Username:      msg.Login,
+		Channel:       msg.Channel,
+		At:            at,
 	}
 }
 
-// handlePrivmsg is called when a new message in the twitch chat of any of the
-// tracked twitch channels is received
-func handlePrivmsg(msg twitch.PrivateMessage) {
-	sub, _ := strconv.Atoi(msg.Tags["suscriber"])
-	privmsg := &message.PrivateMessage{
-		ID:         msg.ID,
+// privmsgEnvelope is a PRIVMSG with the backing array of its LastMessages, so
+// both are allocated at once
+type privmsgEnvelope struct {
+	msg  message.Message
+	last [1]*message.PrivateMessage
+}
+
+// privmsgMessage converts a PRIVMSG into a message. It runs for every chat
+// message, so it allocates only the message and its PRIVMSG, which is kept in
+// the history. See BenchmarkPrivmsg
+func privmsgMessage(msg *twitch.PrivateMessage) *message.Message {
+	sub, _ := strconv.Atoi(msg.Tags["subscriber"])
+	// the id and the body are parsed from the raw IRC line, a single copy of
+	// both doesn't keep the line and its tags in the history. The rest of
+	// strings kept are interned, see internMessage
+	text := msg.ID + msg.Message
+	env := &privmsgEnvelope{}
+	env.last[0] = &message.PrivateMessage{
+		ID:         text[:len(msg.ID)],
 		Username:   msg.User.Name,
-		Body:       msg.Message,
+		UserID:     msg.User.ID,
+		Body:       text[len(msg.ID):],
 		At:         msg.Time,
 		Subscribed: message.SubscribedStatus(sub),
+		SubMonths:  subMonths(msg.Tags["badge-info"]),
+		Badges:     badgeSet(msg.User.Badges),
 	}
-	tracked[msg.Channel] <- &message.Message{
+	env.msg = message.Message{
 		Type:         message.MessagePrivmsg,
 		Username:     msg.User.Name,
+		UserID:       msg.User.ID,
 		Channel:      msg.Channel,
-		LastMessages: []*message.PrivateMessage{privmsg},
+		ChannelID:    msg.RoomID,
+		LastMessages: env.last[:],
 		At:           msg.Time,
 	}
+	return &env.msg
+}
+
+// interned are the strings repeated across the messages, shared by all of
+// them. It is nil if cfg.InternStrings is 0
+var interned = intern.New(cfg.InternStrings)
+
+// internMessage replaces the channel and the user of msg, and of its PRIVMSG,
+// with their interned copies, so the messages of a user share a single string
+// and comparing their usernames in the history is comparing pointers
+func internMessage(msg *message.Message) {
+	msg.Channel = interned.String(msg.Channel)
+	msg.ChannelID = interned.String(msg.ChannelID)
+	msg.Username = interned.String(msg.Username)
+	msg.UserID = interned.String(msg.UserID)
+	// the related messages of the rest of types come from the history, which
+	// only its tracker may change
+	if msg.Type != message.MessagePrivmsg {
+		return
+	}
+	for _, privmsg := range msg.LastMessages {
+		privmsg.Username = interned.String(privmsg.Username)
+		privmsg.UserID = interned.String(privmsg.UserID)
+	}
+}
+
+// maxSharedBadges is the maximum number of badges of the badge sets shared by
+// the messages, see badgeSet
+const maxSharedBadges = 4
+
+// maxBadgeSets bounds the badge sets shared by the messages. There are few
+// badges, the bound is only a safeguard
+const maxBadgeSets = 4096
+
+// badgeSets are the badge sets shared by the messages, by their sorted badges
+var badgeSets = struct {
+	mu   sync.RWMutex
+	sets map[[maxSharedBadges]string][]string
+}{sets: make(map[[maxSharedBadges]string][]string)}
+
+// badgeSet returns the sorted names of the badges of a message. The sets of up
+// to maxSharedBadges badges are shared by every message with the same badges,
+// so they are never modified
+func badgeSet(badges map[string]int) []string {
+	if len(badges) == 0 {
+		return nil
+	}
+	if len(badges) > maxSharedBadges {
+		names := make([]string, 0, len(badges))
+		for badge := range badges {
+			names = append(names, badge)
+		}
+		sort.Strings(names)
+		return names
+	}
+	var key [maxSharedBadges]string
+	n := 0
+	for badge := range badges {
+		// an insertion sort, sort.Strings would allocate
+		i := n
+		for ; i > 0 && key[i-1] > badge; i-- {
+			key[i] = key[i-1]
+		}
+		key[i] = badge
+		n++
+	}
+	badgeSets.mu.RLock()
+	set, ok := badgeSets.sets[key]
+	badgeSets.mu.RUnlock()
+	if ok {
+		return set
+	}
+	// the names are parsed from the raw IRC line, the copies don't keep it
+	set = make([]string, n)
+	for i := range set {
+		set[i] = strings.Clone(key[i])
+	}
+	copy(key[:], set)
+	badgeSets.mu.Lock()
+	if len(badgeSets.sets) < maxBadgeSets {
+		badgeSets.sets[key] = set
+	}
+	badgeSets.mu.Unlock()
+	return set
+}
+
+// subMonths returns the sub tenure in the badge-info tag of a message, e.g.
+// "subscriber/16", or 0 if the user is not subscribed. Founders are subscribers
+// too
+func subMonths(badgeInfo string) int {
+	for rest := badgeInfo; rest != ""; {
+		var badge string
+		badge, rest, _ = strings.Cut(rest, ",")
+		name, months, ok := strings.Cut(badge, "/")
+		if !ok || (name != "subscriber" && name != "founder") {
+			continue
+		}
+		n, _ := strconv.Atoi(months)
+		return n
+	}
+	return 0
+}
+
+// handleClearChat is called when a new timeout or ban message is received
+func (b *Bot) handleClearChat(msg twitch.ClearChatMessage) {
+	b.tapLine(msg.Channel, msg.Raw)
+	if m := clearChatModeration(&msg); m != nil {
+		b.handleModeration(m)
+		return
+	}
+	b.dispatch(msg.Channel, chatClearMessage(&msg))
+}
+
+// handleModeration is called for every ban or timeout, no matter the source
+func (b *Bot) handleModeration(msg *message.Message) {
+	received := msg.Channel
+	if msg.SharedSession {
+		origin, ok := b.origin(msg.SourceChannelID)
+		if ok && b.IsTracked(Channel(origin)) {
+			// the origin channel receives the moderation too, so it is stored there
+			// rather than counted and stored twice
+			return
+		}
+		if ok {
+			// the channel where the moderation was received only keeps the history
+			// of the user, the moderation belongs to the origin
+			msg.Channel = origin
+			msg.ChannelID = msg.SourceChannelID
+		}
+	}
+	b.observe(msg)
+	if !tracksModeration(msg) {
+		return
+	}
+	b.dispatch(received, msg)
+}
+
+// observe counts a received moderation, unless it is left out of the stats.
+// See Storage.excluded
+func (b *Bot) observe(msg *message.Message) {
+	if b.sto != nil && b.sto.excluded(msg.Username) {
+		return
+	}
+	observeModeration(msg)
+}
+
+// tracksModeration reports whether a ban, timeout or deletion is tracked. All
+// of them are, see cfg.DeletionMode for the deletions of a message not in the
+// history. Backfills apply the same filter so they store the same data
+func tracksModeration(msg *message.Message) bool {
+	switch msg.Type {
+	case message.MessageBan, message.MessageTimeout, message.MessageDeletion:
+		return true
+	}
+	return false
+}
+
+// handleEvent is called for every message received from EventSub
+func (b *Bot) handleEvent(msg *message.Message) {
+	switch msg.Type {
+	case message.MessageBan, message.MessageTimeout:
+		b.handleModeration(msg)
+	case message.MessageAutomod:
+		// a hold is only a moderation if it is not approved, so it is counted
+		// once resolved
+		if msg.AutomodStatus == message.AutomodDenied || msg.AutomodStatus == message.AutomodExpired {
+			b.observe(msg)
+		}
+		b.dispatch(msg.Channel, msg)
+	case message.MessageUserClear, message.MessageWarning:
+		b.observe(msg)
+		b.dispatch(msg.Channel, msg)
+	default:
+		b.dispatch(msg.Channel, msg)
+	}
+}
+
+// handleClear is called when a new deletion is received. The deletion is at
+// the time twitch sent it, or at the current time of the clock of twitch if
+// unknown, so it can be compared with the times of the messages
+func (b *Bot) handleClear(msg twitch.ClearMessage) {
+	b.tapLine(msg.Channel, msg.Raw)
+	at, ok := sentAt(msg.Tags)
+	if !ok {
+		at = b.twitch.now()
+	}
+	b.dispatch(msg.Channel, clearMessageDeletion(&msg, at))
+}
+
+// handlePrivmsg is called when a new message in the twitch chat of any of the
+// tracked twitch channels is received
+func (b *Bot) handlePrivmsg(msg twitch.PrivateMessage) {
+	b.tapLine(msg.Channel, msg.Raw)
+	if isCommand(msg.Message) {
+		// commands may hit the database, do not block the IRC client
+		go b.handleCommand(msg)
+	}
+	b.dispatch(msg.Channel, privmsgMessage(&msg))
+}
+
+// tapLine writes the raw IRC `line` of channel `ch` to the tap, if enabled,
+// and to the debug logs of irc
+func (b *Bot) tapLine(ch, line string) {
+	logger.Debugf(logger.IRC, "#%s %s", ch, line)
+	if b.tap == nil {
+		return
+	}
+	if err := b.tap.Write(ch, line); err != nil {
+		errors.WrapAndLog(err)
+	}
+}
+
+// Source is where the chat messages and moderations are read from. Both the IRC
+// client and the EventSub client implement it.
+type Source interface {
+	Join(channels ...string)
+	Depart(channel string)
+	// Connect blocks until the source is disconnected
+	Connect() error
+	Disconnect() error
 }
 
 type Bot struct {
+	// connectedAt and lastMessageAt are unix nanoseconds, accessed atomically.
+	// They are first for their 64-bit alignment
+	connectedAt   int64
+	lastMessageAt int64
+	// startedAt is when Start was called, see RunSummary
+	startedAt time.Time
+
 	sto *Storage
-	// client is the IRC Client
+	// source is the client where messages are read from, either client or an
+	// EventSub client
+	source Source
+	// client is the IRC Client. It is nil if the source is EventSub
 	client *twitch.Client
-	// trackerReady is a channel for signaling when all the go-routine are spawned and
-	// trackerReady to get messages
-	trackerReady chan struct{}
 	// ircReady is a channel for signaling when the IRC client is connected to the
 	// server and listening for messages
 	ircReady chan struct{}
-	// done is a channel for signaling when all the go-routines spawned by Bot
-	// have finished
-	done chan struct{}
+	// ready is closed once the source is connected, see Ready
+	ready chan struct{}
+	// startup are the phases of Start, see Startup
+	startup startupReport
+	// replies limits the rate of the replies to chat commands
+	replies *cooldown
+	// chat gates every message of the bot in chat, see Say
+	chat      *chatGate
+	templates *template.Template
+	// tap is nil unless the raw IRC lines are written for debugging
+	tap *tap.Tap
+	// fixtures is nil unless the parsed events are recorded as fixtures
+	fixtures *fixtures.Recorder
+
+	// mu protects tracked, stopped and the assignment of source, which happens
+	// while the bot may already be stopping if the startup failed
+	mu sync.RWMutex
+	// tracked is a hashtable which contains each go-channel for each twitch
+	// tracked channel
+	tracked map[string]chan *message.Message
+	stopped bool
+	// trackers waits for the go-routine of every tracked channel
+	trackers sync.WaitGroup
+	// helix resolves the origin channels of shared chat sessions
+	helix *helix.Client
+	// rooms caches the logins of the origin channels by their twitch user id
+	rooms sync.Map
+	// invalid has the tracked channels that don't exist in twitch, see
+	// validateChannels
+	invalid sync.Map
+	// clock is the time of the bot, clock.Real unless a test sets another
+	clock clock.Clock
+	// twitch compensates the skew of the local clock with the clock of twitch
+	twitch *twitchClock
+	// claims is nil if the claims of the channels are off or unsupported by
+	// the driver
+	claims *claims
+	// cursors is nil if the gap recovery is disabled or unsupported by the
+	// driver
+	cursors *cursors
+	// suspensions is nil if the channels failing to be joined are never
+	// suspended
+	suspensions *suspensions
+}
+
+// dispatch sends msg to the go-routine of the twitch channel `ch`. Messages of
+// untracked channels are discarded.
+func (b *Bot) dispatch(ch string, msg *message.Message) {
+	now := b.clock.Now()
+	atomic.StoreInt64(&b.lastMessageAt, now.UnixNano())
+	msg.ReceivedAt = now
+	internMessage(msg)
+	if msg.Type == message.MessagePrivmsg {
+		b.twitch.observe(msg.At, now)
+	}
+	if b.fixtures != nil {
+		if err := b.fixtures.Record(msg); err != nil {
+			errors.WrapAndLog(err)
+		}
+	}
+	eventsTotal.Inc(ch, string(msg.Type))
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if msgch, ok := b.tracked[ch]; ok {
+		if b.cursors != nil {
+			b.cursors.advance(Channel(ch), now)
+		}
+		queues.enqueue(ch, msgch, msg)
+	}
+}
+
+// broadcast sends msg to the go-routines of all the tracked channels.
+func (b *Bot) broadcast(msg *message.Message) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch, msgch := range b.tracked {
+		queues.enqueue(ch, msgch, msg)
+	}
+}
+
+// origin returns the login of the channel with twitch user id `roomID`. The
+// first lookup of every id asks Helix and the login is cached from then on. It
+// returns false if the channel cannot be resolved
+func (b *Bot) origin(roomID string) (string, bool) {
+	if login, ok := b.rooms.Load(roomID); ok {
+		return login.(string), true
+	}
+	// the message waits for it
+	ctx, cancel := context.WithTimeout(helix.WithPriority(context.Background(), helix.PriorityHigh), OriginLookupTimeout)
+	defer cancel()
+	users, err := b.helix.UsersByID(ctx, []string{roomID})
+	if err != nil {
+		errors.WrapAndLogWithContext(err, struct{ RoomID string }{roomID})
+		return "", false
+	}
+	if len(users) == 0 {
+		return "", false
+	}
+	login := strings.ToLower(users[0].Login)
+	b.rooms.Store(roomID, login)
+	return login, true
+}
+
+// IsTracked returns whether the twitch channel `ch` is being tracked
+func (b *Bot) IsTracked(ch Channel) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	_, ok := b.tracked[string(ch)]
+	return ok
+}
+
+// track spawns the go-routine that tracks the twitch channel `ch`. It returns
+// false if the channel is already tracked or the bot is stopped.
+func (b *Bot) track(ch Channel) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.tracked[string(ch)]; ok || b.stopped {
+		return false
+	}
+	msgch := make(chan *message.Message, TrackerQueueSize)
+	b.tracked[string(ch)] = msgch
+
+	b.trackers.Add(1)
+	go func() {
+		b.runTracker(msgch)
+		b.trackers.Done()
+	}()
+	return true
+}
+
+// untrack stops tracking the twitch channel `ch`. It returns false if the
+// channel is not tracked.
+func (b *Bot) untrack(ch Channel) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	msgch, ok := b.tracked[string(ch)]
+	if !ok {
+		return false
+	}
+	close(msgch)
+	delete(b.tracked, string(ch))
+	return true
 }
 
 // StartClient initializes the IRC client and connects to the IRC server
 func (b *Bot) StartClient(channels []Channel) error {
 	b.client = twitch.NewClient(cfg.ClientUsername, cfg.ClientToken)
-	b.client.OnClearChatMessage(handleClearChat)
-	// b.client.OnClearMessage(handleClear)
-	b.client.OnPrivateMessage(handlePrivmsg)
-	b.client.OnConnect(func() {
-		b.ircReady <- struct{}{}
-	})
+	b.client.OnClearChatMessage(b.handleClearChat)
+	b.client.OnClearMessage(b.handleClear)
+	b.client.OnPrivateMessage(b.handlePrivmsg)
+	b.client.OnConnect(b.signalConnected)
+	b.client.OnNoticeMessage(b.handleNotice)
+	b.client.OnRoomStateMessage(b.handleRoomState)
+	if cfg.TapFile != "" {
+		var err error
+		if b.tap, err = newTap(); err != nil {
+			return err
+		}
+	}
+	b.mu.Lock()
+	b.source = b.client
+	b.mu.Unlock()
 
 	for _, ch := range channels {
 		b.client.Join(string(ch))
 	}
+	if cfg.ChatOptIn {
+		// the channel of the bot is where broadcasters opt-in their channels
+		b.client.Join(cfg.ClientUsername)
+	}
 
 	if err := b.client.Connect(); err != nil {
 		return err
@@ -117,148 +552,313 @@ func (b *Bot) StartClient(channels []Channel) error {
 	return nil
 }
 
-// StartTracker initializes the channels tracker
-func (b *Bot) StartTracker(channels []Channel) {
-	var w sync.WaitGroup
+// StartEventSub initializes the EventSub client and connects to the EventSub
+// websocket. It is the alternative to StartClient
+func (b *Bot) StartEventSub(channels []Channel) error {
+	es := eventsub.New(b.helix, strings.ToLower(cfg.ClientUsername))
+	es.OnEvent(b.handleEvent)
+	es.OnConnect(b.signalConnected)
+	b.mu.Lock()
+	b.source = es
+	b.mu.Unlock()
 
 	for _, ch := range channels {
-		msgch := make(chan *message.Message, 100)
-		tracked[string(ch)] = msgch
-
-		w.Add(1)
-		go func(msgch chan *message.Message) {
-			// history is scoped to each go-routine, per twitch channel.
-			history := message.New(message.MaxHistory, noopPrivmsg)
-
-			for msg := range msgch {
-				switch msg.Type {
-				case message.MessageBan:
-					fallthrough
-				case message.MessageTimeout:
-					// find in the history previous messages related to the ban/timeout,
-					// if the message is already `Stored` ignore it.
-					msg.LastMessages = history.Filter(func(privmsg *message.PrivateMessage) bool {
-						if privmsg.Username == msg.Username && !privmsg.Stored {
-							// mutate the message so we never store it again
-							privmsg.Stored = true
-							return true
-						}
-						return false
-					})
-					b.sto.Save(msg)
-				case message.MessageDeletion:
-					// find the message in the history with the corresponding ID, if the
-					// message is already `Stored` ignore it. We could retrieve the body
-					// of the message from the CLEARCHAT message but then we couldn't
-					// figure out the time span between the message and the deletion
-					privmsg := history.Find(func(privmsg *message.PrivateMessage) bool {
-						if privmsg.ID == msg.TargetMsgID && !privmsg.Stored {
-							privmsg.Stored = true
-							return true
-						}
-						return false
-					})
-					if privmsg != nil {
-						msg.LastMessages = []*message.PrivateMessage{privmsg}
-						b.sto.Save(msg)
-					}
-				case message.MessagePrivmsg:
-					// extend the history with the received message
-					history = history.Append(msg.LastMessages[0])
-				}
-			}
-			w.Done()
-		}(msgch)
+		es.Join(string(ch))
 	}
-	// Signal that we spawned all the go-routines and are ready to start receiving
-	// messages
-	b.trackerReady <- struct{}{}
-	w.Wait()
-	// Signal that all go-routines are finished
-	b.done <- struct{}{}
+	return es.Connect()
 }
 
-func (b *Bot) Start() {
-	var w sync.WaitGroup
+// signalConnected signals the first time the source is connected. The source
+// may call it again after reconnecting, so it must never block
+func (b *Bot) signalConnected() {
+	atomic.StoreInt64(&b.connectedAt, b.clock.Now().UnixNano())
+	select {
+	case b.ircReady <- struct{}{}:
+	default:
+	}
+}
 
-	log.Print("initializing storage...")
-	sess := database.New(cfg.DBMigrate)
-	driver := NewCassandraStorage(sess)
-	b.SetStorage(NewStorage(driver))
-	w.Add(1)
-	go func() {
-		b.sto.Start()
-		w.Done()
-	}()
+// StartTracker spawns the go-routine of every channel, ready to receive their
+// messages once it returns
+func (b *Bot) StartTracker(channels []Channel) {
+	for _, ch := range channels {
+		b.track(ch)
+	}
+}
 
-	chs, err := b.sto.Channels()
-	if err != nil {
-		errors.WrapFatal(err)
+// runTracker handles the messages of a single twitch channel until msgch is
+// closed
+func (b *Bot) runTracker(msgch chan *message.Message) {
+	t := newChannelTracker(b.sto, b.sto.Save)
+	for msg := range msgch {
+		queues.dequeue()
+		t.process(msg)
+	}
+}
+
+// channelTracker keeps the history of a single twitch channel and saves its
+// moderations along with the messages related to them. It is not safe for
+// concurrent use.
+type channelTracker struct {
+	sto     *Storage
+	save    func(msg *message.Message) bool
+	history *message.MessageRing[*message.PrivateMessage]
+	// users is nil unless the recent messages of every user are kept apart,
+	// see cfg.UserHistorySize
+	users *message.UserHistory
+	// whether the channel is registered for the third-party emotes
+	emotesRegistered bool
+	// floods counts the messages of every user in the flood window, nil unless
+	// cfg.FloodMessages
+	floods *sketch.Window
+}
+
+// process handles msg with the handler of its type, see RegisterHandler
+func (t *channelTracker) process(msg *message.Message) {
+	// the arguments would be allocated even with the debug logs off
+	if logger.Enabled(logger.Tracker) {
+		logger.Debugf(logger.Tracker, "#%s %s of %s", msg.Channel, msg.Type, msg.Username)
+	}
+	if h, ok := handlers[msg.Type]; ok {
+		h(t, msg)
+	}
+}
+
+// newChannelTracker creates a tracker that calls `save` with every moderation
+// ready to be stored
+func newChannelTracker(sto *Storage, save func(msg *message.Message) bool) *channelTracker {
+	t := &channelTracker{
+		sto: sto,
+		// history is scoped to each tracker, per twitch channel.
+		history: message.New(message.MaxHistory, noopPrivmsg),
+		save:    save,
+	}
+	if cfg.UserHistorySize > 0 {
+		t.users = message.NewUserHistory(cfg.UserHistorySize, cfg.UserHistoryUsers)
+	}
+	if cfg.FloodMessages > 0 {
+		window := time.Duration(cfg.FloodWindowSeconds) * time.Second
+		t.floods = sketch.NewWindow(window, FloodBuckets, cfg.FloodEpsilon, cfg.FloodDelta)
+	}
+	return t
+}
+
+// Start starts the storage and then runs the phases of the startup in order:
+// PhaseChannels, PhaseTracker and PhaseSource, see Startup. It returns the
+// error of the first phase that fails, times out or is interrupted by ctx.
+// Otherwise it blocks until the source is disconnected and returns its error,
+// nil if it was disconnected by Stop
+func (b *Bot) Start(ctx context.Context) error {
+	b.startedAt = b.clock.Now()
+	go b.sto.Start()
+	defer b.logStartup()
+
+	var chs []Channel
+	if err := b.phase(ctx, PhaseChannels, func(ctx context.Context) error {
+		var err error
+		chs, err = b.sto.Channels()
+		return err
+	}); err != nil {
+		return err
+	}
+	if b.suspensions != nil {
+		if err := b.suspensions.load(); err != nil {
+			errors.WrapAndLog(err)
+		}
+		if active := b.suspensions.active(chs); len(active) < len(chs) {
+			log.Printf("suspended channels not tracked: %v", b.suspensions.list())
+			chs = active
+		}
 	}
 	log.Printf("channels about to be tracked: %v", chs)
-	log.Print("initializing channel tracker...")
-	w.Add(1)
-	go func(chs []Channel) {
+	if b.cursors != nil {
+		if err := b.cursors.load(); err != nil {
+			errors.WrapAndLog(err)
+		}
+		go b.cursors.Start(ctx)
+	}
+	go b.validateChannels(chs)
+
+	if err := b.phase(ctx, PhaseTracker, func(ctx context.Context) error {
 		b.StartTracker(chs)
-		w.Done()
-	}(chs)
-	<-b.trackerReady
-	log.Print("tracker ready")
-
-	log.Print("initializing IRC client...")
-	w.Add(1)
-	go func(chs []Channel) {
-		if err := b.StartClient(chs); err != nil {
-			if !errors.Is(err, twitch.ErrClientDisconnected) {
-				errors.WrapFatal(err)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// disconnected carries the error of the source once it is disconnected
+	disconnected := make(chan error, 1)
+	if err := b.phase(ctx, PhaseSource, func(ctx context.Context) error {
+		go func() {
+			if cfg.Source == SourceEventSub {
+				disconnected <- b.StartEventSub(chs)
+			} else {
+				disconnected <- b.StartClient(chs)
 			}
+		}()
+		select {
+		case <-b.ircReady:
+			return nil
+		case err := <-disconnected:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
 		}
-		w.Done()
-	}(chs)
-	<-b.ircReady
-	log.Print("connected to IRC server")
+	}); err != nil {
+		return err
+	}
+	log.Printf("connected to %s", cfg.Source)
+	close(b.ready)
+	if b.claims != nil {
+		go b.startClaims(ctx)
+	}
+	if b.suspensions != nil {
+		go b.startSuspensions(ctx)
+	}
+	if b.cursors != nil {
+		go b.recoverGaps(ctx, chs)
+	}
+
+	err := <-disconnected
+	if errors.Is(err, twitch.ErrClientDisconnected) || errors.Is(err, eventsub.ErrDisconnected) {
+		return nil
+	}
+	return err
+}
 
-	w.Wait()
+// Ready is closed once the tracker is started and the source connected
+func (b *Bot) Ready() <-chan struct{} {
+	return b.ready
 }
 
+// ForgetUser removes the messages of `username` from the in-memory history of
+// every tracked channel.
+func (b *Bot) ForgetUser(username string) {
+	b.broadcast(&message.Message{
+		Type:     message.MessagePurge,
+		Username: username,
+	})
+}
+
+// SetStorage sets the storage used by the bot. It must be called before Start.
+// The bot calls Helix with the client of the storage from then on
 func (b *Bot) SetStorage(sto *Storage) {
 	b.sto = sto
+	b.helix = sto.helix
+	b.claims = newClaims(sto.driver)
+	b.cursors = newCursors(sto.driver)
+	b.suspensions = newSuspensions(sto.driver)
 }
 
+// Stop disconnects the source and drains the trackers and the storage. It is
+// also the shutdown of a failed Start, so every step runs even if the previous
+// ones failed, and the first error is returned
 func (b *Bot) Stop() error {
-	// Stop IRC Client
-	log.Print("stopping IRC client")
-	if err := b.client.Disconnect(); err != nil {
-		return err
+	var stopErr error
+	// Stop IRC or EventSub Client, unless the startup failed before
+	b.mu.RLock()
+	source := b.source
+	b.mu.RUnlock()
+	if source != nil {
+		log.Print("stopping client")
+		if err := source.Disconnect(); err != nil {
+			errors.WrapAndLog(err)
+			stopErr = err
+		} else {
+			log.Print("client stopped")
+		}
 	}
-	log.Print("IRC client stopped")
+
+	b.releaseClaims()
 
 	// Close all channels
 	log.Print("stopping tracker")
-	for _, ch := range tracked {
-		close(ch)
+	b.mu.Lock()
+	b.stopped = true
+	for ch, msgch := range b.tracked {
+		close(msgch)
+		delete(b.tracked, ch)
 	}
-	// Wait for all the go-routines spawned by the bot to finish
-	<-b.done
+	b.mu.Unlock()
+	// Wait for all the go-routines spawned by the tracker to finish
+	b.trackers.Wait()
 	log.Print("tracker stopped")
+	if b.cursors != nil {
+		if err := b.cursors.flush(); err != nil {
+			errors.WrapAndLog(err)
+		}
+	}
 
 	// Gracefully close storage and underlying database
 	log.Print("stopping storage")
 	b.sto.Stop()
 	log.Print("storage stopped")
 
-	return nil
+	if b.tap != nil {
+		if err := b.tap.Close(); err != nil {
+			errors.WrapAndLog(err)
+		}
+	}
+	if b.fixtures != nil {
+		if err := b.fixtures.Close(); err != nil {
+			errors.WrapAndLog(err)
+		}
+	}
+
+	b.logSummary()
+
+	return stopErr
+}
+
+// newTap opens the tap file from the configuration. It fails if the messages
+// are encrypted, as the tap writes them in plaintext
+func newTap() (*tap.Tap, error) {
+	if cfg.EncryptionKey != "" {
+		return nil, ErrTapEncrypted
+	}
+	var channels []string
+	if cfg.TapChannels != "" {
+		channels = strings.Split(cfg.TapChannels, ",")
+	}
+	log.Printf("tapping raw IRC lines into %s", cfg.TapFile)
+	return tap.Open(cfg.TapFile, cfg.TapMaxBytes, cfg.TapBackups, channels)
+}
+
+// newFixtures returns nil if the parsed events are not recorded as fixtures
+func newFixtures() *fixtures.Recorder {
+	if cfg.FixturesFile == "" {
+		return nil
+	}
+	r, err := fixtures.Open(cfg.FixturesFile, cfg.FixturesRate, cfg.FixturesBodies)
+	if err != nil {
+		errors.WrapFatalWithContext(err, struct {
+			FixturesFile   string
+			FixturesBodies string
+		}{cfg.FixturesFile, cfg.FixturesBodies})
+	}
+	log.Printf("recording fixtures into %s", cfg.FixturesFile)
+	return r
+}
+
+// SetClock sets the time of the bot, e.g. a fake clock in the tests. It must be
+// set before the bot starts
+func (b *Bot) SetClock(c clock.Clock) {
+	b.clock = c
+	b.twitch.local = c
 }
 
 func New() *Bot {
 	b := &Bot{
-		trackerReady: make(chan struct{}, 1),
-		ircReady:     make(chan struct{}, 1),
-		done:         make(chan struct{}, 1),
+		ircReady:  make(chan struct{}, 1),
+		ready:     make(chan struct{}),
+		tracked:   make(map[string]chan *message.Message),
+		replies:   newCooldown(time.Duration(cfg.ChatCommandsCooldownSeconds) * time.Second),
+		chat:      newChatGate(),
+		templates: newChatTemplates(),
+		helix:     helix.New(cfg.HelixClientID, cfg.HelixToken),
+		clock:     clock.Real,
+		twitch:    newTwitchClock(clock.Real),
+		fixtures:  newFixtures(),
 	}
 	return b
 }
-
-func init() {
-	tracked = make(map[string]chan *message.Message)
-}
@@ -0,0 +1,251 @@
+package bot
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/gempir/go-twitch-irc/v3"
+
+	"github.com/hammertrack/tracker/internal/justlog"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestClearChatModeration(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		raw  string
+		want *message.Message
+	}{
+		{
+			"ban",
+			`@room-id=1;target-user-id=42;tmi-sent-ts=1700000000000 :tmi.twitch.tv CLEARCHAT #foo :bar`,
+			&message.Message{Type: message.MessageBan, Username: "bar", UserID: "42"},
+		},
+		{
+			"timeout with reason",
+			`@ban-duration=600;ban-reason=spamming\slinks;room-id=1;target-user-id=42;tmi-sent-ts=1700000000000 :tmi.twitch.tv CLEARCHAT #foo :bar`,
+			&message.Message{Type: message.MessageTimeout, Username: "bar", UserID: "42", Duration: 600, Reason: "spamming links"},
+		},
+		{"chat clear", `@room-id=1;tmi-sent-ts=1700000000000 :tmi.twitch.tv CLEARCHAT #foo`, nil},
+	}
+	for _, tt := range tests {
+		msg, ok := twitch.ParseMessage(tt.raw).(*twitch.ClearChatMessage)
+		if !ok {
+			t.Fatalf("%s is not a CLEARCHAT", tt.name)
+		}
+		got := clearChatModeration(msg)
+		if got == nil || tt.want == nil {
+			if got != tt.want {
+				t.Errorf("%s got: %+v, want: %+v", tt.name, got, tt.want)
+			}
+			continue
+		}
+		if got.Type != tt.want.Type || got.Username != tt.want.Username || got.UserID != tt.want.UserID ||
+			got.Duration != tt.want.Duration || got.Reason != tt.want.Reason || got.Channel != "foo" {
+			t.Errorf("%s got: %+v, want: %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// BenchmarkPrivmsg measures the path of a PRIVMSG from the IRC client to the
+// history of its channel, which runs for every chat message
+func BenchmarkPrivmsg(b *testing.B) {
+	raw := `@badge-info=subscriber/16;badges=subscriber/12,premium/1;color=#FF0000;display-name=Bar;emotes=;id=b34ccfc7-4977-403a-8a94-33c6bac34fb8;mod=0;room-id=1;subscriber=1;tmi-sent-ts=1700000000000;turbo=0;user-id=42;user-type= :bar!bar@bar.tmi.twitch.tv PRIVMSG #foo :hello world`
+	msg, ok := twitch.ParseMessage(raw).(*twitch.PrivateMessage)
+	if !ok {
+		b.Fatal("not a PRIVMSG")
+	}
+	sto := NewStorage(NewMemoryStorage(10))
+	defer sto.Stop()
+	t := newChannelTracker(sto, sto.Save)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m := privmsgMessage(msg)
+		internMessage(m)
+		eventsTotal.Inc(m.Channel, string(m.Type))
+		t.process(m)
+	}
+}
+
+// TestPrivmsgMessage is not parallel, AllocsPerRun counts the allocations of
+// every goroutine
+func TestPrivmsgMessage(t *testing.T) {
+	raw := `@badge-info=founder/3;badges=vip/1,founder/0,glhf-pledge/1;room-id=1;subscriber=1;tmi-sent-ts=1700000000000;user-id=42 :bar!bar@bar.tmi.twitch.tv PRIVMSG #foo :hello`
+	msg, ok := twitch.ParseMessage(raw).(*twitch.PrivateMessage)
+	if !ok {
+		t.Fatal("not a PRIVMSG")
+	}
+	m := privmsgMessage(msg)
+	if len(m.LastMessages) != 1 || m.LastMessages[0].Body != "hello" || m.LastMessages[0].SubMonths != 3 {
+		t.Fatalf("got: %+v, want a PRIVMSG of a founder of 3 months", m.LastMessages)
+	}
+	want := []string{"founder", "glhf-pledge", "vip"}
+	got := m.LastMessages[0].Badges
+	if len(got) != len(want) {
+		t.Fatalf("got: %v, want: %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got: %v, want: %v", got, want)
+		}
+	}
+	// the messages with the same badges share them
+	if again := privmsgMessage(msg).LastMessages[0].Badges; &again[0] != &got[0] {
+		t.Errorf("got: a new badge set, want: the shared one")
+	}
+	if n := testing.AllocsPerRun(100, func() { privmsgMessage(msg) }); n > 3 {
+		t.Errorf("got: %v allocs, want: at most %v", n, 3)
+	}
+}
+
+// BenchmarkHistoryMemory measures the memory kept by the full histories of the
+// channels, of 40 users chatting in each one
+func BenchmarkHistoryMemory(b *testing.B) {
+	sto := NewStorage(NewMemoryStorage(10))
+	defer sto.Stop()
+	const channels = 100
+	for n := 0; n < b.N; n++ {
+		trackers := make([]*channelTracker, channels)
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		for c := range trackers {
+			trackers[c] = newChannelTracker(sto, sto.Save)
+			for i := 0; i < 2*message.MaxHistory; i++ {
+				raw := fmt.Sprintf(`@badge-info=subscriber/16;badges=subscriber/12,premium/1;client-nonce=%032d;color=#FF0000;display-name=User%d;emotes=;first-msg=0;flags=;id=b34ccfc7-4977-403a-8a94-%012d;mod=0;returning-chatter=0;room-id=%d;subscriber=1;tmi-sent-ts=1700000000000;turbo=0;user-id=%d;user-type= :user%d!user%d@user%d.tmi.twitch.tv PRIVMSG #channel%d :hello world`,
+					i, i%40, i, c, i%40, i%40, i%40, i%40, c)
+				m := privmsgMessage(twitch.ParseMessage(raw).(*twitch.PrivateMessage))
+				internMessage(m)
+				trackers[c].process(m)
+			}
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/channels, "B/channel")
+		runtime.KeepAlive(trackers)
+	}
+}
+
+// trackLines runs the IRC lines through a bot tracking #foo and waits until
+// its tracker processed them
+func trackLines(t *testing.T, sto *Storage, lines ...string) {
+	t.Helper()
+	b := New()
+	b.SetStorage(sto)
+	b.track("foo")
+	for _, line := range lines {
+		switch m := twitch.ParseMessage(line).(type) {
+		case *twitch.PrivateMessage:
+			b.handlePrivmsg(*m)
+		case *twitch.ClearChatMessage:
+			b.handleClearChat(*m)
+		case *twitch.ClearMessage:
+			b.handleClear(*m)
+		default:
+			t.Fatalf("unexpected line %q", line)
+		}
+	}
+	b.untrack("foo")
+	b.trackers.Wait()
+}
+
+func TestTrackTimeout(t *testing.T) {
+	t.Parallel()
+	sto := NewStorage(NewMemoryStorage(10))
+	defer sto.Stop()
+	trackLines(t, sto,
+		`@id=1;room-id=1;tmi-sent-ts=1700000000000;user-id=42 :bar!bar@bar.tmi.twitch.tv PRIVMSG #foo :hello`,
+		`@ban-duration=600;room-id=1;target-user-id=42;tmi-sent-ts=1700000010000 :tmi.twitch.tv CLEARCHAT #foo :bar`,
+	)
+	mods, err := sto.UserModerations("bar", "foo", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mods) != 1 || mods[0].Type != message.MessageTimeout {
+		t.Fatalf("got: %+v, want: the timeout of bar", mods)
+	}
+	if got, want := mods[0].Bucket, message.TimeoutWarning; got != want {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestTrackDeletion(t *testing.T) {
+	t.Parallel()
+	privmsg := `@id=1;room-id=1;tmi-sent-ts=1700000000000;user-id=42 :bar!bar@bar.tmi.twitch.tv PRIVMSG #foo :hello`
+	clearmsg := func(id string) string {
+		return `@login=bar;room-id=;target-msg-id=` + id + `;tmi-sent-ts=1700000010000 :tmi.twitch.tv CLEARMSG #foo :bye`
+	}
+	tests := []struct {
+		name          string
+		fallback      bool
+		target        string
+		wantBody      string
+		wantNoLatency bool
+	}{
+		{"in history", false, "1", "hello", false},
+		{"in history with fallback", true, "1", "hello", false},
+		{"not in history", false, "2", "", false},
+		{"not in history with fallback", true, "2", "bye", true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			sto := NewStorage(NewMemoryStorage(10))
+			defer sto.Stop()
+			sto.deletionFallback = tt.fallback
+			trackLines(t, sto, privmsg, clearmsg(tt.target))
+			mods, err := sto.UserModerations("bar", "foo", 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantBody == "" {
+				if len(mods) != 0 {
+					t.Fatalf("got: %+v, want: no moderations", mods)
+				}
+				return
+			}
+			if len(mods) != 1 || mods[0].Type != message.MessageDeletion || len(mods[0].Messages) != 1 {
+				t.Fatalf("got: %+v, want: the deletion of bar", mods)
+			}
+			if got := mods[0].Messages[0]; got != tt.wantBody {
+				t.Errorf("got: %v, want: %v", got, tt.wantBody)
+			}
+			if got := mods[0].NoLatencyData; got != tt.wantNoLatency {
+				t.Errorf("no latency data got: %v, want: %v", got, tt.wantNoLatency)
+			}
+			if got := mods[0].TimeToAction == nil; got != tt.wantNoLatency {
+				t.Errorf("unknown time to action got: %v, want: %v", got, tt.wantNoLatency)
+			}
+		})
+	}
+}
+
+func TestBackfillMessage(t *testing.T) {
+	t.Parallel()
+	at := time.Date(2023, 11, 14, 22, 13, 30, 0, time.UTC)
+	tests := []struct {
+		raw  string
+		want message.MessageType
+	}{
+		{`@room-id=1;tmi-sent-ts=1700000000000;user-id=42 :bar!bar@bar.tmi.twitch.tv PRIVMSG #foo :hello`, message.MessagePrivmsg},
+		{`@ban-duration=600;room-id=1;target-user-id=42 :tmi.twitch.tv CLEARCHAT #foo :bar`, message.MessageTimeout},
+		{`@room-id=1;target-user-id=42 :tmi.twitch.tv CLEARCHAT #foo :bar`, message.MessageBan},
+		{`@login=bar;room-id=;target-msg-id=1 :tmi.twitch.tv CLEARMSG #foo :hello`, message.MessageDeletion},
+		{`@room-id=1 :tmi.twitch.tv CLEARCHAT #foo`, ""},
+	}
+	for _, tt := range tests {
+		msg := backfillMessage(&justlog.Entry{Message: twitch.ParseMessage(tt.raw), At: at})
+		var got message.MessageType
+		if msg != nil {
+			got = msg.Type
+		}
+		if got != tt.want {
+			t.Errorf("%s got: %q, want: %q", tt.raw, got, tt.want)
+		}
+	}
+}
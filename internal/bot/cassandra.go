@@ -2,17 +2,112 @@ package bot
 
 import (
 	"context"
+	"hash/fnv"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gocql/gocql"
 
 	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/accounts"
+	"github.com/hammertrack/tracker/internal/compress"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/database"
+	"github.com/hammertrack/tracker/internal/encryption"
+	"github.com/hammertrack/tracker/internal/links"
 	"github.com/hammertrack/tracker/internal/message"
+	"github.com/hammertrack/tracker/internal/sampling"
 )
 
+// ShardOf returns the shard assigned to a new channel, from 1 to `count`
+func ShardOf(ch Channel, count int) int {
+	if count <= 1 {
+		return 1
+	}
+	h := fnv.New32a()
+	h.Write([]byte(ch))
+	return int(h.Sum32()%uint32(count)) + 1
+}
+
+// Tables of the moderations written by the cassandra driver, see
+// cfg.ModerationTables
+const (
+	TablesBoth      = "both"
+	TablesByUser    = "by_user"
+	TablesByChannel = "by_channel"
+)
+
+var ErrModerationTables = errors.New("unknown moderation tables, expected both, by_user or by_channel")
+
+// ParseModerationTables returns whether the moderations are written to the
+// table by user and to the table by channel
+func ParseModerationTables(tables string) (byUser, byChannel bool, err error) {
+	switch strings.ToLower(strings.TrimSpace(tables)) {
+	case TablesBoth:
+		return true, true, nil
+	case TablesByUser:
+		return true, false, nil
+	case TablesByChannel:
+		return false, true, nil
+	}
+	return false, false, errors.WrapWithContext(ErrModerationTables, struct{ Tables string }{tables})
+}
+
+// requireTable returns ErrUnsupported if the moderations are not written to
+// `table`, so the endpoints that read it are disabled rather than empty
+func (c *Cassandra) requireTable(table string) error {
+	if (table == TablesByUser && !c.byUser) || (table == TablesByChannel && !c.byChannel) {
+		return errors.WrapWithContext(ErrUnsupported, struct{ Table string }{table})
+	}
+	return nil
+}
+
 type Cassandra struct {
-	s      *gocql.Session
+	s *gocql.Session
+	// r is the session of the reads of the API, s if they are not separated.
+	// See read
+	r      *gocql.Session
 	ctx    context.Context
 	cancel context.CancelFunc
+	// policies of the inserts and reads of moderations, see database.Policies
+	policies *database.Policies
+	// byUser and byChannel are whether the moderations are written to
+	// mod_messages_by_user_name and mod_messages_by_channel_name, see
+	// cfg.ModerationTables
+	byUser, byChannel bool
+
+	mu sync.RWMutex
+	// retention is the TTL in seconds of the moderations of each channel with a
+	// retention policy
+	retention map[string]int
+	// tenants is the tenant of each channel that belongs to one
+	tenants map[string]string
+}
+
+// decompress sets the messages of a moderation from the compressed blob `z` of
+// its row, if any. Rows stored without compression have no blob, and encrypted
+// blobs are left for the storage to open
+func decompress(m *Moderation, z []byte) error {
+	if len(z) == 0 {
+		return nil
+	}
+	if encryption.IsEncrypted(string(z)) {
+		m.sealed = z
+		return nil
+	}
+	msgs, err := compress.Decode(z)
+	if err != nil {
+		return errors.WrapWithContext(err, struct {
+			Username string
+			Channel  string
+			At       time.Time
+		}{m.Username, m.Channel, m.At})
+	}
+	m.Messages = msgs
+	return nil
 }
 
 func (c *Cassandra) Close() error {
@@ -20,16 +115,28 @@ func (c *Cassandra) Close() error {
 	c.cancel()
 	// Close all sessions
 	c.s.Close()
+	if c.r != c.s {
+		c.r.Close()
+	}
 	return nil
 }
 
-func (c *Cassandra) Insert(msg *message.Message) {
+// read returns a query of the reads of the API, so they can be served by
+// other hosts with another consistency level than the inserts. See
+// cfg.DBReadHosts
+func (c *Cassandra) read(stmt string, values ...interface{}) *gocql.Query {
+	return c.r.Query(stmt, values...).Consistency(c.policies.ReadConsistency)
+}
+
+func (c *Cassandra) Insert(msg *message.Message) error {
 	recent := msg.LastMessages
 
 	// We cannot know whether it is sub with no messages in history
 	sub := message.SubscribedStatusUnknown
+	subMonths := 0
 	if len(recent) > 0 {
 		sub = recent[0].Subscribed
+		subMonths = recent[0].SubMonths
 	}
 
 	msgs := make([]string, len(recent))
@@ -37,27 +144,71 @@ func (c *Cassandra) Insert(msg *message.Message) {
 		msgs[i] = m.Body
 	}
 
-	if err := c.s.Query(`INSERT INTO hammertrack.mod_messages_by_user_name (user_name, channel_name, at, messages, sub)
-  VALUES (?, ?, ?, ?, ?)`, msg.Username, msg.Channel, msg.At, msgs, sub).
-		WithContext(c.ctx).
-		Exec(); err != nil {
-		errors.WrapAndLog(err)
-		return
+	// compressed rows store their messages only in messages_z
+	z := msg.Compressed
+	if z != nil {
+		msgs = nil
+	}
+	// null rather than empty, with no cell to index
+	var search *string
+	if text := searchText(msgs); text != "" {
+		search = &text
+	}
+
+	var tta *float64
+	if d, ok := msg.TimeToAction(); ok {
+		secs := d.Seconds()
+		tta = &secs
+	}
+
+	ttl := c.ttl(msg.Channel)
+	tenant := c.tenantOf(msg.Channel)
+	if c.byUser {
+		if err := c.s.Query(`INSERT INTO hammertrack.mod_messages_by_user_name (user_name, channel_name, at, messages, sub, toxicity, tags, type, automod_status, automod_category, user_id, time_to_action, shared_session, source_channel_id, messages_z, duration, tenant_id, sub_months, reason, channels, escalated_from, partial, region, bucket, no_latency_data, instance)
+  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) USING TTL ?`, msg.Username, msg.Channel, msg.At, msgs, sub, msg.Toxicity, msg.Tags,
+			string(msg.Type), msg.AutomodStatus, msg.AutomodCategory, msg.UserID, tta, msg.SharedSession, msg.SourceChannelID, z, msg.Duration, tenant, subMonths, msg.Reason, msg.Channels, msg.EscalatedFrom, msg.Partial, msg.Region, string(msg.Bucket), msg.NoLatencyData, msg.Instance, ttl).
+			Consistency(c.policies.InsertConsistency).
+			SetSpeculativeExecutionPolicy(c.policies.Speculative).
+			Idempotent(true).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			storageErrors.Inc("insert")
+			return errors.Wrap(err)
+		}
 	}
 	// We don't care about atomicity for this use case. The overhead of a batch is
 	// worse than a dangling user in by_channel_name table if the previous insert
 	// fails
-	if err := c.s.Query(`INSERT INTO hammertrack.mod_messages_by_channel_name (month, channel_name, user_name, at, messages, sub)
-    VALUES (?, ?, ?, ?, ?, ?)`, msg.At.Month(), msg.Channel, msg.Username, msg.At, msgs, sub).
-		WithContext(c.ctx).
-		Exec(); err != nil {
-		errors.WrapAndLog(err)
-		return
+	if c.byChannel {
+		if err := c.s.Query(`INSERT INTO hammertrack.mod_messages_by_channel_name (month, channel_name, user_name, at, messages, sub, toxicity, tags, type, automod_status, automod_category, user_id, time_to_action, shared_session, source_channel_id, messages_z, duration, tenant_id, sub_months, reason, channels, escalated_from, partial, search_text, region, bucket, no_latency_data, instance)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) USING TTL ?`, msg.At.Month(), msg.Channel, msg.Username, msg.At, msgs, sub, msg.Toxicity, msg.Tags,
+			string(msg.Type), msg.AutomodStatus, msg.AutomodCategory, msg.UserID, tta, msg.SharedSession, msg.SourceChannelID, z, msg.Duration, tenant, subMonths, msg.Reason, msg.Channels, msg.EscalatedFrom, msg.Partial, search, msg.Region, string(msg.Bucket), msg.NoLatencyData, msg.Instance, ttl).
+			Consistency(c.policies.InsertConsistency).
+			SetSpeculativeExecutionPolicy(c.policies.Speculative).
+			Idempotent(true).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			storageErrors.Inc("insert")
+			return errors.Wrap(err)
+		}
+	}
+	if msg.UserID != "" {
+		if err := c.seeLogin(msg.UserID, msg.Username, msg.At); err != nil {
+			storageErrors.Inc("see_login")
+			errors.WrapAndLog(err)
+		}
 	}
+	if msg.Type == message.MessageAutomod && len(recent) > 0 {
+		if err := c.insertHold(msg, ttl); err != nil {
+			storageErrors.Inc("insert_hold")
+			errors.WrapAndLog(err)
+		}
+	}
+	return nil
 }
 
 func (c *Cassandra) Channels() ([]Channel, error) {
-	scanner := c.s.Query(`SELECT user_name FROM tracked_channels WHERE shard_id=1`).
+	scanner := c.s.Query(`SELECT user_name FROM tracked_channels WHERE shard_id=?`, cfg.ShardID).
 		WithContext(c.ctx).
 		Iter().
 		Scanner()
@@ -79,9 +230,491 @@ func (c *Cassandra) Channels() ([]Channel, error) {
 	return all, nil
 }
 
-func NewCassandraStorage(s *gocql.Session) Driver {
+func (c *Cassandra) UserModerations(username string, ch Channel, limit int) ([]*Moderation, error) {
+	return c.userModerations(username, ch, "", time.Time{}, limit)
+}
+
+// UserModerationsBefore needs the channel, the rows of a user are clustered by
+// channel before the time
+func (c *Cassandra) UserModerationsBefore(username string, ch Channel, before time.Time, limit int) ([]*Moderation, error) {
+	return c.userModerations(username, ch, "", before, limit)
+}
+
+// TaggedUserModerations filters the rows of a single partition, the one of the
+// user, so ALLOW FILTERING does not scan the rest of the table
+func (c *Cassandra) TaggedUserModerations(username string, ch Channel, tag string, limit int) ([]*Moderation, error) {
+	return c.userModerations(username, ch, tag, time.Time{}, limit)
+}
+
+// userModerations returns the most recent moderations of `username`, only in
+// `ch` and with `tag` if they are not empty and only before `before` if it is
+// not zero
+func (c *Cassandra) userModerations(username string, ch Channel, tag string, before time.Time, limit int) ([]*Moderation, error) {
+	if err := c.requireTable(TablesByUser); err != nil {
+		return nil, err
+	}
+	// rows are clustered by channel first, so without a channel these are the
+	// most recent ones of the first channels rather than the most recent ones
+	// overall
+	where := "user_name=?"
+	values := []interface{}{username}
+	if ch != "" {
+		where += " AND channel_name=?"
+		values = append(values, string(ch))
+	}
+	if !before.IsZero() {
+		where += " AND at<?"
+		values = append(values, before)
+	}
+	filtering := ""
+	if tag != "" {
+		where += " AND tags CONTAINS ?"
+		values = append(values, tag)
+		filtering = " ALLOW FILTERING"
+	}
+	values = append(values, limit)
+	scanner := c.read(`SELECT channel_name, at, messages, sub, toxicity, tags, type, automod_status, automod_category, user_id, account_created_at, followed_at, time_to_action, shared_session, source_channel_id, messages_z, duration, tenant_id, sub_months, deleted, note, reason, channels, escalated_from, partial, region, bucket, no_latency_data, instance FROM hammertrack.mod_messages_by_user_name
+  WHERE `+where+` LIMIT ?`+filtering, values...).
+		SetSpeculativeExecutionPolicy(c.policies.Speculative).
+		Idempotent(true).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+
+	all := make([]*Moderation, 0, limit)
+	for scanner.Next() {
+		m := &Moderation{Username: username}
+		var z []byte
+		if err := scanner.Scan(&m.Channel, &m.At, &m.Messages, &m.Sub, &m.Toxicity, &m.Tags, &m.Type, &m.AutomodStatus, &m.AutomodCategory, &m.UserID, &m.AccountCreatedAt, &m.FollowedAt, &m.TimeToAction, &m.SharedSession, &m.SourceChannelID, &z, &m.Duration, &m.TenantID, &m.SubMonths, &m.Deleted, &m.Note, &m.Reason, &m.Channels, &m.EscalatedFrom, &m.Partial, &m.Region, &m.Bucket, &m.NoLatencyData, &m.Instance); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		if err := decompress(m, z); err != nil {
+			return nil, err
+		}
+		all = append(all, m)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return all, nil
+}
+
+// UsersModerations reads the partitions of all the users in a single query.
+// Like userModerations without a channel, the rows are the first ones of every
+// partition, which are clustered by channel first
+func (c *Cassandra) UsersModerations(usernames []string, chs []Channel, limit int) (map[string][]*Moderation, error) {
+	if err := c.requireTable(TablesByUser); err != nil {
+		return nil, err
+	}
+	where := "user_name IN ?"
+	values := []interface{}{usernames}
+	if len(chs) > 0 {
+		names := make([]string, len(chs))
+		for i, ch := range chs {
+			names[i] = string(ch)
+		}
+		where += " AND channel_name IN ?"
+		values = append(values, names)
+	}
+	values = append(values, limit)
+	scanner := c.read(`SELECT user_name, channel_name, at, type, deleted FROM hammertrack.mod_messages_by_user_name
+  WHERE `+where+` PER PARTITION LIMIT ?`, values...).
+		SetSpeculativeExecutionPolicy(c.policies.Speculative).
+		Idempotent(true).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+
+	byUser := make(map[string][]*Moderation, len(usernames))
+	for scanner.Next() {
+		m := &Moderation{}
+		if err := scanner.Scan(&m.Username, &m.Channel, &m.At, &m.Type, &m.Deleted); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		byUser[m.Username] = append(byUser[m.Username], m)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return byUser, nil
+}
+
+func (c *Cassandra) ChannelModerations(ch Channel, from, to time.Time, fn func(*Moderation) error) error {
+	if err := c.requireTable(TablesByChannel); err != nil {
+		return err
+	}
+	// partitions are by month of the year, with no year. Every month in the
+	// range is queried once, the timestamps filter out the other years
+	months := make(map[time.Month]bool)
+	first := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, from.Location())
+	for m := first; !m.After(to) && len(months) < 12; m = m.AddDate(0, 1, 0) {
+		months[m.Month()] = true
+	}
+
+	for month := range months {
+		scanner := c.read(`SELECT user_name, at, messages, sub, toxicity, tags, type, automod_status, automod_category, user_id, account_created_at, followed_at, time_to_action, shared_session, source_channel_id, messages_z, duration, tenant_id, sub_months, deleted, note, reason, channels, escalated_from, partial, region, bucket, no_latency_data, instance FROM hammertrack.mod_messages_by_channel_name
+  WHERE channel_name=? AND month=? AND at>=? AND at<=?`, string(ch), int(month), from, to).
+			SetSpeculativeExecutionPolicy(c.policies.Speculative).
+			Idempotent(true).
+			WithContext(c.ctx).
+			Iter().
+			Scanner()
+		for scanner.Next() {
+			m := &Moderation{Channel: string(ch)}
+			var z []byte
+			if err := scanner.Scan(&m.Username, &m.At, &m.Messages, &m.Sub, &m.Toxicity, &m.Tags, &m.Type, &m.AutomodStatus, &m.AutomodCategory, &m.UserID, &m.AccountCreatedAt, &m.FollowedAt, &m.TimeToAction, &m.SharedSession, &m.SourceChannelID, &z, &m.Duration, &m.TenantID, &m.SubMonths, &m.Deleted, &m.Note, &m.Reason, &m.Channels, &m.EscalatedFrom, &m.Partial, &m.Region, &m.Bucket, &m.NoLatencyData, &m.Instance); err != nil {
+				return errors.Wrap(err)
+			}
+			if err := decompress(m, z); err != nil {
+				return err
+			}
+			if err := fn(m); err != nil {
+				return err
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// SearchModerations queries the SASI index of the messages of by_channel_name.
+// The channel is only a part of the partition key, so it is filtered by the
+// index rather than read from a partition
+func (c *Cassandra) SearchModerations(q string, chs []Channel, limit int) ([]*Moderation, error) {
+	if err := c.requireTable(TablesByChannel); err != nil {
+		return nil, err
+	}
+	// a single query of every channel without a scope
+	if len(chs) == 0 {
+		chs = []Channel{""}
+	}
+	var all []*Moderation
+	for _, ch := range chs {
+		where := "search_text LIKE ?"
+		values := []interface{}{"%" + q + "%"}
+		filtering := ""
+		if ch != "" {
+			where += " AND channel_name=?"
+			values = append(values, string(ch))
+			filtering = " ALLOW FILTERING"
+		}
+		values = append(values, limit)
+		scanner := c.read(`SELECT channel_name, user_name, at, messages, sub, toxicity, tags, type, automod_status, automod_category, user_id, account_created_at, followed_at, time_to_action, shared_session, source_channel_id, messages_z, duration, tenant_id, sub_months, deleted, note, reason, channels, escalated_from, partial, region, bucket, no_latency_data, instance FROM hammertrack.mod_messages_by_channel_name
+  WHERE `+where+` LIMIT ?`+filtering, values...).
+			Idempotent(true).
+			WithContext(c.ctx).
+			Iter().
+			Scanner()
+		for scanner.Next() {
+			m := &Moderation{}
+			var z []byte
+			if err := scanner.Scan(&m.Channel, &m.Username, &m.At, &m.Messages, &m.Sub, &m.Toxicity, &m.Tags, &m.Type, &m.AutomodStatus, &m.AutomodCategory, &m.UserID, &m.AccountCreatedAt, &m.FollowedAt, &m.TimeToAction, &m.SharedSession, &m.SourceChannelID, &z, &m.Duration, &m.TenantID, &m.SubMonths, &m.Deleted, &m.Note, &m.Reason, &m.Channels, &m.EscalatedFrom, &m.Partial, &m.Region, &m.Bucket, &m.NoLatencyData, &m.Instance); err != nil {
+				return nil, errors.Wrap(err)
+			}
+			if err := decompress(m, z); err != nil {
+				return nil, err
+			}
+			all = append(all, m)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, errors.Wrap(err)
+		}
+	}
+	// the most recent of the ones found in every channel
+	sort.Slice(all, func(i, j int) bool { return all[i].At.After(all[j].At) })
+	if len(all) > limit {
+		all = all[:limit]
+	}
+	return all, nil
+}
+
+func (c *Cassandra) SetLinks(username string, ch Channel, at time.Time, resolved []*links.Link) error {
+	domains := make([]string, 0, len(resolved))
+	categories := make([]string, 0, len(resolved))
+	for _, l := range resolved {
+		domains = append(domains, l.Domain)
+		if l.Category != links.CategoryNone {
+			categories = append(categories, l.Category)
+		}
+	}
+	// the updates happen right after the insert, with the TTL of the row the
+	// cells outlive it by seconds at most rather than forever
+	ttl := c.ttl(string(ch))
+	if c.byUser {
+		if err := c.s.Query(`UPDATE hammertrack.mod_messages_by_user_name USING TTL ? SET link_domains=?, link_categories=?
+  WHERE user_name=? AND channel_name=? AND at=?`, ttl, domains, categories, username, string(ch), at).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	if c.byChannel {
+		if err := c.s.Query(`UPDATE hammertrack.mod_messages_by_channel_name USING TTL ? SET link_domains=?, link_categories=?
+  WHERE channel_name=? AND month=? AND at=?`, ttl, domains, categories, string(ch), at.Month(), at).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	return nil
+}
+
+func (c *Cassandra) SetAccountAge(username string, ch Channel, at time.Time, age *accounts.Age) error {
+	// see SetLinks
+	ttl := c.ttl(string(ch))
+	if c.byUser {
+		if err := c.s.Query(`UPDATE hammertrack.mod_messages_by_user_name USING TTL ? SET account_created_at=?, followed_at=?
+  WHERE user_name=? AND channel_name=? AND at=?`, ttl, age.CreatedAt, age.FollowedAt, username, string(ch), at).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	if c.byChannel {
+		if err := c.s.Query(`UPDATE hammertrack.mod_messages_by_channel_name USING TTL ? SET account_created_at=?, followed_at=?
+  WHERE channel_name=? AND month=? AND at=?`, ttl, age.CreatedAt, age.FollowedAt, string(ch), at.Month(), at).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// CompressMessages scans the table by channel, it is unsupported without it
+func (c *Cassandra) CompressMessages(ch Channel, from, to time.Time, dryRun bool, seal func(username string, msgs []string) ([]byte, error)) (int, error) {
+	if err := c.requireTable(TablesByChannel); err != nil {
+		return 0, err
+	}
+	months := make(map[time.Month]bool)
+	first := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, from.Location())
+	for m := first; !m.After(to) && len(months) < 12; m = m.AddDate(0, 1, 0) {
+		months[m.Month()] = true
+	}
+
+	n := 0
+	for month := range months {
+		scanner := c.s.Query(`SELECT user_name, at, messages, messages_z, TTL(messages) FROM hammertrack.mod_messages_by_channel_name
+  WHERE channel_name=? AND month=? AND at>=? AND at<=?`, string(ch), int(month), from, to).
+			WithContext(c.ctx).
+			Iter().
+			Scanner()
+		var (
+			username string
+			at       time.Time
+			msgs     []string
+			z        []byte
+			ttl      *int
+		)
+		for scanner.Next() {
+			if err := scanner.Scan(&username, &at, &msgs, &z, &ttl); err != nil {
+				return n, errors.Wrap(err)
+			}
+			if len(z) > 0 || len(msgs) == 0 {
+				continue
+			}
+			n++
+			if dryRun {
+				continue
+			}
+			// keep the remaining TTL of the row, otherwise the blob would outlive
+			// the rest of the row
+			remaining := 0
+			if ttl != nil {
+				remaining = *ttl
+			}
+			z, err := seal(username, msgs)
+			if err != nil {
+				return n, err
+			}
+			if err := c.s.Query(`UPDATE hammertrack.mod_messages_by_channel_name USING TTL ? SET messages_z=?, messages=null
+  WHERE channel_name=? AND month=? AND at=?`, remaining, z, string(ch), int(month), at).
+				WithContext(c.ctx).
+				Exec(); err != nil {
+				return n, errors.Wrap(err)
+			}
+			if c.byUser {
+				if err := c.s.Query(`UPDATE hammertrack.mod_messages_by_user_name USING TTL ? SET messages_z=?, messages=null
+  WHERE user_name=? AND channel_name=? AND at=?`, remaining, z, username, string(ch), at).
+					WithContext(c.ctx).
+					Exec(); err != nil {
+					return n, errors.Wrap(err)
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return n, errors.Wrap(err)
+		}
+	}
+	return n, nil
+}
+
+func (c *Cassandra) InsertSample(sample *sampling.Sample) error {
+	if err := c.s.Query(`INSERT INTO hammertrack.clean_samples (month, channel_name, at, id, body, length, sub)
+  VALUES (?, ?, ?, ?, ?, ?, ?) USING TTL ?`, sample.At.Month(), sample.Channel, sample.At, sample.ID, sample.Body, sample.Length, sample.Subscribed,
+		c.ttl(sample.Channel)).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+func (c *Cassandra) SaveEvasionClusters(clusters []*EvasionCluster) error {
+	for _, cl := range clusters {
+		if err := c.s.Query(`INSERT INTO hammertrack.evasion_clusters (channel_name, detected_at, id, usernames, reasons, window_from, window_to)
+  VALUES (?, ?, ?, ?, ?, ?, ?) USING TTL ?`, cl.Channel, cl.DetectedAt, cl.ID, cl.Usernames, cl.Reasons, cl.WindowFrom, cl.WindowTo, c.ttl(cl.Channel)).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	return nil
+}
+
+func (c *Cassandra) EvasionClusters(ch Channel, limit int) ([]*EvasionCluster, error) {
+	scanner := c.read(`SELECT detected_at, id, usernames, reasons, window_from, window_to FROM hammertrack.evasion_clusters
+  WHERE channel_name=? LIMIT ?`, string(ch), limit).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	all := make([]*EvasionCluster, 0, limit)
+	for scanner.Next() {
+		cl := &EvasionCluster{Channel: string(ch)}
+		if err := scanner.Scan(&cl.DetectedAt, &cl.ID, &cl.Usernames, &cl.Reasons, &cl.WindowFrom, &cl.WindowTo); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		all = append(all, cl)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return all, nil
+}
+
+func (c *Cassandra) HasModeration(username string, ch Channel, at time.Time) (bool, error) {
+	if !c.byUser {
+		// the row of the channel at that time may be of another user
+		var got string
+		if err := c.s.Query(`SELECT user_name FROM hammertrack.mod_messages_by_channel_name
+  WHERE channel_name=? AND month=? AND at=?`, string(ch), int(at.Month()), at).
+			WithContext(c.ctx).
+			Scan(&got); err != nil {
+			if errors.Is(err, gocql.ErrNotFound) {
+				return false, nil
+			}
+			return false, errors.Wrap(err)
+		}
+		return got == username, nil
+	}
+	var n int
+	if err := c.s.Query(`SELECT COUNT(*) FROM hammertrack.mod_messages_by_user_name
+  WHERE user_name=? AND channel_name=? AND at=?`, username, string(ch), at).
+		WithContext(c.ctx).
+		Scan(&n); err != nil {
+		return false, errors.Wrap(err)
+	}
+	return n > 0, nil
+}
+
+func (c *Cassandra) AddChannel(ch Channel) error {
+	return c.AddChannelToShard(ch, cfg.ShardID)
+}
+
+func (c *Cassandra) AddChannelToShard(ch Channel, shard int) error {
+	if err := c.s.Query(`INSERT INTO tracked_channels (shard_id, user_name) VALUES (?, ?)`, shard, string(ch)).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// ChannelShards filters the whole tracked_channels table, which is small (see
+// the migration)
+func (c *Cassandra) ChannelShards(ch Channel) ([]int, error) {
+	scanner := c.s.Query(`SELECT shard_id FROM tracked_channels WHERE user_name=? ALLOW FILTERING`, string(ch)).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var shards []int
+	for scanner.Next() {
+		var shard int
+		if err := scanner.Scan(&shard); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		shards = append(shards, shard)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return shards, nil
+}
+
+// RemoveChannel removes `ch` from every shard tracking it, not only from the
+// shard of this instance, as it may have been imported in another one
+func (c *Cassandra) RemoveChannel(ch Channel) error {
+	shards, err := c.ChannelShards(ch)
+	if err != nil {
+		return err
+	}
+	for _, shard := range shards {
+		if err := c.s.Query(`DELETE FROM tracked_channels WHERE shard_id=? AND user_name=?`, shard, string(ch)).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	return nil
+}
+
+func (c *Cassandra) Audit(e *AuditEntry) error {
+	if err := c.s.Query(`INSERT INTO hammertrack.audit_log (month, at, action, actor, target, details)
+  VALUES (?, ?, ?, ?, ?, ?)`, e.At.Month(), e.At, e.Action, e.Actor, e.Target, e.Details).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// NewCassandraStorage creates the driver of the session s. The reads of the API
+// use the session r, or s if it is nil
+func NewCassandraStorage(s, r *gocql.Session) Driver {
 	// Instead of taking a ctx we create a new one and expose Close() because
 	// some db drivers don't have contexts
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Cassandra{s: s, ctx: ctx, cancel: cancel}
+	policies, err := database.NewPolicies()
+	if err != nil {
+		errors.WrapFatal(err)
+	}
+	if r == nil {
+		r = s
+	}
+	byUser, byChannel, err := ParseModerationTables(cfg.ModerationTables)
+	if err != nil {
+		errors.WrapFatal(err)
+	}
+	if !byUser {
+		log.Print("moderations not written by user: user moderations, purges, blocklist tags and repairs are disabled")
+	}
+	if !byChannel {
+		log.Print("moderations not written by channel: channel timelines, shared bans, compressions and repairs are disabled")
+	}
+	c := &Cassandra{
+		s:         s,
+		r:         r,
+		ctx:       ctx,
+		cancel:    cancel,
+		policies:  policies,
+		byUser:    byUser,
+		byChannel: byChannel,
+		retention: make(map[string]int),
+		tenants:   make(map[string]string),
+	}
+	go c.refreshRetention()
+	go c.sweepRetention()
+	return c
 }
@@ -0,0 +1,43 @@
+package bot
+
+import (
+	"github.com/hammertrack/tracker/errors"
+)
+
+func (c *Cassandra) SetActiveBan(ban *ActiveBan) error {
+	if err := c.s.Query(`INSERT INTO hammertrack.active_bans (channel_name, user_name, user_id, at) VALUES (?, ?, ?, ?) USING TTL ?`,
+		ban.Channel, ban.Username, ban.UserID, ban.At, c.ttl(ban.Channel)).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+func (c *Cassandra) RemoveActiveBan(ch Channel, username string) error {
+	if err := c.s.Query(`DELETE FROM hammertrack.active_bans WHERE channel_name=? AND user_name=?`, string(ch), username).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+func (c *Cassandra) ActiveBans(ch Channel) ([]*ActiveBan, error) {
+	scanner := c.s.Query(`SELECT user_name, user_id, at FROM hammertrack.active_bans WHERE channel_name=?`, string(ch)).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var all []*ActiveBan
+	for scanner.Next() {
+		b := &ActiveBan{Channel: string(ch)}
+		if err := scanner.Scan(&b.Username, &b.UserID, &b.At); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		all = append(all, b)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return all, nil
+}
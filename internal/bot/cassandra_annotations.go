@@ -0,0 +1,35 @@
+package bot
+
+import (
+	"github.com/hammertrack/tracker/errors"
+)
+
+func (c *Cassandra) InsertAnnotation(a *Annotation) error {
+	if err := c.s.Query(`INSERT INTO hammertrack.annotations (channel_name, user_name, created_at, moderation_at, note, author) VALUES (?, ?, ?, ?, ?, ?)`,
+		a.Channel, a.Username, a.CreatedAt, a.ModerationAt, a.Note, a.Author).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+func (c *Cassandra) Annotations(username string, ch Channel) ([]*Annotation, error) {
+	scanner := c.read(`SELECT created_at, moderation_at, note, author FROM hammertrack.annotations WHERE channel_name=? AND user_name=?`, string(ch), username).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var all []*Annotation
+	for scanner.Next() {
+		a := &Annotation{Channel: string(ch), Username: username}
+		if err := scanner.Scan(&a.CreatedAt, &a.ModerationAt, &a.Note, &a.Author); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		all = append(all, a)
+	}
+	if err := scanner.Err(); err != nil {
+		storageErrors.Inc("annotations")
+		return nil, errors.Wrap(err)
+	}
+	return all, nil
+}
@@ -0,0 +1,55 @@
+package bot
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// insertHold indexes the row of a held message by its id. See
+// SetAutomodStatus
+func (c *Cassandra) insertHold(msg *message.Message, ttl int) error {
+	if err := c.s.Query(`INSERT INTO hammertrack.automod_holds (message_id, channel_name, user_name, at) VALUES (?, ?, ?, ?) USING TTL ?`,
+		msg.LastMessages[0].ID, msg.Channel, msg.Username, msg.At, ttl).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+func (c *Cassandra) SetAutomodStatus(messageID, status string) error {
+	var (
+		ch, username string
+		at           time.Time
+	)
+	if err := c.s.Query(`SELECT channel_name, user_name, at FROM hammertrack.automod_holds WHERE message_id=?`, messageID).
+		WithContext(c.ctx).
+		Scan(&ch, &username, &at); err != nil {
+		if errors.Is(err, gocql.ErrNotFound) {
+			return nil
+		}
+		return errors.Wrap(err)
+	}
+	ttl := c.ttl(ch)
+	if c.byUser {
+		if err := c.s.Query(`UPDATE hammertrack.mod_messages_by_user_name USING TTL ? SET automod_status=?
+  WHERE user_name=? AND channel_name=? AND at=?`, ttl, status, username, ch, at).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	if c.byChannel {
+		if err := c.s.Query(`UPDATE hammertrack.mod_messages_by_channel_name USING TTL ? SET automod_status=?
+  WHERE channel_name=? AND month=? AND at=?`, ttl, status, ch, at.Month(), at).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	return nil
+}
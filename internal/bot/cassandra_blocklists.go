@@ -0,0 +1,118 @@
+package bot
+
+import (
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func (c *Cassandra) Blocklist(list string) ([]string, error) {
+	scanner := c.s.Query(`SELECT user_name FROM hammertrack.blocklisted_users WHERE list=?`, list).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var users []string
+	for scanner.Next() {
+		var u string
+		if err := scanner.Scan(&u); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		users = append(users, u)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return users, nil
+}
+
+// SetBlocklist writes the users with `at` as the generation of the sync and then
+// deletes the users of the previous syncs, so the list is never read empty
+// while it is replaced, nor lost if the sync fails halfway
+func (c *Cassandra) SetBlocklist(list string, users []string, at time.Time) error {
+	for _, u := range users {
+		if err := c.s.Query(`INSERT INTO hammertrack.blocklisted_users (list, user_name, synced_at) VALUES (?, ?, ?)`, list, u, at).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	// timestamps are stored in milliseconds. A later sync running at the same
+	// time is never deleted
+	at = at.Truncate(time.Millisecond)
+	scanner := c.s.Query(`SELECT user_name, synced_at FROM hammertrack.blocklisted_users WHERE list=?`, list).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var (
+		u        string
+		syncedAt time.Time
+	)
+	for scanner.Next() {
+		if err := scanner.Scan(&u, &syncedAt); err != nil {
+			return errors.Wrap(err)
+		}
+		if !syncedAt.Before(at) {
+			continue
+		}
+		if err := c.s.Query(`DELETE FROM hammertrack.blocklisted_users WHERE list=? AND user_name=?`, list, u).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// TagBans locates the bans through the table by user. Without it only the bans
+// stored from now on are tagged, see Storage.tag
+func (c *Cassandra) TagBans(username, tag string) error {
+	if !c.byUser {
+		return nil
+	}
+	scanner := c.s.Query(`SELECT channel_name, at, type, TTL(sub) FROM hammertrack.mod_messages_by_user_name WHERE user_name=?`, username).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var (
+		ch  string
+		at  time.Time
+		typ string
+		ttl *int
+	)
+	for scanner.Next() {
+		if err := scanner.Scan(&ch, &at, &typ, &ttl); err != nil {
+			return errors.Wrap(err)
+		}
+		if typ != string(message.MessageBan) {
+			continue
+		}
+		// keep the remaining TTL of the row, otherwise the tag would outlive it
+		remaining := 0
+		if ttl != nil {
+			remaining = *ttl
+		}
+		tags := []string{tag}
+		if err := c.s.Query(`UPDATE hammertrack.mod_messages_by_user_name USING TTL ? SET tags=tags+? WHERE user_name=? AND channel_name=? AND at=?`,
+			remaining, tags, username, ch, at).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			return errors.Wrap(err)
+		}
+		if c.byChannel {
+			if err := c.s.Query(`UPDATE hammertrack.mod_messages_by_channel_name USING TTL ? SET tags=tags+? WHERE channel_name=? AND month=? AND at=?`,
+				remaining, tags, ch, int(at.Month()), at).
+				WithContext(c.ctx).
+				Exec(); err != nil {
+				return errors.Wrap(err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
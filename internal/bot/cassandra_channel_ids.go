@@ -0,0 +1,102 @@
+package bot
+
+import (
+	"github.com/gocql/gocql"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+// channelIDSeq is the row of channel_id_seq the ids of the channels are taken
+// from
+const channelIDSeq = "channels"
+
+func (c *Cassandra) ChannelIDs() (map[Channel]int64, error) {
+	scanner := c.s.Query(`SELECT channel_name, channel_id FROM hammertrack.channel_ids`).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	ids := make(map[Channel]int64)
+	for scanner.Next() {
+		var (
+			ch string
+			id int64
+		)
+		if err := scanner.Scan(&ch, &id); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		ids[Channel(ch)] = id
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return ids, nil
+}
+
+func (c *Cassandra) AssignChannelID(ch Channel) (int64, error) {
+	var id int64
+	err := c.s.Query(`SELECT channel_id FROM hammertrack.channel_ids WHERE channel_name = ?`, string(ch)).
+		WithContext(c.ctx).
+		Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, gocql.ErrNotFound) {
+		return 0, errors.Wrap(err)
+	}
+	if id, err = c.nextChannelID(); err != nil {
+		return 0, err
+	}
+
+	// another instance may have assigned an id to the channel meanwhile, its id
+	// wins and the one taken is left unused
+	existing := make(map[string]interface{})
+	applied, err := c.s.Query(`INSERT INTO hammertrack.channel_ids (channel_name, channel_id)
+  VALUES (?, ?) IF NOT EXISTS`, string(ch), id).
+		WithContext(c.ctx).
+		MapScanCAS(existing)
+	if err != nil {
+		storageErrors.Inc("assign_channel_id")
+		return 0, errors.Wrap(err)
+	}
+	if !applied {
+		return existing["channel_id"].(int64), nil
+	}
+	if err := c.s.Query(`INSERT INTO hammertrack.channels_by_id (channel_id, channel_name) VALUES (?, ?)`, id, string(ch)).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		storageErrors.Inc("assign_channel_id")
+		return 0, errors.Wrap(err)
+	}
+	return id, nil
+}
+
+// nextChannelID takes the next id of channel_id_seq, retrying while other
+// instances take ids concurrently
+func (c *Cassandra) nextChannelID() (int64, error) {
+	for {
+		var next int64
+		err := c.s.Query(`SELECT next_id FROM hammertrack.channel_id_seq WHERE name = ?`, channelIDSeq).
+			WithContext(c.ctx).
+			Scan(&next)
+		if errors.Is(err, gocql.ErrNotFound) {
+			if _, err := c.s.Query(`INSERT INTO hammertrack.channel_id_seq (name, next_id) VALUES (?, 1) IF NOT EXISTS`, channelIDSeq).
+				WithContext(c.ctx).
+				MapScanCAS(make(map[string]interface{})); err != nil {
+				return 0, errors.Wrap(err)
+			}
+			continue
+		}
+		if err != nil {
+			return 0, errors.Wrap(err)
+		}
+		applied, err := c.s.Query(`UPDATE hammertrack.channel_id_seq SET next_id = ? WHERE name = ? IF next_id = ?`, next+1, channelIDSeq, next).
+			WithContext(c.ctx).
+			MapScanCAS(make(map[string]interface{}))
+		if err != nil {
+			return 0, errors.Wrap(err)
+		}
+		if applied {
+			return next, nil
+		}
+	}
+}
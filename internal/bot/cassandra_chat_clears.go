@@ -0,0 +1,36 @@
+package bot
+
+import (
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+func (c *Cassandra) InsertChatClear(clear *ChatClear) error {
+	if err := c.s.Query(`INSERT INTO hammertrack.chat_clears (channel_name, at, moderator) VALUES (?, ?, ?) USING TTL ?`,
+		clear.Channel, clear.At, clear.Moderator, c.ttl(clear.Channel)).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+func (c *Cassandra) ChatClears(ch Channel, from, to time.Time) ([]*ChatClear, error) {
+	scanner := c.read(`SELECT at, moderator FROM hammertrack.chat_clears WHERE channel_name=? AND at>=? AND at<=?`, string(ch), from, to).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var all []*ChatClear
+	for scanner.Next() {
+		clear := &ChatClear{Channel: string(ch)}
+		if err := scanner.Scan(&clear.At, &clear.Moderator); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		all = append(all, clear)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return all, nil
+}
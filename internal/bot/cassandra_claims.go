@@ -0,0 +1,62 @@
+package bot
+
+import (
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+func (c *Cassandra) ClaimChannels(claims []*ChannelClaim, ttl time.Duration) error {
+	for _, claim := range claims {
+		if err := c.s.Query(`INSERT INTO hammertrack.channel_claims (channel_name, instance_id, started_at, heartbeat_at)
+  VALUES (?, ?, ?, ?) USING TTL ?`,
+			string(claim.Channel), claim.Instance, claim.StartedAt, claim.HeartbeatAt, int(ttl.Seconds())).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			storageErrors.Inc("claim_channels")
+			return errors.Wrap(err)
+		}
+	}
+	return nil
+}
+
+func (c *Cassandra) ChannelClaims(channels []Channel) ([]*ChannelClaim, error) {
+	names := make([]string, len(channels))
+	for i, ch := range channels {
+		names[i] = string(ch)
+	}
+	scanner := c.s.Query(`SELECT channel_name, instance_id, started_at, heartbeat_at
+  FROM hammertrack.channel_claims WHERE channel_name IN ?`, names).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var claims []*ChannelClaim
+	for scanner.Next() {
+		var (
+			ch    string
+			claim ChannelClaim
+		)
+		if err := scanner.Scan(&ch, &claim.Instance, &claim.StartedAt, &claim.HeartbeatAt); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		claim.Channel = Channel(ch)
+		claims = append(claims, &claim)
+	}
+	if err := scanner.Err(); err != nil {
+		storageErrors.Inc("channel_claims")
+		return nil, errors.Wrap(err)
+	}
+	return claims, nil
+}
+
+func (c *Cassandra) ReleaseChannels(instance string, channels []Channel) error {
+	for _, ch := range channels {
+		if err := c.s.Query(`DELETE FROM hammertrack.channel_claims WHERE channel_name = ? AND instance_id = ?`, string(ch), instance).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			storageErrors.Inc("release_channels")
+			return errors.Wrap(err)
+		}
+	}
+	return nil
+}
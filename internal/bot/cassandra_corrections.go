@@ -0,0 +1,47 @@
+package bot
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/hammertrack/tracker/errors"
+)
+
+func (c *Cassandra) CorrectModeration(username string, ch Channel, at time.Time, corr *Correction) error {
+	// keep the remaining TTL of the row, otherwise the correction would outlive
+	// it
+	var ttl *int
+	q := c.s.Query(`SELECT TTL(sub) FROM hammertrack.mod_messages_by_user_name WHERE user_name=? AND channel_name=? AND at=?`,
+		username, string(ch), at)
+	if !c.byUser {
+		q = c.s.Query(`SELECT TTL(sub) FROM hammertrack.mod_messages_by_channel_name WHERE channel_name=? AND month=? AND at=? AND user_name=? ALLOW FILTERING`,
+			string(ch), int(at.Month()), at, username)
+	}
+	if err := q.WithContext(c.ctx).Scan(&ttl); err != nil {
+		if errors.Is(err, gocql.ErrNotFound) {
+			return ErrModerationNotFound
+		}
+		return errors.Wrap(err)
+	}
+	remaining := 0
+	if ttl != nil {
+		remaining = *ttl
+	}
+	if c.byUser {
+		if err := c.s.Query(`UPDATE hammertrack.mod_messages_by_user_name USING TTL ? SET deleted=?, note=? WHERE user_name=? AND channel_name=? AND at=?`,
+			remaining, corr.Deleted, corr.Note, username, string(ch), at).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	if c.byChannel {
+		if err := c.s.Query(`UPDATE hammertrack.mod_messages_by_channel_name USING TTL ? SET deleted=?, note=? WHERE channel_name=? AND month=? AND at=?`,
+			remaining, corr.Deleted, corr.Note, string(ch), int(at.Month()), at).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	return nil
+}
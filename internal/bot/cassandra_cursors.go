@@ -0,0 +1,40 @@
+package bot
+
+import (
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+func (c *Cassandra) Cursors() (map[Channel]time.Time, error) {
+	scanner := c.s.Query(`SELECT channel_name, at FROM hammertrack.channel_cursors`).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	cursors := make(map[Channel]time.Time)
+	for scanner.Next() {
+		var (
+			ch string
+			at time.Time
+		)
+		if err := scanner.Scan(&ch, &at); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		cursors[Channel(ch)] = at
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return cursors, nil
+}
+
+func (c *Cassandra) SaveCursors(cursors map[Channel]time.Time) error {
+	for ch, at := range cursors {
+		if err := c.s.Query(`INSERT INTO hammertrack.channel_cursors (channel_name, at) VALUES (?, ?)`, string(ch), at).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	return nil
+}
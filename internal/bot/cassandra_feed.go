@@ -0,0 +1,105 @@
+package bot
+
+import (
+	"github.com/gocql/gocql"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+func (c *Cassandra) SetBanSharing(ch Channel, enabled bool) error {
+	if err := c.s.Query(`INSERT INTO hammertrack.ban_sharing (channel_name, enabled) VALUES (?, ?)`, string(ch), enabled).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+func (c *Cassandra) BanSharing(ch Channel) (bool, error) {
+	var enabled bool
+	if err := c.s.Query(`SELECT enabled FROM hammertrack.ban_sharing WHERE channel_name=?`, string(ch)).
+		WithContext(c.ctx).
+		Scan(&enabled); err != nil {
+		if errors.Is(err, gocql.ErrNotFound) {
+			return false, nil
+		}
+		return false, errors.Wrap(err)
+	}
+	return enabled, nil
+}
+
+func (c *Cassandra) CreateFeedSubscription(sub *FeedSubscription) error {
+	if err := c.s.Query(`INSERT INTO hammertrack.ban_feed_subscriptions (channel_name, id, tenant_id, url, secret, created_at)
+  VALUES (?, ?, ?, ?, ?, ?)`, sub.Channel, sub.ID, sub.TenantID, sub.URL, sub.Secret, sub.CreatedAt).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+func (c *Cassandra) FeedSubscription(ch Channel, id string) (*FeedSubscription, error) {
+	sub := &FeedSubscription{ID: id, Channel: string(ch)}
+	if err := c.s.Query(`SELECT tenant_id, url, secret, created_at FROM hammertrack.ban_feed_subscriptions
+  WHERE channel_name=? AND id=?`, string(ch), id).
+		WithContext(c.ctx).
+		Scan(&sub.TenantID, &sub.URL, &sub.Secret, &sub.CreatedAt); err != nil {
+		if errors.Is(err, gocql.ErrNotFound) {
+			return nil, ErrSubscriptionNotFound
+		}
+		return nil, errors.Wrap(err)
+	}
+	return sub, nil
+}
+
+func (c *Cassandra) DeleteFeedSubscription(ch Channel, id string) error {
+	if err := c.s.Query(`DELETE FROM hammertrack.ban_feed_subscriptions WHERE channel_name=? AND id=?`, string(ch), id).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// SharedFeeds reads both tables entirely, they are small
+func (c *Cassandra) SharedFeeds() (map[Channel][]*FeedSubscription, error) {
+	scanner := c.s.Query(`SELECT channel_name, enabled FROM hammertrack.ban_sharing`).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	sharing := make(map[Channel]bool)
+	var (
+		ch      string
+		enabled bool
+	)
+	for scanner.Next() {
+		if err := scanner.Scan(&ch, &enabled); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		if enabled {
+			sharing[Channel(ch)] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	scanner = c.s.Query(`SELECT channel_name, id, tenant_id, url, secret, created_at FROM hammertrack.ban_feed_subscriptions`).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	all := make(map[Channel][]*FeedSubscription, len(sharing))
+	for scanner.Next() {
+		sub := &FeedSubscription{}
+		if err := scanner.Scan(&sub.Channel, &sub.ID, &sub.TenantID, &sub.URL, &sub.Secret, &sub.CreatedAt); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		if sharing[Channel(sub.Channel)] {
+			all[Channel(sub.Channel)] = append(all[Channel(sub.Channel)], sub)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return all, nil
+}
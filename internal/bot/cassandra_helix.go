@@ -0,0 +1,44 @@
+package bot
+
+import (
+	"strings"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/helix"
+)
+
+func (c *Cassandra) HelixUsers(logins []string) ([]*helix.User, error) {
+	lower := make([]string, len(logins))
+	for i, login := range logins {
+		lower[i] = strings.ToLower(login)
+	}
+	scanner := c.s.Query(`SELECT login, id, display_name, created_at FROM hammertrack.helix_users WHERE login IN ?`, lower).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var users []*helix.User
+	for scanner.Next() {
+		u := &helix.User{}
+		if err := scanner.Scan(&u.Login, &u.ID, &u.DisplayName, &u.CreatedAt); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		users = append(users, u)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return users, nil
+}
+
+func (c *Cassandra) SaveHelixUsers(users []*helix.User) error {
+	for _, u := range users {
+		if err := c.s.Query(`INSERT INTO hammertrack.helix_users (login, id, display_name, created_at) VALUES (?, ?, ?, ?)`,
+			strings.ToLower(u.Login), u.ID, u.DisplayName, u.CreatedAt).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			storageErrors.Inc("save_helix_users")
+			return errors.Wrap(err)
+		}
+	}
+	return nil
+}
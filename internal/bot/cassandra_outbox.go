@@ -0,0 +1,54 @@
+package bot
+
+import (
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+// outboxBucket is the only partition of the outbox. The entries are removed
+// as soon as they are delivered, so it stays small
+const outboxBucket = 0
+
+func (c *Cassandra) AddOutbox(e *OutboxEntry) error {
+	if err := c.s.Query(`INSERT INTO hammertrack.outbox (bucket, at, id, payload) VALUES (?, ?, ?, ?)`,
+		outboxBucket, e.At, e.ID, e.Payload).
+		Consistency(c.policies.InsertConsistency).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		storageErrors.Inc("add_outbox")
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+func (c *Cassandra) PendingOutbox(before time.Time, limit int) ([]*OutboxEntry, error) {
+	scanner := c.s.Query(`SELECT at, id, payload FROM hammertrack.outbox WHERE bucket=? AND at<? LIMIT ?`,
+		outboxBucket, before, limit).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var entries []*OutboxEntry
+	for scanner.Next() {
+		e := &OutboxEntry{}
+		if err := scanner.Scan(&e.At, &e.ID, &e.Payload); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return entries, nil
+}
+
+func (c *Cassandra) RemoveOutbox(e *OutboxEntry) error {
+	if err := c.s.Query(`DELETE FROM hammertrack.outbox WHERE bucket=? AND at=? AND id=?`,
+		outboxBucket, e.At, e.ID).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		storageErrors.Inc("remove_outbox")
+		return errors.Wrap(err)
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package bot
+
+import (
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+func (c *Cassandra) PurgeUser(logins []string, dryRun bool) (*PurgeReport, error) {
+	report := &PurgeReport{
+		DryRun:   dryRun,
+		Rows:     make(map[string]int),
+		Channels: make([]string, 0),
+	}
+	seen := make(map[string]struct{})
+	for _, login := range logins {
+		channels, err := c.purgeModerations(login, report, dryRun)
+		if err != nil {
+			return nil, err
+		}
+		for _, ch := range channels {
+			if _, ok := seen[ch]; !ok {
+				seen[ch] = struct{}{}
+				report.Channels = append(report.Channels, ch)
+			}
+		}
+		if err := c.purgeActiveBans(login, report, dryRun); err != nil {
+			return nil, err
+		}
+		if err := c.purgeEvasionClusters(login, report, dryRun); err != nil {
+			return nil, err
+		}
+		if err := c.purgeHolds(login, report, dryRun); err != nil {
+			return nil, err
+		}
+	}
+	// the logins are deleted last, they are how the aliases of the user are found
+	if err := c.purgeLogins(logins, report, dryRun); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// purgeModerations deletes the moderations of the login and returns their
+// channels
+func (c *Cassandra) purgeModerations(login string, report *PurgeReport, dryRun bool) ([]string, error) {
+	type key struct {
+		channel string
+		at      time.Time
+	}
+
+	// by_user_name is always written first, so every row in by_channel_name has
+	// its counterpart here and we can use it to locate them. Without it the rows
+	// of a user can't be found
+	if err := c.requireTable(TablesByUser); err != nil {
+		return nil, err
+	}
+	scanner := c.s.Query(`SELECT channel_name, at FROM hammertrack.mod_messages_by_user_name WHERE user_name=?`, login).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var (
+		keys     = make([]key, 0, 20)
+		seen     = make(map[string]struct{})
+		channels []string
+		k        key
+	)
+	for scanner.Next() {
+		if err := scanner.Scan(&k.channel, &k.at); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		keys = append(keys, k)
+		if _, ok := seen[k.channel]; !ok {
+			seen[k.channel] = struct{}{}
+			channels = append(channels, k.channel)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	report.Rows["mod_messages_by_user_name"] += len(keys)
+	if c.byChannel {
+		report.Rows["mod_messages_by_channel_name"] += len(keys)
+	}
+	if dryRun {
+		return channels, nil
+	}
+
+	// Caveat: by_channel_name rows are identified by their timestamp only, two
+	// moderations in the same channel at the exact same millisecond would
+	// collide, which is unlikely enough to ignore
+	if c.byChannel {
+		for _, k := range keys {
+			if err := c.s.Query(`DELETE FROM hammertrack.mod_messages_by_channel_name WHERE channel_name=? AND month=? AND at=?`,
+				k.channel, k.at.Month(), k.at).
+				WithContext(c.ctx).
+				Exec(); err != nil {
+				return nil, errors.WrapWithContext(err, k)
+			}
+		}
+	}
+	if err := c.s.Query(`DELETE FROM hammertrack.mod_messages_by_user_name WHERE user_name=?`, login).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return channels, nil
+}
+
+// purgeActiveBans deletes the active bans of the login. Active bans are
+// partitioned by channel, and a ban is active whether its moderation was stored
+// or not, so every partition is filtered. Purges are rare enough to afford it
+func (c *Cassandra) purgeActiveBans(login string, report *PurgeReport, dryRun bool) error {
+	scanner := c.s.Query(`SELECT channel_name FROM hammertrack.active_bans WHERE user_name=? ALLOW FILTERING`, login).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var (
+		channels []string
+		ch       string
+	)
+	for scanner.Next() {
+		if err := scanner.Scan(&ch); err != nil {
+			return errors.Wrap(err)
+		}
+		channels = append(channels, ch)
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err)
+	}
+	report.Rows["active_bans"] += len(channels)
+	if dryRun {
+		return nil
+	}
+	for _, ch := range channels {
+		if err := c.RemoveActiveBan(Channel(ch), login); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeHolds deletes the index of the messages of the login held by AutoMod.
+// The table is keyed by message, so it is filtered like the active bans
+func (c *Cassandra) purgeHolds(login string, report *PurgeReport, dryRun bool) error {
+	scanner := c.s.Query(`SELECT message_id FROM hammertrack.automod_holds WHERE user_name=? ALLOW FILTERING`, login).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var (
+		ids []string
+		id  string
+	)
+	for scanner.Next() {
+		if err := scanner.Scan(&id); err != nil {
+			return errors.Wrap(err)
+		}
+		ids = append(ids, id)
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err)
+	}
+	report.Rows["automod_holds"] += len(ids)
+	if dryRun {
+		return nil
+	}
+	for _, id := range ids {
+		if err := c.s.Query(`DELETE FROM hammertrack.automod_holds WHERE message_id=?`, id).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// purgeEvasionClusters removes the login from the clusters it is part of
+func (c *Cassandra) purgeEvasionClusters(login string, report *PurgeReport, dryRun bool) error {
+	type key struct {
+		channel    string
+		detectedAt time.Time
+		id         int
+	}
+	scanner := c.s.Query(`SELECT channel_name, detected_at, id FROM hammertrack.evasion_clusters WHERE usernames CONTAINS ? ALLOW FILTERING`, login).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var (
+		keys []key
+		k    key
+	)
+	for scanner.Next() {
+		if err := scanner.Scan(&k.channel, &k.detectedAt, &k.id); err != nil {
+			return errors.Wrap(err)
+		}
+		keys = append(keys, k)
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err)
+	}
+	report.Rows["evasion_clusters"] += len(keys)
+	if dryRun {
+		return nil
+	}
+	for _, k := range keys {
+		if err := c.s.Query(`UPDATE hammertrack.evasion_clusters SET usernames = usernames - ? WHERE channel_name=? AND detected_at=? AND id=?`,
+			[]string{login}, k.channel, k.detectedAt, k.id).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			return errors.WrapWithContext(err, k)
+		}
+	}
+	return nil
+}
+
+// purgeLogins deletes the user ids of the logins along with every login and
+// rename recorded for them
+func (c *Cassandra) purgeLogins(logins []string, report *PurgeReport, dryRun bool) error {
+	ids := make(map[string]struct{})
+	all := make(map[string]struct{})
+	for _, login := range logins {
+		all[login] = struct{}{}
+		userIDs, err := c.UserIDsOf(login)
+		if err != nil {
+			return err
+		}
+		for _, id := range userIDs {
+			ids[id] = struct{}{}
+		}
+	}
+	for id := range ids {
+		idLogins, err := c.LoginsOf(id)
+		if err != nil {
+			return err
+		}
+		report.Rows["user_logins"] += len(idLogins)
+		for _, login := range idLogins {
+			all[login] = struct{}{}
+		}
+		var renames int
+		if err := c.s.Query(`SELECT COUNT(*) FROM hammertrack.renames WHERE user_id=?`, id).
+			WithContext(c.ctx).
+			Scan(&renames); err != nil {
+			return errors.Wrap(err)
+		}
+		report.Rows["renames"] += renames
+	}
+	// a login may be recycled by another user, whose rows are kept
+	for login := range all {
+		userIDs, err := c.UserIDsOf(login)
+		if err != nil {
+			return err
+		}
+		for _, id := range userIDs {
+			if _, ok := ids[id]; ok {
+				report.Rows["login_user_ids"]++
+			}
+		}
+	}
+	if dryRun {
+		return nil
+	}
+	for id := range ids {
+		if err := c.s.Query(`DELETE FROM hammertrack.user_logins WHERE user_id=?`, id).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			return errors.Wrap(err)
+		}
+		if err := c.s.Query(`DELETE FROM hammertrack.renames WHERE user_id=?`, id).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	for login := range all {
+		for id := range ids {
+			if err := c.s.Query(`DELETE FROM hammertrack.login_user_ids WHERE login=? AND user_id=?`, login, id).
+				WithContext(c.ctx).
+				Exec(); err != nil {
+				return errors.Wrap(err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package bot
+
+import (
+	"sort"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+// seeLogin records that the user id had the login at `at`
+func (c *Cassandra) seeLogin(userID, login string, at time.Time) error {
+	if err := c.s.Query(`INSERT INTO hammertrack.user_logins (user_id, login, seen_at) VALUES (?, ?, ?)`, userID, login, at).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	if err := c.s.Query(`INSERT INTO hammertrack.login_user_ids (login, user_id) VALUES (?, ?)`, login, userID).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+type seenLogin struct {
+	login  string
+	seenAt time.Time
+}
+
+// sortLogins returns the logins, the most recently seen first
+func sortLogins(seen []seenLogin) []string {
+	sort.Slice(seen, func(i, j int) bool {
+		return seen[i].seenAt.After(seen[j].seenAt)
+	})
+	logins := make([]string, len(seen))
+	for i, s := range seen {
+		logins[i] = s.login
+	}
+	return logins
+}
+
+func (c *Cassandra) UserLogins(fn func(userID string, logins []string) error) error {
+	// rows of the same partition are consecutive
+	scanner := c.s.Query(`SELECT user_id, login, seen_at FROM hammertrack.user_logins`).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var (
+		current string
+		seen    []seenLogin
+	)
+	for scanner.Next() {
+		var (
+			id string
+			s  seenLogin
+		)
+		if err := scanner.Scan(&id, &s.login, &s.seenAt); err != nil {
+			return errors.Wrap(err)
+		}
+		if id != current && len(seen) > 0 {
+			if err := fn(current, sortLogins(seen)); err != nil {
+				return err
+			}
+			seen = seen[:0]
+		}
+		current = id
+		seen = append(seen, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err)
+	}
+	if len(seen) > 0 {
+		return fn(current, sortLogins(seen))
+	}
+	return nil
+}
+
+func (c *Cassandra) LoginsOf(userID string) ([]string, error) {
+	scanner := c.s.Query(`SELECT login, seen_at FROM hammertrack.user_logins WHERE user_id=?`, userID).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var seen []seenLogin
+	for scanner.Next() {
+		var s seenLogin
+		if err := scanner.Scan(&s.login, &s.seenAt); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		seen = append(seen, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return sortLogins(seen), nil
+}
+
+func (c *Cassandra) UserIDsOf(login string) ([]string, error) {
+	scanner := c.s.Query(`SELECT user_id FROM hammertrack.login_user_ids WHERE login=?`, login).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var (
+		all []string
+		id  string
+	)
+	for scanner.Next() {
+		if err := scanner.Scan(&id); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		all = append(all, id)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return all, nil
+}
+
+func (c *Cassandra) RecordRename(r *Rename) error {
+	if err := c.s.Query(`INSERT INTO hammertrack.renames (user_id, observed_at, old_login, new_login) VALUES (?, ?, ?, ?)`,
+		r.UserID, r.ObservedAt, r.OldLogin, r.NewLogin).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return c.seeLogin(r.UserID, r.NewLogin, r.ObservedAt)
+}
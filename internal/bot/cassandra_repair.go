@@ -0,0 +1,184 @@
+package bot
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gocql/gocql"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+// Repair needs both tables, with a single one there is nothing to repair
+func (c *Cassandra) Repair(ch Channel, from, to time.Time, dryRun bool) (*RepairReport, error) {
+	if err := c.requireTable(TablesByUser); err != nil {
+		return nil, err
+	}
+	if err := c.requireTable(TablesByChannel); err != nil {
+		return nil, err
+	}
+	report := &RepairReport{Channel: string(ch), DryRun: dryRun}
+	if err := c.repairByUser(ch, from, to, report); err != nil {
+		return report, err
+	}
+	if err := c.repairByChannel(ch, from, to, report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// repairByUser copies to mod_messages_by_user_name the rows of the channel only
+// present in mod_messages_by_channel_name
+func (c *Cassandra) repairByUser(ch Channel, from, to time.Time, report *RepairReport) error {
+	months := make(map[time.Month]bool)
+	first := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, from.Location())
+	for m := first; !m.After(to) && len(months) < 12; m = m.AddDate(0, 1, 0) {
+		months[m.Month()] = true
+	}
+	for month := range months {
+		scanner := c.s.Query(`SELECT user_name, at, TTL(sub) FROM hammertrack.mod_messages_by_channel_name
+  WHERE channel_name=? AND month=? AND at>=? AND at<=?`, string(ch), int(month), from, to).
+			WithContext(c.ctx).
+			Iter().
+			Scanner()
+		var (
+			username string
+			at       time.Time
+			ttl      *int
+		)
+		for scanner.Next() {
+			if err := scanner.Scan(&username, &at, &ttl); err != nil {
+				return errors.Wrap(err)
+			}
+			report.Scanned++
+			exists, err := c.exists(c.s.Query(`SELECT at FROM hammertrack.mod_messages_by_user_name WHERE user_name=? AND channel_name=? AND at=?`,
+				username, string(ch), at))
+			if err != nil {
+				return err
+			}
+			if exists {
+				continue
+			}
+			report.MissingByUser++
+			if report.DryRun {
+				continue
+			}
+			if err := c.copyRow(c.s.Query(`SELECT JSON * FROM hammertrack.mod_messages_by_channel_name WHERE channel_name=? AND month=? AND at=?`,
+				string(ch), int(month), at), "mod_messages_by_user_name", ttl, byUserRow); err != nil {
+				return err
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// repairByChannel copies to mod_messages_by_channel_name the rows of the
+// channel only present in mod_messages_by_user_name
+func (c *Cassandra) repairByChannel(ch Channel, from, to time.Time, report *RepairReport) error {
+	// a maintenance scan of every partition, like the rest of the jobs over the
+	// users of a channel
+	scanner := c.s.Query(`SELECT user_name, at, TTL(sub) FROM hammertrack.mod_messages_by_user_name
+  WHERE channel_name=? AND at>=? AND at<=? ALLOW FILTERING`, string(ch), from, to).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var (
+		username string
+		at       time.Time
+		ttl      *int
+	)
+	for scanner.Next() {
+		if err := scanner.Scan(&username, &at, &ttl); err != nil {
+			return errors.Wrap(err)
+		}
+		report.Scanned++
+		exists, err := c.exists(c.s.Query(`SELECT at FROM hammertrack.mod_messages_by_channel_name WHERE channel_name=? AND month=? AND at=?`,
+			string(ch), int(at.Month()), at))
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		report.MissingByChannel++
+		if report.DryRun {
+			continue
+		}
+		month := int(at.Month())
+		if err := c.copyRow(c.s.Query(`SELECT JSON * FROM hammertrack.mod_messages_by_user_name WHERE user_name=? AND channel_name=? AND at=?`,
+			username, string(ch), at), "mod_messages_by_channel_name", ttl, func(row map[string]json.RawMessage) {
+			byChannelRow(row, month)
+		}); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// byUserRow adapts a row of mod_messages_by_channel_name to
+// mod_messages_by_user_name, which has neither the month nor the search_text
+func byUserRow(row map[string]json.RawMessage) {
+	delete(row, "month")
+	delete(row, "search_text")
+}
+
+// byChannelRow adapts a row of mod_messages_by_user_name to
+// mod_messages_by_channel_name, with the search_text Save would have written
+// so the repaired row can be found by /search. Compressed rows have no
+// messages in clear and so no search_text
+func byChannelRow(row map[string]json.RawMessage, month int) {
+	row["month"], _ = json.Marshal(month)
+	var msgs []string
+	if err := json.Unmarshal(row["messages"], &msgs); err != nil {
+		msgs = nil
+	}
+	if text := searchText(msgs); text != "" {
+		row["search_text"], _ = json.Marshal(text)
+	}
+}
+
+// exists reports whether the query returns any row
+func (c *Cassandra) exists(q *gocql.Query) (bool, error) {
+	var at time.Time
+	if err := q.WithContext(c.ctx).Scan(&at); err != nil {
+		if errors.Is(err, gocql.ErrNotFound) {
+			return false, nil
+		}
+		return false, errors.Wrap(err)
+	}
+	return true, nil
+}
+
+// copyRow inserts the row returned by the JSON query `q` into `table`, with the
+// remaining TTL of the row. fix adapts the columns of the row to the table
+func (c *Cassandra) copyRow(q *gocql.Query, table string, ttl *int, fix func(row map[string]json.RawMessage)) error {
+	var raw string
+	if err := q.WithContext(c.ctx).Scan(&raw); err != nil {
+		return errors.Wrap(err)
+	}
+	row := make(map[string]json.RawMessage)
+	if err := json.Unmarshal([]byte(raw), &row); err != nil {
+		return errors.Wrap(err)
+	}
+	fix(row)
+	b, err := json.Marshal(row)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	remaining := 0
+	if ttl != nil {
+		remaining = *ttl
+	}
+	if err := c.s.Query(`INSERT INTO hammertrack.`+table+` JSON ? USING TTL ?`, string(b), remaining).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
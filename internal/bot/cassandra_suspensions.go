@@ -0,0 +1,50 @@
+package bot
+
+import (
+	"github.com/hammertrack/tracker/errors"
+)
+
+func (c *Cassandra) SuspendChannel(s *ChannelSuspension) error {
+	if err := c.s.Query(`INSERT INTO hammertrack.channel_suspensions (channel_name, reason, suspended_at) VALUES (?, ?, ?)`,
+		string(s.Channel), s.Reason, s.SuspendedAt).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		storageErrors.Inc("suspend_channel")
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+func (c *Cassandra) ResumeChannel(ch Channel) error {
+	if err := c.s.Query(`DELETE FROM hammertrack.channel_suspensions WHERE channel_name = ?`, string(ch)).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		storageErrors.Inc("resume_channel")
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+func (c *Cassandra) ChannelSuspensions() ([]*ChannelSuspension, error) {
+	scanner := c.s.Query(`SELECT channel_name, reason, suspended_at FROM hammertrack.channel_suspensions`).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var all []*ChannelSuspension
+	for scanner.Next() {
+		var (
+			ch  string
+			sus ChannelSuspension
+		)
+		if err := scanner.Scan(&ch, &sus.Reason, &sus.SuspendedAt); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		sus.Channel = Channel(ch)
+		all = append(all, &sus)
+	}
+	if err := scanner.Err(); err != nil {
+		storageErrors.Inc("channel_suspensions")
+		return nil, errors.Wrap(err)
+	}
+	return all, nil
+}
@@ -0,0 +1,404 @@
+package bot
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+const (
+	// RetentionRefresh is the interval at which the retention policies of the
+	// tenants are reloaded
+	RetentionRefresh = 10 * time.Minute
+	// RetentionSweep is the interval at which the rows older than the retention
+	// of their tenant are deleted. New rows expire with their TTL, the sweep is
+	// for the rows stored before the tenant had a retention policy or before it
+	// was shortened
+	RetentionSweep = 24 * time.Hour
+)
+
+func (c *Cassandra) CreateTenant(t *Tenant) error {
+	applied, err := c.s.Query(`INSERT INTO hammertrack.tenants (id, name, retention_days, created_at)
+  VALUES (?, ?, ?, ?) IF NOT EXISTS`, t.ID, t.Name, t.RetentionDays, t.CreatedAt).
+		WithContext(c.ctx).
+		MapScanCAS(make(map[string]interface{}))
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if !applied {
+		return ErrTenantExists
+	}
+	return nil
+}
+
+func (c *Cassandra) Tenant(id string) (*Tenant, error) {
+	t := &Tenant{ID: id}
+	if err := c.s.Query(`SELECT name, retention_days, created_at FROM hammertrack.tenants WHERE id=?`, id).
+		WithContext(c.ctx).
+		Scan(&t.Name, &t.RetentionDays, &t.CreatedAt); err != nil {
+		if errors.Is(err, gocql.ErrNotFound) {
+			return nil, ErrTenantNotFound
+		}
+		return nil, errors.Wrap(err)
+	}
+	return t, nil
+}
+
+func (c *Cassandra) Tenants() ([]*Tenant, error) {
+	scanner := c.s.Query(`SELECT id, name, retention_days, created_at FROM hammertrack.tenants`).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var all []*Tenant
+	for scanner.Next() {
+		t := &Tenant{}
+		if err := scanner.Scan(&t.ID, &t.Name, &t.RetentionDays, &t.CreatedAt); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		all = append(all, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return all, nil
+}
+
+func (c *Cassandra) AddTenantChannel(tenantID string, ch Channel) error {
+	existing := make(map[string]interface{})
+	applied, err := c.s.Query(`INSERT INTO hammertrack.channel_tenants (channel_name, tenant_id)
+  VALUES (?, ?) IF NOT EXISTS`, string(ch), tenantID).
+		WithContext(c.ctx).
+		MapScanCAS(existing)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if !applied && existing["tenant_id"] != tenantID {
+		return ErrChannelOwned
+	}
+	if err := c.s.Query(`INSERT INTO hammertrack.tenant_channels (tenant_id, channel_name) VALUES (?, ?)`, tenantID, string(ch)).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+func (c *Cassandra) RemoveTenantChannel(tenantID string, ch Channel) error {
+	if _, err := c.s.Query(`DELETE FROM hammertrack.channel_tenants WHERE channel_name=? IF tenant_id=?`, string(ch), tenantID).
+		WithContext(c.ctx).
+		MapScanCAS(make(map[string]interface{})); err != nil {
+		return errors.Wrap(err)
+	}
+	if err := c.s.Query(`DELETE FROM hammertrack.tenant_channels WHERE tenant_id=? AND channel_name=?`, tenantID, string(ch)).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+func (c *Cassandra) TenantChannels(tenantID string) ([]Channel, error) {
+	scanner := c.s.Query(`SELECT channel_name FROM hammertrack.tenant_channels WHERE tenant_id=?`, tenantID).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var (
+		all []Channel
+		ch  string
+	)
+	for scanner.Next() {
+		if err := scanner.Scan(&ch); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		all = append(all, Channel(ch))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return all, nil
+}
+
+func (c *Cassandra) CreateAPIKey(k *APIKey) error {
+	chs := make([]string, len(k.Channels))
+	for i, ch := range k.Channels {
+		chs[i] = string(ch)
+	}
+	if err := c.s.Query(`INSERT INTO hammertrack.api_keys (id, tenant_id, name, hash, role, channels, created_at)
+  VALUES (?, ?, ?, ?, ?, ?, ?)`, k.ID, k.TenantID, k.Name, k.Hash, string(k.Role), chs, k.CreatedAt).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+func (c *Cassandra) APIKey(id string) (*APIKey, error) {
+	var (
+		k    = &APIKey{ID: id}
+		role string
+		chs  []string
+	)
+	if err := c.s.Query(`SELECT tenant_id, name, hash, role, channels, created_at FROM hammertrack.api_keys WHERE id=?`, id).
+		WithContext(c.ctx).
+		Scan(&k.TenantID, &k.Name, &k.Hash, &role, &chs, &k.CreatedAt); err != nil {
+		if errors.Is(err, gocql.ErrNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, errors.Wrap(err)
+	}
+	k.Role = Role(role)
+	for _, ch := range chs {
+		k.Channels = append(k.Channels, Channel(ch))
+	}
+	return k, nil
+}
+
+func (c *Cassandra) CreateTenantWebhook(h *TenantWebhook) error {
+	if err := c.s.Query(`INSERT INTO hammertrack.tenant_webhooks (tenant_id, id, url, secret, created_at)
+  VALUES (?, ?, ?, ?, ?)`, h.TenantID, h.ID, h.URL, h.Secret, h.CreatedAt).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+func (c *Cassandra) DeleteTenantWebhook(tenantID, id string) error {
+	if err := c.s.Query(`DELETE FROM hammertrack.tenant_webhooks WHERE tenant_id=? AND id=?`, tenantID, id).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+func (c *Cassandra) TenantWebhooks(tenantID string) ([]*TenantWebhook, error) {
+	scanner := c.s.Query(`SELECT id, url, secret, created_at FROM hammertrack.tenant_webhooks WHERE tenant_id=?`, tenantID).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var all []*TenantWebhook
+	for scanner.Next() {
+		h := &TenantWebhook{TenantID: tenantID}
+		if err := scanner.Scan(&h.ID, &h.URL, &h.Secret, &h.CreatedAt); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		all = append(all, h)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return all, nil
+}
+
+func (c *Cassandra) ChannelWebhooks() (map[Channel][]*TenantWebhook, error) {
+	scanner := c.s.Query(`SELECT tenant_id, id, url, secret, created_at FROM hammertrack.tenant_webhooks`).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	byTenant := make(map[string][]*TenantWebhook)
+	for scanner.Next() {
+		h := &TenantWebhook{}
+		if err := scanner.Scan(&h.TenantID, &h.ID, &h.URL, &h.Secret, &h.CreatedAt); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		byTenant[h.TenantID] = append(byTenant[h.TenantID], h)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	all := make(map[Channel][]*TenantWebhook)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for ch, tenantID := range c.tenants {
+		if hooks := byTenant[tenantID]; len(hooks) > 0 {
+			all[Channel(ch)] = hooks
+		}
+	}
+	return all, nil
+}
+
+func (c *Cassandra) RevokeAPIKey(id string) error {
+	if err := c.s.Query(`DELETE FROM hammertrack.api_keys WHERE id=?`, id).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// ttl returns the TTL in seconds of the moderations of the channel, 0 if they
+// never expire
+func (c *Cassandra) ttl(ch string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.retention[ch]
+}
+
+// tenantOf returns the tenant of the channel, empty if none
+func (c *Cassandra) tenantOf(ch string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tenants[ch]
+}
+
+// loadRetention loads the tenant of every channel that belongs to one, and its
+// retention if the tenant has a retention policy
+func (c *Cassandra) loadRetention() error {
+	all, err := c.Tenants()
+	if err != nil {
+		return err
+	}
+	days := make(map[string]int, len(all))
+	for _, t := range all {
+		days[t.ID] = t.RetentionDays
+	}
+
+	scanner := c.s.Query(`SELECT channel_name, tenant_id FROM hammertrack.channel_tenants`).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	retention := make(map[string]int)
+	tenants := make(map[string]string)
+	var ch, tenantID string
+	for scanner.Next() {
+		if err := scanner.Scan(&ch, &tenantID); err != nil {
+			return errors.Wrap(err)
+		}
+		tenants[ch] = tenantID
+		if d := days[tenantID]; d > 0 {
+			retention[ch] = int((time.Duration(d) * 24 * time.Hour).Seconds())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err)
+	}
+
+	c.mu.Lock()
+	c.retention = retention
+	c.tenants = tenants
+	c.mu.Unlock()
+	return nil
+}
+
+// refreshRetention reloads the retention policies periodically until the
+// driver is closed
+func (c *Cassandra) refreshRetention() {
+	t := time.NewTicker(RetentionRefresh)
+	defer t.Stop()
+	for {
+		if err := c.loadRetention(); err != nil {
+			errors.WrapAndLog(err)
+		}
+		select {
+		case <-t.C:
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// sweepRetention deletes the rows older than the retention of the channels of
+// this shard periodically until the driver is closed. The first sweep waits
+// for the retention policies to be loaded
+func (c *Cassandra) sweepRetention() {
+	t := time.NewTicker(RetentionSweep)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-c.ctx.Done():
+			return
+		}
+		chs, err := c.Channels()
+		if err != nil {
+			errors.WrapAndLog(err)
+			continue
+		}
+		for _, ch := range chs {
+			ttl := c.ttl(string(ch))
+			if ttl == 0 {
+				continue
+			}
+			if err := c.expire(ch, time.Now().Add(-time.Duration(ttl)*time.Second)); err != nil {
+				errors.WrapAndLogWithContext(err, struct{ Channel Channel }{ch})
+			}
+		}
+	}
+}
+
+// expireByUser deletes the moderations by user of the channel in the month
+// older than `before`
+func (c *Cassandra) expireByUser(ch Channel, month time.Month, before time.Time) error {
+	scanner := c.s.Query(`SELECT user_name, at FROM hammertrack.mod_messages_by_channel_name
+  WHERE channel_name=? AND month=? AND at<?`, string(ch), int(month), before).
+		WithContext(c.ctx).
+		Iter().
+		Scanner()
+	var (
+		username string
+		at       time.Time
+	)
+	for scanner.Next() {
+		if err := scanner.Scan(&username, &at); err != nil {
+			return errors.Wrap(err)
+		}
+		if err := c.s.Query(`DELETE FROM hammertrack.mod_messages_by_user_name WHERE user_name=? AND channel_name=? AND at=?`,
+			username, string(ch), at).
+			WithContext(c.ctx).
+			Exec(); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// expire deletes the moderations, clean samples, active bans and evasion
+// clusters of the channel older than `before`
+func (c *Cassandra) expire(ch Channel, before time.Time) error {
+	for month := time.January; month <= time.December; month++ {
+		// the rows by user are located through the rows by channel. Written
+		// alone, they only expire with the TTL they were inserted with
+		if c.byUser && c.byChannel {
+			if err := c.expireByUser(ch, month, before); err != nil {
+				return err
+			}
+		}
+		for _, table := range []string{"mod_messages_by_channel_name", "clean_samples"} {
+			if err := c.s.Query(`DELETE FROM hammertrack.`+table+` WHERE channel_name=? AND month=? AND at<?`, string(ch), int(month), before).
+				WithContext(c.ctx).
+				Exec(); err != nil {
+				return errors.Wrap(err)
+			}
+		}
+	}
+	if err := c.s.Query(`DELETE FROM hammertrack.evasion_clusters WHERE channel_name=? AND detected_at<?`, string(ch), before).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	if err := c.s.Query(`DELETE FROM hammertrack.chat_clears WHERE channel_name=? AND at<?`, string(ch), before).
+		WithContext(c.ctx).
+		Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+
+	bans, err := c.ActiveBans(ch)
+	if err != nil {
+		return err
+	}
+	for _, b := range bans {
+		if b.At.Before(before) {
+			if err := c.RemoveActiveBan(ch, b.Username); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
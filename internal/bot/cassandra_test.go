@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+func TestParseModerationTables(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		tables    string
+		byUser    bool
+		byChannel bool
+		err       error
+	}{
+		{tables: "both", byUser: true, byChannel: true},
+		{tables: "by_user", byUser: true},
+		{tables: " BY_CHANNEL ", byChannel: true},
+		{tables: "", err: ErrModerationTables},
+		{tables: "by_month", err: ErrModerationTables},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.tables, func(t *testing.T) {
+			t.Parallel()
+			byUser, byChannel, err := ParseModerationTables(tt.tables)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got: %v, want: %v", err, tt.err)
+			}
+			if byUser != tt.byUser || byChannel != tt.byChannel {
+				t.Errorf("got: %v %v, want: %v %v", byUser, byChannel, tt.byUser, tt.byChannel)
+			}
+		})
+	}
+}
+
+func TestRequireTable(t *testing.T) {
+	t.Parallel()
+	c := &Cassandra{byChannel: true}
+	if err := c.requireTable(TablesByChannel); err != nil {
+		t.Errorf("got: %v, want: %v", err, nil)
+	}
+	if err := c.requireTable(TablesByUser); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("got: %v, want: %v", err, ErrUnsupported)
+	}
+}
+
+func TestRepairRows(t *testing.T) {
+	t.Parallel()
+	// a row of mod_messages_by_channel_name copied to by_user_name, which has no
+	// search_text column
+	byChannel := map[string]json.RawMessage{
+		"month":       json.RawMessage(`11`),
+		"user_name":   json.RawMessage(`"bar"`),
+		"messages":    json.RawMessage(`["Hello","World"]`),
+		"search_text": json.RawMessage(`"hello\nworld"`),
+	}
+	byUserRow(byChannel)
+	if _, ok := byChannel["month"]; ok {
+		t.Errorf("got: %v, want: no month", byChannel)
+	}
+	if _, ok := byChannel["search_text"]; ok {
+		t.Errorf("got: %v, want: no search_text", byChannel)
+	}
+
+	tests := []struct {
+		name     string
+		messages json.RawMessage
+		search   string
+	}{
+		{name: "clear", messages: json.RawMessage(`["Hello","World"]`), search: `"hello\nworld"`},
+		{name: "compressed", messages: json.RawMessage(`null`)},
+		{name: "empty", messages: json.RawMessage(`[]`)},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			row := map[string]json.RawMessage{"user_name": json.RawMessage(`"bar"`), "messages": tt.messages}
+			byChannelRow(row, 11)
+			if got := string(row["month"]); got != "11" {
+				t.Errorf("got: %v, want: %v", got, "11")
+			}
+			if got := string(row["search_text"]); got != tt.search {
+				t.Errorf("got: %v, want: %v", got, tt.search)
+			}
+		})
+	}
+}
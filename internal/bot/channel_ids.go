@@ -0,0 +1,99 @@
+package bot
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// ChannelIDStore is implemented by drivers that persist the internal numeric
+// ids of the channels. The ids are assigned once and never reused, so a channel
+// keeps its id if its name changes
+type ChannelIDStore interface {
+	// ChannelIDs returns the id of every channel with one
+	ChannelIDs() (map[Channel]int64, error)
+	// AssignChannelID returns the id of `ch`, assigning it the next one if it
+	// has none. Concurrent calls for the same channel return the same id
+	AssignChannelID(ch Channel) (int64, error)
+}
+
+// channelIDs caches the ids of the channels of a ChannelIDStore, which never
+// change once assigned. It is safe for concurrent use
+type channelIDs struct {
+	store ChannelIDStore
+
+	mu     sync.RWMutex
+	ids    map[Channel]int64
+	loaded bool
+}
+
+// load fills the cache with every id of the store, once
+func (c *channelIDs) load() error {
+	c.mu.RLock()
+	loaded := c.loaded
+	c.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+	ids, err := c.store.ChannelIDs()
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ch, id := range ids {
+		c.ids[ch] = id
+	}
+	c.loaded = true
+	return nil
+}
+
+// id returns the id of `ch`, assigning one if it has none
+func (c *channelIDs) id(ch Channel) (int64, error) {
+	ch = Channel(strings.ToLower(string(ch)))
+	c.mu.RLock()
+	id, ok := c.ids[ch]
+	c.mu.RUnlock()
+	if ok {
+		return id, nil
+	}
+	id, err := c.store.AssignChannelID(ch)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	c.ids[ch] = id
+	c.mu.Unlock()
+	return id, nil
+}
+
+// newChannelIDs returns nil if the driver doesn't support channel ids
+func newChannelIDs(d Driver) *channelIDs {
+	store, ok := d.(ChannelIDStore)
+	if !ok {
+		return nil
+	}
+	return &channelIDs{store: store, ids: make(map[Channel]int64)}
+}
+
+// ChannelID returns the internal numeric id of `ch`, assigning one if it has
+// none
+func (s *Storage) ChannelID(ch Channel) (int64, error) {
+	if s.channelIDs == nil {
+		return 0, ErrUnsupported
+	}
+	if err := s.channelIDs.load(); err != nil {
+		return 0, err
+	}
+	return s.channelIDs.id(ch)
+}
+
+// assignChannelID makes sure the channel of a stored moderation has an id
+func (s *Storage) assignChannelID(msg *message.Message) {
+	if _, err := s.ChannelID(Channel(msg.Channel)); err != nil {
+		storageErrors.Inc("assign_channel_id")
+		errors.WrapAndLog(err)
+	}
+}
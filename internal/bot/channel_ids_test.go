@@ -0,0 +1,49 @@
+package bot
+
+import "testing"
+
+// countingIDs counts the ids assigned by the store
+type countingIDs struct {
+	*Memory
+	assigned int
+}
+
+func (c *countingIDs) AssignChannelID(ch Channel) (int64, error) {
+	c.assigned++
+	return c.Memory.AssignChannelID(ch)
+}
+
+func TestChannelIDs(t *testing.T) {
+	t.Parallel()
+	m := NewMemoryStorage(10)
+	if _, err := m.AssignChannelID("foo"); err != nil {
+		t.Fatal(err)
+	}
+	store := &countingIDs{Memory: m}
+	ids := &channelIDs{store: store, ids: make(map[Channel]int64)}
+	if err := ids.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ch       Channel
+		want     int64
+		assigned int
+	}{
+		// loaded from the store
+		{"foo", 1, 0},
+		{"bar", 2, 1},
+		// cached
+		{"Bar", 2, 1},
+		{"baz", 3, 2},
+	}
+	for _, tt := range tests {
+		got, err := ids.id(tt.ch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want || store.assigned != tt.assigned {
+			t.Errorf("%s got: %d (%d assigned), want: %d (%d assigned)", tt.ch, got, store.assigned, tt.want, tt.assigned)
+		}
+	}
+}
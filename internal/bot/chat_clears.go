@@ -0,0 +1,69 @@
+package bot
+
+import (
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// ChatClear is a clear of all the messages of a chat
+type ChatClear struct {
+	Channel string    `json:"channel"`
+	At      time.Time `json:"at"`
+	// Moderator is the login of the moderator who cleared the chat, empty if
+	// unknown. Only EventSub tells it
+	Moderator string `json:"moderator,omitempty"`
+}
+
+// ChatClearStore is implemented by drivers that can keep the chat clears of
+// every channel.
+type ChatClearStore interface {
+	InsertChatClear(clear *ChatClear) error
+	// ChatClears returns the chat clears of the channel between `from` and `to`,
+	// the most recent first
+	ChatClears(ch Channel, from, to time.Time) ([]*ChatClear, error)
+}
+
+// ChatClear stores a clear of the chat. The messages of the chat are not
+// stored, they are not related to any moderation
+func (s *Storage) ChatClear(msg *message.Message) {
+	c, ok := s.driver.(ChatClearStore)
+	if !ok {
+		return
+	}
+	if err := c.InsertChatClear(&ChatClear{
+		Channel:   strings.ToLower(msg.Channel),
+		At:        msg.At,
+		Moderator: strings.ToLower(msg.Moderator),
+	}); err != nil {
+		storageErrors.Inc("insert_chat_clear")
+		errors.WrapAndLog(err)
+	}
+}
+
+// ChatClears returns the chat clears of the channel between `from` and `to`.
+// See ChatClearStore
+func (s *Storage) ChatClears(ch Channel, from, to time.Time) ([]*ChatClear, error) {
+	c, ok := s.driver.(ChatClearStore)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return c.ChatClears(Channel(strings.ToLower(string(ch))), from, to)
+}
+
+// TenantChatClears is ChatClears of a channel of the tenant
+func (s *Storage) TenantChatClears(tenantID string, ch Channel, from, to time.Time) ([]*ChatClear, error) {
+	ch = Channel(strings.ToLower(string(ch)))
+	if err := s.owns(tenantID, ch); err != nil {
+		return nil, err
+	}
+	return s.ChatClears(ch, from, to)
+}
+
+func init() {
+	RegisterHandler(message.MessageChatClear, func(t *channelTracker, msg *message.Message) {
+		t.sto.ChatClear(msg)
+	})
+}
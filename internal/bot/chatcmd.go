@@ -0,0 +1,250 @@
+package bot
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gempir/go-twitch-irc/v3"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+const (
+	// CommandPrefix is the prefix of the opt-in/opt-out chat commands, e.g.
+	// `!hammertrack enable`
+	CommandPrefix = "!hammertrack"
+	// Maximum length of a twitch chat message
+	MaxReplyLength = 500
+	// Number of moderations summarized by !bans
+	BansSummaryLimit = 3
+)
+
+type chatCommand struct {
+	// modOnly commands can only be used by the broadcaster and its moderators
+	modOnly bool
+	// replies commands are rate-limited before running, because their reply is
+	// what they query the database for
+	replies bool
+	enabled func() bool
+	// run executes the command and returns the reply, if any
+	run func(b *Bot, msg twitch.PrivateMessage, args []string) (string, error)
+}
+
+// chatCommands maps the first word of a chat message to its command
+var chatCommands = map[string]*chatCommand{
+	CommandPrefix: {
+		enabled: func() bool { return cfg.ChatOptIn },
+		run:     cmdOptIn,
+	},
+	"!bans": {
+		modOnly: true,
+		replies: true,
+		enabled: func() bool { return cfg.ChatCommands },
+		run:     cmdBans,
+	},
+}
+
+// cooldown limits the replies of the bot to one per channel every `d` so a
+// command can't be abused to get the bot rate-limited or banned by twitch
+type cooldown struct {
+	d    time.Duration
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// allow returns true and starts the cooldown of `ch` at `now` if it is not
+// cooling down
+func (c *cooldown) allow(ch string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.last[ch]) < c.d {
+		return false
+	}
+	c.last[ch] = now
+	return true
+}
+
+func newCooldown(d time.Duration) *cooldown {
+	return &cooldown{d: d, last: make(map[string]time.Time)}
+}
+
+func findCommand(body string) *chatCommand {
+	if !strings.HasPrefix(body, "!") {
+		return nil
+	}
+	name := body
+	if i := strings.IndexByte(body, ' '); i > 0 {
+		name = body[:i]
+	}
+	cmd, ok := chatCommands[name]
+	if !ok || !cmd.enabled() {
+		return nil
+	}
+	return cmd
+}
+
+func isCommand(body string) bool {
+	return findCommand(body) != nil
+}
+
+// isModerator returns whether the author of a message has moderation rights in
+// the channel where the message was sent
+func isModerator(u twitch.User) bool {
+	_, broadcaster := u.Badges["broadcaster"]
+	_, mod := u.Badges["moderator"]
+	return broadcaster || mod
+}
+
+func (b *Bot) handleCommand(msg twitch.PrivateMessage) {
+	cmd := findCommand(msg.Message)
+	if cmd == nil {
+		return
+	}
+	if cmd.modOnly && !isModerator(msg.User) {
+		return
+	}
+	if cmd.replies && !b.replies.allow(msg.Channel, b.clock.Now()) {
+		return
+	}
+	reply, err := cmd.run(b, msg, strings.Fields(msg.Message)[1:])
+	if err != nil {
+		errors.WrapAndLogWithContext(err, struct {
+			Channel string
+			Author  string
+			Command string
+		}{msg.Channel, msg.User.Name, msg.Message})
+		return
+	}
+	if reply == "" || (!cmd.replies && !b.replies.allow(msg.Channel, b.clock.Now())) {
+		return
+	}
+	if cfg.ChatCommandsWhisper {
+		err = b.Whisper(msg.User.Name, reply)
+	} else {
+		err = b.Say(Channel(msg.Channel), "@"+msg.User.Name+" "+reply)
+	}
+	if err != nil && !errors.Is(err, ErrChatSilenced) {
+		errors.WrapAndLog(err)
+	}
+}
+
+// truncateReply cuts the reply to MaxReplyLength bytes on a rune boundary
+func truncateReply(reply string) string {
+	if len(reply) <= MaxReplyLength {
+		return reply
+	}
+	cut := MaxReplyLength - len("...")
+	for cut > 0 && !utf8.RuneStart(reply[cut]) {
+		cut--
+	}
+	return reply[:cut] + "..."
+}
+
+// cmdOptIn handles `!hammertrack enable|disable`:
+//
+// - In the channel of the bot, anyone can enable or disable the tracking of its
+// own channel, which is the only way to opt-in an untracked channel because
+// the bot can't read its chat.
+//
+// - In a tracked channel, the broadcaster and its moderators can disable the
+// tracking of the channel.
+func cmdOptIn(b *Bot, msg twitch.PrivateMessage, args []string) (string, error) {
+	if len(args) < 1 {
+		return "", nil
+	}
+	var target Channel
+	if msg.Channel == strings.ToLower(cfg.ClientUsername) {
+		target = Channel(msg.User.Name)
+	} else {
+		if !isModerator(msg.User) {
+			return "", nil
+		}
+		target = Channel(msg.Channel)
+	}
+
+	actor := "chat:" + msg.User.Name
+	switch args[0] {
+	case "enable":
+		return "", b.EnableChannel(target, actor)
+	case "disable":
+		return "", b.DisableChannel(target, actor)
+	}
+	return "", nil
+}
+
+// cmdBans handles `!bans <username>`, replying with a summary of the recent
+// moderations of the user in the channel. The stored messages are never
+// repeated in chat, they are often what got the user banned in the first place
+func cmdBans(b *Bot, msg twitch.PrivateMessage, args []string) (string, error) {
+	if len(args) < 1 {
+		return b.render("bans.usage", nil)
+	}
+	username := strings.ToLower(strings.TrimPrefix(args[0], "@"))
+	mods, err := b.sto.UserModerations(username, Channel(msg.Channel), BansSummaryLimit)
+	if err != nil {
+		return "", err
+	}
+	type summary struct {
+		Day      string
+		Type     message.MessageType
+		Messages int
+	}
+	data := struct {
+		Username    string
+		Moderations []summary
+	}{Username: username}
+	if len(mods) == 0 {
+		return b.render("bans.none", data)
+	}
+	for _, m := range mods {
+		typ := m.Type
+		if typ == "" {
+			// stored before the type was, only bans were stored then
+			typ = message.MessageBan
+		}
+		data.Moderations = append(data.Moderations, summary{m.At.UTC().Format("2006-01-02"), typ, len(m.Messages)})
+	}
+	return b.render("bans.summary", data)
+}
+
+// EnableChannel persists the channel as tracked and starts tracking it
+func (b *Bot) EnableChannel(ch Channel, actor string) error {
+	ch = Channel(strings.ToLower(string(ch)))
+	if b.IsTracked(ch) {
+		return nil
+	}
+	if err := b.sto.AddChannel(ch, actor); err != nil {
+		return err
+	}
+	b.validateChannels([]Channel{ch})
+	if b.track(ch) {
+		b.source.Join(string(ch))
+		log.Printf("tracking #%s, enabled by %s", ch, actor)
+	}
+	return nil
+}
+
+// DisableChannel removes the channel from the tracked channels and stops
+// tracking it
+func (b *Bot) DisableChannel(ch Channel, actor string) error {
+	ch = Channel(strings.ToLower(string(ch)))
+	if !b.IsTracked(ch) {
+		return nil
+	}
+	if err := b.sto.RemoveChannel(ch, actor); err != nil {
+		return err
+	}
+	// the channel of the bot is never departed, it is needed to receive commands
+	if string(ch) != strings.ToLower(cfg.ClientUsername) {
+		b.source.Depart(string(ch))
+	}
+	if b.untrack(ch) {
+		log.Printf("stopped tracking #%s, disabled by %s", ch, actor)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package bot
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+)
+
+// ChatRateWindow is the period of cfg.ChatRateLimit. Twitch allows 20 messages
+// every 30 seconds to the accounts that are not moderators of the channels, an
+// account over it is locked out of the chat
+const ChatRateWindow = 30 * time.Second
+
+var (
+	ErrChatSilenced    = errors.New("the messages of the bot are silenced")
+	ErrChatRateLimited = errors.New("message of the bot over the rate limit")
+	// ErrChatForbidden is returned for the messages the bot must never send,
+	// e.g. to an untracked channel or running an IRC command like /ban
+	ErrChatForbidden = errors.New("message of the bot not allowed")
+	ErrChatNoClient  = errors.New("the bot can only write in chat from the IRC source")
+	ErrChatTemplates = errors.New("bad CHAT_TEMPLATES, expected <name>=<template>;...")
+)
+
+// chatTemplates are the default templates of the replies of the bot, which
+// CHAT_TEMPLATES overrides by name
+var chatTemplates = map[string]string{
+	"bans.usage":   "usage: !bans <username>",
+	"bans.none":    "no moderations stored for {{.Username}} in this channel",
+	"bans.summary": "last moderations of {{.Username}}:{{range .Moderations}} [{{.Day}} {{.Type}}, {{.Messages}} messages]{{end}}",
+}
+
+// chatGate is the only way out of the bot to the chat. It enforces the rate
+// limits of twitch over every message, and the kill switch. It is safe for
+// concurrent use
+type chatGate struct {
+	limit    int
+	interval time.Duration
+
+	mu       sync.Mutex
+	silenced bool
+	// sent are the times of the messages of the last ChatRateWindow, oldest
+	// first
+	sent []time.Time
+	// last is the time of the last message of every channel or whisper
+	last map[string]time.Time
+}
+
+// allow reports whether a message to `target` can be sent at `now`, and
+// counts it as sent if it can
+func (g *chatGate) allow(target string, now time.Time) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.silenced {
+		return ErrChatSilenced
+	}
+	i := 0
+	for i < len(g.sent) && now.Sub(g.sent[i]) >= ChatRateWindow {
+		i++
+	}
+	g.sent = g.sent[i:]
+	if len(g.sent) >= g.limit || now.Sub(g.last[target]) < g.interval {
+		return ErrChatRateLimited
+	}
+	g.sent = append(g.sent, now)
+	g.last[target] = now
+	return nil
+}
+
+func (g *chatGate) silence(silenced bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.silenced = silenced
+}
+
+func (g *chatGate) isSilenced() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.silenced
+}
+
+func newChatGate() *chatGate {
+	return &chatGate{
+		limit:    cfg.ChatRateLimit,
+		interval: time.Duration(cfg.ChatChannelIntervalMs) * time.Millisecond,
+		silenced: cfg.ChatSilenced,
+		last:     make(map[string]time.Time),
+	}
+}
+
+// parseChatTemplates returns the templates of the replies, the defaults
+// overridden by a list of CHAT_TEMPLATES
+func parseChatTemplates(list string) (*template.Template, error) {
+	texts := make(map[string]string, len(chatTemplates))
+	for name, text := range chatTemplates {
+		texts[name] = text
+	}
+	for _, entry := range strings.Split(list, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, text, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if _, known := chatTemplates[name]; !ok || !known {
+			return nil, errors.WrapWithContext(ErrChatTemplates, struct{ Entry string }{entry})
+		}
+		texts[name] = text
+	}
+	root := template.New("chat")
+	for name, text := range texts {
+		if _, err := root.New(name).Parse(text); err != nil {
+			return nil, errors.WrapWithContext(err, struct{ Template string }{name})
+		}
+	}
+	return root, nil
+}
+
+func newChatTemplates() *template.Template {
+	t, err := parseChatTemplates(cfg.ChatTemplates)
+	if err != nil {
+		errors.WrapFatal(err)
+	}
+	return t
+}
+
+// render returns the reply of the template `name`
+func (b *Bot) render(name string, data interface{}) (string, error) {
+	var sb strings.Builder
+	if err := b.templates.ExecuteTemplate(&sb, name, data); err != nil {
+		return "", errors.WrapWithContext(err, struct{ Template string }{name})
+	}
+	return sb.String(), nil
+}
+
+// permit returns why the text can't be sent, if it can't. The bot only writes
+// in the tracked channels and its own, and never sends IRC commands
+func (b *Bot) permit(ch, text string) error {
+	if strings.HasPrefix(text, "/") || strings.HasPrefix(text, ".") {
+		return ErrChatForbidden
+	}
+	if ch != "" && ch != strings.ToLower(cfg.ClientUsername) && !b.IsTracked(Channel(ch)) {
+		return ErrChatForbidden
+	}
+	if b.client == nil {
+		return ErrChatNoClient
+	}
+	return nil
+}
+
+// send sends the text to the channel, or whispers it to `user` if ch is
+// empty, through the gate
+func (b *Bot) send(ch, user, text string) error {
+	text = truncateReply(text)
+	target := "#" + ch
+	if ch == "" {
+		target = user
+	}
+	err := b.permit(ch, text)
+	if err == nil {
+		err = b.chat.allow(target, b.clock.Now())
+	}
+	if err != nil {
+		chatMessages.Inc(chatResult(err))
+		return errors.WrapWithContext(err, struct{ Target string }{target})
+	}
+	chatMessages.Inc("sent")
+	if ch == "" {
+		b.client.Whisper(user, text)
+	} else {
+		b.client.Say(ch, text)
+	}
+	return nil
+}
+
+// chatResult returns the label of the result of a message in the metrics
+func chatResult(err error) string {
+	switch {
+	case errors.Is(err, ErrChatSilenced):
+		return "silenced"
+	case errors.Is(err, ErrChatRateLimited):
+		return "rate_limited"
+	default:
+		return "forbidden"
+	}
+}
+
+// Say writes the text in the chat of the channel, if the gate allows it
+func (b *Bot) Say(ch Channel, text string) error {
+	return b.send(strings.ToLower(string(ch)), "", text)
+}
+
+// Whisper whispers the text to the user, if the gate allows it
+func (b *Bot) Whisper(user, text string) error {
+	return b.send("", strings.ToLower(user), text)
+}
+
+// SilenceChat turns on or off the kill switch of the messages of the bot
+func (b *Bot) SilenceChat(silenced bool, actor string) {
+	b.chat.silence(silenced)
+	action := "chat-unsilence"
+	if silenced {
+		action = "chat-silence"
+	}
+	log.Printf("%s by %s", action, actor)
+	b.sto.auditTenant(action, actor, "")
+}
+
+// ChatSilenced reports whether the messages of the bot are silenced
+func (b *Bot) ChatSilenced() bool {
+	return b.chat.isSilenced()
+}
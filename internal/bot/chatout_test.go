@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestChatGate(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	g := &chatGate{limit: 3, interval: time.Second, last: make(map[string]time.Time)}
+	tests := []struct {
+		name   string
+		target string
+		at     time.Duration
+		want   error
+	}{
+		{"first", "#foo", 0, nil},
+		{"same channel too soon", "#foo", 500 * time.Millisecond, ErrChatRateLimited},
+		{"another channel", "#bar", 500 * time.Millisecond, nil},
+		{"same channel later", "#foo", 2 * time.Second, nil},
+		{"over the limit", "#baz", 3 * time.Second, ErrChatRateLimited},
+		{"window passed", "#baz", ChatRateWindow + time.Second, nil},
+	}
+	for _, tt := range tests {
+		if got := g.allow(tt.target, now.Add(tt.at)); !errors.Is(got, tt.want) {
+			t.Errorf("%s got: %v, want: %v", tt.name, got, tt.want)
+		}
+	}
+	g.silence(true)
+	if got := g.allow("#qux", now.Add(time.Hour)); !errors.Is(got, ErrChatSilenced) {
+		t.Errorf("silenced got: %v, want: %v", got, ErrChatSilenced)
+	}
+}
+
+func TestParseChatTemplates(t *testing.T) {
+	t.Parallel()
+	tmpl, err := parseChatTemplates("bans.none=nothing for {{.Username}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	if err := tmpl.ExecuteTemplate(&sb, "bans.none", struct{ Username string }{"foo"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sb.String(), "nothing for foo"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+	for _, list := range []string{"bans.unknown=x", "bans.none", "bans.none={{.Username"} {
+		if _, err := parseChatTemplates(list); err == nil {
+			t.Errorf("%q got no error", list)
+		}
+	}
+}
+
+func TestPermitCommands(t *testing.T) {
+	t.Parallel()
+	b := &Bot{tracked: map[string]chan *message.Message{"foo": nil}}
+	for _, text := range []string{"/ban someone", ".timeout someone 600"} {
+		if err := b.permit("foo", text); !errors.Is(err, ErrChatForbidden) {
+			t.Errorf("%q got: %v, want: %v", text, err, ErrChatForbidden)
+		}
+	}
+	if err := b.permit("bar", "hello"); !errors.Is(err, ErrChatForbidden) {
+		t.Errorf("untracked channel got: %v, want: %v", err, ErrChatForbidden)
+	}
+}
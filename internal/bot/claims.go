@@ -0,0 +1,285 @@
+package bot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+)
+
+// Modes of the claims of the channels, see cfg.ChannelClaims
+const (
+	ClaimsOff     = "off"
+	ClaimsWarn    = "warn"
+	ClaimsBackoff = "backoff"
+)
+
+// ClaimConflictChecks is the number of consecutive checks a channel must be
+// claimed by another instance to be a conflict. The claims of an instance that
+// crashed are left until they expire, and must not be taken for a conflict
+const ClaimConflictChecks = 3
+
+var ErrClaimsMode = errors.New("unknown CHANNEL_CLAIMS, expected off, warn or backoff")
+
+// ChannelClaim is the claim of a tracked channel by an instance of the tracker
+type ChannelClaim struct {
+	Channel  Channel
+	Instance string
+	// StartedAt is when the instance started, the newest instance backs off
+	StartedAt   time.Time
+	HeartbeatAt time.Time
+}
+
+// ChannelClaimStore is implemented by drivers that keep the claims of the
+// channels of every instance, so the channels tracked by more than an instance
+// are detected
+type ChannelClaimStore interface {
+	// ClaimChannels stores the claims, which expire after ttl unless they are
+	// claimed again
+	ClaimChannels(claims []*ChannelClaim, ttl time.Duration) error
+	// ChannelClaims returns the claims of the channels by every instance
+	ChannelClaims(channels []Channel) ([]*ChannelClaim, error)
+	// ReleaseChannels removes the claims of the channels by `instance`
+	ReleaseChannels(instance string, channels []Channel) error
+}
+
+// claims claims the tracked channels of the instance and detects the ones
+// tracked by other instances too. It is safe for concurrent use
+type claims struct {
+	store     ChannelClaimStore
+	instance  string
+	startedAt time.Time
+	backoff   bool
+	interval  time.Duration
+
+	mu sync.Mutex
+	// seen is the number of consecutive checks every channel was claimed by
+	// another instance
+	seen map[Channel]int
+	// conflicts are the other instances of every channel in conflict
+	conflicts map[Channel][]string
+}
+
+// live reports whether the claim was renewed recently enough to belong to a
+// running instance
+func (c *claims) live(claim *ChannelClaim, now time.Time) bool {
+	return now.Sub(claim.HeartbeatAt) < c.interval*3/2
+}
+
+// check updates the conflicts from the claims of the tracked channels and
+// returns the channels that began to conflict, and the ones the instance must
+// back off from
+func (c *claims) check(all []*ChannelClaim, now time.Time) (began, backoff []Channel) {
+	others := make(map[Channel][]*ChannelClaim)
+	for _, claim := range all {
+		if claim.Instance != c.instance && c.live(claim, now) {
+			others[claim.Channel] = append(others[claim.Channel], claim)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ch := range c.seen {
+		if _, ok := others[ch]; !ok {
+			delete(c.seen, ch)
+			delete(c.conflicts, ch)
+		}
+	}
+	for ch, claims := range others {
+		c.seen[ch]++
+		if c.seen[ch] < ClaimConflictChecks {
+			continue
+		}
+		instances := make([]string, len(claims))
+		oldest := true
+		for i, claim := range claims {
+			instances[i] = claim.Instance
+			if c.newerThan(claim) {
+				oldest = false
+			}
+		}
+		sort.Strings(instances)
+		if _, ok := c.conflicts[ch]; !ok {
+			began = append(began, ch)
+		}
+		c.conflicts[ch] = instances
+		// every instance but the oldest backs off
+		if c.backoff && !oldest {
+			backoff = append(backoff, ch)
+		}
+	}
+	return began, backoff
+}
+
+// newerThan reports whether the instance started after the one of `claim`,
+// with the instance ids breaking the ties
+func (c *claims) newerThan(claim *ChannelClaim) bool {
+	if c.startedAt.Equal(claim.StartedAt) {
+		return c.instance > claim.Instance
+	}
+	return c.startedAt.After(claim.StartedAt)
+}
+
+// released forgets the conflict of a channel that is not tracked anymore
+func (c *claims) released(ch Channel) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.seen, ch)
+	delete(c.conflicts, ch)
+}
+
+func (c *claims) instancesOf(ch Channel) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conflicts[ch]
+}
+
+// conflicting returns the channels in conflict, sorted, with their instances
+func (c *claims) conflicting() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	chs := make([]string, 0, len(c.conflicts))
+	for ch, instances := range c.conflicts {
+		chs = append(chs, fmt.Sprintf("%s (%s)", ch, strings.Join(instances, ", ")))
+	}
+	sort.Strings(chs)
+	return chs
+}
+
+// claim renews the claims of the tracked channels and handles the conflicts
+func (b *Bot) claim(now time.Time) error {
+	chs := b.trackedChannels()
+	if len(chs) == 0 {
+		return nil
+	}
+	c := b.claims
+	own := make([]*ChannelClaim, len(chs))
+	for i, ch := range chs {
+		own[i] = &ChannelClaim{Channel: ch, Instance: c.instance, StartedAt: c.startedAt, HeartbeatAt: now}
+	}
+	if err := c.store.ClaimChannels(own, 3*c.interval); err != nil {
+		return err
+	}
+	all, err := c.store.ChannelClaims(chs)
+	if err != nil {
+		return err
+	}
+	began, backoff := c.check(all, now)
+	for _, ch := range began {
+		channelConflicts.Inc(string(ch))
+		log.Printf("WARNING: #%s is also tracked by %s, its moderations are stored twice. Check the shards of the instances", ch, strings.Join(c.instancesOf(ch), ", "))
+	}
+	for _, ch := range backoff {
+		b.backOff(ch)
+	}
+	return nil
+}
+
+// backOff stops tracking a channel tracked by an older instance, leaving it in
+// the tracked channels of the database
+func (b *Bot) backOff(ch Channel) {
+	b.mu.RLock()
+	source := b.source
+	b.mu.RUnlock()
+	if source != nil {
+		source.Depart(string(ch))
+	}
+	if b.untrack(ch) {
+		log.Printf("stopped tracking #%s, an older instance of the tracker tracks it", ch)
+	}
+	b.claims.released(ch)
+	if err := b.claims.store.ReleaseChannels(b.claims.instance, []Channel{ch}); err != nil {
+		errors.WrapAndLog(err)
+	}
+}
+
+// startClaims claims the tracked channels every interval until ctx is done
+func (b *Bot) startClaims(ctx context.Context) {
+	t := time.NewTicker(b.claims.interval)
+	defer t.Stop()
+	for {
+		if err := b.claim(b.clock.Now()); err != nil {
+			errors.WrapAndLog(err)
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// releaseClaims removes the claims of the tracked channels, so a restarted
+// instance doesn't conflict with its previous run
+func (b *Bot) releaseClaims() {
+	if b.claims == nil {
+		return
+	}
+	if err := b.claims.store.ReleaseChannels(b.claims.instance, b.trackedChannels()); err != nil {
+		errors.WrapAndLog(err)
+	}
+}
+
+// ConflictingChannels returns the tracked channels also tracked by other
+// instances, with the instances, sorted
+func (b *Bot) ConflictingChannels() []string {
+	if b.claims == nil {
+		return nil
+	}
+	return b.claims.conflicting()
+}
+
+// trackedChannels returns the channels tracked by the bot
+func (b *Bot) trackedChannels() []Channel {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	chs := make([]Channel, 0, len(b.tracked))
+	for ch := range b.tracked {
+		chs = append(chs, Channel(ch))
+	}
+	return chs
+}
+
+// instanceID returns an id of the running instance, unique across restarts
+func instanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
+
+// newClaims returns nil if the claims are off or the driver doesn't support
+// them
+func newClaims(d Driver) *claims {
+	switch cfg.ChannelClaims {
+	case ClaimsOff:
+		return nil
+	case ClaimsWarn, ClaimsBackoff:
+	default:
+		errors.WrapFatalWithContext(ErrClaimsMode, struct{ Mode string }{cfg.ChannelClaims})
+	}
+	store, ok := d.(ChannelClaimStore)
+	if !ok {
+		return nil
+	}
+	return &claims{
+		store:     store,
+		instance:  instanceID(),
+		startedAt: time.Now(),
+		backoff:   cfg.ChannelClaims == ClaimsBackoff,
+		interval:  time.Duration(cfg.ChannelClaimsIntervalSeconds) * time.Second,
+		seen:      make(map[Channel]int),
+		conflicts: make(map[Channel][]string),
+	}
+}
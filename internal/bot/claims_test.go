@@ -0,0 +1,67 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClaimsCheck(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	newClaims := func(backoff bool) *claims {
+		return &claims{
+			instance:  "b",
+			startedAt: now.Add(-time.Hour),
+			backoff:   backoff,
+			interval:  30 * time.Second,
+			seen:      make(map[Channel]int),
+			conflicts: make(map[Channel][]string),
+		}
+	}
+	claim := func(instance string, started, heartbeat time.Duration) *ChannelClaim {
+		return &ChannelClaim{Channel: "foo", Instance: instance, StartedAt: now.Add(started), HeartbeatAt: now.Add(heartbeat)}
+	}
+	own := claim("b", -time.Hour, 0)
+	tests := []struct {
+		name        string
+		backoff     bool
+		claims      []*ChannelClaim
+		wantBegan   []Channel
+		wantBackoff []Channel
+	}{
+		{"alone", true, []*ChannelClaim{own}, nil, nil},
+		{"stale", true, []*ChannelClaim{own, claim("a", -2*time.Hour, -time.Minute)}, nil, nil},
+		{"warn", false, []*ChannelClaim{own, claim("a", -2*time.Hour, 0)}, []Channel{"foo"}, nil},
+		{"newer backs off", true, []*ChannelClaim{own, claim("a", -2*time.Hour, 0)}, []Channel{"foo"}, []Channel{"foo"}},
+		{"older stays", true, []*ChannelClaim{own, claim("c", -time.Minute, 0)}, []Channel{"foo"}, nil},
+		{"tie by instance", true, []*ChannelClaim{own, claim("c", -time.Hour, 0)}, []Channel{"foo"}, nil},
+	}
+	for _, tt := range tests {
+		c := newClaims(tt.backoff)
+		var began, backoff []Channel
+		for i := 0; i < ClaimConflictChecks; i++ {
+			if began, backoff = c.check(tt.claims, now); i < ClaimConflictChecks-1 && began != nil {
+				t.Errorf("%s got a conflict after %d checks", tt.name, i+1)
+			}
+		}
+		if !reflect.DeepEqual(began, tt.wantBegan) || !reflect.DeepEqual(backoff, tt.wantBackoff) {
+			t.Errorf("%s got: %v %v, want: %v %v", tt.name, began, backoff, tt.wantBegan, tt.wantBackoff)
+		}
+	}
+
+	// a conflict only begins once, and ends with the claims of the other
+	// instance
+	c := newClaims(false)
+	claims := []*ChannelClaim{own, claim("a", -2*time.Hour, 0)}
+	for i := 0; i < ClaimConflictChecks+1; i++ {
+		c.check(claims, now)
+	}
+	if got, want := c.conflicting(), []string{"foo (a)"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+	c.check([]*ChannelClaim{own}, now)
+	if got := c.conflicting(); len(got) != 0 {
+		t.Errorf("got: %v, want: none", got)
+	}
+}
@@ -0,0 +1,95 @@
+package bot
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/clock"
+)
+
+const (
+	// ClockSkewSamples is the number of recent messages the skew of the local
+	// clock is estimated from
+	ClockSkewSamples = 100
+	// ClockSkewWarning is the skew of the local clock logged as a warning, once
+	ClockSkewWarning = 2 * time.Second
+)
+
+// twitchClock estimates the skew of the local clock from the time twitch sent
+// the received messages, so the times taken from the local clock can be
+// compared with the times of twitch. It is safe for concurrent use
+type twitchClock struct {
+	local clock.Clock
+
+	mu sync.Mutex
+	// samples are the recent local times of receipt minus the times sent
+	samples []time.Duration
+	next    int
+	full    bool
+	warned  bool
+}
+
+// observe records a message sent by twitch at `sent` and received at the local
+// time `received`
+func (c *twitchClock) observe(sent, received time.Time) {
+	if sent.IsZero() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.samples[c.next] = received.Sub(sent)
+	c.next = (c.next + 1) % len(c.samples)
+	if c.next == 0 {
+		c.full = true
+	}
+	if skew := c.skewLocked(); !c.warned && (skew > ClockSkewWarning || skew < -ClockSkewWarning) {
+		c.warned = true
+		log.Printf("the local clock is %s off the clock of twitch, check the time synchronization of the host. The times of the local clock are compensated", skew)
+	}
+}
+
+// skew returns how far ahead of twitch the local clock is, 0 if unknown
+func (c *twitchClock) skew() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.skewLocked()
+}
+
+// skewLocked is the minimum of the samples, which include the latency of the
+// network: the sample with the least latency is the closest to the skew
+func (c *twitchClock) skewLocked() time.Duration {
+	n := c.next
+	if c.full {
+		n = len(c.samples)
+	}
+	if n == 0 {
+		return 0
+	}
+	min := c.samples[0]
+	for _, s := range c.samples[1:n] {
+		if s < min {
+			min = s
+		}
+	}
+	return min
+}
+
+// now returns the current time in the clock of twitch
+func (c *twitchClock) now() time.Time {
+	return c.local.Now().Add(-c.skew())
+}
+
+func newTwitchClock(local clock.Clock) *twitchClock {
+	return &twitchClock{local: local, samples: make([]time.Duration, ClockSkewSamples)}
+}
+
+// sentAt returns the time twitch sent an IRC message from its tmi-sent-ts tag
+func sentAt(tags map[string]string) (time.Time, bool) {
+	ms, err := strconv.ParseInt(tags["tmi-sent-ts"], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/clock"
+)
+
+func TestClockSkew(t *testing.T) {
+	t.Parallel()
+	sent := time.Date(2023, 7, 19, 14, 50, 0, 0, time.UTC)
+	tests := []struct {
+		desc string
+		// latencies are the local times of receipt minus the times sent
+		latencies []time.Duration
+		want      time.Duration
+	}{
+		{"unknown", nil, 0},
+		{"minimum latency", []time.Duration{3 * time.Second, 2 * time.Second, 5 * time.Second}, 2 * time.Second},
+		{"local clock behind", []time.Duration{-time.Second, -900 * time.Millisecond}, -time.Second},
+	}
+	for _, tt := range tests {
+		c := newTwitchClock(clock.Real)
+		for _, l := range tt.latencies {
+			c.observe(sent, sent.Add(l))
+		}
+		if got := c.skew(); got != tt.want {
+			t.Errorf("%s: got: %s, want: %s", tt.desc, got, tt.want)
+		}
+	}
+
+	// only the most recent samples are kept
+	c := newTwitchClock(clock.Real)
+	c.observe(sent, sent.Add(-time.Hour))
+	for i := 0; i < ClockSkewSamples; i++ {
+		c.observe(sent, sent.Add(time.Second))
+	}
+	if got := c.skew(); got != time.Second {
+		t.Errorf("got: %s, want: %s", got, time.Second)
+	}
+}
+
+func TestSentAt(t *testing.T) {
+	t.Parallel()
+	at, ok := sentAt(map[string]string{"tmi-sent-ts": "1490382457309"})
+	if want := time.UnixMilli(1490382457309); !ok || !at.Equal(want) {
+		t.Errorf("got: %v %v, want: %v true", at, ok, want)
+	}
+	if _, ok := sentAt(map[string]string{}); ok {
+		t.Errorf("got: true, want: false")
+	}
+}
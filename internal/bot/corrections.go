@@ -0,0 +1,57 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+var ErrModerationNotFound = errors.New("moderation not found")
+
+// Corrector is implemented by drivers that can correct the moderations stored
+// by mistake, e.g. an accidental ban reverted right away. The moderations are
+// soft-deleted with a tombstone rather than deleted, so they are left out of
+// the default queries but kept for audit.
+type Corrector interface {
+	// CorrectModeration sets the tombstone and the note of the moderation of
+	// `username` in `ch` at `at`, or returns ErrModerationNotFound
+	CorrectModeration(username string, ch Channel, at time.Time, c *Correction) error
+}
+
+// Correction is the state of a corrected moderation. A moderation is restored
+// by correcting it with Deleted false
+type Correction struct {
+	Deleted bool   `json:"deleted"`
+	Note    string `json:"note"`
+}
+
+// CorrectModeration soft-deletes, restores or annotates a stored moderation and
+// records who did it in the audit log. See Corrector
+func (s *Storage) CorrectModeration(username string, ch Channel, at time.Time, c *Correction, actor string) error {
+	cr, ok := s.driver.(Corrector)
+	if !ok {
+		return ErrUnsupported
+	}
+	username = strings.ToLower(username)
+	ch = Channel(strings.ToLower(string(ch)))
+	if err := cr.CorrectModeration(username, ch, at, c); err != nil {
+		return err
+	}
+	if err := s.Audit(&AuditEntry{
+		Action:  "moderation-correct",
+		Actor:   actor,
+		Target:  username,
+		Details: fmt.Sprintf("channel=%s at=%s deleted=%v note=%q", ch, at.Format(time.RFC3339Nano), c.Deleted, c.Note),
+		At:      s.clock.Now(),
+	}); err != nil && !errors.Is(err, ErrUnsupported) {
+		errors.WrapAndLog(err)
+	}
+	return nil
+}
+
+// AuditModerations is UserModerations including the soft-deleted moderations
+func (s *Storage) AuditModerations(username string, ch Channel, limit int) ([]*Moderation, error) {
+	return s.userModerations(username, ch, "", limit, true)
+}
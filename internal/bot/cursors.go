@@ -0,0 +1,161 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/justlog"
+)
+
+const (
+	// CursorsFlushInterval is how often the cursors of the channels are
+	// persisted. The events of the last interval before a crash are recovered
+	// again, and skipped as duplicates
+	CursorsFlushInterval = 30 * time.Second
+	// MinGap is the shortest downtime recovered on startup, shorter gaps are
+	// restarts that lost nothing
+	MinGap = time.Minute
+)
+
+// CursorStore is implemented by drivers that persist the cursor of every
+// channel, the time of the last event received from the source
+type CursorStore interface {
+	Cursors() (map[Channel]time.Time, error)
+	SaveCursors(cursors map[Channel]time.Time) error
+}
+
+// cursors keeps the high-water mark of the events of every tracked channel, so
+// the events missed while the tracker was down are recovered on the next
+// startup. It is safe for concurrent use
+type cursors struct {
+	store CursorStore
+
+	mu sync.Mutex
+	at map[Channel]time.Time
+	// dirty are the channels whose cursor changed since the last flush
+	dirty map[Channel]bool
+	// previous are the cursors persisted by the previous run, see load
+	previous map[Channel]time.Time
+}
+
+// advance moves the cursor of the channel to `at` if it is later
+func (c *cursors) advance(ch Channel, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if at.After(c.at[ch]) {
+		c.at[ch] = at
+		c.dirty[ch] = true
+	}
+}
+
+// load reads the cursors of the previous run, before any event of this run
+func (c *cursors) load() error {
+	prev, err := c.store.Cursors()
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.previous = prev
+	c.mu.Unlock()
+	return nil
+}
+
+// flush persists the cursors that changed since the last flush
+func (c *cursors) flush() error {
+	c.mu.Lock()
+	changed := make(map[Channel]time.Time, len(c.dirty))
+	for ch := range c.dirty {
+		changed[ch] = c.at[ch]
+	}
+	c.dirty = make(map[Channel]bool)
+	c.mu.Unlock()
+	if len(changed) == 0 {
+		return nil
+	}
+	if err := c.store.SaveCursors(changed); err != nil {
+		storageErrors.Inc("save_cursors")
+		// retried on the next flush
+		c.mu.Lock()
+		for ch := range changed {
+			c.dirty[ch] = true
+		}
+		c.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Start flushes the cursors every CursorsFlushInterval until ctx is done
+func (c *cursors) Start(ctx context.Context) {
+	t := time.NewTicker(CursorsFlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := c.flush(); err != nil {
+				errors.WrapAndLog(err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// gaps returns the periods of the channels without events between the
+// previous run and `until`, at most cfg.GapRecoveryMaxHours long. The
+// channels without a cursor were not tracked before and have no gap
+func (c *cursors) gaps(chs []Channel, until time.Time) map[Channel]time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	oldest := until.Add(-time.Duration(cfg.GapRecoveryMaxHours) * time.Hour)
+	gaps := make(map[Channel]time.Time)
+	for _, ch := range chs {
+		from, ok := c.previous[ch]
+		if !ok || until.Sub(from) < MinGap {
+			continue
+		}
+		if from.Before(oldest) {
+			from = oldest
+		}
+		gaps[ch] = from
+	}
+	return gaps
+}
+
+// newCursors returns nil if the gap recovery is disabled or the driver doesn't
+// support cursors
+func newCursors(d Driver) *cursors {
+	if !cfg.GapRecovery {
+		return nil
+	}
+	store, ok := d.(CursorStore)
+	if !ok {
+		return nil
+	}
+	return &cursors{store: store, at: make(map[Channel]time.Time), dirty: make(map[Channel]bool)}
+}
+
+// recoverGaps backfills the events of the tracked channels missed while the
+// tracker was down, from the archived logs of cfg.BackfillURL. The moderations
+// stored before the downtime are skipped as duplicates
+func (b *Bot) recoverGaps(ctx context.Context, chs []Channel) {
+	if cfg.BackfillURL == "" {
+		log.Print("gap recovery needs BACKFILL_URL, the gaps are not recovered")
+		return
+	}
+	logs := justlog.New(cfg.BackfillURL)
+	for ch, from := range b.cursors.gaps(chs, b.startedAt) {
+		log.Printf("recovering #%s from %s to %s", ch, from.UTC().Format(time.RFC3339), b.startedAt.UTC().Format(time.RFC3339))
+		report, err := backfill(ctx, b.sto, logs, ch, from, b.startedAt, true)
+		if err != nil {
+			errors.WrapAndLogWithContext(err, struct{ Channel Channel }{ch})
+			continue
+		}
+		gapsRecovered.Add(float64(report.Stored), string(ch))
+		log.Printf("recovered #%s: %d moderations found, %d stored, %d already stored", ch, report.Moderations, report.Stored, report.Duplicates)
+	}
+}
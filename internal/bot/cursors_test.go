@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"github.com/hammertrack/tracker/errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fakeCursorStore struct {
+	saved map[Channel]time.Time
+	err   error
+}
+
+func (f *fakeCursorStore) Cursors() (map[Channel]time.Time, error) {
+	return f.saved, nil
+}
+
+func (f *fakeCursorStore) SaveCursors(cursors map[Channel]time.Time) error {
+	if f.err != nil {
+		return f.err
+	}
+	for ch, at := range cursors {
+		f.saved[ch] = at
+	}
+	return nil
+}
+
+func TestCursorsFlush(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := &fakeCursorStore{saved: make(map[Channel]time.Time), err: errors.New("down")}
+	c := &cursors{store: store, at: make(map[Channel]time.Time), dirty: make(map[Channel]bool)}
+	c.advance("foo", now)
+	// an older event never moves the cursor back
+	c.advance("foo", now.Add(-time.Minute))
+	if err := c.flush(); err == nil {
+		t.Errorf("got: %v, want: an error", err)
+	}
+	// the cursors that failed are retried on the next flush
+	store.err = nil
+	if err := c.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := store.saved, map[Channel]time.Time{"foo": now}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+	if got := len(c.dirty); got != 0 {
+		t.Errorf("got: %v, want: %v", got, 0)
+	}
+}
+
+func TestCursorsGaps(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := &fakeCursorStore{saved: map[Channel]time.Time{
+		"restarted": now.Add(-10 * time.Second),
+		"down":      now.Add(-time.Hour),
+		"long":      now.Add(-72 * time.Hour),
+	}}
+	c := &cursors{store: store, at: make(map[Channel]time.Time), dirty: make(map[Channel]bool)}
+	if err := c.load(); err != nil {
+		t.Fatal(err)
+	}
+	got := c.gaps([]Channel{"restarted", "down", "long", "new"}, now)
+	want := map[Channel]time.Time{
+		"down": now.Add(-time.Hour),
+		"long": now.Add(-24 * time.Hour),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
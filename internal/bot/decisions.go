@@ -0,0 +1,179 @@
+package bot
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"hash/fnv"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/heuristics"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// The outcomes of a decision that are not the name of the rule that rejected
+// the moderation
+const (
+	DecisionStored  = "stored"
+	DecisionSpilled = "spilled"
+	DecisionError   = "error"
+)
+
+// Decision is a line of the decisions log, why a moderation was stored or not.
+// The rules of the pipeline of the moderation are written once in a line of
+// their own, with only RuleSet and Rules, and referenced by the decisions
+type Decision struct {
+	Channel  string              `json:"ch,omitempty"`
+	Username string              `json:"u,omitempty"`
+	Type     message.MessageType `json:"t,omitempty"`
+	// At is the time of the moderation, which with the channel and the user
+	// identifies it
+	At time.Time `json:"at,omitempty"`
+	// RuleSet is the id of the rules of the pipeline
+	RuleSet string `json:"rs"`
+	// Verdicts is the bitmap of the rules the messages of the moderation were
+	// not compliant with, see heuristics.Analyzer.Verdicts
+	Verdicts uint64 `json:"v,omitempty"`
+	// Outcome is DecisionStored, DecisionSpilled, DecisionError, or the name of
+	// the rule that rejected the moderation
+	Outcome string `json:"d,omitempty"`
+	// Rules are the names of the rules of the set. Decisions read with
+	// ReadDecisions have them resolved
+	Rules []string `json:"rules,omitempty"`
+}
+
+// Violated returns the names of the rules the moderation was not compliant
+// with. Final rules are among them when they did not apply
+func (d *Decision) Violated() []string {
+	var names []string
+	for i, name := range d.Rules {
+		if i < heuristics.MaxVerdicts && d.Verdicts&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ruleSet returns the id of the rules, the same for the same rules in the same
+// order
+func ruleSet(rules []string) string {
+	h := fnv.New32a()
+	h.Write([]byte(strings.Join(rules, ",")))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// decisionsLog writes the decisions of the processed moderations as compact
+// JSON lines. It is safe for concurrent use
+type decisionsLog struct {
+	mu sync.Mutex
+	w  io.Writer
+	// f is nil if the lines are not written to a file
+	f *os.File
+	// defined are the rule sets already written
+	defined map[string]bool
+}
+
+// write writes the decision of the moderation of `res`, after its rule set if
+// it was not written yet
+func (l *decisionsLog) write(res *PipelineResult) error {
+	d := &Decision{
+		Channel:  res.Channel,
+		Username: res.Username,
+		Type:     res.Type,
+		At:       res.ModeratedAt,
+		RuleSet:  ruleSet(res.Rules),
+		Verdicts: res.Verdicts,
+	}
+	switch {
+	case res.Accepted && res.Spilled:
+		d.Outcome = DecisionSpilled
+	case res.Accepted:
+		d.Outcome = DecisionStored
+	case res.Rule != "":
+		d.Outcome = res.Rule
+	default:
+		d.Outcome = DecisionError
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.defined[d.RuleSet] {
+		def, err := json.Marshal(&Decision{RuleSet: d.RuleSet, Rules: res.Rules})
+		if err != nil {
+			return errors.Wrap(err)
+		}
+		b = append(append(def, '\n'), b...)
+	}
+	if _, err := l.w.Write(append(b, '\n')); err != nil {
+		return errors.Wrap(err)
+	}
+	l.defined[d.RuleSet] = true
+	return nil
+}
+
+func (l *decisionsLog) Close() error {
+	if l.f == nil {
+		return nil
+	}
+	return l.f.Close()
+}
+
+// newDecisionsLog returns nil if the decisions are not logged
+func newDecisionsLog() *decisionsLog {
+	if cfg.DecisionsLog == "" {
+		return nil
+	}
+	f, err := os.OpenFile(cfg.DecisionsLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		errors.WrapFatalWithContext(err, struct{ DecisionsLog string }{cfg.DecisionsLog})
+	}
+	return &decisionsLog{w: f, f: f, defined: make(map[string]bool)}
+}
+
+// logDecision writes the decision of the processed moderation to the decisions
+// log
+func (s *Storage) logDecision(res *PipelineResult) {
+	if err := s.decisions.write(res); err != nil {
+		storageErrors.Inc("decisions_log")
+		errors.WrapAndLog(err)
+	}
+}
+
+// ReadDecisions calls fn with every decision of the decisions log read from
+// `r`, with the names of its rules resolved
+func ReadDecisions(r io.Reader, fn func(d *Decision) error) error {
+	sets := make(map[string][]string)
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		d := new(Decision)
+		if err := json.Unmarshal(scanner.Bytes(), d); err != nil {
+			return errors.WrapWithContext(err, struct{ Line int }{line})
+		}
+		if d.Outcome == "" {
+			sets[d.RuleSet] = d.Rules
+			continue
+		}
+		d.Rules = sets[d.RuleSet]
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
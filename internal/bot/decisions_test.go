@@ -0,0 +1,63 @@
+package bot
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestDecisionsLog(t *testing.T) {
+	t.Parallel()
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	rules := []string{"AlwaysStoreBans", "NoLinks", "MinTimeoutDuration"}
+	results := []*PipelineResult{
+		{Channel: "channel", Username: "a", Type: message.MessageBan, ModeratedAt: at, Rules: rules, Verdicts: 0b010, Accepted: true},
+		{Channel: "channel", Username: "b", Type: message.MessageTimeout, ModeratedAt: at, Rules: rules, Verdicts: 0b101, Rule: "MinTimeoutDuration"},
+		{Channel: "channel", Username: "c", Type: message.MessageBan, ModeratedAt: at, Rules: rules, Accepted: true, Spilled: true},
+		{Channel: "channel", Username: "d", Type: message.MessageBan, ModeratedAt: at, Rules: []string{}, Error: "insert failed"},
+	}
+	var buf bytes.Buffer
+	l := &decisionsLog{w: &buf, defined: make(map[string]bool)}
+	for _, res := range results {
+		if err := l.write(res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// every rule set is written once
+	if got := strings.Count(buf.String(), "\n"); got != 6 {
+		t.Fatalf("got: %v lines, want: %v", got, 6)
+	}
+
+	var got []*Decision
+	err := ReadDecisions(&buf, func(d *Decision) error {
+		got = append(got, d)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		outcome  string
+		violated string
+	}{
+		{outcome: DecisionStored, violated: "NoLinks"},
+		{outcome: "MinTimeoutDuration", violated: "AlwaysStoreBans,MinTimeoutDuration"},
+		{outcome: DecisionSpilled},
+		{outcome: DecisionError},
+	}
+	if len(got) != len(tests) {
+		t.Fatalf("got: %v decisions, want: %v", len(got), len(tests))
+	}
+	for i, tt := range tests {
+		d := got[i]
+		if d.Outcome != tt.outcome || !d.At.Equal(at) || d.Username != results[i].Username {
+			t.Errorf("got: %+v, want the outcome %v", d, tt.outcome)
+		}
+		if v := strings.Join(d.Violated(), ","); v != tt.violated {
+			t.Errorf("got: %v, want: %v", v, tt.violated)
+		}
+	}
+}
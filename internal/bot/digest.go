@@ -0,0 +1,123 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/message"
+	"github.com/hammertrack/tracker/internal/metrics"
+)
+
+// ChannelDigest sums up the moderations of a channel stored in a day
+type ChannelDigest struct {
+	// Moderations are the stored moderations by type
+	Moderations map[message.MessageType]int `json:"moderations"`
+	// TimeToAction is the histogram of the times to action, in seconds, of the
+	// moderations with the moderated message. See TimeToActionBuckets
+	TimeToAction *metrics.Histogram `json:"time_to_action_seconds"`
+}
+
+// Digest sums up the moderations stored in a UTC day, by channel
+type Digest struct {
+	Day      time.Time                 `json:"day"`
+	Channels map[string]*ChannelDigest `json:"channels"`
+}
+
+// digest collects the Digest of the current UTC day. It is safe for concurrent
+// use
+type digest struct {
+	mu      sync.Mutex
+	current *Digest
+}
+
+func newDigestOf(day time.Time) *Digest {
+	return &Digest{Day: day, Channels: make(map[string]*ChannelDigest)}
+}
+
+// observe adds a stored moderation to the digest of the day of `now`. The
+// digest of the previous day, if not collected yet, is returned
+func (d *digest) observe(msg *message.Message, now time.Time) (prev *Digest) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if day := now.UTC().Truncate(24 * time.Hour); !day.Equal(d.current.Day) {
+		prev, d.current = d.current, newDigestOf(day)
+	}
+	ch := strings.ToLower(msg.Channel)
+	cd, ok := d.current.Channels[ch]
+	if !ok {
+		cd = &ChannelDigest{
+			Moderations:  make(map[message.MessageType]int),
+			TimeToAction: metrics.NewHistogram(TimeToActionBuckets),
+		}
+		d.current.Channels[ch] = cd
+	}
+	cd.Moderations[msg.Type]++
+	if tta, ok := msg.TimeToAction(); ok && !msg.SharedSession {
+		cd.TimeToAction.Observe(tta.Seconds())
+	}
+	return prev
+}
+
+// rotate returns the digest of the day before `now` and starts the one of the
+// day of `now`. It returns nil if the day of `now` was already started
+func (d *digest) rotate(now time.Time) *Digest {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	day := now.UTC().Truncate(24 * time.Hour)
+	if day.Equal(d.current.Day) {
+		return nil
+	}
+	prev := d.current
+	d.current = newDigestOf(day)
+	return prev
+}
+
+// Start closes the digest at the end of every UTC day until ctx is done,
+// calling send with it
+func (d *digest) Start(ctx context.Context, send func(*Digest)) {
+	for {
+		now := time.Now().UTC()
+		next := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+		select {
+		case <-time.After(next.Sub(now)):
+		case <-ctx.Done():
+			return
+		}
+		if prev := d.rotate(time.Now()); prev != nil {
+			send(prev)
+		}
+	}
+}
+
+// newDigest returns nil if the daily digest is disabled
+func newDigest() *digest {
+	if !cfg.DailyDigest {
+		return nil
+	}
+	return &digest{current: newDigestOf(time.Now().UTC().Truncate(24 * time.Hour))}
+}
+
+// observeDigest adds a stored moderation to the daily digest
+func (s *Storage) observeDigest(msg *message.Message) {
+	if prev := s.digest.observe(msg, s.clock.Now()); prev != nil {
+		s.sendDigest(prev)
+	}
+}
+
+// sendDigest logs the digest as a single JSON line, so it can be picked up by
+// log collectors, and sends it to the notifiers of its channels and tenants
+func (s *Storage) sendDigest(d *Digest) {
+	s.notifyDigest(d)
+	data, err := json.Marshal(d)
+	if err != nil {
+		errors.WrapAndLog(err)
+		return
+	}
+	log.Printf("daily digest: %s", data)
+}
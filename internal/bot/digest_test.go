@@ -0,0 +1,61 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestDigest(t *testing.T) {
+	t.Parallel()
+	day := time.Date(2023, 7, 19, 0, 0, 0, 0, time.UTC)
+	d := &digest{current: newDigestOf(day)}
+	moderation := func(channel string, typ message.MessageType, tta time.Duration) *message.Message {
+		at := day.Add(time.Hour)
+		msg := &message.Message{Channel: channel, Type: typ, At: at}
+		if tta > 0 {
+			msg.LastMessages = []*message.PrivateMessage{{At: at.Add(-tta)}}
+		}
+		return msg
+	}
+
+	for _, msg := range []*message.Message{
+		moderation("foo", message.MessageBan, 3*time.Second),
+		moderation("Foo", message.MessageTimeout, 20*time.Second),
+		moderation("foo", message.MessageBan, 0),
+		moderation("bar", message.MessageBan, time.Hour),
+	} {
+		if prev := d.observe(msg, day.Add(time.Hour)); prev != nil {
+			t.Fatalf("got: %v, want: %v", prev, nil)
+		}
+	}
+
+	foo := d.current.Channels["foo"]
+	if got, want := foo.Moderations[message.MessageBan], 2; got != want {
+		t.Errorf("bans got: %d, want: %d", got, want)
+	}
+	if got, want := foo.TimeToAction.Count, uint64(2); got != want {
+		t.Errorf("times to action got: %d, want: %d", got, want)
+	}
+	// 3s is in the bucket of 5s and 20s in the one of 30s
+	if got, want := foo.TimeToAction.Counts, []uint64{0, 0, 0, 1, 0, 1, 0, 0, 0, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("buckets got: %v, want: %v", got, want)
+	}
+	// over the last bucket, only counted in the total
+	if got := d.current.Channels["bar"].TimeToAction; got.Count != 1 || !reflect.DeepEqual(got.Counts, make([]uint64, len(TimeToActionBuckets))) {
+		t.Errorf("got: %+v, want: %d over the buckets", got, 1)
+	}
+
+	if prev := d.rotate(day.Add(2 * time.Hour)); prev != nil {
+		t.Fatalf("got: %v, want: %v", prev, nil)
+	}
+	prev := d.observe(moderation("foo", message.MessageBan, 0), day.Add(25*time.Hour))
+	if prev == nil || !prev.Day.Equal(day) || len(prev.Channels) != 2 {
+		t.Fatalf("got: %+v, want: the digest of %s", prev, day)
+	}
+	if prev := d.rotate(day.Add(26 * time.Hour)); prev != nil {
+		t.Fatalf("got: %v, want: %v", prev, nil)
+	}
+}
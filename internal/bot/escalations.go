@@ -0,0 +1,110 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// TagEscalation is the tag of the bans that end an escalation of the user in
+// the channel, a deletion followed by a timeout and then the ban within the
+// escalation window, see cfg.EscalationWindowMinutes
+const TagEscalation = "escalation"
+
+// escalationStep is a moderation of the timeline of a user in a channel
+type escalationStep struct {
+	typ message.MessageType
+	at  time.Time
+}
+
+// escalations keeps the recent deletions and timeouts of every user in every
+// channel, to tell the bans of users in genuine trouble from drive-by bans. It
+// is safe for concurrent use.
+type escalations struct {
+	window time.Duration
+
+	mu sync.Mutex
+	// recent are the deletions and timeouts within the window by channel and
+	// user, oldest first
+	recent map[string][]escalationStep
+}
+
+// observe records the moderation msg in the timeline of its user, and returns
+// the times of the deletion and the timeout that escalated to it if it is a
+// ban that ends an escalation, nil otherwise
+func (e *escalations) observe(msg *message.Message) []time.Time {
+	if msg.Type != message.MessageDeletion && msg.Type != message.MessageTimeout && msg.Type != message.MessageBan {
+		return nil
+	}
+	key := banKey(msg.Channel, msg.Username)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	steps := e.prune(e.recent[key], msg.At)
+	if msg.Type != message.MessageBan {
+		e.recent[key] = append(steps, escalationStep{msg.Type, msg.At})
+		return nil
+	}
+	// the ban ends the timeline of the user, an escalation is only tagged once
+	delete(e.recent, key)
+	var deletion *escalationStep
+	for i := range steps {
+		switch step := &steps[i]; {
+		case step.typ == message.MessageDeletion && deletion == nil:
+			deletion = step
+		case step.typ == message.MessageTimeout && deletion != nil:
+			return []time.Time{deletion.at, step.at}
+		}
+	}
+	return nil
+}
+
+// prune returns the steps within the window before `now`
+func (e *escalations) prune(steps []escalationStep, now time.Time) []escalationStep {
+	i := 0
+	for i < len(steps) && now.Sub(steps[i].at) > e.window {
+		i++
+	}
+	return steps[i:]
+}
+
+// sweep forgets the timelines of the users with no moderation within the
+// window
+func (e *escalations) sweep(now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for key, steps := range e.recent {
+		if steps = e.prune(steps, now); len(steps) == 0 {
+			delete(e.recent, key)
+		} else {
+			e.recent[key] = steps
+		}
+	}
+}
+
+// Start sweeps the timelines every window until ctx is done
+func (e *escalations) Start(ctx context.Context) {
+	t := time.NewTicker(e.window)
+	defer t.Stop()
+	for {
+		select {
+		case now := <-t.C:
+			e.sweep(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// newEscalations returns nil if the escalations are not tagged
+func newEscalations() *escalations {
+	if cfg.EscalationWindowMinutes <= 0 {
+		return nil
+	}
+	return &escalations{
+		window: time.Duration(cfg.EscalationWindowMinutes) * time.Minute,
+		recent: make(map[string][]escalationStep),
+	}
+}
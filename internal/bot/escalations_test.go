@@ -0,0 +1,83 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestEscalationsObserve(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	deletion := &message.Message{Type: message.MessageDeletion, Channel: "foo", Username: "bar", At: now.Add(-20 * time.Minute)}
+	timeout := &message.Message{Type: message.MessageTimeout, Channel: "foo", Username: "bar", At: now.Add(-10 * time.Minute)}
+	ban := &message.Message{Type: message.MessageBan, Channel: "foo", Username: "bar", At: now}
+	otherChannel := &message.Message{Type: message.MessageTimeout, Channel: "baz", Username: "bar", At: now.Add(-10 * time.Minute)}
+	oldDeletion := &message.Message{Type: message.MessageDeletion, Channel: "foo", Username: "bar", At: now.Add(-2 * time.Hour)}
+	tests := []struct {
+		name string
+		msgs []*message.Message
+		want []time.Time
+	}{
+		{"escalation", []*message.Message{deletion, timeout, ban}, []time.Time{deletion.At, timeout.At}},
+		{"drive-by", []*message.Message{ban}, nil},
+		{"out of order", []*message.Message{timeout, deletion, ban}, nil},
+		{"other channel", []*message.Message{deletion, otherChannel, ban}, nil},
+		{"outside the window", []*message.Message{oldDeletion, timeout, ban}, nil},
+	}
+	for _, tt := range tests {
+		e := &escalations{window: time.Hour, recent: make(map[string][]escalationStep)}
+		var got []time.Time
+		for _, msg := range tt.msgs {
+			got = e.observe(msg)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s got: %v, want: %v", tt.name, got, tt.want)
+		}
+	}
+
+	// an escalation is only tagged once
+	e := &escalations{window: time.Hour, recent: make(map[string][]escalationStep)}
+	for _, msg := range []*message.Message{deletion, timeout, ban} {
+		e.observe(msg)
+	}
+	if got := e.observe(ban); got != nil {
+		t.Errorf("got: %v, want: %v", got, nil)
+	}
+}
+
+func TestEscalationsTracked(t *testing.T) {
+	t.Parallel()
+	sto := NewStorage(NewMemoryStorage(10))
+	defer sto.Stop()
+	sto.escalations = &escalations{window: time.Hour, recent: make(map[string][]escalationStep)}
+	trackLines(t, sto,
+		`@id=1;room-id=1;tmi-sent-ts=1700000000000;user-id=42 :bar!bar@bar.tmi.twitch.tv PRIVMSG #foo :hello`,
+		`@login=bar;room-id=;target-msg-id=1;tmi-sent-ts=1700000010000 :tmi.twitch.tv CLEARMSG #foo :hello`,
+		`@id=2;room-id=1;tmi-sent-ts=1700000020000;user-id=42 :bar!bar@bar.tmi.twitch.tv PRIVMSG #foo :hello again`,
+		// dropped by MinTimeoutDuration, but still a step of the escalation
+		`@ban-duration=1;room-id=1;target-user-id=42;tmi-sent-ts=1700000030000 :tmi.twitch.tv CLEARCHAT #foo :bar`,
+		`@room-id=1;target-user-id=42;tmi-sent-ts=1700000050000 :tmi.twitch.tv CLEARCHAT #foo :bar`,
+	)
+	mods, err := sto.UserModerations("bar", "foo", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []message.MessageType
+	for _, m := range mods {
+		types = append(types, m.Type)
+	}
+	if want := []message.MessageType{message.MessageBan, message.MessageDeletion}; !reflect.DeepEqual(types, want) {
+		t.Fatalf("got: %v, want: %v", types, want)
+	}
+	ban := mods[0]
+	want := []time.Time{time.UnixMilli(1700000010000), time.UnixMilli(1700000030000)}
+	if len(ban.EscalatedFrom) != 2 || !ban.EscalatedFrom[0].Equal(want[0]) || !ban.EscalatedFrom[1].Equal(want[1]) {
+		t.Errorf("got: %v, want: %v", ban.EscalatedFrom, want)
+	}
+	if !reflect.DeepEqual(ban.Tags, []string{TagEscalation}) {
+		t.Errorf("got: %v, want: %v", ban.Tags, []string{TagEscalation})
+	}
+}
@@ -0,0 +1,94 @@
+package bot
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// EventLogStream is the "stream" field of every line of the event log, so the
+// lines can be told apart from the logs written to the same output
+const EventLogStream = "moderations"
+
+// eventLine is a line of the event log, the event of a stored moderation
+// with the fields that locate it in the log stream
+type eventLine struct {
+	Stream string    `json:"stream"`
+	TS     time.Time `json:"ts"`
+	event
+	// MessageCount is the number of related messages, also when their bodies
+	// are left out
+	MessageCount int `json:"message_count"`
+}
+
+// eventLog writes the stored moderations as JSON lines. It is safe for
+// concurrent use
+type eventLog struct {
+	// messages is whether the lines include the bodies of the messages
+	messages bool
+
+	mu sync.Mutex
+	w  io.Writer
+	// f is nil if the lines are written to stdout
+	f *os.File
+}
+
+// write writes the line of the moderation stored at `now`
+func (l *eventLog) write(msg *message.Message, now time.Time) error {
+	line := &eventLine{
+		Stream:       EventLogStream,
+		TS:           now,
+		event:        *newEvent(msg),
+		MessageCount: len(msg.LastMessages),
+	}
+	if !l.messages {
+		line.Messages = nil
+	}
+	b, err := json.Marshal(line)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// a single write, so the line is not interleaved with the logs
+	if _, err := l.w.Write(append(b, '\n')); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+func (l *eventLog) Close() error {
+	if l.f == nil {
+		return nil
+	}
+	return l.f.Close()
+}
+
+// newEventLog returns nil if the event log is disabled
+func newEventLog() *eventLog {
+	switch cfg.EventLog {
+	case "":
+		return nil
+	case "stdout":
+		return &eventLog{messages: cfg.EventLogMessages, w: os.Stdout}
+	}
+	f, err := os.OpenFile(cfg.EventLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		errors.WrapFatalWithContext(err, struct{ EventLog string }{cfg.EventLog})
+	}
+	return &eventLog{messages: cfg.EventLogMessages, w: f, f: f}
+}
+
+// logEvent writes the stored moderation to the event log
+func (s *Storage) logEvent(msg *message.Message) {
+	if err := s.eventLog.write(msg, s.clock.Now()); err != nil {
+		storageErrors.Inc("event_log")
+		errors.WrapAndLog(err)
+	}
+}
@@ -0,0 +1,72 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestEventLog(t *testing.T) {
+	t.Parallel()
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	msg := &message.Message{
+		Type:         message.MessageBan,
+		Channel:      "channel",
+		Username:     "user",
+		Moderator:    "mod",
+		At:           at,
+		Tags:         []string{"spam"},
+		LastMessages: []*message.PrivateMessage{{Username: "user", Body: "hello", At: at}, {Username: "user", Body: "world", At: at}},
+	}
+	tests := []struct {
+		name     string
+		messages bool
+		want     int
+	}{
+		{name: "without messages", want: 0},
+		{name: "with messages", messages: true, want: 2},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			l := &eventLog{messages: tt.messages, w: &buf}
+			if err := l.write(msg, at.Add(time.Second)); err != nil {
+				t.Fatal(err)
+			}
+			if err := l.write(msg, at.Add(time.Second)); err != nil {
+				t.Fatal(err)
+			}
+			lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+			if len(lines) != 2 {
+				t.Fatalf("got: %v lines, want: %v", len(lines), 2)
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal(lines[0], &got); err != nil {
+				t.Fatal(err)
+			}
+			for field, want := range map[string]interface{}{
+				"stream":        EventLogStream,
+				"ts":            "2024-01-02T03:04:06Z",
+				"v":             float64(EventSchema),
+				"type":          "ban",
+				"channel":       "channel",
+				"username":      "user",
+				"moderator":     "mod",
+				"message_count": float64(2),
+			} {
+				if got[field] != want {
+					t.Errorf("%s got: %v, want: %v", field, got[field], want)
+				}
+			}
+			msgs, _ := got["messages"].([]interface{})
+			if len(msgs) != tt.want {
+				t.Errorf("got: %v messages, want: %v", len(msgs), tt.want)
+			}
+		})
+	}
+}
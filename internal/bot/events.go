@@ -0,0 +1,165 @@
+package bot
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// EventSchema is the version of the schema of the moderations serialized by
+// the tracker, e.g. in the outbox. Bump it and add a shim to eventShims
+// decoding the previous version whenever the schema changes in a way older
+// trackers can't read
+const EventSchema = 2
+
+// ErrEventSchema is an event written with a schema newer than EventSchema, by
+// a newer tracker. It is kept as is for the tracker that wrote it
+var ErrEventSchema = errors.New("event written with a newer schema")
+
+// event is a moderation serialized with the EventSchema
+type event struct {
+	// V is the version of the schema, missing in the first one
+	V         int                 `json:"v"`
+	Type      message.MessageType `json:"type"`
+	Channel   string              `json:"channel"`
+	ChannelID string              `json:"channel_id,omitempty"`
+	Username  string              `json:"username"`
+	UserID    string              `json:"user_id,omitempty"`
+	At        time.Time           `json:"at"`
+	Duration  int                 `json:"duration,omitempty"`
+	Moderator string              `json:"moderator,omitempty"`
+	Reason    string              `json:"reason,omitempty"`
+	Messages  []*eventMessage     `json:"messages,omitempty"`
+	Toxicity  *float64            `json:"toxicity,omitempty"`
+	Tags      []string            `json:"tags,omitempty"`
+	Channels  []string            `json:"channels,omitempty"`
+	Region    string              `json:"region,omitempty"`
+	Instance  string              `json:"instance,omitempty"`
+}
+
+type eventMessage struct {
+	Body   string    `json:"body"`
+	UserID string    `json:"user_id,omitempty"`
+	At     time.Time `json:"at,omitempty"`
+}
+
+// eventV1 is the first schema, with the bodies of the messages only
+type eventV1 struct {
+	Channel  string              `json:"channel"`
+	Username string              `json:"username"`
+	Type     message.MessageType `json:"type"`
+	At       time.Time           `json:"at"`
+	Duration int                 `json:"duration,omitempty"`
+	Messages []string            `json:"messages,omitempty"`
+	Toxicity *float64            `json:"toxicity,omitempty"`
+	Tags     []string            `json:"tags,omitempty"`
+}
+
+// eventShims decode the events of every previous schema by version. Shims
+// are never removed, the events of any version may still be replayed
+var eventShims = map[int]func(b []byte) (*event, error){
+	1: func(b []byte) (*event, error) {
+		var v1 eventV1
+		if err := json.Unmarshal(b, &v1); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		ev := &event{
+			V:        1,
+			Type:     v1.Type,
+			Channel:  v1.Channel,
+			Username: v1.Username,
+			At:       v1.At,
+			Duration: v1.Duration,
+			Toxicity: v1.Toxicity,
+			Tags:     v1.Tags,
+		}
+		for _, body := range v1.Messages {
+			ev.Messages = append(ev.Messages, &eventMessage{Body: body})
+		}
+		return ev, nil
+	},
+}
+
+// encodeEvent serializes the moderation with the EventSchema
+func encodeEvent(msg *message.Message) ([]byte, error) {
+	b, err := json.Marshal(newEvent(msg))
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return b, nil
+}
+
+// newEvent returns the event of the moderation with the EventSchema
+func newEvent(msg *message.Message) *event {
+	ev := &event{
+		V:         EventSchema,
+		Type:      msg.Type,
+		Channel:   msg.Channel,
+		ChannelID: msg.ChannelID,
+		Username:  msg.Username,
+		UserID:    msg.UserID,
+		At:        msg.At,
+		Duration:  msg.Duration,
+		Moderator: msg.Moderator,
+		Reason:    msg.Reason,
+		Toxicity:  msg.Toxicity,
+		Tags:      msg.Tags,
+		Channels:  msg.Channels,
+		Region:    msg.Region,
+		Instance:  msg.Instance,
+	}
+	for _, privmsg := range msg.LastMessages {
+		ev.Messages = append(ev.Messages, &eventMessage{Body: privmsg.Body, UserID: privmsg.UserID, At: privmsg.At})
+	}
+	return ev
+}
+
+// decodeEvent returns the moderation of an event of any schema up to
+// EventSchema, or ErrEventSchema
+func decodeEvent(b []byte) (*message.Message, error) {
+	var version struct {
+		V int `json:"v"`
+	}
+	if err := json.Unmarshal(b, &version); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if version.V == 0 {
+		version.V = 1
+	}
+	if version.V > EventSchema {
+		return nil, errors.WrapWithContext(ErrEventSchema, struct{ Version int }{version.V})
+	}
+
+	ev := new(event)
+	if shim, ok := eventShims[version.V]; ok {
+		var err error
+		if ev, err = shim(b); err != nil {
+			return nil, err
+		}
+	} else if err := json.Unmarshal(b, ev); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	msg := &message.Message{
+		Type:         ev.Type,
+		Channel:      ev.Channel,
+		ChannelID:    ev.ChannelID,
+		Username:     ev.Username,
+		UserID:       ev.UserID,
+		At:           ev.At,
+		Duration:     ev.Duration,
+		Moderator:    ev.Moderator,
+		Reason:       ev.Reason,
+		Toxicity:     ev.Toxicity,
+		Tags:         ev.Tags,
+		Channels:     ev.Channels,
+		Region:       ev.Region,
+		Instance:     ev.Instance,
+		LastMessages: make([]*message.PrivateMessage, len(ev.Messages)),
+	}
+	for i, m := range ev.Messages {
+		msg.LastMessages[i] = &message.PrivateMessage{Username: ev.Username, UserID: m.UserID, Body: m.Body, At: m.At}
+	}
+	return msg, nil
+}
@@ -0,0 +1,77 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestDecodeEvent(t *testing.T) {
+	t.Parallel()
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	current, err := encodeEvent(&message.Message{
+		Type:         message.MessageBan,
+		Channel:      "channel",
+		Username:     "user",
+		UserID:       "1",
+		Moderator:    "mod",
+		Region:       "eu",
+		Instance:     "tracker-eu-1",
+		At:           at,
+		LastMessages: []*message.PrivateMessage{{Username: "user", UserID: "1", Body: "hello", At: at}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		event     string
+		err       error
+		moderator string
+		region    string
+		instance  string
+		body      string
+	}{
+		{
+			name:  "v1",
+			event: `{"channel":"channel","username":"user","type":"ban","at":"2024-01-02T03:04:05Z","messages":["hello"]}`,
+			body:  "hello",
+		},
+		{name: "current", event: string(current), moderator: "mod", region: "eu", instance: "tracker-eu-1", body: "hello"},
+		{name: "newer", event: `{"v":1000,"channel":"channel"}`, err: ErrEventSchema},
+		{name: "invalid", event: `{"v":"2"}`, err: errors.New("invalid")},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			msg, err := decodeEvent([]byte(tt.event))
+			if tt.err != nil {
+				if err == nil || (tt.err == ErrEventSchema && !errors.Is(err, ErrEventSchema)) {
+					t.Fatalf("got: %v, want: %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.Type != message.MessageBan || msg.Username != "user" || !msg.At.Equal(at) {
+				t.Fatalf("got: %+v, want: the ban of user at %v", msg, at)
+			}
+			if msg.Moderator != tt.moderator {
+				t.Fatalf("moderator got: %q, want: %q", msg.Moderator, tt.moderator)
+			}
+			if msg.Region != tt.region {
+				t.Fatalf("region got: %q, want: %q", msg.Region, tt.region)
+			}
+			if msg.Instance != tt.instance {
+				t.Fatalf("instance got: %q, want: %q", msg.Instance, tt.instance)
+			}
+			if len(msg.LastMessages) != 1 || msg.LastMessages[0].Body != tt.body {
+				t.Fatalf("messages got: %v, want: %q", msg.LastMessages, tt.body)
+			}
+		})
+	}
+}
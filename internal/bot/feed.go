@@ -0,0 +1,344 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/message"
+	"github.com/hammertrack/tracker/internal/webhook"
+)
+
+const (
+	// BanFeedRefresh is the interval at which the webhooks subscribed to the
+	// ban feeds are reloaded
+	BanFeedRefresh = time.Minute
+	// BanFeedQueue is the maximum number of pending webhook deliveries
+	BanFeedQueue = 1000
+	// BanFeedTimeout is the maximum time of every webhook request
+	BanFeedTimeout = 5 * time.Second
+)
+
+var (
+	ErrSharingDisabled      = errors.New("the channel does not share its bans")
+	ErrNotChannelOwner      = errors.New("the channel does not belong to the tenant")
+	ErrSubscriptionNotFound = errors.New("ban feed subscription not found")
+	ErrInvalidWebhookURL    = errors.New("invalid webhook URL, expected an absolute https URL of a public host")
+)
+
+// SharedBan is an entry of the ban feed of a channel. Only permanent bans are
+// shared, without the messages of the user
+type SharedBan struct {
+	Channel  string    `json:"channel"`
+	Username string    `json:"username"`
+	At       time.Time `json:"at"`
+	Tags     []string  `json:"tags,omitempty"`
+}
+
+// FeedSubscription is a webhook of a tenant subscribed to the ban feed of a
+// channel. Every delivery is signed with its secret, see package webhook
+type FeedSubscription struct {
+	ID        string    `json:"id"`
+	Channel   string    `json:"channel"`
+	TenantID  string    `json:"tenant_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BanFeedStore is implemented by drivers that can store the consent of the
+// channels to share their bans and the webhooks subscribed to them.
+type BanFeedStore interface {
+	SetBanSharing(ch Channel, enabled bool) error
+	BanSharing(ch Channel) (bool, error)
+	CreateFeedSubscription(sub *FeedSubscription) error
+	// FeedSubscription returns ErrSubscriptionNotFound if it does not exist
+	FeedSubscription(ch Channel, id string) (*FeedSubscription, error)
+	DeleteFeedSubscription(ch Channel, id string) error
+	// SharedFeeds returns the subscriptions of every channel sharing its bans
+	SharedFeeds() (map[Channel][]*FeedSubscription, error)
+}
+
+func (s *Storage) banFeeds() (BanFeedStore, error) {
+	f, ok := s.driver.(BanFeedStore)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return f, nil
+}
+
+// owns returns ErrNotChannelOwner if the channel does not belong to the tenant
+func (s *Storage) owns(tenantID string, ch Channel) error {
+	chs, err := s.TenantChannels(tenantID)
+	if err != nil {
+		return err
+	}
+	for _, tch := range chs {
+		if tch == ch {
+			return nil
+		}
+	}
+	return ErrNotChannelOwner
+}
+
+// SetBanSharing gives or withdraws the consent of a channel of the tenant to
+// share its bans with the partner channels
+func (s *Storage) SetBanSharing(tenantID string, ch Channel, enabled bool, actor string) error {
+	f, err := s.banFeeds()
+	if err != nil {
+		return err
+	}
+	ch = Channel(strings.ToLower(string(ch)))
+	if err := s.owns(tenantID, ch); err != nil {
+		return err
+	}
+	if err := f.SetBanSharing(ch, enabled); err != nil {
+		return err
+	}
+	action := "ban-sharing-disable"
+	if enabled {
+		action = "ban-sharing-enable"
+	}
+	s.auditTenant(action, actor, string(ch))
+	return nil
+}
+
+// SharedBans returns the most recent permanent bans of a channel sharing its
+// bans since `since`
+func (s *Storage) SharedBans(ch Channel, since time.Time, limit int) ([]*SharedBan, error) {
+	f, err := s.banFeeds()
+	if err != nil {
+		return nil, err
+	}
+	ch = Channel(strings.ToLower(string(ch)))
+	if enabled, err := f.BanSharing(ch); err != nil {
+		return nil, err
+	} else if !enabled {
+		return nil, ErrSharingDisabled
+	}
+	var bans []*SharedBan
+	if err := s.ChannelModerations(ch, since, s.clock.Now(), func(m *Moderation) error {
+		if m.Type == message.MessageBan {
+			bans = append(bans, &SharedBan{Channel: m.Channel, Username: m.Username, At: m.At, Tags: m.Tags})
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].At.After(bans[j].At)
+	})
+	if len(bans) > limit {
+		bans = bans[:limit]
+	}
+	return bans, nil
+}
+
+// SubscribeBanFeed subscribes a webhook of the tenant to the ban feed of a
+// channel. The returned subscription has the secret used to sign the
+// deliveries, it cannot be retrieved again
+func (s *Storage) SubscribeBanFeed(tenantID string, ch Channel, webhookURL, actor string) (*FeedSubscription, error) {
+	f, err := s.banFeeds()
+	if err != nil {
+		return nil, err
+	}
+	if err := validWebhookURL(webhookURL); err != nil {
+		return nil, err
+	}
+	ch = Channel(strings.ToLower(string(ch)))
+	if enabled, err := f.BanSharing(ch); err != nil {
+		return nil, err
+	} else if !enabled {
+		return nil, ErrSharingDisabled
+	}
+	id, err := randomHex(6)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return nil, err
+	}
+	sub := &FeedSubscription{
+		ID:        id,
+		Channel:   string(ch),
+		TenantID:  strings.ToLower(tenantID),
+		URL:       webhookURL,
+		Secret:    secret,
+		CreatedAt: s.clock.Now(),
+	}
+	if err := f.CreateFeedSubscription(sub); err != nil {
+		return nil, err
+	}
+	if s.feed != nil {
+		s.feed.add(sub)
+	}
+	s.auditTenant("ban-feed-subscribe", actor, string(ch)+"/"+id)
+	return sub, nil
+}
+
+// validWebhookURL returns ErrInvalidWebhookURL if the URL cannot receive
+// webhooks. See webhook.ValidateURL
+func validWebhookURL(webhookURL string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), BanFeedTimeout)
+	defer cancel()
+	if err := webhook.ValidateURL(ctx, webhookURL); err != nil {
+		errors.WrapAndLogWithContext(err, struct{ URL string }{webhookURL})
+		return ErrInvalidWebhookURL
+	}
+	return nil
+}
+
+// UnsubscribeBanFeed removes a subscription of the tenant
+func (s *Storage) UnsubscribeBanFeed(tenantID string, ch Channel, id, actor string) error {
+	f, err := s.banFeeds()
+	if err != nil {
+		return err
+	}
+	ch = Channel(strings.ToLower(string(ch)))
+	sub, err := f.FeedSubscription(ch, id)
+	if err != nil {
+		return err
+	}
+	if sub.TenantID != strings.ToLower(tenantID) {
+		return ErrSubscriptionNotFound
+	}
+	if err := f.DeleteFeedSubscription(ch, id); err != nil {
+		return err
+	}
+	if s.feed != nil {
+		s.feed.remove(sub)
+	}
+	s.auditTenant("ban-feed-unsubscribe", actor, string(ch)+"/"+id)
+	return nil
+}
+
+// shareBan delivers a stored permanent ban to the webhooks subscribed to the
+// ban feed of its channel. The backfilled bans are never published to the
+// stored topic, and the user clears of EventSub are not bans, see
+// message.MessageUserClear
+func (s *Storage) shareBan(msg *message.Message) {
+	enqueueDeliveries(s.banDeliveries(msg))
+}
+
+// banDeliveries returns the deliveries of a stored moderation to the webhooks
+// subscribed to the ban feed of its channel, none if it is not a permanent ban
+func (s *Storage) banDeliveries(msg *message.Message) []*queuedDelivery {
+	if s.feed == nil || msg.Type != message.MessageBan {
+		return nil
+	}
+	subs := s.feed.subscriptions(msg.Channel)
+	if len(subs) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(&SharedBan{Channel: msg.Channel, Username: msg.Username, At: msg.At, Tags: msg.Tags})
+	if err != nil {
+		errors.WrapAndLog(err)
+		return nil
+	}
+	dels := make([]*queuedDelivery, len(subs))
+	for i, sub := range subs {
+		dels[i] = &queuedDelivery{
+			Delivery:   &webhook.Delivery{URL: sub.URL, Secret: sub.Secret, Body: body},
+			dispatcher: s.feed.dispatcher,
+			hook:       sub.ID,
+		}
+	}
+	return dels
+}
+
+// banFeed keeps in memory the webhooks subscribed to the channels sharing
+// their bans, so shareBan does not hit the database
+type banFeed struct {
+	load       func() (map[Channel][]*FeedSubscription, error)
+	dispatcher *webhook.Dispatcher
+
+	mu   sync.RWMutex
+	subs map[Channel][]*FeedSubscription
+}
+
+func (f *banFeed) subscriptions(ch string) []*FeedSubscription {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.subs[Channel(ch)]
+}
+
+func (f *banFeed) add(sub *FeedSubscription) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// copied, the previous slice may be in use by shareBan
+	ch := Channel(sub.Channel)
+	subs := make([]*FeedSubscription, len(f.subs[ch]), len(f.subs[ch])+1)
+	copy(subs, f.subs[ch])
+	f.subs[ch] = append(subs, sub)
+}
+
+func (f *banFeed) remove(sub *FeedSubscription) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := Channel(sub.Channel)
+	kept := make([]*FeedSubscription, 0, len(f.subs[ch]))
+	for _, s := range f.subs[ch] {
+		if s.ID != sub.ID {
+			kept = append(kept, s)
+		}
+	}
+	f.subs[ch] = kept
+}
+
+func (f *banFeed) refresh() {
+	subs, err := f.load()
+	if err != nil {
+		if !errors.Is(err, ErrUnsupported) {
+			errors.WrapAndLog(err)
+		}
+		return
+	}
+	f.mu.Lock()
+	f.subs = subs
+	f.mu.Unlock()
+}
+
+// Start delivers the shared bans and reloads the subscriptions periodically
+// until ctx is done
+func (f *banFeed) Start(ctx context.Context) {
+	go f.dispatcher.Start(ctx)
+	t := time.NewTicker(BanFeedRefresh)
+	defer t.Stop()
+	for {
+		f.refresh()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// newBanFeed creates the delivery of the ban feeds from the configuration. It
+// returns nil if the webhooks are disabled. The feeds are still readable from
+// the API
+func newBanFeed(load func() (map[Channel][]*FeedSubscription, error)) *banFeed {
+	if !cfg.BanFeedWebhooks {
+		return nil
+	}
+	return &banFeed{
+		load:       load,
+		dispatcher: webhook.New(cfg.BanFeedWorkers, BanFeedQueue, BanFeedTimeout),
+		subs:       make(map[Channel][]*FeedSubscription),
+	}
+}
+
+// sharedFeeds loads the subscriptions of the ban feeds. See BanFeedStore
+func (s *Storage) sharedFeeds() (map[Channel][]*FeedSubscription, error) {
+	f, err := s.banFeeds()
+	if err != nil {
+		return nil, err
+	}
+	return f.SharedFeeds()
+}
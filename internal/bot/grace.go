@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// TagReverted is the tag of the bans undone within the grace window, see
+// cfg.BanGraceSeconds
+const TagReverted = "reverted"
+
+// grace holds the bans for a while before storing them, so the bans undone
+// right away, usually misclicks, are not stored as clean bans. It is safe for
+// concurrent use.
+type grace struct {
+	window time.Duration
+	drop   bool
+
+	mu   sync.Mutex
+	held map[string]*heldBan
+}
+
+type heldBan struct {
+	msg   *message.Message
+	save  func(msg *message.Message) bool
+	timer *time.Timer
+}
+
+// hold calls save with the ban msg once the grace window is over, unless it is
+// reverted before
+func (g *grace) hold(msg *message.Message, save func(msg *message.Message) bool) {
+	key := banKey(msg.Channel, msg.Username)
+	h := &heldBan{msg: msg, save: save}
+	g.mu.Lock()
+	prev, ok := g.held[key]
+	g.held[key] = h
+	h.timer = time.AfterFunc(g.window, func() {
+		if g.release(key, h) {
+			h.save(h.msg)
+		}
+	})
+	g.mu.Unlock()
+	if ok && prev.timer.Stop() {
+		// banned twice within the window, the first ban is stored right away
+		prev.save(prev.msg)
+	}
+}
+
+// release removes h from the held bans and reports whether it was still held
+func (g *grace) release(key string, h *heldBan) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.held[key] != h {
+		return false
+	}
+	delete(g.held, key)
+	return true
+}
+
+// revert drops the held ban undone by `unban`, or stores it tagged with
+// TagReverted. It reports whether there was a held ban
+func (g *grace) revert(unban *message.Message) bool {
+	key := banKey(unban.Channel, unban.Username)
+	g.mu.Lock()
+	h, ok := g.held[key]
+	if ok {
+		delete(g.held, key)
+		ok = h.timer.Stop()
+	}
+	g.mu.Unlock()
+	if !ok {
+		return false
+	}
+	if !g.drop {
+		h.msg.Reverted = true
+		h.save(h.msg)
+	}
+	return true
+}
+
+// flush stores every held ban right away
+func (g *grace) flush() {
+	g.mu.Lock()
+	held := g.held
+	g.held = make(map[string]*heldBan)
+	g.mu.Unlock()
+	for _, h := range held {
+		if h.timer.Stop() {
+			h.save(h.msg)
+		}
+	}
+}
+
+func banKey(ch, username string) string {
+	return strings.ToLower(ch) + sep + strings.ToLower(username)
+}
+
+var ErrBanGraceSource = errors.New("the grace window of the bans requires the eventsub source, the only one with unbans")
+
+// newGrace returns nil if the grace window of the bans is disabled. With the IRC
+// source no ban would ever be reverted, only delayed, so it is rejected
+func newGrace() *grace {
+	if cfg.BanGraceSeconds <= 0 {
+		return nil
+	}
+	if cfg.Source != SourceEventSub {
+		errors.WrapFatalWithContext(ErrBanGraceSource, struct{ Source string }{cfg.Source})
+		return nil
+	}
+	return &grace{
+		window: time.Duration(cfg.BanGraceSeconds) * time.Second,
+		drop:   cfg.BanGraceDrop,
+		held:   make(map[string]*heldBan),
+	}
+}
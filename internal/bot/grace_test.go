@@ -0,0 +1,56 @@
+package bot
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestGrace(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		drop     bool
+		unban    bool
+		saved    bool
+		reverted bool
+	}{
+		{name: "kept", saved: true},
+		{name: "reverted", unban: true, saved: true, reverted: true},
+		{name: "dropped", drop: true, unban: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			g := &grace{window: 50 * time.Millisecond, drop: tt.drop, held: make(map[string]*heldBan)}
+			var (
+				mu    sync.Mutex
+				saved []*message.Message
+			)
+			save := func(msg *message.Message) bool {
+				mu.Lock()
+				saved = append(saved, msg)
+				mu.Unlock()
+				return true
+			}
+			g.hold(&message.Message{Type: message.MessageBan, Channel: "channel", Username: "user"}, save)
+			if tt.unban {
+				if !g.revert(&message.Message{Type: message.MessageUnban, Channel: "Channel", Username: "User"}) {
+					t.Fatal("revert got: false, want: true")
+				}
+			}
+			time.Sleep(100 * time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			if got := len(saved) == 1; got != tt.saved {
+				t.Fatalf("saved got: %d, want saved: %v", len(saved), tt.saved)
+			}
+			if tt.saved && saved[0].Reverted != tt.reverted {
+				t.Fatalf("reverted got: %v, want: %v", saved[0].Reverted, tt.reverted)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/heuristics"
+	"github.com/hammertrack/tracker/internal/message"
+	"github.com/hammertrack/tracker/internal/webhook"
+)
+
+var (
+	ErrGroupNotFound = errors.New("group not found")
+	ErrBadGroups     = errors.New("bad CHANNEL_GROUPS, expected <group>=<channel>,...;...")
+	// ErrChannelGrouped is returned when a channel is in more than a group,
+	// which would make the rules of its group ambiguous
+	ErrChannelGrouped   = errors.New("channel in more than a group")
+	ErrBadGroupSettings = errors.New("bad GROUP_RULE_PIPELINES or GROUP_WEBHOOKS, expected settings of the groups of CHANNEL_GROUPS")
+)
+
+// Group is a named group of channels defined by the operator, e.g. the
+// channels of a network. The groups have aggregated stats, their own rules and
+// their own webhooks, see cfg.ChannelGroups
+type Group struct {
+	Name     string    `json:"name"`
+	Channels []Channel `json:"channels"`
+	// Rules is the pipelines of the heuristics of the group as in
+	// cfg.GroupRulePipelines, empty if the group uses the rules of every
+	// channel
+	Rules string `json:"rules,omitempty"`
+	// Webhooks is the number of webhooks of the group, their urls are not
+	// exposed
+	Webhooks int `json:"webhooks"`
+}
+
+// GroupModeration is a moderation delivered to the webhooks of the group of
+// its channel
+type GroupModeration struct {
+	Group    string    `json:"group"`
+	Channel  string    `json:"channel"`
+	Username string    `json:"username"`
+	Type     string    `json:"type"`
+	At       time.Time `json:"at"`
+	Duration int       `json:"duration,omitempty"`
+	Messages []string  `json:"messages"`
+	Toxicity *float64  `json:"toxicity,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+}
+
+// groups are the groups of channels of the configuration. They don't change
+// once created, so they are safe for concurrent use
+type groups struct {
+	byName    map[string]*Group
+	byChannel map[Channel]*Group
+	// analyzers are the heuristics of the groups with their own rules
+	analyzers map[string]*heuristics.Pipelines
+	webhooks  map[string][]string
+	// dispatcher is nil if no group has webhooks
+	dispatcher *webhook.Dispatcher
+}
+
+// parseGroupList parses a list of "<group>=<values>" separated by `sep`, with
+// the values of every group as they are
+func parseGroupList(list, sep string, bad error) (map[string]string, error) {
+	byGroup := make(map[string]string)
+	for _, entry := range strings.Split(list, sep) {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, values, ok := strings.Cut(entry, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || name == "" {
+			return nil, errors.WrapWithContext(bad, struct{ Entry string }{entry})
+		}
+		byGroup[name] = values
+	}
+	return byGroup, nil
+}
+
+// parseGroups returns the channels of every group of a list of
+// CHANNEL_GROUPS
+func parseGroups(list string) (map[string][]Channel, error) {
+	lists, err := parseGroupList(list, ";", ErrBadGroups)
+	if err != nil {
+		return nil, err
+	}
+	byGroup := make(map[string][]Channel, len(lists))
+	seen := make(map[Channel]string)
+	for name, chs := range lists {
+		for _, ch := range strings.Split(chs, ",") {
+			ch = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ch), "#"))
+			if ch == "" {
+				continue
+			}
+			if other, ok := seen[Channel(ch)]; ok {
+				return nil, errors.WrapWithContext(ErrChannelGrouped, struct{ Channel, Group, Other string }{ch, name, other})
+			}
+			seen[Channel(ch)] = name
+			byGroup[name] = append(byGroup[name], Channel(ch))
+		}
+		if len(byGroup[name]) == 0 {
+			return nil, errors.WrapWithContext(ErrBadGroups, struct{ Group string }{name})
+		}
+		sort.Slice(byGroup[name], func(i, j int) bool { return byGroup[name][i] < byGroup[name][j] })
+	}
+	return byGroup, nil
+}
+
+// parseGroupPipelines returns the pipelines of every group of a list of
+// GROUP_RULE_PIPELINES, which are separated by "|" because the pipelines are
+// separated by ";"
+func parseGroupPipelines(list string) (map[string]string, error) {
+	pipelines := make(map[string]string)
+	for _, entry := range strings.Split(list, "|") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, spec, ok := strings.Cut(entry, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || name == "" {
+			return nil, errors.WrapWithContext(ErrBadGroupSettings, struct{ Entry string }{entry})
+		}
+		pipelines[name] = spec
+	}
+	return pipelines, nil
+}
+
+// compile creates the heuristics of the groups with their own rules. The
+// pipelines of a group override the ones of cfg.RulePipelines, the rest of
+// types use `def`
+func (g *groups) compile(def []heuristics.Rule) error {
+	analyzers := make(map[string]*heuristics.Pipelines)
+	for name, group := range g.byName {
+		if group.Rules == "" {
+			continue
+		}
+		p, err := heuristics.ParsePipelines(cfg.RulePipelines+";"+group.Rules, PipelineRules(), def)
+		if err != nil {
+			return errors.WrapWithContext(err, struct{ Group string }{name})
+		}
+		p.Compile()
+		analyzers[name] = p
+	}
+	g.analyzers = analyzers
+	return nil
+}
+
+// of returns the group of the channel, nil if it has none
+func (g *groups) of(ch string) *Group {
+	return g.byChannel[Channel(strings.ToLower(ch))]
+}
+
+// analyzer returns the heuristics of the group of the channel, nil if it has
+// no group or its group has no rules of its own
+func (g *groups) analyzer(ch string) *heuristics.Pipelines {
+	group := g.of(ch)
+	if group == nil {
+		return nil
+	}
+	return g.analyzers[group.Name]
+}
+
+// newGroups creates the groups of the configuration. It returns nil if there
+// are no groups
+func newGroups() *groups {
+	byGroup, err := parseGroups(cfg.ChannelGroups)
+	if err != nil {
+		errors.WrapFatal(err)
+	}
+	if len(byGroup) == 0 {
+		return nil
+	}
+	pipelines, err := parseGroupPipelines(cfg.GroupRulePipelines)
+	if err != nil {
+		errors.WrapFatal(err)
+	}
+	hooks, err := parseGroupList(cfg.GroupWebhooks, ";", ErrBadGroupSettings)
+	if err != nil {
+		errors.WrapFatal(err)
+	}
+	g := &groups{
+		byName:    make(map[string]*Group, len(byGroup)),
+		byChannel: make(map[Channel]*Group),
+		webhooks:  make(map[string][]string),
+	}
+	for name, chs := range byGroup {
+		group := &Group{Name: name, Channels: chs, Rules: pipelines[name]}
+		g.byName[name] = group
+		for _, ch := range chs {
+			g.byChannel[ch] = group
+		}
+	}
+	for name := range pipelines {
+		if _, ok := g.byName[name]; !ok {
+			errors.WrapFatalWithContext(ErrBadGroupSettings, struct{ UnknownGroup string }{name})
+		}
+	}
+	for name, urls := range hooks {
+		group, ok := g.byName[name]
+		if !ok {
+			errors.WrapFatalWithContext(ErrBadGroupSettings, struct{ UnknownGroup string }{name})
+		}
+		for _, url := range strings.Split(urls, ",") {
+			if url = strings.TrimSpace(url); url != "" {
+				g.webhooks[name] = append(g.webhooks[name], url)
+			}
+		}
+		group.Webhooks = len(g.webhooks[name])
+	}
+	if len(g.webhooks) > 0 {
+		g.dispatcher = webhook.New(cfg.TenantWebhookWorkers, TenantWebhooksQueue, TenantWebhooksTimeout)
+	}
+	if err := g.compile(DefaultRules()); err != nil {
+		errors.WrapFatal(err)
+	}
+	return g
+}
+
+// Groups returns the groups of channels, sorted by name
+func (s *Storage) Groups() []*Group {
+	if s.groups == nil {
+		return nil
+	}
+	all := make([]*Group, 0, len(s.groups.byName))
+	for _, group := range s.groups.byName {
+		all = append(all, group)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// Group returns the group `name`, or ErrGroupNotFound
+func (s *Storage) Group(name string) (*Group, error) {
+	if s.groups == nil {
+		return nil, ErrGroupNotFound
+	}
+	group, ok := s.groups.byName[strings.ToLower(name)]
+	if !ok {
+		return nil, ErrGroupNotFound
+	}
+	return group, nil
+}
+
+// notifyGroup delivers a stored moderation to the webhooks of the group of its
+// channel
+func (s *Storage) notifyGroup(msg *message.Message) {
+	enqueueDeliveries(s.groupDeliveries(msg))
+}
+
+// groupDeliveries returns the deliveries of a stored moderation to the
+// webhooks of the group of its channel
+func (s *Storage) groupDeliveries(msg *message.Message) []*queuedDelivery {
+	if s.groups == nil || s.groups.dispatcher == nil {
+		return nil
+	}
+	group := s.groups.of(msg.Channel)
+	if group == nil || len(s.groups.webhooks[group.Name]) == 0 {
+		return nil
+	}
+	m := &GroupModeration{
+		Group:    group.Name,
+		Channel:  msg.Channel,
+		Username: msg.Username,
+		Type:     string(msg.Type),
+		At:       msg.At,
+		Duration: msg.Duration,
+		Messages: make([]string, len(msg.LastMessages)),
+		Toxicity: msg.Toxicity,
+		Tags:     msg.Tags,
+	}
+	for i, privmsg := range msg.LastMessages {
+		m.Messages[i] = privmsg.Body
+	}
+	body, err := json.Marshal(m)
+	if err != nil {
+		errors.WrapAndLog(err)
+		return nil
+	}
+	urls := s.groups.webhooks[group.Name]
+	dels := make([]*queuedDelivery, len(urls))
+	for i, url := range urls {
+		dels[i] = &queuedDelivery{
+			Delivery:   &webhook.Delivery{URL: url, Secret: cfg.GroupWebhookSecret, Body: body},
+			dispatcher: s.groups.dispatcher,
+			hook:       "group:" + group.Name,
+		}
+	}
+	return dels
+}
+
+// Start delivers the moderations to the webhooks of the groups until ctx
+// is done
+func (g *groups) Start(ctx context.Context) {
+	if g.dispatcher != nil {
+		g.dispatcher.Start(ctx)
+	}
+}
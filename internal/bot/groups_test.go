@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/heuristics"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestParseGroups(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		list string
+		want map[string][]Channel
+		err  error
+	}{
+		{"", map[string][]Channel{}, nil},
+		{
+			"Esports=#Foo, bar; network=baz",
+			map[string][]Channel{"esports": {"bar", "foo"}, "network": {"baz"}},
+			nil,
+		},
+		{"esports", nil, ErrBadGroups},
+		{"esports=", nil, ErrBadGroups},
+		{"esports=foo;network=foo", nil, ErrChannelGrouped},
+	}
+	for _, tt := range tests {
+		got, err := parseGroups(tt.list)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%q err got: %v, want: %v", tt.list, err, tt.err)
+			continue
+		}
+		if tt.err == nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q got: %v, want: %v", tt.list, got, tt.want)
+		}
+	}
+}
+
+func TestGroupsAnalyzer(t *testing.T) {
+	t.Parallel()
+	pipelines, err := parseGroupPipelines("esports:timeout=MinTimeoutDuration | network:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"esports": "timeout=MinTimeoutDuration", "network": ""}; !reflect.DeepEqual(pipelines, want) {
+		t.Fatalf("got: %v, want: %v", pipelines, want)
+	}
+	esports := &Group{Name: "esports", Channels: []Channel{"foo"}, Rules: pipelines["esports"]}
+	g := &groups{
+		byName:    map[string]*Group{"esports": esports, "network": {Name: "network", Channels: []Channel{"bar"}}},
+		byChannel: map[Channel]*Group{"foo": esports},
+	}
+	if err := g.compile(nil); err != nil {
+		t.Fatal(err)
+	}
+	if a := g.analyzer("bar"); a != nil {
+		t.Errorf("bar got an analyzer, want none")
+	}
+	a := g.analyzer("Foo")
+	if a == nil {
+		t.Fatal("Foo got no analyzer")
+	}
+	short := heuristics.Traits{Type: message.MessageTimeout, TimeoutDuration: 1}
+	if a.Violation(short) == nil {
+		t.Errorf("a short timeout of the group got no violation")
+	}
+	// the types the group doesn't list use the default rules, none here
+	if rule := a.Violation(heuristics.Traits{Type: message.MessageBan}); rule != nil {
+		t.Errorf("a ban of the group got: %v, want: no violation", heuristics.RuleName(rule))
+	}
+}
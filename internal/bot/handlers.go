@@ -0,0 +1,222 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/message"
+	"github.com/hammertrack/tracker/internal/modcmd"
+)
+
+// Handler handles a message in the tracker of its channel. Handlers are called
+// from the go-routine of the channel, one message at a time and in the order
+// they were received, so they may use the tracker without locking
+type Handler func(t *channelTracker, msg *message.Message)
+
+// handlers are the handlers of every message type. Messages of a type without
+// a handler are ignored
+var handlers = make(map[message.MessageType]Handler)
+
+// RegisterHandler sets the handler of the messages of type `typ`. It must be
+// called before the bot starts, usually from the init function of the file
+// that adds the type, and it panics if the type already has a handler
+func RegisterHandler(typ message.MessageType, h Handler) {
+	if _, ok := handlers[typ]; ok {
+		panic(fmt.Sprintf("bot: handler of %q registered twice", typ))
+	}
+	handlers[typ] = h
+}
+
+func init() {
+	RegisterHandler(message.MessageBan, trackModeration)
+	RegisterHandler(message.MessageTimeout, trackModeration)
+	RegisterHandler(message.MessageUserClear, trackModeration)
+	RegisterHandler(message.MessageWarning, trackModeration)
+	RegisterHandler(message.MessageDeletion, trackDeletion)
+	RegisterHandler(message.MessagePrivmsg, trackPrivmsg)
+	RegisterHandler(message.MessagePurge, trackPurge)
+}
+
+// trackModeration saves a ban, timeout or clear of a user with the messages
+// of the user in the history
+func trackModeration(t *channelTracker, msg *message.Message) {
+	// find in the history previous messages related to the ban/timeout,
+	// if the message is already `Stored` ignore it.
+	related := func(privmsg *message.PrivateMessage) bool {
+		if privmsg.Username == msg.Username && !privmsg.Stored {
+			// mutate the message so we never store it again
+			privmsg.Stored = true
+			return true
+		}
+		return false
+	}
+	if t.users != nil {
+		// the messages are shared with the history of the channel, so they
+		// are marked as stored in both
+		msg.LastMessages = t.users.Filter(msg.Username, related)
+	} else {
+		msg.LastMessages = t.history.Filter(related)
+	}
+	if msg.Reason == "" && t.sto.commands != nil {
+		t.inferReason(msg)
+	}
+	t.countFlood(msg)
+	save := t.save
+	if t.sto.massBans != nil && msg.Type == message.MessageBan && !msg.Backfilled {
+		// stored once the window is over, or collapsed into the held ban of
+		// the user in another channel
+		save = func(msg *message.Message) bool {
+			t.sto.massBans.hold(msg, t.save)
+			return true
+		}
+	}
+	if t.sto.grace != nil && msg.Type == message.MessageBan && !msg.Backfilled {
+		t.sto.grace.hold(msg, save)
+		return
+	}
+	save(msg)
+}
+
+// inferReason sets the reason of a ban or timeout from the most recent
+// moderation command of the user typed in chat by a moderator shortly before.
+// The moderator who typed it is the moderator of msg if unknown
+func (t *channelTracker) inferReason(msg *message.Message) {
+	if msg.Type != message.MessageBan && msg.Type != message.MessageTimeout {
+		return
+	}
+	window := time.Duration(cfg.CommandReasonsSeconds) * time.Second
+	var cmd *modcmd.Command
+	privmsg := t.history.Find(func(privmsg *message.PrivateMessage) bool {
+		if !hasModBadge(privmsg.Badges) {
+			return false
+		}
+		if ago := msg.At.Sub(privmsg.At); ago < -window || ago > window {
+			return false
+		}
+		c, ok := t.sto.commands.Parse(privmsg.Body)
+		if !ok || c.Type != msg.Type || c.Reason == "" || !strings.EqualFold(c.Target, msg.Username) {
+			return false
+		}
+		cmd = c
+		return true
+	})
+	if cmd == nil {
+		return
+	}
+	msg.Reason = cmd.Reason
+	if msg.Moderator == "" {
+		msg.Moderator = strings.ToLower(privmsg.Username)
+	}
+	reasonsInferred.Inc(string(msg.Type))
+}
+
+// hasModBadge reports whether the badges are the ones of a moderator or of the
+// broadcaster
+func hasModBadge(badges []string) bool {
+	for _, b := range badges {
+		if b == "moderator" || b == "broadcaster" {
+			return true
+		}
+	}
+	return false
+}
+
+// Modes of the deletions of a message not in the history, see
+// cfg.DeletionMode
+const (
+	DeletionHistory  = "history"
+	DeletionClearmsg = "clearmsg"
+)
+
+var ErrDeletionMode = errors.New("unknown deletion mode, expected history or clearmsg")
+
+// newDeletionFallback reports whether the deletions of a message not in the
+// history are stored with the body of their CLEARMSG
+func newDeletionFallback() bool {
+	switch cfg.DeletionMode {
+	case DeletionHistory:
+		return false
+	case DeletionClearmsg:
+		return true
+	default:
+		errors.WrapFatalWithContext(ErrDeletionMode, struct{ Mode string }{cfg.DeletionMode})
+		return false
+	}
+}
+
+// trackDeletion saves a deletion with the deleted message, if it is in the
+// history, or with the body of the CLEARMSG if the deletions fall back to it
+func trackDeletion(t *channelTracker, msg *message.Message) {
+	// find the message in the history with the corresponding ID, if the
+	// message is already `Stored` ignore it. We could retrieve the body
+	// of the message from the CLEARCHAT message but then we couldn't
+	// figure out the time span between the message and the deletion
+	privmsg := t.history.Find(func(privmsg *message.PrivateMessage) bool {
+		if privmsg.ID == msg.TargetMsgID && !privmsg.Stored {
+			privmsg.Stored = true
+			return true
+		}
+		return false
+	})
+	if privmsg == nil {
+		if !t.sto.deletionFallback || msg.TargetMsgBody == "" {
+			return
+		}
+		// the time of the message is unknown, so is the time to action
+		privmsg = &message.PrivateMessage{
+			ID:         msg.TargetMsgID,
+			Username:   msg.Username,
+			Body:       msg.TargetMsgBody,
+			Subscribed: message.SubscribedStatusUnknown,
+			Stored:     true,
+		}
+		msg.NoLatencyData = true
+	}
+	msg.LastMessages = []*message.PrivateMessage{privmsg}
+	t.countFlood(msg)
+	t.save(msg)
+}
+
+// countFlood sets the messages of the user of the moderation in the flood
+// window, see cfg.FloodMessages
+func (t *channelTracker) countFlood(msg *message.Message) {
+	if t.floods != nil && !msg.Backfilled {
+		msg.Flood = t.floods.Count(msg.Username, msg.At)
+	}
+}
+
+// trackPrivmsg extends the history with a chat message
+func trackPrivmsg(t *channelTracker, msg *message.Message) {
+	// the message about to leave the history was never moderated while it
+	// was in it, so it is a candidate for a clean sample. Archived messages
+	// are never sampled
+	if oldest := t.history.Oldest(); !msg.Backfilled && oldest != noopPrivmsg && !oldest.Stored {
+		t.sto.sample(msg.Channel, oldest)
+	}
+	// extend the history with the received message
+	t.history = t.history.Append(msg.LastMessages[0])
+	if t.users != nil {
+		t.users.Append(msg.LastMessages[0])
+	}
+	// archived messages would reset the buckets of the live ones
+	if t.floods != nil && !msg.Backfilled {
+		t.floods.Add(msg.Username, msg.At)
+	}
+	if !t.emotesRegistered && msg.ChannelID != "" && t.sto.emotes != nil {
+		t.sto.emotes.Register(msg.Channel, msg.ChannelID)
+		t.emotesRegistered = true
+	}
+}
+
+// trackPurge forgets the messages of a purged user
+func trackPurge(t *channelTracker, msg *message.Message) {
+	t.history.Replace(func(privmsg *message.PrivateMessage) bool {
+		return privmsg.Username == msg.Username
+	}, noopPrivmsg)
+	if t.users != nil {
+		t.users.Forget(msg.Username)
+	}
+}
@@ -0,0 +1,50 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/message"
+	"github.com/hammertrack/tracker/internal/modcmd"
+)
+
+func TestInferReason(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	mod := []string{"moderator"}
+	privmsg := func(username, body string, ago time.Duration, badges []string) *message.PrivateMessage {
+		return &message.PrivateMessage{Username: username, Body: body, At: now.Add(-ago), Badges: badges}
+	}
+	tests := []struct {
+		name          string
+		typ           message.MessageType
+		history       []*message.PrivateMessage
+		wantReason    string
+		wantModerator string
+	}{
+		{"command", message.MessageBan, []*message.PrivateMessage{privmsg("Mod", "!ban foo spam links", time.Second, mod)}, "spam links", "mod"},
+		{"most recent", message.MessageBan, []*message.PrivateMessage{
+			privmsg("mod", "!ban foo first", 2*time.Second, mod),
+			privmsg("mod", "!ban foo second", time.Second, mod),
+		}, "second", "mod"},
+		{"timeout", message.MessageTimeout, []*message.PrivateMessage{privmsg("mod", "!timeout foo 10m caps", time.Second, mod)}, "caps", "mod"},
+		{"not a moderator", message.MessageBan, []*message.PrivateMessage{privmsg("bar", "!ban foo spam", time.Second, nil)}, "", ""},
+		{"other user", message.MessageBan, []*message.PrivateMessage{privmsg("mod", "!ban baz spam", time.Second, mod)}, "", ""},
+		{"other type", message.MessageBan, []*message.PrivateMessage{privmsg("mod", "!timeout foo spam", time.Second, mod)}, "", ""},
+		{"too old", message.MessageBan, []*message.PrivateMessage{privmsg("mod", "!ban foo spam", time.Minute, mod)}, "", ""},
+	}
+	for _, tt := range tests {
+		tr := &channelTracker{
+			sto:     &Storage{commands: modcmd.New(modcmd.DefaultBan, modcmd.DefaultTimeout)},
+			history: message.New(message.MaxHistory, noopPrivmsg),
+		}
+		for _, privmsg := range tt.history {
+			tr.history = tr.history.Append(privmsg)
+		}
+		msg := &message.Message{Type: tt.typ, Channel: "channel", Username: "foo", At: now}
+		tr.inferReason(msg)
+		if msg.Reason != tt.wantReason || msg.Moderator != tt.wantModerator {
+			t.Errorf("%s got: %q %q, want: %q %q", tt.name, msg.Reason, msg.Moderator, tt.wantReason, tt.wantModerator)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package bot
+
+import (
+	"sync/atomic"
+	"time"
+
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/metrics"
+)
+
+// Statuses of a running tracker, see Health
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	// StatusMaintenance is a tracker whose ingestion was paused on purpose,
+	// see Storage.Pause
+	StatusMaintenance = "degraded, intentional"
+)
+
+// Health is the state of a running tracker
+type Health struct {
+	// Status is StatusDegraded while the source is not connected or the
+	// end-to-end latency is over its SLO
+	Status string `json:"status"`
+	// Instance, Version and Commit identify the tracker, see cfg.Instance
+	Instance  string `json:"instance"`
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Source    string `json:"source"`
+	Connected bool   `json:"connected"`
+	// ConnectedAt is the last time the source connected
+	ConnectedAt   time.Time `json:"connected_at"`
+	LastMessageAt time.Time `json:"last_message_at"`
+	Channels      int       `json:"channels"`
+	// Queue is the number of messages waiting in the tracker queues, of
+	// QueueCap, and QueuePeak the maximum since the tracker started
+	Queue     int `json:"queue"`
+	QueueCap  int `json:"queue_cap"`
+	QueuePeak int `json:"queue_peak"`
+	// ClockSkewMs is how far ahead of the clock of twitch the local clock is,
+	// including the latency of the network
+	ClockSkewMs int64 `json:"clock_skew_ms"`
+	// InvalidChannels are the tracked channels that don't exist in twitch
+	InvalidChannels []string `json:"invalid_channels,omitempty"`
+	// SuspendedChannels are the channels not tracked anymore because they
+	// failed to be joined too many times in a row, see cfg.ChannelSuspendFailures
+	SuspendedChannels []string `json:"suspended_channels,omitempty"`
+	// ConflictingChannels are the tracked channels also tracked by other
+	// instances, whose moderations are stored twice
+	ConflictingChannels []string `json:"conflicting_channels,omitempty"`
+	// OverQuota are the channels and the tenants over their daily quota, see
+	// Storage.OverQuota
+	OverQuota []string `json:"over_quota,omitempty"`
+	// Latency are the quantiles of the end-to-end latency of the last minute
+	// and the state of its SLO
+	Latency *LatencyBudget `json:"latency"`
+	// Maintenance is nil unless the ingestion is paused
+	Maintenance *Maintenance `json:"maintenance,omitempty"`
+	// Startup are the phases of the startup started so far
+	Startup []*StartupPhase `json:"startup"`
+}
+
+func unixNano(v *int64) time.Time {
+	n := atomic.LoadInt64(v)
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// Health returns the state of the tracker
+func (b *Bot) Health() *Health {
+	b.mu.RLock()
+	channels := len(b.tracked)
+	b.mu.RUnlock()
+	h := &Health{
+		Instance:      cfg.Instance,
+		Version:       cfg.Version,
+		Commit:        cfg.Commit,
+		Source:        cfg.Source,
+		ConnectedAt:   unixNano(&b.connectedAt),
+		LastMessageAt: unixNano(&b.lastMessageAt),
+		Channels:      channels,
+		Queue:         int(queues.current()),
+		QueueCap:      channels * TrackerQueueSize,
+		QueuePeak:     int(queues.max()),
+	}
+	h.InvalidChannels = b.InvalidChannels()
+	h.SuspendedChannels = b.SuspendedChannels()
+	h.ConflictingChannels = b.ConflictingChannels()
+	h.Connected = !h.ConnectedAt.IsZero()
+	h.Startup = b.Startup()
+	h.ClockSkewMs = b.twitch.skew().Milliseconds()
+	h.OverQuota = b.sto.OverQuota()
+	h.Latency = b.sto.LatencyBudget()
+	switch m := b.sto.Maintenance(); {
+	case m.Paused:
+		h.Status, h.Maintenance = StatusMaintenance, m
+	case !h.Connected || h.Latency.Alerting:
+		h.Status = StatusDegraded
+	default:
+		h.Status = StatusOK
+	}
+	return h
+}
+
+// ModerationCounts returns the number of moderations received since the
+// tracker started, by channel and type
+func ModerationCounts() map[string]map[string]int {
+	return countsByChannel(moderationsTotal)
+}
+
+// SubStatusCounts returns the number of moderations stored since the tracker
+// started, by channel and sub status of the user
+func SubStatusCounts() map[string]map[string]int {
+	return countsByChannel(moderationsBySub)
+}
+
+// TimeoutBucketCounts returns the number of timeouts stored since the tracker
+// started, by channel and bucket of their duration. See message.BucketOf
+func TimeoutBucketCounts() map[string]map[string]int {
+	return countsByChannel(timeoutsByBucket)
+}
+
+// countsByChannel returns the samples of a counter by channel and its second
+// label
+func countsByChannel(c *metrics.CounterVec) map[string]map[string]int {
+	counts := make(map[string]map[string]int)
+	for _, s := range c.Samples() {
+		ch, typ := s.Labels[0], s.Labels[1]
+		if counts[ch] == nil {
+			counts[ch] = make(map[string]int)
+		}
+		counts[ch][typ] = int(s.Value)
+	}
+	return counts
+}
@@ -0,0 +1,39 @@
+package bot
+
+import (
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/helix"
+)
+
+// HelixUserStore is implemented by drivers that can persist the users looked
+// up from Helix, so they are not looked up again after a restart. The users
+// should expire after helix.UsersCacheTTL
+type HelixUserStore interface {
+	// HelixUsers returns the stored users of the logins, omitting the missing
+	// ones
+	HelixUsers(logins []string) ([]*helix.User, error)
+	SaveHelixUsers(users []*helix.User) error
+}
+
+// helixCache is the helix.Cache of a HelixUserStore
+type helixCache struct {
+	store HelixUserStore
+}
+
+func (c helixCache) CachedUsers(logins []string) ([]*helix.User, error) {
+	return c.store.HelixUsers(logins)
+}
+
+func (c helixCache) CacheUsers(users []*helix.User) error {
+	return c.store.SaveHelixUsers(users)
+}
+
+// newHelix creates the Helix client of the storage, persisting its cache of
+// users in the driver if it supports it
+func newHelix(d Driver) *helix.Client {
+	h := helix.New(cfg.HelixClientID, cfg.HelixToken)
+	if store, ok := d.(HelixUserStore); ok {
+		h.SetCache(helixCache{store})
+	}
+	return h
+}
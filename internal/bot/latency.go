@@ -0,0 +1,173 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/metrics"
+)
+
+// LatencyWindow is the period the quantiles of the end-to-end latency are
+// computed over and checked against the SLO
+const LatencyWindow = time.Minute
+
+// LatencyBuckets are the upper bounds, in seconds, of the buckets of the
+// histogram of the end-to-end latency
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// LatencyQuantiles are the quantiles of the end-to-end latency of the stored
+// moderations of a window, in milliseconds
+type LatencyQuantiles struct {
+	Count int     `json:"count"`
+	P50   float64 `json:"p50_ms"`
+	P95   float64 `json:"p95_ms"`
+	P99   float64 `json:"p99_ms"`
+}
+
+// LatencyBudget is the state of the SLO of the end-to-end latency, from the
+// reception of a moderation to its insert acknowledged by the driver
+type LatencyBudget struct {
+	// SLOMs is the maximum p99 of a window, 0 if the SLO is disabled
+	SLOMs int `json:"slo_ms"`
+	// Types are the quantiles of the last window by type of moderation, "all"
+	// for every type
+	Types map[string]LatencyQuantiles `json:"types"`
+	// OverWindows is the number of consecutive windows whose p99 was over the
+	// SLO
+	OverWindows int  `json:"over_windows"`
+	Alerting    bool `json:"alerting"`
+}
+
+// latencyBudget computes the quantiles of the end-to-end latency of every
+// window and alerts when the p99 stays over the SLO. It is safe for concurrent
+// use
+type latencyBudget struct {
+	slo time.Duration
+	// windows is the number of consecutive windows over the SLO that raise the
+	// alert
+	windows int
+
+	mu sync.Mutex
+	// samples are the latencies of the current window by type, in seconds
+	samples  map[string][]float64
+	last     map[string]LatencyQuantiles
+	over     int
+	alerting bool
+}
+
+func (l *latencyBudget) observe(r *PipelineResult) {
+	if r.Latency <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.samples[string(r.Type)] = append(l.samples[string(r.Type)], r.Latency.Seconds())
+}
+
+func quantiles(sorted []float64) LatencyQuantiles {
+	return LatencyQuantiles{
+		Count: len(sorted),
+		P50:   metrics.Quantile(sorted, .5) * 1000,
+		P95:   metrics.Quantile(sorted, .95) * 1000,
+		P99:   metrics.Quantile(sorted, .99) * 1000,
+	}
+}
+
+// rotate closes the current window and returns its p99, and whether the alert
+// began or ended with it. A window without moderations is not over the SLO
+func (l *latencyBudget) rotate() (p99 time.Duration, began, ended bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var all []float64
+	last := make(map[string]LatencyQuantiles, len(l.samples)+1)
+	for typ, samples := range l.samples {
+		sort.Float64s(samples)
+		last[typ] = quantiles(samples)
+		all = append(all, samples...)
+	}
+	sort.Float64s(all)
+	q := quantiles(all)
+	last["all"] = q
+	l.last = last
+	l.samples = make(map[string][]float64)
+
+	p99 = time.Duration(q.P99 * float64(time.Millisecond))
+	if l.slo > 0 && q.Count > 0 && p99 > l.slo {
+		l.over++
+	} else {
+		l.over = 0
+	}
+	switch {
+	case !l.alerting && l.slo > 0 && l.over >= l.windows:
+		l.alerting, began = true, true
+	case l.alerting && l.over == 0:
+		l.alerting, ended = false, true
+	}
+	return p99, began, ended
+}
+
+func (l *latencyBudget) budget() *LatencyBudget {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	types := make(map[string]LatencyQuantiles, len(l.last))
+	for typ, q := range l.last {
+		types[typ] = q
+	}
+	return &LatencyBudget{
+		SLOMs:       int(l.slo.Milliseconds()),
+		Types:       types,
+		OverWindows: l.over,
+		Alerting:    l.alerting,
+	}
+}
+
+// Start rotates the windows until ctx is done, calling alert when the alert
+// begins or ends
+func (l *latencyBudget) Start(ctx context.Context, alert func(p99 time.Duration, began bool)) {
+	t := time.NewTicker(LatencyWindow)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			p99, began, ended := l.rotate()
+			if began || ended {
+				alert(p99, began)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func newLatencyBudget() *latencyBudget {
+	return &latencyBudget{
+		slo:     time.Duration(cfg.LatencySLOMs) * time.Millisecond,
+		windows: cfg.LatencySLOMinutes,
+		samples: make(map[string][]float64),
+	}
+}
+
+// LatencyBudget returns the quantiles of the end-to-end latency of the last
+// minute and the state of its SLO
+func (s *Storage) LatencyBudget() *LatencyBudget {
+	return s.latency.budget()
+}
+
+// alertLatency reports the p99 of the end-to-end latency going over the SLO for
+// cfg.LatencySLOMinutes, or back under it
+func (s *Storage) alertLatency(p99 time.Duration, began bool) {
+	if !began {
+		log.Printf("the p99 of the end-to-end latency is back under its SLO of %dms", cfg.LatencySLOMs)
+		return
+	}
+	latencySLOAlerts.Inc()
+	summary := fmt.Sprintf("the p99 of the end-to-end latency has been over its SLO of %dms for %d minutes, it was %dms in the last minute. Moderations may be lost if the queues fill up",
+		cfg.LatencySLOMs, cfg.LatencySLOMinutes, p99.Milliseconds())
+	log.Print("WARNING: " + summary)
+	s.notifyIncident(ScopeTracker, summary)
+}
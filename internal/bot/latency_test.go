@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestLatencyBudget(t *testing.T) {
+	t.Parallel()
+	l := &latencyBudget{slo: time.Second, windows: 2, samples: make(map[string][]float64)}
+	observe := func(typ message.MessageType, latencies ...time.Duration) {
+		for _, d := range latencies {
+			l.observe(&PipelineResult{Type: typ, Latency: d})
+		}
+	}
+	tests := []struct {
+		name      string
+		latencies []time.Duration
+		wantBegan bool
+		wantEnded bool
+	}{
+		{"under", []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, false, false},
+		{"first over", []time.Duration{100 * time.Millisecond, 2 * time.Second}, false, false},
+		{"second over", []time.Duration{3 * time.Second}, true, false},
+		{"still over", []time.Duration{3 * time.Second}, false, false},
+		{"recovered", []time.Duration{10 * time.Millisecond}, false, true},
+		{"over after recovery", []time.Duration{3 * time.Second}, false, false},
+		{"empty window", nil, false, false},
+	}
+	for _, tt := range tests {
+		observe(message.MessageBan, tt.latencies...)
+		_, began, ended := l.rotate()
+		if began != tt.wantBegan || ended != tt.wantEnded {
+			t.Errorf("%s got: %v %v, want: %v %v", tt.name, began, ended, tt.wantBegan, tt.wantEnded)
+		}
+	}
+
+	observe(message.MessageBan, 10*time.Millisecond, 20*time.Millisecond, 30*time.Millisecond)
+	observe(message.MessageTimeout, time.Second)
+	observe(message.MessageTimeout, 0)
+	l.rotate()
+	b := l.budget()
+	want := map[string]LatencyQuantiles{
+		string(message.MessageBan):     {Count: 3, P50: 20, P95: 30, P99: 30},
+		string(message.MessageTimeout): {Count: 1, P50: 1000, P95: 1000, P99: 1000},
+		"all":                          {Count: 4, P50: 20, P95: 1000, P99: 1000},
+	}
+	for typ, q := range want {
+		if got := b.Types[typ]; got != q {
+			t.Errorf("%s got: %+v, want: %+v", typ, got, q)
+		}
+	}
+	if b.SLOMs != 1000 || b.Alerting {
+		t.Errorf("got: %+v, want an SLO of 1000ms not alerting", b)
+	}
+}
@@ -0,0 +1,147 @@
+package bot
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// LookupDepth is the number of the most recent moderations of every login
+// summarized by LookupUsers
+const LookupDepth = 100
+
+// UserSummary is a compact summary of the moderations of a user, see
+// LookupUsers
+type UserSummary struct {
+	// User is the login or the twitch user id looked up
+	User string `json:"user"`
+	// Logins are the logins whose moderations are summarized, more than one if
+	// the user was renamed and none if the user id is unknown
+	Logins []string `json:"logins"`
+	// Total is the number of moderations summarized, at most LookupDepth of
+	// every login
+	Total  int                         `json:"total"`
+	ByType map[message.MessageType]int `json:"by_type"`
+	// Channels are the channels where the user was moderated
+	Channels []string            `json:"channels"`
+	LastAt   *time.Time          `json:"last_at,omitempty"`
+	LastType message.MessageType `json:"last_type,omitempty"`
+}
+
+// MultiReader is implemented by drivers that can read the moderations of many
+// users at once.
+type MultiReader interface {
+	// UsersModerations returns the most recent moderations of every login, at
+	// most `limit` of each, only in the channels `chs` if not empty. The
+	// moderations only have their channel, time, type and tombstone
+	UsersModerations(usernames []string, chs []Channel, limit int) (map[string][]*Moderation, error)
+}
+
+// LookupUsers summarizes the moderations of the users with the logins
+// `usernames` and of the ones with the twitch user ids `userIDs`, in the
+// channels `chs`, or in every channel if nil. The logins of the user ids are
+// the ones seen by the RenameStore, so they are unknown without one. The
+// moderations are read at once if the driver is a MultiReader
+func (s *Storage) LookupUsers(usernames, userIDs []string, chs []Channel) ([]*UserSummary, error) {
+	summaries := make([]*UserSummary, 0, len(usernames)+len(userIDs))
+	for _, username := range usernames {
+		logins, err := s.aliases(strings.ToLower(username))
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, &UserSummary{User: username, Logins: logins})
+	}
+	rs, _ := s.driver.(RenameStore)
+	for _, id := range userIDs {
+		sum := &UserSummary{User: id, Logins: []string{}}
+		if rs != nil {
+			logins, err := rs.LoginsOf(id)
+			if err != nil {
+				return nil, err
+			}
+			sum.Logins = append(sum.Logins, logins...)
+		}
+		summaries = append(summaries, sum)
+	}
+
+	var logins []string
+	seen := make(map[string]bool)
+	for _, sum := range summaries {
+		for _, login := range sum.Logins {
+			if !seen[login] {
+				seen[login] = true
+				logins = append(logins, login)
+			}
+		}
+	}
+	// no channel in the scope, e.g. a tenant without channels yet
+	var byLogin map[string][]*Moderation
+	if len(logins) > 0 && (chs == nil || len(chs) > 0) {
+		var err error
+		if byLogin, err = s.usersModerations(logins, chs); err != nil {
+			return nil, err
+		}
+	}
+	for _, sum := range summaries {
+		summarize(sum, byLogin)
+	}
+	return summaries, nil
+}
+
+// usersModerations reads the moderations of the logins with the MultiReader,
+// or login by login and channel by channel with the Reader
+func (s *Storage) usersModerations(logins []string, scope []Channel) (map[string][]*Moderation, error) {
+	chs := make([]Channel, len(scope))
+	for i, ch := range scope {
+		chs[i] = Channel(strings.ToLower(string(ch)))
+	}
+	if mr, ok := s.driver.(MultiReader); ok {
+		return mr.UsersModerations(logins, chs, LookupDepth)
+	}
+	r, ok := s.driver.(Reader)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	if len(chs) == 0 {
+		chs = []Channel{""}
+	}
+	byLogin := make(map[string][]*Moderation, len(logins))
+	for _, login := range logins {
+		for _, ch := range chs {
+			mods, err := r.UserModerations(login, ch, LookupDepth)
+			if err != nil {
+				return nil, err
+			}
+			byLogin[login] = append(byLogin[login], mods...)
+		}
+	}
+	return byLogin, nil
+}
+
+// summarize fills the summary with the moderations of its logins, leaving out
+// the soft-deleted ones
+func summarize(sum *UserSummary, byLogin map[string][]*Moderation) {
+	sum.ByType = make(map[message.MessageType]int)
+	sum.Channels = []string{}
+	channels := make(map[string]bool)
+	for _, login := range sum.Logins {
+		for _, m := range byLogin[login] {
+			if m.Deleted {
+				continue
+			}
+			sum.Total++
+			sum.ByType[m.Type]++
+			if !channels[m.Channel] {
+				channels[m.Channel] = true
+				sum.Channels = append(sum.Channels, m.Channel)
+			}
+			if sum.LastAt == nil || m.At.After(*sum.LastAt) {
+				at := m.At
+				sum.LastAt, sum.LastType = &at, m.Type
+			}
+		}
+	}
+	sort.Strings(sum.Channels)
+}
@@ -0,0 +1,60 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestLookupUsers(t *testing.T) {
+	t.Parallel()
+	s := NewStorage(NewMemoryStorage(10))
+	defer s.Stop()
+
+	now := time.Now()
+	for i, mod := range []struct {
+		typ      message.MessageType
+		channel  string
+		username string
+	}{
+		{message.MessageTimeout, "foo", "user"},
+		{message.MessageBan, "bar", "user"},
+		{message.MessageBan, "foo", "other"},
+	} {
+		msg := &message.Message{Type: mod.typ, Channel: mod.channel, Username: mod.username, At: now.Add(time.Duration(i) * time.Minute)}
+		if !s.Save(msg) {
+			t.Fatalf("moderation %d was not stored", i)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		chs      []Channel
+		total    int
+		lastType message.MessageType
+	}{
+		{name: "every channel", total: 2, lastType: message.MessageBan},
+		{name: "scoped", chs: []Channel{"Foo"}, total: 1, lastType: message.MessageTimeout},
+		{name: "no channels", chs: []Channel{}, total: 0},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := s.LookupUsers([]string{"User", "unknown"}, nil, tt.chs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 2 {
+				t.Fatalf("got: %v summaries, want: %v", len(got), 2)
+			}
+			if got[0].User != "User" || got[0].Total != tt.total || got[0].LastType != tt.lastType {
+				t.Errorf("got: %+v, want: %v moderations, the last a %v", got[0], tt.total, tt.lastType)
+			}
+			if got[1].Total != 0 || got[1].LastAt != nil {
+				t.Errorf("got: %+v, want: no moderations", got[1])
+			}
+		})
+	}
+}
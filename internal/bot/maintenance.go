@@ -0,0 +1,107 @@
+package bot
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// MaintenanceBuffer is the maximum number of moderations held while the
+// ingestion is paused, the next ones are dropped
+const MaintenanceBuffer = 10000
+
+var (
+	ErrPaused    = errors.New("the ingestion is already paused")
+	ErrNotPaused = errors.New("the ingestion is not paused")
+)
+
+// Maintenance is the state of a pause of the ingestion
+type Maintenance struct {
+	Paused bool      `json:"paused"`
+	Since  time.Time `json:"since,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	// Held is the number of moderations waiting for the resume, and Dropped
+	// the ones that did not fit in the MaintenanceBuffer
+	Held    int `json:"held"`
+	Dropped int `json:"dropped"`
+}
+
+// maintenance holds the moderations in memory while the ingestion is paused,
+// e.g. during a maintenance of the database, so nothing is written until it
+// is resumed. The channels stay joined and their history keeps being
+// recorded. It is safe for concurrent use.
+type maintenance struct {
+	mu    sync.Mutex
+	state Maintenance
+	held  []*message.Message
+}
+
+// hold keeps msg until the resume if the ingestion is paused. It reports
+// whether msg was taken, held or dropped
+func (m *maintenance) hold(msg *message.Message) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.state.Paused {
+		return false
+	}
+	if len(m.held) >= MaintenanceBuffer {
+		m.state.Dropped++
+		dropped.Inc("maintenance")
+		return true
+	}
+	m.held = append(m.held, msg)
+	return true
+}
+
+func (m *maintenance) current() *Maintenance {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := m.state
+	st.Held = len(m.held)
+	return &st
+}
+
+// Pause stops writing the moderations to the driver until Resume. It returns
+// ErrPaused if the ingestion is already paused
+func (s *Storage) Pause(reason, actor string) error {
+	s.maint.mu.Lock()
+	if s.maint.state.Paused {
+		s.maint.mu.Unlock()
+		return ErrPaused
+	}
+	s.maint.state = Maintenance{Paused: true, Since: s.clock.Now(), Reason: reason}
+	s.maint.mu.Unlock()
+	log.Printf("ingestion paused by %s: %s", actor, reason)
+	s.auditTenant("ingestion-pause", actor, reason)
+	return nil
+}
+
+// Resume stores in background the moderations held since Pause and resumes
+// the ingestion. It returns the number of moderations held, or ErrNotPaused
+func (s *Storage) Resume(actor string) (int, error) {
+	s.maint.mu.Lock()
+	if !s.maint.state.Paused {
+		s.maint.mu.Unlock()
+		return 0, ErrNotPaused
+	}
+	held := s.maint.held
+	s.maint.held = nil
+	s.maint.state = Maintenance{}
+	s.maint.mu.Unlock()
+	log.Printf("ingestion resumed by %s, storing %d held moderations", actor, len(held))
+	s.auditTenant("ingestion-resume", actor, "")
+	go func() {
+		for _, msg := range held {
+			s.Save(msg)
+		}
+	}()
+	return len(held), nil
+}
+
+// Maintenance returns the state of the pause of the ingestion
+func (s *Storage) Maintenance() *Maintenance {
+	return s.maint.current()
+}
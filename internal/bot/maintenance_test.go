@@ -0,0 +1,56 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestMaintenance(t *testing.T) {
+	t.Parallel()
+	d := &fakeDriver{}
+	s := NewStorage(d)
+	defer s.Stop()
+
+	if _, err := s.Resume("test"); !errors.Is(err, ErrNotPaused) {
+		t.Fatalf("got: %v, want: %v", err, ErrNotPaused)
+	}
+	if err := s.Pause("repair", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Pause("repair", "test"); !errors.Is(err, ErrPaused) {
+		t.Fatalf("got: %v, want: %v", err, ErrPaused)
+	}
+	s.maint.mu.Lock()
+	s.maint.held = make([]*message.Message, MaintenanceBuffer-1)
+	s.maint.mu.Unlock()
+	for i := 0; i < 2; i++ {
+		msg := &message.Message{Type: message.MessageBan, Channel: "channel", Username: "user", At: time.Now()}
+		if !s.Save(msg) {
+			t.Fatal("got: false, want: held")
+		}
+	}
+	m := s.Maintenance()
+	if !m.Paused || m.Reason != "repair" || m.Held != MaintenanceBuffer || m.Dropped != 1 {
+		t.Fatalf("got: %+v, want: paused with %d held and 1 dropped", m, MaintenanceBuffer)
+	}
+	if d.inserted != 0 {
+		t.Fatalf("inserted got: %d, want: %d", d.inserted, 0)
+	}
+
+	s.maint.mu.Lock()
+	s.maint.held = s.maint.held[MaintenanceBuffer-1:]
+	s.maint.mu.Unlock()
+	held, err := s.Resume("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if held != 1 {
+		t.Fatalf("held got: %d, want: %d", held, 1)
+	}
+	if s.Maintenance().Paused {
+		t.Fatal("got: paused, want: resumed")
+	}
+}
@@ -0,0 +1,89 @@
+package bot
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// massBans collapses the bans of the same user in several channels within a
+// window, usually given by ban bots sharing a list, into the ban of the first
+// channel with the rest in message.Message.Channels. Only the first ban is
+// stored, so the user is only found in the moderations of the first channel.
+// It is safe for concurrent use.
+type massBans struct {
+	window time.Duration
+
+	mu   sync.Mutex
+	held map[string]*heldBan
+}
+
+// hold calls save with the ban msg once the window is over, along with the
+// channels of the bans of the same user received meanwhile. If a ban of the
+// user is already held, msg is collapsed into it and never saved
+func (m *massBans) hold(msg *message.Message, save func(msg *message.Message) bool) {
+	key := strings.ToLower(msg.Username)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if h, ok := m.held[key]; ok {
+		if !strings.EqualFold(h.msg.Channel, msg.Channel) && !contains(h.msg.Channels, msg.Channel) {
+			h.msg.Channels = append(h.msg.Channels, msg.Channel)
+		}
+		massBansCollapsed.Inc()
+		return
+	}
+	h := &heldBan{msg: msg, save: save}
+	m.held[key] = h
+	h.timer = time.AfterFunc(m.window, func() {
+		if m.release(key, h) {
+			h.save(h.msg)
+		}
+	})
+}
+
+// release removes h from the held bans and reports whether it was still held
+func (m *massBans) release(key string, h *heldBan) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.held[key] != h {
+		return false
+	}
+	delete(m.held, key)
+	return true
+}
+
+// flush stores every held ban right away
+func (m *massBans) flush() {
+	m.mu.Lock()
+	held := m.held
+	m.held = make(map[string]*heldBan)
+	m.mu.Unlock()
+	for _, h := range held {
+		if h.timer.Stop() {
+			h.save(h.msg)
+		}
+	}
+}
+
+// newMassBans returns nil if the bans are not collapsed
+func newMassBans() *massBans {
+	if cfg.MassBanWindowSeconds <= 0 {
+		return nil
+	}
+	return &massBans{
+		window: time.Duration(cfg.MassBanWindowSeconds) * time.Second,
+		held:   make(map[string]*heldBan),
+	}
+}
+
+func contains(channels []string, ch string) bool {
+	for _, c := range channels {
+		if strings.EqualFold(c, ch) {
+			return true
+		}
+	}
+	return false
+}
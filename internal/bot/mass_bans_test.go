@@ -0,0 +1,50 @@
+package bot
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestMassBans(t *testing.T) {
+	t.Parallel()
+	m := &massBans{window: 50 * time.Millisecond, held: make(map[string]*heldBan)}
+	var (
+		mu    sync.Mutex
+		saved []*message.Message
+	)
+	save := func(msg *message.Message) bool {
+		mu.Lock()
+		saved = append(saved, msg)
+		mu.Unlock()
+		return true
+	}
+	for _, ban := range []struct{ channel, username string }{
+		{"first", "user"},
+		{"second", "User"},
+		{"third", "user"},
+		{"second", "user"},
+		{"first", "other"},
+	} {
+		m.hold(&message.Message{Type: message.MessageBan, Channel: ban.channel, Username: ban.username}, save)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(saved) != 2 {
+		t.Fatalf("saved got: %d, want: %d", len(saved), 2)
+	}
+	for _, msg := range saved {
+		var want []string
+		if msg.Username == "user" {
+			want = []string{"second", "third"}
+		}
+		if !reflect.DeepEqual(msg.Channels, want) {
+			t.Fatalf("%s channels got: %v, want: %v", msg.Username, msg.Channels, want)
+		}
+	}
+}
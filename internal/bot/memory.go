@@ -0,0 +1,308 @@
+package bot
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// Memory is a driver that keeps the moderations in memory, for the demo mode
+// and the tests that need a working driver. Once full, every new moderation
+// evicts the oldest stored one. Everything is lost when the tracker exits.
+// The queries scan every moderation, which is fine for its bounded size. It is
+// safe for concurrent use.
+type Memory struct {
+	max int
+
+	mu sync.RWMutex
+	// mods are the moderations in the order they were inserted
+	mods []*Moderation
+	// shards are the shards tracking each channel
+	shards map[Channel][]int
+	// channelIDs are the ids of the channels, assigned from 1 in order
+	channelIDs map[Channel]int64
+	// annotations are in the order they were inserted
+	annotations []*Annotation
+}
+
+func (m *Memory) Insert(msg *message.Message) error {
+	mod := &Moderation{
+		Channel:         msg.Channel,
+		Username:        msg.Username,
+		At:              msg.At,
+		Sub:             message.SubscribedStatusUnknown,
+		Toxicity:        msg.Toxicity,
+		Tags:            msg.Tags,
+		Type:            msg.Type,
+		Duration:        msg.Duration,
+		Bucket:          msg.Bucket,
+		AutomodStatus:   msg.AutomodStatus,
+		AutomodCategory: msg.AutomodCategory,
+		UserID:          msg.UserID,
+		SharedSession:   msg.SharedSession,
+		SourceChannelID: msg.SourceChannelID,
+		Reason:          msg.Reason,
+		Channels:        msg.Channels,
+		EscalatedFrom:   msg.EscalatedFrom,
+		Partial:         msg.Partial,
+		NoLatencyData:   msg.NoLatencyData,
+		Region:          msg.Region,
+		Instance:        msg.Instance,
+	}
+	if len(msg.LastMessages) > 0 {
+		mod.Sub = msg.LastMessages[0].Subscribed
+		mod.SubMonths = msg.LastMessages[0].SubMonths
+	}
+	if d, ok := msg.TimeToAction(); ok {
+		secs := d.Seconds()
+		mod.TimeToAction = &secs
+	}
+	// compressed moderations are stored as the Cassandra driver reads them
+	if msg.Compressed != nil {
+		if err := decompress(mod, msg.Compressed); err != nil {
+			return err
+		}
+	} else {
+		for _, privmsg := range msg.LastMessages {
+			mod.Messages = append(mod.Messages, privmsg.Body)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// replaced like the rows of the same primary key
+	for i, stored := range m.mods {
+		if stored.Username == mod.Username && stored.Channel == mod.Channel && stored.At.Equal(mod.At) {
+			m.mods[i] = mod
+			return nil
+		}
+	}
+	if len(m.mods) >= m.max {
+		copy(m.mods, m.mods[1:])
+		m.mods = m.mods[:len(m.mods)-1]
+	}
+	m.mods = append(m.mods, mod)
+	return nil
+}
+
+// Channels returns the channels of the shard of this instance
+func (m *Memory) Channels() ([]Channel, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var all []Channel
+	for ch, shards := range m.shards {
+		for _, shard := range shards {
+			if shard == cfg.ShardID {
+				all = append(all, ch)
+			}
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	return all, nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+// find returns the moderations that pass `match`, the most recent first
+func (m *Memory) find(match func(*Moderation) bool) []*Moderation {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var all []*Moderation
+	for _, mod := range m.mods {
+		if match(mod) {
+			// copied, so the callers can't change the stored moderation
+			cp := *mod
+			all = append(all, &cp)
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].At.After(all[j].At) })
+	return all
+}
+
+// userModerations is Cassandra.userModerations
+func (m *Memory) userModerations(username string, ch Channel, tag string, before time.Time, limit int) []*Moderation {
+	all := m.find(func(mod *Moderation) bool {
+		if mod.Username != username || (ch != "" && mod.Channel != string(ch)) {
+			return false
+		}
+		if !before.IsZero() && !mod.At.Before(before) {
+			return false
+		}
+		if tag == "" {
+			return true
+		}
+		for _, t := range mod.Tags {
+			if t == tag {
+				return true
+			}
+		}
+		return false
+	})
+	if len(all) > limit {
+		all = all[:limit]
+	}
+	return all
+}
+
+func (m *Memory) UserModerations(username string, ch Channel, limit int) ([]*Moderation, error) {
+	return m.userModerations(username, ch, "", time.Time{}, limit), nil
+}
+
+func (m *Memory) UserModerationsBefore(username string, ch Channel, before time.Time, limit int) ([]*Moderation, error) {
+	return m.userModerations(username, ch, "", before, limit), nil
+}
+
+func (m *Memory) TaggedUserModerations(username string, ch Channel, tag string, limit int) ([]*Moderation, error) {
+	return m.userModerations(username, ch, tag, time.Time{}, limit), nil
+}
+
+func (m *Memory) UsersModerations(usernames []string, chs []Channel, limit int) (map[string][]*Moderation, error) {
+	users := make(map[string]bool, len(usernames))
+	for _, username := range usernames {
+		users[username] = true
+	}
+	scope := make(map[string]bool, len(chs))
+	for _, ch := range chs {
+		scope[string(ch)] = true
+	}
+	all := m.find(func(mod *Moderation) bool {
+		return users[mod.Username] && (len(scope) == 0 || scope[mod.Channel])
+	})
+	byUser := make(map[string][]*Moderation, len(usernames))
+	for _, mod := range all {
+		if len(byUser[mod.Username]) < limit {
+			byUser[mod.Username] = append(byUser[mod.Username], mod)
+		}
+	}
+	return byUser, nil
+}
+
+func (m *Memory) SearchModerations(q string, chs []Channel, limit int) ([]*Moderation, error) {
+	scope := make(map[string]bool, len(chs))
+	for _, ch := range chs {
+		scope[string(ch)] = true
+	}
+	all := m.find(func(mod *Moderation) bool {
+		return (len(scope) == 0 || scope[mod.Channel]) && strings.Contains(searchText(mod.Messages), q)
+	})
+	if len(all) > limit {
+		all = all[:limit]
+	}
+	return all, nil
+}
+
+// ChannelModerations calls fn with the moderations the most recent first
+func (m *Memory) ChannelModerations(ch Channel, from, to time.Time, fn func(*Moderation) error) error {
+	all := m.find(func(mod *Moderation) bool {
+		return mod.Channel == string(ch) && !mod.At.Before(from) && !mod.At.After(to)
+	})
+	for _, mod := range all {
+		if err := fn(mod); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Memory) HasModeration(username string, ch Channel, at time.Time) (bool, error) {
+	all := m.find(func(mod *Moderation) bool {
+		return mod.Username == username && mod.Channel == string(ch) && mod.At.Equal(at)
+	})
+	return len(all) > 0, nil
+}
+
+func (m *Memory) CorrectModeration(username string, ch Channel, at time.Time, c *Correction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, mod := range m.mods {
+		if mod.Username == username && mod.Channel == string(ch) && mod.At.Equal(at) {
+			mod.Deleted, mod.Note = c.Deleted, c.Note
+			return nil
+		}
+	}
+	return ErrModerationNotFound
+}
+
+func (m *Memory) AddChannel(ch Channel) error {
+	return m.AddChannelToShard(ch, cfg.ShardID)
+}
+
+func (m *Memory) AddChannelToShard(ch Channel, shard int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.shards[ch] {
+		if s == shard {
+			return nil
+		}
+	}
+	m.shards[ch] = append(m.shards[ch], shard)
+	return nil
+}
+
+func (m *Memory) ChannelShards(ch Channel) ([]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]int(nil), m.shards[ch]...), nil
+}
+
+func (m *Memory) RemoveChannel(ch Channel) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.shards, ch)
+	return nil
+}
+
+func (m *Memory) ChannelIDs() (map[Channel]int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ids := make(map[Channel]int64, len(m.channelIDs))
+	for ch, id := range m.channelIDs {
+		ids[ch] = id
+	}
+	return ids, nil
+}
+
+func (m *Memory) AssignChannelID(ch Channel) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, ok := m.channelIDs[ch]
+	if !ok {
+		id = int64(len(m.channelIDs)) + 1
+		m.channelIDs[ch] = id
+	}
+	return id, nil
+}
+
+func (m *Memory) InsertAnnotation(a *Annotation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.annotations = append(m.annotations, a)
+	return nil
+}
+
+func (m *Memory) Annotations(username string, ch Channel) ([]*Annotation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var all []*Annotation
+	for i := len(m.annotations) - 1; i >= 0; i-- {
+		if a := m.annotations[i]; a.Username == username && a.Channel == string(ch) {
+			all = append(all, a)
+		}
+	}
+	return all, nil
+}
+
+// NewMemoryStorage creates an in-memory driver of up to `max` moderations
+func NewMemoryStorage(max int) *Memory {
+	return &Memory{
+		max:        max,
+		shards:     make(map[Channel][]int),
+		channelIDs: make(map[Channel]int64),
+	}
+}
@@ -0,0 +1,68 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestMemory(t *testing.T) {
+	t.Parallel()
+	d := NewMemoryStorage(2)
+	s := NewStorage(d)
+	defer s.Stop()
+
+	now := time.Now()
+	for i, tags := range [][]string{{"spam"}, {"spam"}, nil} {
+		at := now.Add(time.Duration(i) * time.Minute)
+		msg := &message.Message{
+			Type:         message.MessageBan,
+			Channel:      "channel",
+			Username:     "user",
+			At:           at,
+			Tags:         tags,
+			LastMessages: []*message.PrivateMessage{{Username: "user", Body: "hello", At: at.Add(-10 * time.Second)}},
+		}
+		if !s.Save(msg) {
+			t.Fatalf("moderation %d was not stored", i)
+		}
+	}
+
+	tests := []struct {
+		name string
+		tag  string
+		want []time.Time
+	}{
+		{name: "oldest evicted", want: []time.Time{now.Add(2 * time.Minute), now.Add(time.Minute)}},
+		{name: "tagged", tag: "spam", want: []time.Time{now.Add(time.Minute)}},
+	}
+	for _, tt := range tests {
+		got, err := s.TaggedUserModerations("user", "channel", tt.tag, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s got: %d moderations, want: %d", tt.name, len(got), len(tt.want))
+		}
+		for i, m := range got {
+			if !m.At.Equal(tt.want[i]) || len(m.Messages) != 1 {
+				t.Fatalf("%s got: %v, want: %v", tt.name, m, tt.want[i])
+			}
+		}
+	}
+	if stored, err := s.HasModeration("user", "channel", now); err != nil || stored {
+		t.Fatalf("got: %v, %v, want: evicted", stored, err)
+	}
+
+	if err := d.AddChannelToShard("other", cfg.ShardID+1); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddChannel("channel"); err != nil {
+		t.Fatal(err)
+	}
+	if chs, err := d.Channels(); err != nil || len(chs) != 1 || chs[0] != "channel" {
+		t.Fatalf("got: %v, %v, want: [channel]", chs, err)
+	}
+}
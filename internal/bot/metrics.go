@@ -0,0 +1,303 @@
+package bot
+
+import (
+	"hash/fnv"
+	"sync"
+
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/message"
+	"github.com/hammertrack/tracker/internal/metrics"
+)
+
+// TimeToActionSamples is the number of recent times to action kept per channel
+const TimeToActionSamples = 1000
+
+// TimeToActionBuckets are the upper bounds, in seconds, of the buckets of the
+// histograms of the times to action
+var TimeToActionBuckets = []float64{0.5, 1, 2, 5, 10, 30, 60, 120, 300, 600}
+
+var (
+	topChannels = metrics.NewTopChannels(cfg.MetricsTopChannels)
+
+	moderationsTotal = metrics.NewCounterVec(
+		"hammertrack_moderations_total",
+		"Moderations received, by channel and type.",
+		"channel", "type",
+	).LimitChannels("channel", topChannels)
+	eventsTotal = metrics.NewCounterVec(
+		"hammertrack_events_total",
+		"Events ingested from the source, by channel and type.",
+		"channel", "type",
+	).LimitChannels("channel", topChannels)
+	timeToActionSeconds = metrics.NewHistogramVec(
+		"hammertrack_time_to_action_seconds",
+		"Time from a message to its moderation, by channel.",
+		TimeToActionBuckets,
+		"channel",
+	).LimitChannels("channel", topChannels)
+	latencySeconds = metrics.NewHistogramVec(
+		"hammertrack_latency_seconds",
+		"Time from the reception of a moderation to its insert acknowledged by the driver, by type.",
+		LatencyBuckets,
+		"type",
+	)
+	latencySLOAlerts = metrics.NewCounterVec(
+		"hammertrack_latency_slo_alerts_total",
+		"Times the p99 of the end-to-end latency stayed over LATENCY_SLO_MS for LATENCY_SLO_MINUTES.",
+	)
+	gapsRecovered = metrics.NewCounterVec(
+		"hammertrack_gaps_recovered_total",
+		"Moderations missed while the tracker was down and recovered from the logs on startup, by channel.",
+		"channel",
+	).LimitChannels("channel", topChannels)
+	chatMessages = metrics.NewCounterVec(
+		"hammertrack_chat_messages_total",
+		"Messages of the bot in chat, by result: sent, silenced, rate_limited or forbidden.",
+		"result",
+	)
+	bodiesTruncated = metrics.NewCounterVec(
+		"hammertrack_bodies_truncated_total",
+		"Bodies of stored messages truncated to MAX_BODY_LENGTH, by channel.",
+		"channel",
+	).LimitChannels("channel", topChannels)
+	moderationsRejected = metrics.NewCounterVec(
+		"hammertrack_moderations_rejected_total",
+		"Moderations not stored because of a heuristic rule, by rule.",
+		"rule",
+	)
+	insertSeconds = metrics.NewCounterVec(
+		"hammertrack_insert_seconds_total",
+		"Time spent inserting moderations, by driver.",
+		"driver",
+	)
+	storageErrors = metrics.NewCounterVec(
+		"hammertrack_storage_errors_total",
+		"Errors writing to the database, by operation.",
+		"op",
+	)
+	dropped = metrics.NewCounterVec(
+		"hammertrack_dropped_total",
+		"Jobs dropped because their queue was full, by queue.",
+		"queue",
+	)
+	insertErrors = metrics.NewCounterVec(
+		"hammertrack_insert_errors_total",
+		"Moderations that failed to be inserted, by driver.",
+		"driver",
+	)
+	enqueueBlockedSeconds = metrics.NewCounterVec(
+		"hammertrack_enqueue_blocked_seconds_total",
+		"Time the source was blocked waiting for a full tracker queue.",
+	)
+	channelConflicts = metrics.NewCounterVec(
+		"hammertrack_channel_conflicts_total",
+		"Tracked channels found to be tracked by another instance too, by channel.",
+		"channel",
+	).LimitChannels("channel", topChannels)
+	channelSuspensions = metrics.NewCounterVec(
+		"hammertrack_channel_suspensions_total",
+		"Tracked channels suspended after failing to be joined too many times in a row, by channel.",
+		"channel",
+	).LimitChannels("channel", topChannels)
+	reasonsInferred = metrics.NewCounterVec(
+		"hammertrack_reasons_inferred_total",
+		"Reasons of the moderations inferred from the moderation commands typed in chat, by type.",
+		"type",
+	)
+	escalationsTagged = metrics.NewCounterVec(
+		"hammertrack_escalations_total",
+		"Bans tagged as the end of an escalation of the user, by channel.",
+		"channel",
+	).LimitChannels("channel", topChannels)
+	massBansCollapsed = metrics.NewCounterVec(
+		"hammertrack_mass_bans_collapsed_total",
+		"Bans not stored because they were collapsed into the ban of the same user in another channel.",
+	)
+	quotasExceeded = metrics.NewCounterVec(
+		"hammertrack_quotas_exceeded_total",
+		"Daily quotas exceeded, by scope, channel or tenant.",
+		"scope",
+	)
+	notificationsFailed = metrics.NewCounterVec(
+		"hammertrack_notifications_failed_total",
+		"Notifications of the digests and the incidents that failed to be sent.",
+	)
+	outboxRedeliveries = metrics.NewCounterVec(
+		"hammertrack_outbox_redeliveries_total",
+		"Webhook notifications delivered again from the outbox after a failure or a restart.",
+	)
+	enrichmentsSkipped = metrics.NewCounterVec(
+		"hammertrack_enrichments_skipped_total",
+		"Enrichments skipped because the processing of the moderation went over EVENT_BUDGET_MS, by enrichment: tags or toxicity.",
+		"enrichment",
+	)
+	moderationsSpilled = metrics.NewCounterVec(
+		"hammertrack_moderations_spilled_total",
+		"Moderations spilled to disk because they failed to be inserted, or earlier ones were still spilled.",
+	)
+	spillReplayed = metrics.NewCounterVec(
+		"hammertrack_spill_replayed_total",
+		"Spilled moderations inserted once the database was back.",
+	)
+	_ = metrics.NewGaugeFunc(
+		"hammertrack_spill_records",
+		"Moderations spilled to disk waiting to be inserted.",
+		spillUsage.currentRecords,
+	)
+	_ = metrics.NewGaugeFunc(
+		"hammertrack_spill_bytes",
+		"Bytes on disk of the spilled moderations, up to SPILL_MAX_MB.",
+		spillUsage.currentBytes,
+	)
+	_ = metrics.NewGaugeFunc(
+		"hammertrack_queue_depth",
+		"Messages waiting in the tracker queues.",
+		queues.current,
+	)
+	_ = metrics.NewGaugeFunc(
+		"hammertrack_queue_depth_peak",
+		"Maximum number of messages that waited in the tracker queues at once since the tracker started.",
+		queues.max,
+	)
+	moderationsBySub = metrics.NewCounterVec(
+		"hammertrack_moderations_by_sub_total",
+		"Stored moderations, by channel and sub status of the user.",
+		"channel", "sub",
+	).LimitChannels("channel", topChannels)
+	timeoutsByBucket = metrics.NewCounterVec(
+		"hammertrack_timeouts_by_bucket_total",
+		"Stored timeouts, by channel and bucket of their duration.",
+		"channel", "bucket",
+	).LimitChannels("channel", topChannels)
+	moderationsStored = metrics.NewCounterVec(
+		"hammertrack_moderations_stored_total",
+		"Moderations that passed the heuristics and were stored, by channel and type.",
+		"channel", "type",
+	).LimitChannels("channel", topChannels)
+
+	// timesToAction are the most recent times to action of the stored
+	// moderations of every channel, in seconds
+	timesToAction = metrics.NewWindowVec(TimeToActionSamples, cfg.MetricsTopChannels)
+
+	_ = metrics.NewGaugeFunc(
+		"hammertrack_interned_strings",
+		"Strings repeated across the messages, e.g. usernames, kept once and shared, see INTERN_STRINGS.",
+		func() float64 { return float64(interned.Len()) },
+	)
+
+	_ = metrics.NewInfo(
+		"hammertrack_build_info",
+		"Name, version and commit of the tracker, always 1, see INSTANCE_NAME.",
+		[]string{"instance", "version", "commit"},
+		[]string{cfg.Instance, cfg.Version, cfg.Commit},
+	)
+
+	bannedUsers = &userSet{users: make(map[uint64]struct{})}
+	_           = metrics.NewGaugeFunc(
+		"hammertrack_unique_banned_users",
+		"Distinct users banned since the tracker started.",
+		bannedUsers.len,
+	)
+)
+
+// userSet is a set of usernames. Only a hash of each username is kept, which
+// keeps the memory of the set small at the cost of some unlikely collisions
+type userSet struct {
+	mu    sync.Mutex
+	users map[uint64]struct{}
+}
+
+func (s *userSet) add(username string) {
+	h := fnv.New64a()
+	h.Write([]byte(username))
+	s.mu.Lock()
+	s.users[h.Sum64()] = struct{}{}
+	s.mu.Unlock()
+}
+
+func (s *userSet) len() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return float64(len(s.users))
+}
+
+// busDropped counts the values of `topic` dropped for its slow subscribers
+func busDropped(topic string) func(sub string) {
+	return func(sub string) {
+		dropped.Inc("bus:" + topic + ":" + sub)
+	}
+}
+
+// observeResult updates the metrics of the processed moderations
+func observeResult(r *PipelineResult) {
+	switch {
+	case r.Accepted:
+		moderationsStored.Inc(r.Channel, string(r.Type))
+		insertSeconds.Add(r.InsertLatency.Seconds(), r.Driver)
+		if r.Latency > 0 {
+			latencySeconds.Observe(r.Latency.Seconds(), string(r.Type))
+		}
+		if r.Truncated > 0 {
+			bodiesTruncated.Add(float64(r.Truncated), r.Channel)
+		}
+	case r.Rule != "":
+		moderationsRejected.Inc(r.Rule)
+	case r.Error != "":
+		insertErrors.Inc(r.Driver)
+		insertFailures.add(r.Driver, r.At)
+	}
+}
+
+// subLabel returns the label of a sub status in the metrics
+func subLabel(sub message.SubscribedStatus) string {
+	switch sub {
+	case message.SubscribedStatusTrue:
+		return "subscriber"
+	case message.SubscribedStatusFalse:
+		return "non_subscriber"
+	default:
+		return "unknown"
+	}
+}
+
+// observeSubStatus counts a stored moderation by the sub status of the user in
+// the most recent message
+func observeSubStatus(msg *message.Message) {
+	sub := message.SubscribedStatusUnknown
+	if len(msg.LastMessages) > 0 {
+		sub = msg.LastMessages[0].Subscribed
+	}
+	moderationsBySub.Inc(msg.Channel, subLabel(sub))
+}
+
+// observeTimeoutBucket counts a stored timeout by the bucket of its duration
+func observeTimeoutBucket(msg *message.Message) {
+	if msg.Bucket != "" {
+		timeoutsByBucket.Inc(msg.Channel, string(msg.Bucket))
+	}
+}
+
+// observeTimeToAction records the time to action of a stored moderation
+func observeTimeToAction(msg *message.Message) {
+	if msg.SharedSession {
+		return
+	}
+	if tta, ok := msg.TimeToAction(); ok {
+		timesToAction.Observe(msg.Channel, tta.Seconds())
+		timeToActionSeconds.Observe(tta.Seconds(), msg.Channel)
+	}
+}
+
+// TimesToAction summarizes the recent times to action of the stored moderations
+// of every channel, in seconds
+func TimesToAction() map[string]metrics.Summary {
+	return timesToAction.Summaries()
+}
+
+// observeModeration updates the moderation metrics
+func observeModeration(msg *message.Message) {
+	moderationsTotal.Inc(msg.Channel, string(msg.Type))
+	if msg.Type == message.MessageBan {
+		bannedUsers.add(msg.Username)
+	}
+}
@@ -0,0 +1,209 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/message"
+	"github.com/hammertrack/tracker/internal/notify"
+)
+
+// NotifyTimeout is the maximum time of the delivery of a notification
+const NotifyTimeout = 30 * time.Second
+
+// ScopeTracker is the scope of the notifications of the tracker itself, e.g.
+// the latency over its SLO
+const ScopeTracker = "tracker"
+
+var (
+	ErrBadNotifyEmails = errors.New("bad NOTIFY_EMAILS, expected channel:<name>=<email>,...;tenant:<id>=<email>,...;tracker=<email>,...")
+	ErrNoSMTP          = errors.New("NOTIFY_EMAILS requires SMTP_ADDR and SMTP_FROM")
+)
+
+// notifiers are the notifiers of every scope, "channel:<name>", "tenant:<id>"
+// or ScopeTracker. It is safe for concurrent use
+type notifiers struct {
+	mu     sync.RWMutex
+	scopes map[string][]notify.Notifier
+}
+
+func (n *notifiers) add(scope string, nt notify.Notifier) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.scopes[scope] = append(n.scopes[scope], nt)
+}
+
+func (n *notifiers) of(scope string) []notify.Notifier {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.scopes[scope]
+}
+
+// parseNotifyEmails returns the recipients of every scope of a list of
+// NOTIFY_EMAILS
+func parseNotifyEmails(list string) (map[string][]string, error) {
+	emails := make(map[string][]string)
+	for _, route := range strings.Split(list, ";") {
+		if route = strings.TrimSpace(route); route == "" {
+			continue
+		}
+		scope, to, ok := strings.Cut(route, "=")
+		kind, name, _ := strings.Cut(strings.TrimSpace(scope), ":")
+		isTracker := kind == ScopeTracker && name == ""
+		if !ok || (kind != "channel" && kind != "tenant" && !isTracker) || (name == "" && !isTracker) {
+			return nil, errors.WrapWithContext(ErrBadNotifyEmails, struct{ Route string }{route})
+		}
+		if kind == "channel" {
+			name = strings.ToLower(name)
+		}
+		scope = kind + ":" + name
+		if isTracker {
+			scope = ScopeTracker
+		}
+		for _, addr := range strings.Split(to, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				emails[scope] = append(emails[scope], addr)
+			}
+		}
+		if len(emails[scope]) == 0 {
+			return nil, errors.WrapWithContext(ErrBadNotifyEmails, struct{ Route string }{route})
+		}
+	}
+	return emails, nil
+}
+
+// newNotifiers creates the email notifiers of the configuration. More
+// notifiers can be added with Storage.AddNotifier
+func newNotifiers() *notifiers {
+	n := &notifiers{scopes: make(map[string][]notify.Notifier)}
+	if cfg.NotifyEmails == "" {
+		return n
+	}
+	emails, err := parseNotifyEmails(cfg.NotifyEmails)
+	if err != nil {
+		errors.WrapFatal(err)
+	}
+	if cfg.SMTPAddr == "" || cfg.SMTPFrom == "" {
+		errors.WrapFatal(ErrNoSMTP)
+	}
+	for scope, to := range emails {
+		e, err := notify.NewEmail(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom, to)
+		if err != nil {
+			errors.WrapFatalWithContext(err, struct{ Scope string }{scope})
+		}
+		n.add(scope, e)
+	}
+	return n
+}
+
+// AddNotifier sends the notifications of `scope`, "channel:<name>",
+// "tenant:<id>" or ScopeTracker, to `n` too
+func (s *Storage) AddNotifier(scope string, n notify.Notifier) {
+	if kind, name, ok := strings.Cut(scope, ":"); ok && kind == "channel" {
+		scope = kind + ":" + strings.ToLower(name)
+	}
+	s.notifiers.add(scope, n)
+}
+
+// notify sends the notification to the notifiers of `scope` in the background.
+// Failed notifications are only logged
+func (s *Storage) notify(scope string, n *notify.Notification) {
+	for _, nt := range s.notifiers.of(scope) {
+		nt := nt
+		go func() {
+			ctx, cancel := context.WithTimeout(s.ctx, NotifyTimeout)
+			defer cancel()
+			if err := nt.Notify(ctx, n); err != nil {
+				notificationsFailed.Inc()
+				errors.WrapAndLogWithContext(err, struct{ Scope string }{scope})
+			}
+		}()
+	}
+}
+
+// notifyDigest sends the digest of every channel to its notifiers, and the
+// digest of the channels of every tenant to the notifiers of the tenant
+func (s *Storage) notifyDigest(d *Digest) {
+	for ch, cd := range d.Channels {
+		s.notify("channel:"+ch, digestNotification(d.Day, map[string]*ChannelDigest{ch: cd}))
+	}
+	tenants, err := s.tenantsOfChannels()
+	if err != nil {
+		if !errors.Is(err, ErrUnsupported) {
+			errors.WrapAndLog(err)
+		}
+		return
+	}
+	byTenant := make(map[string]map[string]*ChannelDigest)
+	for ch, cd := range d.Channels {
+		id, ok := tenants[Channel(ch)]
+		if !ok {
+			continue
+		}
+		if byTenant[id] == nil {
+			byTenant[id] = make(map[string]*ChannelDigest)
+		}
+		byTenant[id][ch] = cd
+	}
+	for id, channels := range byTenant {
+		s.notify("tenant:"+id, digestNotification(d.Day, channels))
+	}
+}
+
+// digestNotification returns the digest of the channels in `day` in plain text
+func digestNotification(day time.Time, channels map[string]*ChannelDigest) *notify.Notification {
+	names := make([]string, 0, len(channels))
+	for ch := range channels {
+		names = append(names, ch)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Moderations stored on %s (UTC)\n", day.Format("2006-01-02"))
+	for _, ch := range names {
+		cd := channels[ch]
+		fmt.Fprintf(&b, "\n#%s\n", ch)
+		types := make([]string, 0, len(cd.Moderations))
+		for typ := range cd.Moderations {
+			types = append(types, string(typ))
+		}
+		sort.Strings(types)
+		for _, typ := range types {
+			fmt.Fprintf(&b, "  %s: %d\n", typ, cd.Moderations[message.MessageType(typ)])
+		}
+		h := cd.TimeToAction
+		if h.Count == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "  time to action of %d moderations:\n", h.Count)
+		var counted uint64
+		for i, n := range h.Counts {
+			counted += n
+			if n > 0 {
+				fmt.Fprintf(&b, "    up to %ss: %d\n", strconv.FormatFloat(h.Buckets[i], 'g', -1, 64), n)
+			}
+		}
+		if over := h.Count - counted; over > 0 {
+			fmt.Fprintf(&b, "    over %ss: %d\n", strconv.FormatFloat(h.Buckets[len(h.Buckets)-1], 'g', -1, 64), over)
+		}
+	}
+	return &notify.Notification{
+		Subject: fmt.Sprintf("Daily digest of %s", day.Format("2006-01-02")),
+		Body:    b.String(),
+	}
+}
+
+// notifyIncident sends the summary of an incident of `scope` to its notifiers
+func (s *Storage) notifyIncident(scope, summary string) {
+	s.notify(scope, &notify.Notification{
+		Subject: fmt.Sprintf("Incident in %s", scope),
+		Body:    fmt.Sprintf("%s\n\nAt %s (UTC)\n", summary, s.clock.Now().UTC().Format(time.RFC1123)),
+	})
+}
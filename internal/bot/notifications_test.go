@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/message"
+	"github.com/hammertrack/tracker/internal/metrics"
+)
+
+func TestParseNotifyEmails(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		list string
+		want map[string][]string
+		err  error
+	}{
+		{"", map[string][]string{}, nil},
+		{
+			"channel:Foo=a@foo.tv; tenant:acme=b@acme.com, c@acme.com;",
+			map[string][]string{"channel:foo": {"a@foo.tv"}, "tenant:acme": {"b@acme.com", "c@acme.com"}},
+			nil,
+		},
+		{"foo=a@foo.tv", nil, ErrBadNotifyEmails},
+		{"user:foo=a@foo.tv", nil, ErrBadNotifyEmails},
+		{"channel:foo=", nil, ErrBadNotifyEmails},
+		{"tracker=ops@example.com", map[string][]string{ScopeTracker: {"ops@example.com"}}, nil},
+		{"tracker:foo=ops@example.com", nil, ErrBadNotifyEmails},
+		{"channel:=a@foo.tv", nil, ErrBadNotifyEmails},
+	}
+	for _, tt := range tests {
+		got, err := parseNotifyEmails(tt.list)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%q err got: %v, want: %v", tt.list, err, tt.err)
+			continue
+		}
+		if tt.err == nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q got: %v, want: %v", tt.list, got, tt.want)
+		}
+	}
+}
+
+func TestDigestNotification(t *testing.T) {
+	t.Parallel()
+	h := metrics.NewHistogram([]float64{1, 5})
+	for _, v := range []float64{0.5, 3, 3, 10} {
+		h.Observe(v)
+	}
+	n := digestNotification(time.Date(2023, 7, 19, 0, 0, 0, 0, time.UTC), map[string]*ChannelDigest{
+		"foo": {
+			Moderations:  map[message.MessageType]int{message.MessageTimeout: 3, message.MessageBan: 1},
+			TimeToAction: h,
+		},
+	})
+	want := `Moderations stored on 2023-07-19 (UTC)
+
+#foo
+  ban: 1
+  timeout: 3
+  time to action of 4 moderations:
+    up to 1s: 1
+    up to 5s: 2
+    over 5s: 1
+`
+	if n.Body != want {
+		t.Errorf("got:\n%s\nwant:\n%s", n.Body, want)
+	}
+	if want := "Daily digest of 2023-07-19"; n.Subject != want {
+		t.Errorf("got: %q, want: %q", n.Subject, want)
+	}
+}
@@ -0,0 +1,232 @@
+package bot
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/message"
+	"github.com/hammertrack/tracker/internal/webhook"
+)
+
+const (
+	// OutboxScanInterval is the interval at which the pending notifications of
+	// the outbox are redelivered
+	OutboxScanInterval = time.Minute
+	// OutboxRetryAfter is the age of a pending notification before it is
+	// redelivered, so the ones whose moderation is still being inserted are not
+	OutboxRetryAfter = time.Minute
+	// OutboxBatch is the maximum number of notifications redelivered per scan
+	OutboxBatch = 100
+)
+
+// OutboxEntry is the notification of a stored moderation pending delivery to
+// the webhooks
+type OutboxEntry struct {
+	ID string
+	// At is when the entry was written, not the time of the moderation
+	At time.Time
+	// Payload is the JSON of the moderation, see EventSchema, encrypted if the encryption of the
+	// messages is enabled
+	Payload string
+}
+
+// OutboxStore is implemented by drivers that can keep the notifications of the
+// stored moderations until they are delivered.
+type OutboxStore interface {
+	AddOutbox(e *OutboxEntry) error
+	// PendingOutbox returns at most `limit` entries written before `before`,
+	// oldest first
+	PendingOutbox(before time.Time, limit int) ([]*OutboxEntry, error)
+	RemoveOutbox(e *OutboxEntry) error
+}
+
+// outbox delivers the notifications of the stored moderations with
+// at-least-once semantics. An entry is written before the moderation and only
+// removed once every webhook accepted it, so a restart, a full queue or a
+// failing webhook never lose a notification. The pending entries are
+// redelivered to every webhook, the receivers drop the duplicates by the
+// webhook.HeaderEvent of the deliveries
+type outbox struct {
+	store OutboxStore
+	// inflight are the ids of the entries being delivered
+	inflight sync.Map
+}
+
+// queuedDelivery is a delivery and the dispatcher of its webhook
+type queuedDelivery struct {
+	*webhook.Delivery
+	dispatcher *webhook.Dispatcher
+	// hook is the id of the webhook
+	hook string
+}
+
+// enqueueDeliveries schedules the deliveries without blocking. The ones not
+// queued are done with webhook.ErrQueueFull
+func enqueueDeliveries(dels []*queuedDelivery) {
+	for _, d := range dels {
+		if d.dispatcher.Enqueue(d.Delivery) {
+			continue
+		}
+		dropped.Inc("webhooks")
+		errors.WrapAndLogWithContext(webhook.ErrQueueFull, struct{ Webhook string }{d.hook})
+		if d.Done != nil {
+			d.Done(webhook.ErrQueueFull)
+		}
+	}
+}
+
+// addOutbox writes the entry of the notification of a moderation about to be
+// stored
+func (s *Storage) addOutbox(msg *message.Message) (*OutboxEntry, error) {
+	id, err := randomHex(12)
+	if err != nil {
+		return nil, err
+	}
+	b, err := encodeEvent(msg)
+	if err != nil {
+		return nil, err
+	}
+	e := &OutboxEntry{ID: id, At: s.clock.Now(), Payload: string(b)}
+	if s.cipher != nil {
+		if e.Payload, err = s.cipher.Encrypt(e.Payload, id); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.outbox.store.AddOutbox(e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// decodeOutbox returns the moderation of an entry
+func (s *Storage) decodeOutbox(e *OutboxEntry) (*message.Message, error) {
+	payload := e.Payload
+	if s.cipher != nil {
+		var err error
+		if payload, err = s.cipher.Decrypt(payload, e.ID); err != nil {
+			return nil, err
+		}
+	}
+	return decodeEvent([]byte(payload))
+}
+
+// deliverOutbox delivers the notification of an entry to every webhook, and
+// removes the entry once all of them accepted it. Nothing is done if the entry
+// is already being delivered
+func (s *Storage) deliverOutbox(e *OutboxEntry, msg *message.Message) {
+	if _, loaded := s.outbox.inflight.LoadOrStore(e.ID, true); loaded {
+		return
+	}
+	dels := append(s.banDeliveries(msg), s.tenantDeliveries(msg)...)
+	dels = append(dels, s.groupDeliveries(msg)...)
+	if len(dels) == 0 {
+		s.settleOutbox(e, true)
+		return
+	}
+	pending := int32(len(dels))
+	var failed int32
+	done := func(err error) {
+		if err != nil {
+			atomic.StoreInt32(&failed, 1)
+		}
+		if atomic.AddInt32(&pending, -1) == 0 {
+			s.settleOutbox(e, atomic.LoadInt32(&failed) == 0)
+		}
+	}
+	for _, d := range dels {
+		d.Event = e.ID
+		d.Done = done
+	}
+	enqueueDeliveries(dels)
+}
+
+// settleOutbox ends the delivery of an entry. It is removed if `remove`,
+// otherwise it is kept for the next scan
+func (s *Storage) settleOutbox(e *OutboxEntry, remove bool) {
+	defer s.outbox.inflight.Delete(e.ID)
+	if !remove {
+		return
+	}
+	if err := s.outbox.store.RemoveOutbox(e); err != nil {
+		errors.WrapAndLog(err)
+	}
+}
+
+// redeliverOutbox delivers again the pending entries. The ones whose
+// moderation was never stored, because the insert failed before the entry
+// could be removed, are removed instead
+func (s *Storage) redeliverOutbox() {
+	entries, err := s.outbox.store.PendingOutbox(s.clock.Now().Add(-OutboxRetryAfter), OutboxBatch)
+	if err != nil {
+		errors.WrapAndLog(err)
+		return
+	}
+	for _, e := range entries {
+		if _, ok := s.outbox.inflight.Load(e.ID); ok {
+			continue
+		}
+		msg, err := s.decodeOutbox(e)
+		if errors.Is(err, ErrEventSchema) {
+			// left for the newer tracker sharing the database, e.g. during a
+			// rolling upgrade
+			continue
+		}
+		if err != nil {
+			// it can never be delivered
+			errors.WrapAndLogWithContext(err, struct{ Entry string }{e.ID})
+			s.settleOutbox(e, true)
+			continue
+		}
+		if stored, err := s.storedModeration(msg); err != nil {
+			errors.WrapAndLog(err)
+			continue
+		} else if !stored {
+			s.settleOutbox(e, true)
+			continue
+		}
+		outboxRedeliveries.Inc()
+		s.deliverOutbox(e, msg)
+	}
+}
+
+// storedModeration reports whether the moderation is stored. It is assumed to
+// be if the driver cannot tell
+func (s *Storage) storedModeration(msg *message.Message) (bool, error) {
+	stored, err := s.HasModeration(msg.Username, Channel(msg.Channel), msg.At)
+	if errors.Is(err, ErrUnsupported) {
+		return true, nil
+	}
+	return stored, err
+}
+
+// startOutbox redelivers the pending entries periodically until the storage
+// is stopped, starting with the ones left by the previous run
+func (s *Storage) startOutbox() {
+	tick := time.NewTicker(OutboxScanInterval)
+	defer tick.Stop()
+	for {
+		s.redeliverOutbox()
+		select {
+		case <-tick.C:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// newOutbox creates the outbox of the notifications from the configuration.
+// It returns nil if it is disabled or there are no webhooks to notify
+func newOutbox(d Driver) *outbox {
+	if !cfg.Outbox || (!cfg.BanFeedWebhooks && !cfg.TenantWebhooks) {
+		return nil
+	}
+	store, ok := d.(OutboxStore)
+	if !ok {
+		errors.WrapAndLog(ErrUnsupported)
+		return nil
+	}
+	return &outbox{store: store}
+}
@@ -0,0 +1,132 @@
+package bot
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/message"
+	"github.com/hammertrack/tracker/internal/webhook"
+)
+
+// outboxDriver keeps the entries of the outbox in memory
+type outboxDriver struct {
+	fakeDriver
+	mu      sync.Mutex
+	entries map[string]*OutboxEntry
+	// stored are the times of the stored moderations
+	stored []time.Time
+}
+
+func (d *outboxDriver) HasModeration(username string, ch Channel, at time.Time) (bool, error) {
+	for _, stored := range d.stored {
+		if stored.Equal(at) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (d *outboxDriver) AddOutbox(e *OutboxEntry) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries[e.ID] = e
+	return nil
+}
+
+func (d *outboxDriver) PendingOutbox(before time.Time, limit int) ([]*OutboxEntry, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var entries []*OutboxEntry
+	for _, e := range d.entries {
+		if len(entries) < limit && e.At.Before(before) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func (d *outboxDriver) RemoveOutbox(e *OutboxEntry) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.entries, e.ID)
+	return nil
+}
+
+func (d *outboxDriver) pending() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.entries)
+}
+
+func TestOutbox(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		err     error
+		hooks   bool
+		pending int
+	}{
+		{name: "delivered"},
+		{name: "insert failed", err: errors.New("insert failed")},
+		{name: "webhook failed", hooks: true, pending: 1},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			d := &outboxDriver{entries: make(map[string]*OutboxEntry)}
+			d.err = tt.err
+			s := NewStorage(d)
+			defer s.Stop()
+			s.outbox = &outbox{store: d}
+			if tt.hooks {
+				// the dispatcher is not started and has no queue, so the delivery
+				// fails right away
+				s.hooks = &tenantHooks{
+					dispatcher: webhook.New(1, 0, time.Second),
+					hooks:      map[Channel][]*TenantWebhook{"channel": {{ID: "hook", URL: "https://example.com/hook"}}},
+				}
+			}
+			s.Save(&message.Message{Type: message.MessageBan, Channel: "channel", Username: "user", At: time.Now()})
+			if got := d.pending(); got != tt.pending {
+				t.Fatalf("pending got: %d, want: %d", got, tt.pending)
+			}
+		})
+	}
+}
+
+func TestRedeliverOutbox(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	d := &outboxDriver{entries: make(map[string]*OutboxEntry)}
+	d.stored = []time.Time{now}
+	s := NewStorage(d)
+	defer s.Stop()
+	s.outbox = &outbox{store: d}
+
+	stored, err := s.addOutbox(&message.Message{Type: message.MessageBan, Channel: "channel", Username: "user", At: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lost, err := s.addOutbox(&message.Message{Type: message.MessageBan, Channel: "channel", Username: "user", At: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inflight, err := s.addOutbox(&message.Message{Type: message.MessageBan, Channel: "channel", Username: "user", At: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []*OutboxEntry{stored, lost, inflight} {
+		e.At = now.Add(-2 * OutboxRetryAfter)
+	}
+	s.outbox.inflight.Store(inflight.ID, true)
+
+	s.redeliverOutbox()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.entries) != 1 || d.entries[inflight.ID] == nil {
+		t.Fatalf("got: %v, want: only the entry in flight", d.entries)
+	}
+}
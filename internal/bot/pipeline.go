@@ -0,0 +1,119 @@
+package bot
+
+import (
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/bus"
+	"github.com/hammertrack/tracker/internal/message"
+	"github.com/hammertrack/tracker/internal/scrubber"
+	"github.com/hammertrack/tracker/logger"
+)
+
+// PipelineResult is the outcome of processing a single moderation, whether it
+// was stored or not
+type PipelineResult struct {
+	Channel  string              `json:"channel"`
+	Username string              `json:"username"`
+	Type     message.MessageType `json:"type"`
+	// ModeratedAt is the time of the moderation
+	ModeratedAt time.Time `json:"moderated_at"`
+	Accepted    bool      `json:"accepted"`
+	// Rule is the heuristic rule that rejected the moderation, if any
+	Rule string `json:"rule,omitempty"`
+	// Error is why the moderation could not be stored, if any
+	Error string `json:"error,omitempty"`
+	// Rules are the names of the rules of the pipeline of the moderation and
+	// Verdicts the bitmap of the ones its messages were not compliant with, see
+	// heuristics.Analyzer.Verdicts. Both are only set if the decisions are
+	// logged, see cfg.DecisionsLog
+	Rules    []string `json:"rules,omitempty"`
+	Verdicts uint64   `json:"verdicts,omitempty"`
+	// Redactions are the personal data redacted from the messages, nil if none.
+	// See package scrubber
+	Redactions scrubber.Redactions `json:"redactions,omitempty"`
+	// Truncated is the number of messages whose body was truncated, see
+	// cfg.MaxBodyLength
+	Truncated int `json:"truncated,omitempty"`
+	// Partial is whether enrichments were skipped because the processing went
+	// over its budget, see cfg.EventBudgetMs
+	Partial bool `json:"partial,omitempty"`
+	// EnqueueLatency is the time the moderation waited for the tracker of its
+	// channel, 0 if unknown
+	EnqueueLatency time.Duration `json:"enqueue_latency"`
+	// Spilled is whether the moderation was spilled to disk to be inserted
+	// later, see cfg.SpillDir. InsertLatency is then the time taken to spill it
+	Spilled bool `json:"spilled,omitempty"`
+	// InsertLatency is the time taken by the driver to insert the moderation, 0
+	// if it was not inserted
+	InsertLatency time.Duration `json:"insert_latency"`
+	// Latency is the end-to-end time from the reception of the moderation to
+	// its insert acknowledged by the driver, 0 if unknown or not inserted
+	Latency time.Duration `json:"latency"`
+	Driver  string        `json:"driver"`
+	At      time.Time     `json:"at"`
+}
+
+// BusBuffer is the number of values buffered for every subscriber of the
+// topics of the storage
+const BusBuffer = 256
+
+// BusCloseTimeout is how long stopping the storage waits for the subscribers of
+// its topics to handle the values already published
+const BusCloseTimeout = 10 * time.Second
+
+// Results is the topic of the results of the processed moderations. The same
+// rules of Stored apply
+func (s *Storage) Results() *bus.Topic[*PipelineResult] {
+	return s.results
+}
+
+// newResult starts the result of processing `msg`
+func (s *Storage) newResult(msg *message.Message) *PipelineResult {
+	now := s.clock.Now()
+	r := &PipelineResult{
+		Channel:     msg.Channel,
+		Username:    msg.Username,
+		Type:        msg.Type,
+		ModeratedAt: msg.At,
+		Driver:      s.driverName,
+		At:          now,
+	}
+	if !msg.ReceivedAt.IsZero() {
+		r.EnqueueLatency = now.Sub(msg.ReceivedAt)
+	}
+	return r
+}
+
+// driverName returns the name of the type of the driver, e.g. "cassandra"
+func driverName(d Driver) string {
+	t := reflect.TypeOf(d)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return strings.ToLower(t.Name())
+}
+
+// debugResult writes the latencies of a result to the debug logs of the
+// storage, see logResult
+func debugResult(r *PipelineResult) {
+	logger.Debugf(logger.Storage, "->[#%s] :%s %s via %s, enqueued %s, inserted %s, end-to-end %s", r.Channel, r.Username, r.Type, r.Driver, r.EnqueueLatency, r.InsertLatency, r.Latency)
+}
+
+// logResult logs the result of a moderation
+func logResult(r *PipelineResult) {
+	switch {
+	case r.Spilled:
+		log.Printf("->[#%s] :%s %s spilled to be stored later", r.Channel, r.Username, r.Type)
+	case r.Accepted && r.Redactions != nil:
+		log.Printf("->[#%s] :%s %s stored, redacted %v", r.Channel, r.Username, r.Type, r.Redactions)
+	case r.Accepted:
+		log.Printf("->[#%s] :%s %s stored", r.Channel, r.Username, r.Type)
+	case r.Rule != "":
+		log.Printf("->[#%s] :%s %s rejected by %s", r.Channel, r.Username, r.Type, r.Rule)
+	default:
+		log.Printf("->[#%s] :%s %s failed: %s", r.Channel, r.Username, r.Type, r.Error)
+	}
+}
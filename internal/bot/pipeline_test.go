@@ -0,0 +1,103 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/bus"
+	"github.com/hammertrack/tracker/internal/heuristics/testkit"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+var errInsert = errors.New("insert failed")
+
+// fakeDriver stores nothing, failing every insert with err if not nil
+type fakeDriver struct {
+	err      error
+	inserted int
+}
+
+func (d *fakeDriver) Insert(msg *message.Message) error {
+	if d.err != nil {
+		return d.err
+	}
+	d.inserted++
+	return nil
+}
+
+func (d *fakeDriver) Channels() ([]Channel, error) { return nil, nil }
+func (d *fakeDriver) Close() error                 { return nil }
+
+func TestPipelineResult(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	received := now.Add(-time.Second)
+	privmsg := &message.PrivateMessage{Username: "user", Body: "hello", At: now.Add(-10 * time.Second)}
+	tests := []struct {
+		name     string
+		msg      *message.Message
+		err      error
+		accepted bool
+		rejected bool
+		inserted int
+	}{
+		{
+			name:     "stored",
+			msg:      &message.Message{Type: message.MessageBan, Username: "user", Channel: "channel", At: now, ReceivedAt: received, LastMessages: []*message.PrivateMessage{privmsg}},
+			accepted: true,
+			inserted: 1,
+		},
+		{
+			name:     "rejected",
+			msg:      &message.Message{Type: message.MessageTimeout, Duration: 1, Username: "user", Channel: "channel", At: now, ReceivedAt: received, LastMessages: []*message.PrivateMessage{privmsg}},
+			rejected: true,
+		},
+		{
+			name: "failed",
+			msg:  &message.Message{Type: message.MessageBan, Username: "user", Channel: "channel", At: now, ReceivedAt: received, LastMessages: []*message.PrivateMessage{privmsg}},
+			err:  errInsert,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			d := &fakeDriver{err: tt.err}
+			s := NewStorage(d)
+			s.SetClock(testkit.NewClock(now))
+			results := make(chan *PipelineResult, 1)
+			s.Results().Subscribe("test", 1, bus.Block, func(r *PipelineResult) {
+				results <- r
+			})
+			if got := s.Save(tt.msg); got != tt.accepted {
+				t.Fatalf("Save got: %v, want: %v", got, tt.accepted)
+			}
+			s.Stop()
+
+			r := <-results
+			if r.Accepted != tt.accepted {
+				t.Fatalf("accepted got: %v, want: %v", r.Accepted, tt.accepted)
+			}
+			if (r.Rule != "") != tt.rejected {
+				t.Fatalf("rule got: %q, want rejected: %v", r.Rule, tt.rejected)
+			}
+			wantErr := ""
+			if tt.err != nil {
+				wantErr = tt.err.Error()
+			}
+			if r.Error != wantErr {
+				t.Fatalf("error got: %q, want: %q", r.Error, wantErr)
+			}
+			if !r.At.Equal(now) || r.EnqueueLatency != time.Second {
+				t.Fatalf("got: %v %v, want: %v %v", r.At, r.EnqueueLatency, now, time.Second)
+			}
+			if r.Driver != "fakedriver" {
+				t.Fatalf("driver got: %q, want: %q", r.Driver, "fakedriver")
+			}
+			if d.inserted != tt.inserted {
+				t.Fatalf("inserted got: %d, want: %d", d.inserted, tt.inserted)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package bot
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// TrackerQueueSize is the number of messages of a tracked channel waiting for
+// its go-routine before the source blocks
+const TrackerQueueSize = 100
+
+// WarnInterval is the minimum time between two warnings of the same kind
+const WarnInterval = time.Minute
+
+var (
+	ErrQueueBacklog = errors.New("tracker queue above the warning threshold, the source will block when it is full")
+	ErrInsertErrors = errors.New("failed inserts in the last minute above the warning threshold")
+)
+
+var queues = &queueStats{}
+
+// queueStats keeps the number of messages waiting in the tracker queues and
+// warns when one of them is about to block the source. It is safe for
+// concurrent use.
+type queueStats struct {
+	depth int64
+	peak  int64
+	// warnedAt is the last time a backlog was warned, in unix nanoseconds
+	warnedAt int64
+}
+
+// enqueue sends msg to the tracker queue msgch, counting the time blocked if
+// the queue is full
+func (q *queueStats) enqueue(ch string, msgch chan *message.Message, msg *message.Message) {
+	depth := atomic.AddInt64(&q.depth, 1)
+	for {
+		peak := atomic.LoadInt64(&q.peak)
+		if depth <= peak || atomic.CompareAndSwapInt64(&q.peak, peak, depth) {
+			break
+		}
+	}
+	q.warn(ch, len(msgch), cap(msgch))
+	select {
+	case msgch <- msg:
+	default:
+		start := time.Now()
+		msgch <- msg
+		enqueueBlockedSeconds.Add(time.Since(start).Seconds())
+	}
+}
+
+// dequeue is called for every message taken from a tracker queue
+func (q *queueStats) dequeue() {
+	atomic.AddInt64(&q.depth, -1)
+}
+
+// warn logs ErrQueueBacklog, at most once every WarnInterval, if the queue of
+// `ch` is filled above cfg.QueueWarnRatio
+func (q *queueStats) warn(ch string, n, capacity int) {
+	if cfg.QueueWarnRatio <= 0 || float64(n) < cfg.QueueWarnRatio*float64(capacity) {
+		return
+	}
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&q.warnedAt)
+	if now-last < int64(WarnInterval) || !atomic.CompareAndSwapInt64(&q.warnedAt, last, now) {
+		return
+	}
+	errors.WrapAndLogWithContext(ErrQueueBacklog, struct {
+		Channel string
+		Depth   int
+		Cap     int
+	}{ch, n, capacity})
+}
+
+func (q *queueStats) current() float64 {
+	return float64(atomic.LoadInt64(&q.depth))
+}
+
+func (q *queueStats) max() float64 {
+	return float64(atomic.LoadInt64(&q.peak))
+}
+
+var insertFailures = &errorRate{}
+
+// errorRate counts the failed inserts of the current minute and warns when
+// they reach cfg.InsertErrorsWarnPerMinute. It is safe for concurrent use.
+type errorRate struct {
+	mu     sync.Mutex
+	start  time.Time
+	n      int
+	warned bool
+}
+
+func (e *errorRate) add(driver string, at time.Time) {
+	if cfg.InsertErrorsWarnPerMinute <= 0 {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if at.Sub(e.start) >= WarnInterval {
+		e.start, e.n, e.warned = at, 0, false
+	}
+	e.n++
+	if e.n < cfg.InsertErrorsWarnPerMinute || e.warned {
+		return
+	}
+	e.warned = true
+	errors.WrapAndLogWithContext(ErrInsertErrors, struct {
+		Driver string
+		Errors int
+	}{driver, e.n})
+}
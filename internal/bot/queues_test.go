@@ -0,0 +1,27 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestQueueStats(t *testing.T) {
+	t.Parallel()
+	q := &queueStats{}
+	msgch := make(chan *message.Message, 3)
+	for i := 0; i < 3; i++ {
+		q.enqueue("channel", msgch, &message.Message{})
+	}
+	for i := 0; i < 2; i++ {
+		<-msgch
+		q.dequeue()
+	}
+	q.enqueue("channel", msgch, &message.Message{})
+	if got := q.current(); got != 2 {
+		t.Fatalf("depth got: %v, want: %v", got, 2)
+	}
+	if got := q.max(); got != 3 {
+		t.Fatalf("peak got: %v, want: %v", got, 3)
+	}
+}
@@ -0,0 +1,248 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// Modes of the moderations over the quota, see cfg.QuotaMode
+const (
+	QuotaSample    = "sample"
+	QuotaAggregate = "aggregate"
+)
+
+const (
+	// RuleQuota is the rule of the results of the moderations left out because
+	// their channel or tenant is over its quota
+	RuleQuota = "Quota"
+	// QuotaTenantsRefresh is the interval at which the tenants of the channels
+	// are reloaded
+	QuotaTenantsRefresh = time.Minute
+)
+
+var ErrQuotaMode = errors.New("unknown quota mode, expected sample or aggregate")
+
+// quotaLimit is the daily quota of a channel or a tenant, 0 for no limit
+type quotaLimit struct {
+	moderations int
+	bytes       int
+}
+
+// quotaUsage is what a channel or a tenant stored in the current day
+type quotaUsage struct {
+	moderations int
+	bytes       int
+	// over is the number of moderations received over the quota
+	over int
+	// alerted is whether the quota was exceeded, which is alerted once a day
+	alerted bool
+}
+
+// exceeds reports whether storing `size` more bytes exceeds the limit
+func (u *quotaUsage) exceeds(l quotaLimit, size int) bool {
+	return (l.moderations > 0 && u.moderations+1 > l.moderations) ||
+		(l.bytes > 0 && u.bytes+size > l.bytes)
+}
+
+// quotas keeps the daily usage of the channels and the tenants, so a runaway
+// channel cannot exhaust the cluster. Over its quota, a channel or every
+// channel of a tenant only stores a sample of its moderations, or none, until
+// the next UTC day. It is safe for concurrent use.
+type quotas struct {
+	mode        string
+	sampleEvery int
+	channel     quotaLimit
+	tenant      quotaLimit
+	// load returns the tenant of every channel of a tenant
+	load func() (map[Channel]string, error)
+
+	mu  sync.Mutex
+	day time.Time
+	// usage is by scope, "channel:<name>" or "tenant:<id>"
+	usage   map[string]*quotaUsage
+	tenants map[Channel]string
+}
+
+// use counts the moderation in the usage of the day of `now` of its channel and
+// its tenant. It reports whether it is stored, and the scopes that exceeded
+// their quota with it
+func (q *quotas) use(msg *message.Message, now time.Time) (store bool, exceeded []string) {
+	size := moderationSize(msg)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if day := now.UTC().Truncate(24 * time.Hour); !day.Equal(q.day) {
+		q.day, q.usage = day, make(map[string]*quotaUsage)
+	}
+
+	ch := strings.ToLower(msg.Channel)
+	scopes := []string{"channel:" + ch}
+	limits := []quotaLimit{q.channel}
+	if id, ok := q.tenants[Channel(ch)]; ok {
+		scopes = append(scopes, "tenant:"+id)
+		limits = append(limits, q.tenant)
+	}
+	usages := make([]*quotaUsage, len(scopes))
+	over := false
+	for i, scope := range scopes {
+		u, ok := q.usage[scope]
+		if !ok {
+			u = new(quotaUsage)
+			q.usage[scope] = u
+		}
+		usages[i] = u
+		if !u.exceeds(limits[i], size) {
+			continue
+		}
+		over = true
+		if !u.alerted {
+			u.alerted = true
+			exceeded = append(exceeded, scope)
+		}
+	}
+
+	store = true
+	if over {
+		// sampled by channel, even when its tenant is the one over the quota
+		usages[0].over++
+		store = q.mode == QuotaSample && (usages[0].over-1)%q.sampleEvery == 0
+	}
+	if store {
+		for _, u := range usages {
+			u.moderations++
+			u.bytes += size
+		}
+	}
+	return store, exceeded
+}
+
+// overQuota returns the scopes over their quota in the current day
+func (q *quotas) overQuota(now time.Time) []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !now.UTC().Truncate(24 * time.Hour).Equal(q.day) {
+		return nil
+	}
+	var scopes []string
+	for scope, u := range q.usage {
+		if u.alerted {
+			scopes = append(scopes, scope)
+		}
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+func (q *quotas) refresh() {
+	tenants, err := q.load()
+	if err != nil {
+		if !errors.Is(err, ErrUnsupported) {
+			errors.WrapAndLog(err)
+		}
+		return
+	}
+	q.mu.Lock()
+	q.tenants = tenants
+	q.mu.Unlock()
+}
+
+// Start reloads the tenants of the channels periodically until ctx is done.
+// They are only needed by the quotas of the tenants
+func (q *quotas) Start(ctx context.Context) {
+	if q.tenant == (quotaLimit{}) {
+		return
+	}
+	tick := time.NewTicker(QuotaTenantsRefresh)
+	defer tick.Stop()
+	for {
+		q.refresh()
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// quota reports whether the moderation is stored according to the quotas of
+// its channel and its tenant, alerting of the quotas it exceeds
+func (s *Storage) quota(msg *message.Message) bool {
+	store, exceeded := s.quotas.use(msg, s.clock.Now())
+	for _, scope := range exceeded {
+		summary := fmt.Sprintf("%s exceeded its daily quota, its moderations are stored in %s mode until the end of the day", scope, s.quotas.mode)
+		log.Print(summary)
+		quotasExceeded.Inc(scope[:strings.Index(scope, ":")])
+		s.auditTenant("quota-exceeded", "quotas", scope)
+		s.notifyIncident(scope, summary)
+	}
+	return store
+}
+
+// OverQuota returns the channels and the tenants over their daily quota, as
+// "channel:<name>" and "tenant:<id>"
+func (s *Storage) OverQuota() []string {
+	if s.quotas == nil {
+		return nil
+	}
+	return s.quotas.overQuota(s.clock.Now())
+}
+
+// tenantsOfChannels returns the tenant of every channel of a tenant
+func (s *Storage) tenantsOfChannels() (map[Channel]string, error) {
+	tenants, err := s.Tenants()
+	if err != nil {
+		return nil, err
+	}
+	byChannel := make(map[Channel]string)
+	for _, t := range tenants {
+		chs, err := s.TenantChannels(t.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, ch := range chs {
+			byChannel[Channel(strings.ToLower(string(ch)))] = t.ID
+		}
+	}
+	return byChannel, nil
+}
+
+// moderationSize returns the bytes of the moderation counted in the quotas
+func moderationSize(msg *message.Message) int {
+	size := len(msg.Channel) + len(msg.Username) + len(msg.Reason)
+	for _, privmsg := range msg.LastMessages {
+		size += len(privmsg.Body)
+	}
+	return size
+}
+
+// newQuotas returns nil if there are no quotas
+func newQuotas(load func() (map[Channel]string, error)) *quotas {
+	channel := quotaLimit{cfg.QuotaModerationsPerDay, cfg.QuotaBytesPerDay}
+	tenant := quotaLimit{cfg.TenantQuotaModerationsPerDay, cfg.TenantQuotaBytesPerDay}
+	if channel == (quotaLimit{}) && tenant == (quotaLimit{}) {
+		return nil
+	}
+	if cfg.QuotaMode != QuotaSample && cfg.QuotaMode != QuotaAggregate {
+		errors.WrapFatalWithContext(ErrQuotaMode, struct{ Mode string }{cfg.QuotaMode})
+	}
+	q := &quotas{
+		mode:        cfg.QuotaMode,
+		sampleEvery: cfg.QuotaSampleEvery,
+		channel:     channel,
+		tenant:      tenant,
+		load:        load,
+		usage:       make(map[string]*quotaUsage),
+	}
+	if q.sampleEvery < 1 {
+		q.sampleEvery = 1
+	}
+	return q
+}
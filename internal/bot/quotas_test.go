@@ -0,0 +1,87 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestQuotas(t *testing.T) {
+	t.Parallel()
+	day := time.Date(2023, 7, 19, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		q        *quotas
+		channels []string
+		at       []time.Time
+		// stored are the moderations stored, by index
+		stored   []bool
+		exceeded [][]string
+	}{
+		{
+			name:     "sample",
+			q:        &quotas{mode: QuotaSample, sampleEvery: 2, channel: quotaLimit{moderations: 2}},
+			channels: []string{"a", "a", "a", "a", "a", "a"},
+			stored:   []bool{true, true, true, false, true, false},
+			exceeded: [][]string{nil, nil, {"channel:a"}, nil, nil, nil},
+		},
+		{
+			name:     "aggregate by channel",
+			q:        &quotas{mode: QuotaAggregate, sampleEvery: 1, channel: quotaLimit{moderations: 1}},
+			channels: []string{"a", "b", "A", "b"},
+			stored:   []bool{true, true, false, false},
+			exceeded: [][]string{nil, nil, {"channel:a"}, {"channel:b"}},
+		},
+		{
+			name: "tenant",
+			q: &quotas{
+				mode:        QuotaAggregate,
+				sampleEvery: 1,
+				tenant:      quotaLimit{moderations: 2},
+				tenants:     map[Channel]string{"a": "t", "b": "t"},
+			},
+			channels: []string{"a", "b", "c", "a", "c"},
+			stored:   []bool{true, true, true, false, true},
+			exceeded: [][]string{nil, nil, nil, {"tenant:t"}, nil},
+		},
+		{
+			name:     "reset the next day",
+			q:        &quotas{mode: QuotaAggregate, sampleEvery: 1, channel: quotaLimit{moderations: 1}},
+			channels: []string{"a", "a", "a"},
+			at:       []time.Time{day, day, day.Add(14 * time.Hour)},
+			stored:   []bool{true, false, true},
+			exceeded: [][]string{nil, {"channel:a"}, nil},
+		},
+		{
+			name:     "bytes",
+			q:        &quotas{mode: QuotaAggregate, sampleEvery: 1, channel: quotaLimit{bytes: 10}},
+			channels: []string{"a", "a"},
+			stored:   []bool{true, false},
+			exceeded: [][]string{nil, {"channel:a"}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.q.usage = make(map[string]*quotaUsage)
+			for i, ch := range tt.channels {
+				at := day
+				if tt.at != nil {
+					at = tt.at[i]
+				}
+				// 7 bytes
+				msg := &message.Message{Channel: ch, Username: "user", LastMessages: []*message.PrivateMessage{{Body: "hi"}}}
+				store, exceeded := tt.q.use(msg, at)
+				if store != tt.stored[i] {
+					t.Errorf("%d stored got: %v, want: %v", i, store, tt.stored[i])
+				}
+				if !reflect.DeepEqual(exceeded, tt.exceeded[i]) {
+					t.Errorf("%d exceeded got: %v, want: %v", i, exceeded, tt.exceeded[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/helix"
+)
+
+// Rename is a change of the login of a twitch user, observed by DetectRenames
+type Rename struct {
+	UserID     string    `json:"user_id"`
+	OldLogin   string    `json:"old_login"`
+	NewLogin   string    `json:"new_login"`
+	ObservedAt time.Time `json:"observed_at"`
+}
+
+// RenamesReport summarizes a run of DetectRenames
+type RenamesReport struct {
+	Users   int
+	Renames []*Rename
+}
+
+// Log logs the report, a line per rename
+func (r *RenamesReport) Log() {
+	log.Printf("%d users, %d renames", r.Users, len(r.Renames))
+	for _, rn := range r.Renames {
+		log.Printf("  %s: %s -> %s", rn.UserID, rn.OldLogin, rn.NewLogin)
+	}
+}
+
+// RenameStore is implemented by drivers that keep the logins seen for every
+// twitch user id, so the moderations of a user can be found by any of its
+// logins.
+type RenameStore interface {
+	// UserLogins calls fn with every user id and its logins, the most recently
+	// seen first
+	UserLogins(fn func(userID string, logins []string) error) error
+	// LoginsOf returns every login seen for the user id
+	LoginsOf(userID string) ([]string, error)
+	// UserIDsOf returns the user ids that have had the login
+	UserIDsOf(login string) ([]string, error)
+	RecordRename(r *Rename) error
+}
+
+// aliases returns every login of the users that have had the login, including
+// the login itself
+func (s *Storage) aliases(login string) ([]string, error) {
+	rs, ok := s.driver.(RenameStore)
+	if !ok {
+		return []string{login}, nil
+	}
+	ids, err := rs.UserIDsOf(login)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{login: true}
+	all := []string{login}
+	for _, id := range ids {
+		logins, err := rs.LoginsOf(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range logins {
+			if !seen[l] {
+				seen[l] = true
+				all = append(all, l)
+			}
+		}
+	}
+	return all, nil
+}
+
+// DetectRenames compares the logins seen for every user id with their current
+// login in twitch and records the renames. Nothing is recorded if dryRun is
+// true
+func DetectRenames(ctx context.Context, sto *Storage, h *helix.Client, dryRun bool) (*RenamesReport, error) {
+	rs, ok := sto.driver.(RenameStore)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	report := &RenamesReport{}
+	// latest is the most recently seen login of every user id, and seen all the
+	// logins seen of every user id
+	latest := make(map[string]string)
+	seen := make(map[string]map[string]bool)
+	if err := rs.UserLogins(func(userID string, logins []string) error {
+		latest[userID] = logins[0]
+		seen[userID] = make(map[string]bool, len(logins))
+		for _, l := range logins {
+			seen[userID][l] = true
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(latest))
+	for id := range latest {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	report.Users = len(ids)
+
+	users, err := h.UsersByID(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	now := sto.clock.Now()
+	for _, u := range users {
+		login := strings.ToLower(u.Login)
+		if seen[u.ID] == nil || seen[u.ID][login] {
+			continue
+		}
+		r := &Rename{UserID: u.ID, OldLogin: latest[u.ID], NewLogin: login, ObservedAt: now}
+		report.Renames = append(report.Renames, r)
+		if dryRun {
+			continue
+		}
+		if err := rs.RecordRename(r); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,36 @@
+package bot
+
+import (
+	"strings"
+	"time"
+)
+
+// RepairReport summarizes a repair of the denormalized moderation tables
+type RepairReport struct {
+	Channel string
+	// Scanned is the number of rows read from both tables
+	Scanned int
+	// MissingByUser and MissingByChannel are the rows only present in the other
+	// table, that were copied to it unless DryRun
+	MissingByUser    int
+	MissingByChannel int
+	DryRun           bool
+}
+
+// Repairer is implemented by drivers that write every moderation to more than
+// one table without atomicity, so the tables can diverge when one of the
+// writes fails.
+type Repairer interface {
+	// Repair copies the moderations of channel `ch` between `from` and `to`
+	// that are missing from one of the tables, or only reports them if dryRun
+	Repair(ch Channel, from, to time.Time, dryRun bool) (*RepairReport, error)
+}
+
+// Repair reconciles the tables of the moderations of the channel. See Repairer
+func (s *Storage) Repair(ch Channel, from, to time.Time, dryRun bool) (*RepairReport, error) {
+	r, ok := s.driver.(Repairer)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return r.Repair(Channel(strings.ToLower(string(ch))), from, to, dryRun)
+}
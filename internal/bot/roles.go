@@ -0,0 +1,96 @@
+package bot
+
+import (
+	"strings"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+// Role is what an API key of a tenant can do. Every role can do what the
+// roles below it can:
+//
+//   - RoleViewer reads the moderations, bans and stats of the channels
+//   - RoleModerator also looks up the moderation history of single users
+//   - RoleAdmin also changes the settings of the tenant, e.g. its ban feeds
+type Role string
+
+const (
+	RoleViewer    Role = "viewer"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+var ErrUnknownRole = errors.New("unknown role, it must be viewer, moderator or admin")
+
+var roleRanks = map[Role]int{
+	RoleViewer:    1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+// ParseRole returns the role named `s`, or ErrUnknownRole
+func ParseRole(s string) (Role, error) {
+	r := Role(strings.ToLower(s))
+	if _, ok := roleRanks[r]; !ok {
+		return "", ErrUnknownRole
+	}
+	return r, nil
+}
+
+// Allows reports whether the role can do what `required` can
+func (r Role) Allows(required Role) bool {
+	return roleRanks[r] >= roleRanks[required]
+}
+
+// Access is what an API key grants: a role over the channels of its tenant,
+// or only over some of them
+type Access struct {
+	// KeyID is the id of the API key
+	KeyID  string
+	Tenant *Tenant
+	Role   Role
+	// Channels are the channels of the tenant the key is scoped to, all of
+	// them if empty
+	Channels []Channel
+}
+
+// Allows reports whether the access has the role `required` over the channel
+// `ch`, or over the whole tenant if empty, which the keys scoped to some
+// channels don't have. It does not check that the channel belongs to the
+// tenant
+func (a *Access) Allows(required Role, ch Channel) bool {
+	if !a.Role.Allows(required) {
+		return false
+	}
+	if ch == "" {
+		return len(a.Channels) == 0
+	}
+	return a.Scopes(ch)
+}
+
+// Scopes reports whether the channel is in the scope of the access
+func (a *Access) Scopes(ch Channel) bool {
+	if len(a.Channels) == 0 {
+		return true
+	}
+	for _, sch := range a.Channels {
+		if strings.EqualFold(string(sch), string(ch)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scope returns the channels of `chs` in the scope of the access
+func (a *Access) Scope(chs []Channel) []Channel {
+	if len(a.Channels) == 0 {
+		return chs
+	}
+	scoped := make([]Channel, 0, len(chs))
+	for _, ch := range chs {
+		if a.Scopes(ch) {
+			scoped = append(scoped, ch)
+		}
+	}
+	return scoped
+}
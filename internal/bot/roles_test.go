@@ -0,0 +1,41 @@
+package bot
+
+import "testing"
+
+func TestAccessAllows(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		access   Access
+		required Role
+		ch       Channel
+		want     bool
+	}{
+		{name: "same role", access: Access{Role: RoleViewer}, required: RoleViewer, ch: "foo", want: true},
+		{name: "higher role", access: Access{Role: RoleAdmin}, required: RoleModerator, ch: "foo", want: true},
+		{name: "lower role", access: Access{Role: RoleViewer}, required: RoleModerator, ch: "foo", want: false},
+		{name: "unscoped tenant", access: Access{Role: RoleAdmin}, required: RoleAdmin, want: true},
+		{name: "in scope", access: Access{Role: RoleModerator, Channels: []Channel{"foo"}}, required: RoleViewer, ch: "Foo", want: true},
+		{name: "out of scope", access: Access{Role: RoleModerator, Channels: []Channel{"foo"}}, required: RoleViewer, ch: "bar", want: false},
+		{name: "scoped tenant", access: Access{Role: RoleAdmin, Channels: []Channel{"foo"}}, required: RoleAdmin, want: false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.access.Allows(tt.required, tt.ch); got != tt.want {
+				t.Errorf("got: %v, want: %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	t.Parallel()
+	if got, err := ParseRole("Moderator"); err != nil || got != RoleModerator {
+		t.Errorf("got: %v %v, want: %v", got, err, RoleModerator)
+	}
+	if _, err := ParseRole("owner"); err != ErrUnknownRole {
+		t.Errorf("got: %v, want: %v", err, ErrUnknownRole)
+	}
+}
@@ -0,0 +1,74 @@
+package bot
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/encryption"
+)
+
+// MinSearchLength is the minimum number of characters of a search
+const MinSearchLength = 3
+
+var ErrSearchQuery = errors.New("the search must have at least 3 characters and no %")
+
+// Searcher is implemented by drivers that can find the moderations by the
+// content of their messages.
+type Searcher interface {
+	// SearchModerations returns at most `limit` moderations with a message
+	// containing `q`, lowercased, only in the channels `chs` if not empty. The
+	// moderations are not necessarily the most recent ones matching
+	SearchModerations(q string, chs []Channel, limit int) ([]*Moderation, error)
+}
+
+// SearchModerations returns the moderations with a message containing `q`,
+// whatever its case, in the channels `chs`, or in every channel if nil. Only
+// the messages stored in clear are found, neither encrypted nor compressed,
+// and the soft-deleted moderations are left out after the limit, see Corrector
+func (s *Storage) SearchModerations(q string, chs []Channel, limit int) ([]*Moderation, error) {
+	q = strings.ToLower(strings.TrimSpace(q))
+	if utf8.RuneCountInString(q) < MinSearchLength || strings.Contains(q, "%") {
+		return nil, ErrSearchQuery
+	}
+	sr, ok := s.driver.(Searcher)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	// no channel in the scope, e.g. a tenant without channels yet
+	if chs != nil && len(chs) == 0 {
+		return []*Moderation{}, nil
+	}
+	lowered := make([]Channel, len(chs))
+	for i, ch := range chs {
+		lowered[i] = Channel(strings.ToLower(string(ch)))
+	}
+	mods, err := sr.SearchModerations(q, lowered, limit)
+	if err != nil {
+		return nil, err
+	}
+	all := make([]*Moderation, 0, len(mods))
+	for _, m := range mods {
+		if m.Deleted {
+			continue
+		}
+		s.decrypt(m)
+		all = append(all, m)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].At.After(all[j].At)
+	})
+	return all, nil
+}
+
+// searchText returns the text of the messages indexed for the searches, empty
+// if they are not stored in clear
+func searchText(msgs []string) string {
+	for _, body := range msgs {
+		if encryption.IsEncrypted(body) {
+			return ""
+		}
+	}
+	return strings.ToLower(strings.Join(msgs, "\n"))
+}
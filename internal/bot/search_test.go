@@ -0,0 +1,68 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestSearchModerations(t *testing.T) {
+	t.Parallel()
+	s := NewStorage(NewMemoryStorage(10))
+	defer s.Stop()
+
+	now := time.Now()
+	for i, mod := range []struct {
+		channel string
+		body    string
+	}{
+		{"foo", "get FREE bits here"},
+		{"bar", "free bits again"},
+		{"foo", "hello"},
+	} {
+		msg := &message.Message{
+			Type:         message.MessageBan,
+			Channel:      mod.channel,
+			Username:     "user",
+			At:           now.Add(time.Duration(i) * time.Minute),
+			LastMessages: []*message.PrivateMessage{{Username: "user", Body: mod.body}},
+		}
+		if !s.Save(msg) {
+			t.Fatalf("moderation %d was not stored", i)
+		}
+	}
+
+	tests := []struct {
+		name string
+		q    string
+		chs  []Channel
+		want []string
+		err  error
+	}{
+		{name: "every channel", q: "Free Bits", want: []string{"bar", "foo"}},
+		{name: "scoped", q: "free bits", chs: []Channel{"Foo"}, want: []string{"foo"}},
+		{name: "no channels", q: "free bits", chs: []Channel{}},
+		{name: "too short", q: " fr ", err: ErrSearchQuery},
+		{name: "wildcard", q: "free%", err: ErrSearchQuery},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := s.SearchModerations(tt.q, tt.chs, 10)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error got: %v, want: %v", err, tt.err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got: %v moderations, want: %v", len(got), len(tt.want))
+			}
+			for i, m := range got {
+				if m.Channel != tt.want[i] {
+					t.Errorf("got: %v, want: %v", m.Channel, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/message"
+	"github.com/hammertrack/tracker/internal/spill"
+)
+
+// SpillRetryMin and SpillRetryMax bound the wait between the inserts of a
+// spilled moderation while the database is still down
+const (
+	SpillRetryMin = time.Second
+	SpillRetryMax = time.Minute
+)
+
+var spillUsage = &spillStats{}
+
+// spillStats keeps the usage of the spill for its gauges
+type spillStats struct {
+	records int64
+	bytes   int64
+}
+
+func (u *spillStats) set(q *spill.Queue) {
+	atomic.StoreInt64(&u.records, int64(q.Len()))
+	atomic.StoreInt64(&u.bytes, q.Size())
+}
+
+func (u *spillStats) currentRecords() float64 {
+	return float64(atomic.LoadInt64(&u.records))
+}
+
+func (u *spillStats) currentBytes() float64 {
+	return float64(atomic.LoadInt64(&u.bytes))
+}
+
+// spiller keeps on disk the moderations that failed to be inserted, and
+// inserts them in order once the database is back
+type spiller struct {
+	q *spill.Queue
+	// pushed wakes up the replay when a moderation is spilled
+	pushed chan struct{}
+}
+
+// pending reports whether there are spilled moderations not inserted yet
+func (sp *spiller) pending() bool {
+	return sp.q.Len() > 0
+}
+
+func (sp *spiller) push(msg *message.Message) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if err := sp.q.Push(b); err != nil {
+		if errors.Is(err, spill.ErrFull) {
+			dropped.Inc("spill")
+		}
+		return err
+	}
+	spillUsage.set(sp.q)
+	moderationsSpilled.Inc()
+	select {
+	case sp.pushed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// pop removes the oldest spilled moderation
+func (sp *spiller) pop() {
+	if err := sp.q.Pop(); err != nil {
+		errors.WrapAndLog(err)
+	}
+	spillUsage.set(sp.q)
+}
+
+// replay inserts the spilled moderations in order until ctx is done. The
+// oldest one is retried until it is inserted, the newer ones wait for it
+func (sp *spiller) replay(ctx context.Context, insert func(*message.Message) error) {
+	wait := SpillRetryMin
+	for {
+		rec, err := sp.q.Peek()
+		if errors.Is(err, spill.ErrEmpty) {
+			select {
+			case <-sp.pushed:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err == nil {
+			msg := new(message.Message)
+			if err := json.Unmarshal(rec, msg); err != nil {
+				// it would never be inserted and the rest would wait forever
+				errors.WrapAndLog(err)
+				dropped.Inc("spill")
+				sp.pop()
+				continue
+			}
+			if err = insert(msg); err == nil {
+				spillReplayed.Inc()
+				sp.pop()
+				wait = SpillRetryMin
+				continue
+			}
+		}
+		errors.WrapAndLog(err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+		if wait *= 2; wait > SpillRetryMax {
+			wait = SpillRetryMax
+		}
+	}
+}
+
+func (sp *spiller) Close() error {
+	return sp.q.Close()
+}
+
+// newSpiller returns nil if the moderations that fail to be inserted are lost
+func newSpiller() *spiller {
+	if cfg.SpillDir == "" {
+		return nil
+	}
+	q, err := spill.Open(cfg.SpillDir, int64(cfg.SpillMaxMB)<<20)
+	if err != nil {
+		errors.WrapFatalWithContext(err, struct{ SpillDir string }{cfg.SpillDir})
+	}
+	if n := q.Len(); n > 0 {
+		log.Printf("%d moderations spilled by the previous run are inserted before the new ones", n)
+	}
+	spillUsage.set(q)
+	return &spiller{q: q, pushed: make(chan struct{}, 1)}
+}
+
+// insert inserts the moderation with the driver. If the spill is enabled, the
+// moderation is spilled if the insert fails or earlier moderations are still
+// spilled, so they are inserted in order, and res.Spilled is set
+func (s *Storage) insert(msg *message.Message, res *PipelineResult) error {
+	if s.spill == nil {
+		return s.driver.Insert(msg)
+	}
+	if !s.spill.pending() {
+		err := s.driver.Insert(msg)
+		if err == nil {
+			return nil
+		}
+		errors.WrapAndLog(err)
+	}
+	if err := s.spill.push(msg); err != nil {
+		return err
+	}
+	res.Spilled = true
+	return nil
+}
@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/message"
+	"github.com/hammertrack/tracker/internal/spill"
+)
+
+// downDriver fails every insert while down, and keeps the users of the
+// inserted moderations in order
+type downDriver struct {
+	mu    sync.Mutex
+	down  bool
+	users []string
+}
+
+func (d *downDriver) Insert(msg *message.Message) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.down {
+		return errInsert
+	}
+	d.users = append(d.users, msg.Username)
+	return nil
+}
+
+func (d *downDriver) setDown(down bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.down = down
+}
+
+func (d *downDriver) inserted() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.users...)
+}
+
+func (d *downDriver) Channels() ([]Channel, error) { return nil, nil }
+func (d *downDriver) Close() error                 { return nil }
+
+func TestSpill(t *testing.T) {
+	t.Parallel()
+	q, err := spill.Open(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &downDriver{down: true}
+	s := &Storage{driver: d, spill: &spiller{q: q, pushed: make(chan struct{}, 1)}}
+	defer s.spill.Close()
+
+	save := func(username string) *PipelineResult {
+		res := &PipelineResult{}
+		msg := &message.Message{Type: message.MessageBan, Channel: "channel", Username: username, At: time.Now()}
+		if err := s.insert(msg, res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	// the database is back, but the second waits for the first
+	for _, username := range []string{"first", "second"} {
+		if res := save(username); !res.Spilled {
+			t.Fatalf("%s got: %v, want: %v", username, res.Spilled, true)
+		}
+		d.setDown(false)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.spill.replay(ctx, d.Insert)
+	deadline := time.Now().Add(5 * time.Second)
+	for s.spill.pending() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if res := save("third"); res.Spilled {
+		t.Errorf("third got: %v, want: %v", res.Spilled, false)
+	}
+	got := d.inserted()
+	want := []string{"first", "second", "third"}
+	if len(got) != len(want) {
+		t.Fatalf("got: %v, want: %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got: %v, want: %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+)
+
+// Phases of the startup of the bot, in order, see Start
+const (
+	// PhaseChannels loads the tracked channels from the storage
+	PhaseChannels = "channels"
+	// PhaseTracker spawns the go-routine of every tracked channel
+	PhaseTracker = "tracker"
+	// PhaseSource connects to the IRC server or the EventSub websocket
+	PhaseSource = "source"
+)
+
+var ErrStartupTimeout = errors.New("startup phase timed out")
+
+// StartupPhase is the state of a phase of the startup
+type StartupPhase struct {
+	Name      string    `json:"name"`
+	StartedAt time.Time `json:"started_at"`
+	// DurationMs is set once the phase is done
+	DurationMs int64  `json:"duration_ms"`
+	Done       bool   `json:"done"`
+	Error      string `json:"error,omitempty"`
+}
+
+// startupReport records the phases of the startup. It is safe for concurrent
+// use
+type startupReport struct {
+	mu     sync.Mutex
+	phases []*StartupPhase
+}
+
+func (r *startupReport) begin(name string) *StartupPhase {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := &StartupPhase{Name: name, StartedAt: time.Now()}
+	r.phases = append(r.phases, p)
+	return p
+}
+
+func (r *startupReport) end(p *StartupPhase, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p.DurationMs = time.Since(p.StartedAt).Milliseconds()
+	p.Done = true
+	if err != nil {
+		p.Error = err.Error()
+	}
+}
+
+// copy returns a copy of the phases started so far
+func (r *startupReport) copy() []*StartupPhase {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	phases := make([]*StartupPhase, len(r.phases))
+	for i, p := range r.phases {
+		cp := *p
+		phases[i] = &cp
+	}
+	return phases
+}
+
+// Startup returns the phases of the startup started so far, see Start
+func (b *Bot) Startup() []*StartupPhase {
+	return b.startup.copy()
+}
+
+// phase runs fn as the phase `name` of the startup. It fails with
+// ErrStartupTimeout if fn takes longer than STARTUP_PHASE_TIMEOUT_SECONDS, or
+// with the error of ctx if it is done first. fn is left running in both
+// cases, it should return once its context is done
+func (b *Bot) phase(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	p := b.startup.begin(name)
+	log.Printf("startup: %s...", name)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.StartupPhaseTimeoutSeconds)*time.Second)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = errors.WrapWithContext(ErrStartupTimeout, struct {
+				Phase   string
+				Timeout int
+			}{name, cfg.StartupPhaseTimeoutSeconds})
+		}
+	}
+	b.startup.end(p, err)
+	if err != nil {
+		return err
+	}
+	log.Printf("startup: %s done in %dms", name, p.DurationMs)
+	return nil
+}
+
+// logStartup logs the phases of the startup as a single JSON line, like
+// logSummary
+func (b *Bot) logStartup() {
+	data, err := json.Marshal(b.Startup())
+	if err != nil {
+		errors.WrapAndLog(err)
+		return
+	}
+	log.Printf("startup report: %s", data)
+}
@@ -0,0 +1,48 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+func TestPhase(t *testing.T) {
+	t.Parallel()
+	failed := errors.New("failed")
+	block := func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		fn      func(ctx context.Context) error
+		want    error
+	}{
+		{name: "done", fn: func(ctx context.Context) error { return nil }},
+		{name: "failed", fn: func(ctx context.Context) error { return failed }, want: failed},
+		{name: "timed out", timeout: time.Millisecond, fn: block, want: ErrStartupTimeout},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			b := New()
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			if err := b.phase(ctx, tt.name, tt.fn); !errors.Is(err, tt.want) {
+				t.Fatalf("got: %v, want: %v", err, tt.want)
+			}
+			phases := b.Startup()
+			if len(phases) != 1 || !phases[0].Done || (phases[0].Error != "") != (tt.want != nil) {
+				t.Fatalf("got: %+v, want: the phase %s done", phases, tt.name)
+			}
+		})
+	}
+}
@@ -3,14 +3,33 @@ package bot
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/accounts"
+	"github.com/hammertrack/tracker/internal/blocklist"
+	"github.com/hammertrack/tracker/internal/bus"
+	"github.com/hammertrack/tracker/internal/clock"
+	"github.com/hammertrack/tracker/internal/compress"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/emotes"
+	"github.com/hammertrack/tracker/internal/encryption"
+	"github.com/hammertrack/tracker/internal/export"
+	"github.com/hammertrack/tracker/internal/helix"
 	"github.com/hammertrack/tracker/internal/heuristics"
+	"github.com/hammertrack/tracker/internal/links"
 	"github.com/hammertrack/tracker/internal/message"
+	"github.com/hammertrack/tracker/internal/metrics"
+	"github.com/hammertrack/tracker/internal/modcmd"
+	"github.com/hammertrack/tracker/internal/sampling"
+	"github.com/hammertrack/tracker/internal/scoring"
+	"github.com/hammertrack/tracker/internal/scrubber"
+	"github.com/hammertrack/tracker/internal/tags"
 )
 
 const (
@@ -21,28 +40,380 @@ const (
 	// Exclusive minimum number of seconds that has to happen for the moderation
 	// to be considered human
 	MinHumanlyPossible float64 = .9
+	// Exclusive maximum ratio of third-party emotes of the words of a stored
+	// message, and minimum words for it to apply. See RuleMaxEmoteDensity
+	MaxEmoteDensity      = .8
+	MinEmoteDensityWords = 3
+	// Buckets of the flood window, the counts are of the window minus up to a
+	// bucket. See cfg.FloodMessages
+	FloodBuckets = 3
 )
 
-var ErrUncachedChannels = errors.New("Postgres storage layer requires to be called with OptimizeChannels() before starting")
+var (
+	ErrUnknownScrubPattern  = errors.New("unknown scrubber pattern")
+	ErrUnknownEmoteProvider = errors.New("unknown third-party emote provider")
+)
+
+var ErrUnsupported = errors.New("operation not supported by the storage driver")
+
+var ErrChannelTracked = errors.New("channel already tracked by a shard")
 
 type Driver interface {
-	Insert(msg *message.Message)
+	// Insert stores the moderation. Errors of the data derived from it, e.g.
+	// the logins of the user, are only logged
+	Insert(msg *message.Message) error
 	Channels() ([]Channel, error)
 	Close() error
 }
 
+// Purger is implemented by drivers that can remove all the stored data of a
+// user.
+type Purger interface {
+	// PurgeUser deletes all the rows of the logins of a user across all the
+	// tables, including the logins and user ids recorded for them. If dryRun is
+	// true nothing is deleted but the report is filled as if it was.
+	PurgeUser(logins []string, dryRun bool) (*PurgeReport, error)
+}
+
+// Reader is implemented by drivers that can query the stored moderations.
+type Reader interface {
+	// UserModerations returns the most recent moderations of `username` in the
+	// channel `ch`, or in every channel if ch is empty.
+	UserModerations(username string, ch Channel, limit int) ([]*Moderation, error)
+	// ChannelModerations calls fn with every moderation in the channel `ch`
+	// between `from` and `to`, stopping at the first error.
+	ChannelModerations(ch Channel, from, to time.Time, fn func(*Moderation) error) error
+}
+
+// TagReader is implemented by drivers that can filter the moderations of a
+// user by tag before limiting them.
+type TagReader interface {
+	// TaggedUserModerations is UserModerations of the moderations tagged with
+	// `tag`
+	TaggedUserModerations(username string, ch Channel, tag string, limit int) ([]*Moderation, error)
+}
+
+// Deduplicator is implemented by drivers that can tell whether a moderation is
+// already stored.
+type Deduplicator interface {
+	// HasModeration reports whether a moderation of `username` in `ch` at `at`
+	// is stored
+	HasModeration(username string, ch Channel, at time.Time) (bool, error)
+}
+
+// MessageCompressor is implemented by drivers that can compress the messages
+// of the moderations stored before the compression was enabled.
+type MessageCompressor interface {
+	// CompressMessages replaces the messages of the uncompressed moderations of
+	// channel `ch` between `from` and `to` with the blob returned by seal, and
+	// returns how many were compressed, or would be if dryRun
+	CompressMessages(ch Channel, from, to time.Time, dryRun bool, seal func(username string, msgs []string) ([]byte, error)) (int, error)
+}
+
+// AccountWriter is implemented by drivers that can enrich a stored ban with the
+// age of the account of the user.
+type AccountWriter interface {
+	SetAccountAge(username string, ch Channel, at time.Time, age *accounts.Age) error
+}
+
+// SampleWriter is implemented by drivers that can store samples of the
+// messages that were not moderated. See package sampling
+type SampleWriter interface {
+	InsertSample(sample *sampling.Sample) error
+}
+
+// LinkWriter is implemented by drivers that can enrich a stored moderation
+// with its resolved links.
+type LinkWriter interface {
+	SetLinks(username string, ch Channel, at time.Time, links []*links.Link) error
+}
+
+// EvasionStore is implemented by drivers that can store the clusters of likely
+// ban evasion found by `tracker analyze evasion`.
+type EvasionStore interface {
+	SaveEvasionClusters(clusters []*EvasionCluster) error
+	// EvasionClusters returns the most recent clusters of the channel
+	EvasionClusters(ch Channel, limit int) ([]*EvasionCluster, error)
+}
+
+// ChannelWriter is implemented by drivers that can modify the tracked channels.
+type ChannelWriter interface {
+	AddChannel(ch Channel) error
+	RemoveChannel(ch Channel) error
+}
+
+// ShardWriter is implemented by drivers that can add channels to the shards of
+// other instances.
+type ShardWriter interface {
+	AddChannelToShard(ch Channel, shard int) error
+	// ChannelShards returns the shards tracking `ch`, none if it is not tracked
+	ChannelShards(ch Channel) ([]int, error)
+}
+
+// Auditor is implemented by drivers that keep a log of administrative actions.
+type Auditor interface {
+	Audit(entry *AuditEntry) error
+}
+
+// PurgeReport summarizes what a purge removed, or would remove in a dry-run.
+type PurgeReport struct {
+	Username string `json:"username"`
+	// Aliases are the logins purged along with Username, see RenameStore
+	Aliases []string `json:"aliases"`
+	DryRun  bool     `json:"dry_run"`
+	// Rows is the number of rows per table
+	Rows     map[string]int `json:"rows"`
+	Channels []string       `json:"channels"`
+}
+
+// EvasionCluster is a group of accounts moderated in a channel within a time
+// window that are likely owned by the same person
+type EvasionCluster struct {
+	Channel    string    `json:"channel"`
+	DetectedAt time.Time `json:"detected_at"`
+	// ID tells apart the clusters detected at the same time
+	ID         int       `json:"id"`
+	Usernames  []string  `json:"usernames"`
+	Reasons    []string  `json:"reasons"`
+	WindowFrom time.Time `json:"window_from"`
+	WindowTo   time.Time `json:"window_to"`
+}
+
+// Moderation is a stored moderation, as returned by a Reader
+type Moderation struct {
+	Channel  string                   `json:"channel"`
+	Username string                   `json:"username"`
+	At       time.Time                `json:"at"`
+	Messages []string                 `json:"messages"`
+	Sub      message.SubscribedStatus `json:"sub"`
+	// SubMonths is the sub tenure of the user, 0 if not subscribed or stored
+	// before it was
+	SubMonths int      `json:"sub_months,omitempty"`
+	Toxicity  *float64 `json:"toxicity,omitempty"`
+	Tags      []string `json:"tags"`
+	// Type is empty for the moderations stored before it was
+	Type message.MessageType `json:"type,omitempty"`
+	// Duration is the duration in seconds of a timeout, 0 for the rest of types
+	// and the moderations stored before it was
+	Duration int `json:"duration,omitempty"`
+	// Bucket is the bucket of the Duration of a timeout, empty for the rest of
+	// types and the timeouts stored before it was
+	Bucket          message.TimeoutBucket `json:"bucket,omitempty"`
+	AutomodStatus   string                `json:"automod_status,omitempty"`
+	AutomodCategory string                `json:"automod_category,omitempty"`
+	UserID          string                `json:"user_id,omitempty"`
+	// AccountCreatedAt and FollowedAt are set by the account enrichment, see
+	// package accounts
+	AccountCreatedAt *time.Time `json:"account_created_at,omitempty"`
+	FollowedAt       *time.Time `json:"followed_at,omitempty"`
+	// TimeToAction is the number of seconds between the most recent message and
+	// the moderation, nil if unknown. See message.Message.TimeToAction
+	TimeToAction *float64 `json:"time_to_action,omitempty"`
+	// SharedSession is whether the moderation happened during a shared chat
+	// session in the channel SourceChannelID and was received through another
+	// tracked channel. See message.Message.SharedSession
+	SharedSession   bool   `json:"shared_session,omitempty"`
+	SourceChannelID string `json:"source_channel_id,omitempty"`
+	// TenantID is the tenant of the channel when the moderation was stored,
+	// empty if none or stored before it was
+	TenantID string `json:"tenant_id,omitempty"`
+	// Deleted is the tombstone of a moderation stored by mistake, and Note
+	// annotates its correction. See Corrector
+	Deleted bool   `json:"deleted,omitempty"`
+	Note    string `json:"note,omitempty"`
+	// Reason is the reason of a warning, a ban or a timeout given by its
+	// moderator, empty if unknown
+	Reason string `json:"reason,omitempty"`
+	// Channels are the other channels of a collapsed mass ban, see
+	// message.Message.Channels
+	Channels []string `json:"channels,omitempty"`
+	// EscalatedFrom are the times of the deletion and the timeout of the user
+	// in the channel that escalated to a ban tagged with TagEscalation
+	EscalatedFrom []time.Time `json:"escalated_from,omitempty"`
+	// Partial is whether enrichments were skipped because the processing of
+	// the moderation went over its budget, see cfg.EventBudgetMs
+	Partial bool `json:"partial,omitempty"`
+	// NoLatencyData is whether the deleted message was not in the history and
+	// its body was taken from the deletion, so the time to action is unknown.
+	// See message.Message.NoLatencyData
+	NoLatencyData bool `json:"no_latency_data,omitempty"`
+	// Region is the region of the tracker that stored the moderation, empty if
+	// none or stored before it was
+	Region string `json:"region,omitempty"`
+	// Instance is the name of the tracker that stored the moderation, empty if
+	// stored before it was
+	Instance string `json:"instance,omitempty"`
+	// sealed is the encrypted blob of the compressed messages, set by the
+	// drivers instead of Messages and opened by the storage
+	sealed []byte
+}
+
+type AuditEntry struct {
+	Action  string
+	Actor   string
+	Target  string
+	Details string
+	At      time.Time
+}
+
 type Storage struct {
-	queue  chan *message.Message
-	ctx    context.Context
-	cancel context.CancelFunc
-	driver Driver
+	queue    chan *message.Message
+	ctx      context.Context
+	cancel   context.CancelFunc
+	driver   Driver
+	analyzer *heuristics.Pipelines
+	// clock is the time of the storage, clock.Real unless a test sets another
+	clock clock.Clock
+	// gate is nil unless the toxicity score gates the storage. It runs apart
+	// from the analyzer because the messages are only scored once they passed
+	// the heuristics and were scrubbed, see score
+	gate *heuristics.Analyzer
+	// scrubber is nil if scrubbing is disabled
+	scrubber *scrubber.Scrubber
+	// truncation is nil if the bodies have no maximum length
+	truncation *truncation
+	// emotes is nil if third-party emotes are disabled
+	emotes *emotes.Registry
+	// scorer is nil if toxicity scoring is disabled
+	scorer scoring.Scorer
+	// exporter is nil if the continuous export is disabled
+	exporter *export.Exporter
+	// eventLog is nil if the stored moderations are not written to an event
+	// log, see cfg.EventLog
+	eventLog *eventLog
+	// decisions is nil if the decisions of the processed moderations are not
+	// logged, see cfg.DecisionsLog
+	decisions *decisionsLog
+	// enricher is nil if the link enrichment is disabled
+	enricher *links.Enricher
+	// ages is nil if the account enrichment is disabled
+	ages *accounts.Enricher
+	// sampler is nil if the sampling of clean messages is disabled. The picked
+	// samples wait in samples to be stored, see storeSamples
+	sampler *sampling.Sampler
+	samples chan *sampling.Sample
+	// classifier is nil if the tagging is disabled
+	classifier *tags.Classifier
+	// commands is nil unless the reasons are inferred from the moderation
+	// commands typed in chat
+	commands *modcmd.Parser
+	// feed is nil if the webhooks of the ban feeds are disabled
+	feed *banFeed
+	// hooks is nil if the webhooks of the tenants are disabled
+	hooks *tenantHooks
+	// cipher is nil if the encryption of the messages is disabled
+	cipher *encryption.Cipher
+	// compress is whether the messages of new moderations are compressed. See
+	// package compress
+	compress bool
+	// blocklists is nil if the community blocklists are disabled
+	blocklists *blocklists
+	// grace is nil if the bans are stored right away
+	grace *grace
+	// massBans is nil if the bans of a user in several channels are not
+	// collapsed
+	massBans *massBans
+	// escalations is nil if the escalations of the users are not tagged
+	escalations *escalations
+	// helix is shared by every feature calling the Helix API, so they share its
+	// rate limit budget and its cache, see Bot.SetStorage
+	helix *helix.Client
+	// quotas is nil if the channels and the tenants have no daily quota
+	quotas *quotas
+	// digest is nil if the daily digest is disabled
+	digest *digest
+	// channelIDs is nil if the driver doesn't support channel ids
+	channelIDs *channelIDs
+	// groups is nil if there are no groups of channels
+	groups *groups
+	// latency computes the quantiles of the end-to-end latency and alerts when
+	// they go over the SLO
+	latency *latencyBudget
+	// notifiers send the daily digest and the incidents of the channels and
+	// the tenants
+	notifiers *notifiers
+	// outbox is nil if the webhooks are notified from the stored topic, which
+	// loses the notifications on a restart
+	outbox *outbox
+	// spill is nil if the moderations that fail to be inserted are lost, see
+	// cfg.SpillDir
+	spill *spiller
+	// maint holds the moderations while the ingestion is paused, see Pause
+	maint maintenance
+	// stored carries every stored moderation, results carries the result of
+	// every processed moderation. See Stored and Results
+	stored  *bus.Topic[*message.Message]
+	results *bus.Topic[*PipelineResult]
+	// driverName is the name of the driver in the results
+	driverName string
+	// deletionFallback is whether the deletions of a message not in the
+	// history are stored with the body of their CLEARMSG, see cfg.DeletionMode
+	deletionFallback bool
+}
+
+// Stored is the topic of the stored moderations. Subscribers must subscribe
+// before starting the bot, and must not modify the moderations
+func (s *Storage) Stored() *bus.Topic[*message.Message] {
+	return s.stored
+}
+
+// SetClock sets the time of the storage, e.g. a fake clock in the tests. It
+// must be set before the storage starts
+func (s *Storage) SetClock(c clock.Clock) {
+	s.clock = c
 }
 
 func (s *Storage) Start() {
+	if s.emotes != nil {
+		go s.emotes.Start(s.ctx)
+	}
+	if s.enricher != nil {
+		go s.enricher.Start(s.ctx)
+	}
+	if s.ages != nil {
+		// the background enrichments leave the budget of helix to the ingestion
+		go s.ages.Start(helix.WithPriority(s.ctx, helix.PriorityLow))
+	}
+	if s.feed != nil {
+		go s.feed.Start(s.ctx)
+	}
+	if s.hooks != nil {
+		go s.hooks.Start(s.ctx)
+	}
+	if s.quotas != nil {
+		go s.quotas.Start(s.ctx)
+	}
+	if s.digest != nil {
+		go s.digest.Start(s.ctx, s.sendDigest)
+	}
+	go s.latency.Start(s.ctx, s.alertLatency)
+	if s.groups != nil {
+		go s.groups.Start(s.ctx)
+	}
+	if s.escalations != nil {
+		go s.escalations.Start(s.ctx)
+	}
+	if s.outbox != nil {
+		go s.startOutbox()
+	}
+	if s.spill != nil {
+		go s.spill.replay(s.ctx, s.driver.Insert)
+	}
+	if s.sampler != nil {
+		go s.storeSamples()
+	}
+	if s.exporter != nil {
+		go s.exporter.Start(s.ctx, time.Duration(cfg.ExportFlushSeconds)*time.Second)
+	}
+	if s.blocklists != nil {
+		go s.blocklists.Start(s.ctx, time.Duration(cfg.BlocklistsSyncMinutes)*time.Minute)
+	}
 	for {
 		select {
 		case msg := <-s.queue:
-			s.driver.Insert(msg)
+			if err := s.driver.Insert(msg); err != nil {
+				errors.WrapAndLog(err)
+			}
 		case <-s.ctx.Done():
 			return
 		}
@@ -50,25 +421,1314 @@ func (s *Storage) Start() {
 }
 
 func (s *Storage) Stop() {
+	if s.grace != nil {
+		s.grace.flush()
+	}
+	// after the grace window, which may hand it the bans it held
+	if s.massBans != nil {
+		s.massBans.flush()
+	}
+	if m := s.Maintenance(); m.Held > 0 {
+		log.Printf("%d moderations held while the ingestion is paused were not stored", m.Held)
+	}
+	// the subscribers may still hand work to the enrichers and the exporter
+	for _, t := range []interface {
+		Name() string
+		Close(time.Duration) bool
+	}{s.stored, s.results} {
+		if !t.Close(BusCloseTimeout) {
+			log.Printf("gave up waiting for the subscribers of %s", t.Name())
+		}
+	}
 	s.cancel()
+	if s.exporter != nil {
+		if err := s.exporter.Flush(); err != nil {
+			errors.WrapAndLog(err)
+		}
+	}
+	if s.eventLog != nil {
+		if err := s.eventLog.Close(); err != nil {
+			errors.WrapAndLog(err)
+		}
+	}
+	if s.decisions != nil {
+		if err := s.decisions.Close(); err != nil {
+			errors.WrapAndLog(err)
+		}
+	}
+	// the moderations still spilled are inserted by the next run
+	if s.spill != nil {
+		if err := s.spill.Close(); err != nil {
+			errors.WrapAndLog(err)
+		}
+	}
 	s.driver.Close()
 }
 
-func (s *Storage) Save(msg *message.Message) {
-	s.driver.Insert(msg)
+// Save stores the moderation if it is compliant with the heuristics rules,
+// redacting the personal data of its messages first. It reports whether the
+// moderation was compliant. Backfilled moderations are only stored, they are
+// not published to the subscribers of the storage. While the ingestion is
+// paused the moderations are held and reported as compliant, see Pause. The
+// moderations of the channels over their daily quota may be left out, see
+// cfg.QuotaMode
+func (s *Storage) Save(msg *message.Message) bool {
+	// processed once the ingestion is resumed
+	if s.maint.hold(msg) {
+		return true
+	}
+	deadline := s.deadline()
+	res := s.newResult(msg)
+	// the deletions and timeouts dropped by the heuristics are still steps of
+	// an escalation. The backfilled moderations are out of the order of the
+	// live ones
+	if s.escalations != nil && !msg.Backfilled {
+		msg.EscalatedFrom = s.escalations.observe(msg)
+	}
+	// the rules run against the same bodies in both, see heuristics.Memo
+	memo := heuristics.NewMemo()
+	if !msg.Backfilled {
+		defer s.results.Publish(res)
+		s.activateBan(msg)
+		if s.decisions != nil {
+			res.Rules, res.Verdicts = s.verdicts(msg, memo)
+		}
+	}
+
+	if rule := s.violation(msg, memo); rule != nil {
+		res.Rule = heuristics.RuleName(rule)
+		return false
+	}
+	if msg.UserID == "" && len(msg.LastMessages) > 0 {
+		// e.g. deletions, whose CLEARMSG has no user id
+		msg.UserID = msg.LastMessages[0].UserID
+	}
+	// kept if the moderation comes from another tracker, e.g. replayed
+	if msg.Region == "" {
+		msg.Region = cfg.Region
+	}
+	if msg.Instance == "" {
+		msg.Instance = cfg.Instance
+	}
+	if msg.Type == message.MessageTimeout {
+		msg.Bucket = message.BucketOf(msg.Duration)
+	}
+	s.tag(msg, deadline)
+	res.Redactions = s.scrub(msg)
+	res.Truncated = s.truncate(msg)
+	s.score(msg, deadline)
+	res.Partial = msg.Partial
+	if rule := s.gated(msg); rule != nil {
+		res.Rule = heuristics.RuleName(rule)
+		return false
+	}
+	if s.quotas != nil && !msg.Backfilled && !s.quota(msg) {
+		res.Rule = RuleQuota
+		return false
+	}
+	sealed, err := s.seal(msg)
+	if err != nil {
+		res.Error = err.Error()
+		errors.WrapAndLog(err)
+		return false
+	}
+	// the notification is written first, so it is not lost if the process
+	// dies right after the insert. See outbox
+	var entry *OutboxEntry
+	if s.outbox != nil && !msg.Backfilled {
+		if entry, err = s.addOutbox(msg); err != nil {
+			res.Error = err.Error()
+			errors.WrapAndLog(err)
+			return false
+		}
+	}
+	start := s.clock.Now()
+	err = s.insert(sealed, res)
+	res.InsertLatency = s.clock.Now().Sub(start)
+	if err != nil {
+		res.Error = err.Error()
+		if entry != nil {
+			s.settleOutbox(entry, true)
+		}
+		return false
+	}
+	res.Accepted = true
+	if !msg.ReceivedAt.IsZero() {
+		res.Latency = s.clock.Now().Sub(msg.ReceivedAt)
+	}
+	if !msg.Backfilled {
+		if entry != nil {
+			s.deliverOutbox(entry, msg)
+		}
+		s.stored.Publish(msg)
+	}
+	return true
+}
+
+// enrichLinks schedules the resolution of the links of the stored moderation
+func (s *Storage) enrichLinks(msg *message.Message) {
+	if s.enricher == nil {
+		return
+	}
+	var found []string
+	for _, privmsg := range msg.LastMessages {
+		found = append(found, links.Extract(privmsg.Body)...)
+	}
+	if len(found) == 0 {
+		return
+	}
+	if !s.enricher.Enqueue(&links.Job{
+		Username: msg.Username,
+		Channel:  msg.Channel,
+		At:       msg.At,
+		Links:    found,
+	}) {
+		dropped.Inc("links")
+	}
+}
+
+// enrichAccount schedules the enrichment of a stored ban with the age of the
+// account of the user
+func (s *Storage) enrichAccount(msg *message.Message) {
+	if s.ages == nil || msg.Type != message.MessageBan {
+		return
+	}
+	if !s.ages.Enqueue(&accounts.Job{
+		Username:  msg.Username,
+		Channel:   msg.Channel,
+		ChannelID: msg.ChannelID,
+		At:        msg.At,
+	}) {
+		dropped.Inc("accounts")
+	}
+}
+
+// sample queues `privmsg` of channel `ch` to be stored as a clean sample if it
+// is picked by the sampler. It must only be called with messages that were
+// never moderated. It never blocks the tracker of the channel, the samples are
+// dropped if the queue is full
+func (s *Storage) sample(ch string, privmsg *message.PrivateMessage) {
+	if s.sampler == nil || !s.sampler.Take(s.clock.Now()) {
+		return
+	}
+	if _, ok := s.driver.(SampleWriter); !ok {
+		return
+	}
+	select {
+	case s.samples <- &sampling.Sample{
+		ID:         privmsg.ID,
+		Channel:    ch,
+		At:         privmsg.At,
+		Body:       privmsg.Body,
+		Length:     len([]rune(privmsg.Body)),
+		Subscribed: int(privmsg.Subscribed),
+	}:
+	default:
+		dropped.Inc("samples")
+	}
+}
+
+// storeSamples stores the queued samples until the storage is stopped. Raw
+// bodies are scrubbed and encrypted like the ones of the moderations, the rest
+// are hashed
+func (s *Storage) storeSamples() {
+	w, ok := s.driver.(SampleWriter)
+	if !ok {
+		return
+	}
+	for {
+		select {
+		case sample := <-s.samples:
+			if s.sampler.Raw() {
+				if s.scrubber != nil {
+					sample.Body, _ = s.scrubber.Scrub(sample.Body)
+				}
+				if s.cipher != nil {
+					var err error
+					if sample.Body, err = s.cipher.Encrypt(sample.Body, rowOf(sample.Channel, "")); err != nil {
+						errors.WrapAndLog(err)
+						continue
+					}
+				}
+			}
+			sample.Body = s.sampler.Body(sample.Body)
+			if err := w.InsertSample(sample); err != nil {
+				storageErrors.Inc("insert_sample")
+				errors.WrapAndLog(err)
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// storeAccountAge stores the age of the account of a ban. See AccountWriter
+func (s *Storage) storeAccountAge(job *accounts.Job, age *accounts.Age) error {
+	w, ok := s.driver.(AccountWriter)
+	if !ok {
+		return ErrUnsupported
+	}
+	return w.SetAccountAge(job.Username, Channel(job.Channel), job.At, age)
+}
+
+// storeLinks stores the resolved links of a moderation. See LinkWriter
+func (s *Storage) storeLinks(job *links.Job, resolved []*links.Link) error {
+	w, ok := s.driver.(LinkWriter)
+	if !ok {
+		return ErrUnsupported
+	}
+	return w.SetLinks(job.Username, Channel(job.Channel), job.At, resolved)
+}
+
+// export adds the stored moderation to the continuous export
+func (s *Storage) export(msg *message.Message) {
+	if s.exporter == nil {
+		return
+	}
+	r := &export.Row{
+		Channel:  msg.Channel,
+		Username: msg.Username,
+		At:       msg.At,
+		Type:     string(msg.Type),
+		Duration: msg.Duration,
+		Messages: make([]string, len(msg.LastMessages)),
+		Sub:      int(message.SubscribedStatusUnknown),
+		Toxicity: msg.Toxicity,
+	}
+	for i, privmsg := range msg.LastMessages {
+		r.Messages[i] = privmsg.Body
+	}
+	if len(msg.LastMessages) > 0 {
+		r.Sub = int(msg.LastMessages[0].Subscribed)
+	}
+	if err := s.sealRow(r); err != nil {
+		errors.WrapAndLog(err)
+		return
+	}
+	if err := s.exporter.Add(r); err != nil {
+		errors.WrapAndLog(err)
+	}
+}
+
+// ExportRow returns the exported row of a stored moderation. See sealRow
+func (s *Storage) ExportRow(m *Moderation) (*export.Row, error) {
+	r := &export.Row{
+		Channel:  m.Channel,
+		Username: m.Username,
+		At:       m.At,
+		Type:     string(m.Type),
+		Duration: m.Duration,
+		Messages: m.Messages,
+		Sub:      int(m.Sub),
+		Toxicity: m.Toxicity,
+	}
+	if err := s.sealRow(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// sealRow encrypts the messages of an exported row if the encryption is
+// enabled, as the exports are kept apart from the database like backups
+func (s *Storage) sealRow(r *export.Row) error {
+	if s.cipher == nil {
+		return nil
+	}
+	sealed := make([]string, len(r.Messages))
+	for i, body := range r.Messages {
+		var err error
+		if sealed[i], err = s.cipher.Encrypt(body, rowOf(r.Channel, r.Username)); err != nil {
+			return err
+		}
+	}
+	r.Messages = sealed
+	return nil
+}
+
+// violation checks the traits of every message related to the moderation and
+// returns the first rule violated. If a single message of all the ones cleared
+// is not compliant, the moderation is not compliant. The verdicts of the body
+// rules are memoized in memo, see heuristics.Memo
+func (s *Storage) violation(msg *message.Message, memo *heuristics.Memo) heuristics.Rule {
+	// every trait has the type of msg, see heuristics.Pipelines.Violation
+	analyzer := s.analyzerOf(msg.Channel).Of(msg.Type)
+	var violated heuristics.Rule
+	s.eachTraits(msg, func(t heuristics.Traits) bool {
+		violated = memo.Violation(analyzer, t)
+		return violated == nil
+	})
+	return violated
+}
+
+// verdicts returns the names of the rules of the pipeline of msg and the
+// bitmap of the rules any of its messages was not compliant with. See
+// heuristics.Analyzer.Verdicts
+func (s *Storage) verdicts(msg *message.Message, memo *heuristics.Memo) ([]string, uint64) {
+	analyzer := s.analyzerOf(msg.Channel).Of(msg.Type)
+	var bitmap uint64
+	s.eachTraits(msg, func(t heuristics.Traits) bool {
+		bitmap |= memo.Verdicts(analyzer, t)
+		return true
+	})
+	return analyzer.RuleNames(), bitmap
+}
+
+// analyzerOf returns the pipelines of the group of the channel, or the default
+// ones
+func (s *Storage) analyzerOf(ch string) *heuristics.Pipelines {
+	if s.groups != nil {
+		if a := s.groups.analyzer(ch); a != nil {
+			return a
+		}
+	}
+	return s.analyzer
+}
+
+// eachTraits calls fn with the traits of every recent message of msg, the most
+// recent first, until fn returns false
+func (s *Storage) eachTraits(msg *message.Message, fn func(t heuristics.Traits) bool) {
+	t := heuristics.Traits{
+		Type:            msg.Type,
+		ModeratedAt:     msg.At,
+		TimeoutDuration: msg.Duration,
+		Flood:           msg.Flood,
+		// flag to identify most recent message (=msg.LastMessages[0])
+		IsMostRecentMsg: true,
+	}
+	for _, privmsg := range msg.LastMessages {
+		// reuse trait object for every recent message
+		t.Body = privmsg.Body
+		t.At = privmsg.At
+		t.Badges = privmsg.Badges
+		if s.emotes != nil {
+			t.ThirdPartyEmotes = s.emotes.Count(msg.Channel, privmsg.Body)
+		}
+		if !fn(t) {
+			return
+		}
+		t.IsMostRecentMsg = false
+	}
+}
+
+// gated returns the gate rule violated by the toxicity of msg, if any.
+// Unscored moderations are never gated, see heuristics.RuleMinToxicity
+func (s *Storage) gated(msg *message.Message) heuristics.Rule {
+	if s.gate == nil || msg.Toxicity == nil {
+		return nil
+	}
+	return s.gate.Violation(heuristics.Traits{
+		Type:            msg.Type,
+		IsMostRecentMsg: true,
+		Toxicity:        *msg.Toxicity,
+		Scored:          true,
+	})
+}
+
+// deadline returns when the processing of a moderation starting now goes over
+// cfg.EventBudgetMs, zero if there is no budget
+func (s *Storage) deadline() time.Time {
+	if cfg.EventBudgetMs <= 0 {
+		return time.Time{}
+	}
+	return s.clock.Now().Add(time.Duration(cfg.EventBudgetMs) * time.Millisecond)
+}
+
+// skip reports whether the enrichment of msg is skipped because its
+// processing went over the deadline, and marks msg as partial if so
+func (s *Storage) skip(msg *message.Message, enrichment string, deadline time.Time) bool {
+	if deadline.IsZero() || s.clock.Now().Before(deadline) {
+		return false
+	}
+	msg.Partial = true
+	enrichmentsSkipped.Inc(enrichment)
+	return true
+}
+
+// score sets the toxicity of the most recent message of msg. It must be called
+// once msg passed the heuristics and was scrubbed, so only the moderations that
+// may be stored wait for the scorer, and the scorer never sees the redacted
+// personal data. Scoring errors are logged and the message is left unscored.
+// The scorer waits until the deadline at most, the partial moderations are not
+// gated by their toxicity
+func (s *Storage) score(msg *message.Message, deadline time.Time) {
+	if s.scorer == nil || len(msg.LastMessages) == 0 || s.skip(msg, "toxicity", deadline) {
+		return
+	}
+	ctx := s.ctx
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(s.ctx, deadline.Sub(s.clock.Now()))
+		defer cancel()
+	}
+	score, err := s.scorer.Score(ctx, msg.LastMessages[0].Body)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			msg.Partial = true
+			enrichmentsSkipped.Inc("toxicity")
+			return
+		}
+		if !errors.Is(err, scoring.ErrCircuitOpen) {
+			errors.WrapAndLog(err)
+		}
+		return
+	}
+	msg.Toxicity = &score
+}
+
+// tag sets the inferred reasons of msg, blocklist.Tag to the bans of the
+// blocklisted users and TagEscalation to the bans that end an escalation. It
+// runs before scrubbing so the keywords are matched against the original
+// messages. Only the inferred reasons are skipped over the deadline
+func (s *Storage) tag(msg *message.Message, deadline time.Time) {
+	if s.classifier != nil && !s.skip(msg, "tags", deadline) {
+		bodies := make([]string, len(msg.LastMessages))
+		for i, privmsg := range msg.LastMessages {
+			bodies[i] = privmsg.Body
+		}
+		msg.Tags = s.classifier.Classify(msg.Username, bodies)
+	}
+	if msg.Type == message.MessageBan && s.blocklisted(msg.Username) {
+		msg.Tags = append(msg.Tags, blocklist.Tag)
+	}
+	if msg.Reverted {
+		msg.Tags = append(msg.Tags, TagReverted)
+	}
+	// see Save
+	if msg.EscalatedFrom != nil {
+		msg.Tags = append(msg.Tags, TagEscalation)
+		escalationsTagged.Inc(msg.Channel)
+	}
+}
+
+// scrub redacts the messages of msg and returns the redactions, nil if none.
+// The private messages are copied before being redacted because they are
+// shared with the history of the channel.
+func (s *Storage) scrub(msg *message.Message) scrubber.Redactions {
+	if s.scrubber == nil {
+		return nil
+	}
+	var total scrubber.Redactions
+	for i, privmsg := range msg.LastMessages {
+		body, r := s.scrubber.Scrub(privmsg.Body)
+		if r == nil {
+			continue
+		}
+		cp := *privmsg
+		cp.Body = body
+		msg.LastMessages[i] = &cp
+
+		if total == nil {
+			total = make(scrubber.Redactions)
+		}
+		for name, n := range r {
+			total[name] += n
+		}
+	}
+	return total
+}
+
+// seal returns a copy of msg with its messages compressed and encrypted, in
+// that order, or msg itself if both are disabled. The messages of msg are left
+// as they are because they are shared with the history of the channel and the
+// observers.
+func (s *Storage) seal(msg *message.Message) (*message.Message, error) {
+	if s.compress && len(msg.LastMessages) > 0 {
+		bodies := make([]string, len(msg.LastMessages))
+		for i, privmsg := range msg.LastMessages {
+			bodies[i] = privmsg.Body
+		}
+		z, err := s.compressed(msg.Channel, msg.Username, bodies)
+		if err != nil {
+			return nil, err
+		}
+		cp := *msg
+		cp.Compressed = z
+		return &cp, nil
+	}
+	if s.cipher == nil {
+		return msg, nil
+	}
+	cp := *msg
+	cp.LastMessages = make([]*message.PrivateMessage, len(msg.LastMessages))
+	for i, privmsg := range msg.LastMessages {
+		body, err := s.cipher.Encrypt(privmsg.Body, rowOf(msg.Channel, msg.Username))
+		if err != nil {
+			return nil, err
+		}
+		p := *privmsg
+		p.Body = body
+		cp.LastMessages[i] = &p
+	}
+	return &cp, nil
+}
+
+// compressed returns the compressed blob of the messages of `username` in
+// `ch`, encrypted if the encryption is enabled
+func (s *Storage) compressed(ch, username string, msgs []string) ([]byte, error) {
+	z := compress.Encode(msgs)
+	if s.cipher == nil {
+		return z, nil
+	}
+	sealed, err := s.cipher.Encrypt(string(z), rowOf(ch, username))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(sealed), nil
+}
+
+// decrypt decrypts in place the messages of a stored moderation. Messages
+// stored before enabling the encryption are left as they are, as well as the
+// ones that fail to decrypt: a plaintext message may start with
+// encryption.Prefix, and a single message must not hide the rest
+func (s *Storage) decrypt(m *Moderation) {
+	if s.cipher == nil {
+		return
+	}
+	if m.sealed != nil {
+		s.open(m)
+		return
+	}
+	for i, body := range m.Messages {
+		plain, err := s.cipher.Decrypt(body, rowOf(m.Channel, m.Username))
+		if err != nil {
+			storageErrors.Inc("decrypt")
+			errors.WrapAndLogWithContext(err, struct {
+				Username string
+				Channel  string
+				At       time.Time
+			}{m.Username, m.Channel, m.At})
+			continue
+		}
+		m.Messages[i] = plain
+	}
+}
+
+// open sets the messages of a stored moderation from its encrypted and
+// compressed blob. Moderations whose blob cannot be opened are left with no
+// messages
+func (s *Storage) open(m *Moderation) {
+	z, err := s.cipher.Decrypt(string(m.sealed), rowOf(m.Channel, m.Username))
+	if err == nil {
+		m.Messages, err = compress.Decode([]byte(z))
+	}
+	if err != nil {
+		storageErrors.Inc("decrypt")
+		errors.WrapAndLogWithContext(err, struct {
+			Username string
+			Channel  string
+			At       time.Time
+		}{m.Username, m.Channel, m.At})
+	}
+	m.sealed = nil
+}
+
+// rowOf returns the additional data that binds an encrypted message to the
+// moderation it belongs to
+func rowOf(ch, username string) string {
+	return strings.ToLower(ch) + sep + strings.ToLower(username)
 }
 
 func (s *Storage) Channels() ([]Channel, error) {
 	return s.driver.Channels()
 }
 
+// UserModerations returns the most recent moderations of `username`, merged
+// with the ones of its previous and later logins if the user was renamed. See
+// Reader and RenameStore
+func (s *Storage) UserModerations(username string, ch Channel, limit int) ([]*Moderation, error) {
+	return s.TaggedUserModerations(username, ch, "", limit)
+}
+
+// TaggedUserModerations is UserModerations of the moderations tagged with
+// `tag`, or of all of them if it is empty. The tag is filtered before the
+// limit. See TagReader
+func (s *Storage) TaggedUserModerations(username string, ch Channel, tag string, limit int) ([]*Moderation, error) {
+	return s.userModerations(username, ch, tag, limit, false)
+}
+
+// userModerations is TaggedUserModerations, leaving out the soft-deleted
+// moderations unless `deleted`. They are left out after the limit, so fewer
+// than `limit` may be returned. See Corrector
+func (s *Storage) userModerations(username string, ch Channel, tag string, limit int, deleted bool) ([]*Moderation, error) {
+	r, ok := s.driver.(Reader)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	read := r.UserModerations
+	if tag != "" {
+		tr, ok := s.driver.(TagReader)
+		if !ok {
+			return nil, ErrUnsupported
+		}
+		read = func(username string, ch Channel, limit int) ([]*Moderation, error) {
+			return tr.TaggedUserModerations(username, ch, tag, limit)
+		}
+	}
+	logins, err := s.aliases(strings.ToLower(username))
+	if err != nil {
+		return nil, err
+	}
+	var all []*Moderation
+	for _, login := range logins {
+		mods, err := read(login, ch, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range mods {
+			if m.Deleted && !deleted {
+				continue
+			}
+			s.decrypt(m)
+			all = append(all, m)
+		}
+	}
+	if len(logins) > 1 {
+		sort.Slice(all, func(i, j int) bool {
+			return all[i].At.After(all[j].At)
+		})
+		if len(all) > limit {
+			all = all[:limit]
+		}
+	}
+	return all, nil
+}
+
+// ChannelModerations calls fn with every moderation of the channel between
+// `from` and `to`, except the soft-deleted ones. See Reader and Corrector
+func (s *Storage) ChannelModerations(ch Channel, from, to time.Time, fn func(*Moderation) error) error {
+	r, ok := s.driver.(Reader)
+	if !ok {
+		return ErrUnsupported
+	}
+	return r.ChannelModerations(Channel(strings.ToLower(string(ch))), from, to, func(m *Moderation) error {
+		if m.Deleted {
+			return nil
+		}
+		s.decrypt(m)
+		return fn(m)
+	})
+}
+
+// ChannelBans returns the most recent `limit` bans of the channel between
+// `from` and `to`. If subscribed is not nil only the bans of subscribers, or of
+// non-subscribers, are returned, so the bans whose sub status is unknown are
+// left out
+func (s *Storage) ChannelBans(ch Channel, from, to time.Time, subscribed *bool, limit int) ([]*Moderation, error) {
+	var bans []*Moderation
+	if err := s.ChannelModerations(ch, from, to, func(m *Moderation) error {
+		if m.Type != message.MessageBan {
+			return nil
+		}
+		if subscribed != nil {
+			if m.Sub == message.SubscribedStatusUnknown || (m.Sub == message.SubscribedStatusTrue) != *subscribed {
+				return nil
+			}
+		}
+		bans = append(bans, m)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].At.After(bans[j].At)
+	})
+	if len(bans) > limit {
+		bans = bans[:limit]
+	}
+	return bans, nil
+}
+
+// TenantChannelBans is ChannelBans of a channel of the tenant
+func (s *Storage) TenantChannelBans(tenantID string, ch Channel, from, to time.Time, subscribed *bool, limit int) ([]*Moderation, error) {
+	ch = Channel(strings.ToLower(string(ch)))
+	if err := s.owns(tenantID, ch); err != nil {
+		return nil, err
+	}
+	return s.ChannelBans(ch, from, to, subscribed, limit)
+}
+
+// TimeToAction summarizes the times to action, in seconds, of the moderations
+// of the channel between `from` and `to`. Moderations stored before the time
+// to action was are skipped, as well as the ones of shared chat sessions, that
+// were acted on by the moderators of another channel
+func (s *Storage) TimeToAction(ch Channel, from, to time.Time) (metrics.Summary, error) {
+	var samples []float64
+	if err := s.ChannelModerations(ch, from, to, func(m *Moderation) error {
+		if m.TimeToAction != nil && !m.SharedSession {
+			samples = append(samples, *m.TimeToAction)
+		}
+		return nil
+	}); err != nil {
+		return metrics.Summary{}, err
+	}
+	return metrics.Summarize(samples), nil
+}
+
+// SaveEvasionClusters stores the clusters. See EvasionStore
+func (s *Storage) SaveEvasionClusters(clusters []*EvasionCluster) error {
+	e, ok := s.driver.(EvasionStore)
+	if !ok {
+		return ErrUnsupported
+	}
+	return e.SaveEvasionClusters(clusters)
+}
+
+// EvasionClusters returns the most recent clusters of the channel. See
+// EvasionStore
+func (s *Storage) EvasionClusters(ch Channel, limit int) ([]*EvasionCluster, error) {
+	e, ok := s.driver.(EvasionStore)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return e.EvasionClusters(Channel(strings.ToLower(string(ch))), limit)
+}
+
+// HasModeration reports whether the moderation is already stored. See
+// Deduplicator
+func (s *Storage) HasModeration(username string, ch Channel, at time.Time) (bool, error) {
+	d, ok := s.driver.(Deduplicator)
+	if !ok {
+		return false, ErrUnsupported
+	}
+	return d.HasModeration(strings.ToLower(username), ch, at)
+}
+
+// CompressMessages compresses the messages of the moderations stored before the
+// compression was enabled. See MessageCompressor
+func (s *Storage) CompressMessages(ch Channel, from, to time.Time, dryRun bool) (int, error) {
+	c, ok := s.driver.(MessageCompressor)
+	if !ok {
+		return 0, ErrUnsupported
+	}
+	ch = Channel(strings.ToLower(string(ch)))
+	return c.CompressMessages(ch, from, to, dryRun, func(username string, msgs []string) ([]byte, error) {
+		// messages encrypted one by one are decrypted first, ciphertexts do not
+		// compress
+		plain := make([]string, len(msgs))
+		for i, body := range msgs {
+			plain[i] = body
+			if s.cipher == nil || !encryption.IsEncrypted(body) {
+				continue
+			}
+			var err error
+			if plain[i], err = s.cipher.Decrypt(body, rowOf(string(ch), username)); err != nil {
+				return nil, err
+			}
+		}
+		return s.compressed(string(ch), username, plain)
+	})
+}
+
+// AddChannel persists `ch` as a tracked channel
+func (s *Storage) AddChannel(ch Channel, actor string) error {
+	return s.writeChannel(ch, actor, true)
+}
+
+// RemoveChannel removes `ch` from the tracked channels
+func (s *Storage) RemoveChannel(ch Channel, actor string) error {
+	return s.writeChannel(ch, actor, false)
+}
+
+// ImportChannel adds `ch` to the tracked channels of `shard`. It fails with
+// ErrChannelTracked if any shard already tracks `ch`, so that a channel is
+// never joined by two instances
+func (s *Storage) ImportChannel(ch Channel, shard int, actor string) error {
+	w, ok := s.driver.(ShardWriter)
+	if !ok {
+		return ErrUnsupported
+	}
+	ch = Channel(strings.ToLower(string(ch)))
+	shards, err := w.ChannelShards(ch)
+	if err != nil {
+		return err
+	}
+	if len(shards) > 0 {
+		return ErrChannelTracked
+	}
+	if err := w.AddChannelToShard(ch, shard); err != nil {
+		return err
+	}
+	if err := s.Audit(&AuditEntry{
+		Action:  "channel-import",
+		Actor:   actor,
+		Target:  string(ch),
+		Details: fmt.Sprintf("shard=%d", shard),
+		At:      s.clock.Now(),
+	}); err != nil && !errors.Is(err, ErrUnsupported) {
+		errors.WrapAndLog(err)
+	}
+	return nil
+}
+
+func (s *Storage) writeChannel(ch Channel, actor string, add bool) error {
+	w, ok := s.driver.(ChannelWriter)
+	if !ok {
+		return ErrUnsupported
+	}
+	var (
+		err    error
+		action = "channel-enable"
+	)
+	if add {
+		err = w.AddChannel(ch)
+		if _, idErr := s.ChannelID(ch); idErr != nil && !errors.Is(idErr, ErrUnsupported) {
+			errors.WrapAndLog(idErr)
+		}
+	} else {
+		action = "channel-disable"
+		err = w.RemoveChannel(ch)
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.Audit(&AuditEntry{
+		Action: action,
+		Actor:  actor,
+		Target: string(ch),
+		At:     s.clock.Now(),
+	}); err != nil && !errors.Is(err, ErrUnsupported) {
+		errors.WrapAndLog(err)
+	}
+	return nil
+}
+
+// PurgeUser removes all the stored data of `username`, and of its previous and
+// later logins if the user was renamed, and records who did it in the audit
+// log. Dry-runs are not audited.
+func (s *Storage) PurgeUser(username, actor string, dryRun bool) (*PurgeReport, error) {
+	p, ok := s.driver.(Purger)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	// twitch logins are always lowercase
+	username = strings.ToLower(username)
+	logins, err := s.aliases(username)
+	if err != nil {
+		return nil, err
+	}
+	report, err := p.PurgeUser(logins, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	report.Username = username
+	report.Aliases = logins[1:]
+	if dryRun {
+		return report, nil
+	}
+	if err := s.Audit(&AuditEntry{
+		Action:  "purge-user",
+		Actor:   actor,
+		Target:  username,
+		Details: fmt.Sprintf("aliases=%v rows=%v channels=%v", report.Aliases, report.Rows, report.Channels),
+		At:      s.clock.Now(),
+	}); err != nil {
+		// the data is already gone, do not report the purge as failed
+		errors.WrapAndLogWithContext(err, struct {
+			Username string
+		}{username})
+	}
+	return report, nil
+}
+
+// Audit records an administrative action if the driver supports it
+func (s *Storage) Audit(entry *AuditEntry) error {
+	a, ok := s.driver.(Auditor)
+	if !ok {
+		return ErrUnsupported
+	}
+	return a.Audit(entry)
+}
+
+// DefaultRules returns the heuristics rules every moderation must comply with
+// to be stored
+func DefaultRules() []heuristics.Rule {
+	rules := []heuristics.Rule{
+		heuristics.RuleAlwaysStoreBans(),
+		heuristics.RuleAlwaysStoreAutomod(),
+		heuristics.RuleAlwaysStoreWarnings(),
+		heuristics.RuleNoLinks(),
+		heuristics.RuleMinTimeoutDuration(MinTimeoutDuration),
+		heuristics.RuleOnlyHumanModerations(MinHumanlyPossible),
+	}
+	if cfg.EmotesEnabled {
+		rules = append(rules, heuristics.RuleMaxEmoteDensity(MaxEmoteDensity, MinEmoteDensityWords))
+	}
+	if cfg.OnlyBadges != "" {
+		rules = append(rules, heuristics.RuleOnlyBadges(parseBadges(cfg.OnlyBadges)))
+	}
+	if cfg.SkipBadges != "" {
+		rules = append(rules, heuristics.RuleSkipBadges(parseBadges(cfg.SkipBadges)))
+	}
+	if cfg.FloodMessages > 0 {
+		rules = append(rules, heuristics.RuleMaxFlood(cfg.FloodMessages))
+	}
+	return rules
+}
+
+// parseBadges returns the badges of a comma-separated list, see cfg.OnlyBadges
+func parseBadges(list string) []string {
+	var badges []string
+	for _, b := range strings.Split(list, ",") {
+		if b = strings.ToLower(strings.TrimSpace(b)); b != "" {
+			badges = append(badges, b)
+		}
+	}
+	return badges
+}
+
+// PipelineRules are the rules that can be used in the pipelines of the message
+// types by name, see cfg.RulePipelines
+func PipelineRules() map[string]func() heuristics.Rule {
+	return map[string]func() heuristics.Rule{
+		"NoLinks": func() heuristics.Rule {
+			return heuristics.RuleNoLinks()
+		},
+		"MinTimeoutDuration": func() heuristics.Rule {
+			return heuristics.RuleMinTimeoutDuration(MinTimeoutDuration)
+		},
+		"OnlyHumanModerations": func() heuristics.Rule {
+			return heuristics.RuleOnlyHumanModerations(MinHumanlyPossible)
+		},
+		"MaxEmoteDensity": func() heuristics.Rule {
+			return heuristics.RuleMaxEmoteDensity(MaxEmoteDensity, MinEmoteDensityWords)
+		},
+		"OnlyBadges": func() heuristics.Rule {
+			return heuristics.RuleOnlyBadges(parseBadges(cfg.OnlyBadges))
+		},
+		"SkipBadges": func() heuristics.Rule {
+			return heuristics.RuleSkipBadges(parseBadges(cfg.SkipBadges))
+		},
+		"MaxFlood": func() heuristics.Rule {
+			return heuristics.RuleMaxFlood(cfg.FloodMessages)
+		},
+	}
+}
+
+// newAnalyzer creates and compiles the pipelines of the heuristics from the
+// configuration. Without pipelines every type uses DefaultRules
+func newAnalyzer() *heuristics.Pipelines {
+	p, err := heuristics.ParsePipelines(cfg.RulePipelines, PipelineRules(), DefaultRules())
+	if err != nil {
+		errors.WrapFatal(err)
+	}
+	p.Compile()
+	return p
+}
+
+// SetRules replaces DefaultRules with `rules` as the rules of the message types
+// without a pipeline, see cfg.RulePipelines. It must be called before Start
+func (s *Storage) SetRules(rules []heuristics.Rule) error {
+	p, err := heuristics.ParsePipelines(cfg.RulePipelines, PipelineRules(), rules)
+	if err != nil {
+		return err
+	}
+	p.Compile()
+	if s.groups != nil {
+		if err := s.groups.compile(rules); err != nil {
+			return err
+		}
+	}
+	s.analyzer = p
+	return nil
+}
+
+// gateRules returns the rules the toxicity of a moderation must comply with to
+// be stored, or nil if the score doesn't gate the storage. Bans, AutoMod
+// actions and warnings are never gated, like with the rest of the rules
+func gateRules() []heuristics.Rule {
+	if cfg.ScoringURL == "" || !cfg.ScoringGate {
+		return nil
+	}
+	return []heuristics.Rule{
+		heuristics.RuleAlwaysStoreBans(),
+		heuristics.RuleAlwaysStoreAutomod(),
+		heuristics.RuleAlwaysStoreWarnings(),
+		heuristics.RuleMinToxicity(cfg.ScoringMinToxicity),
+	}
+}
+
+// newGate creates and compiles the toxicity gate from the configuration. It
+// returns nil if the score doesn't gate the storage
+func newGate() *heuristics.Analyzer {
+	rules := gateRules()
+	if rules == nil {
+		return nil
+	}
+	gate := heuristics.New(rules)
+	gate.Compile()
+	return gate
+}
+
+// newScrubber creates and compiles the scrubber from the configuration. It
+// returns nil if scrubbing is disabled
+func newScrubber() *scrubber.Scrubber {
+	if !cfg.ScrubEnabled {
+		return nil
+	}
+	patterns := make([]*scrubber.Pattern, 0, 4)
+	for _, name := range strings.Split(cfg.ScrubPatterns, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		p := scrubber.Builtin(name)
+		if p == nil {
+			errors.WrapFatalWithContext(ErrUnknownScrubPattern, struct {
+				Pattern string
+			}{name})
+		}
+		patterns = append(patterns, p)
+	}
+	if cfg.ScrubCustomPattern != "" {
+		patterns = append(patterns, scrubber.NewPattern("custom", cfg.ScrubCustomPattern))
+	}
+	if cfg.ScrubPatternsFile != "" {
+		custom, err := scrubber.ReadPatterns(cfg.ScrubPatternsFile)
+		if err != nil {
+			errors.WrapFatal(err)
+		}
+		patterns = append(patterns, custom...)
+	}
+	s := scrubber.New(patterns)
+	if err := s.Compile(); err != nil {
+		errors.WrapFatal(err)
+	}
+	return s
+}
+
+// newEmotes creates the third-party emotes registry from the configuration. It
+// returns nil if the emotes are disabled
+func newEmotes() *emotes.Registry {
+	if !cfg.EmotesEnabled {
+		return nil
+	}
+	providers := make([]emotes.Provider, 0, 3)
+	for _, name := range strings.Split(cfg.EmotesProviders, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		p := emotes.ProviderByName(name)
+		if p == nil {
+			errors.WrapFatalWithContext(ErrUnknownEmoteProvider, struct {
+				Provider string
+			}{name})
+		}
+		providers = append(providers, p)
+	}
+	return emotes.New(providers, time.Duration(cfg.EmotesRefreshMinutes)*time.Minute)
+}
+
+// newScorer creates the toxicity scorer from the configuration. It returns nil
+// if scoring is disabled
+func newScorer() scoring.Scorer {
+	if cfg.ScoringURL == "" {
+		return nil
+	}
+	return scoring.NewGuarded(
+		scoring.NewHTTPScorer(cfg.ScoringURL),
+		time.Duration(cfg.ScoringTimeoutMs)*time.Millisecond,
+		scoring.NewBreaker(cfg.ScoringBreakerThreshold, time.Duration(cfg.ScoringBreakerCooldownSeconds)*time.Second),
+	)
+}
+
+// newExporter creates the continuous exporter from the configuration. It
+// returns nil if the export is disabled
+func newExporter() *export.Exporter {
+	if cfg.ExportDir == "" {
+		return nil
+	}
+	e, err := export.New(cfg.ExportDir, cfg.ExportBatchSize)
+	if err != nil {
+		errors.WrapFatal(err)
+	}
+	return e
+}
+
+// newEnricher creates the link enricher from the configuration. It returns nil
+// if the link enrichment is disabled
+func newEnricher(store func(*links.Job, []*links.Link) error) *links.Enricher {
+	if !cfg.LinksEnrich {
+		return nil
+	}
+	scams := make(map[string]bool)
+	if cfg.LinksScamList != "" {
+		var err error
+		if scams, err = links.ReadDomains(cfg.LinksScamList); err != nil {
+			errors.WrapFatal(err)
+		}
+	}
+	timeout := time.Duration(cfg.LinksTimeoutMs) * time.Millisecond
+	return links.NewEnricher(links.NewDomainResolver(scams, timeout), timeout, store)
+}
+
+// newAccountEnricher creates the account enrichment from the configuration. It
+// returns nil if the account enrichment is disabled
+func newAccountEnricher(h *helix.Client, store func(*accounts.Job, *accounts.Age) error) *accounts.Enricher {
+	if !cfg.AccountsEnrich {
+		return nil
+	}
+	return accounts.NewEnricher(h, cfg.AccountsFollowAge, store)
+}
+
+// newSampler creates the sampler of clean messages from the configuration. It
+// returns nil if the sampling is disabled
+func newSampler() *sampling.Sampler {
+	if cfg.SamplingRate <= 0 {
+		return nil
+	}
+	s, err := sampling.New(cfg.SamplingRate, cfg.SamplingMaxPerMinute, cfg.SamplingRaw, cfg.SamplingSecret)
+	if err != nil {
+		errors.WrapFatal(err)
+	}
+	return s
+}
+
+// newClassifier creates the reason classifier from the configuration. It
+// returns nil if the tagging is disabled
+func newClassifier() *tags.Classifier {
+	if !cfg.TagsEnabled {
+		return nil
+	}
+	keywords := make(map[string][]string)
+	if cfg.TagsKeywords != "" {
+		var err error
+		if keywords, err = tags.ReadKeywords(cfg.TagsKeywords); err != nil {
+			errors.WrapFatal(err)
+		}
+	}
+	patterns := tags.FollowBotPatterns
+	if cfg.TagsNamePatterns != "" {
+		patterns = strings.Split(cfg.TagsNamePatterns, ",")
+	}
+	c := tags.New(keywords, patterns)
+	if err := c.Compile(); err != nil {
+		errors.WrapFatal(err)
+	}
+	return c
+}
+
+// newCommands creates the parser of the moderation commands from the
+// configuration. It returns nil if the reasons are not inferred from them
+func newCommands() *modcmd.Parser {
+	if !cfg.CommandReasons {
+		return nil
+	}
+	ban, timeout := modcmd.DefaultBan, modcmd.DefaultTimeout
+	if cfg.CommandReasonsBan != "" {
+		ban = strings.Split(cfg.CommandReasonsBan, ",")
+	}
+	if cfg.CommandReasonsTimeout != "" {
+		timeout = strings.Split(cfg.CommandReasonsTimeout, ",")
+	}
+	return modcmd.New(ban, timeout)
+}
+
+// newCipher creates the cipher of the messages from the configuration. It
+// returns nil if the encryption is disabled
+func newCipher() *encryption.Cipher {
+	if cfg.EncryptionKey == "" {
+		return nil
+	}
+	keys, err := encryption.ParseKeys(cfg.EncryptionKeyID, cfg.EncryptionKey, cfg.EncryptionOldKeys)
+	if err != nil {
+		errors.WrapFatal(err)
+	}
+	return encryption.New(keys)
+}
+
 func NewStorage(d Driver) *Storage {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Storage{
-		ctx:    ctx,
-		cancel: cancel,
-		queue:  make(chan *message.Message, QueueSize),
-		driver: d,
+	analyzer := newAnalyzer()
+	s := &Storage{
+		ctx:         ctx,
+		cancel:      cancel,
+		queue:       make(chan *message.Message, QueueSize),
+		driver:      d,
+		analyzer:    analyzer,
+		clock:       clock.Real,
+		gate:        newGate(),
+		scrubber:    newScrubber(),
+		truncation:  newTruncation(),
+		emotes:      newEmotes(),
+		scorer:      newScorer(),
+		exporter:    newExporter(),
+		eventLog:    newEventLog(),
+		decisions:   newDecisionsLog(),
+		cipher:      newCipher(),
+		compress:    cfg.CompressMessages,
+		blocklists:  newBlocklists(d),
+		grace:       newGrace(),
+		massBans:    newMassBans(),
+		escalations: newEscalations(),
+		outbox:      newOutbox(d),
+		spill:       newSpiller(),
+		classifier:  newClassifier(),
+		commands:    newCommands(),
+		sampler:     newSampler(),
+		digest:      newDigest(),
+		notifiers:   newNotifiers(),
+		channelIDs:  newChannelIDs(d),
+		latency:     newLatencyBudget(),
+		groups:      newGroups(),
+		samples:     make(chan *sampling.Sample, sampling.QueueSize),
+		driverName:  driverName(d),
+
+		deletionFallback: newDeletionFallback(),
+	}
+	s.enricher = newEnricher(s.storeLinks)
+	s.feed = newBanFeed(s.sharedFeeds)
+	s.hooks = newTenantHooks(s.channelWebhooks)
+	s.quotas = newQuotas(s.tenantsOfChannels)
+	s.helix = newHelix(d)
+	s.ages = newAccountEnricher(s.helix, s.storeAccountAge)
+	s.subscribe()
+	return s
+}
+
+// subscribe creates the topics of the storage and subscribes the consumers of
+// the storage itself. They are fast or only enqueue work, so they never drop
+func (s *Storage) subscribe() {
+	s.stored = bus.NewTopic[*message.Message]("stored", busDropped("stored"))
+	s.results = bus.NewTopic[*PipelineResult]("results", busDropped("results"))
+
+	s.results.Subscribe("metrics", BusBuffer, bus.Block, observeResult)
+	s.results.Subscribe("log", BusBuffer, bus.Drop, logResult)
+	s.results.Subscribe("debug-log", BusBuffer, bus.Drop, debugResult)
+	s.results.Subscribe("latency", BusBuffer, bus.Block, s.latency.observe)
+	if s.decisions != nil {
+		s.results.Subscribe("decisions", BusBuffer, bus.Block, s.logDecision)
+	}
+	s.stored.Subscribe("time-to-action", BusBuffer, bus.Block, s.unlessExcluded(observeTimeToAction))
+	s.stored.Subscribe("sub-status", BusBuffer, bus.Block, s.unlessExcluded(observeSubStatus))
+	s.stored.Subscribe("timeout-buckets", BusBuffer, bus.Block, s.unlessExcluded(observeTimeoutBucket))
+	if s.channelIDs != nil {
+		s.stored.Subscribe("channel-ids", BusBuffer, bus.Block, s.assignChannelID)
+	}
+	if s.digest != nil {
+		s.stored.Subscribe("digest", BusBuffer, bus.Block, s.unlessExcluded(s.observeDigest))
+	}
+	if s.exporter != nil {
+		s.stored.Subscribe("export", BusBuffer, bus.Block, s.export)
+	}
+	if s.eventLog != nil {
+		s.stored.Subscribe("event-log", BusBuffer, bus.Block, s.logEvent)
+	}
+	if s.enricher != nil {
+		s.stored.Subscribe("links", BusBuffer, bus.Block, s.enrichLinks)
+	}
+	if s.ages != nil {
+		s.stored.Subscribe("accounts", BusBuffer, bus.Block, s.enrichAccount)
+	}
+	// the outbox delivers the webhooks itself
+	if s.feed != nil && s.outbox == nil {
+		s.stored.Subscribe("ban-feed", BusBuffer, bus.Block, s.shareBan)
+	}
+	if s.hooks != nil && s.outbox == nil {
+		s.stored.Subscribe("tenant-webhooks", BusBuffer, bus.Block, s.notifyTenant)
+	}
+	if s.groups != nil && s.groups.dispatcher != nil && s.outbox == nil {
+		s.stored.Subscribe("group-webhooks", BusBuffer, bus.Block, s.notifyGroup)
 	}
 }
 
@@ -84,7 +1744,9 @@ type Op struct {
 	username string
 	channel  string
 	duration int
-	messages string
+	// messages are the bodies of the messages encoded as a JSON array, see
+	// encodeMessages
+	messages []byte
 	at       time.Time
 }
 
@@ -110,28 +1772,41 @@ type Postgres struct {
 	size     int
 	ctx      context.Context
 	cancel   context.CancelFunc
-	// In memory hash-table to cache and map twitch channels to internal ids to
-	// avoid querying in every query
-	chanIds  map[string]int
 	analyzer *heuristics.Analyzer
+	// gate is nil unless the toxicity score gates the storage. It runs apart
+	// from the analyzer because the messages are only scored once they passed
+	// the heuristics and were scrubbed, see score
+	gate *heuristics.Analyzer
 }
 
 type Channel string
 
 const sep = "|"
 
-// replacer is safe for concurrent use
-var replacer = strings.NewReplacer(sep, "\\"+sep)
+// encodeMessages encodes the bodies of msgs as a JSON array, stored as is in
+// the jsonb messages column of Postgres. Unlike joining them with a separator,
+// the bodies need no escaping and can be queried by the database
+func encodeMessages(msgs []*message.PrivateMessage) ([]byte, error) {
+	bodies := make([]string, len(msgs))
+	for i, privmsg := range msgs {
+		bodies[i] = privmsg.Body
+	}
+	b, err := json.Marshal(bodies)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return b, nil
+}
 
 func (sto *Postgres) Save(msg *message.Message) {
 	var (
-		sb     strings.Builder
 		logmsg strings.Builder
 		t      = heuristics.Traits{}
 	)
 	if len(msg.LastMessages) > 0 {
 		privmsg := msg.LastMessages[0]
-		logmsg.WriteString(fmt.Sprintf("%s: %s; T-%f", msg.Username, privmsg.Body, msg.At.Sub(msg.LastMessages[0].At).Seconds()))
+		tta, _ := msg.TimeToAction()
+		logmsg.WriteString(fmt.Sprintf("%s: %s; T-%f", msg.Username, privmsg.Body, tta.Seconds()))
 	}
 
 	// flag to identify most recent message (=msg.LastMessages[0])
@@ -140,6 +1815,7 @@ func (sto *Postgres) Save(msg *message.Message) {
 		// reuse trait object for every recent message
 		t.Body = privmsg.Body
 		t.At = privmsg.At
+		t.Badges = privmsg.Badges
 		t.ModeratedAt = msg.At
 		t.Type = msg.Type
 		t.TimeoutDuration = msg.Duration
@@ -148,13 +1824,11 @@ func (sto *Postgres) Save(msg *message.Message) {
 			return
 		}
 		t.IsMostRecentMsg = false
-
-		sb.WriteString(replacer.Replace(privmsg.Body) + sep)
 	}
-	str := sb.String()
-	if len(str) > 0 {
-		// Trim last sep
-		str = str[:len(str)-1]
+	msgs, err := encodeMessages(msg.LastMessages)
+	if err != nil {
+		errors.WrapAndLog(err)
+		return
 	}
 
 	sto.op <- &Op{
@@ -163,7 +1837,7 @@ func (sto *Postgres) Save(msg *message.Message) {
 		username: msg.Username,
 		channel:  msg.Channel,
 		duration: msg.Duration,
-		messages: str,
+		messages: msgs,
 		at:       msg.At,
 	}
 	logmsg.WriteString(" [S]")
@@ -0,0 +1,102 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/heuristics/testkit"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestEncodeMessages(t *testing.T) {
+	t.Parallel()
+	bodies := []string{"a|b", `back\slash`, `"quoted"`, ""}
+	msgs := make([]*message.PrivateMessage, len(bodies))
+	for i, body := range bodies {
+		msgs[i] = &message.PrivateMessage{Body: body}
+	}
+	b, err := encodeMessages(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, bodies) {
+		t.Fatalf("got: %q, want: %q", got, bodies)
+	}
+}
+
+func BenchmarkEncodeMessages(b *testing.B) {
+	for _, n := range []int{1, 10, message.MaxHistory} {
+		msgs := make([]*message.PrivateMessage, n)
+		for i := range msgs {
+			msgs[i] = &message.PrivateMessage{Body: fmt.Sprintf("message %d with a | separator and some more words", i)}
+		}
+		b.Run(fmt.Sprintf("messages=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := encodeMessages(msgs); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// slowScorer scores every message with 0.5, or waits for ctx if slow
+type slowScorer struct {
+	slow   bool
+	called bool
+}
+
+func (s *slowScorer) Score(ctx context.Context, body string) (float64, error) {
+	s.called = true
+	if s.slow {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	return 0.5, nil
+}
+
+func TestScoreDeadline(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		deadline time.Time
+		slow     bool
+		called   bool
+		scored   bool
+		partial  bool
+	}{
+		{name: "no budget", called: true, scored: true},
+		{name: "within budget", deadline: now.Add(time.Second), called: true, scored: true},
+		{name: "over budget", deadline: now, partial: true},
+		{name: "slow scorer", deadline: now.Add(10 * time.Millisecond), slow: true, called: true, partial: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			scorer := &slowScorer{slow: tt.slow}
+			s := &Storage{ctx: context.Background(), clock: testkit.NewClock(now), scorer: scorer}
+			msg := &message.Message{LastMessages: []*message.PrivateMessage{{Body: "hello"}}}
+			s.score(msg, tt.deadline)
+			if scorer.called != tt.called {
+				t.Errorf("called got: %v, want: %v", scorer.called, tt.called)
+			}
+			if (msg.Toxicity != nil) != tt.scored {
+				t.Errorf("scored got: %v, want: %v", msg.Toxicity != nil, tt.scored)
+			}
+			if msg.Partial != tt.partial {
+				t.Errorf("partial got: %v, want: %v", msg.Partial, tt.partial)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package bot
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/metrics"
+)
+
+// RunSummary is the close-out summary of a run of the tracker, logged when the
+// bot stops
+type RunSummary struct {
+	StartedAt time.Time `json:"started_at"`
+	StoppedAt time.Time `json:"stopped_at"`
+	Uptime    string    `json:"uptime"`
+	// Events are the events ingested by channel
+	Events map[string]float64 `json:"events"`
+	Stored float64            `json:"stored"`
+	// Rejected are the moderations not stored by rule
+	Rejected      map[string]float64 `json:"rejected"`
+	StorageErrors map[string]float64 `json:"storage_errors"`
+	// Dropped are the jobs dropped by queue
+	Dropped map[string]float64 `json:"dropped"`
+}
+
+// byLabel sums the samples by the label at index i
+func byLabel(samples []metrics.Sample, i int) map[string]float64 {
+	sums := make(map[string]float64)
+	for _, s := range samples {
+		sums[s.Labels[i]] += s.Value
+	}
+	return sums
+}
+
+func total(samples []metrics.Sample) float64 {
+	var n float64
+	for _, s := range samples {
+		n += s.Value
+	}
+	return n
+}
+
+// Summary summarizes the run of the bot until now
+func (b *Bot) Summary() *RunSummary {
+	now := b.clock.Now()
+	return &RunSummary{
+		StartedAt:     b.startedAt,
+		StoppedAt:     now,
+		Uptime:        now.Sub(b.startedAt).Round(time.Second).String(),
+		Events:        byLabel(eventsTotal.Samples(), 0),
+		Stored:        total(moderationsStored.Samples()),
+		Rejected:      byLabel(moderationsRejected.Samples(), 0),
+		StorageErrors: byLabel(storageErrors.Samples(), 0),
+		Dropped:       byLabel(dropped.Samples(), 0),
+	}
+}
+
+// logSummary logs the summary of the run as a single JSON line, so it can be
+// picked up by log collectors
+func (b *Bot) logSummary() {
+	data, err := json.Marshal(b.Summary())
+	if err != nil {
+		errors.WrapAndLog(err)
+		return
+	}
+	log.Printf("run summary: %s", data)
+}
@@ -0,0 +1,311 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gempir/go-twitch-irc/v3"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+)
+
+// Reasons of the suspensions of the channels
+const (
+	// SuspensionNotFound is a channel that doesn't exist in Helix, e.g. banned
+	// or renamed
+	SuspensionNotFound = "not found in twitch"
+	// SuspensionIRC is a channel whose JOIN was refused by twitch with a
+	// msg_channel_suspended notice
+	SuspensionIRC = "suspended in chat"
+)
+
+// SuspensionCheckTimeout is how long a check of the suspended channels against
+// Helix may take
+const SuspensionCheckTimeout = 30 * time.Second
+
+// ChannelSuspension is a tracked channel that is not joined anymore because it
+// failed to be joined too many times in a row, e.g. a channel banned from
+// twitch, until it is found again
+type ChannelSuspension struct {
+	Channel     Channel
+	Reason      string
+	SuspendedAt time.Time
+}
+
+// SuspensionStore is implemented by drivers that keep the suspended channels,
+// so they are not joined again after a restart
+type SuspensionStore interface {
+	SuspendChannel(s *ChannelSuspension) error
+	ResumeChannel(ch Channel) error
+	ChannelSuspensions() ([]*ChannelSuspension, error)
+}
+
+// suspensions counts the consecutive failures of the tracked channels and
+// keeps the suspended ones. It is safe for concurrent use
+type suspensions struct {
+	// store is nil if the suspensions are forgotten on restart
+	store    SuspensionStore
+	after    int
+	interval time.Duration
+
+	mu        sync.Mutex
+	failures  map[Channel]int
+	suspended map[Channel]*ChannelSuspension
+}
+
+// fail counts a failure of the channel at `now`. It returns the suspension of
+// the channel once it fails `after` times in a row, nil otherwise
+func (s *suspensions) fail(ch Channel, reason string, now time.Time) *ChannelSuspension {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.suspended[ch]; ok {
+		return nil
+	}
+	s.failures[ch]++
+	if s.failures[ch] < s.after {
+		return nil
+	}
+	delete(s.failures, ch)
+	sus := &ChannelSuspension{Channel: ch, Reason: reason, SuspendedAt: now}
+	s.suspended[ch] = sus
+	return sus
+}
+
+// succeed resets the failures of the channel
+func (s *suspensions) succeed(ch Channel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.failures, ch)
+}
+
+// resume forgets the suspension of the channel. It returns false if it was not
+// suspended
+func (s *suspensions) resume(ch Channel) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.suspended[ch]; !ok {
+		return false
+	}
+	delete(s.suspended, ch)
+	return true
+}
+
+// active returns the channels of `chs` that are not suspended
+func (s *suspensions) active(chs []Channel) []Channel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	active := make([]Channel, 0, len(chs))
+	for _, ch := range chs {
+		if _, ok := s.suspended[Channel(strings.ToLower(string(ch)))]; !ok {
+			active = append(active, ch)
+		}
+	}
+	return active
+}
+
+// channels returns the suspended channels and the ones failing, sorted
+func (s *suspensions) channels() (suspended, failing []Channel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.suspended {
+		suspended = append(suspended, ch)
+	}
+	for ch := range s.failures {
+		failing = append(failing, ch)
+	}
+	sort.Slice(suspended, func(i, j int) bool { return suspended[i] < suspended[j] })
+	sort.Slice(failing, func(i, j int) bool { return failing[i] < failing[j] })
+	return suspended, failing
+}
+
+// list returns the suspended channels with their reasons, sorted
+func (s *suspensions) list() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chs := make([]string, 0, len(s.suspended))
+	for ch, sus := range s.suspended {
+		chs = append(chs, fmt.Sprintf("%s (%s since %s)", ch, sus.Reason, sus.SuspendedAt.UTC().Format(time.RFC3339)))
+	}
+	sort.Strings(chs)
+	return chs
+}
+
+// load reads the suspended channels of the store, if any
+func (s *suspensions) load() error {
+	if s.store == nil {
+		return nil
+	}
+	all, err := s.store.ChannelSuspensions()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sus := range all {
+		s.suspended[sus.Channel] = sus
+	}
+	return nil
+}
+
+// newSuspensions returns nil if the channels are never suspended. The
+// suspensions are kept in memory only if the driver doesn't support them
+func newSuspensions(d Driver) *suspensions {
+	if cfg.ChannelSuspendFailures <= 0 {
+		return nil
+	}
+	store, _ := d.(SuspensionStore)
+	return &suspensions{
+		store:     store,
+		after:     cfg.ChannelSuspendFailures,
+		interval:  time.Duration(cfg.ChannelSuspensionCheckMinutes) * time.Minute,
+		failures:  make(map[Channel]int),
+		suspended: make(map[Channel]*ChannelSuspension),
+	}
+}
+
+// joinFailed counts a failure to join the channel, suspending it once it
+// failed too many times in a row
+func (b *Bot) joinFailed(ch Channel, reason string) {
+	if b.suspensions == nil {
+		return
+	}
+	// e.g. disabled since
+	if !b.IsTracked(ch) {
+		b.suspensions.succeed(ch)
+		return
+	}
+	sus := b.suspensions.fail(ch, reason, b.clock.Now())
+	if sus == nil {
+		return
+	}
+	// the channel of the bot is never departed, see DisableChannel
+	if string(ch) != strings.ToLower(cfg.ClientUsername) {
+		b.mu.RLock()
+		source := b.source
+		b.mu.RUnlock()
+		if source != nil {
+			source.Depart(string(ch))
+		}
+	}
+	b.untrack(ch)
+	channelSuspensions.Inc(string(ch))
+	log.Printf("WARNING: suspended #%s, %s, it is checked again every %s", ch, reason, b.suspensions.interval)
+	if b.suspensions.store != nil {
+		if err := b.suspensions.store.SuspendChannel(sus); err != nil {
+			errors.WrapAndLog(err)
+		}
+	}
+}
+
+// joined resets the failures of the channel, e.g. once its JOIN succeeded
+func (b *Bot) joined(ch Channel) {
+	if b.suspensions != nil {
+		b.suspensions.succeed(ch)
+	}
+}
+
+// handleNotice counts the JOINs refused because the channel is suspended
+func (b *Bot) handleNotice(msg twitch.NoticeMessage) {
+	if msg.MsgID == "msg_channel_suspended" {
+		b.joinFailed(Channel(strings.ToLower(msg.Channel)), SuspensionIRC)
+	}
+}
+
+// handleRoomState resets the failures of a channel, its ROOMSTATE is the
+// answer of twitch to a JOIN that succeeded
+func (b *Bot) handleRoomState(msg twitch.RoomStateMessage) {
+	b.joined(Channel(strings.ToLower(msg.Channel)))
+}
+
+// checkSuspensions looks up in Helix the channels failing to be joined, which
+// fail again if they are still not found, and the suspended ones, which are
+// tracked again once they are found
+func (b *Bot) checkSuspensions(ctx context.Context) error {
+	suspended, failing := b.suspensions.channels()
+	chs := append(suspended, failing...)
+	if len(chs) == 0 {
+		return nil
+	}
+	logins := make([]string, len(chs))
+	for i, ch := range chs {
+		logins[i] = string(ch)
+	}
+	ctx, cancel := context.WithTimeout(ctx, SuspensionCheckTimeout)
+	defer cancel()
+	users, err := b.helix.Users(ctx, logins)
+	if err != nil {
+		return err
+	}
+	found := make(map[string]bool, len(users))
+	for _, u := range users {
+		found[strings.ToLower(u.Login)] = true
+	}
+	for _, ch := range failing {
+		if !found[string(ch)] {
+			b.joinFailed(ch, SuspensionNotFound)
+		}
+	}
+	for _, ch := range suspended {
+		if found[string(ch)] {
+			b.resume(ch)
+		}
+	}
+	return nil
+}
+
+// resume tracks a suspended channel again
+func (b *Bot) resume(ch Channel) {
+	if !b.suspensions.resume(ch) {
+		return
+	}
+	if b.suspensions.store != nil {
+		if err := b.suspensions.store.ResumeChannel(ch); err != nil {
+			errors.WrapAndLog(err)
+		}
+	}
+	b.invalid.Delete(string(ch))
+	if b.track(ch) {
+		b.mu.RLock()
+		source := b.source
+		b.mu.RUnlock()
+		if source != nil {
+			source.Join(string(ch))
+		}
+		log.Printf("tracking #%s again, it was found in twitch", ch)
+	}
+}
+
+// startSuspensions checks the suspensions every interval until ctx is done.
+// Nothing is checked without a Helix client id
+func (b *Bot) startSuspensions(ctx context.Context) {
+	if cfg.HelixClientID == "" {
+		return
+	}
+	t := time.NewTicker(b.suspensions.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+		if err := b.checkSuspensions(ctx); err != nil {
+			errors.WrapAndLog(err)
+		}
+	}
+}
+
+// SuspendedChannels returns the suspended channels, with the reason and the
+// time of their suspension, sorted
+func (b *Bot) SuspendedChannels() []string {
+	if b.suspensions == nil {
+		return nil
+	}
+	return b.suspensions.list()
+}
@@ -0,0 +1,52 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSuspensions(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := &suspensions{
+		after:     3,
+		failures:  make(map[Channel]int),
+		suspended: make(map[Channel]*ChannelSuspension),
+	}
+	// a success resets the failures in a row
+	s.fail("foo", SuspensionIRC, now)
+	s.fail("foo", SuspensionIRC, now)
+	s.succeed("foo")
+	if sus := s.fail("foo", SuspensionIRC, now); sus != nil {
+		t.Fatalf("got: %+v, want: %v", sus, nil)
+	}
+	s.fail("foo", SuspensionIRC, now)
+	sus := s.fail("foo", SuspensionNotFound, now)
+	if sus == nil || sus.Channel != "foo" || sus.Reason != SuspensionNotFound {
+		t.Fatalf("got: %+v, want a suspension of foo", sus)
+	}
+	// a suspended channel doesn't fail again
+	if sus := s.fail("foo", SuspensionIRC, now); sus != nil {
+		t.Errorf("got: %+v, want: %v", sus, nil)
+	}
+	s.fail("bar", SuspensionIRC, now)
+
+	suspended, failing := s.channels()
+	if !reflect.DeepEqual(suspended, []Channel{"foo"}) || !reflect.DeepEqual(failing, []Channel{"bar"}) {
+		t.Errorf("got: %v %v, want: %v %v", suspended, failing, []Channel{"foo"}, []Channel{"bar"})
+	}
+	if got, want := s.active([]Channel{"Foo", "bar", "baz"}), []Channel{"bar", "baz"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+	if got, want := s.list(), []string{"foo (not found in twitch since 2023-01-01T12:00:00Z)"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+
+	if !s.resume("foo") || s.resume("foo") {
+		t.Error("got: the suspension resumed twice, want: once")
+	}
+	if got := s.list(); len(got) != 0 {
+		t.Errorf("got: %v, want: none", got)
+	}
+}
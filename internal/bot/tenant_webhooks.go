@@ -0,0 +1,141 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/message"
+	"github.com/hammertrack/tracker/internal/webhook"
+)
+
+const (
+	// TenantWebhooksRefresh is the interval at which the webhooks of the tenants
+	// are reloaded, the new webhooks receive deliveries after at most this long
+	TenantWebhooksRefresh = time.Minute
+	// TenantWebhooksQueue is the maximum number of pending webhook deliveries
+	TenantWebhooksQueue = 1000
+	// TenantWebhooksTimeout is the maximum time of every webhook request
+	TenantWebhooksTimeout = 5 * time.Second
+)
+
+// TenantModeration is a moderation delivered to the webhooks of the tenant of
+// its channel
+type TenantModeration struct {
+	TenantID string    `json:"tenant_id"`
+	Channel  string    `json:"channel"`
+	Username string    `json:"username"`
+	Type     string    `json:"type"`
+	At       time.Time `json:"at"`
+	Duration int       `json:"duration,omitempty"`
+	Messages []string  `json:"messages"`
+	Toxicity *float64  `json:"toxicity,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+}
+
+// notifyTenant delivers a stored moderation to the webhooks of the tenant of
+// its channel
+func (s *Storage) notifyTenant(msg *message.Message) {
+	enqueueDeliveries(s.tenantDeliveries(msg))
+}
+
+// tenantDeliveries returns the deliveries of a stored moderation to the
+// webhooks of the tenant of its channel
+func (s *Storage) tenantDeliveries(msg *message.Message) []*queuedDelivery {
+	if s.hooks == nil {
+		return nil
+	}
+	hooks := s.hooks.webhooks(msg.Channel)
+	if len(hooks) == 0 {
+		return nil
+	}
+	m := &TenantModeration{
+		TenantID: hooks[0].TenantID,
+		Channel:  msg.Channel,
+		Username: msg.Username,
+		Type:     string(msg.Type),
+		At:       msg.At,
+		Duration: msg.Duration,
+		Messages: make([]string, len(msg.LastMessages)),
+		Toxicity: msg.Toxicity,
+		Tags:     msg.Tags,
+	}
+	for i, privmsg := range msg.LastMessages {
+		m.Messages[i] = privmsg.Body
+	}
+	body, err := json.Marshal(m)
+	if err != nil {
+		errors.WrapAndLog(err)
+		return nil
+	}
+	dels := make([]*queuedDelivery, len(hooks))
+	for i, h := range hooks {
+		dels[i] = &queuedDelivery{
+			Delivery:   &webhook.Delivery{URL: h.URL, Secret: h.Secret, Body: body},
+			dispatcher: s.hooks.dispatcher,
+			hook:       h.ID,
+		}
+	}
+	return dels
+}
+
+// tenantHooks keeps in memory the webhooks of the tenants by channel, so
+// notifyTenant does not hit the database
+type tenantHooks struct {
+	load       func() (map[Channel][]*TenantWebhook, error)
+	dispatcher *webhook.Dispatcher
+
+	mu    sync.RWMutex
+	hooks map[Channel][]*TenantWebhook
+}
+
+func (t *tenantHooks) webhooks(ch string) []*TenantWebhook {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.hooks[Channel(ch)]
+}
+
+func (t *tenantHooks) refresh() {
+	hooks, err := t.load()
+	if err != nil {
+		if !errors.Is(err, ErrUnsupported) {
+			errors.WrapAndLog(err)
+		}
+		return
+	}
+	t.mu.Lock()
+	t.hooks = hooks
+	t.mu.Unlock()
+}
+
+// Start delivers the moderations and reloads the webhooks periodically until
+// ctx is done
+func (t *tenantHooks) Start(ctx context.Context) {
+	go t.dispatcher.Start(ctx)
+	tick := time.NewTicker(TenantWebhooksRefresh)
+	defer tick.Stop()
+	for {
+		t.refresh()
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// newTenantHooks creates the delivery of the webhooks of the tenants from the
+// configuration. It returns nil if they are disabled
+func newTenantHooks(load func() (map[Channel][]*TenantWebhook, error)) *tenantHooks {
+	if !cfg.TenantWebhooks {
+		return nil
+	}
+	return &tenantHooks{
+		load:       load,
+		dispatcher: webhook.New(cfg.TenantWebhookWorkers, TenantWebhooksQueue, TenantWebhooksTimeout),
+		hooks:      make(map[Channel][]*TenantWebhook),
+	}
+}
@@ -0,0 +1,378 @@
+package bot
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+// APIKeyPrefix is the prefix of every tenant API key
+const APIKeyPrefix = "ht_"
+
+var (
+	ErrTenantNotFound = errors.New("tenant not found")
+	ErrTenantExists   = errors.New("tenant already exists")
+	// ErrChannelOwned is returned when adding to a tenant a channel that
+	// belongs to another tenant
+	ErrChannelOwned  = errors.New("channel belongs to another tenant")
+	ErrInvalidAPIKey = errors.New("invalid API key")
+)
+
+// Tenant is a community the tracker is hosted for. Its channels, API keys and
+// retention policy are its own
+type Tenant struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// RetentionDays is the number of days the moderations of the channels of
+	// the tenant are kept, forever if 0
+	RetentionDays int       `json:"retention_days"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// APIKey grants access to the API scoped to a tenant. Only the hash of the key
+// is stored
+type APIKey struct {
+	// ID is the public part of the key, used to look it up and revoke it
+	ID       string
+	TenantID string
+	Name     string
+	Hash     string
+	// Role is RoleAdmin if empty, for the keys created before the roles
+	Role Role
+	// Channels are the channels the key is scoped to, all the channels of the
+	// tenant if empty
+	Channels  []Channel
+	CreatedAt time.Time
+}
+
+// TenantWebhook receives the moderations stored in the channels of its tenant.
+// Every delivery is signed with its secret, see package webhook
+type TenantWebhook struct {
+	ID        string    `json:"id"`
+	TenantID  string    `json:"tenant_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TenantStore is implemented by drivers that can store tenants.
+type TenantStore interface {
+	CreateTenant(t *Tenant) error
+	// Tenant returns ErrTenantNotFound if it does not exist
+	Tenant(id string) (*Tenant, error)
+	Tenants() ([]*Tenant, error)
+	// AddTenantChannel returns ErrChannelOwned if the channel belongs to
+	// another tenant
+	AddTenantChannel(tenantID string, ch Channel) error
+	RemoveTenantChannel(tenantID string, ch Channel) error
+	TenantChannels(tenantID string) ([]Channel, error)
+	CreateAPIKey(k *APIKey) error
+	// APIKey returns ErrInvalidAPIKey if it does not exist
+	APIKey(id string) (*APIKey, error)
+	RevokeAPIKey(id string) error
+	CreateTenantWebhook(h *TenantWebhook) error
+	DeleteTenantWebhook(tenantID, id string) error
+	TenantWebhooks(tenantID string) ([]*TenantWebhook, error)
+	// ChannelWebhooks returns the webhooks of the tenant of every channel
+	ChannelWebhooks() (map[Channel][]*TenantWebhook, error)
+}
+
+func (s *Storage) tenants() (TenantStore, error) {
+	t, ok := s.driver.(TenantStore)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return t, nil
+}
+
+func (s *Storage) CreateTenant(t *Tenant, actor string) error {
+	ts, err := s.tenants()
+	if err != nil {
+		return err
+	}
+	t.ID = strings.ToLower(t.ID)
+	t.CreatedAt = s.clock.Now()
+	if err := ts.CreateTenant(t); err != nil {
+		return err
+	}
+	s.auditTenant("tenant-create", actor, t.ID)
+	return nil
+}
+
+func (s *Storage) Tenant(id string) (*Tenant, error) {
+	ts, err := s.tenants()
+	if err != nil {
+		return nil, err
+	}
+	return ts.Tenant(strings.ToLower(id))
+}
+
+func (s *Storage) Tenants() ([]*Tenant, error) {
+	ts, err := s.tenants()
+	if err != nil {
+		return nil, err
+	}
+	return ts.Tenants()
+}
+
+// AddTenantChannel assigns the channel to the tenant. The channel is not
+// tracked until it is added to the tracked channels
+func (s *Storage) AddTenantChannel(tenantID string, ch Channel, actor string) error {
+	ts, err := s.tenants()
+	if err != nil {
+		return err
+	}
+	tenantID = strings.ToLower(tenantID)
+	if _, err := ts.Tenant(tenantID); err != nil {
+		return err
+	}
+	ch = Channel(strings.ToLower(string(ch)))
+	if err := ts.AddTenantChannel(tenantID, ch); err != nil {
+		return err
+	}
+	s.auditTenant("tenant-add-channel", actor, tenantID+"/"+string(ch))
+	return nil
+}
+
+func (s *Storage) RemoveTenantChannel(tenantID string, ch Channel, actor string) error {
+	ts, err := s.tenants()
+	if err != nil {
+		return err
+	}
+	tenantID = strings.ToLower(tenantID)
+	ch = Channel(strings.ToLower(string(ch)))
+	if err := ts.RemoveTenantChannel(tenantID, ch); err != nil {
+		return err
+	}
+	s.auditTenant("tenant-remove-channel", actor, tenantID+"/"+string(ch))
+	return nil
+}
+
+func (s *Storage) TenantChannels(tenantID string) ([]Channel, error) {
+	ts, err := s.tenants()
+	if err != nil {
+		return nil, err
+	}
+	return ts.TenantChannels(strings.ToLower(tenantID))
+}
+
+// CreateAPIKey creates a new API key of the tenant with the role, scoped to
+// the channels `chs` or to all of them if empty, and returns it. The key is
+// not stored, it cannot be retrieved again
+func (s *Storage) CreateAPIKey(tenantID, name string, role Role, chs []Channel, actor string) (string, error) {
+	ts, err := s.tenants()
+	if err != nil {
+		return "", err
+	}
+	if _, ok := roleRanks[role]; !ok {
+		return "", ErrUnknownRole
+	}
+	tenantID = strings.ToLower(tenantID)
+	if _, err := ts.Tenant(tenantID); err != nil {
+		return "", err
+	}
+	scope := make([]Channel, len(chs))
+	for i, ch := range chs {
+		scope[i] = Channel(strings.ToLower(string(ch)))
+		if err := s.owns(tenantID, scope[i]); err != nil {
+			return "", errors.WrapWithContext(err, struct{ Channel Channel }{ch})
+		}
+	}
+	id, err := randomHex(6)
+	if err != nil {
+		return "", err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return "", err
+	}
+	key := APIKeyPrefix + id + "_" + secret
+	if err := ts.CreateAPIKey(&APIKey{
+		ID:        id,
+		TenantID:  tenantID,
+		Name:      name,
+		Hash:      hashAPIKey(key),
+		Role:      role,
+		Channels:  scope,
+		CreatedAt: s.clock.Now(),
+	}); err != nil {
+		return "", err
+	}
+	s.auditTenant("tenant-create-key", actor, tenantID+"/"+id)
+	return key, nil
+}
+
+func (s *Storage) RevokeAPIKey(id, actor string) error {
+	ts, err := s.tenants()
+	if err != nil {
+		return err
+	}
+	if err := ts.RevokeAPIKey(id); err != nil {
+		return err
+	}
+	s.auditTenant("tenant-revoke-key", actor, id)
+	return nil
+}
+
+// CreateTenantWebhook adds a webhook receiving the moderations of the channels
+// of the tenant. The returned webhook has the secret used to sign the
+// deliveries, it cannot be retrieved again
+func (s *Storage) CreateTenantWebhook(tenantID, webhookURL, actor string) (*TenantWebhook, error) {
+	ts, err := s.tenants()
+	if err != nil {
+		return nil, err
+	}
+	if err := validWebhookURL(webhookURL); err != nil {
+		return nil, err
+	}
+	tenantID = strings.ToLower(tenantID)
+	if _, err := ts.Tenant(tenantID); err != nil {
+		return nil, err
+	}
+	id, err := randomHex(6)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return nil, err
+	}
+	h := &TenantWebhook{
+		ID:        id,
+		TenantID:  tenantID,
+		URL:       webhookURL,
+		Secret:    secret,
+		CreatedAt: s.clock.Now(),
+	}
+	if err := ts.CreateTenantWebhook(h); err != nil {
+		return nil, err
+	}
+	s.auditTenant("tenant-add-webhook", actor, tenantID+"/"+id)
+	return h, nil
+}
+
+func (s *Storage) DeleteTenantWebhook(tenantID, id, actor string) error {
+	ts, err := s.tenants()
+	if err != nil {
+		return err
+	}
+	tenantID = strings.ToLower(tenantID)
+	if err := ts.DeleteTenantWebhook(tenantID, id); err != nil {
+		return err
+	}
+	s.auditTenant("tenant-remove-webhook", actor, tenantID+"/"+id)
+	return nil
+}
+
+// TenantWebhooks returns the webhooks of the tenant, without their secrets
+func (s *Storage) TenantWebhooks(tenantID string) ([]*TenantWebhook, error) {
+	ts, err := s.tenants()
+	if err != nil {
+		return nil, err
+	}
+	hooks, err := ts.TenantWebhooks(strings.ToLower(tenantID))
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range hooks {
+		h.Secret = ""
+	}
+	return hooks, nil
+}
+
+// channelWebhooks loads the webhooks of the tenants. See TenantStore
+func (s *Storage) channelWebhooks() (map[Channel][]*TenantWebhook, error) {
+	ts, err := s.tenants()
+	if err != nil {
+		return nil, err
+	}
+	return ts.ChannelWebhooks()
+}
+
+// Authenticate returns the access granted by the API key, or ErrInvalidAPIKey
+func (s *Storage) Authenticate(key string) (*Access, error) {
+	ts, err := s.tenants()
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(strings.TrimPrefix(key, APIKeyPrefix), "_", 2)
+	if !strings.HasPrefix(key, APIKeyPrefix) || len(parts) != 2 {
+		return nil, ErrInvalidAPIKey
+	}
+	k, err := ts.APIKey(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hashAPIKey(key))) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+	t, err := ts.Tenant(k.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	a := &Access{KeyID: k.ID, Tenant: t, Role: k.Role, Channels: k.Channels}
+	if a.Role == "" {
+		a.Role = RoleAdmin
+	}
+	return a, nil
+}
+
+// TenantModerations returns the most recent moderations of `username` in the
+// channels of the access, or only in `ch` if not empty, tagged with `tag` if
+// not empty. A channel of another tenant or out of the scope of the access
+// returns no moderations
+func (s *Storage) TenantModerations(a *Access, username string, ch Channel, tag string, limit int) ([]*Moderation, error) {
+	chs, err := s.TenantChannels(a.Tenant.ID)
+	if err != nil {
+		return nil, err
+	}
+	chs = a.Scope(chs)
+	all := make([]*Moderation, 0, limit)
+	for _, tch := range chs {
+		if ch != "" && !strings.EqualFold(string(ch), string(tch)) {
+			continue
+		}
+		mods, err := s.TaggedUserModerations(username, tch, tag, limit)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, mods...)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].At.After(all[j].At)
+	})
+	if len(all) > limit {
+		all = all[:limit]
+	}
+	return all, nil
+}
+
+func (s *Storage) auditTenant(action, actor, target string) {
+	if err := s.Audit(&AuditEntry{
+		Action: action,
+		Actor:  actor,
+		Target: target,
+		At:     s.clock.Now(),
+	}); err != nil && !errors.Is(err, ErrUnsupported) {
+		errors.WrapAndLog(err)
+	}
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,100 @@
+package bot
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// TimelineReader is implemented by drivers that can page through the
+// moderations of a user in a channel.
+type TimelineReader interface {
+	// UserModerationsBefore is Reader.UserModerations of the moderations of the
+	// channel `ch` before `before`
+	UserModerationsBefore(username string, ch Channel, before time.Time, limit int) ([]*Moderation, error)
+}
+
+// Timeline is a page of the case file of a user in a channel: every stored
+// moderation of the user, e.g. warnings, timeouts and bans, with the messages
+// that led to each one, the most recent first
+type Timeline struct {
+	Entries []*Moderation `json:"entries"`
+	// Annotations are the notes of the moderators about the entries, and about
+	// the user on the first page, the most recent first. See Annotate
+	Annotations []*Annotation `json:"annotations,omitempty"`
+	// Next is the cursor of the next page, nil if this is the last one
+	Next *time.Time `json:"next,omitempty"`
+}
+
+// Timeline returns the page of the timeline of `username` in `ch` before
+// `before`, or the first page if it is zero. The moderations of the previous
+// and later logins of the user are merged in, like with UserModerations
+func (s *Storage) Timeline(username string, ch Channel, before time.Time, limit int) (*Timeline, error) {
+	r, ok := s.driver.(TimelineReader)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	ch = Channel(strings.ToLower(string(ch)))
+	logins, err := s.aliases(strings.ToLower(username))
+	if err != nil {
+		return nil, err
+	}
+	var (
+		all []*Moderation
+		// cursor is the most recent time the moderations of a login were cut
+		// at, the older ones of the rest of logins belong to the next pages
+		cursor time.Time
+	)
+	for _, login := range logins {
+		// one more than the page tells whether there is a next page
+		mods, err := r.UserModerationsBefore(login, ch, before, limit+1)
+		if err != nil {
+			return nil, err
+		}
+		if len(mods) > limit {
+			mods = mods[:limit]
+			if cut := mods[limit-1].At; cut.After(cursor) {
+				cursor = cut
+			}
+		}
+		for _, m := range mods {
+			if m.Deleted {
+				continue
+			}
+			s.decrypt(m)
+			all = append(all, m)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].At.After(all[j].At)
+	})
+	if !cursor.IsZero() {
+		for i, m := range all {
+			if m.At.Before(cursor) {
+				all = all[:i]
+				break
+			}
+		}
+	}
+	if len(all) > limit {
+		all = all[:limit]
+		cursor = all[limit-1].At
+	}
+	t := &Timeline{Entries: all}
+	if !cursor.IsZero() {
+		t.Next = &cursor
+	}
+	if err := s.annotate(t, username, ch, before.IsZero()); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// TenantTimeline is Timeline of a channel of the tenant
+func (s *Storage) TenantTimeline(tenantID, username string, ch Channel, before time.Time, limit int) (*Timeline, error) {
+	ch = Channel(strings.ToLower(string(ch)))
+	if err := s.owns(tenantID, ch); err != nil {
+		return nil, err
+	}
+	return s.Timeline(username, ch, before, limit)
+}
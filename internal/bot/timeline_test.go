@@ -0,0 +1,69 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// timelineDriver returns the moderations before a time, the most recent first
+type timelineDriver struct {
+	fakeDriver
+	mods []*Moderation
+}
+
+func (d *timelineDriver) UserModerationsBefore(username string, ch Channel, before time.Time, limit int) ([]*Moderation, error) {
+	var mods []*Moderation
+	for _, m := range d.mods {
+		if len(mods) < limit && (before.IsZero() || m.At.Before(before)) {
+			mods = append(mods, m)
+		}
+	}
+	return mods, nil
+}
+
+func TestTimeline(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	d := &timelineDriver{mods: []*Moderation{
+		{Type: message.MessageBan, At: now},
+		{Type: message.MessageTimeout, At: now.Add(-time.Hour), Deleted: true},
+		{Type: message.MessageTimeout, At: now.Add(-2 * time.Hour)},
+		{Type: message.MessageWarning, At: now.Add(-3 * time.Hour)},
+	}}
+	s := NewStorage(d)
+	defer s.Stop()
+
+	var (
+		got    []message.MessageType
+		before time.Time
+		pages  int
+	)
+	for {
+		page, err := s.Timeline("user", "channel", before, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		for _, m := range page.Entries {
+			got = append(got, m.Type)
+		}
+		if page.Next == nil {
+			break
+		}
+		before = *page.Next
+	}
+	want := []message.MessageType{message.MessageBan, message.MessageTimeout, message.MessageWarning}
+	if len(got) != len(want) {
+		t.Fatalf("got: %v, want: %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got: %v, want: %v", got, want)
+		}
+	}
+	if pages != 2 {
+		t.Fatalf("pages got: %d, want: %d", pages, 2)
+	}
+}
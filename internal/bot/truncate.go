@@ -0,0 +1,87 @@
+package bot
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// Policies of the truncation of the bodies, see cfg.BodyTruncation
+const (
+	TruncateEnd    = "end"
+	TruncateMiddle = "middle"
+)
+
+var ErrBodyTruncation = errors.New("unknown BODY_TRUNCATION, expected end or middle")
+
+// truncation shortens the bodies of the messages over a maximum length, e.g.
+// walls of text pasted by spammers, which would bloat the rows
+type truncation struct {
+	max    int
+	middle bool
+}
+
+// truncateMarker replaces the `n` characters left out of a body
+func truncateMarker(n int) string {
+	return fmt.Sprintf("[…%d truncated]", n)
+}
+
+// body returns the body truncated to the maximum length, marker included, and
+// whether it was truncated. A maximum shorter than the marker keeps the marker
+// only
+func (t *truncation) body(b string) (string, bool) {
+	n := utf8.RuneCountInString(b)
+	if n <= t.max {
+		return b, false
+	}
+	runes := []rune(b)
+	// the length of the marker depends on the characters left out, which
+	// depend on the length of the marker, but the digits rarely change
+	keep := t.max - utf8.RuneCountInString(truncateMarker(n-t.max))
+	if keep < 0 {
+		keep = 0
+	}
+	marker := truncateMarker(n - keep)
+	if !t.middle {
+		return string(runes[:keep]) + marker, true
+	}
+	head := keep - keep/2
+	return string(runes[:head]) + marker + string(runes[n-keep/2:]), true
+}
+
+// newTruncation returns nil if the bodies have no maximum length
+func newTruncation() *truncation {
+	if cfg.MaxBodyLength <= 0 {
+		return nil
+	}
+	switch cfg.BodyTruncation {
+	case TruncateEnd, TruncateMiddle:
+	default:
+		errors.WrapFatalWithContext(ErrBodyTruncation, struct{ Policy string }{cfg.BodyTruncation})
+	}
+	return &truncation{max: cfg.MaxBodyLength, middle: cfg.BodyTruncation == TruncateMiddle}
+}
+
+// truncate truncates the bodies of the messages of msg over the maximum length
+// and returns how many were truncated. Like in scrub, the private messages are
+// copied before being truncated
+func (s *Storage) truncate(msg *message.Message) int {
+	if s.truncation == nil {
+		return 0
+	}
+	var truncated int
+	for i, privmsg := range msg.LastMessages {
+		body, ok := s.truncation.body(privmsg.Body)
+		if !ok {
+			continue
+		}
+		cp := *privmsg
+		cp.Body = body
+		msg.LastMessages[i] = &cp
+		truncated++
+	}
+	return truncated
+}
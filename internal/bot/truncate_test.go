@@ -0,0 +1,32 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncation(t *testing.T) {
+	t.Parallel()
+	long := strings.Repeat("a", 30) + strings.Repeat("é", 30) + strings.Repeat("b", 40)
+	tests := []struct {
+		name string
+		t    *truncation
+		body string
+		want string
+	}{
+		{"short", &truncation{max: 100}, "hello", "hello"},
+		{"end", &truncation{max: 20}, long, "aaaaa[…95 truncated]"},
+		{"middle", &truncation{max: 21, middle: true}, long, "aaa[…94 truncated]bbb"},
+		{"max under the marker", &truncation{max: 5}, long, "[…100 truncated]"},
+	}
+	for _, tt := range tests {
+		got, truncated := tt.t.body(tt.body)
+		if got != tt.want || truncated != (tt.body != tt.want) {
+			t.Errorf("%s got: %q (%v), want: %q", tt.name, got, truncated, tt.want)
+		}
+		if truncated && tt.name != "max under the marker" && utf8.RuneCountInString(got) > tt.t.max {
+			t.Errorf("%s got %d characters, want at most %d", tt.name, utf8.RuneCountInString(got), tt.t.max)
+		}
+	}
+}
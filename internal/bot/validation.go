@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+)
+
+// ChannelValidationTimeout is how long the validation of the tracked channels
+// against Helix may take
+const ChannelValidationTimeout = 30 * time.Second
+
+var ErrChannelNotFound = errors.New("twitch channel not found, it may be a typo or a renamed channel")
+
+// validateChannels flags the channels that don't exist in twitch, e.g. typos in
+// tracked_channels or renamed channels, which are joined but never receive a
+// message. They are still tracked, see InvalidChannels. Nothing is validated
+// without a Helix client id
+func (b *Bot) validateChannels(chs []Channel) {
+	if cfg.HelixClientID == "" || len(chs) == 0 {
+		return
+	}
+	logins := make([]string, len(chs))
+	for i, ch := range chs {
+		logins[i] = strings.ToLower(string(ch))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ChannelValidationTimeout)
+	defer cancel()
+	users, err := b.helix.Users(ctx, logins)
+	if err != nil {
+		errors.WrapAndLog(err)
+		return
+	}
+	found := make(map[string]bool, len(users))
+	for _, u := range users {
+		found[strings.ToLower(u.Login)] = true
+	}
+	for _, login := range logins {
+		if found[login] {
+			b.invalid.Delete(login)
+			continue
+		}
+		b.invalid.Store(login, true)
+		errors.WrapAndLogWithContext(ErrChannelNotFound, struct{ Channel string }{login})
+		b.joinFailed(Channel(login), SuspensionNotFound)
+	}
+}
+
+// InvalidChannels returns the tracked channels that don't exist in twitch,
+// sorted. See validateChannels
+func (b *Bot) InvalidChannels() []string {
+	var chs []string
+	b.invalid.Range(func(ch, _ interface{}) bool {
+		if b.IsTracked(Channel(ch.(string))) {
+			chs = append(chs, ch.(string))
+		}
+		return true
+	})
+	sort.Strings(chs)
+	return chs
+}
@@ -0,0 +1,143 @@
+// Package bus is a lightweight in-process publish/subscribe bus. Every topic
+// carries values of a single type to its subscribers, each one with its own
+// bounded buffer and go-routine, so a slow subscriber never delays the others.
+package bus
+
+import (
+	"sync"
+	"time"
+)
+
+// Policy is what a topic does when the buffer of a subscriber is full
+type Policy int
+
+const (
+	// Drop drops the value for the subscriber. It is the policy of the
+	// subscribers that can afford to miss values, e.g. streams
+	Drop Policy = iota
+	// Block waits for the subscriber, delaying the publisher until there is
+	// room or the topic is closed. It is the policy of the fast subscribers that
+	// must see every value, e.g. metrics
+	Block
+)
+
+// Topic delivers the published values to its subscribers. It is safe for
+// concurrent use.
+type Topic[T any] struct {
+	name string
+	// onDrop is called with the name of the subscriber of every dropped value,
+	// if not nil
+	onDrop func(sub string)
+
+	// mu protects subs and closed. It is never held while sending, so a stuck
+	// subscriber cannot block Subscribe or Close
+	mu     sync.RWMutex
+	subs   []*subscriber[T]
+	closed bool
+	// done is closed by Close to release the blocked publishers and stop the
+	// subscribers once their buffers are drained
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type subscriber[T any] struct {
+	name   string
+	policy Policy
+	ch     chan T
+}
+
+// Name returns the name of the topic
+func (t *Topic[T]) Name() string {
+	return t.name
+}
+
+// Subscribe calls fn with every value published from now on, from a
+// go-routine of the subscriber. Up to `buffer` values wait for fn, the values
+// after that are handled according to policy. It must not be called after
+// Close
+func (t *Topic[T]) Subscribe(name string, buffer int, policy Policy, fn func(v T)) {
+	s := &subscriber[T]{name: name, policy: policy, ch: make(chan T, buffer)}
+	t.mu.Lock()
+	t.subs = append(t.subs, s)
+	t.mu.Unlock()
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		for {
+			select {
+			case v := <-s.ch:
+				fn(v)
+			case <-t.done:
+				// handle what was published before closing
+				for {
+					select {
+					case v := <-s.ch:
+						fn(v)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Publish delivers v to every subscriber. Values published after Close are
+// discarded
+func (t *Topic[T]) Publish(v T) {
+	t.mu.RLock()
+	subs, closed := t.subs, t.closed
+	t.mu.RUnlock()
+	if closed {
+		return
+	}
+	for _, s := range subs {
+		if s.policy == Block {
+			select {
+			case s.ch <- v:
+			case <-t.done:
+				return
+			}
+			continue
+		}
+		select {
+		case s.ch <- v:
+		default:
+			if t.onDrop != nil {
+				t.onDrop(s.name)
+			}
+		}
+	}
+}
+
+// Close stops accepting values and waits up to `timeout` for the subscribers
+// to handle the values already published. It reports whether all of them did
+func (t *Topic[T]) Close(timeout time.Duration) bool {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return true
+	}
+	t.closed = true
+	close(t.done)
+	t.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// NewTopic creates a topic. onDrop, if not nil, is called with the name of the
+// subscriber every time a value is dropped for it
+func NewTopic[T any](name string, onDrop func(sub string)) *Topic[T] {
+	return &Topic[T]{name: name, onDrop: onDrop, done: make(chan struct{})}
+}
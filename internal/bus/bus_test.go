@@ -0,0 +1,98 @@
+package bus
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPublish(t *testing.T) {
+	t.Parallel()
+	topic := NewTopic[int]("numbers", nil)
+	var (
+		mu  sync.Mutex
+		got = make(map[string]int)
+	)
+	for _, name := range []string{"a", "b"} {
+		name := name
+		topic.Subscribe(name, 1, Block, func(v int) {
+			mu.Lock()
+			got[name] += v
+			mu.Unlock()
+		})
+	}
+	for i := 1; i <= 10; i++ {
+		topic.Publish(i)
+	}
+	topic.Close(time.Second)
+	// discarded
+	topic.Publish(100)
+
+	for _, name := range []string{"a", "b"} {
+		if got[name] != 55 {
+			t.Fatalf("%s got: %d, want: %d", name, got[name], 55)
+		}
+	}
+}
+
+func TestDrop(t *testing.T) {
+	t.Parallel()
+	var dropped []string
+	topic := NewTopic[int]("numbers", func(sub string) {
+		dropped = append(dropped, sub)
+	})
+	release := make(chan struct{})
+	received := make(chan int, 10)
+	topic.Subscribe("slow", 1, Drop, func(v int) {
+		<-release
+		received <- v
+	})
+
+	// values are dropped once the subscriber is busy and its buffer is full
+	published := 0
+	for len(dropped) == 0 {
+		topic.Publish(published)
+		published++
+	}
+	close(release)
+	topic.Close(time.Second)
+	close(received)
+
+	n := 0
+	for range received {
+		n++
+	}
+	if n+len(dropped) != published || dropped[0] != "slow" {
+		t.Fatalf("got: %d received and %v dropped, want: %d published", n, dropped, published)
+	}
+}
+
+func TestStuckSubscriber(t *testing.T) {
+	t.Parallel()
+	topic := NewTopic[int]("numbers", nil)
+	stuck := make(chan struct{})
+	defer close(stuck)
+	topic.Subscribe("stuck", 1, Block, func(v int) {
+		<-stuck
+	})
+
+	published := make(chan struct{})
+	go func() {
+		// the first value is taken by the subscriber, the second one fills its
+		// buffer and the third one blocks until the topic is closed
+		for i := 0; i < 3; i++ {
+			topic.Publish(i)
+		}
+		close(published)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	if topic.Close(10 * time.Millisecond) {
+		t.Fatal("got: closed, want: timed out waiting for the stuck subscriber")
+	}
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("the publisher is still blocked after closing the topic")
+	}
+}
@@ -0,0 +1,144 @@
+// Package cache keeps the results of expensive queries in memory with
+// stale-while-revalidate semantics. A result younger than the TTL is served
+// as is. An older one is still served instantly during the stale window while
+// a single go-routine refreshes it in background, so only the first request
+// after the stale window, or for a new key, waits for the query.
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// Result is how a value was served
+type Result string
+
+const (
+	// Hit is a value younger than the TTL
+	Hit Result = "hit"
+	// Stale is an expired value served while it is refreshed
+	Stale Result = "stale"
+	// Miss is a value loaded by the request itself
+	Miss Result = "miss"
+	// RefreshError is a background refresh that failed. The stale value is
+	// kept until the end of its stale window
+	RefreshError Result = "refresh_error"
+)
+
+// Cache keeps up to a fixed number of values by key. It is safe for
+// concurrent use. A nil Cache caches nothing
+type Cache[V any] struct {
+	ttl   time.Duration
+	stale time.Duration
+	size  int
+	// observe is called with every result, if not nil
+	observe func(Result)
+	// now is time.Now, replaced in tests
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*entry[V]
+}
+
+type entry[V any] struct {
+	v  V
+	at time.Time
+	// refreshing is whether a background refresh is running
+	refreshing bool
+}
+
+// Get returns the value of key, calling load if there is none or it is
+// older than the stale window. The errors of load are returned and never
+// cached
+func (c *Cache[V]) Get(key string, load func() (V, error)) (V, error) {
+	if c == nil {
+		return load()
+	}
+	c.mu.Lock()
+	e := c.entries[key]
+	if e != nil {
+		age := c.now().Sub(e.at)
+		if age < c.ttl {
+			c.mu.Unlock()
+			c.result(Hit)
+			return e.v, nil
+		}
+		if age < c.ttl+c.stale {
+			if !e.refreshing {
+				e.refreshing = true
+				go c.refresh(key, e, load)
+			}
+			c.mu.Unlock()
+			c.result(Stale)
+			return e.v, nil
+		}
+	}
+	c.mu.Unlock()
+
+	c.result(Miss)
+	v, err := load()
+	if err != nil {
+		return v, err
+	}
+	c.set(key, &entry[V]{v: v, at: c.now()})
+	return v, nil
+}
+
+// refresh replaces the stale entry `e` of key with a new value
+func (c *Cache[V]) refresh(key string, e *entry[V], load func() (V, error)) {
+	v, err := load()
+	if err != nil {
+		c.mu.Lock()
+		e.refreshing = false
+		c.mu.Unlock()
+		c.result(RefreshError)
+		return
+	}
+	c.set(key, &entry[V]{v: v, at: c.now()})
+}
+
+// set stores the entry of key, evicting the dead entries first if the cache
+// is full, then any entry
+func (c *Cache[V]) set(key string, e *entry[V]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		now := c.now()
+		for k, old := range c.entries {
+			if now.Sub(old.at) >= c.ttl+c.stale {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < c.size {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = e
+}
+
+func (c *Cache[V]) result(r Result) {
+	if c.observe != nil {
+		c.observe(r)
+	}
+}
+
+// New creates a cache of up to `size` values, served for `ttl` and then for
+// `stale` more while they are refreshed. observe, if not nil, is called with
+// the result of every request and failed refresh. It returns nil if ttl is 0,
+// which caches nothing
+func New[V any](ttl, stale time.Duration, size int, observe func(Result)) *Cache[V] {
+	if ttl <= 0 {
+		return nil
+	}
+	return &Cache[V]{
+		ttl:     ttl,
+		stale:   stale,
+		size:    size,
+		observe: observe,
+		now:     time.Now,
+		entries: make(map[string]*entry[V]),
+	}
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+func TestGet(t *testing.T) {
+	t.Parallel()
+	var (
+		mu      sync.Mutex
+		results []Result
+	)
+	c := New[int](time.Minute, time.Hour, 10, func(r Result) {
+		mu.Lock()
+		results = append(results, r)
+		mu.Unlock()
+	})
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	loads := 0
+	refreshed := make(chan bool, 1)
+	load := func() (int, error) {
+		loads++
+		return loads, nil
+	}
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		want    int
+		result  Result
+	}{
+		{"miss", 0, 1, Miss},
+		{"hit", 30 * time.Second, 1, Hit},
+		{"stale", 2 * time.Minute, 1, Stale},
+		{"refreshed", 0, 2, Hit},
+		{"expired", 2 * time.Hour, 3, Miss},
+	}
+	for _, tt := range tests {
+		now = now.Add(tt.elapsed)
+		got, err := c.Get("key", func() (int, error) {
+			v, err := load()
+			refreshed <- true
+			return v, err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.result != Hit {
+			<-refreshed
+		}
+		if tt.result == Stale {
+			// the refresh runs in background, wait until it replaces the value
+			for {
+				c.mu.Lock()
+				refreshing := c.entries["key"].refreshing
+				c.mu.Unlock()
+				if !refreshing {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+		if got != tt.want {
+			t.Fatalf("%s got: %d, want: %d", tt.name, got, tt.want)
+		}
+		mu.Lock()
+		last := results[len(results)-1]
+		mu.Unlock()
+		if last != tt.result {
+			t.Fatalf("%s result got: %v, want: %v", tt.name, last, tt.result)
+		}
+	}
+}
+
+func TestGetError(t *testing.T) {
+	t.Parallel()
+	c := New[int](time.Minute, time.Hour, 10, nil)
+	want := errors.New("query failed")
+	if _, err := c.Get("key", func() (int, error) { return 0, want }); !errors.Is(err, want) {
+		t.Fatalf("got: %v, want: %v", err, want)
+	}
+	// errors are not cached
+	if got, err := c.Get("key", func() (int, error) { return 1, nil }); err != nil || got != 1 {
+		t.Fatalf("got: %d, %v, want: %d, %v", got, err, 1, nil)
+	}
+}
+
+func TestSize(t *testing.T) {
+	t.Parallel()
+	c := New[int](time.Minute, time.Hour, 2, nil)
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := c.Get(key, func() (int, error) { return 0, nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(c.entries); got != 2 {
+		t.Fatalf("got: %d, want: %d", got, 2)
+	}
+}
+
+func TestNil(t *testing.T) {
+	t.Parallel()
+	c := New[int](0, time.Hour, 10, nil)
+	calls := 0
+	for i := 0; i < 2; i++ {
+		c.Get("key", func() (int, error) {
+			calls++
+			return calls, nil
+		})
+	}
+	if calls != 2 {
+		t.Fatalf("got: %d, want: %d", calls, 2)
+	}
+}
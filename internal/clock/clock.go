@@ -0,0 +1,21 @@
+// Package clock is the time of the tracker. The tracker takes the current time
+// from a Clock rather than from time.Now, so the time-based rules, the quotas
+// or the retention can be tested deterministically with a fake clock, see
+// testkit.Clock. The periodic tasks still tick with the time of the system.
+package clock
+
+import "time"
+
+// Clock tells the current time
+type Clock interface {
+	Now() time.Time
+}
+
+// Real is the clock of the system
+var Real Clock = system{}
+
+type system struct{}
+
+func (system) Now() time.Time {
+	return time.Now()
+}
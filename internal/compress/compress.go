@@ -0,0 +1,62 @@
+// Package compress encodes the messages of a moderation into a single
+// compressed blob. The first byte of every blob is a marker of its format, so
+// the format can change without rewriting the stored blobs.
+package compress
+
+import (
+	"encoding/binary"
+
+	"github.com/golang/snappy"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+// Formats of the blobs
+const (
+	FormatSnappy byte = 1
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown compression format")
+	ErrCorrupted     = errors.New("corrupted compressed messages")
+)
+
+// Encode compresses the messages with snappy. The messages are length-prefixed
+// with uvarints before compressing
+func Encode(msgs []string) []byte {
+	n := 0
+	for _, m := range msgs {
+		n += binary.MaxVarintLen64 + len(m)
+	}
+	buf := make([]byte, 0, n)
+	var l [binary.MaxVarintLen64]byte
+	for _, m := range msgs {
+		buf = append(buf, l[:binary.PutUvarint(l[:], uint64(len(m)))]...)
+		buf = append(buf, m...)
+	}
+	return append([]byte{FormatSnappy}, snappy.Encode(nil, buf)...)
+}
+
+// Decode decompresses the messages of a blob created with Encode
+func Decode(b []byte) ([]string, error) {
+	if len(b) == 0 {
+		return nil, ErrCorrupted
+	}
+	if b[0] != FormatSnappy {
+		return nil, ErrUnknownFormat
+	}
+	buf, err := snappy.Decode(nil, b[1:])
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	var msgs []string
+	for len(buf) > 0 {
+		l, n := binary.Uvarint(buf)
+		if n <= 0 || uint64(len(buf)-n) < l {
+			return nil, ErrCorrupted
+		}
+		msgs = append(msgs, string(buf[n:n+int(l)]))
+		buf = buf[n+int(l):]
+	}
+	return msgs, nil
+}
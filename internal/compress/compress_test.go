@@ -0,0 +1,50 @@
+package compress
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+)
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		desc string
+		msgs []string
+	}{
+		{desc: "one", msgs: []string{"hola"}},
+		{desc: "many", msgs: []string{"hola", "", "ñandú 🦤", strings.Repeat("spam ", 200)}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			b := Encode(test.msgs)
+			if b[0] != FormatSnappy {
+				t.Fatalf("got: %d, want: %d", b[0], FormatSnappy)
+			}
+			got, err := Decode(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.msgs) {
+				t.Fatalf("got: %q, want: %q", got, test.msgs)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	t.Parallel()
+	if _, err := Decode(nil); err != ErrCorrupted {
+		t.Fatalf("got: %v, want: %v", err, ErrCorrupted)
+	}
+	if _, err := Decode([]byte{42, 0}); err != ErrUnknownFormat {
+		t.Fatalf("got: %v, want: %v", err, ErrUnknownFormat)
+	}
+	// a length longer than the rest of the blob
+	b := append([]byte{FormatSnappy}, snappy.Encode(nil, []byte{10, 'h'})...)
+	if _, err := Decode(b); err != ErrCorrupted {
+		t.Fatalf("got: %v, want: %v", err, ErrCorrupted)
+	}
+}
@@ -1,9 +1,11 @@
 package config
 
 import (
+	"io/fs"
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
 
 	"github.com/hammertrack/tracker/errors"
 	"github.com/joho/godotenv"
@@ -14,6 +16,21 @@ var ErrParseEnv = errors.New("environment variable could not be parsed")
 const Version string = "0.0.1"
 
 var (
+	// Level of the logs: debug, info or error, and the subsystems with debug
+	// logs, e.g. "irc,storage". Both can be changed at runtime through
+	// /admin/logging
+	LogLevel string
+	LogDebug string
+	// Where the moderations are stored: cassandra, or memory to keep up to
+	// MemoryMaxModerations of them in memory, lost on exit, with no database
+	StorageDriver        string
+	MemoryMaxModerations int
+	// Tables where the cassandra driver writes the moderations: by_user,
+	// by_channel or both. Deployments that only query by channel halve the
+	// writes with by_channel, at the cost of the endpoints that read the other
+	// table
+	ModerationTables string
+
 	DBHost     string
 	DBKeyspace string
 	DBPort     string
@@ -24,17 +41,433 @@ var (
 	// Whether to update the database to the last migration version specified by
 	// DB_VERSION
 	DBMigrate bool
+	// TTL of the lock of the migrations shared by the instances, renewed while
+	// migrating, so the lock of an instance that dies is released after it
+	DBMigrateLockTTLSeconds int
+	// How long an instance waits for another one to apply the migrations
+	// before giving up
+	DBMigrateWaitSeconds int
+	// Whether to create the keyspace before connecting if it doesn't exist,
+	// replicated as DBReplication: a replication factor, e.g. "3", for a single
+	// datacenter, or the factor of every datacenter, e.g. "eu=3,na=2"
+	DBBootstrap   bool
+	DBReplication string
 	// Timeout when initializating the app and testing the connection. The
 	// database may take longer to initialize than the app, so we need to give it
 	// a little bit of time.
 	DBConnTimeoutSeconds int
+	// Consistency level of the queries, e.g. quorum or one
+	DBConsistency string
+	// Consistency level of the inserts of moderations, DBConsistency if empty
+	DBInsertConsistency string
+	// Datacenter of the region of the tracker, preferred by its queries, any
+	// if empty. Trackers of several regions sharing a cluster set it with a
+	// local consistency, e.g. local_quorum, to write in their own region
+	DBLocalDatacenter string
+	// Region of the tracker, e.g. "eu", recorded with every stored moderation
+	// so the moderations stored by the trackers of several regions can be
+	// told apart and filtered by origin. Empty for none
+	Region string
+	// Name of the instance, recorded with every stored moderation and shown in
+	// the responses of the API, the metrics and the startup banner with the
+	// version and the commit, so the data of several instances can be
+	// attributed and their versions compared. The hostname if empty
+	Instance string
+	// Comma-separated hosts of the reads of the API, with their own session so
+	// heavy dashboards can be pointed at another datacenter without slowing
+	// down the inserts. Empty to read from DBHost with the session of the
+	// inserts, unless DBReadDatacenter is set
+	DBReadHosts string
+	// Datacenter preferred by the reads of the API, any if empty
+	DBReadDatacenter string
+	// Consistency level of the reads of the API, DBConsistency if empty
+	DBReadConsistency string
+	// Retry policy of the failed queries: none, simple or exponential, with up
+	// to DBRetries retries. The exponential backoff waits between DBRetryMinMs
+	// and DBRetryMaxMs
+	DBRetryPolicy string
+	DBRetries     int
+	DBRetryMinMs  int
+	DBRetryMaxMs  int
+	// Additional attempts of the inserts and reads of moderations that take
+	// longer than DBSpeculativeDelayMs, sent to other nodes. 0 disables them
+	DBSpeculativeAttempts int
+	DBSpeculativeDelayMs  int
+
+	// Shard of tracked channels handled by this instance, from 1 to ShardCount.
+	// New channels are spread across ShardCount shards, see bot.ShardOf
+	ShardID    int
+	ShardCount int
+	// What an instance does when another one tracks the same channel, which
+	// stores its moderations twice: "warn" logs it and reports it in the health,
+	// "backoff" also makes the newest instance stop tracking the channel, "off"
+	// doesn't check it. Every instance claims its channels in the database every
+	// ChannelClaimsIntervalSeconds
+	ChannelClaims                string
+	ChannelClaimsIntervalSeconds int
+	// Consecutive failures to join a channel, e.g. refused JOINs or lookups in
+	// Helix that don't find it, after which it is suspended: departed and not
+	// joined again, even after a restart, until it is found in Helix, which is
+	// checked every ChannelSuspensionCheckMinutes. 0 never suspends them
+	ChannelSuspendFailures        int
+	ChannelSuspensionCheckMinutes int
 
 	ClientUsername string
 	ClientToken    string
+	// Where chat messages and moderations are read from: irc or eventsub
+	Source string
+	// Client ID and user access token for the twitch Helix API. The token
+	// defaults to the IRC token, which must then belong to the same client ID
+	HelixClientID string
+	HelixToken    string
+
+	// Address where the HTTP API listens, e.g. ":8080". The API is disabled if
+	// empty
+	APIAddr string
+	// File where the PID of `serve` is written, empty to write none. The API
+	// also serves on the socket passed by systemd, if any, and systemd is
+	// notified when the tracker is ready and stopping, see package service
+	PIDFile string
+	// Token required in the Authorization header to use the admin endpoints.
+	// Admin endpoints are disabled if empty
+	AdminToken string
+	// Seconds the results of /stats and of the times to action of the channels
+	// are cached, 0 to always query them
+	StatsCacheSeconds        int
+	TimeToActionCacheSeconds int
+	// Seconds an expired result is still served while it is refreshed in
+	// background
+	APICacheStaleSeconds int
+	// Searches of /search allowed to every API key a day, 0 for no limit. The
+	// admin token is never limited
+	SearchQuota int
+
+	// Whether to redact personal data from the messages before storing them
+	ScrubEnabled bool
+	// Comma separated list of built-in scrubber patterns: email, ip, phone
+	ScrubPatterns string
+	// Optional extra regular expression whose matches are also redacted
+	ScrubCustomPattern string
+	// Optional file with more named expressions to redact, as `name: expression`
+	// per line. See scrubber.ReadPatterns
+	ScrubPatternsFile string
+
+	// Maximum length in characters of the stored bodies of the messages, 0 for
+	// no limit. Longer bodies are truncated according to BodyTruncation: "end"
+	// keeps their start, "middle" their start and their end. A marker with the
+	// number of characters left out replaces them
+	MaxBodyLength  int
+	BodyTruncation string
+
+	// Maximum duration of each phase of the startup, e.g. connecting to the
+	// source, before the tracker gives up. See bot.Bot.Start
+	StartupPhaseTimeoutSeconds int
+
+	// Whether broadcasters can opt-in/out their channels with chat commands. See
+	// bot.CommandPrefix
+	ChatOptIn bool
+	// Whether moderators can look up moderations with chat commands like !bans
+	ChatCommands bool
+	// Minimum time between two replies of the bot in the same channel
+	ChatCommandsCooldownSeconds int
+	// Whether to whisper the replies instead of writing them in the chat
+	ChatCommandsWhisper bool
+	// Kill switch of every message of the bot in chat. It can also be turned
+	// on and off at runtime, see bot.Bot.SilenceChat
+	ChatSilenced bool
+	// Maximum number of messages of the bot every 30 seconds across every
+	// channel, and minimum time between two messages in the same channel
+	ChatRateLimit         int
+	ChatChannelIntervalMs int
+	// Templates of the replies of the bot overriding the default ones by name,
+	// e.g. "bans.none=nothing stored for {{.Username}}", see bot.chatTemplates
+	ChatTemplates string
+
+	// Whether to count the BTTV/FFZ/7TV emotes of the messages for the
+	// heuristics rules
+	EmotesEnabled bool
+	// Comma separated list of third-party emote providers: bttv, ffz, 7tv
+	EmotesProviders string
+	// How often the emotes of every channel are fetched again
+	EmotesRefreshMinutes int
+
+	// URL of the external toxicity model. Scoring is disabled if empty
+	ScoringURL string
+	// Maximum time waited for a score
+	ScoringTimeoutMs int
+	// Consecutive failures that open the circuit breaker, and time it stays open
+	ScoringBreakerThreshold       int
+	ScoringBreakerCooldownSeconds int
+	// Whether the score gates the storage (see heuristics.RuleMinToxicity) or
+	// only enriches the stored moderations
+	ScoringGate        bool
+	ScoringMinToxicity float64
+	// Maximum time processing a moderation, from the heuristics to the insert.
+	// The enrichments left once it is over, the tags and the toxicity, are
+	// skipped and the moderation is stored as partial, so the throughput holds
+	// while a dependency is slow. 0 for no budget
+	EventBudgetMs int
+
+	// Number of channels with their own label in the exported metrics, the rest
+	// are aggregated under the "other" label
+	MetricsTopChannels int
+	// Fill ratio of a tracker queue, from 0 to 1, above which a warning is
+	// logged before the queue blocks the source. 0 disables the warning
+	QueueWarnRatio float64
+	// Failed inserts in the last minute above which a warning is logged. 0
+	// disables the warning
+	InsertErrorsWarnPerMinute int
+	// Directory where the moderations that fail to be inserted are spilled,
+	// to be inserted in order once the database is back, empty to lose them.
+	// At most SpillMaxMB are kept, the moderations are lost beyond it
+	SpillDir   string
+	SpillMaxMB int
+	// Maximum p99, in milliseconds, of the end-to-end latency of a minute, from
+	// the reception of a moderation to its insert acknowledged by the driver.
+	// An incident is raised when it is exceeded for LatencySLOMinutes minutes
+	// in a row. 0 disables the alert
+	LatencySLOMs      int
+	LatencySLOMinutes int
+
+	// Base URL of the justlog compatible log archive used by `tracker backfill`
+	// and the gap recovery
+	BackfillURL string
+	// Whether the time of the last event of every channel is persisted, and
+	// the events missed while the tracker was down are recovered on startup
+	// from the logs of BackfillURL, up to GapRecoveryMaxHours back
+	GapRecovery         bool
+	GapRecoveryMaxHours int
+
+	// Directory where the stored moderations are continuously exported as
+	// Parquet, empty to disable the continuous export. See package export
+	ExportDir string
+	// Seconds between micro-batches, and maximum rows buffered between them
+	ExportFlushSeconds int
+	ExportBatchSize    int
+	// Where every stored moderation is written as a JSON line with the field
+	// names of the events (see bot.EventSchema), for Promtail to ship them to
+	// Loki: stdout, mixed with the logs and told apart by their "stream"
+	// field, or the path of a file they are appended to. Empty to disable it
+	EventLog string
+	// Whether the lines of EventLog include the bodies of the messages, in
+	// clear even if the encryption is enabled
+	EventLogMessages bool
+	// The file where the decisions of the heuristics on every moderation are
+	// appended as JSON lines, with the verdicts of every rule, so it can be
+	// told why a moderation was not stored. Empty to disable it
+	DecisionsLog string
+
+	// Whether the links of the stored moderations are resolved in background to
+	// store their domain and category
+	LinksEnrich bool
+	// File with the known scam domains, one per line
+	LinksScamList string
+	// Maximum time resolving a link
+	LinksTimeoutMs int
+
+	// Whether the stored moderations are tagged with their inferred reasons
+	TagsEnabled bool
+	// File with the keywords of every tag, as `tag: keyword, keyword`
+	TagsKeywords string
+	// Comma separated patterns of the names of follow-bots, empty for the
+	// builtin ones
+	TagsNamePatterns string
+	// Whether the reason of the bans and timeouts without one is inferred from
+	// the moderation command typed in chat by a moderator, e.g. `!ban user
+	// spam`, at most CommandReasonsSeconds before the moderation. The commands
+	// are comma separated, empty for the ones of the common moderation bots
+	CommandReasons        bool
+	CommandReasonsSeconds int
+	CommandReasonsBan     string
+	CommandReasonsTimeout string
+
+	// Base64 encoded 32 bytes AES key used to encrypt the messages before
+	// storing them, empty to store them in plaintext. See package encryption.
+	// It covers the messages at rest: the moderations, the raw clean samples
+	// and the exports. The stream, the debug stream and the webhooks deliver
+	// them in plaintext to their authenticated clients, and the tap cannot be
+	// enabled along with it
+	EncryptionKey string
+	// Id of EncryptionKey, stored with every encrypted value
+	EncryptionKeyID string
+	// Old keys only used to decrypt, as "id:base64,id:base64"
+	EncryptionOldKeys string
+
+	// Whether the bans of the channels sharing them are delivered to the
+	// webhooks subscribed to their feeds
+	BanFeedWebhooks bool
+	// Number of concurrent webhook deliveries
+	BanFeedWorkers int
+	// Whether the moderations of the channels of the tenants are delivered to
+	// the webhooks of the tenants
+	TenantWebhooks bool
+	// Number of concurrent webhook deliveries
+	TenantWebhookWorkers int
+	// Whether the webhook notifications of the stored moderations are kept in
+	// an outbox until they are delivered, so they survive a restart
+	Outbox bool
+
+	// Named groups of channels, e.g. networks of channels, as
+	// "esports-a=foo,bar;network-b=baz". A channel belongs to a group at most
+	ChannelGroups string
+	// Rules of the heuristics of the channels of the groups, overriding
+	// RulePipelines for the types they list, e.g.
+	// "esports-a:ban=;timeout=NoLinks|network-b:timeout="
+	GroupRulePipelines string
+	// Webhooks receiving the moderations stored in the channels of the
+	// groups, e.g. "esports-a=https://a.example/hook,https://b.example/hook",
+	// signed with GroupWebhookSecret
+	GroupWebhooks      string
+	GroupWebhookSecret string
+
+	// Minutes between the detections of renamed users while serving, 0 to only
+	// detect them with `tracker renames detect`
+	RenamesIntervalMinutes int
+
+	// Whether the stored bans are enriched with the creation date of the
+	// account of the user, from helix
+	AccountsEnrich bool
+	// Whether they are also enriched with the follow age of the user in the
+	// channel. It requires HELIX_TOKEN to be of a moderator of the channels
+	AccountsFollowAge bool
+
+	// Fraction, from 0 to 1, of the messages that were never moderated stored as
+	// clean samples, 0 to disable the sampling. See package sampling
+	SamplingRate float64
+	// Maximum number of clean samples stored per minute
+	SamplingMaxPerMinute int
+	// Whether the bodies of the samples are stored as they are, scrubbed, instead
+	// of hashed
+	SamplingRaw bool
+	// Secret of the HMAC of the hashed bodies of the samples, required unless
+	// SamplingRaw
+	SamplingSecret string
+
+	// File where the raw IRC lines are written for debugging, empty to disable
+	// it. See package tap
+	TapFile string
+	// Comma separated channels whose lines are written, empty for all of them
+	TapChannels string
+	// Size in bytes at which the tap file is rotated
+	TapMaxBytes int64
+	// Number of rotated tap files kept
+	TapBackups int
+
+	// File where a sanitized sample of the parsed events is recorded as
+	// fixtures, empty to disable it. See package fixtures
+	FixturesFile string
+	// Fraction, from 0 to 1, of the chat messages recorded as fixtures. The
+	// rest of the events are always recorded
+	FixturesRate float64
+	// How the bodies of the fixtures are sanitized, either hash or synthetic
+	FixturesBodies string
+
+	// Whether the messages of the new moderations are stored compressed. The
+	// ones stored before are compressed with `tracker compress`. With
+	// ENCRYPTION_KEY the messages are compressed first and the blob is encrypted
+	CompressMessages bool
+
+	// Comma-separated community blocklists of known ban-bots, as URLs or paths of
+	// CSV files, or watchlists imported with `tracker import` as
+	// watchlist:<name>. Empty disables the blocklists, see package blocklist
+	Blocklists string
+	// Minutes between the syncs of the blocklists
+	BlocklistsSyncMinutes int
+	// Whether the moderations of blocklisted users are left out of the stats of
+	// the channels, e.g. the mass bans of a bot wave
+	BlocklistsExcludeStats bool
+
+	// Seconds the bans are held before being stored. A ban followed by an unban
+	// of the same user within them is a misclick, which is dropped or tagged as
+	// reverted according to BanGraceDrop. 0 disables the grace window. Unbans
+	// are only received from EventSub, so any other Source refuses to start
+	// with a grace window
+	BanGraceSeconds int
+	BanGraceDrop    bool
+	// Window in seconds in which the bans of the same user in several
+	// channels, e.g. by ban bots sharing a list, are collapsed into the ban of
+	// the first channel, with the rest in its channels. 0 disables it
+	MassBanWindowSeconds int
+	// Window in minutes in which a deletion, a timeout and then a ban of the
+	// same user in a channel are an escalation, whose ban is tagged as
+	// "escalation" with the times of the deletion and the timeout. 0 disables
+	// it
+	EscalationWindowMinutes int
+	// Maximum number of moderations and bytes of messages stored per UTC day
+	// by channel and by tenant, for all the channels of the tenant. 0 for no
+	// limit. Over its quota a channel switches to QuotaMode until the next day
+	QuotaModerationsPerDay       int
+	QuotaBytesPerDay             int
+	TenantQuotaModerationsPerDay int
+	TenantQuotaBytesPerDay       int
+	// What happens to the moderations over the quota: "sample" stores one of
+	// every QuotaSampleEvery, "aggregate" only counts them in the metrics
+	QuotaMode        string
+	QuotaSampleEvery int
+	// What happens to the deletions of a message not in the history, e.g. in a
+	// channel just joined: "history" skips them, "clearmsg" stores them with
+	// the body of the CLEARMSG, flagged as without latency data since the time
+	// of the message is unknown
+	DeletionMode string
+
+	// Rules of the heuristics of every message type, e.g.
+	// "ban=;timeout=NoLinks,MinTimeoutDuration,OnlyHumanModerations". A type
+	// with no rules stores all its messages. The types not listed use the
+	// default rules, see bot.DefaultRules and bot.PipelineRules
+	RulePipelines string
+	// Comma-separated badges, e.g. "subscriber,vip,moderator", of the users
+	// whose moderations are the only ones stored, or are never stored. Bans,
+	// AutoMod actions and warnings are always stored unless a pipeline says
+	// otherwise, see bot.PipelineRules
+	OnlyBadges string
+	SkipBadges string
+
+	// Messages of a user within FloodWindowSeconds from which the moderation of
+	// the user is a flood that is not stored, 0 to disable it. The messages
+	// are counted with a sketch per channel of bounded memory, see package
+	// sketch and heuristics.RuleMaxFlood
+	FloodMessages      int
+	FloodWindowSeconds int
+	// Accuracy of the counts of the messages: they are over by at most
+	// FloodEpsilon times the messages of the channel in the window, with a
+	// probability of 1 - FloodDelta. The lower, the more memory every channel
+	// takes, about 4 * e / FloodEpsilon * ln(1 / FloodDelta) bytes per bucket
+	// of the window, see bot.FloodBuckets
+	FloodEpsilon float64
+	FloodDelta   float64
+
+	// Messages kept per user in the tracker of every channel, on top of the
+	// history of the channel, so the bans of fast chats still find the recent
+	// messages of the user. 0 disables it. Up to UserHistoryUsers users are
+	// kept per channel, the least recently active ones are evicted
+	UserHistorySize  int
+	UserHistoryUsers int
+
+	// Strings repeated across the messages, e.g. the channels and the
+	// usernames, kept once and shared by every message. Up to twice as many
+	// are kept, the ones not seen recently are evicted. 0 disables it
+	InternStrings int
+
+	// Whether a digest of the stored moderations and the times to action of
+	// every channel is logged at the end of every UTC day
+	DailyDigest bool
+
+	// SMTP server the email notifications are sent through, e.g.
+	// "smtp.example.com:587", with STARTTLS if the server supports it. The
+	// credentials are optional
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	// Recipients of the email notifications, the daily digest and the
+	// incidents, of the channels and the tenants, e.g.
+	// "channel:foo=mods@foo.tv;tenant:acme=ops@acme.com,oncall@acme.com".
+	// The incidents of the tracker itself go to "tracker=oncall@example.com"
+	NotifyEmails string
 )
 
 type SupportStringconv interface {
-	~int | ~int64 | ~float32 | ~string | ~bool
+	~int | ~int64 | ~float32 | ~float64 | ~string | ~bool
 }
 
 func conv(v string, to reflect.Kind) any {
@@ -64,7 +497,13 @@ func conv(v string, to reflect.Kind) any {
 
 	if to == reflect.Float32 {
 		if f32, err := strconv.ParseFloat(v, 32); err == nil {
-			return f32
+			return float32(f32)
+		}
+	}
+
+	if to == reflect.Float64 {
+		if f64, err := strconv.ParseFloat(v, 64); err == nil {
+			return f64
 		}
 	}
 
@@ -82,19 +521,167 @@ func Env[T SupportStringconv](key string, def T) T {
 }
 
 func init() {
-	if err := godotenv.Load(); err != nil {
+	// the .env file is optional, the environment may be set by other means
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
 		errors.WrapFatal(err)
 	}
 
+	LogLevel = Env("LOG_LEVEL", "info")
+	LogDebug = Env("LOG_DEBUG", "")
+	StorageDriver = Env("STORAGE_DRIVER", "cassandra")
+	MemoryMaxModerations = Env("MEMORY_MAX_MODERATIONS", 100000)
+	ModerationTables = Env("MODERATION_TABLES", "both")
 	DBHost = Env("DB_HOST", "127.0.0.1")
 	DBKeyspace = Env("DB_KEYSPACE", "hammertrack")
 	DBPort = Env("DB_PORT", "5200")
 	DBUser = Env("DB_USER", "tracker")
 	DBPassword = Env("DB_PASSWORD", "unsafepassword")
 	DBName = Env("DB_NAME", "tracker")
-	DBVersion = Env("DB_VERSION", 1)
+	DBVersion = Env("DB_VERSION", 40)
 	DBMigrate = Env("DB_MIGRATE", false)
+	DBMigrateLockTTLSeconds = Env("DB_MIGRATE_LOCK_TTL_SECONDS", 60)
+	DBMigrateWaitSeconds = Env("DB_MIGRATE_WAIT_SECONDS", 600)
+	DBBootstrap = Env("DB_BOOTSTRAP", false)
+	DBReplication = Env("DB_REPLICATION", "1")
 	DBConnTimeoutSeconds = Env("DB_CONN_TIMEOUT_SECONDS", 20)
+	DBConsistency = Env("DB_CONSISTENCY", "quorum")
+	DBInsertConsistency = Env("DB_INSERT_CONSISTENCY", "")
+	DBLocalDatacenter = Env("DB_LOCAL_DATACENTER", "")
+	Region = Env("REGION", "")
+	Instance = Env("INSTANCE_NAME", hostname())
+	DBReadHosts = Env("DB_READ_HOSTS", "")
+	DBReadDatacenter = Env("DB_READ_DATACENTER", "")
+	DBReadConsistency = Env("DB_READ_CONSISTENCY", "")
+	DBRetryPolicy = Env("DB_RETRY_POLICY", "none")
+	DBRetries = Env("DB_RETRIES", 3)
+	DBRetryMinMs = Env("DB_RETRY_MIN_MS", 100)
+	DBRetryMaxMs = Env("DB_RETRY_MAX_MS", 2000)
+	DBSpeculativeAttempts = Env("DB_SPECULATIVE_ATTEMPTS", 0)
+	DBSpeculativeDelayMs = Env("DB_SPECULATIVE_DELAY_MS", 100)
 	ClientUsername = Env("CLIENT_USERNAME", "username")
 	ClientToken = Env("CLIENT_TOKEN", "invalid_token")
+	Source = Env("SOURCE", "irc")
+	ShardID = Env("SHARD_ID", 1)
+	ShardCount = Env("SHARD_COUNT", 1)
+	LatencySLOMs = Env("LATENCY_SLO_MS", 5000)
+	LatencySLOMinutes = Env("LATENCY_SLO_MINUTES", 5)
+	ChannelClaims = Env("CHANNEL_CLAIMS", "warn")
+	ChannelClaimsIntervalSeconds = Env("CHANNEL_CLAIMS_INTERVAL_SECONDS", 30)
+	ChannelSuspendFailures = Env("CHANNEL_SUSPEND_FAILURES", 3)
+	ChannelSuspensionCheckMinutes = Env("CHANNEL_SUSPENSION_CHECK_MINUTES", 60)
+	HelixClientID = Env("HELIX_CLIENT_ID", "")
+	HelixToken = Env("HELIX_TOKEN", strings.TrimPrefix(ClientToken, "oauth:"))
+	APIAddr = Env("API_ADDR", "")
+	PIDFile = Env("PID_FILE", "")
+	AdminToken = Env("ADMIN_TOKEN", "")
+	StatsCacheSeconds = Env("STATS_CACHE_SECONDS", 5)
+	TimeToActionCacheSeconds = Env("TIME_TO_ACTION_CACHE_SECONDS", 300)
+	APICacheStaleSeconds = Env("API_CACHE_STALE_SECONDS", 600)
+	SearchQuota = Env("SEARCH_QUOTA", 1000)
+	ScrubEnabled = Env("SCRUB_ENABLED", false)
+	ScrubPatterns = Env("SCRUB_PATTERNS", "email,ip,phone")
+	ScrubCustomPattern = Env("SCRUB_CUSTOM_PATTERN", "")
+	ScrubPatternsFile = Env("SCRUB_PATTERNS_FILE", "")
+	MaxBodyLength = Env("MAX_BODY_LENGTH", 0)
+	BodyTruncation = Env("BODY_TRUNCATION", "end")
+	StartupPhaseTimeoutSeconds = Env("STARTUP_PHASE_TIMEOUT_SECONDS", 60)
+	ChatOptIn = Env("CHAT_OPTIN", false)
+	ChatCommands = Env("CHAT_COMMANDS", false)
+	ChatCommandsCooldownSeconds = Env("CHAT_COMMANDS_COOLDOWN_SECONDS", 5)
+	ChatCommandsWhisper = Env("CHAT_COMMANDS_WHISPER", false)
+	ChatSilenced = Env("CHAT_SILENCED", false)
+	ChatRateLimit = Env("CHAT_RATE_LIMIT", 20)
+	ChatChannelIntervalMs = Env("CHAT_CHANNEL_INTERVAL_MS", 1000)
+	ChatTemplates = Env("CHAT_TEMPLATES", "")
+	EmotesEnabled = Env("EMOTES_ENABLED", false)
+	EmotesProviders = Env("EMOTES_PROVIDERS", "bttv,ffz,7tv")
+	EmotesRefreshMinutes = Env("EMOTES_REFRESH_MINUTES", 30)
+	ScoringURL = Env("SCORING_URL", "")
+	ScoringTimeoutMs = Env("SCORING_TIMEOUT_MS", 500)
+	ScoringBreakerThreshold = Env("SCORING_BREAKER_THRESHOLD", 5)
+	ScoringBreakerCooldownSeconds = Env("SCORING_BREAKER_COOLDOWN_SECONDS", 30)
+	ScoringGate = Env("SCORING_GATE", false)
+	ScoringMinToxicity = Env("SCORING_MIN_TOXICITY", 0.5)
+	EventBudgetMs = Env("EVENT_BUDGET_MS", 0)
+	MetricsTopChannels = Env("METRICS_TOP_CHANNELS", 50)
+	QueueWarnRatio = Env("QUEUE_WARN_RATIO", 0.8)
+	InsertErrorsWarnPerMinute = Env("INSERT_ERRORS_WARN_PER_MINUTE", 10)
+	SpillDir = Env("SPILL_DIR", "")
+	SpillMaxMB = Env("SPILL_MAX_MB", 512)
+	BackfillURL = Env("BACKFILL_URL", "")
+	GapRecovery = Env("GAP_RECOVERY", false)
+	GapRecoveryMaxHours = Env("GAP_RECOVERY_MAX_HOURS", 24)
+	ExportDir = Env("EXPORT_DIR", "")
+	ExportFlushSeconds = Env("EXPORT_FLUSH_SECONDS", 60)
+	ExportBatchSize = Env("EXPORT_BATCH_SIZE", 10000)
+	EventLog = Env("EVENT_LOG", "")
+	EventLogMessages = Env("EVENT_LOG_MESSAGES", false)
+	DecisionsLog = Env("DECISIONS_LOG", "")
+	LinksEnrich = Env("LINKS_ENRICH", false)
+	LinksScamList = Env("LINKS_SCAM_LIST", "")
+	LinksTimeoutMs = Env("LINKS_TIMEOUT_MS", 2000)
+	TagsEnabled = Env("TAGS_ENABLED", false)
+	TagsKeywords = Env("TAGS_KEYWORDS", "")
+	TagsNamePatterns = Env("TAGS_NAME_PATTERNS", "")
+	CommandReasons = Env("COMMAND_REASONS", false)
+	CommandReasonsSeconds = Env("COMMAND_REASONS_SECONDS", 10)
+	CommandReasonsBan = Env("COMMAND_REASONS_BAN", "")
+	CommandReasonsTimeout = Env("COMMAND_REASONS_TIMEOUT", "")
+	EncryptionKey = Env("ENCRYPTION_KEY", "")
+	EncryptionKeyID = Env("ENCRYPTION_KEY_ID", "1")
+	EncryptionOldKeys = Env("ENCRYPTION_OLD_KEYS", "")
+	BanFeedWebhooks = Env("BAN_FEED_WEBHOOKS", false)
+	BanFeedWorkers = Env("BAN_FEED_WORKERS", 4)
+	TenantWebhooks = Env("TENANT_WEBHOOKS", false)
+	TenantWebhookWorkers = Env("TENANT_WEBHOOK_WORKERS", 4)
+	Outbox = Env("OUTBOX", false)
+	ChannelGroups = Env("CHANNEL_GROUPS", "")
+	GroupRulePipelines = Env("GROUP_RULE_PIPELINES", "")
+	GroupWebhooks = Env("GROUP_WEBHOOKS", "")
+	GroupWebhookSecret = Env("GROUP_WEBHOOK_SECRET", "")
+	RenamesIntervalMinutes = Env("RENAMES_INTERVAL_MINUTES", 0)
+	AccountsEnrich = Env("ACCOUNTS_ENRICH", false)
+	AccountsFollowAge = Env("ACCOUNTS_FOLLOW_AGE", false)
+	SamplingRate = Env("SAMPLING_RATE", 0.0)
+	SamplingMaxPerMinute = Env("SAMPLING_MAX_PER_MINUTE", 60)
+	SamplingRaw = Env("SAMPLING_RAW", false)
+	SamplingSecret = Env("SAMPLING_SECRET", "")
+	TapFile = Env("TAP_FILE", "")
+	TapChannels = Env("TAP_CHANNELS", "")
+	TapMaxBytes = Env("TAP_MAX_BYTES", int64(10<<20))
+	TapBackups = Env("TAP_BACKUPS", 3)
+	FixturesFile = Env("FIXTURES_FILE", "")
+	FixturesRate = Env("FIXTURES_RATE", 0.01)
+	FixturesBodies = Env("FIXTURES_BODIES", "hash")
+	CompressMessages = Env("COMPRESS_MESSAGES", false)
+	Blocklists = Env("BLOCKLISTS", "")
+	BlocklistsSyncMinutes = Env("BLOCKLISTS_SYNC_MINUTES", 60)
+	BlocklistsExcludeStats = Env("BLOCKLISTS_EXCLUDE_STATS", false)
+	BanGraceSeconds = Env("BAN_GRACE_SECONDS", 0)
+	BanGraceDrop = Env("BAN_GRACE_DROP", false)
+	MassBanWindowSeconds = Env("MASS_BAN_WINDOW_SECONDS", 0)
+	EscalationWindowMinutes = Env("ESCALATION_WINDOW_MINUTES", 0)
+	QuotaModerationsPerDay = Env("QUOTA_MODERATIONS_PER_DAY", 0)
+	QuotaBytesPerDay = Env("QUOTA_BYTES_PER_DAY", 0)
+	TenantQuotaModerationsPerDay = Env("TENANT_QUOTA_MODERATIONS_PER_DAY", 0)
+	TenantQuotaBytesPerDay = Env("TENANT_QUOTA_BYTES_PER_DAY", 0)
+	QuotaMode = Env("QUOTA_MODE", "sample")
+	QuotaSampleEvery = Env("QUOTA_SAMPLE_EVERY", 10)
+	DeletionMode = Env("DELETION_MODE", "history")
+	RulePipelines = Env("RULE_PIPELINES", "")
+	OnlyBadges = Env("ONLY_BADGES", "")
+	SkipBadges = Env("SKIP_BADGES", "")
+	FloodMessages = Env("FLOOD_MESSAGES", 0)
+	FloodWindowSeconds = Env("FLOOD_WINDOW_SECONDS", 30)
+	FloodEpsilon = Env("FLOOD_EPSILON", 0.001)
+	FloodDelta = Env("FLOOD_DELTA", 0.01)
+	UserHistorySize = Env("USER_HISTORY_SIZE", 0)
+	UserHistoryUsers = Env("USER_HISTORY_USERS", 10000)
+	InternStrings = Env("INTERN_STRINGS", 50000)
+	DailyDigest = Env("DAILY_DIGEST", false)
+	SMTPAddr = Env("SMTP_ADDR", "")
+	SMTPUsername = Env("SMTP_USERNAME", "")
+	SMTPPassword = Env("SMTP_PASSWORD", "")
+	SMTPFrom = Env("SMTP_FROM", "")
+	NotifyEmails = Env("NOTIFY_EMAILS", "")
 }
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+)
+
+// Commit is the VCS revision the binary was built from, e.g. set with
+//
+//	go build -ldflags "-X github.com/hammertrack/tracker/internal/config.Commit=$(git rev-parse --short HEAD)"
+//
+// or read from the build info otherwise. Empty if unknown, e.g. built out of
+// the repository like the Docker image without the COMMIT argument
+var Commit string
+
+// UserAgent returns the identity of the instance, its name, version and commit,
+// e.g. "hammertrack/0.0.1 (tracker-eu-1; 1a2b3c4)"
+func UserAgent() string {
+	commit := Commit
+	if commit == "" {
+		commit = "unknown"
+	}
+	return fmt.Sprintf("hammertrack/%s (%s; %s)", Version, Instance, commit)
+}
+
+// vcsRevision returns the short revision of the build info, with a "-dirty"
+// suffix if the tree had local changes
+func vcsRevision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	var rev string
+	var modified bool
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			rev = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if len(rev) > 7 {
+		rev = rev[:7]
+	}
+	if rev != "" && modified {
+		rev += "-dirty"
+	}
+	return rev
+}
+
+// hostname returns the name of the host, "unknown" if it has none
+func hostname() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "unknown"
+	}
+	return host
+}
+
+func init() {
+	if Commit == "" {
+		Commit = vcsRevision()
+	}
+}
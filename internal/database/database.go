@@ -4,7 +4,11 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gocql/gocql"
@@ -22,8 +26,15 @@ var (
 	ErrDBBadArguments = errors.New("connection arguments could not be validated")
 	ErrDBConnTimeout  = errors.New("test connection with database timed out")
 	ErrDBMigration    = errors.New("database migration failed")
+	ErrDBBootstrap    = errors.New("database bootstrap failed")
+	ErrDBKeyspace     = errors.New("invalid DB_KEYSPACE, expected a letter followed by letters, digits or underscores")
+	ErrDBReplication  = errors.New("invalid DB_REPLICATION, expected a replication factor or <datacenter>=<factor>,...")
 )
 
+// keyspaceName matches the unquoted names of the keyspaces, which can't be
+// bound as parameters of the queries
+var keyspaceName = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,47}$`)
+
 func src() string {
 	return fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
@@ -70,8 +81,44 @@ func migrate(s *gocql.Session) (err error) {
 		return
 	}
 
-	if err = mg.Steps(cfg.DBVersion); err != nil {
-		if errors.Is(err, os.ErrNotExist) {
+	// the instances started at once wait for the one holding the lock, unless
+	// the database is already up to date
+	lock := newMigrationLock(s)
+	if err = lock.create(); err != nil {
+		return
+	}
+	deadline := time.Now().Add(time.Duration(cfg.DBMigrateWaitSeconds) * time.Second)
+	for waiting := false; ; waiting = true {
+		if upToDate(mg) {
+			log.Print("  → database already migrated, no changes were applied")
+			return nil
+		}
+		var acquired bool
+		if acquired, err = lock.acquire(); err != nil || acquired {
+			break
+		}
+		if time.Now().After(deadline) {
+			return ErrMigrationLock
+		}
+		if !waiting {
+			log.Print("  → waiting for another instance to apply the migrations...")
+		}
+		time.Sleep(time.Second)
+	}
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go lock.hold(ctx)
+	defer func() {
+		cancel()
+		if err := lock.release(); err != nil {
+			errors.WrapAndLog(err)
+		}
+	}()
+
+	if err = mg.Migrate(uint(cfg.DBVersion)); err != nil {
+		if errors.Is(err, gomigrate.ErrNoChange) || errors.Is(err, os.ErrNotExist) {
 			err = nil
 			log.Print("  → no new migrations found, no changes were applied")
 		}
@@ -79,11 +126,71 @@ func migrate(s *gocql.Session) (err error) {
 	return
 }
 
-func New(doMigrate bool) *gocql.Session {
-	cluster := gocql.NewCluster(fmt.Sprintf("%s:%s", cfg.DBHost, cfg.DBPort))
+// upToDate reports whether the database is clean at cfg.DBVersion. It is not
+// while another instance is applying a migration, which leaves it dirty
+func upToDate(mg *gomigrate.Migrate) bool {
+	v, dirty, err := mg.Version()
+	return err == nil && !dirty && v == uint(cfg.DBVersion)
+}
+
+// replication returns the replication map of a keyspace from DB_REPLICATION,
+// SimpleStrategy for a replication factor and NetworkTopologyStrategy for the
+// factors of the datacenters
+func replication(s string) (string, error) {
+	if n, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
+		if n < 1 {
+			return "", errors.WrapWithContext(ErrDBReplication, struct{ Replication string }{s})
+		}
+		return fmt.Sprintf("{'class': 'SimpleStrategy', 'replication_factor': %d}", n), nil
+	}
+	var b strings.Builder
+	b.WriteString("{'class': 'NetworkTopologyStrategy'")
+	for _, dc := range strings.Split(s, ",") {
+		name, factor, ok := strings.Cut(strings.TrimSpace(dc), "=")
+		n, err := strconv.Atoi(factor)
+		// the names of the datacenters are quoted, e.g. "us-east-1"
+		if !ok || err != nil || n < 1 || name == "" || strings.ContainsAny(name, `'\`) {
+			return "", errors.WrapWithContext(ErrDBReplication, struct{ Replication string }{s})
+		}
+		fmt.Fprintf(&b, ", '%s': %d", name, n)
+	}
+	b.WriteByte('}')
+	return b.String(), nil
+}
+
+// bootstrap creates the keyspace if it doesn't exist. The session is
+// connected to no keyspace, connecting to a missing one fails
+func bootstrap() error {
+	if !keyspaceName.MatchString(cfg.DBKeyspace) {
+		return errors.WrapWithContext(ErrDBKeyspace, struct{ Keyspace string }{cfg.DBKeyspace})
+	}
+	rep, err := replication(cfg.DBReplication)
+	if err != nil {
+		return err
+	}
+	s := connect([]string{cfg.DBHost}, func(cluster *gocql.ClusterConfig) {
+		cluster.Keyspace = ""
+		cluster.Consistency = gocql.Quorum
+	})
+	defer s.Close()
+	if err := s.Query(fmt.Sprintf("CREATE KEYSPACE IF NOT EXISTS %s WITH REPLICATION = %s", cfg.DBKeyspace, rep)).Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// connect creates a session of the hosts, waiting for the database to be
+// ready
+func connect(hosts []string, configure func(*gocql.ClusterConfig)) *gocql.Session {
+	for i, host := range hosts {
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			hosts[i] = net.JoinHostPort(host, cfg.DBPort)
+		}
+	}
+	cluster := gocql.NewCluster(hosts...)
 	cluster.Keyspace = cfg.DBKeyspace
 	cluster.ProtoVersion = 4
-	cluster.Consistency = gocql.Quorum
+	configure(cluster)
 
 	log.Print("testing database connection...")
 	ctx := context.Background()
@@ -97,6 +204,30 @@ func New(doMigrate bool) *gocql.Session {
 		}{err.Error()})
 	}
 	log.Print("  ✓ database connection")
+	return s
+}
+
+func New(doMigrate bool) *gocql.Session {
+	policies, err := NewPolicies()
+	if err != nil {
+		errors.WrapFatal(err)
+	}
+	if cfg.DBBootstrap {
+		log.Printf("bootstrapping keyspace %s...", cfg.DBKeyspace)
+		if err := bootstrap(); err != nil {
+			errors.WrapFatalWithContext(ErrDBBootstrap, struct {
+				Cause string
+			}{err.Error()})
+		}
+		log.Print("  ✓ keyspace exists")
+	}
+	s := connect([]string{cfg.DBHost}, func(cluster *gocql.ClusterConfig) {
+		cluster.Consistency = policies.Consistency
+		cluster.RetryPolicy = policies.Retry
+		if cfg.DBLocalDatacenter != "" {
+			cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(gocql.DCAwareRoundRobinPolicy(cfg.DBLocalDatacenter))
+		}
+	})
 
 	if doMigrate {
 		log.Print("applying migrations...")
@@ -110,3 +241,29 @@ func New(doMigrate bool) *gocql.Session {
 
 	return s
 }
+
+// NewReader creates the session of the reads of the API from the
+// configuration. It returns nil if they share the session of New
+func NewReader() *gocql.Session {
+	if cfg.DBReadHosts == "" && cfg.DBReadDatacenter == "" {
+		return nil
+	}
+	policies, err := NewPolicies()
+	if err != nil {
+		errors.WrapFatal(err)
+	}
+	hosts := []string{cfg.DBHost}
+	if cfg.DBReadHosts != "" {
+		hosts = strings.Split(cfg.DBReadHosts, ",")
+		for i := range hosts {
+			hosts[i] = strings.TrimSpace(hosts[i])
+		}
+	}
+	return connect(hosts, func(cluster *gocql.ClusterConfig) {
+		cluster.Consistency = policies.ReadConsistency
+		cluster.RetryPolicy = policies.Retry
+		if cfg.DBReadDatacenter != "" {
+			cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(gocql.DCAwareRoundRobinPolicy(cfg.DBReadDatacenter))
+		}
+	})
+}
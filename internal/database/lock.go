@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gocql/gocql"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+)
+
+// migrationLockName is the row of the lock of the migrations
+const migrationLockName = "migrations"
+
+var (
+	ErrMigrationLock     = errors.New("gave up waiting for the migration lock")
+	ErrMigrationLockLost = errors.New("the migration lock expired while migrating")
+)
+
+// migrationLock is a lock of the migrations shared by the instances migrating
+// the same keyspace, a row inserted with a lightweight transaction. The row
+// expires after its TTL unless renewed, so the lock of an instance that died
+// while migrating is eventually released
+type migrationLock struct {
+	s     *gocql.Session
+	owner string
+	ttl   time.Duration
+}
+
+// create creates the table of the lock. It can't be a migration, the
+// migrations run under the lock
+func (l *migrationLock) create() error {
+	if err := l.s.Query(`CREATE TABLE IF NOT EXISTS migration_lock (
+  name text PRIMARY KEY,
+  owner text,
+  locked_at timestamp
+)`).Exec(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// acquire reports whether the lock was acquired
+func (l *migrationLock) acquire() (bool, error) {
+	applied, err := l.s.Query(`INSERT INTO migration_lock (name, owner, locked_at) VALUES (?, ?, ?)
+  IF NOT EXISTS USING TTL ?`, migrationLockName, l.owner, time.Now(), int(l.ttl.Seconds())).
+		SerialConsistency(gocql.Serial).
+		MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return false, errors.Wrap(err)
+	}
+	return applied, nil
+}
+
+// renew extends the TTL of the lock. It reports whether the lock is still held
+func (l *migrationLock) renew() (bool, error) {
+	applied, err := l.s.Query(`UPDATE migration_lock USING TTL ? SET locked_at = ? WHERE name = ? IF owner = ?`,
+		int(l.ttl.Seconds()), time.Now(), migrationLockName, l.owner).
+		SerialConsistency(gocql.Serial).
+		MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return false, errors.Wrap(err)
+	}
+	return applied, nil
+}
+
+// hold renews the lock every third of its TTL until ctx is done
+func (l *migrationLock) hold(ctx context.Context) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			held, err := l.renew()
+			if err != nil {
+				errors.WrapAndLog(err)
+			} else if !held {
+				errors.WrapAndLog(ErrMigrationLockLost)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// release releases the lock if it is still held
+func (l *migrationLock) release() error {
+	if _, err := l.s.Query(`DELETE FROM migration_lock WHERE name = ? IF owner = ?`, migrationLockName, l.owner).
+		SerialConsistency(gocql.Serial).
+		MapScanCAS(map[string]interface{}{}); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// newMigrationLock returns the lock of the configuration, owned by this
+// process
+func newMigrationLock(s *gocql.Session) *migrationLock {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	b := make([]byte, 4)
+	rand.Read(b)
+	return &migrationLock{
+		s:     s,
+		owner: fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b)),
+		ttl:   time.Duration(cfg.DBMigrateLockTTLSeconds) * time.Second,
+	}
+}
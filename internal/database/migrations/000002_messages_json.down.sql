@@ -0,0 +1,14 @@
+BEGIN;
+
+ALTER TABLE clearchat ADD COLUMN messages_joined varchar NOT NULL DEFAULT '';
+
+UPDATE clearchat SET messages_joined = (
+  SELECT COALESCE(string_agg(replace(body, '|', '\|'), '|' ORDER BY n), '')
+  FROM jsonb_array_elements_text(messages) WITH ORDINALITY AS m(body, n)
+);
+
+ALTER TABLE clearchat DROP COLUMN messages;
+ALTER TABLE clearchat RENAME COLUMN messages_joined TO messages;
+ALTER TABLE clearchat ALTER COLUMN messages DROP DEFAULT;
+
+COMMIT;
@@ -0,0 +1,17 @@
+BEGIN;
+
+-- the messages were joined with "|", escaping the "|" of the bodies with "\|".
+-- They are split on the unescaped separators into a JSON array
+ALTER TABLE clearchat ADD COLUMN messages_json jsonb NOT NULL DEFAULT '[]';
+
+UPDATE clearchat SET messages_json = (
+  SELECT COALESCE(jsonb_agg(replace(body, '\|', '|') ORDER BY n), '[]'::jsonb)
+  FROM regexp_split_to_table(messages, '(?<!\\)\|') WITH ORDINALITY AS m(body, n)
+)
+WHERE messages <> '';
+
+ALTER TABLE clearchat DROP COLUMN messages;
+ALTER TABLE clearchat RENAME COLUMN messages_json TO messages;
+ALTER TABLE clearchat ALTER COLUMN messages DROP DEFAULT;
+
+COMMIT;
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+)
+
+// Retry policies, see cfg.DBRetryPolicy
+const (
+	RetryNone        = "none"
+	RetrySimple      = "simple"
+	RetryExponential = "exponential"
+)
+
+var ErrDBPolicy = errors.New("invalid database consistency or retry policy")
+
+// Policies are the consistency levels, retries and speculative executions of
+// the queries, so operators can trade durability for availability during node
+// outages
+type Policies struct {
+	// Consistency is the default consistency level of the queries
+	Consistency gocql.Consistency
+	// InsertConsistency is the consistency level of the inserts of moderations
+	InsertConsistency gocql.Consistency
+	// ReadConsistency is the consistency level of the reads of the API
+	ReadConsistency gocql.Consistency
+	// Retry is nil without retries
+	Retry gocql.RetryPolicy
+	// Speculative applies to the idempotent queries only, see
+	// gocql.Query.Idempotent
+	Speculative gocql.SpeculativeExecutionPolicy
+}
+
+// NewPolicies returns the policies of the configuration
+func NewPolicies() (*Policies, error) {
+	p := &Policies{Speculative: gocql.NonSpeculativeExecution{}}
+	var err error
+	if p.Consistency, err = gocql.ParseConsistencyWrapper(cfg.DBConsistency); err != nil {
+		return nil, errors.WrapWithContext(ErrDBPolicy, struct{ Consistency string }{cfg.DBConsistency})
+	}
+	p.InsertConsistency = p.Consistency
+	if cfg.DBInsertConsistency != "" {
+		if p.InsertConsistency, err = gocql.ParseConsistencyWrapper(cfg.DBInsertConsistency); err != nil {
+			return nil, errors.WrapWithContext(ErrDBPolicy, struct{ InsertConsistency string }{cfg.DBInsertConsistency})
+		}
+	}
+	p.ReadConsistency = p.Consistency
+	if cfg.DBReadConsistency != "" {
+		if p.ReadConsistency, err = gocql.ParseConsistencyWrapper(cfg.DBReadConsistency); err != nil {
+			return nil, errors.WrapWithContext(ErrDBPolicy, struct{ ReadConsistency string }{cfg.DBReadConsistency})
+		}
+	}
+	switch strings.ToLower(cfg.DBRetryPolicy) {
+	case RetryNone:
+	case RetrySimple:
+		p.Retry = &gocql.SimpleRetryPolicy{NumRetries: cfg.DBRetries}
+	case RetryExponential:
+		p.Retry = &gocql.ExponentialBackoffRetryPolicy{
+			NumRetries: cfg.DBRetries,
+			Min:        time.Duration(cfg.DBRetryMinMs) * time.Millisecond,
+			Max:        time.Duration(cfg.DBRetryMaxMs) * time.Millisecond,
+		}
+	default:
+		return nil, errors.WrapWithContext(ErrDBPolicy, struct{ RetryPolicy string }{cfg.DBRetryPolicy})
+	}
+	if cfg.DBSpeculativeAttempts > 0 {
+		p.Speculative = &gocql.SimpleSpeculativeExecution{
+			NumAttempts:  cfg.DBSpeculativeAttempts,
+			TimeoutDelay: time.Duration(cfg.DBSpeculativeDelayMs) * time.Millisecond,
+		}
+	}
+	return p, nil
+}
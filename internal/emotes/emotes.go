@@ -0,0 +1,161 @@
+package emotes
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+type set map[string]struct{}
+
+func (s set) add(codes []string) {
+	for _, code := range codes {
+		s[code] = struct{}{}
+	}
+}
+
+type channelEmotes struct {
+	id     string
+	emotes set
+}
+
+// Registry caches the third-party emotes of the tracked channels and refreshes
+// them periodically. Channels are registered lazily, the first time a message
+// with their twitch id is seen.
+type Registry struct {
+	providers []Provider
+	refresh   time.Duration
+
+	mu       sync.RWMutex
+	global   set
+	channels map[string]*channelEmotes
+	// pending receives the channels to fetch for the first time
+	pending chan string
+}
+
+// Register adds the channel to the registry if it is not already registered
+// and schedules the fetch of its emotes. It never blocks.
+func (r *Registry) Register(channel, channelID string) {
+	if channelID == "" {
+		return
+	}
+	r.mu.Lock()
+	if _, ok := r.channels[channel]; ok {
+		r.mu.Unlock()
+		return
+	}
+	r.channels[channel] = &channelEmotes{id: channelID, emotes: make(set)}
+	r.mu.Unlock()
+
+	select {
+	case r.pending <- channel:
+	default:
+		// the next refresh will fetch it
+	}
+}
+
+// Count returns the number of words in body that are third-party emotes of
+// the channel or global third-party emotes
+func (r *Registry) Count(channel, body string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ch := r.channels[channel]
+	n := 0
+	for _, word := range strings.Fields(body) {
+		if _, ok := r.global[word]; ok {
+			n++
+			continue
+		}
+		if ch != nil {
+			if _, ok := ch.emotes[word]; ok {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func (r *Registry) fetchGlobal(ctx context.Context) {
+	global := make(set)
+	for _, p := range r.providers {
+		codes, err := p.Global(ctx)
+		if err != nil {
+			errors.WrapAndLogWithContext(err, struct{ Provider string }{p.Name()})
+			continue
+		}
+		global.add(codes)
+	}
+	r.mu.Lock()
+	r.global = global
+	r.mu.Unlock()
+}
+
+func (r *Registry) fetchChannel(ctx context.Context, channel string) {
+	r.mu.RLock()
+	ch, ok := r.channels[channel]
+	r.mu.RUnlock()
+	if !ok {
+		return
+	}
+	emotes := make(set)
+	for _, p := range r.providers {
+		codes, err := p.Channel(ctx, ch.id)
+		if err != nil {
+			errors.WrapAndLogWithContext(err, struct {
+				Provider string
+				Channel  string
+			}{p.Name(), channel})
+			continue
+		}
+		emotes.add(codes)
+	}
+	r.mu.Lock()
+	ch.emotes = emotes
+	r.mu.Unlock()
+}
+
+func (r *Registry) fetchAll(ctx context.Context) {
+	r.fetchGlobal(ctx)
+	r.mu.RLock()
+	all := make([]string, 0, len(r.channels))
+	for ch := range r.channels {
+		all = append(all, ch)
+	}
+	r.mu.RUnlock()
+	for _, ch := range all {
+		r.fetchChannel(ctx, ch)
+	}
+	log.Printf("third-party emotes refreshed for %d channels", len(all))
+}
+
+// Start fetches the emotes of the newly registered channels as they come and
+// refreshes all of them periodically until ctx is done
+func (r *Registry) Start(ctx context.Context) {
+	r.fetchGlobal(ctx)
+	ticker := time.NewTicker(r.refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case ch := <-r.pending:
+			r.fetchChannel(ctx, ch)
+		case <-ticker.C:
+			r.fetchAll(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func New(providers []Provider, refresh time.Duration) *Registry {
+	return &Registry{
+		providers: providers,
+		refresh:   refresh,
+		global:    make(set),
+		channels:  make(map[string]*channelEmotes),
+		pending:   make(chan string, 100),
+	}
+}
@@ -0,0 +1,52 @@
+package emotes
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type providerTest struct {
+	global   []string
+	channels map[string][]string
+}
+
+func (p *providerTest) Name() string { return "test" }
+func (p *providerTest) Global(ctx context.Context) ([]string, error) {
+	return p.global, nil
+}
+func (p *providerTest) Channel(ctx context.Context, channelID string) ([]string, error) {
+	return p.channels[channelID], nil
+}
+
+func TestCount(t *testing.T) {
+	t.Parallel()
+	p := &providerTest{
+		global:   []string{"OMEGALUL", "monkaS"},
+		channels: map[string][]string{"1": {"fooHype"}, "2": {"barWave"}},
+	}
+	r := New([]Provider{p}, time.Hour)
+	r.Register("foo", "1")
+	r.Register("bar", "2")
+	r.fetchAll(context.Background())
+
+	tests := []struct {
+		channel string
+		body    string
+		want    int
+	}{
+		{channel: "foo", body: "hola que tal", want: 0},
+		{channel: "foo", body: "OMEGALUL OMEGALUL fooHype", want: 3},
+		{channel: "foo", body: "barWave monkaS", want: 1},
+		{channel: "bar", body: "barWave monkaS", want: 2},
+		{channel: "unknown", body: "fooHype monkaS", want: 1},
+		{channel: "foo", body: "omegalul", want: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.channel+":"+test.body, func(t *testing.T) {
+			if got := r.Count(test.channel, test.body); got != test.want {
+				t.Fatalf("got: %d, want: %d", got, test.want)
+			}
+		})
+	}
+}
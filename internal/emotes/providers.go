@@ -0,0 +1,157 @@
+package emotes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+const RequestTimeout = 10 * time.Second
+
+var ErrUnexpectedStatus = errors.New("unexpected status code from emote provider")
+
+// Provider is a third-party emote service
+type Provider interface {
+	Name() string
+	// Global returns the codes of the emotes available in every channel
+	Global(ctx context.Context) ([]string, error)
+	// Channel returns the codes of the emotes of the channel with the given
+	// twitch user id
+	Channel(ctx context.Context, channelID string) ([]string, error)
+}
+
+func getJSON(ctx context.Context, url string, dst interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		// the channel doesn't use the provider
+		return nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return errors.WrapWithContext(ErrUnexpectedStatus, struct {
+			URL    string
+			Status int
+		}{url, res.StatusCode})
+	}
+	if err := json.NewDecoder(res.Body).Decode(dst); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+type bttvEmote struct {
+	Code string `json:"code"`
+}
+
+func bttvCodes(emotes ...[]bttvEmote) []string {
+	codes := make([]string, 0)
+	for _, list := range emotes {
+		for _, e := range list {
+			codes = append(codes, e.Code)
+		}
+	}
+	return codes
+}
+
+// BTTV - BetterTTV
+type BTTV struct{}
+
+func (BTTV) Name() string { return "bttv" }
+func (BTTV) Global(ctx context.Context) ([]string, error) {
+	var res []bttvEmote
+	if err := getJSON(ctx, "https://api.betterttv.net/3/cached/emotes/global", &res); err != nil {
+		return nil, err
+	}
+	return bttvCodes(res), nil
+}
+func (BTTV) Channel(ctx context.Context, channelID string) ([]string, error) {
+	var res struct {
+		ChannelEmotes []bttvEmote `json:"channelEmotes"`
+		SharedEmotes  []bttvEmote `json:"sharedEmotes"`
+	}
+	if err := getJSON(ctx, "https://api.betterttv.net/3/cached/users/twitch/"+channelID, &res); err != nil {
+		return nil, err
+	}
+	return bttvCodes(res.ChannelEmotes, res.SharedEmotes), nil
+}
+
+// FFZ - FrankerFaceZ, through the cached API of BetterTTV which has the same
+// format
+type FFZ struct{}
+
+func (FFZ) Name() string { return "ffz" }
+func (FFZ) Global(ctx context.Context) ([]string, error) {
+	var res []bttvEmote
+	if err := getJSON(ctx, "https://api.betterttv.net/3/cached/frankerfacez/emotes/global", &res); err != nil {
+		return nil, err
+	}
+	return bttvCodes(res), nil
+}
+func (FFZ) Channel(ctx context.Context, channelID string) ([]string, error) {
+	var res []bttvEmote
+	if err := getJSON(ctx, "https://api.betterttv.net/3/cached/frankerfacez/users/twitch/"+channelID, &res); err != nil {
+		return nil, err
+	}
+	return bttvCodes(res), nil
+}
+
+type sevenTVSet struct {
+	Emotes []struct {
+		Name string `json:"name"`
+	} `json:"emotes"`
+}
+
+func (s sevenTVSet) codes() []string {
+	codes := make([]string, len(s.Emotes))
+	for i, e := range s.Emotes {
+		codes[i] = e.Name
+	}
+	return codes
+}
+
+// SevenTV - 7TV
+type SevenTV struct{}
+
+func (SevenTV) Name() string { return "7tv" }
+func (SevenTV) Global(ctx context.Context) ([]string, error) {
+	var res sevenTVSet
+	if err := getJSON(ctx, "https://7tv.io/v3/emote-sets/global", &res); err != nil {
+		return nil, err
+	}
+	return res.codes(), nil
+}
+func (SevenTV) Channel(ctx context.Context, channelID string) ([]string, error) {
+	var res struct {
+		EmoteSet sevenTVSet `json:"emote_set"`
+	}
+	if err := getJSON(ctx, fmt.Sprintf("https://7tv.io/v3/users/twitch/%s", channelID), &res); err != nil {
+		return nil, err
+	}
+	return res.EmoteSet.codes(), nil
+}
+
+// ProviderByName returns a built-in provider or nil if it doesn't exist
+func ProviderByName(name string) Provider {
+	switch name {
+	case "bttv":
+		return BTTV{}
+	case "ffz":
+		return FFZ{}
+	case "7tv":
+		return SevenTV{}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// Package encryption encrypts the message bodies before they are stored, so
+// the operators of the database cannot read them.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+// Prefix of the encrypted values, followed by the id of the key and the
+// ciphertext: enc:v1:<key id>:<base64 of nonce and ciphertext>
+const Prefix = "enc:v1:"
+
+const KeySize = 32
+
+var (
+	ErrKeySize    = errors.New("encryption keys must be 32 bytes long")
+	ErrUnknownKey = errors.New("value encrypted with an unknown key")
+	ErrMalformed  = errors.New("malformed encrypted value")
+)
+
+// KeyProvider provides the keys, e.g. from the configuration or a KMS
+type KeyProvider interface {
+	// CurrentKey returns the key used to encrypt and its id
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key with the given id, used to decrypt
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider of a fixed set of keys
+type StaticKeys struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+func (s *StaticKeys) CurrentKey() (string, []byte, error) {
+	key, err := s.Key(s.Current)
+	return s.Current, key, err
+}
+
+func (s *StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := s.Keys[id]
+	if !ok {
+		return nil, errors.WrapWithContext(ErrUnknownKey, struct{ KeyID string }{id})
+	}
+	return key, nil
+}
+
+// ParseKeys parses the current key and the old keys used only to decrypt,
+// given as "id:base64,id:base64"
+func ParseKeys(currentID, current, old string) (*StaticKeys, error) {
+	keys := &StaticKeys{Current: currentID, Keys: make(map[string][]byte)}
+	add := func(id, encoded string) error {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return errors.Wrap(err)
+		}
+		if len(key) != KeySize {
+			return errors.WrapWithContext(ErrKeySize, struct{ KeyID string }{id})
+		}
+		keys.Keys[id] = key
+		return nil
+	}
+	if err := add(currentID, current); err != nil {
+		return nil, err
+	}
+	for _, pair := range strings.Split(old, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, errors.Wrap(ErrMalformed)
+		}
+		if err := add(id, encoded); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// Cipher encrypts and decrypts with AES-GCM. The additional data binds each
+// value to its row, so a value copied to another row fails to decrypt
+type Cipher struct {
+	keys KeyProvider
+}
+
+func aead(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return gcm, nil
+}
+
+func (c *Cipher) Encrypt(plaintext, additional string) (string, error) {
+	id, key, err := c.keys.CurrentKey()
+	if err != nil {
+		return "", err
+	}
+	gcm, err := aead(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.Wrap(err)
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), []byte(additional))
+	return Prefix + id + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value encrypted with Encrypt. Values not encrypted are
+// returned as they are, so rows stored before enabling the encryption are
+// still readable. Those that happen to start with Prefix fail to decrypt, like
+// tampered values do, so the callers must not let them fail a whole listing
+func (c *Cipher) Decrypt(value, additional string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(value, Prefix), ":")
+	if !ok {
+		return "", errors.Wrap(ErrMalformed)
+	}
+	key, err := c.keys.Key(id)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", errors.Wrap(err)
+	}
+	gcm, err := aead(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.Wrap(ErrMalformed)
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(additional))
+	if err != nil {
+		return "", errors.Wrap(err)
+	}
+	return string(plaintext), nil
+}
+
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+func New(keys KeyProvider) *Cipher {
+	return &Cipher{keys: keys}
+}
@@ -0,0 +1,68 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+)
+
+func key(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, KeySize))
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+	keys, err := ParseKeys("2", key(2), "1:"+key(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(keys)
+
+	enc, err := c.Encrypt("hello chat", "foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(enc) || enc == "hello chat" {
+		t.Fatalf("expected an encrypted value, got %q", enc)
+	}
+	dec, err := c.Decrypt(enc, "foo/bar")
+	if err != nil || dec != "hello chat" {
+		t.Fatalf("got %q, %v", dec, err)
+	}
+	if _, err := c.Decrypt(enc, "foo/baz"); err == nil {
+		t.Fatal("expected an error decrypting with other additional data")
+	}
+
+	// values encrypted with an old key are still readable
+	old, err := New(&StaticKeys{Current: "1", Keys: keys.Keys}).Encrypt("old", "foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec, err := c.Decrypt(old, "foo/bar"); err != nil || dec != "old" {
+		t.Fatalf("got %q, %v", dec, err)
+	}
+
+	// plaintext values are returned as they are
+	if dec, err := c.Decrypt("plain", "foo/bar"); err != nil || dec != "plain" {
+		t.Fatalf("got %q, %v", dec, err)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		current, old string
+		wantErr      bool
+	}{
+		{key(1), "", false},
+		{key(1), "0:" + key(0) + ", ", false},
+		{"c2hvcnQ=", "", true},
+		{key(1), "nocolon", true},
+		{key(1), "0:not base64", true},
+	}
+	for _, tt := range tests {
+		if _, err := ParseKeys("1", tt.current, tt.old); (err != nil) != tt.wantErr {
+			t.Fatalf("ParseKeys(%q, %q): got %v, want error %v", tt.current, tt.old, err, tt.wantErr)
+		}
+	}
+}
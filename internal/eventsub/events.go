@@ -0,0 +1,336 @@
+package eventsub
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/helix"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// Message types of the EventSub websocket protocol
+const (
+	TypeWelcome      = "session_welcome"
+	TypeKeepalive    = "session_keepalive"
+	TypeNotification = "notification"
+	TypeReconnect    = "session_reconnect"
+	TypeRevocation   = "revocation"
+)
+
+// Subscription types handled by the client
+const (
+	SubChatMessage       = "channel.chat.message"
+	SubBan               = "channel.ban"
+	SubUnban             = "channel.unban"
+	SubClearUserMessages = "channel.chat.clear_user_messages"
+	SubMessageDelete     = "channel.chat.message_delete"
+	SubAutomodHold       = "automod.message.hold"
+	SubAutomodUpdate     = "automod.message.update"
+	SubModerate          = "channel.moderate"
+	SubChatClear         = "channel.chat.clear"
+	SubWarningSend       = "channel.warning.send"
+)
+
+var ErrUnknownSubscription = errors.New("unknown subscription type")
+
+type metadata struct {
+	MessageID        string    `json:"message_id"`
+	MessageType      string    `json:"message_type"`
+	MessageTimestamp time.Time `json:"message_timestamp"`
+	SubscriptionType string    `json:"subscription_type"`
+}
+
+type session struct {
+	ID                      string `json:"id"`
+	Status                  string `json:"status"`
+	KeepaliveTimeoutSeconds int    `json:"keepalive_timeout_seconds"`
+	ReconnectURL            string `json:"reconnect_url"`
+}
+
+// envelope is every message received through the websocket
+type envelope struct {
+	Metadata metadata `json:"metadata"`
+	Payload  struct {
+		Session      *session            `json:"session"`
+		Subscription *helix.Subscription `json:"subscription"`
+		Event        json.RawMessage     `json:"event"`
+	} `json:"payload"`
+}
+
+type chatMessageEvent struct {
+	BroadcasterUserID    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	ChatterUserID        string `json:"chatter_user_id"`
+	ChatterUserLogin     string `json:"chatter_user_login"`
+	MessageID            string `json:"message_id"`
+	Message              struct {
+		Text string `json:"text"`
+	} `json:"message"`
+	Badges []struct {
+		SetID string `json:"set_id"`
+		// Info is the number of months subscribed of the subscriber badges
+		Info string `json:"info"`
+	} `json:"badges"`
+}
+
+type banEvent struct {
+	UserID               string     `json:"user_id"`
+	UserLogin            string     `json:"user_login"`
+	BroadcasterUserID    string     `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string     `json:"broadcaster_user_login"`
+	ModeratorUserLogin   string     `json:"moderator_user_login"`
+	Reason               string     `json:"reason"`
+	BannedAt             time.Time  `json:"banned_at"`
+	EndsAt               *time.Time `json:"ends_at"`
+	IsPermanent          bool       `json:"is_permanent"`
+}
+
+type unbanEvent struct {
+	UserID               string `json:"user_id"`
+	UserLogin            string `json:"user_login"`
+	BroadcasterUserID    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+}
+
+type clearUserMessagesEvent struct {
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	TargetUserID         string `json:"target_user_id"`
+	TargetUserLogin      string `json:"target_user_login"`
+}
+
+// messageDeleteEvent is the event of channel.chat.message_delete. Unlike the
+// CLEARMSG of IRC, it has no body, so the deleted message must be in the
+// history to be stored
+type messageDeleteEvent struct {
+	BroadcasterUserID    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	TargetUserID         string `json:"target_user_id"`
+	TargetUserLogin      string `json:"target_user_login"`
+	MessageID            string `json:"message_id"`
+}
+
+// moderateEvent is the event of channel.moderate. Only the chat clears are
+// parsed, the rest of actions have their own subscriptions
+type moderateEvent struct {
+	BroadcasterUserID    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	ModeratorUserLogin   string `json:"moderator_user_login"`
+	Action               string `json:"action"`
+}
+
+// chatClearEvent is the event of channel.chat.clear, received instead of
+// channel.moderate when the account is not a moderator of the channel
+type chatClearEvent struct {
+	BroadcasterUserID    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+}
+
+// warningEvent is the event of channel.warning.send
+type warningEvent struct {
+	BroadcasterUserID    string   `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string   `json:"broadcaster_user_login"`
+	ModeratorUserLogin   string   `json:"moderator_user_login"`
+	UserID               string   `json:"user_id"`
+	UserLogin            string   `json:"user_login"`
+	Reason               string   `json:"reason"`
+	ChatRulesCited       []string `json:"chat_rules_cited"`
+}
+
+// automodEvent is the event of both automod.message.hold and
+// automod.message.update. Status is only present in the updates
+type automodEvent struct {
+	BroadcasterUserID    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	UserID               string `json:"user_id"`
+	UserLogin            string `json:"user_login"`
+	MessageID            string `json:"message_id"`
+	Message              struct {
+		Text string `json:"text"`
+	} `json:"message"`
+	Category string    `json:"category"`
+	Level    int       `json:"level"`
+	Status   string    `json:"status"`
+	HeldAt   time.Time `json:"held_at"`
+}
+
+// parseEvent maps the event of a notification into a message.Message, the
+// same way the IRC handlers of the bot do it, so the rest of the pipeline
+// doesn't know where the messages come from. `at` is the timestamp of the
+// notification, used for events without their own timestamp.
+func parseEvent(subType string, at time.Time, raw json.RawMessage) (*message.Message, error) {
+	switch subType {
+	case SubChatMessage:
+		var e chatMessageEvent
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		sub := message.SubscribedStatusFalse
+		months := 0
+		var badges []string
+		for _, badge := range e.Badges {
+			badges = append(badges, badge.SetID)
+			if badge.SetID == "subscriber" || badge.SetID == "founder" {
+				sub = message.SubscribedStatusTrue
+				months, _ = strconv.Atoi(badge.Info)
+			}
+		}
+		return &message.Message{
+			Type:      message.MessagePrivmsg,
+			Username:  e.ChatterUserLogin,
+			UserID:    e.ChatterUserID,
+			Channel:   e.BroadcasterUserLogin,
+			ChannelID: e.BroadcasterUserID,
+			LastMessages: []*message.PrivateMessage{{
+				ID:         e.MessageID,
+				Username:   e.ChatterUserLogin,
+				UserID:     e.ChatterUserID,
+				Body:       e.Message.Text,
+				At:         at,
+				Subscribed: sub,
+				SubMonths:  months,
+				Badges:     badges,
+			}},
+			At: at,
+		}, nil
+	case SubBan:
+		var e banEvent
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		msg := &message.Message{
+			Type:      message.MessageBan,
+			Username:  e.UserLogin,
+			UserID:    e.UserID,
+			Channel:   e.BroadcasterUserLogin,
+			ChannelID: e.BroadcasterUserID,
+			At:        e.BannedAt,
+		}
+		if !e.IsPermanent && e.EndsAt != nil {
+			msg.Type = message.MessageTimeout
+			msg.Duration = int(e.EndsAt.Sub(e.BannedAt).Seconds())
+		}
+		return msg, nil
+	case SubUnban:
+		var e unbanEvent
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		return &message.Message{
+			Type:      message.MessageUnban,
+			Username:  e.UserLogin,
+			UserID:    e.UserID,
+			Channel:   e.BroadcasterUserLogin,
+			ChannelID: e.BroadcasterUserID,
+			At:        at,
+		}, nil
+	case SubClearUserMessages:
+		var e clearUserMessagesEvent
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		// Caveat: this event doesn't tell bans and timeouts apart, it is only used
+		// when the channel.ban subscription is not authorized. See Client
+		return &message.Message{
+			Type:     message.MessageUserClear,
+			Username: e.TargetUserLogin,
+			UserID:   e.TargetUserID,
+			Channel:  e.BroadcasterUserLogin,
+			At:       at,
+		}, nil
+	case SubMessageDelete:
+		var e messageDeleteEvent
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		return &message.Message{
+			Type:        message.MessageDeletion,
+			Username:    e.TargetUserLogin,
+			UserID:      e.TargetUserID,
+			Channel:     e.BroadcasterUserLogin,
+			ChannelID:   e.BroadcasterUserID,
+			TargetMsgID: e.MessageID,
+			At:          at,
+		}, nil
+	case SubModerate:
+		var e moderateEvent
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		if e.Action != "clear" {
+			return nil, nil
+		}
+		return &message.Message{
+			Type:      message.MessageChatClear,
+			Channel:   e.BroadcasterUserLogin,
+			ChannelID: e.BroadcasterUserID,
+			Moderator: e.ModeratorUserLogin,
+			At:        at,
+		}, nil
+	case SubChatClear:
+		var e chatClearEvent
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		return &message.Message{
+			Type:      message.MessageChatClear,
+			Channel:   e.BroadcasterUserLogin,
+			ChannelID: e.BroadcasterUserID,
+			At:        at,
+		}, nil
+	case SubWarningSend:
+		var e warningEvent
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		// the cited rules are part of the reason given to the user
+		var reasons []string
+		for _, r := range append([]string{e.Reason}, e.ChatRulesCited...) {
+			if r != "" {
+				reasons = append(reasons, r)
+			}
+		}
+		return &message.Message{
+			Type:      message.MessageWarning,
+			Username:  e.UserLogin,
+			UserID:    e.UserID,
+			Channel:   e.BroadcasterUserLogin,
+			ChannelID: e.BroadcasterUserID,
+			Moderator: e.ModeratorUserLogin,
+			Reason:    strings.Join(reasons, "; "),
+			At:        at,
+		}, nil
+	case SubAutomodHold, SubAutomodUpdate:
+		var e automodEvent
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return nil, errors.Wrap(err)
+		}
+		status := message.AutomodHeld
+		if subType == SubAutomodUpdate {
+			status = strings.ToLower(e.Status)
+		}
+		return &message.Message{
+			Type:      message.MessageAutomod,
+			Username:  e.UserLogin,
+			UserID:    e.UserID,
+			Channel:   e.BroadcasterUserLogin,
+			ChannelID: e.BroadcasterUserID,
+			// the held message never reached the chat, so it is not in the history
+			LastMessages: []*message.PrivateMessage{{
+				ID:         e.MessageID,
+				Username:   e.UserLogin,
+				UserID:     e.UserID,
+				Body:       e.Message.Text,
+				At:         e.HeldAt,
+				Subscribed: message.SubscribedStatusUnknown,
+			}},
+			AutomodStatus:   status,
+			AutomodCategory: e.Category,
+			AutomodLevel:    e.Level,
+			At:              at,
+		}, nil
+	}
+	return nil, ErrUnknownSubscription
+}
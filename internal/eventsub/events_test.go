@@ -0,0 +1,159 @@
+package eventsub
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestParseEvent(t *testing.T) {
+	t.Parallel()
+	at := time.Date(2023, 7, 19, 14, 56, 51, 0, time.UTC)
+	bannedAt := time.Date(2023, 7, 19, 14, 50, 0, 0, time.UTC)
+
+	tests := []struct {
+		desc    string
+		subType string
+		event   string
+		want    *message.Message
+	}{
+		{
+			desc:    "chat message",
+			subType: SubChatMessage,
+			event: `{"broadcaster_user_id":"1","broadcaster_user_login":"foo","chatter_user_login":"bar","message_id":"abc",
+				"message":{"text":"hola"},"badges":[{"set_id":"subscriber","id":"12","info":"16"}]}`,
+			want: &message.Message{
+				Type:      message.MessagePrivmsg,
+				Username:  "bar",
+				Channel:   "foo",
+				ChannelID: "1",
+				LastMessages: []*message.PrivateMessage{{
+					ID: "abc", Username: "bar", Body: "hola", At: at, Subscribed: message.SubscribedStatusTrue, SubMonths: 16,
+					Badges: []string{"subscriber"},
+				}},
+				At: at,
+			},
+		},
+		{
+			desc:    "chat clear by a moderator",
+			subType: SubModerate,
+			event:   `{"broadcaster_user_id":"1","broadcaster_user_login":"foo","moderator_user_login":"mod","action":"clear"}`,
+			want:    &message.Message{Type: message.MessageChatClear, Channel: "foo", ChannelID: "1", Moderator: "mod", At: at},
+		},
+		{
+			desc:    "other moderator action",
+			subType: SubModerate,
+			event:   `{"broadcaster_user_id":"1","broadcaster_user_login":"foo","moderator_user_login":"mod","action":"slow"}`,
+			want:    nil,
+		},
+		{
+			desc:    "warning",
+			subType: SubWarningSend,
+			event: `{"broadcaster_user_id":"1","broadcaster_user_login":"foo","moderator_user_login":"mod","user_id":"2","user_login":"bar",
+				"reason":"be nice","chat_rules_cited":["no spam"]}`,
+			want: &message.Message{Type: message.MessageWarning, Username: "bar", UserID: "2", Channel: "foo", ChannelID: "1", Moderator: "mod", Reason: "be nice; no spam", At: at},
+		},
+		{
+			desc:    "warning with no reason",
+			subType: SubWarningSend,
+			event:   `{"broadcaster_user_id":"1","broadcaster_user_login":"foo","moderator_user_login":"mod","user_login":"bar","reason":null,"chat_rules_cited":["no spam"]}`,
+			want:    &message.Message{Type: message.MessageWarning, Username: "bar", Channel: "foo", ChannelID: "1", Moderator: "mod", Reason: "no spam", At: at},
+		},
+		{
+			desc:    "chat clear",
+			subType: SubChatClear,
+			event:   `{"broadcaster_user_id":"1","broadcaster_user_login":"foo"}`,
+			want:    &message.Message{Type: message.MessageChatClear, Channel: "foo", ChannelID: "1", At: at},
+		},
+		{
+			desc:    "permanent ban",
+			subType: SubBan,
+			event: `{"user_id":"2","user_login":"bar","broadcaster_user_login":"foo","moderator_user_login":"mod",
+				"reason":"spam","banned_at":"2023-07-19T14:50:00Z","ends_at":null,"is_permanent":true}`,
+			want: &message.Message{Type: message.MessageBan, Username: "bar", UserID: "2", Channel: "foo", At: bannedAt},
+		},
+		{
+			desc:    "timeout",
+			subType: SubBan,
+			event: `{"user_login":"bar","broadcaster_user_login":"foo","moderator_user_login":"mod",
+				"reason":"","banned_at":"2023-07-19T14:50:00Z","ends_at":"2023-07-19T15:00:00Z","is_permanent":false}`,
+			want: &message.Message{Type: message.MessageTimeout, Duration: 600, Username: "bar", Channel: "foo", At: bannedAt},
+		},
+		{
+			desc:    "unban",
+			subType: SubUnban,
+			event:   `{"user_id":"2","user_login":"bar","broadcaster_user_id":"1","broadcaster_user_login":"foo","moderator_user_login":"mod"}`,
+			want:    &message.Message{Type: message.MessageUnban, Username: "bar", UserID: "2", Channel: "foo", ChannelID: "1", At: at},
+		},
+		{
+			desc:    "message delete",
+			subType: SubMessageDelete,
+			event:   `{"broadcaster_user_id":"1","broadcaster_user_login":"foo","target_user_id":"2","target_user_login":"bar","message_id":"abc"}`,
+			want:    &message.Message{Type: message.MessageDeletion, Username: "bar", UserID: "2", Channel: "foo", ChannelID: "1", TargetMsgID: "abc", At: at},
+		},
+		{
+			desc:    "clear user messages",
+			subType: SubClearUserMessages,
+			event:   `{"broadcaster_user_login":"foo","target_user_login":"bar"}`,
+			want:    &message.Message{Type: message.MessageUserClear, Username: "bar", Channel: "foo", At: at},
+		},
+		{
+			desc:    "automod hold",
+			subType: SubAutomodHold,
+			event: `{"broadcaster_user_id":"1","broadcaster_user_login":"foo","user_login":"bar","message_id":"m1",
+				"message":{"text":"hi"},"category":"swearing","level":2,"held_at":"2023-07-19T14:50:00Z"}`,
+			want: &message.Message{
+				Type:      message.MessageAutomod,
+				Username:  "bar",
+				Channel:   "foo",
+				ChannelID: "1",
+				LastMessages: []*message.PrivateMessage{{
+					ID: "m1", Username: "bar", Body: "hi", At: bannedAt, Subscribed: message.SubscribedStatusUnknown,
+				}},
+				AutomodStatus:   message.AutomodHeld,
+				AutomodCategory: "swearing",
+				AutomodLevel:    2,
+				At:              at,
+			},
+		},
+		{
+			desc:    "automod denied",
+			subType: SubAutomodUpdate,
+			event: `{"broadcaster_user_id":"1","broadcaster_user_login":"foo","user_login":"bar","message_id":"m1",
+				"message":{"text":"hi"},"category":"swearing","level":2,"status":"Denied","held_at":"2023-07-19T14:50:00Z"}`,
+			want: &message.Message{
+				Type:      message.MessageAutomod,
+				Username:  "bar",
+				Channel:   "foo",
+				ChannelID: "1",
+				LastMessages: []*message.PrivateMessage{{
+					ID: "m1", Username: "bar", Body: "hi", At: bannedAt, Subscribed: message.SubscribedStatusUnknown,
+				}},
+				AutomodStatus:   message.AutomodDenied,
+				AutomodCategory: "swearing",
+				AutomodLevel:    2,
+				At:              at,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := parseEvent(test.subType, at, json.RawMessage(test.event))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got: %s, want: %s", spew.Sdump(got), spew.Sdump(test.want))
+			}
+		})
+	}
+
+	if _, err := parseEvent("channel.follow", at, json.RawMessage(`{}`)); err != ErrUnknownSubscription {
+		t.Fatalf("got: %v, want: %v", err, ErrUnknownSubscription)
+	}
+}
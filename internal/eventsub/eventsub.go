@@ -0,0 +1,420 @@
+package eventsub
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/helix"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+const (
+	DefaultURL = "wss://eventsub.wss.twitch.tv/ws"
+	// Time waited for the welcome message after connecting
+	WelcomeTimeout = 10 * time.Second
+	// Extra time waited on top of the keepalive timeout announced by twitch
+	// before considering the connection dead
+	KeepaliveSlack = 5 * time.Second
+	// Time waited before reconnecting after the connection is lost
+	ReconnectDelay = 5 * time.Second
+)
+
+var (
+	ErrDisconnected    = errors.New("eventsub client disconnected")
+	ErrUnknownUser     = errors.New("twitch user not found")
+	ErrExpectedWelcome = errors.New("expected a session_welcome message")
+)
+
+// channel is the state of the subscriptions of a tracked twitch channel
+type channel struct {
+	broadcasterID string
+	subIDs        []string
+	// banAuthorized is whether the channel.ban subscription was accepted. It
+	// requires the authorization of the broadcaster so it usually isn't, in
+	// which case bans are read from channel.chat.clear_user_messages
+	banAuthorized bool
+}
+
+// Client reads chat messages and moderations from the EventSub websocket
+// transport. It has the same methods as the IRC client so the bot can use
+// both interchangeably.
+//
+// Caveat: twitch limits the number of subscriptions per websocket session and
+// each channel uses up to six, so a single client can't track more than ~50
+// channels.
+type Client struct {
+	URL   string
+	helix *helix.Client
+	// login of the account reading the chats, which must be the owner of the
+	// helix token
+	login     string
+	userID    string
+	onEvent   func(msg *message.Message)
+	onConnect func()
+	// welcomed is whether the client has connected at least once
+	welcomed bool
+
+	// mu protects the fields below
+	mu        sync.Mutex
+	channels  map[string]*channel
+	sessionID string
+	conn      *websocket.Conn
+	done      chan struct{}
+}
+
+// OnEvent sets the function called for every message received
+func (c *Client) OnEvent(fn func(msg *message.Message)) {
+	c.onEvent = fn
+}
+
+// OnConnect sets the function called once the client is connected and
+// subscribed to the events of the joined channels
+func (c *Client) OnConnect(fn func()) {
+	c.onConnect = fn
+}
+
+// Join subscribes to the events of the given channels. If the client is not
+// connected, the subscriptions are created on connect.
+func (c *Client) Join(channels ...string) {
+	c.mu.Lock()
+	added := make([]string, 0, len(channels))
+	for _, ch := range channels {
+		if _, ok := c.channels[ch]; !ok {
+			c.channels[ch] = &channel{}
+			added = append(added, ch)
+		}
+	}
+	connected := c.sessionID != ""
+	c.mu.Unlock()
+
+	if connected && len(added) > 0 {
+		go c.subscribe(added)
+	}
+}
+
+// Depart deletes the subscriptions of the channel
+func (c *Client) Depart(ch string) {
+	c.mu.Lock()
+	state, ok := c.channels[ch]
+	delete(c.channels, ch)
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	go func() {
+		for _, id := range state.subIDs {
+			if err := c.helix.DeleteSubscription(context.Background(), id); err != nil {
+				errors.WrapAndLog(err)
+			}
+		}
+	}()
+}
+
+// Connect connects to the EventSub websocket and handles the events until
+// Disconnect is called, reconnecting when the connection is lost. It always
+// returns an error, ErrDisconnected if the client was disconnected.
+func (c *Client) Connect() error {
+	users, err := c.helix.Users(helix.WithPriority(context.Background(), helix.PriorityHigh), []string{c.login})
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return errors.WrapWithContext(ErrUnknownUser, struct {
+			Login string
+		}{c.login})
+	}
+	c.userID = users[0].ID
+
+	var (
+		url  = c.URL
+		prev *websocket.Conn
+	)
+	for {
+		var reconnectURL string
+		// a new session is only needed when it is not a reconnection requested by
+		// twitch
+		reconnectURL, err = c.run(url, prev, prev == nil)
+		if c.isDone() {
+			return ErrDisconnected
+		}
+		if reconnectURL != "" {
+			// twitch asks to move to another url. The subscriptions are kept, and the
+			// current connection must stay open until the new one is welcomed
+			c.mu.Lock()
+			prev = c.conn
+			c.mu.Unlock()
+			url = reconnectURL
+			continue
+		}
+		errors.WrapAndLog(err)
+		prev = nil
+		url = c.URL
+		select {
+		case <-time.After(ReconnectDelay):
+		case <-c.done:
+			return ErrDisconnected
+		}
+	}
+}
+
+// run connects to `url` and reads from the connection until it is lost or
+// twitch asks to reconnect somewhere else, in which case it returns the new
+// url. `prev` is the previous connection, closed as soon as the new one is
+// welcomed. If resubscribe is true, all the subscriptions are created again.
+func (c *Client) run(url string, prev *websocket.Conn, resubscribe bool) (string, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return "", errors.Wrap(err)
+	}
+	keepOpen := false
+	defer func() {
+		if !keepOpen {
+			conn.Close()
+		}
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(WelcomeTimeout))
+	var env envelope
+	if err := conn.ReadJSON(&env); err != nil {
+		return "", errors.Wrap(err)
+	}
+	if env.Metadata.MessageType != TypeWelcome || env.Payload.Session == nil {
+		return "", errors.WrapWithContext(ErrExpectedWelcome, env.Metadata)
+	}
+	if prev != nil {
+		prev.Close()
+	}
+	keepalive := time.Duration(env.Payload.Session.KeepaliveTimeoutSeconds)*time.Second + KeepaliveSlack
+
+	c.mu.Lock()
+	c.conn = conn
+	c.sessionID = env.Payload.Session.ID
+	all := make([]string, 0, len(c.channels))
+	for ch := range c.channels {
+		all = append(all, ch)
+	}
+	c.mu.Unlock()
+	if c.isDone() {
+		return "", ErrDisconnected
+	}
+
+	if resubscribe {
+		c.subscribe(all)
+		if !c.welcomed && c.onConnect != nil {
+			c.onConnect()
+		}
+		c.welcomed = true
+	}
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(keepalive))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return "", errors.Wrap(err)
+		}
+		var env envelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			errors.WrapAndLog(err)
+			continue
+		}
+		switch env.Metadata.MessageType {
+		case TypeKeepalive:
+		case TypeNotification:
+			c.handleNotification(&env)
+		case TypeReconnect:
+			if env.Payload.Session != nil && env.Payload.Session.ReconnectURL != "" {
+				// do not close the connection, the next one will close it
+				keepOpen = true
+				return env.Payload.Session.ReconnectURL, nil
+			}
+		case TypeRevocation:
+			if sub := env.Payload.Subscription; sub != nil {
+				log.Printf("eventsub: subscription %s revoked: %s %v", sub.Type, sub.Status, sub.Condition)
+			}
+		}
+	}
+}
+
+func (c *Client) handleNotification(env *envelope) {
+	subType := env.Metadata.SubscriptionType
+	msg, err := parseEvent(subType, env.Metadata.MessageTimestamp, env.Payload.Event)
+	if err != nil {
+		errors.WrapAndLogWithContext(err, env.Metadata)
+		return
+	}
+	if msg == nil {
+		// an event of no interest, e.g. a channel.moderate other than a clear
+		return
+	}
+	if subType == SubClearUserMessages {
+		c.mu.Lock()
+		state, ok := c.channels[msg.Channel]
+		banAuthorized := ok && state.banAuthorized
+		c.mu.Unlock()
+		if banAuthorized {
+			// already received through channel.ban, with its duration
+			return
+		}
+	}
+	if c.onEvent != nil {
+		c.onEvent(msg)
+	}
+}
+
+// subscribe creates the subscriptions of the given channels in the current
+// session
+func (c *Client) subscribe(channels []string) {
+	if len(channels) == 0 {
+		return
+	}
+	// the events of the channels are lost until they are subscribed
+	ctx := helix.WithPriority(context.Background(), helix.PriorityHigh)
+	users, err := c.helix.Users(ctx, channels)
+	if err != nil {
+		errors.WrapAndLog(err)
+		return
+	}
+
+	c.mu.Lock()
+	sessionID := c.sessionID
+	c.mu.Unlock()
+	transport := helix.Transport{Method: "websocket", SessionID: sessionID}
+
+	for _, u := range users {
+		subs := []*helix.Subscription{
+			{Type: SubChatMessage, Version: "1", Transport: transport, Condition: map[string]string{
+				"broadcaster_user_id": u.ID,
+				"user_id":             c.userID,
+			}},
+			{Type: SubClearUserMessages, Version: "1", Transport: transport, Condition: map[string]string{
+				"broadcaster_user_id": u.ID,
+				"user_id":             c.userID,
+			}},
+			{Type: SubMessageDelete, Version: "1", Transport: transport, Condition: map[string]string{
+				"broadcaster_user_id": u.ID,
+				"user_id":             c.userID,
+			}},
+			{Type: SubBan, Version: "1", Transport: transport, Condition: map[string]string{
+				"broadcaster_user_id": u.ID,
+			}},
+			{Type: SubUnban, Version: "1", Transport: transport, Condition: map[string]string{
+				"broadcaster_user_id": u.ID,
+			}},
+			{Type: SubAutomodHold, Version: "1", Transport: transport, Condition: map[string]string{
+				"broadcaster_user_id": u.ID,
+				"moderator_user_id":   c.userID,
+			}},
+			{Type: SubAutomodUpdate, Version: "1", Transport: transport, Condition: map[string]string{
+				"broadcaster_user_id": u.ID,
+				"moderator_user_id":   c.userID,
+			}},
+			{Type: SubModerate, Version: "1", Transport: transport, Condition: map[string]string{
+				"broadcaster_user_id": u.ID,
+				"moderator_user_id":   c.userID,
+			}},
+			{Type: SubWarningSend, Version: "1", Transport: transport, Condition: map[string]string{
+				"broadcaster_user_id": u.ID,
+				"moderator_user_id":   c.userID,
+			}},
+		}
+		state := &channel{broadcasterID: u.ID}
+		// subs grows with the fallbacks of the forbidden subscriptions
+		for i := 0; i < len(subs); i++ {
+			sub := subs[i]
+			created, err := c.helix.CreateSubscription(ctx, sub)
+			if err != nil && isForbidden(err) {
+				if sub.Type == SubModerate {
+					log.Printf("eventsub: channel.moderate not authorized for #%s, chat clears will be stored with no moderator", u.Login)
+					subs = append(subs, &helix.Subscription{Type: SubChatClear, Version: "1", Transport: transport, Condition: map[string]string{
+						"broadcaster_user_id": u.ID,
+						"user_id":             c.userID,
+					}})
+					continue
+				}
+				if sub.Type == SubBan {
+					log.Printf("eventsub: channel.ban not authorized for #%s, bans and timeouts will be stored as user clears", u.Login)
+					continue
+				}
+				if sub.Type == SubUnban {
+					log.Printf("eventsub: channel.unban not authorized for #%s, its active bans will not be lifted", u.Login)
+					continue
+				}
+				if sub.Type == SubWarningSend {
+					log.Printf("eventsub: channel.warning.send not authorized for #%s, its warnings will not be stored", u.Login)
+					continue
+				}
+				if sub.Type == SubAutomodHold || sub.Type == SubAutomodUpdate {
+					// requires the account to be a moderator of the channel
+					log.Printf("eventsub: %s not authorized for #%s, AutoMod actions will not be stored", sub.Type, u.Login)
+					continue
+				}
+			}
+			if err != nil {
+				errors.WrapAndLogWithContext(err, struct {
+					Channel string
+					Type    string
+				}{u.Login, sub.Type})
+				continue
+			}
+			state.subIDs = append(state.subIDs, created.ID)
+			if sub.Type == SubBan {
+				state.banAuthorized = true
+			}
+		}
+
+		c.mu.Lock()
+		if _, ok := c.channels[u.Login]; ok {
+			c.channels[u.Login] = state
+		}
+		c.mu.Unlock()
+	}
+}
+
+// isForbidden returns whether err is helix refusing a subscription because the
+// account is not authorized to read its events
+func isForbidden(err error) bool {
+	var se *helix.StatusError
+	return errors.As(err, &se) && se.Code == http.StatusForbidden
+}
+
+func (c *Client) isDone() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Disconnect closes the connection and stops the client
+func (c *Client) Disconnect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.isDone() {
+		return ErrDisconnected
+	}
+	close(c.done)
+	if c.conn != nil {
+		return c.conn.Close()
+	}
+	return nil
+}
+
+// New creates an EventSub client that reads the chats as the twitch user
+// `login`, which must be the owner of the token used by the helix client
+func New(h *helix.Client, login string) *Client {
+	return &Client{
+		URL:      DefaultURL,
+		helix:    h,
+		login:    login,
+		channels: make(map[string]*channel),
+		done:     make(chan struct{}),
+	}
+}
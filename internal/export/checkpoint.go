@@ -0,0 +1,115 @@
+package export
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+// CheckpointFile is the file of the checkpoint of a bulk export, in the
+// metadata directory of the export
+const CheckpointFile = "checkpoint.json"
+
+var ErrCheckpointRange = errors.New("the checkpoint is of an export of other days, export again without resuming")
+
+// Checkpoint records the progress of a bulk export of the days From to To, the
+// last day of every channel whose partition was completely written. It is
+// saved after every completed partition, so an interrupted export resumes
+// from the day after. It is safe for concurrent use
+type Checkpoint struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	mu   sync.Mutex
+	path string
+	// Done is the last completed day of every channel, as YYYY-MM-DD
+	Done map[string]string `json:"done"`
+}
+
+// Next returns the first day of the channel left to export, after `to` if
+// every day was exported
+func (c *Checkpoint) Next(channel string, from time.Time) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last, ok := c.Done[channel]
+	if !ok {
+		return from
+	}
+	day, err := time.Parse(dayLayout, last)
+	if err != nil {
+		return from
+	}
+	return day.AddDate(0, 0, 1)
+}
+
+// Complete records that the partition of the channel and day was written and
+// saves the checkpoint
+func (c *Checkpoint) Complete(channel string, day time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Done[channel] = day.UTC().Format(dayLayout)
+	return c.save()
+}
+
+// save writes the checkpoint with a temporary name and renames it, so an
+// interruption never leaves it half-written
+func (c *Checkpoint) save() error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if err := os.WriteFile(c.path+".tmp", b, 0o644); err != nil {
+		return errors.Wrap(err)
+	}
+	if err := os.Rename(c.path+".tmp", c.path); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// NewCheckpoint starts the checkpoint of a bulk export of the days `from` to
+// `to` in `dir`, replacing any previous one
+func NewCheckpoint(dir string, from, to time.Time) (*Checkpoint, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "metadata"), 0o755); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	c := &Checkpoint{
+		From: from.UTC().Format(dayLayout),
+		To:   to.UTC().Format(dayLayout),
+		path: filepath.Join(dir, "metadata", CheckpointFile),
+		Done: make(map[string]string),
+	}
+	if err := c.save(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ResumeCheckpoint reads the checkpoint of the bulk export of the days `from`
+// to `to` in `dir`. It starts a new one if there is none, and returns
+// ErrCheckpointRange if it is of other days
+func ResumeCheckpoint(dir string, from, to time.Time) (*Checkpoint, error) {
+	path := filepath.Join(dir, "metadata", CheckpointFile)
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewCheckpoint(dir, from, to)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	c := &Checkpoint{path: path}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if c.From != from.UTC().Format(dayLayout) || c.To != to.UTC().Format(dayLayout) {
+		return nil, ErrCheckpointRange
+	}
+	if c.Done == nil {
+		c.Done = make(map[string]string)
+	}
+	return c, nil
+}
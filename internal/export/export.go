@@ -0,0 +1,205 @@
+// Package export writes the moderations as Parquet files partitioned by channel
+// and day (see PartitionSpec). Every column has the field id of the registered
+// schema (see Schemas), following the Iceberg conventions, but no Iceberg table
+// metadata nor manifests are written: the files are plain Parquet data files
+// that an external tool has to register to use them from an Iceberg table.
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/parquet"
+)
+
+const dayLayout = "2006-01-02"
+
+// BulkFile is the name of the file of a partition written at once, see
+// WritePartition
+const BulkFile = "bulk.parquet"
+
+type partition struct {
+	channel string
+	day     string
+}
+
+// Exporter buffers rows and writes them in micro-batches, a file per partition
+// and batch. It is safe for concurrent use.
+type Exporter struct {
+	dir       string
+	batchSize int
+
+	mu      sync.Mutex
+	pending map[partition][]*Row
+	n       int
+	seq     int
+}
+
+// Add buffers the row, writing the batch if it is full
+func (e *Exporter) Add(r *Row) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p := partition{r.Channel, r.At.UTC().Format(dayLayout)}
+	e.pending[p] = append(e.pending[p], r)
+	e.n++
+	if e.n >= e.batchSize {
+		return e.flush()
+	}
+	return nil
+}
+
+// Flush writes all the buffered rows
+func (e *Exporter) Flush() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.flush()
+}
+
+func (e *Exporter) flush() error {
+	if e.n == 0 {
+		return nil
+	}
+	// write in order so the files of a batch are sorted by name
+	parts := make([]partition, 0, len(e.pending))
+	for p := range e.pending {
+		parts = append(parts, p)
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		if parts[i].channel == parts[j].channel {
+			return parts[i].day < parts[j].day
+		}
+		return parts[i].channel < parts[j].channel
+	})
+	n := e.n
+	for _, p := range parts {
+		e.seq++
+		if err := e.writeFile(p, fmt.Sprintf("%d-%05d.parquet", time.Now().UnixNano(), e.seq), e.pending[p]); err != nil {
+			return err
+		}
+		e.n -= len(e.pending[p])
+		delete(e.pending, p)
+	}
+	log.Printf("exported %d moderations in %d files", n, len(parts))
+	return nil
+}
+
+// WritePartition writes every row of the channel in the day of `day` at once,
+// bypassing the buffer, in the file BulkFile of the partition. A later write
+// of the same partition replaces it, so exporting a day again never
+// duplicates its rows. Nothing is written if there are no rows
+func (e *Exporter) WritePartition(channel string, day time.Time, rows []*Row) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	return e.writeFile(partition{channel, day.UTC().Format(dayLayout)}, BulkFile, rows)
+}
+
+// writeFile writes the rows in the file `name` of the partition. The file is
+// written with a temporary name and renamed when complete, so readers never
+// see partial files
+func (e *Exporter) writeFile(p partition, name string, rows []*Row) error {
+	dir := filepath.Join(e.dir, "data",
+		"channel="+url.PathEscape(p.channel),
+		"at_day="+p.day)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return errors.Wrap(err)
+	}
+	name = filepath.Join(dir, name)
+
+	f, err := os.Create(name + ".tmp")
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	schema := CurrentSchema()
+	schemaJSON, err := json.Marshal(schema)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	w := parquet.NewWriter(f, schema.columns())
+	w.SetMetadata("iceberg.schema", string(schemaJSON))
+	row := make([]interface{}, len(schema.Fields))
+	for _, r := range rows {
+		for i, field := range schema.Fields {
+			row[i] = r.value(field)
+		}
+		if err := w.Write(row...); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err)
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// Start writes the buffered rows every `interval` until ctx is done. The rows
+// buffered when ctx is done are left for a final Flush
+func (e *Exporter) Start(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := e.Flush(); err != nil {
+				errors.WrapAndLog(err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// writeRegistry writes every schema and the partition spec in the metadata
+// directory of the export
+func writeRegistry(dir string) error {
+	dir = filepath.Join(dir, "metadata")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return errors.Wrap(err)
+	}
+	files := map[string]interface{}{"partition-spec.json": PartitionSpec}
+	for _, s := range Schemas {
+		files["schema-"+strconv.Itoa(s.ID)+".json"] = s
+	}
+	for name, v := range files {
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return errors.Wrap(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0o644); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// New creates an exporter writing to `dir`, flushing every `batchSize` rows.
+// The schema registry is written to the directory right away
+func New(dir string, batchSize int) (*Exporter, error) {
+	if err := writeRegistry(dir); err != nil {
+		return nil, err
+	}
+	return &Exporter{
+		dir:       dir,
+		batchSize: batchSize,
+		pending:   make(map[partition][]*Row),
+	}, nil
+}
@@ -0,0 +1,141 @@
+package export
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestSchemaEvolution checks the rules of the evolution of the schemas, so the
+// files written with an old schema are readable with the newest one
+func TestSchemaEvolution(t *testing.T) {
+	t.Parallel()
+	ids := make(map[int32]string)
+	for i, s := range Schemas {
+		if s.ID != i+1 {
+			t.Fatalf("schema %d has id %d", i, s.ID)
+		}
+		if i > 0 {
+			prev := Schemas[i-1]
+			if len(s.Fields) < len(prev.Fields) {
+				t.Fatalf("schema %d removes fields", s.ID)
+			}
+			for j, f := range prev.Fields {
+				if *s.Fields[j] != *f {
+					t.Fatalf("schema %d changes the field %s", s.ID, f.Name)
+				}
+			}
+			for _, f := range s.Fields[len(prev.Fields):] {
+				if f.Required {
+					t.Fatalf("schema %d adds the required field %s", s.ID, f.Name)
+				}
+			}
+		}
+		for _, f := range s.Fields {
+			if name, ok := ids[f.ID]; ok && name != f.Name {
+				t.Fatalf("field id %d reused by %s and %s", f.ID, name, f.Name)
+			}
+			ids[f.ID] = f.Name
+		}
+	}
+}
+
+func TestExporter(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	e, err := New(dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2022, 3, 4, 23, 59, 0, 0, time.UTC)
+	rows := []*Row{
+		{Channel: "foo", Username: "a", At: at, Type: "ban"},
+		{Channel: "foo", Username: "b", At: at.Add(time.Minute), Type: "timeout", Duration: 600},
+		{Channel: "bar", Username: "c", At: at},
+	}
+	for _, r := range rows {
+		if err := e.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, part := range []string{
+		"channel=foo/at_day=2022-03-04",
+		"channel=foo/at_day=2022-03-05",
+		"channel=bar/at_day=2022-03-04",
+	} {
+		files, err := filepath.Glob(filepath.Join(dir, "data", part, "*.parquet"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 1 {
+			t.Fatalf("expected a file in %s, got %d", part, len(files))
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "metadata", "schema-1.json")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWritePartition(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	e, err := New(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2022, 3, 4, 0, 0, 0, 0, time.UTC)
+	rows := []*Row{{Channel: "foo", Username: "a", At: day, Type: "ban"}}
+	// exporting a day again replaces its file
+	for i := 0; i < 2; i++ {
+		if err := e.WritePartition("foo", day, rows); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.WritePartition("foo", day.AddDate(0, 0, 1), nil); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "data", "channel=foo", "*", "*.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || filepath.Base(files[0]) != BulkFile {
+		t.Fatalf("got: %v, want: a single %s", files, BulkFile)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	from := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2022, 12, 31, 0, 0, 0, 0, time.UTC)
+	cp, err := NewCheckpoint(dir, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cp.Complete("foo", from.AddDate(0, 0, 9)); err != nil {
+		t.Fatal(err)
+	}
+
+	cp, err = ResumeCheckpoint(dir, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cp.Next("foo", from), from.AddDate(0, 0, 10); !got.Equal(want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+	if got := cp.Next("bar", from); !got.Equal(from) {
+		t.Errorf("got: %v, want: %v", got, from)
+	}
+	if _, err := ResumeCheckpoint(dir, from.AddDate(0, 1, 0), to); err != ErrCheckpointRange {
+		t.Errorf("got: %v, want: %v", err, ErrCheckpointRange)
+	}
+	// a new export starts over
+	if _, err := NewCheckpoint(dir, from, to); err != nil {
+		t.Fatal(err)
+	}
+	if cp, err = ResumeCheckpoint(dir, from, to); err != nil || !cp.Next("foo", from).Equal(from) {
+		t.Errorf("got: %v, %v, want: a new checkpoint", cp, err)
+	}
+}
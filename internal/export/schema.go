@@ -0,0 +1,145 @@
+package export
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/parquet"
+)
+
+// Iceberg primitive types used by the schemas
+const (
+	TypeString      = "string"
+	TypeInt         = "int"
+	TypeDouble      = "double"
+	TypeTimestampTZ = "timestamptz"
+)
+
+// Field of an Iceberg schema
+type Field struct {
+	ID       int32  `json:"id"`
+	Name     string `json:"name"`
+	Required bool   `json:"required"`
+	Type     string `json:"type"`
+	Doc      string `json:"doc,omitempty"`
+}
+
+// Schema is an Iceberg schema, serialized as in the Iceberg table metadata
+type Schema struct {
+	Type   string   `json:"type"`
+	ID     int      `json:"schema-id"`
+	Fields []*Field `json:"fields"`
+}
+
+// Schemas is the registry of every version of the schema of the exported
+// moderations, oldest first. Schemas only evolve by appending optional fields
+// with new ids. Ids are never reused and fields are never renamed nor removed,
+// so the files written with any version are readable with the latest one.
+var Schemas = []*Schema{
+	{
+		Type: "struct",
+		ID:   1,
+		Fields: []*Field{
+			{ID: 1, Name: "channel", Required: true, Type: TypeString},
+			{ID: 2, Name: "username", Required: true, Type: TypeString},
+			{ID: 3, Name: "at", Required: true, Type: TypeTimestampTZ},
+			{ID: 4, Name: "type", Type: TypeString, Doc: "ban, timeout or deletion. Null if unknown"},
+			{ID: 5, Name: "duration", Type: TypeInt, Doc: "timeout duration in seconds"},
+			{ID: 6, Name: "messages", Type: TypeString, Doc: "JSON array with the messages of the user before the moderation"},
+			{ID: 7, Name: "sub", Type: TypeInt},
+			{ID: 8, Name: "toxicity", Type: TypeDouble},
+		},
+	},
+}
+
+// CurrentSchema returns the latest schema, the one used to write new files
+func CurrentSchema() *Schema {
+	return Schemas[len(Schemas)-1]
+}
+
+// PartitionField of an Iceberg partition spec
+type PartitionField struct {
+	Name      string `json:"name"`
+	Transform string `json:"transform"`
+	SourceID  int32  `json:"source-id"`
+	FieldID   int32  `json:"field-id"`
+}
+
+// PartitionSpec of the exported moderations, by channel and day
+var PartitionSpec = struct {
+	ID     int               `json:"spec-id"`
+	Fields []*PartitionField `json:"fields"`
+}{
+	ID: 0,
+	Fields: []*PartitionField{
+		{Name: "channel", Transform: "identity", SourceID: 1, FieldID: 1000},
+		{Name: "at_day", Transform: "day", SourceID: 3, FieldID: 1001},
+	},
+}
+
+// Row is an exported moderation
+type Row struct {
+	Channel  string
+	Username string
+	At       time.Time
+	// Type is empty if unknown
+	Type string
+	// Duration is 0 if not a timeout
+	Duration int
+	Messages []string
+	Sub      int
+	Toxicity *float64
+}
+
+// value returns the value of the field in the row, or nil if null
+func (r *Row) value(f *Field) interface{} {
+	switch f.Name {
+	case "channel":
+		return r.Channel
+	case "username":
+		return r.Username
+	case "at":
+		return r.At
+	case "type":
+		if r.Type == "" {
+			return nil
+		}
+		return r.Type
+	case "duration":
+		if r.Duration == 0 {
+			return nil
+		}
+		return int32(r.Duration)
+	case "messages":
+		b, _ := json.Marshal(r.Messages)
+		return string(b)
+	case "sub":
+		return int32(r.Sub)
+	case "toxicity":
+		if r.Toxicity == nil {
+			return nil
+		}
+		return *r.Toxicity
+	}
+	return nil
+}
+
+// columns returns the parquet columns of the schema
+func (s *Schema) columns() []parquet.Column {
+	cols := make([]parquet.Column, len(s.Fields))
+	for i, f := range s.Fields {
+		col := parquet.Column{Name: f.Name, FieldID: f.ID, Optional: !f.Required}
+		switch f.Type {
+		case TypeString:
+			col.Type, col.Logical = parquet.ByteArray, parquet.String
+		case TypeInt:
+			col.Type = parquet.Int32
+		case TypeDouble:
+			col.Type = parquet.Double
+		case TypeTimestampTZ:
+			col.Type, col.Logical = parquet.Int64, parquet.TimestampMicros
+		}
+		cols[i] = col
+	}
+	return cols
+}
@@ -0,0 +1,219 @@
+// Package fixtures records a sample of the events received live, once parsed,
+// into a file of JSON lines that can be shared and committed along the tests:
+// the bodies of the chat messages and the reasons of the moderations are
+// hashed or replaced with synthetic ones of the same shape, and the users are
+// replaced with pseudonyms. The files are read back with Load, so the oddities
+// seen in production become regression tests.
+package fixtures
+
+import (
+	"bufio"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// How the bodies are sanitized, see Recorder
+const (
+	// BodiesHash replaces the bodies with their keyed hash, prefixed with
+	// HashPrefix. Equal bodies have equal hashes in the same file
+	BodiesHash = "hash"
+	// BodiesSynthetic replaces the letters of the bodies with x or X and the
+	// digits with 0, keeping the rest, so the length, the caps and the
+	// punctuation of the bodies are kept
+	BodiesSynthetic = "synthetic"
+)
+
+// HashPrefix is prepended to the hashed bodies
+const HashPrefix = "hash:"
+
+// MaxLine is the size of the longest event read by Read
+const MaxLine = 1 << 20
+
+var ErrBodies = errors.New("unknown fixtures bodies, it must be hash or synthetic")
+
+// Recorder writes the sanitized events to a file. Every event is recorded but
+// the chat messages, which are sampled. It is safe for concurrent use
+type Recorder struct {
+	rate   float64
+	bodies string
+	// key is the key of the hashes of the bodies and the pseudonyms of the
+	// users. It is random for every recorder, so the users and the bodies are
+	// still told apart in a file without being guessed
+	key []byte
+
+	mu   sync.Mutex
+	rand *rand.Rand
+	f    *os.File
+}
+
+// Record appends the event sanitized, unless it is a chat message left out of
+// the sample
+func (r *Recorder) Record(msg *message.Message) error {
+	if msg.Type == message.MessagePrivmsg && !r.take() {
+		return nil
+	}
+	b, err := json.Marshal(r.sanitize(msg))
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return os.ErrClosed
+	}
+	if _, err := r.f.Write(append(b, '\n')); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// take reports whether a chat message is sampled
+func (r *Recorder) take() bool {
+	if r.rate <= 0 {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rand.Float64() < r.rate
+}
+
+// sanitize returns a copy of the event without its bodies, reasons and users.
+// The channels are kept, they are public
+func (r *Recorder) sanitize(msg *message.Message) *message.Message {
+	s := *msg
+	s.Username = r.pseudonym(msg.Username)
+	s.UserID = r.pseudonym(msg.UserID)
+	s.Moderator = r.pseudonym(msg.Moderator)
+	s.Reason = r.body(msg.Reason)
+	s.Compressed = nil
+	s.LastMessages = make([]*message.PrivateMessage, len(msg.LastMessages))
+	for i, pm := range msg.LastMessages {
+		spm := *pm
+		spm.Username = r.pseudonym(pm.Username)
+		spm.UserID = r.pseudonym(pm.UserID)
+		spm.Body = r.body(pm.Body)
+		s.LastMessages[i] = &spm
+	}
+	return &s
+}
+
+func (r *Recorder) hash(s string) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// pseudonym returns the same pseudonym for the same user, whatever the case of
+// the login
+func (r *Recorder) pseudonym(user string) string {
+	if user == "" {
+		return ""
+	}
+	return "user_" + r.hash(strings.ToLower(user))
+}
+
+func (r *Recorder) body(body string) string {
+	if body == "" {
+		return ""
+	}
+	if r.bodies == BodiesSynthetic {
+		return Synthetic(body)
+	}
+	return HashPrefix + r.hash(body)
+}
+
+// Synthetic returns a body of the same shape as `body`, see BodiesSynthetic
+func Synthetic(body string) string {
+	return strings.Map(func(c rune) rune {
+		switch {
+		case unicode.IsDigit(c):
+			return '0'
+		case unicode.IsUpper(c):
+			return 'X'
+		case unicode.IsLetter(c):
+			return 'x'
+		}
+		return c
+	}, body)
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// Open opens the file at `path` to append the events, with a fraction `rate`
+// of the chat messages and the bodies sanitized as `bodies`
+func Open(path string, rate float64, bodies string) (*Recorder, error) {
+	if bodies != BodiesHash && bodies != BodiesSynthetic {
+		return nil, ErrBodies
+	}
+	key := make([]byte, 32)
+	if _, err := crand.Read(key); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return &Recorder{
+		rate:   rate,
+		bodies: bodies,
+		key:    key,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		f:      f,
+	}, nil
+}
+
+// Read returns the events recorded in `rd`, in the order they were received
+func Read(rd io.Reader) ([]*message.Message, error) {
+	var all []*message.Message
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(nil, MaxLine)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		msg := new(message.Message)
+		if err := json.Unmarshal(scanner.Bytes(), msg); err != nil {
+			return nil, errors.WrapWithContext(err, struct{ Event int }{len(all) + 1})
+		}
+		all = append(all, msg)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return all, nil
+}
+
+// Load returns the events recorded in the file at `path`, see Read
+func Load(path string) ([]*message.Message, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	defer f.Close()
+	return Read(f)
+}
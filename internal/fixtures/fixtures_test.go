@@ -0,0 +1,84 @@
+package fixtures
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestSynthetic(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		body string
+		want string
+	}{
+		{body: "hello World", want: "xxxxx Xxxxx"},
+		{body: "FREE v1bux at bit.ly/x!", want: "XXXX x0xxx xx xxx.xx/x!"},
+		{body: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := Synthetic(tt.body); got != tt.want {
+			t.Errorf("got: %q, want: %q", got, tt.want)
+		}
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	t.Parallel()
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name   string
+		bodies string
+		want   string
+	}{
+		{name: "hashed", bodies: BodiesHash},
+		{name: "synthetic", bodies: BodiesSynthetic, want: "xxxxx"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), "fixtures.jsonl")
+			// no chat messages are sampled, the moderations are always recorded
+			r, err := Open(path, 0, tt.bodies)
+			if err != nil {
+				t.Fatal(err)
+			}
+			events := []*message.Message{
+				{Type: message.MessagePrivmsg, Channel: "channel", Username: "user", LastMessages: []*message.PrivateMessage{{Username: "user", Body: "hello"}}, At: at},
+				{Type: message.MessageBan, Channel: "channel", Username: "User", Moderator: "mod", LastMessages: []*message.PrivateMessage{{Username: "user", Body: "hello"}, {Username: "user", Body: "hello"}}, At: at},
+			}
+			for _, msg := range events {
+				if err := r.Record(msg); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r.Close()
+
+			got, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 {
+				t.Fatalf("got: %v events, want: %v", len(got), 1)
+			}
+			ban := got[0]
+			if ban.Type != message.MessageBan || ban.Channel != "channel" || !ban.At.Equal(at) {
+				t.Errorf("got: %+v, want the ban", ban)
+			}
+			if ban.Username == "User" || ban.Username != ban.LastMessages[0].Username || ban.Moderator == ban.Username {
+				t.Errorf("got: %q %q %q, want the pseudonyms of the user and the moderator", ban.Username, ban.LastMessages[0].Username, ban.Moderator)
+			}
+			body := ban.LastMessages[0].Body
+			if tt.want != "" && body != tt.want {
+				t.Errorf("got: %q, want: %q", body, tt.want)
+			}
+			if tt.want == "" && (!strings.HasPrefix(body, HashPrefix) || body != ban.LastMessages[1].Body) {
+				t.Errorf("got: %q and %q, want the same hash", body, ban.LastMessages[1].Body)
+			}
+		})
+	}
+}
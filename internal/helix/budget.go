@@ -0,0 +1,84 @@
+package helix
+
+import (
+	"context"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+// Priority is the tier of a request in the rate limit budget. Every request
+// spends a point of the bucket of the token, but the lower tiers leave some
+// points to the higher ones. See WithPriority
+type Priority int
+
+const (
+	// PriorityLow is for the background enrichments, e.g. the account ages
+	PriorityLow Priority = iota
+	// PriorityNormal is the priority of the requests without one
+	PriorityNormal
+	// PriorityHigh is for the requests the ingestion waits for, e.g. the
+	// EventSub subscriptions
+	PriorityHigh
+)
+
+const (
+	// LowPriorityReserve and NormalPriorityReserve are the points of the bucket
+	// the requests of these tiers leave to the higher ones, waiting for the
+	// bucket to be refilled instead
+	LowPriorityReserve    = 200
+	NormalPriorityReserve = 50
+)
+
+type priorityKey struct{}
+
+// WithPriority returns a copy of ctx whose requests have the priority p
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// priorityOf returns the priority of the requests of ctx, PriorityNormal by
+// default
+func priorityOf(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return PriorityNormal
+}
+
+// reserve returns the points left to the tiers above p
+func (p Priority) reserve() int {
+	switch p {
+	case PriorityLow:
+		return LowPriorityReserve
+	case PriorityNormal:
+		return NormalPriorityReserve
+	default:
+		return 0
+	}
+}
+
+// wait blocks until the bucket has points for the priority of ctx, and spends
+// one. The points are known from the headers of the last response, so the
+// first requests never wait
+func (c *Client) wait(ctx context.Context) error {
+	reserve := priorityOf(ctx).reserve()
+	for {
+		c.mu.Lock()
+		if c.reset.IsZero() || c.remaining > reserve || !time.Now().Before(c.reset) {
+			c.remaining--
+			c.mu.Unlock()
+			return nil
+		}
+		d := time.Until(c.reset)
+		c.mu.Unlock()
+
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return errors.Wrap(ctx.Err())
+		}
+	}
+}
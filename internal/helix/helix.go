@@ -0,0 +1,251 @@
+package helix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+const (
+	BaseURL = "https://api.twitch.tv/helix"
+	// Maximum number of logins or ids per Users call
+	MaxUsersPerRequest = 100
+	RequestTimeout     = 10 * time.Second
+)
+
+var ErrUnexpectedStatus = errors.New("unexpected status code from helix")
+
+// Client is a minimal client of the twitch Helix API, implementing only the
+// endpoints needed by the tracker.
+//
+// It manages the rate limit budget of the token, so every feature of the
+// tracker should share the same client: when the points of the bucket run out,
+// requests wait until the bucket is refilled, and the requests of the lower
+// priorities wait before to leave some points to the higher ones. See
+// WithPriority. The lookups of users by concurrent callers are merged into the
+// same requests, and the users looked up by login are cached.
+type Client struct {
+	BaseURL  string
+	clientID string
+	token    string
+	http     *http.Client
+	cache    *userCache
+
+	// mu protects the state of the rate limit, from the headers of the last
+	// response, and the store
+	mu        sync.Mutex
+	remaining int
+	reset     time.Time
+	store     Cache
+
+	// batchMu protects the batches open to new lookups by param
+	batchMu sync.Mutex
+	batches map[string]*userBatch
+}
+
+type User struct {
+	ID          string    `json:"id"`
+	Login       string    `json:"login"`
+	DisplayName string    `json:"display_name"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Transport of an EventSub subscription
+type Transport struct {
+	Method    string `json:"method"`
+	SessionID string `json:"session_id,omitempty"`
+}
+
+type Subscription struct {
+	ID        string            `json:"id,omitempty"`
+	Status    string            `json:"status,omitempty"`
+	Type      string            `json:"type"`
+	Version   string            `json:"version"`
+	Condition map[string]string `json:"condition"`
+	Transport Transport         `json:"transport"`
+}
+
+// StatusError is returned when helix responds with an unexpected status code
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: %d %s", ErrUnexpectedStatus.Error(), e.Code, e.Body)
+}
+
+func (e *StatusError) Unwrap() error {
+	return ErrUnexpectedStatus
+}
+
+// do sends a request to the helix `endpoint` and decodes the response in `dst`,
+// if not nil.
+func (c *Client) do(ctx context.Context, method, endpoint string, body interface{}, dst interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return errors.Wrap(err)
+		}
+		r = bytes.NewReader(b)
+	}
+
+	if err := c.wait(ctx); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+endpoint, r)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	req.Header.Set("Client-Id", c.clientID)
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	defer res.Body.Close()
+	c.limit(res)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return &StatusError{Code: res.StatusCode, Body: string(b)}
+	}
+	if dst == nil {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(dst); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// limit updates the state of the rate limit from the headers of a response
+func (c *Client) limit(res *http.Response) {
+	remaining, err := strconv.Atoi(res.Header.Get("Ratelimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(res.Header.Get("Ratelimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	c.remaining = remaining
+	c.reset = time.Unix(reset, 0)
+	c.mu.Unlock()
+}
+
+// Users returns the users with the given logins. Logins that don't exist are
+// omitted from the result. The users are cached for UsersCacheTTL
+func (c *Client) Users(ctx context.Context, logins []string) ([]*User, error) {
+	users, missing := c.cachedUsers(logins)
+	if len(missing) == 0 {
+		return users, nil
+	}
+	fetched, err := c.fetchUsers(ctx, "login", missing)
+	if err != nil {
+		return nil, err
+	}
+	c.cacheUsers(fetched)
+	return append(users, fetched...), nil
+}
+
+// UsersByID returns the users with the given ids. Ids of users that don't exist
+// anymore, e.g. suspended users, are omitted from the result. They are always
+// looked up from helix, as they are used to find the current login of the ids
+func (c *Client) UsersByID(ctx context.Context, ids []string) ([]*User, error) {
+	users, err := c.fetchUsers(ctx, "id", ids)
+	if err != nil {
+		return nil, err
+	}
+	c.cacheUsers(users)
+	return users, nil
+}
+
+// TeamMembers returns the logins of the members of the team `name`
+func (c *Client) TeamMembers(ctx context.Context, name string) ([]string, error) {
+	var res struct {
+		Data []struct {
+			Users []struct {
+				UserLogin string `json:"user_login"`
+			} `json:"users"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/teams?name="+url.QueryEscape(name), nil, &res); err != nil {
+		return nil, err
+	}
+	if len(res.Data) == 0 {
+		return nil, nil
+	}
+	logins := make([]string, len(res.Data[0].Users))
+	for i, u := range res.Data[0].Users {
+		logins[i] = u.UserLogin
+	}
+	return logins, nil
+}
+
+// FollowedAt returns when the user started following the broadcaster, nil if
+// the user doesn't follow it. It requires a token of a moderator of the channel
+func (c *Client) FollowedAt(ctx context.Context, broadcasterID, userID string) (*time.Time, error) {
+	q := url.Values{}
+	q.Set("broadcaster_id", broadcasterID)
+	q.Set("user_id", userID)
+	var res struct {
+		Data []struct {
+			FollowedAt time.Time `json:"followed_at"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/channels/followers?"+q.Encode(), nil, &res); err != nil {
+		return nil, err
+	}
+	if len(res.Data) == 0 {
+		return nil, nil
+	}
+	return &res.Data[0].FollowedAt, nil
+}
+
+// CreateSubscription creates an EventSub subscription and returns it with its
+// ID and status
+func (c *Client) CreateSubscription(ctx context.Context, sub *Subscription) (*Subscription, error) {
+	var res struct {
+		Data []*Subscription `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/eventsub/subscriptions", sub, &res); err != nil {
+		return nil, err
+	}
+	if len(res.Data) == 0 {
+		return nil, errors.Wrap(ErrUnexpectedStatus)
+	}
+	return res.Data[0], nil
+}
+
+// DeleteSubscription deletes the EventSub subscription with the given id
+func (c *Client) DeleteSubscription(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/eventsub/subscriptions?id="+url.QueryEscape(id), nil, nil)
+}
+
+func New(clientID, token string) *Client {
+	return &Client{
+		BaseURL:  BaseURL,
+		clientID: clientID,
+		token:    token,
+		http:     &http.Client{},
+		cache:    &userCache{users: make(map[string]cachedUser)},
+		batches:  make(map[string]*userBatch),
+	}
+}
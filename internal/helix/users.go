@@ -0,0 +1,254 @@
+package helix
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+const (
+	// BatchWindow is how long a lookup of users waits for the lookups of other
+	// callers to be sent in the same request, unless it has PriorityHigh
+	BatchWindow = 50 * time.Millisecond
+	// UsersCacheTTL is how long the users looked up by login are cached, in
+	// memory and in the Cache
+	UsersCacheTTL = 24 * time.Hour
+	// UsersCacheSize is the number of users cached in memory
+	UsersCacheSize = 10000
+)
+
+// Cache persists the users looked up by login, so they are not looked up again
+// after a restart. Its entries should expire after UsersCacheTTL. See SetCache
+type Cache interface {
+	// CachedUsers returns the cached users of the logins, omitting the missing
+	// ones
+	CachedUsers(logins []string) ([]*User, error)
+	CacheUsers(users []*User) error
+}
+
+type cachedUser struct {
+	user *User
+	at   time.Time
+}
+
+// userCache keeps in memory the users by login. It is safe for concurrent use
+type userCache struct {
+	mu    sync.Mutex
+	users map[string]cachedUser
+}
+
+func (c *userCache) get(login string) (*User, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cu, ok := c.users[login]
+	if !ok || time.Since(cu.at) > UsersCacheTTL {
+		return nil, false
+	}
+	return cu.user, true
+}
+
+func (c *userCache) add(users []*User) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for _, u := range users {
+		if len(c.users) >= UsersCacheSize {
+			c.evict(now)
+		}
+		c.users[strings.ToLower(u.Login)] = cachedUser{u, now}
+	}
+}
+
+// evict removes the expired users, or any user if none expired
+func (c *userCache) evict(now time.Time) {
+	for login, cu := range c.users {
+		if now.Sub(cu.at) > UsersCacheTTL {
+			delete(c.users, login)
+		}
+	}
+	if len(c.users) < UsersCacheSize {
+		return
+	}
+	for login := range c.users {
+		delete(c.users, login)
+		return
+	}
+}
+
+// SetCache persists the users looked up by login in `cache`
+func (c *Client) SetCache(cache Cache) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store = cache
+}
+
+// cachedUsers returns the cached users of the logins, and the logins that are
+// not cached
+func (c *Client) cachedUsers(logins []string) ([]*User, []string) {
+	var (
+		found   []*User
+		missing []string
+	)
+	for _, login := range logins {
+		if u, ok := c.cache.get(strings.ToLower(login)); ok {
+			found = append(found, u)
+		} else {
+			missing = append(missing, login)
+		}
+	}
+	c.mu.Lock()
+	store := c.store
+	c.mu.Unlock()
+	if store == nil || len(missing) == 0 {
+		return found, missing
+	}
+	stored, err := store.CachedUsers(missing)
+	if err != nil {
+		// looked up from helix instead
+		errors.WrapAndLog(err)
+		return found, missing
+	}
+	c.cache.add(stored)
+	hit := make(map[string]bool, len(stored))
+	for _, u := range stored {
+		hit[strings.ToLower(u.Login)] = true
+	}
+	found = append(found, stored...)
+	var still []string
+	for _, login := range missing {
+		if !hit[strings.ToLower(login)] {
+			still = append(still, login)
+		}
+	}
+	return found, still
+}
+
+// cacheUsers caches the users looked up from helix
+func (c *Client) cacheUsers(users []*User) {
+	if len(users) == 0 {
+		return
+	}
+	c.cache.add(users)
+	c.mu.Lock()
+	store := c.store
+	c.mu.Unlock()
+	if store == nil {
+		return
+	}
+	if err := store.CacheUsers(users); err != nil {
+		errors.WrapAndLog(err)
+	}
+}
+
+// userBatch is a request of users shared by the lookups of several callers
+type userBatch struct {
+	param    string
+	values   []string
+	priority Priority
+	timer    *time.Timer
+	// done is closed once users and err are set
+	done  chan struct{}
+	users []*User
+	err   error
+}
+
+// join adds the values to the open batches of `param`, opening new ones as
+// they fill up, and returns the batches joined
+func (c *Client) join(param string, values []string, p Priority) []*userBatch {
+	c.batchMu.Lock()
+	defer c.batchMu.Unlock()
+	var joined []*userBatch
+	for _, v := range values {
+		b, ok := c.batches[param]
+		if !ok {
+			b = &userBatch{param: param, done: make(chan struct{})}
+			c.batches[param] = b
+			b.timer = time.AfterFunc(BatchWindow, func() { c.flush(b) })
+		}
+		b.values = append(b.values, v)
+		if p > b.priority {
+			b.priority = p
+		}
+		if len(joined) == 0 || joined[len(joined)-1] != b {
+			joined = append(joined, b)
+		}
+		if len(b.values) == MaxUsersPerRequest {
+			c.close(b)
+		}
+	}
+	if b, ok := c.batches[param]; ok && p == PriorityHigh {
+		c.close(b)
+	}
+	return joined
+}
+
+// close sends the batch right away unless its window is already over. It must
+// be called with batchMu held
+func (c *Client) close(b *userBatch) {
+	delete(c.batches, b.param)
+	if b.timer.Stop() {
+		go c.send(b)
+	}
+}
+
+// flush sends the batch once its window is over
+func (c *Client) flush(b *userBatch) {
+	c.batchMu.Lock()
+	if c.batches[b.param] == b {
+		delete(c.batches, b.param)
+	}
+	c.batchMu.Unlock()
+	c.send(b)
+}
+
+func (c *Client) send(b *userBatch) {
+	defer close(b.done)
+	q := url.Values{}
+	for _, v := range b.values {
+		q.Add(b.param, v)
+	}
+	var res struct {
+		Data []*User `json:"data"`
+	}
+	ctx := WithPriority(context.Background(), b.priority)
+	if b.err = c.do(ctx, http.MethodGet, "/users?"+q.Encode(), nil, &res); b.err == nil {
+		b.users = res.Data
+	}
+}
+
+// fetchUsers looks up the users whose `param` is one of `values` from helix,
+// in the same requests as the lookups of other callers within BatchWindow
+func (c *Client) fetchUsers(ctx context.Context, param string, values []string) ([]*User, error) {
+	want := make(map[string]bool, len(values))
+	for _, v := range values {
+		want[strings.ToLower(v)] = true
+	}
+	var users []*User
+	for _, b := range c.join(param, values, priorityOf(ctx)) {
+		select {
+		case <-b.done:
+		case <-ctx.Done():
+			return nil, errors.Wrap(ctx.Err())
+		}
+		if b.err != nil {
+			return nil, b.err
+		}
+		// the batch has the users of the other callers too
+		for _, u := range b.users {
+			key := strings.ToLower(u.ID)
+			if param == "login" {
+				key = strings.ToLower(u.Login)
+			}
+			if want[key] {
+				want[key] = false
+				users = append(users, u)
+			}
+		}
+	}
+	return users, nil
+}
@@ -0,0 +1,92 @@
+package helix
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUsersBatched(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		var res struct {
+			Data []*User `json:"data"`
+		}
+		for _, login := range r.URL.Query()["login"] {
+			res.Data = append(res.Data, &User{ID: "id-" + login, Login: login})
+		}
+		json.NewEncoder(w).Encode(res)
+	}))
+	defer srv.Close()
+	c := New("id", "token")
+	c.BaseURL = srv.URL
+
+	var wg sync.WaitGroup
+	for _, logins := range [][]string{{"a", "b"}, {"b", "c"}, {"d"}} {
+		logins := logins
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			users, err := c.Users(context.Background(), logins)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			got := make([]string, len(users))
+			for i, u := range users {
+				got[i] = u.Login
+			}
+			sort.Strings(got)
+			if len(got) != len(logins) || got[0] != logins[0] {
+				t.Errorf("got: %v, want: %v", got, logins)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("requests got: %d, want: %d", got, 1)
+	}
+
+	// cached
+	if _, err := c.Users(context.Background(), []string{"A", "d"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("requests got: %d, want: %d", got, 1)
+	}
+}
+
+func TestPriorityReserve(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		priority  Priority
+		remaining int
+		wait      bool
+	}{
+		{PriorityHigh, 1, false},
+		{PriorityNormal, NormalPriorityReserve + 1, false},
+		{PriorityNormal, NormalPriorityReserve, true},
+		{PriorityLow, NormalPriorityReserve + 1, true},
+		{PriorityLow, LowPriorityReserve + 1, false},
+	}
+	for _, tt := range tests {
+		c := New("id", "token")
+		c.remaining = tt.remaining
+		c.reset = time.Now().Add(time.Hour)
+		ctx, cancel := context.WithCancel(WithPriority(context.Background(), tt.priority))
+		// a canceled wait fails right away instead of waiting for the reset
+		cancel()
+		waited := c.wait(ctx) != nil
+		if waited != tt.wait {
+			t.Errorf("priority %d with %d points waited got: %v, want: %v", tt.priority, tt.remaining, waited, tt.wait)
+		}
+	}
+}
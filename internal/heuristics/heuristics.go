@@ -1,6 +1,7 @@
 package heuristics
 
 import (
+	"reflect"
 	"time"
 
 	"github.com/hammertrack/tracker/internal/message"
@@ -13,6 +14,19 @@ type Traits struct {
 	ModeratedAt     time.Time
 	TimeoutDuration int
 	IsMostRecentMsg bool
+	// ThirdPartyEmotes is the number of BTTV/FFZ/7TV emotes in Body. It is
+	// always 0 if the emotes are not enabled
+	ThirdPartyEmotes int
+	// Toxicity is the score of Body given by the scorer, from 0 to 1. Only the
+	// most recent message is scored, so it is only valid if Scored is true
+	Toxicity float64
+	Scored   bool
+	// Badges are the badges of the author of Body, e.g. "vip". See
+	// message.PrivateMessage.Badges
+	Badges []string
+	// Flood is the estimated number of messages of the user shortly before the
+	// moderation. See message.Message.Flood
+	Flood int
 }
 
 type Rule interface {
@@ -56,21 +70,73 @@ func (a *Analyzer) Compile() {
 // IsCompliant requires rules to be compiled before with `Compile()` or it may
 // throw a nil pointer derefence error
 func (a *Analyzer) IsCompliant(target Traits) bool {
+	return a.Violation(target) == nil
+}
+
+// Violation returns the first rule the `target` traits are not compliant with,
+// or nil if they are compliant. See IsCompliant
+func (a *Analyzer) Violation(target Traits) Rule {
+	return a.violation(target, nil)
+}
+
+func (a *Analyzer) violation(target Traits, m *Memo) Rule {
 	for _, rule := range a.rules {
-		v := rule.IsCompliant(target)
+		v := m.isCompliant(rule, target)
 		if rule.Final() {
 			if v {
 				// target is compliant with a final rule, ignore the rest
-				return true
+				return nil
 			}
 			// target is not compliant with a final rule, ignore the rule
 			continue
 		}
 		if !v {
-			return false
+			return rule
+		}
+	}
+	return nil
+}
+
+// MaxVerdicts is the number of rules whose verdicts fit in the bitmap of
+// Verdicts
+const MaxVerdicts = 64
+
+// Verdicts runs every rule against the `target` traits, unlike Violation, and
+// returns the bitmap of their verdicts: the bit i is set if the rule i returned
+// false, final rules included. Only the first MaxVerdicts rules are run
+func (a *Analyzer) Verdicts(target Traits) uint64 {
+	return a.verdicts(target, nil)
+}
+
+func (a *Analyzer) verdicts(target Traits, m *Memo) uint64 {
+	var bitmap uint64
+	for i, rule := range a.rules {
+		if i == MaxVerdicts {
+			break
+		}
+		if !m.isCompliant(rule, target) {
+			bitmap |= 1 << i
 		}
 	}
-	return true
+	return bitmap
+}
+
+// RuleNames returns the names of the rules in order, see RuleName
+func (a *Analyzer) RuleNames() []string {
+	names := make([]string, len(a.rules))
+	for i, rule := range a.rules {
+		names[i] = RuleName(rule)
+	}
+	return names
+}
+
+// RuleName returns the name of the type of the rule, e.g. "NoLinks"
+func RuleName(r Rule) string {
+	t := reflect.TypeOf(r)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Name()
 }
 
 func New(rules []Rule) *Analyzer {
@@ -58,6 +58,43 @@ func TestAnalyzer(t *testing.T) {
 	}
 }
 
+func TestViolation(t *testing.T) {
+	t.Parallel()
+	a := New([]Rule{RuleAlwaysStoreBans(), RuleNoLinks(), RuleMinTimeoutDuration(5)})
+	a.Compile()
+
+	if r := a.Violation(Traits{Type: message.MessageBan, Body: "https://example.com"}); r != nil {
+		t.Fatalf("got %s, want nil", RuleName(r))
+	}
+	if r := a.Violation(Traits{Type: message.MessageTimeout, Body: "hola", TimeoutDuration: 1}); r == nil || RuleName(r) != "MinTimeoutDuration" {
+		t.Fatalf("got %v, want MinTimeoutDuration", r)
+	}
+}
+
+func TestVerdicts(t *testing.T) {
+	t.Parallel()
+	a := New([]Rule{RuleAlwaysStoreBans(), RuleNoLinks(), RuleMinTimeoutDuration(5)})
+	a.Compile()
+
+	tests := []struct {
+		traits Traits
+		want   uint64
+	}{
+		{traits: Traits{Type: message.MessageBan, Body: "https://example.com"}, want: 0b010},
+		{traits: Traits{Type: message.MessageTimeout, Body: "https://example.com", TimeoutDuration: 1}, want: 0b111},
+		{traits: Traits{Type: message.MessageTimeout, Body: "hola", TimeoutDuration: 10}, want: 0b001},
+	}
+	for _, tt := range tests {
+		if got := a.Verdicts(tt.traits); got != tt.want {
+			t.Errorf("got: %03b, want: %03b", got, tt.want)
+		}
+	}
+	names := a.RuleNames()
+	if len(names) != 3 || names[1] != "NoLinks" {
+		t.Errorf("got: %v, want the names of the 3 rules", names)
+	}
+}
+
 func TestFinalRules(t *testing.T) {
 	t.Parallel()
 
@@ -98,6 +135,12 @@ func TestFinalRules(t *testing.T) {
 			rules:  []Rule{RuleAlwaysStoreBans(), RuleNoLinks()},
 			want:   true,
 		},
+		{
+			desc:   "Final=true;automod",
+			traits: Traits{Type: message.MessageAutomod, Body: "https://example.com", IsMostRecentMsg: true},
+			rules:  []Rule{RuleAlwaysStoreBans(), RuleAlwaysStoreAutomod(), RuleNoLinks(), RuleOnlyHumanModerations(.9)},
+			want:   true,
+		},
 	}
 
 	for _, test := range tests {
@@ -113,3 +156,96 @@ func TestFinalRules(t *testing.T) {
 		})
 	}
 }
+
+// bodyRuleTest counts the bodies it evaluates
+type bodyRuleTest struct {
+	calls int
+}
+
+func (r *bodyRuleTest) Compile() {}
+func (r *bodyRuleTest) Final() bool {
+	return false
+}
+func (r *bodyRuleTest) IsCompliant(target Traits) bool {
+	r.calls++
+	return target.Body != "spam"
+}
+func (r *bodyRuleTest) OnlyBody() bool {
+	return true
+}
+
+func TestMemo(t *testing.T) {
+	t.Parallel()
+	body := &bodyRuleTest{}
+	other := &RuleTest{compliant: true}
+	a := New([]Rule{body, other})
+	b := New([]Rule{body})
+
+	tests := []struct {
+		body      string
+		violation Rule
+		calls     int
+	}{
+		{body: "hola", violation: nil, calls: 1},
+		{body: "hola", violation: nil, calls: 1},
+		{body: "spam", violation: body, calls: 2},
+		{body: "hola", violation: nil, calls: 2},
+		{body: "spam", violation: body, calls: 2},
+		{body: "", violation: nil, calls: 3},
+	}
+	m := NewMemo()
+	for _, tt := range tests {
+		if got := m.Violation(a, Traits{Body: tt.body}); got != tt.violation {
+			t.Errorf("%q: got: %v, want: %v", tt.body, got, tt.violation)
+		}
+		if body.calls != tt.calls {
+			t.Errorf("%q: got: %v calls, want: %v", tt.body, body.calls, tt.calls)
+		}
+	}
+	// the same rule in another analyzer reuses the verdicts
+	if got := m.Verdicts(b, Traits{Body: "spam"}); got != 0b1 || body.calls != 3 {
+		t.Errorf("got: %b after %v calls, want: 1 after 3", got, body.calls)
+	}
+	if got := m.Len(); got != 3 {
+		t.Errorf("got: %v verdicts, want: %v", got, 3)
+	}
+
+	// a nil memo evaluates every body
+	var nilMemo *Memo
+	nilMemo.Violation(a, Traits{Body: "hola"})
+	nilMemo.Violation(a, Traits{Body: "hola"})
+	if body.calls != 5 {
+		t.Errorf("got: %v calls, want: %v", body.calls, 5)
+	}
+}
+
+// BenchmarkViolationSpam measures the rules against the history of a user
+// banned for 30 copies of the same spam, within an event
+func BenchmarkViolationSpam(b *testing.B) {
+	a := New([]Rule{RuleNoLinks(), RuleMinTimeoutDuration(5), RuleMaxFlood(100)})
+	a.Compile()
+	t := Traits{
+		Type:            message.MessageTimeout,
+		Body:            "FREE FOLLOWERS, VIEWERS AND PRIMES ON bigfollows * com PogChamp PogChamp PogChamp",
+		TimeoutDuration: 600,
+	}
+	const copies = 30
+
+	b.Run("memo=false", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < copies; j++ {
+				a.Violation(t)
+			}
+		}
+	})
+	b.Run("memo=true", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			m := NewMemo()
+			for j := 0; j < copies; j++ {
+				m.Violation(a, t)
+			}
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package heuristics
+
+// BodyRule is implemented by the rules whose verdict only depends on the body
+// of the message, e.g. NoLinks, so it can be memoized. See Memo
+type BodyRule interface {
+	Rule
+	// OnlyBody returns true if IsCompliant only reads target.Body
+	OnlyBody() bool
+}
+
+// memoKey is a verdict of a rule, by the FNV-1a hash of a body
+type memoKey struct {
+	rule Rule
+	body uint64
+}
+
+// Memo memoizes the verdicts of the body rules within an event, e.g. the ban
+// of a user whose recent messages are 30 copies of the same spam, so an
+// identical body is only evaluated once by every rule, whatever the analyzer
+// running it. A nil Memo memoizes nothing. It is not safe for concurrent use
+type Memo struct {
+	verdicts map[memoKey]bool
+	// last is the last body hashed and sum its hash, the rules of an analyzer
+	// run against the same body in a row
+	last string
+	sum  uint64
+}
+
+// isCompliant is rule.IsCompliant(target), memoized if the rule is a body rule
+func (m *Memo) isCompliant(rule Rule, target Traits) bool {
+	if m == nil {
+		return rule.IsCompliant(target)
+	}
+	if br, ok := rule.(BodyRule); !ok || !br.OnlyBody() {
+		return rule.IsCompliant(target)
+	}
+	if target.Body != m.last || m.verdicts == nil {
+		m.last, m.sum = target.Body, hashBody(target.Body)
+	}
+	if m.verdicts == nil {
+		m.verdicts = make(map[memoKey]bool)
+	}
+	key := memoKey{rule, m.sum}
+	if v, ok := m.verdicts[key]; ok {
+		return v
+	}
+	v := rule.IsCompliant(target)
+	m.verdicts[key] = v
+	return v
+}
+
+// Violation is a.Violation(target) with the verdicts of the body rules
+// memoized
+func (m *Memo) Violation(a *Analyzer, target Traits) Rule {
+	return a.violation(target, m)
+}
+
+// Verdicts is a.Verdicts(target) with the verdicts of the body rules memoized
+func (m *Memo) Verdicts(a *Analyzer, target Traits) uint64 {
+	return a.verdicts(target, m)
+}
+
+// Len returns the number of verdicts memoized
+func (m *Memo) Len() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.verdicts)
+}
+
+// hashBody returns the 64-bit FNV-1a hash of the body, without converting it
+// to a slice of bytes
+func hashBody(body string) uint64 {
+	const (
+		offset = 14695981039346656037
+		prime  = 1099511628211
+	)
+	h := uint64(offset)
+	for i := 0; i < len(body); i++ {
+		h ^= uint64(body[i])
+		h *= prime
+	}
+	return h
+}
+
+// NewMemo returns an empty Memo, meant to be used for a single event
+func NewMemo() *Memo {
+	return &Memo{}
+}
@@ -0,0 +1,85 @@
+package heuristics
+
+import (
+	"strings"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+var ErrBadPipeline = errors.New("bad rule pipeline, want <type>=<rule>,<rule>;<type>=...")
+
+// Pipelines applies a different Analyzer to every message type, so the rules
+// of a pipeline don't need to check the type of the message. The types
+// without a pipeline of their own use the default one, which holds the rules
+// of every type like a single Analyzer does.
+type Pipelines struct {
+	def    *Analyzer
+	byType map[message.MessageType]*Analyzer
+}
+
+// Set sets the pipeline of the messages of type `typ`. A pipeline without
+// rules stores every message of the type
+func (p *Pipelines) Set(typ message.MessageType, a *Analyzer) {
+	p.byType[typ] = a
+}
+
+// Compile calls the Compile() method of every pipeline
+func (p *Pipelines) Compile() {
+	p.def.Compile()
+	for _, a := range p.byType {
+		a.Compile()
+	}
+}
+
+// Violation returns the first rule of the pipeline of the type of `target`
+// the traits are not compliant with, or nil if they are compliant. See
+// Analyzer.Violation
+func (p *Pipelines) Violation(target Traits) Rule {
+	return p.Of(target.Type).Violation(target)
+}
+
+// Of returns the pipeline of the messages of type `typ`
+func (p *Pipelines) Of(typ message.MessageType) *Analyzer {
+	if a, ok := p.byType[typ]; ok {
+		return a
+	}
+	return p.def
+}
+
+// NewPipelines creates the pipelines with `def` as the default pipeline
+func NewPipelines(def *Analyzer) *Pipelines {
+	return &Pipelines{def: def, byType: make(map[message.MessageType]*Analyzer)}
+}
+
+// ParsePipelines creates the pipelines of `spec`, e.g.
+// "ban=;timeout=NoLinks,MinTimeoutDuration", with the rules created by
+// `rules` by name. The types not in spec use `def`
+func ParsePipelines(spec string, rules map[string]func() Rule, def []Rule) (*Pipelines, error) {
+	p := NewPipelines(New(def))
+	for _, pipeline := range strings.Split(spec, ";") {
+		pipeline = strings.TrimSpace(pipeline)
+		if pipeline == "" {
+			continue
+		}
+		typ, names, ok := strings.Cut(pipeline, "=")
+		typ = strings.TrimSpace(typ)
+		if !ok || typ == "" {
+			return nil, errors.WrapWithContext(ErrBadPipeline, struct{ Pipeline string }{pipeline})
+		}
+		var pipelineRules []Rule
+		for _, name := range strings.Split(names, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			newRule, ok := rules[name]
+			if !ok {
+				return nil, errors.WrapWithContext(ErrBadPipeline, struct{ UnknownRule string }{name})
+			}
+			pipelineRules = append(pipelineRules, newRule())
+		}
+		p.Set(message.MessageType(typ), New(pipelineRules))
+	}
+	return p, nil
+}
@@ -0,0 +1,48 @@
+package heuristics
+
+import (
+	"testing"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestPipelines(t *testing.T) {
+	t.Parallel()
+	rules := map[string]func() Rule{
+		"NoLinks": func() Rule { return RuleNoLinks() },
+		"Reject":  func() Rule { return &RuleTest{} },
+	}
+	link := "see https://example.com"
+	tests := []struct {
+		desc      string
+		spec      string
+		target    Traits
+		compliant bool
+		err       error
+	}{
+		{desc: "default pipeline", spec: "", target: Traits{Type: message.MessageTimeout, Body: link}, compliant: false},
+		{desc: "empty pipeline stores all", spec: "timeout=", target: Traits{Type: message.MessageTimeout, Body: link}, compliant: true},
+		{desc: "own pipeline", spec: "timeout=NoLinks; deletion=Reject", target: Traits{Type: message.MessageTimeout, Body: link}, compliant: false},
+		{desc: "other type", spec: "timeout=; deletion=Reject", target: Traits{Type: message.MessageDeletion}, compliant: false},
+		{desc: "unknown rule", spec: "timeout=Unknown", err: ErrBadPipeline},
+		{desc: "no type", spec: "NoLinks", err: ErrBadPipeline},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.desc, func(t *testing.T) {
+			t.Parallel()
+			p, err := ParsePipelines(tt.spec, rules, []Rule{RuleNoLinks()})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error got: %v, want: %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			p.Compile()
+			if got := p.Violation(tt.target) == nil; got != tt.compliant {
+				t.Fatalf("compliant got: %v, want: %v", got, tt.compliant)
+			}
+		})
+	}
+}
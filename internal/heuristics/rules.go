@@ -2,6 +2,7 @@ package heuristics
 
 import (
 	"regexp"
+	"strings"
 
 	"github.com/hammertrack/tracker/internal/message"
 )
@@ -24,6 +25,9 @@ func (r *NoLinks) Final() bool {
 func (r *NoLinks) IsCompliant(target Traits) bool {
 	return !r.urlrg.MatchString(target.Body)
 }
+func (r *NoLinks) OnlyBody() bool {
+	return true
+}
 func RuleNoLinks() *NoLinks {
 	return &NoLinks{}
 }
@@ -63,6 +67,8 @@ func RuleMinTimeoutDuration(min int) *MinTimeoutDuration {
 // - A user may repeatedly send messages while a moderator is banning him. If
 // the moderator takes action and right after another message is sent, it may
 // not be stored.
+// - A moderation before its message is a skew of the clocks the times come
+// from, the time to action is unknown so it is compliant.
 type OnlyHumanModerations struct {
 	minHumanlyPossible float64
 }
@@ -70,7 +76,8 @@ type OnlyHumanModerations struct {
 func (r *OnlyHumanModerations) Compile() {}
 func (r *OnlyHumanModerations) IsCompliant(target Traits) bool {
 	if target.IsMostRecentMsg {
-		return target.ModeratedAt.Sub(target.At).Seconds() > r.minHumanlyPossible
+		d := target.ModeratedAt.Sub(target.At)
+		return d < 0 || d.Seconds() > r.minHumanlyPossible
 	}
 	return true
 }
@@ -102,3 +109,199 @@ func (r *AlwaysStoreBans) Final() bool {
 func RuleAlwaysStoreBans() *AlwaysStoreBans {
 	return &AlwaysStoreBans{}
 }
+
+// AlwaysStoreAutomod - Always store the messages caught by AutoMod
+//
+// Reason: They are automatic by definition, so the other rules would drop
+// them, but they are stored apart with their own type to tell AutoMod actions
+// and human moderations apart.
+//
+// It should always be placed at the beginning of the rules slice
+type AlwaysStoreAutomod struct{}
+
+func (r *AlwaysStoreAutomod) Compile() {}
+func (r *AlwaysStoreAutomod) IsCompliant(target Traits) bool {
+	return target.Type == message.MessageAutomod
+}
+func (r *AlwaysStoreAutomod) Final() bool {
+	return true
+}
+
+func RuleAlwaysStoreAutomod() *AlwaysStoreAutomod {
+	return &AlwaysStoreAutomod{}
+}
+
+// AlwaysStoreWarnings - Always store the warnings given by moderators
+//
+// Reason: Warnings are given by hand with a reason, they are never automatic,
+// and they are the first step of the escalations of a user.
+//
+// It should always be placed at the beginning of the rules slice
+type AlwaysStoreWarnings struct{}
+
+func (r *AlwaysStoreWarnings) Compile() {}
+func (r *AlwaysStoreWarnings) IsCompliant(target Traits) bool {
+	return target.Type == message.MessageWarning
+}
+func (r *AlwaysStoreWarnings) Final() bool {
+	return true
+}
+
+func RuleAlwaysStoreWarnings() *AlwaysStoreWarnings {
+	return &AlwaysStoreWarnings{}
+}
+
+// MaxEmoteDensity - Only store moderations whose most recent message is not
+// made mostly of third-party emotes
+//
+// Reason: Emote walls are spam removed by moderators or bots in bulk, like
+// links, and they say nothing about the user. BTTV/FFZ/7TV emotes look like
+// plain words, so the density is only known with the emotes enabled, otherwise
+// ThirdPartyEmotes is always 0 and every message is compliant. Messages with
+// less than `minWords` words are always compliant, a single emote is a
+// reaction rather than spam.
+type MaxEmoteDensity struct {
+	max      float64
+	minWords int
+}
+
+func (r *MaxEmoteDensity) Compile() {}
+func (r *MaxEmoteDensity) IsCompliant(target Traits) bool {
+	if !target.IsMostRecentMsg {
+		return true
+	}
+	words := len(strings.Fields(target.Body))
+	if words < r.minWords {
+		return true
+	}
+	return float64(target.ThirdPartyEmotes)/float64(words) < r.max
+}
+func (r *MaxEmoteDensity) Final() bool {
+	return false
+}
+
+func RuleMaxEmoteDensity(max float64, minWords int) *MaxEmoteDensity {
+	return &MaxEmoteDensity{max, minWords}
+}
+
+// MinToxicity - Only store moderations whose most recent message has a
+// toxicity score greater or equal than a specified minimum
+//
+// Reason: Lets an external model decide which moderations are worth storing.
+// Unscored messages (the scorer is disabled, down or slow) are always
+// compliant, so the rule never drops moderations because of an outage.
+type MinToxicity struct {
+	min float64
+}
+
+func (r *MinToxicity) Compile() {}
+func (r *MinToxicity) IsCompliant(target Traits) bool {
+	if target.IsMostRecentMsg && target.Scored {
+		return target.Toxicity >= r.min
+	}
+	return true
+}
+func (r *MinToxicity) Final() bool {
+	return false
+}
+
+func RuleMinToxicity(min float64) *MinToxicity {
+	return &MinToxicity{min}
+}
+
+// MaxFlood - Only store moderations of users who sent less than a specified
+// maximum of messages shortly before
+//
+// Reason: Floods are spam removed by bots or by moderators in bulk, like links
+// and emote walls, and the messages say nothing about the user. The messages
+// are estimated, so a user of a busy chat may be counted a few messages more,
+// never less. Users without counted messages are always compliant.
+type MaxFlood struct {
+	max int
+}
+
+func (r *MaxFlood) Compile() {}
+func (r *MaxFlood) IsCompliant(target Traits) bool {
+	return target.Flood < r.max
+}
+func (r *MaxFlood) Final() bool {
+	return false
+}
+
+func RuleMaxFlood(max int) *MaxFlood {
+	return &MaxFlood{max}
+}
+
+// hasBadge reports whether `badges` has any of `want`. A founder is a
+// subscriber and the broadcaster a moderator
+func hasBadge(badges []string, want map[string]bool) bool {
+	for _, b := range badges {
+		switch b {
+		case "founder":
+			b = "subscriber"
+		case "broadcaster":
+			b = "moderator"
+		}
+		if want[b] {
+			return true
+		}
+	}
+	return false
+}
+
+func badgeSet(badges []string) map[string]bool {
+	set := make(map[string]bool, len(badges))
+	for _, b := range badges {
+		set[b] = true
+	}
+	return set
+}
+
+// OnlyBadges - Only store moderations of users with any of the badges, e.g.
+// subscriber, vip or moderator, in their most recent message
+//
+// Reason: Communities that only care about their own members, e.g. to follow
+// the moderations of their subscribers. The badges are those shown by twitch
+// when the message was sent.
+type OnlyBadges struct {
+	badges map[string]bool
+}
+
+func (r *OnlyBadges) Compile() {}
+func (r *OnlyBadges) IsCompliant(target Traits) bool {
+	if target.IsMostRecentMsg {
+		return hasBadge(target.Badges, r.badges)
+	}
+	return true
+}
+func (r *OnlyBadges) Final() bool {
+	return false
+}
+
+func RuleOnlyBadges(badges []string) *OnlyBadges {
+	return &OnlyBadges{badgeSet(badges)}
+}
+
+// SkipBadges - Only store moderations of users without any of the badges in
+// their most recent message
+//
+// Reason: Communities that only care about tracking non-community members,
+// e.g. skipping the timeouts given to VIPs and moderators as a joke.
+type SkipBadges struct {
+	badges map[string]bool
+}
+
+func (r *SkipBadges) Compile() {}
+func (r *SkipBadges) IsCompliant(target Traits) bool {
+	if target.IsMostRecentMsg {
+		return !hasBadge(target.Badges, r.badges)
+	}
+	return true
+}
+func (r *SkipBadges) Final() bool {
+	return false
+}
+
+func RuleSkipBadges(badges []string) *SkipBadges {
+	return &SkipBadges{badgeSet(badges)}
+}
@@ -129,6 +129,8 @@ func TestOnlyHumanModerations(t *testing.T) {
 		{input: 5.3, want: true},
 		{input: 5, want: true},
 		{input: 7.32, want: true},
+		// skewed clocks
+		{input: -2, want: true},
 	}
 
 	for _, test := range tests {
@@ -149,3 +151,84 @@ func TestOnlyHumanModerations(t *testing.T) {
 		})
 	}
 }
+
+func TestMinToxicity(t *testing.T) {
+	t.Parallel()
+	a := createAnalyzer(RuleMinToxicity(.5))
+
+	tests := []struct {
+		desc   string
+		traits Traits
+		want   bool
+	}{
+		{desc: "toxic", traits: Traits{IsMostRecentMsg: true, Scored: true, Toxicity: .9}, want: true},
+		{desc: "min", traits: Traits{IsMostRecentMsg: true, Scored: true, Toxicity: .5}, want: true},
+		{desc: "harmless", traits: Traits{IsMostRecentMsg: true, Scored: true, Toxicity: .1}, want: false},
+		{desc: "unscored", traits: Traits{IsMostRecentMsg: true, Scored: false}, want: true},
+		{desc: "not-most-recent", traits: Traits{IsMostRecentMsg: false, Scored: true, Toxicity: .1}, want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			if got := a.IsCompliant(test.traits); got != test.want {
+				t.Fatalf("got: %t want:%t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMaxEmoteDensity(t *testing.T) {
+	t.Parallel()
+	a := createAnalyzer(RuleMaxEmoteDensity(.8, 3))
+
+	tests := []struct {
+		desc   string
+		traits Traits
+		want   bool
+	}{
+		{desc: "emote wall", traits: Traits{IsMostRecentMsg: true, Body: "KEKW KEKW KEKW KEKW KEKW", ThirdPartyEmotes: 5}, want: false},
+		{desc: "mostly emotes", traits: Traits{IsMostRecentMsg: true, Body: "lol KEKW KEKW KEKW KEKW", ThirdPartyEmotes: 4}, want: false},
+		{desc: "some emotes", traits: Traits{IsMostRecentMsg: true, Body: "you are so bad KEKW", ThirdPartyEmotes: 1}, want: true},
+		{desc: "few words", traits: Traits{IsMostRecentMsg: true, Body: "KEKW KEKW", ThirdPartyEmotes: 2}, want: true},
+		{desc: "emotes disabled", traits: Traits{IsMostRecentMsg: true, Body: "KEKW KEKW KEKW KEKW", ThirdPartyEmotes: 0}, want: true},
+		{desc: "not-most-recent", traits: Traits{IsMostRecentMsg: false, Body: "KEKW KEKW KEKW", ThirdPartyEmotes: 3}, want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			if got := a.IsCompliant(test.traits); got != test.want {
+				t.Fatalf("got: %t want:%t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBadges(t *testing.T) {
+	t.Parallel()
+	only := createAnalyzer(RuleOnlyBadges([]string{"subscriber", "vip"}))
+	skip := createAnalyzer(RuleSkipBadges([]string{"moderator"}))
+
+	tests := []struct {
+		desc     string
+		traits   Traits
+		wantOnly bool
+		wantSkip bool
+	}{
+		{desc: "vip", traits: Traits{IsMostRecentMsg: true, Badges: []string{"vip"}}, wantOnly: true, wantSkip: true},
+		{desc: "founder", traits: Traits{IsMostRecentMsg: true, Badges: []string{"founder"}}, wantOnly: true, wantSkip: true},
+		{desc: "broadcaster", traits: Traits{IsMostRecentMsg: true, Badges: []string{"broadcaster"}}, wantOnly: false, wantSkip: false},
+		{desc: "no badges", traits: Traits{IsMostRecentMsg: true}, wantOnly: false, wantSkip: true},
+		{desc: "not-most-recent", traits: Traits{IsMostRecentMsg: false, Badges: []string{"moderator"}}, wantOnly: true, wantSkip: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			if got := only.IsCompliant(test.traits); got != test.wantOnly {
+				t.Fatalf("only got: %t want:%t", got, test.wantOnly)
+			}
+			if got := skip.IsCompliant(test.traits); got != test.wantSkip {
+				t.Fatalf("skip got: %t want:%t", got, test.wantSkip)
+			}
+		})
+	}
+}
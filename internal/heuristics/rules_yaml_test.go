@@ -0,0 +1,28 @@
+package heuristics_test
+
+import (
+	"testing"
+
+	"github.com/hammertrack/tracker/internal/heuristics"
+	"github.com/hammertrack/tracker/internal/heuristics/testkit"
+)
+
+// TestRulesYAML runs the cases of testdata/*.yaml. Rules are added here with
+// the parameters their cases assume
+func TestRulesYAML(t *testing.T) {
+	t.Parallel()
+	testkit.RunDir(t, map[string]func() heuristics.Rule{
+		"MinTimeoutDuration": func() heuristics.Rule {
+			return heuristics.RuleMinTimeoutDuration(5)
+		},
+		"OnlyHumanModerations": func() heuristics.Rule {
+			return heuristics.RuleOnlyHumanModerations(0.5)
+		},
+		"SkipBadges": func() heuristics.Rule {
+			return heuristics.RuleSkipBadges([]string{"vip", "moderator"})
+		},
+		"MaxFlood": func() heuristics.Rule {
+			return heuristics.RuleMaxFlood(10)
+		},
+	}, "testdata")
+}
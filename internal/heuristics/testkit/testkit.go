@@ -0,0 +1,171 @@
+// Package testkit runs the test cases of the heuristics rules written in YAML,
+// so a rule ships with its coverage without writing the table-driven test
+// itself. A file has the cases of a rule:
+//
+//	rule: MinTimeoutDuration
+//	cases:
+//	  - name: short timeout
+//	    traits: {type: timeout, timeout_duration: 1}
+//	    want: false
+//	  - name: slow moderator
+//	    traits: {type: ban, time_to_action: 3s}
+//	    want: true
+//
+// want is whether the traits are compliant with the rule. The traits are the
+// fields of heuristics.Traits in snake case. The most recent message is
+// assumed unless is_most_recent_msg is false, and time_to_action sets
+// moderated_at after `at`.
+package testkit
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/heuristics"
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+var ErrUnknownRule = errors.New("unknown rule in the cases")
+
+// Traits are the heuristics.Traits of a case
+type Traits struct {
+	Type             string        `yaml:"type"`
+	Body             string        `yaml:"body"`
+	At               time.Time     `yaml:"at"`
+	ModeratedAt      time.Time     `yaml:"moderated_at"`
+	TimeToAction     time.Duration `yaml:"time_to_action"`
+	TimeoutDuration  int           `yaml:"timeout_duration"`
+	IsMostRecentMsg  *bool         `yaml:"is_most_recent_msg"`
+	ThirdPartyEmotes int           `yaml:"third_party_emotes"`
+	Toxicity         float64       `yaml:"toxicity"`
+	Scored           bool          `yaml:"scored"`
+	Badges           []string      `yaml:"badges"`
+	Flood            int           `yaml:"flood"`
+}
+
+// Traits returns the traits of the rules
+func (t *Traits) Traits() heuristics.Traits {
+	at := t.At
+	if at.IsZero() {
+		at = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	moderatedAt := t.ModeratedAt
+	if moderatedAt.IsZero() {
+		moderatedAt = at.Add(t.TimeToAction)
+	}
+	return heuristics.Traits{
+		Type:             message.MessageType(t.Type),
+		Body:             t.Body,
+		At:               at,
+		ModeratedAt:      moderatedAt,
+		TimeoutDuration:  t.TimeoutDuration,
+		IsMostRecentMsg:  t.IsMostRecentMsg == nil || *t.IsMostRecentMsg,
+		ThirdPartyEmotes: t.ThirdPartyEmotes,
+		Toxicity:         t.Toxicity,
+		Scored:           t.Scored,
+		Badges:           t.Badges,
+		Flood:            t.Flood,
+	}
+}
+
+type Case struct {
+	Name   string `yaml:"name"`
+	Traits Traits `yaml:"traits"`
+	// Want is whether the traits are compliant with the rule
+	Want bool `yaml:"want"`
+}
+
+// Suite are the cases of a rule
+type Suite struct {
+	Rule  string `yaml:"rule"`
+	Cases []Case `yaml:"cases"`
+}
+
+// Load reads the suite of the YAML file `path`
+func Load(path string) (*Suite, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	var s Suite
+	if err := yaml.Unmarshal(b, &s); err != nil {
+		return nil, errors.WrapWithContext(err, struct{ Path string }{path})
+	}
+	return &s, nil
+}
+
+// Run runs the cases of the suite against `rule` as subtests of t
+func Run(t *testing.T, rule heuristics.Rule, s *Suite) {
+	t.Helper()
+	a := heuristics.New([]heuristics.Rule{rule})
+	a.Compile()
+	for _, c := range s.Cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			if got := a.IsCompliant(c.Traits.Traits()); got != c.Want {
+				t.Errorf("%s got: %v, want: %v", s.Rule, got, c.Want)
+			}
+		})
+	}
+}
+
+// RunDir runs the suites of every .yaml file in `dir` against the rule they
+// name, created with `rules`. See bot.PipelineRules
+func RunDir(t *testing.T, rules map[string]func() heuristics.Rule, dir string) {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		s, err := Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		newRule, ok := rules[s.Rule]
+		if !ok {
+			t.Fatal(errors.WrapWithContext(ErrUnknownRule, struct{ Path, Rule string }{path, s.Rule}))
+		}
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			Run(t, newRule(), s)
+		})
+	}
+}
+
+// Clock is a fake clock.Clock for the tests, which only moves when told to. It
+// is safe for concurrent use
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set sets the current time of the clock
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// Advance moves the clock forward by d
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// NewClock returns a fake clock stopped at `now`
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
@@ -0,0 +1,66 @@
+// Package intern deduplicates the strings repeated across the messages, e.g.
+// the channels and the usernames, which are otherwise parsed into a distinct
+// string for every message and keep alive the raw lines they were parsed from.
+package intern
+
+import (
+	"strings"
+	"sync"
+)
+
+// Pool keeps a single copy of every recent string. It holds up to two
+// generations of `max` strings: once the current generation is full it
+// becomes the previous one, whose strings are moved back to the current
+// generation when they are seen again and evicted otherwise. It is safe for
+// concurrent use. A nil Pool interns nothing
+type Pool struct {
+	max int
+
+	mu   sync.Mutex
+	cur  map[string]string
+	prev map[string]string
+}
+
+// String returns the copy of `s` kept by the pool, keeping it first if there
+// is none
+func (p *Pool) String(s string) string {
+	if p == nil || s == "" {
+		return s
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if v, ok := p.cur[s]; ok {
+		return v
+	}
+	v, ok := p.prev[s]
+	if !ok {
+		v = strings.Clone(s)
+	}
+	if len(p.cur) >= p.max {
+		p.prev, p.cur = p.cur, make(map[string]string, p.max)
+	}
+	p.cur[v] = v
+	return v
+}
+
+// Len returns the number of strings kept by the pool, of both generations
+func (p *Pool) Len() int {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.cur) + len(p.prev)
+}
+
+// New returns a pool of up to 2 * `max` strings, nil if `max` is not positive
+func New(max int) *Pool {
+	if max <= 0 {
+		return nil
+	}
+	return &Pool{
+		max:  max,
+		cur:  make(map[string]string, max),
+		prev: make(map[string]string),
+	}
+}
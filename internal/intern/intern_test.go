@@ -0,0 +1,45 @@
+package intern
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+// same reports whether both strings share their bytes
+func same(a, b string) bool {
+	ha := (*reflect.StringHeader)(unsafe.Pointer(&a))
+	hb := (*reflect.StringHeader)(unsafe.Pointer(&b))
+	return ha.Len == hb.Len && ha.Data == hb.Data
+}
+
+func TestPool(t *testing.T) {
+	t.Parallel()
+	p := New(2)
+	foo := p.String(string([]byte("foo")))
+	if got := p.String(string([]byte("foo"))); got != "foo" || !same(got, foo) {
+		t.Fatalf("got: %q, want the interned %q", got, foo)
+	}
+	// bar and baz fill the current generation, foo moves to the previous one
+	p.String("bar")
+	p.String("baz")
+	if got := p.String(string([]byte("foo"))); !same(got, foo) {
+		t.Errorf("got: a new copy, want foo kept in the previous generation")
+	}
+	// the strings not seen for a generation are evicted
+	for i := 0; i < 4; i++ {
+		p.String(fmt.Sprint("qux", i))
+	}
+	if n := p.Len(); n > 4 {
+		t.Errorf("got: %v strings, want: at most %v", n, 4)
+	}
+
+	var disabled *Pool
+	if got := disabled.String("foo"); got != "foo" || disabled.Len() != 0 {
+		t.Errorf("got: %q, want: %q", got, "foo")
+	}
+	if New(0) != nil {
+		t.Error("got: a pool, want: nil")
+	}
+}
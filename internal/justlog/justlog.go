@@ -0,0 +1,98 @@
+// Package justlog is a client of the public chat log archives compatible with
+// the justlog API, like justlog itself or rustlog.
+package justlog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/gempir/go-twitch-irc/v3"
+	"github.com/hammertrack/tracker/errors"
+)
+
+const RequestTimeout = 30 * time.Second
+
+var ErrUnexpectedStatus = errors.New("unexpected status code from the log archive")
+
+// Entry is a logged IRC message
+type Entry struct {
+	// Message is the parsed IRC message, one of twitch.PrivateMessage,
+	// twitch.ClearChatMessage, twitch.ClearMessage...
+	Message twitch.Message
+	At      time.Time
+}
+
+type chatMessage struct {
+	Timestamp time.Time `json:"timestamp"`
+	Raw       string    `json:"raw"`
+}
+
+// Client is a client of a justlog compatible API
+type Client struct {
+	BaseURL string
+	http    *http.Client
+}
+
+// Day returns the logs of `channel` of the day of `day`, in chronological
+// order. A day without logs returns no entries and no error.
+func (c *Client) Day(ctx context.Context, channel string, day time.Time) ([]*Entry, error) {
+	day = day.UTC()
+	endpoint := fmt.Sprintf("%s/channel/%s/%d/%d/%d?json=1",
+		c.BaseURL, url.PathEscape(channel), day.Year(), day.Month(), day.Day())
+
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, errors.WrapWithContext(ErrUnexpectedStatus, struct {
+			Code int
+			Body string
+		}{res.StatusCode, string(b)})
+	}
+
+	var logs struct {
+		Messages []*chatMessage `json:"messages"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&logs); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	entries := make([]*Entry, 0, len(logs.Messages))
+	for _, m := range logs.Messages {
+		if m.Raw == "" {
+			continue
+		}
+		entries = append(entries, &Entry{
+			Message: twitch.ParseMessage(m.Raw),
+			At:      m.Timestamp,
+		})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].At.Before(entries[j].At)
+	})
+	return entries, nil
+}
+
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL: baseURL,
+		http:    &http.Client{},
+	}
+}
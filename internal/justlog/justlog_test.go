@@ -0,0 +1,51 @@
+package justlog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gempir/go-twitch-irc/v3"
+)
+
+func TestDay(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/channel/foo/2022/3/4" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"messages":[
+{"timestamp":"2022-03-04T10:00:02Z","raw":"@ban-duration=600;room-id=1;target-user-id=2;tmi-sent-ts=1646388002000 :tmi.twitch.tv CLEARCHAT #foo :bar"},
+{"timestamp":"2022-03-04T10:00:01Z","raw":"@id=abc;room-id=1;tmi-sent-ts=1646388001000;user-id=2 :bar!bar@bar.tmi.twitch.tv PRIVMSG #foo :hello"},
+{"timestamp":"2022-03-04T10:00:03Z","raw":""}
+]}`))
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	entries, err := c.Day(context.Background(), "foo", time.Date(2022, 3, 4, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if _, ok := entries[0].Message.(*twitch.PrivateMessage); !ok {
+		t.Fatalf("expected the first entry to be the PRIVMSG, got %T", entries[0].Message)
+	}
+	cc, ok := entries[1].Message.(*twitch.ClearChatMessage)
+	if !ok {
+		t.Fatalf("expected the second entry to be the CLEARCHAT, got %T", entries[1].Message)
+	}
+	if cc.TargetUsername != "bar" || cc.BanDuration != 600 {
+		t.Fatalf("unexpected CLEARCHAT: %+v", cc)
+	}
+
+	entries, err = c.Day(context.Background(), "foo", time.Date(2022, 3, 5, 0, 0, 0, 0, time.UTC))
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("expected no entries and no error for a missing day, got %d, %v", len(entries), err)
+	}
+}
@@ -0,0 +1,86 @@
+package links
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+// QueueSize is the number of jobs waiting to be resolved before new ones are
+// dropped
+const QueueSize = 100
+
+// Job are the links of a stored moderation
+type Job struct {
+	Username string
+	Channel  string
+	At       time.Time
+	Links    []string
+}
+
+// Enricher resolves links in the background and passes the results to a
+// store function. Resolving is best-effort: jobs are dropped rather than
+// slowing down the ingestion.
+type Enricher struct {
+	resolver Resolver
+	store    func(job *Job, links []*Link) error
+	timeout  time.Duration
+	jobs     chan *Job
+}
+
+// Enqueue schedules the job. It never blocks, and reports whether the job was
+// scheduled
+func (e *Enricher) Enqueue(job *Job) bool {
+	select {
+	case e.jobs <- job:
+		return true
+	default:
+		log.Printf("link enrichment queue full, dropping %d links", len(job.Links))
+		return false
+	}
+}
+
+// Start resolves the jobs until ctx is done
+func (e *Enricher) Start(ctx context.Context) {
+	for {
+		select {
+		case job := <-e.jobs:
+			e.process(ctx, job)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (e *Enricher) process(ctx context.Context, job *Job) {
+	resolved := make([]*Link, 0, len(job.Links))
+	for _, link := range job.Links {
+		rctx, cancel := context.WithTimeout(ctx, e.timeout)
+		l, err := e.resolver.Resolve(rctx, link)
+		cancel()
+		if err != nil {
+			errors.WrapAndLog(err)
+			continue
+		}
+		resolved = append(resolved, l)
+	}
+	if len(resolved) == 0 {
+		return
+	}
+	if err := e.store(job, resolved); err != nil {
+		errors.WrapAndLog(err)
+	}
+}
+
+// NewEnricher creates an enricher that resolves each link with `resolver`
+// within `timeout`, and stores the results with `store`
+func NewEnricher(resolver Resolver, timeout time.Duration, store func(job *Job, links []*Link) error) *Enricher {
+	return &Enricher{
+		resolver: resolver,
+		store:    store,
+		timeout:  timeout,
+		jobs:     make(chan *Job, QueueSize),
+	}
+}
@@ -0,0 +1,167 @@
+// Package links extracts the links of the stored messages and enriches them
+// with their domain and a category.
+package links
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+// Categories of a link
+const (
+	CategoryNone      = ""
+	CategoryShortener = "shortener"
+	CategoryScam      = "scam"
+)
+
+// MaxRedirects is the maximum number of redirects followed to resolve a
+// shortened link
+const MaxRedirects = 3
+
+// urlrg is the same pattern used by heuristics.NoLinks, so the links
+// extracted are the ones the heuristics consider links
+var urlrg = regexp.MustCompile(`\b(https?|ftps?|file):\/\/[\-A-Za-z0-9+&@#\/%?=~_|!:,.;]*[\-A-Za-z0-9+&@#\/%=~_|]`)
+
+// Shorteners are the domains of the known URL shorteners
+var Shorteners = map[string]bool{
+	"bit.ly":      true,
+	"buff.ly":     true,
+	"cutt.ly":     true,
+	"goo.gl":      true,
+	"is.gd":       true,
+	"ow.ly":       true,
+	"rb.gy":       true,
+	"rebrand.ly":  true,
+	"shorturl.at": true,
+	"t.co":        true,
+	"tiny.cc":     true,
+	"tinyurl.com": true,
+}
+
+// Link is a resolved link
+type Link struct {
+	URL string
+	// Domain is the domain the link points to, after following the redirects
+	// of the shorteners
+	Domain   string
+	Category string
+}
+
+// Resolver resolves the domain and category of a link
+type Resolver interface {
+	Resolve(ctx context.Context, link string) (*Link, error)
+}
+
+// Extract returns the links of a message
+func Extract(body string) []string {
+	return urlrg.FindAllString(body, -1)
+}
+
+// domain returns the host of the URL, lowercased and without the www prefix
+func domain(u *url.URL) string {
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// DomainResolver categorizes the links by their domain. Links of shorteners
+// are resolved following their redirects, without ever requesting the final
+// page.
+type DomainResolver struct {
+	// scams are the domains of the known scams
+	scams      map[string]bool
+	shorteners map[string]bool
+	http       *http.Client
+}
+
+func (r *DomainResolver) Resolve(ctx context.Context, link string) (*Link, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	l := &Link{URL: link, Domain: domain(u)}
+	shortened := r.shorteners[l.Domain]
+	for i := 0; i < MaxRedirects && r.shorteners[domain(u)]; i++ {
+		next, err := r.location(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			break
+		}
+		u = next
+	}
+	l.Domain = domain(u)
+
+	switch {
+	case r.scams[l.Domain]:
+		l.Category = CategoryScam
+	case shortened:
+		l.Category = CategoryShortener
+	}
+	return l, nil
+}
+
+// location returns where `u` redirects to, or nil if it is not a redirect
+func (r *DomainResolver) location(ctx context.Context, u *url.URL) (*url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	res, err := r.http.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	res.Body.Close()
+	if res.StatusCode < 300 || res.StatusCode > 399 {
+		return nil, nil
+	}
+	next, err := res.Location()
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return next, nil
+}
+
+// ReadDomains reads a list of domains from a file, one per line. Empty lines
+// and lines starting with # are ignored
+func ReadDomains(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	defer f.Close()
+	domains := make(map[string]bool)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.ToLower(strings.TrimSpace(s.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[strings.TrimPrefix(line, "www.")] = true
+	}
+	if err := s.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return domains, nil
+}
+
+func NewDomainResolver(scams map[string]bool, timeout time.Duration) *DomainResolver {
+	return &DomainResolver{
+		scams:      scams,
+		shorteners: Shorteners,
+		http: &http.Client{
+			Timeout: timeout,
+			// redirects are followed one by one, only while in a shortener
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
@@ -0,0 +1,66 @@
+package links
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExtract(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{"no links here", nil},
+		{"free nitro https://scam.example/claim now", []string{"https://scam.example/claim"}},
+		{"http://a.example and https://b.example/x?y=1", []string{"http://a.example", "https://b.example/x?y=1"}},
+	}
+	for _, tt := range tests {
+		got := Extract(tt.body)
+		if len(got) != len(tt.want) {
+			t.Fatalf("%q: got %v, want %v", tt.body, got, tt.want)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Fatalf("%q: got %v, want %v", tt.body, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestDomainResolver(t *testing.T) {
+	t.Parallel()
+	// a shortener redirecting to domains that are never requested
+	shortener := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("unexpected method %s", r.Method)
+		}
+		http.Redirect(w, r, "https://"+r.URL.Path[1:]+"/claim", http.StatusMovedPermanently)
+	}))
+	defer shortener.Close()
+
+	r := NewDomainResolver(map[string]bool{"scam.example": true}, time.Second)
+	r.shorteners = map[string]bool{"127.0.0.1": true}
+	tests := []struct {
+		link     string
+		domain   string
+		category string
+	}{
+		{"https://www.Scam.example/claim", "scam.example", CategoryScam},
+		{"https://twitch.tv/foo", "twitch.tv", CategoryNone},
+		{shortener.URL + "/scam.example", "scam.example", CategoryScam},
+		{shortener.URL + "/twitch.tv", "twitch.tv", CategoryShortener},
+	}
+	for _, tt := range tests {
+		l, err := r.Resolve(context.Background(), tt.link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l.Domain != tt.domain || l.Category != tt.category {
+			t.Fatalf("%s: got %s %q, want %s %q", tt.link, l.Domain, l.Category, tt.domain, tt.category)
+		}
+	}
+}
@@ -9,8 +9,68 @@ const (
 	MessageBan      MessageType = "ban"
 	MessageTimeout  MessageType = "timeout"
 	MessageDeletion MessageType = "deletion"
+	// MessageAutomod is a message caught by AutoMod, see the Automod* fields of
+	// Message. Only the holds are stored, the later updates set the status of
+	// the stored hold, see bot.AutomodStore
+	MessageAutomod MessageType = "automod"
+	// MessageUnban is the lift of a ban. It is never stored, see
+	// bot.ActiveBanStore
+	MessageUnban MessageType = "unban"
+	// MessageUserClear is a ban or a timeout that can't be told apart, e.g. the
+	// messages of a user cleared in an EventSub channel whose channel.ban
+	// subscription is not authorized. It is never treated as a ban
+	MessageUserClear MessageType = "user_clear"
+	// MessageChatClear is a clear of all the messages of the chat. Only the
+	// channel, the time and the Moderator are stored, see bot.ChatClearStore
+	MessageChatClear MessageType = "chat_clear"
+	// MessageWarning is a warning given to a user by a moderator with a
+	// Reason. It is stored like the rest of moderations, so the escalations of
+	// a user (warning, timeout, ban) can be followed
+	MessageWarning MessageType = "warning"
+	// MessagePurge is an internal message used to remove every trace of a user
+	// from the in-memory histories. It is never stored
+	MessagePurge MessageType = "purge"
 )
 
+// Status of a message caught by AutoMod
+const (
+	AutomodHeld     = "held"
+	AutomodApproved = "approved"
+	AutomodDenied   = "denied"
+	AutomodExpired  = "expired"
+)
+
+// TimeoutBucket classifies a timeout by its duration, since the raw seconds
+// are awkward to aggregate
+type TimeoutBucket string
+
+const (
+	// TimeoutPurge is a timeout of up to 10 seconds, usually given by bots to
+	// purge the messages of a user
+	TimeoutPurge TimeoutBucket = "purge"
+	// TimeoutWarning is a timeout longer than a purge and shorter than an hour,
+	// usually of 1 to 10 minutes
+	TimeoutWarning TimeoutBucket = "warning"
+	// TimeoutSerious is a timeout of 1 to 24 hours
+	TimeoutSerious TimeoutBucket = "serious"
+	// TimeoutSevere is a timeout longer than 24 hours
+	TimeoutSevere TimeoutBucket = "severe"
+)
+
+// BucketOf returns the bucket of a timeout of `seconds`
+func BucketOf(seconds int) TimeoutBucket {
+	switch {
+	case seconds <= 10:
+		return TimeoutPurge
+	case seconds < 60*60:
+		return TimeoutWarning
+	case seconds <= 24*60*60:
+		return TimeoutSerious
+	default:
+		return TimeoutSevere
+	}
+}
+
 type SubscribedStatus int
 
 const (
@@ -29,12 +89,20 @@ const (
 
 // PrivateMessage represents each chat message in the IRC, i.e. twitch chat.
 type PrivateMessage struct {
-	ID         string
-	Username   string
+	ID       string
+	Username string
+	// UserID is the twitch user id of Username, if known
+	UserID     string
 	Body       string
 	At         time.Time
 	Stored     bool
 	Subscribed SubscribedStatus
+	// SubMonths is the number of months the user has been subscribed, 0 if not
+	// subscribed or unknown
+	SubMonths int
+	// Badges are the badges of the user shown with the message, e.g.
+	// "subscriber", "vip" or "moderator"
+	Badges []string
 }
 
 // Message represents a message coming from the IRC client. It denormalizes the
@@ -48,22 +116,106 @@ type Message struct {
 	Type MessageType
 	// Channel represents the twitch channel
 	Channel string
+	// ChannelID is the twitch user id of the channel, if known
+	ChannelID string
 	// Username represents the owner of the message
 	Username string
+	// UserID is the twitch user id of Username, if known. Unlike usernames, it
+	// doesn't change when the user is renamed
+	UserID string
 	// Duration represents in seconds the timeout. Duration is only present for
 	// messafe of type MessageTimeout and MessageBan
 	Duration int
+	// Bucket is the bucket of the Duration of a timeout, empty for the rest of
+	// types. See BucketOf
+	Bucket TimeoutBucket
 	// LastMessages contains the related PRIVMSGs. It may be multiple PRIVMSGs
 	// retrieved from a history in the case of bans and timeouts or single
 	// messages in the case of deletion messages or a PRIVMSG itself
 	LastMessages []*PrivateMessage
-	// Used in case of deletions
-	TargetMsgID string
+	// Used in case of deletions. TargetMsgBody is the body of the deleted
+	// message given by the CLEARMSG
+	TargetMsgID   string
+	TargetMsgBody string
+	// Used in case of AutoMod messages. AutomodCategory is the category of the
+	// caught term given by twitch, e.g. "swearing"
+	AutomodStatus   string
+	AutomodCategory string
+	AutomodLevel    int
+	// Toxicity is the score of the most recent message given by the scorer, nil
+	// if it was not scored
+	Toxicity *float64
+	// Tags are the inferred reasons of the moderation, nil if they were not
+	// inferred. See package tags
+	Tags []string
+	// SharedSession is whether the moderation was received during a shared chat
+	// session and originated in another channel, whose twitch user id is
+	// SourceChannelID. Channel is the origin once its login is resolved
+	SharedSession   bool
+	SourceChannelID string
+	// Moderator is the login of the moderator who took the action, empty if
+	// unknown
+	Moderator string
+	// Reason is the reason of a warning, or of a ban or a timeout if the source
+	// gives it, e.g. the ban-reason tag of a CLEARCHAT. Empty if unknown
+	Reason string
+	// Compressed is the blob of the bodies of LastMessages that drivers store
+	// instead of them, encrypted if the encryption is enabled. It is nil unless
+	// the compression is enabled, see package compress
+	Compressed []byte
+	// ReceivedAt is when the message was handed to the tracker of its channel,
+	// zero if it was not received from a source
+	ReceivedAt time.Time
+	// Backfilled is whether the message was read from a log archive rather than
+	// received live. Backfilled moderations are stored without the side effects
+	// of the live ones, e.g. webhooks or active bans
+	Backfilled bool
+	// Reverted is whether a ban was undone by an unban within the grace window
+	// of the bans
+	Reverted bool
+	// Channels are the other channels where the user of a ban was banned
+	// within the mass-ban window, whose bans were collapsed into this one
+	Channels []string
+	// EscalatedFrom are the times of the earlier moderations of the user in
+	// the channel that escalated to this ban, the deletion and the timeout
+	EscalatedFrom []time.Time
+	// Partial is whether enrichments of the moderation, e.g. its toxicity,
+	// were skipped because its processing went over its budget
+	Partial bool
+	// NoLatencyData is whether the message of a deletion was not in the
+	// history, so its body was taken from the CLEARMSG and its time, like the
+	// time to action, is unknown. See cfg.DeletionMode
+	NoLatencyData bool
+	// Region is the region of the tracker that stored the moderation, see
+	// cfg.Region. Trackers of several regions may store the same moderation,
+	// its last writer is the one recorded
+	Region string
+	// Instance is the name of the tracker that stored the moderation, see
+	// cfg.Instance. Like Region, its last writer is the one recorded
+	Instance string
+	// Flood is the estimated number of messages of the user in the flood window
+	// before the moderation, 0 if the floods are not counted
+	Flood int
 	// At represents the timestamp of the message in the case of a MessageChat
 	// type or the time of the moderation (deletion/ban/timeout)
 	At time.Time
 }
 
+// TimeToAction returns the time between the most recent related message and
+// the moderation. It is false if there are no related messages or their time is
+// unknown, or if the moderation is before the message, which is a skew of the
+// clocks the times come from
+func (m *Message) TimeToAction() (time.Duration, bool) {
+	if len(m.LastMessages) == 0 || m.LastMessages[0].At.IsZero() {
+		return 0, false
+	}
+	d := m.At.Sub(m.LastMessages[0].At)
+	if d < 0 {
+		return 0, false
+	}
+	return d, true
+}
+
 // MessageRing is a ring buffer that contains values of `V` type in a circular
 // list of messages, effectively creating a rotating window of `size` size.
 //
@@ -100,10 +252,17 @@ func (last *MessageRing[V]) Append(val V) *MessageRing[V] {
 	return next
 }
 
+// Oldest returns the element that the next Append overrides
+func (last *MessageRing[V]) Oldest() V {
+	return last.next.val
+}
+
 // Do executes a `fn` function for each element. If the functions returns true
 // it will stop iterating.
 func (last *MessageRing[V]) Do(fn func(msg *MessageRing[V], index int) bool) {
-	fn(last, 0)
+	if fn(last, 0) {
+		return
+	}
 	for prev, i := last.prev, 1; prev != last; prev, i = prev.prev, i+1 {
 		if fn(prev, i) {
 			return
@@ -135,6 +294,20 @@ func (last *MessageRing[V]) Filter(fn func(val V) bool) []V {
 	return msgs
 }
 
+// Replace overrides every element that matches a `fn` function with `val` and
+// returns the number of replaced elements
+func (last *MessageRing[V]) Replace(fn func(val V) bool, val V) int {
+	n := 0
+	last.Do(func(msg *MessageRing[V], _ int) bool {
+		if fn(msg.val) {
+			msg.val = val
+			n++
+		}
+		return false
+	})
+	return n
+}
+
 func (last *MessageRing[V]) All() []V {
 	all := make([]V, last.size)
 	last.Do(func(msg *MessageRing[V], i int) bool {
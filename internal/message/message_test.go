@@ -3,6 +3,7 @@ package message
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 )
@@ -155,6 +156,8 @@ func TestFind(t *testing.T) {
 		{val: &NestedVal{90}, user: &User{"ddd"}, id: "9"},
 		{val: &NestedVal{100}, user: &User{"ddd"}, id: "10"},
 		{val: &NestedVal{10}, user: &User{"eee"}, id: "11"},
+		{val: &NestedVal{20}, user: &User{"fff"}, id: "12"},
+		{val: &NestedVal{30}, user: &User{"ggg"}, id: "12"},
 	}
 	tests := []struct {
 		desc  string
@@ -165,6 +168,7 @@ func TestFind(t *testing.T) {
 		{desc: "find:8", input: "8", want: initialMsgs[9]},
 		{desc: "find:10", input: "10", want: initialMsgs[11]},
 		{desc: "find:100", input: "100", want: Msg{}},
+		{desc: "find:12 most recent", input: "12", want: initialMsgs[14]},
 	}
 
 	msgRing := New(15, Msg{user: &User{""}})
@@ -187,3 +191,70 @@ func TestFind(t *testing.T) {
 	}
 
 }
+
+func TestReplace(t *testing.T) {
+	t.Parallel()
+	msgRing := New(5, 0)
+	for _, v := range []int{1, 2, 1, 3, 1, 4} {
+		msgRing = msgRing.Append(v)
+	}
+
+	n := msgRing.Replace(func(v int) bool {
+		return v == 1
+	}, -1)
+	if n != 2 {
+		t.Fatalf("replaced: got %d, want %d", n, 2)
+	}
+	got, want := msgRing.All(), []int{4, -1, 3, -1, 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestTimeToAction(t *testing.T) {
+	t.Parallel()
+	at := time.Date(2023, 7, 19, 14, 50, 0, 0, time.UTC)
+	tests := []struct {
+		desc   string
+		msg    *Message
+		want   time.Duration
+		wantOk bool
+	}{
+		{"no messages", &Message{At: at}, 0, false},
+		{"unknown time", &Message{At: at, LastMessages: []*PrivateMessage{{}}}, 0, false},
+		{"most recent", &Message{At: at, LastMessages: []*PrivateMessage{
+			{At: at.Add(-3 * time.Second)},
+			{At: at.Add(-time.Minute)},
+		}}, 3 * time.Second, true},
+		{"skewed clocks", &Message{At: at, LastMessages: []*PrivateMessage{{At: at.Add(time.Second)}}}, 0, false},
+	}
+	for _, test := range tests {
+		got, ok := test.msg.TimeToAction()
+		if got != test.want || ok != test.wantOk {
+			t.Errorf("%s: got (%s, %t), want (%s, %t)", test.desc, got, ok, test.want, test.wantOk)
+		}
+	}
+}
+
+func TestBucketOf(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		seconds int
+		want    TimeoutBucket
+	}{
+		{1, TimeoutPurge},
+		{10, TimeoutPurge},
+		{11, TimeoutWarning},
+		{600, TimeoutWarning},
+		{3599, TimeoutWarning},
+		{3600, TimeoutSerious},
+		{86400, TimeoutSerious},
+		{86401, TimeoutSevere},
+		{1209600, TimeoutSevere},
+	}
+	for _, test := range tests {
+		if got := BucketOf(test.seconds); got != test.want {
+			t.Errorf("%d: got: %v, want: %v", test.seconds, got, test.want)
+		}
+	}
+}
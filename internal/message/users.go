@@ -0,0 +1,80 @@
+package message
+
+import "container/list"
+
+// UserHistory keeps the most recent messages of every user of a channel, so
+// the messages of a user are found even if they already left the history of
+// the channel, e.g. in fast chats. Up to `users` users are kept, once full the
+// least recently active user is evicted. It is not safe for concurrent use.
+type UserHistory struct {
+	size  int
+	users int
+	// lru has the entries of the users, the most recently active first
+	lru    *list.List
+	byUser map[string]*list.Element
+}
+
+type userEntry struct {
+	username string
+	// msgs are the messages of the user, the oldest first
+	msgs []*PrivateMessage
+}
+
+// Append adds privmsg to the messages of its user, dropping the oldest one if
+// the user already has `size` messages
+func (h *UserHistory) Append(privmsg *PrivateMessage) {
+	if el, ok := h.byUser[privmsg.Username]; ok {
+		e := el.Value.(*userEntry)
+		if len(e.msgs) == h.size {
+			copy(e.msgs, e.msgs[1:])
+			e.msgs = e.msgs[:h.size-1]
+		}
+		e.msgs = append(e.msgs, privmsg)
+		h.lru.MoveToFront(el)
+		return
+	}
+	if h.lru.Len() == h.users {
+		oldest := h.lru.Back()
+		delete(h.byUser, oldest.Value.(*userEntry).username)
+		h.lru.Remove(oldest)
+	}
+	e := &userEntry{username: privmsg.Username, msgs: make([]*PrivateMessage, 0, h.size)}
+	e.msgs = append(e.msgs, privmsg)
+	h.byUser[privmsg.Username] = h.lru.PushFront(e)
+}
+
+// Filter returns the messages of `username` that match a filter `fn`
+// function, the most recent first like MessageRing.Filter
+func (h *UserHistory) Filter(username string, fn func(privmsg *PrivateMessage) bool) []*PrivateMessage {
+	el, ok := h.byUser[username]
+	if !ok {
+		return []*PrivateMessage{}
+	}
+	msgs := el.Value.(*userEntry).msgs
+	matched := make([]*PrivateMessage, 0, len(msgs))
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if fn(msgs[i]) {
+			matched = append(matched, msgs[i])
+		}
+	}
+	return matched
+}
+
+// Forget removes the messages of `username`
+func (h *UserHistory) Forget(username string) {
+	if el, ok := h.byUser[username]; ok {
+		delete(h.byUser, username)
+		h.lru.Remove(el)
+	}
+}
+
+// NewUserHistory creates a history of the last `size` messages of up to
+// `users` users
+func NewUserHistory(size, users int) *UserHistory {
+	return &UserHistory{
+		size:   size,
+		users:  users,
+		lru:    list.New(),
+		byUser: make(map[string]*list.Element),
+	}
+}
@@ -0,0 +1,46 @@
+package message
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUserHistory(t *testing.T) {
+	t.Parallel()
+	h := NewUserHistory(2, 2)
+	for _, privmsg := range []*PrivateMessage{
+		{Username: "a", Body: "1"},
+		{Username: "b", Body: "2"},
+		{Username: "a", Body: "3"},
+		{Username: "a", Body: "4"},
+		// evicts b, the least recently active
+		{Username: "c", Body: "5"},
+	} {
+		h.Append(privmsg)
+	}
+	all := func(*PrivateMessage) bool { return true }
+	bodies := func(msgs []*PrivateMessage) []string {
+		b := make([]string, 0, len(msgs))
+		for _, m := range msgs {
+			b = append(b, m.Body)
+		}
+		return b
+	}
+	tests := []struct {
+		username string
+		want     []string
+	}{
+		{"a", []string{"4", "3"}},
+		{"b", []string{}},
+		{"c", []string{"5"}},
+	}
+	for _, tt := range tests {
+		if got := bodies(h.Filter(tt.username, all)); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%s got: %v, want: %v", tt.username, got, tt.want)
+		}
+	}
+	h.Forget("a")
+	if got := h.Filter("a", all); len(got) != 0 {
+		t.Fatalf("forgotten got: %v, want none", bodies(got))
+	}
+}
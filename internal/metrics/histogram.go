@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Histogram counts the observations by bucket
+type Histogram struct {
+	// Buckets are the upper bounds of the buckets, sorted. Observations greater
+	// than the last one are only counted in Count
+	Buckets []float64 `json:"buckets"`
+	// Counts are the observations of every bucket, not cumulative
+	Counts []uint64 `json:"counts"`
+	Sum    float64  `json:"sum"`
+	Count  uint64   `json:"count"`
+}
+
+func (h *Histogram) Observe(v float64) {
+	if i := sort.SearchFloat64s(h.Buckets, v); i < len(h.Buckets) {
+		h.Counts[i]++
+	}
+	h.Sum += v
+	h.Count++
+}
+
+// merge adds the observations of o, with the same buckets, to h
+func (h *Histogram) merge(o *Histogram) {
+	for i, n := range o.Counts {
+		h.Counts[i] += n
+	}
+	h.Sum += o.Sum
+	h.Count += o.Count
+}
+
+func (h *Histogram) copy() *Histogram {
+	cp := *h
+	cp.Counts = append([]uint64(nil), h.Counts...)
+	return &cp
+}
+
+// NewHistogram creates a histogram with the upper bounds `buckets`, sorted
+func NewHistogram(buckets []float64) *Histogram {
+	return &Histogram{Buckets: buckets, Counts: make([]uint64, len(buckets))}
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	// top limits the cardinality of the label at index channel, if not nil
+	top     *TopChannels
+	channel int
+
+	mu     sync.Mutex
+	values map[string]*Histogram
+}
+
+// LimitChannels limits the cardinality of the `label` label with top. See
+// TopChannels
+func (h *HistogramVec) LimitChannels(label string, top *TopChannels) *HistogramVec {
+	for i, l := range h.labels {
+		if l == label {
+			h.channel = i
+			h.top = top
+		}
+	}
+	return h
+}
+
+// Observe adds v to the histogram with the given label values, in the same
+// order as the labels of the histogram
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	key := strings.Join(values, keySep)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hist, ok := h.values[key]
+	if !ok {
+		hist = NewHistogram(h.buckets)
+		h.values[key] = hist
+	}
+	hist.Observe(v)
+}
+
+func (h *HistogramVec) Write(w io.Writer) {
+	h.mu.Lock()
+	values := make(map[string]*Histogram, len(h.values))
+	for k, hist := range h.values {
+		values[k] = hist.copy()
+	}
+	h.mu.Unlock()
+
+	if h.top != nil {
+		totals := make(map[string]float64)
+		for k, hist := range values {
+			totals[strings.Split(k, keySep)[h.channel]] += float64(hist.Count)
+		}
+		allowed := h.top.assign(totals)
+		limited := make(map[string]*Histogram, len(values))
+		for k, hist := range values {
+			lv := strings.Split(k, keySep)
+			if !allowed[lv[h.channel]] {
+				lv[h.channel] = OtherChannels
+			}
+			key := strings.Join(lv, keySep)
+			if merged, ok := limited[key]; ok {
+				merged.merge(hist)
+			} else {
+				limited[key] = hist
+			}
+		}
+		values = limited
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	writeHeader(w, h.name, h.help, "histogram")
+	labels := append(append([]string(nil), h.labels...), "le")
+	for _, k := range keys {
+		hist, lv := values[k], strings.Split(k, keySep)
+		var cumulative uint64
+		for i, b := range hist.Buckets {
+			cumulative += hist.Counts[i]
+			writeSample(w, h.name+"_bucket", labels, append(lv, strconv.FormatFloat(b, 'g', -1, 64)), float64(cumulative))
+		}
+		writeSample(w, h.name+"_bucket", labels, append(lv, "+Inf"), float64(hist.Count))
+		writeSample(w, h.name+"_sum", h.labels, lv, hist.Sum)
+		writeSample(w, h.name+"_count", h.labels, lv, float64(hist.Count))
+	}
+}
+
+// NewHistogramVec creates a histogram with the upper bounds `buckets`, sorted,
+// and registers it in the Default registry
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		values:  make(map[string]*Histogram),
+	}
+	Default.Register(h)
+	return h
+}
@@ -0,0 +1,316 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OtherChannels is the channel label of the channels out of the top
+const OtherChannels = "other"
+
+// Collector is anything that can write itself in the Prometheus text
+// exposition format
+type Collector interface {
+	Write(w io.Writer)
+}
+
+// Registry is a set of collectors exposed together
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// Write writes all the collectors in the Prometheus text exposition format
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	collectors := make([]Collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	r.mu.Unlock()
+	for _, c := range collectors {
+		c.Write(w)
+	}
+}
+
+// Handler serves the metrics of the registry
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		bw := bufio.NewWriter(w)
+		r.Write(bw)
+		bw.Flush()
+	})
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Default is the registry where every metric created with the New* functions is
+// registered
+var Default = NewRegistry()
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeSample(w io.Writer, name string, labels, values []string, v float64) {
+	if len(labels) == 0 {
+		fmt.Fprintf(w, "%s %g\n", name, v)
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString(name)
+	sb.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, `%s="%s"`, l, labelEscaper.Replace(values[i]))
+	}
+	sb.WriteByte('}')
+	fmt.Fprintf(w, "%s %g\n", sb.String(), v)
+}
+
+// TopChannels limits the cardinality of the channel label. Slots are handed
+// out to the busiest channels without one every time the metrics are written,
+// while there are free slots. Once a channel has a slot it keeps it so its
+// series never moves between labels, which would break the rates. Channels
+// without a slot are aggregated as OtherChannels.
+type TopChannels struct {
+	n     int
+	mu    sync.Mutex
+	slots map[string]struct{}
+}
+
+// assign hands out free slots to the busiest channels in totals and returns
+// whether each channel has a slot
+func (t *TopChannels) assign(totals map[string]float64) map[string]bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.slots) < t.n {
+		candidates := make([]string, 0, len(totals))
+		for ch := range totals {
+			if _, ok := t.slots[ch]; !ok {
+				candidates = append(candidates, ch)
+			}
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			if totals[candidates[i]] == totals[candidates[j]] {
+				return candidates[i] < candidates[j]
+			}
+			return totals[candidates[i]] > totals[candidates[j]]
+		})
+		for _, ch := range candidates {
+			if len(t.slots) >= t.n {
+				break
+			}
+			t.slots[ch] = struct{}{}
+		}
+	}
+	allowed := make(map[string]bool, len(totals))
+	for ch := range totals {
+		_, allowed[ch] = t.slots[ch]
+	}
+	return allowed
+}
+
+func NewTopChannels(n int) *TopChannels {
+	return &TopChannels{n: n, slots: make(map[string]struct{})}
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+	// top limits the cardinality of the label at index channel, if not nil
+	top     *TopChannels
+	channel int
+
+	mu sync.Mutex
+	// values are pointers so the hot counters are added without writing the
+	// map, see Add
+	values map[string]*float64
+}
+
+const keySep = "\xff"
+
+// LimitChannels limits the cardinality of the `label` label with top. See
+// TopChannels
+func (c *CounterVec) LimitChannels(label string, top *TopChannels) *CounterVec {
+	for i, l := range c.labels {
+		if l == label {
+			c.channel = i
+			c.top = top
+		}
+	}
+	return c
+}
+
+// Add adds v to the counter with the given label values, in the same order
+// as the labels of the counter
+//
+// The key of the values is built on the stack, and only the first add of every
+// combination allocates
+func (c *CounterVec) Add(v float64, values ...string) {
+	var buf [128]byte
+	key := buf[:0]
+	for i, value := range values {
+		if i > 0 {
+			key = append(key, keySep...)
+		}
+		key = append(key, value...)
+	}
+	c.mu.Lock()
+	if p, ok := c.values[string(key)]; ok {
+		*p += v
+	} else {
+		p := new(float64)
+		*p = v
+		c.values[string(key)] = p
+	}
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Sample is the value of a counter for some label values
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+// Samples returns the current value of every label combination, without
+// limiting the channels
+func (c *CounterVec) Samples() []Sample {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	samples := make([]Sample, 0, len(c.values))
+	for k, v := range c.values {
+		samples = append(samples, Sample{Labels: strings.Split(k, keySep), Value: *v})
+	}
+	return samples
+}
+
+func (c *CounterVec) Write(w io.Writer) {
+	c.mu.Lock()
+	values := make(map[string]float64, len(c.values))
+	for k, v := range c.values {
+		values[k] = *v
+	}
+	c.mu.Unlock()
+
+	if c.top != nil {
+		totals := make(map[string]float64)
+		for k, v := range values {
+			totals[strings.Split(k, keySep)[c.channel]] += v
+		}
+		allowed := c.top.assign(totals)
+		limited := make(map[string]float64, len(values))
+		for k, v := range values {
+			lv := strings.Split(k, keySep)
+			if !allowed[lv[c.channel]] {
+				lv[c.channel] = OtherChannels
+			}
+			limited[strings.Join(lv, keySep)] += v
+		}
+		values = limited
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	writeHeader(w, c.name, c.help, "counter")
+	for _, k := range keys {
+		writeSample(w, c.name, c.labels, strings.Split(k, keySep), values[k])
+	}
+}
+
+// NewCounterVec creates a counter and registers it in the Default registry
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]*float64),
+	}
+	Default.Register(c)
+	return c
+}
+
+// GaugeFunc is a gauge whose value is computed when the metrics are written
+type GaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+func (g *GaugeFunc) Write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	writeSample(w, g.name, nil, nil, g.fn())
+}
+
+// NewGaugeFunc creates a gauge and registers it in the Default registry
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, fn: fn}
+	Default.Register(g)
+	return g
+}
+
+// Info is a gauge always 1 whose labels describe the process, e.g. its
+// version, joined with other series by the queries
+type Info struct {
+	name   string
+	help   string
+	labels []string
+	values []string
+}
+
+func (i *Info) Write(w io.Writer) {
+	writeHeader(w, i.name, i.help, "gauge")
+	writeSample(w, i.name, i.labels, i.values, 1)
+}
+
+// NewInfo creates an info gauge with the values of the labels in the same
+// order and registers it in the Default registry
+func NewInfo(name, help string, labels, values []string) *Info {
+	i := &Info{name: name, help: help, labels: labels, values: values}
+	Default.Register(i)
+	return i
+}
+
+var startTime = time.Now()
+
+func init() {
+	NewGaugeFunc("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", func() float64 {
+		return float64(startTime.Unix())
+	})
+	NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+	NewGaugeFunc("go_memstats_heap_alloc_bytes", "Number of heap bytes allocated and still in use.", func() float64 {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		return float64(m.HeapAlloc)
+	})
+}
@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCounterVecTopChannels(t *testing.T) {
+	t.Parallel()
+	c := &CounterVec{
+		name:   "test_total",
+		help:   "Test.",
+		labels: []string{"channel", "type"},
+		values: make(map[string]*float64),
+	}
+	c.LimitChannels("channel", NewTopChannels(2))
+
+	c.Add(5, "foo", "ban")
+	c.Add(3, "bar", "ban")
+	c.Add(1, "baz", "ban")
+	c.Add(1, "qux", "ban")
+	c.Add(2, "bar", "timeout")
+
+	var sb strings.Builder
+	c.Write(&sb)
+	want := `# HELP test_total Test.
+# TYPE test_total counter
+test_total{channel="bar",type="ban"} 3
+test_total{channel="bar",type="timeout"} 2
+test_total{channel="foo",type="ban"} 5
+test_total{channel="other",type="ban"} 2
+`
+	if got := sb.String(); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// slots are sticky, even if baz becomes the busiest channel
+	c.Add(100, "baz", "ban")
+	sb.Reset()
+	c.Write(&sb)
+	if !strings.Contains(sb.String(), `test_total{channel="other",type="ban"} 102`) {
+		t.Fatalf("expected baz to be aggregated in other:\n%s", sb.String())
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	t.Parallel()
+	var sb strings.Builder
+	writeSample(&sb, "m", []string{"l"}, []string{"a\"b\\c\n"}, 1)
+	if got, want := sb.String(), "m{l=\"a\\\"b\\\\c\\n\"} 1\n"; got != want {
+		t.Fatalf("got: %q, want: %q", got, want)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	t.Parallel()
+	i := &Info{name: "test_info", help: "Test.", labels: []string{"version", "commit"}, values: []string{"0.0.1", "1a2b3c4"}}
+	var sb strings.Builder
+	i.Write(&sb)
+	want := `# HELP test_info Test.
+# TYPE test_info gauge
+test_info{version="0.0.1",commit="1a2b3c4"} 1
+`
+	if got := sb.String(); got != want {
+		t.Fatalf("got: %q, want: %q", got, want)
+	}
+}
+
+func TestWindowVec(t *testing.T) {
+	t.Parallel()
+	v := NewWindowVec(4, 1)
+	for _, s := range []float64{100, 1, 2, 3, 4} {
+		v.Observe("foo", s)
+	}
+	v.Observe("bar", 7)
+	v.Observe("baz", 9)
+
+	got := v.Summaries()
+	want := map[string]Summary{
+		// 100 was rotated out of the window
+		"foo":         {Count: 4, Median: 2, P90: 4},
+		OtherChannels: {Count: 2, Median: 7, P90: 9},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for key, s := range want {
+		if got[key] != s {
+			t.Fatalf("%s: got %+v, want %+v", key, got[key], s)
+		}
+	}
+}
+
+func TestHistogramVecTopChannels(t *testing.T) {
+	t.Parallel()
+	h := &HistogramVec{
+		name:    "test_seconds",
+		help:    "Test.",
+		labels:  []string{"channel"},
+		buckets: []float64{1, 5},
+		values:  make(map[string]*Histogram),
+	}
+	h.LimitChannels("channel", NewTopChannels(1))
+
+	h.Observe(0.5, "foo")
+	h.Observe(3, "foo")
+	h.Observe(1, "bar")
+	h.Observe(10, "baz")
+
+	var sb strings.Builder
+	h.Write(&sb)
+	want := `# HELP test_seconds Test.
+# TYPE test_seconds histogram
+test_seconds_bucket{channel="foo",le="1"} 1
+test_seconds_bucket{channel="foo",le="5"} 2
+test_seconds_bucket{channel="foo",le="+Inf"} 2
+test_seconds_sum{channel="foo"} 3.5
+test_seconds_count{channel="foo"} 2
+test_seconds_bucket{channel="other",le="1"} 1
+test_seconds_bucket{channel="other",le="5"} 1
+test_seconds_bucket{channel="other",le="+Inf"} 2
+test_seconds_sum{channel="other"} 11
+test_seconds_count{channel="other"} 2
+`
+	if got := sb.String(); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCounterVecAddAllocs(t *testing.T) {
+	c := &CounterVec{labels: []string{"channel", "type"}, values: make(map[string]*float64)}
+	c.Add(1, "foo", "privmsg")
+	if n := testing.AllocsPerRun(100, func() { c.Add(1, "foo", "privmsg") }); n != 0 {
+		t.Errorf("got: %v allocs, want: %v", n, 0)
+	}
+	// AllocsPerRun runs the function once more to warm up
+	if got := c.Samples()[0].Value; got != 102 {
+		t.Errorf("got: %v, want: %v", got, 102)
+	}
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+)
+
+// Summary summarizes the samples of a window
+type Summary struct {
+	Count  int     `json:"count"`
+	Median float64 `json:"median"`
+	P90    float64 `json:"p90"`
+}
+
+// Summarize returns the summary of the samples. The samples are sorted in
+// place
+func Summarize(samples []float64) Summary {
+	sort.Float64s(samples)
+	return Summary{
+		Count:  len(samples),
+		Median: Quantile(samples, .5),
+		P90:    Quantile(samples, .9),
+	}
+}
+
+// Quantile returns the q-quantile of the sorted samples with the nearest-rank
+// method, 0 if there are no samples
+func Quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(q*float64(len(sorted))+.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// window is a ring with the most recent samples
+type window struct {
+	samples []float64
+	next    int
+	full    bool
+}
+
+func (w *window) observe(v float64) {
+	w.samples[w.next] = v
+	w.next = (w.next + 1) % len(w.samples)
+	if w.next == 0 {
+		w.full = true
+	}
+}
+
+func (w *window) values() []float64 {
+	n := w.next
+	if w.full {
+		n = len(w.samples)
+	}
+	cp := make([]float64, n)
+	copy(cp, w.samples[:n])
+	return cp
+}
+
+// WindowVec keeps the most recent samples of every key, e.g. of every channel,
+// to summarize them. Only the first maxKeys keys have their own window, the
+// rest share the OtherChannels window
+type WindowVec struct {
+	size    int
+	maxKeys int
+
+	mu      sync.Mutex
+	windows map[string]*window
+}
+
+func (v *WindowVec) Observe(key string, value float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	w, ok := v.windows[key]
+	if !ok {
+		if len(v.windows) >= v.maxKeys {
+			key = OtherChannels
+			w = v.windows[key]
+		}
+		if w == nil {
+			w = &window{samples: make([]float64, v.size)}
+			v.windows[key] = w
+		}
+	}
+	w.observe(value)
+}
+
+// Summaries returns the summary of the window of every key
+func (v *WindowVec) Summaries() map[string]Summary {
+	v.mu.Lock()
+	values := make(map[string][]float64, len(v.windows))
+	for key, w := range v.windows {
+		values[key] = w.values()
+	}
+	v.mu.Unlock()
+
+	all := make(map[string]Summary, len(values))
+	for key, samples := range values {
+		all[key] = Summarize(samples)
+	}
+	return all
+}
+
+// NewWindowVec creates a WindowVec that keeps the last `size` samples of the
+// first `maxKeys` keys
+func NewWindowVec(size, maxKeys int) *WindowVec {
+	return &WindowVec{size: size, maxKeys: maxKeys, windows: make(map[string]*window)}
+}
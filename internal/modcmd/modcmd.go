@@ -0,0 +1,97 @@
+// Package modcmd parses the commands of the moderation bots typed in chat,
+// e.g. `!ban user spamming links` or `!timeout @user 10m caps`, so the reason
+// of a moderation can be inferred when the source doesn't give it.
+package modcmd
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+// Default commands of the common moderation bots
+var (
+	DefaultBan     = []string{"!ban", "!b"}
+	DefaultTimeout = []string{"!timeout", "!to"}
+)
+
+// Command is a parsed moderation command
+type Command struct {
+	Type message.MessageType
+	// Target is the login of the moderated user, lowercase and without @
+	Target string
+	// Duration is the duration of a timeout, 0 if not given
+	Duration time.Duration
+	// Reason is the rest of the command, empty if not given
+	Reason string
+}
+
+// Parser parses the commands of the moderation bots. The commands are matched
+// case-insensitively
+type Parser struct {
+	commands map[string]message.MessageType
+}
+
+// Parse returns the moderation command of the body of a chat message, false
+// if it is not one or it has no target. The duration of a timeout is optional
+// and may be in seconds, e.g. "600", or have a unit, e.g. "10m"
+func (p *Parser) Parse(body string) (*Command, bool) {
+	fields := strings.Fields(body)
+	if len(fields) < 2 {
+		return nil, false
+	}
+	typ, ok := p.commands[strings.ToLower(fields[0])]
+	if !ok {
+		return nil, false
+	}
+	cmd := &Command{Type: typ, Target: strings.ToLower(strings.TrimPrefix(fields[1], "@"))}
+	if cmd.Target == "" {
+		return nil, false
+	}
+	rest := fields[2:]
+	if typ == message.MessageTimeout && len(rest) > 0 {
+		if d, ok := duration(rest[0]); ok {
+			cmd.Duration = d
+			rest = rest[1:]
+		}
+	}
+	cmd.Reason = strings.Join(rest, " ")
+	return cmd, true
+}
+
+// units are the units of the durations of the timeouts
+var units = map[byte]time.Duration{
+	's': time.Second,
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+// duration parses the duration of a timeout, in seconds or with a unit of
+// units
+func duration(s string) (time.Duration, bool) {
+	unit := time.Second
+	if u, ok := units[s[len(s)-1]]; ok {
+		unit, s = u, s[:len(s)-1]
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// New returns a parser of the commands `ban` and `timeout`, e.g. "!ban"
+func New(ban, timeout []string) *Parser {
+	p := &Parser{commands: make(map[string]message.MessageType, len(ban)+len(timeout))}
+	for _, c := range ban {
+		p.commands[strings.ToLower(c)] = message.MessageBan
+	}
+	for _, c := range timeout {
+		p.commands[strings.ToLower(c)] = message.MessageTimeout
+	}
+	return p
+}
@@ -0,0 +1,36 @@
+package modcmd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/message"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	p := New(DefaultBan, DefaultTimeout)
+	tests := []struct {
+		body string
+		want *Command
+	}{
+		{"!ban foo spamming links", &Command{Type: message.MessageBan, Target: "foo", Reason: "spamming links"}},
+		{"!B @Foo", &Command{Type: message.MessageBan, Target: "foo"}},
+		{"!timeout foo 10m caps", &Command{Type: message.MessageTimeout, Target: "foo", Duration: 10 * time.Minute, Reason: "caps"}},
+		{"!to foo 600", &Command{Type: message.MessageTimeout, Target: "foo", Duration: 600 * time.Second}},
+		{"!timeout foo 2 many emotes", &Command{Type: message.MessageTimeout, Target: "foo", Duration: 2 * time.Second, Reason: "many emotes"}},
+		{"!timeout foo calm down", &Command{Type: message.MessageTimeout, Target: "foo", Reason: "calm down"}},
+		{"!ban foo 10m spam", &Command{Type: message.MessageBan, Target: "foo", Reason: "10m spam"}},
+		{"!ban", nil},
+		{"!ban @", nil},
+		{"!unban foo", nil},
+		{"ban foo spam", nil},
+	}
+	for _, tt := range tests {
+		got, ok := p.Parse(tt.body)
+		if ok != (tt.want != nil) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) got: %+v, want: %+v", tt.body, got, tt.want)
+		}
+	}
+}
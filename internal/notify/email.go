@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+var ErrNoRecipients = errors.New("email notifier without recipients")
+
+// Email sends the notifications by email through an SMTP server, upgrading the
+// connection with STARTTLS if the server supports it
+type Email struct {
+	addr string
+	host string
+	// auth is nil if the server requires no credentials
+	auth smtp.Auth
+	from string
+	to   []string
+}
+
+func (e *Email) Notify(ctx context.Context, n *Notification) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", e.addr)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		conn.Close()
+		return errors.Wrap(err)
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: e.host}); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	if e.auth != nil {
+		if err := c.Auth(e.auth); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	if err := c.Mail(e.from); err != nil {
+		return errors.Wrap(err)
+	}
+	for _, to := range e.to {
+		if err := c.Rcpt(to); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if _, err := w.Write(e.message(n, time.Now())); err != nil {
+		return errors.Wrap(err)
+	}
+	if err := w.Close(); err != nil {
+		return errors.Wrap(err)
+	}
+	if err := c.Quit(); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// message returns the email of the notification sent at `now`
+func (e *Email) message(n *Notification, now time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", e.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", n.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&b)
+	qp.Write([]byte(strings.ReplaceAll(n.Body, "\n", "\r\n")))
+	qp.Close()
+	return b.Bytes()
+}
+
+// NewEmail creates an email notifier sending to `to` from `from` through the
+// SMTP server at `addr`, "host:port". The username and password are optional
+func NewEmail(addr, username, password, from string, to []string) (*Email, error) {
+	if len(to) == 0 {
+		return nil, errors.Wrap(ErrNoRecipients)
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	e := &Email{addr: addr, host: host, from: from, to: to}
+	if username != "" {
+		e.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return e, nil
+}
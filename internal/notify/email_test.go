@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveSMTP accepts a single email in l and sends its data to `data`
+func serveSMTP(t *testing.T, l net.Listener, data chan<- string) {
+	conn, err := l.Accept()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 test")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(strings.Fields(line)[0]); cmd {
+		case "EHLO", "HELO", "MAIL", "RCPT":
+			reply("250 ok")
+		case "DATA":
+			reply("354 go on")
+			var sb strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil || line == ".\r\n" {
+					break
+				}
+				sb.WriteString(line)
+			}
+			data <- sb.String()
+			reply("250 ok")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 unsupported")
+		}
+	}
+}
+
+func TestEmail(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	data := make(chan string, 1)
+	go serveSMTP(t, l, data)
+
+	e, err := NewEmail(l.Addr().String(), "", "", "tracker@example.com", []string{"mods@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.Notify(ctx, &Notification{Subject: "Daily digest", Body: "foo: 2 bans\n"}); err != nil {
+		t.Fatal(err)
+	}
+	got := <-data
+	for _, want := range []string{"To: mods@example.com\r\n", "Subject: Daily digest\r\n", "\r\n\r\nfoo: 2 bans\r\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got: %q, want: %q in it", got, want)
+		}
+	}
+}
+
+func TestNewEmailErrors(t *testing.T) {
+	t.Parallel()
+	if _, err := NewEmail("smtp.example.com:587", "", "", "a@example.com", nil); err == nil {
+		t.Errorf("got: %v, want: %v", err, ErrNoRecipients)
+	}
+	if _, err := NewEmail("smtp.example.com", "", "", "a@example.com", []string{"b@example.com"}); err == nil {
+		t.Error("got: nil, want: an error of the address without port")
+	}
+}
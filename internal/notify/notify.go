@@ -0,0 +1,20 @@
+// Package notify sends the low-frequency reports of the tracker, like the daily
+// digest or the summary of an incident, to the people behind a channel or a
+// tenant. Notifiers are pluggable, see Notifier, and Email is the built-in one.
+//
+// Unlike the webhooks, notifications are meant to be read by people: they are
+// plain text, sent at most a few times a day, and never retried.
+package notify
+
+import "context"
+
+// Notification is a report, in plain text
+type Notification struct {
+	Subject string
+	Body    string
+}
+
+// Notifier sends notifications. It must be safe for concurrent use
+type Notifier interface {
+	Notify(ctx context.Context, n *Notification) error
+}
@@ -0,0 +1,368 @@
+// Package parquet is a minimal writer of Parquet files: flat schemas of
+// primitive columns, a single row group per file, PLAIN encoding and snappy
+// compression. It covers what the exporter needs and nothing else.
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/hammertrack/tracker/errors"
+)
+
+const magic = "PAR1"
+
+// Type is the physical type of a column
+type Type int32
+
+const (
+	Int32     Type = 1
+	Int64     Type = 2
+	Double    Type = 5
+	ByteArray Type = 6
+)
+
+// Logical annotates how a physical type is interpreted
+type Logical int
+
+const (
+	NoLogical Logical = iota
+	// String annotates a ByteArray column as UTF-8
+	String
+	// TimestampMicros annotates an Int64 column as microseconds since the unix
+	// epoch, adjusted to UTC
+	TimestampMicros
+)
+
+// parquet enums
+const (
+	repetitionRequired = 0
+	repetitionOptional = 1
+	convertedUTF8      = 0
+	convertedTsMicros  = 10
+	encodingPlain      = 0
+	encodingRLE        = 3
+	codecSnappy        = 1
+	pageData           = 0
+)
+
+var (
+	ErrColumnCount = errors.New("the number of values does not match the number of columns")
+	ErrValueType   = errors.New("value of the wrong type for the column")
+	ErrNullValue   = errors.New("null value in a required column")
+)
+
+type Column struct {
+	Name string
+	// FieldID is the id of the field in the table schema, written only if not
+	// zero
+	FieldID  int32
+	Type     Type
+	Logical  Logical
+	Optional bool
+}
+
+type columnChunk struct {
+	values bytes.Buffer
+	// defined is whether each value is not null, for optional columns
+	defined []bool
+}
+
+// Writer buffers the rows in memory, column by column, and writes the file on
+// Close.
+type Writer struct {
+	w       io.Writer
+	columns []Column
+	chunks  []*columnChunk
+	rows    int64
+	meta    [][2]string
+}
+
+// SetMetadata sets a key-value pair in the metadata of the file
+func (w *Writer) SetMetadata(key, value string) {
+	w.meta = append(w.meta, [2]string{key, value})
+}
+
+// Rows returns the number of rows written
+func (w *Writer) Rows() int64 {
+	return w.rows
+}
+
+// Write appends a row with a value per column, in the same order as the
+// columns. Int32 columns take int32, Int64 columns int64 or time.Time if they
+// are TimestampMicros, Double columns float64 and ByteArray columns string or
+// []byte. Optional columns also take nil.
+func (w *Writer) Write(row ...interface{}) error {
+	if len(row) != len(w.columns) {
+		return errors.Wrap(ErrColumnCount)
+	}
+	// validate first so a bad row does not leave the columns unaligned
+	for i, v := range row {
+		if err := checkValue(&w.columns[i], v); err != nil {
+			return err
+		}
+	}
+	for i, v := range row {
+		c := w.chunks[i]
+		if w.columns[i].Optional {
+			c.defined = append(c.defined, v != nil)
+		}
+		if v != nil {
+			encodePlain(&c.values, v)
+		}
+	}
+	w.rows++
+	return nil
+}
+
+func checkValue(col *Column, v interface{}) error {
+	if v == nil {
+		if !col.Optional {
+			return errors.WrapWithContext(ErrNullValue, struct{ Column string }{col.Name})
+		}
+		return nil
+	}
+	ok := false
+	switch v.(type) {
+	case int32:
+		ok = col.Type == Int32
+	case int64:
+		ok = col.Type == Int64
+	case time.Time:
+		ok = col.Type == Int64 && col.Logical == TimestampMicros
+	case float64:
+		ok = col.Type == Double
+	case string, []byte:
+		ok = col.Type == ByteArray
+	}
+	if !ok {
+		return errors.WrapWithContext(ErrValueType, struct{ Column string }{col.Name})
+	}
+	return nil
+}
+
+func encodePlain(buf *bytes.Buffer, v interface{}) {
+	var b [8]byte
+	switch v := v.(type) {
+	case int32:
+		binary.LittleEndian.PutUint32(b[:4], uint32(v))
+		buf.Write(b[:4])
+	case int64:
+		binary.LittleEndian.PutUint64(b[:], uint64(v))
+		buf.Write(b[:])
+	case time.Time:
+		binary.LittleEndian.PutUint64(b[:], uint64(v.UnixNano()/int64(time.Microsecond)))
+		buf.Write(b[:])
+	case float64:
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+		buf.Write(b[:])
+	case string:
+		binary.LittleEndian.PutUint32(b[:4], uint32(len(v)))
+		buf.Write(b[:4])
+		buf.WriteString(v)
+	case []byte:
+		binary.LittleEndian.PutUint32(b[:4], uint32(len(v)))
+		buf.Write(b[:4])
+		buf.Write(v)
+	}
+}
+
+// encodeLevels encodes the definition levels of an optional column with the
+// RLE/bit-packed hybrid encoding, as a single bit-packed run of bit width 1,
+// prefixed with its length
+func encodeLevels(buf *bytes.Buffer, defined []bool) {
+	groups := (len(defined) + 7) / 8
+	var run bytes.Buffer
+	var b [binary.MaxVarintLen64]byte
+	run.Write(b[:binary.PutUvarint(b[:], uint64(groups<<1|1))])
+	packed := make([]byte, groups)
+	for i, d := range defined {
+		if d {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	run.Write(packed)
+	binary.LittleEndian.PutUint32(b[:4], uint32(run.Len()))
+	buf.Write(b[:4])
+	buf.Write(run.Bytes())
+}
+
+// countingWriter tracks the offset in the file
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type chunkMeta struct {
+	offset       int64
+	uncompressed int64
+	compressed   int64
+	values       int64
+}
+
+// Close writes the file. It does not close the underlying writer
+func (w *Writer) Close() error {
+	cw := &countingWriter{w: w.w}
+	if _, err := io.WriteString(cw, magic); err != nil {
+		return errors.Wrap(err)
+	}
+
+	metas := make([]chunkMeta, len(w.columns))
+	for i, col := range w.columns {
+		c := w.chunks[i]
+		var page bytes.Buffer
+		if col.Optional {
+			encodeLevels(&page, c.defined)
+		}
+		page.Write(c.values.Bytes())
+		compressed := snappy.Encode(nil, page.Bytes())
+
+		var h thriftWriter
+		h.i32(1, pageData)
+		h.i32(2, int32(page.Len()))
+		h.i32(3, int32(len(compressed)))
+		h.structBegin(5)
+		h.i32(1, int32(w.rows))
+		h.i32(2, encodingPlain)
+		h.i32(3, encodingRLE)
+		h.i32(4, encodingRLE)
+		h.structEnd()
+		h.buf.WriteByte(0)
+
+		metas[i] = chunkMeta{
+			offset:       cw.n,
+			uncompressed: int64(h.buf.Len() + page.Len()),
+			compressed:   int64(h.buf.Len() + len(compressed)),
+			values:       w.rows,
+		}
+		if _, err := cw.Write(h.buf.Bytes()); err != nil {
+			return errors.Wrap(err)
+		}
+		if _, err := cw.Write(compressed); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	footer := w.footer(metas)
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(footer)))
+	for _, b := range [][]byte{footer, size[:], []byte(magic)} {
+		if _, err := cw.Write(b); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// footer encodes the FileMetaData
+func (w *Writer) footer(metas []chunkMeta) []byte {
+	var t thriftWriter
+	t.i32(1, 1)
+
+	t.list(2, tStruct, len(w.columns)+1)
+	// root of the schema
+	t.structBegin(0)
+	t.string(4, "schema")
+	t.i32(5, int32(len(w.columns)))
+	t.structEnd()
+	for _, col := range w.columns {
+		t.structBegin(0)
+		t.i32(1, int32(col.Type))
+		if col.Optional {
+			t.i32(3, repetitionOptional)
+		} else {
+			t.i32(3, repetitionRequired)
+		}
+		t.string(4, col.Name)
+		switch col.Logical {
+		case String:
+			t.i32(6, convertedUTF8)
+		case TimestampMicros:
+			t.i32(6, convertedTsMicros)
+		}
+		if col.FieldID != 0 {
+			t.i32(9, col.FieldID)
+		}
+		switch col.Logical {
+		case String:
+			t.structBegin(10)
+			t.structBegin(1)
+			t.structEnd()
+			t.structEnd()
+		case TimestampMicros:
+			t.structBegin(10)
+			t.structBegin(8)
+			t.bool(1, true)
+			t.structBegin(2)
+			t.structBegin(2)
+			t.structEnd()
+			t.structEnd()
+			t.structEnd()
+			t.structEnd()
+		}
+		t.structEnd()
+	}
+
+	t.i64(3, w.rows)
+
+	var total int64
+	for _, m := range metas {
+		total += m.uncompressed
+	}
+	t.list(4, tStruct, 1)
+	t.structBegin(0)
+	t.list(1, tStruct, len(w.columns))
+	for i, col := range w.columns {
+		m := metas[i]
+		t.structBegin(0)
+		t.i64(2, m.offset)
+		t.structBegin(3)
+		t.i32(1, int32(col.Type))
+		t.list(2, tI32, 2)
+		t.varint(zigzag(encodingPlain))
+		t.varint(zigzag(encodingRLE))
+		t.list(3, tBinary, 1)
+		t.rawString(col.Name)
+		t.i32(4, codecSnappy)
+		t.i64(5, m.values)
+		t.i64(6, m.uncompressed)
+		t.i64(7, m.compressed)
+		t.i64(9, m.offset)
+		t.structEnd()
+		t.structEnd()
+	}
+	t.i64(2, total)
+	t.i64(3, w.rows)
+	t.structEnd()
+
+	if len(w.meta) > 0 {
+		t.list(5, tStruct, len(w.meta))
+		for _, kv := range w.meta {
+			t.structBegin(0)
+			t.string(1, kv[0])
+			t.string(2, kv[1])
+			t.structEnd()
+		}
+	}
+	t.string(6, "hammertrack tracker")
+	t.buf.WriteByte(0)
+	return t.buf.Bytes()
+}
+
+func NewWriter(w io.Writer, columns []Column) *Writer {
+	chunks := make([]*columnChunk, len(columns))
+	for i := range chunks {
+		chunks[i] = &columnChunk{}
+	}
+	return &Writer{w: w, columns: columns, chunks: chunks}
+}
@@ -0,0 +1,150 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+// thriftReader decodes the thrift compact protocol into maps of field id to
+// value, enough to check what the writer produces
+type thriftReader struct {
+	b []byte
+	i int
+}
+
+func (r *thriftReader) varint() uint64 {
+	v, n := binary.Uvarint(r.b[r.i:])
+	r.i += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case tBoolTrue:
+		return true
+	case tBoolFalse:
+		return false
+	case tI32, tI64:
+		return r.zigzag()
+	case tBinary:
+		n := int(r.varint())
+		s := string(r.b[r.i : r.i+n])
+		r.i += n
+		return s
+	case tList:
+		h := r.b[r.i]
+		r.i++
+		size, elem := int(h>>4), h&0x0f
+		if size == 15 {
+			size = int(r.varint())
+		}
+		l := make([]interface{}, size)
+		for i := range l {
+			l[i] = r.value(elem)
+		}
+		return l
+	case tStruct:
+		return r.structure()
+	}
+	panic("unexpected thrift type")
+}
+
+func (r *thriftReader) structure() map[int16]interface{} {
+	s := make(map[int16]interface{})
+	var last int16
+	for {
+		h := r.b[r.i]
+		r.i++
+		if h == 0 {
+			return s
+		}
+		typ := h & 0x0f
+		if delta := int16(h >> 4); delta != 0 {
+			last += delta
+		} else {
+			last = int16(r.zigzag())
+		}
+		s[last] = r.value(typ)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	t.Parallel()
+	at := time.Date(2022, 3, 4, 10, 0, 0, 0, time.UTC)
+	cols := []Column{
+		{Name: "channel", FieldID: 1, Type: ByteArray, Logical: String},
+		{Name: "at", FieldID: 2, Type: Int64, Logical: TimestampMicros},
+		{Name: "toxicity", FieldID: 3, Type: Double, Optional: true},
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf, cols)
+	w.SetMetadata("k", "v")
+	if err := w.Write("foo", at, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write("bar", at, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(nil, at, nil); err == nil {
+		t.Fatal("expected an error writing null in a required column")
+	}
+	if err := w.Write("baz", "not a time", nil); err == nil {
+		t.Fatal("expected an error writing a value of the wrong type")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+	if string(b[:4]) != magic || string(b[len(b)-4:]) != magic {
+		t.Fatal("missing magic bytes")
+	}
+	size := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	footer := &thriftReader{b: b[len(b)-8-size : len(b)-8]}
+	meta := footer.structure()
+
+	if meta[3].(int64) != 2 {
+		t.Fatalf("expected 2 rows, got %v", meta[3])
+	}
+	schema := meta[2].([]interface{})
+	if len(schema) != len(cols)+1 {
+		t.Fatalf("expected %d schema elements, got %d", len(cols)+1, len(schema))
+	}
+	for i, col := range cols {
+		el := schema[i+1].(map[int16]interface{})
+		if el[4] != col.Name || el[9].(int64) != int64(col.FieldID) {
+			t.Fatalf("unexpected schema element for %s: %v", col.Name, el)
+		}
+	}
+	kv := meta[5].([]interface{})[0].(map[int16]interface{})
+	if kv[1] != "k" || kv[2] != "v" {
+		t.Fatalf("unexpected key-value metadata: %v", kv)
+	}
+
+	// read back the optional column
+	chunks := meta[4].([]interface{})[0].(map[int16]interface{})[1].([]interface{})
+	colMeta := chunks[2].(map[int16]interface{})[3].(map[int16]interface{})
+	page := &thriftReader{b: b, i: int(colMeta[9].(int64))}
+	header := page.structure()
+	data, err := snappy.Decode(nil, b[page.i:page.i+int(header[3].(int64))])
+	if err != nil {
+		t.Fatal(err)
+	}
+	levelsLen := int(binary.LittleEndian.Uint32(data))
+	// bit-packed run of a group, with the first value defined
+	if got := data[4 : 4+levelsLen]; !bytes.Equal(got, []byte{3, 1}) {
+		t.Fatalf("unexpected definition levels: %v", got)
+	}
+	if values := data[4+levelsLen:]; len(values) != 8 {
+		t.Fatalf("expected a single double, got %d bytes", len(values))
+	}
+}
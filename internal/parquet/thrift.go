@@ -0,0 +1,100 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// types of the thrift compact protocol
+const (
+	tBoolTrue  byte = 1
+	tBoolFalse byte = 2
+	tI32       byte = 5
+	tI64       byte = 6
+	tBinary    byte = 8
+	tList      byte = 9
+	tStruct    byte = 12
+)
+
+// thriftWriter encodes the parquet metadata with the thrift compact protocol.
+// Fields must be written in increasing order of id within each struct.
+type thriftWriter struct {
+	buf    bytes.Buffer
+	lastID int16
+	// stack of the last field ids of the enclosing structs
+	stack []int16
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	t.buf.Write(b[:n])
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	if delta := id - t.lastID; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(zigzag(int64(id)))
+	}
+	t.lastID = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, tI32)
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, tI64)
+	t.varint(zigzag(v))
+}
+
+func (t *thriftWriter) bool(id int16, v bool) {
+	if v {
+		t.field(id, tBoolTrue)
+	} else {
+		t.field(id, tBoolFalse)
+	}
+}
+
+func (t *thriftWriter) string(id int16, v string) {
+	t.field(id, tBinary)
+	t.rawString(v)
+}
+
+func (t *thriftWriter) rawString(v string) {
+	t.varint(uint64(len(v)))
+	t.buf.WriteString(v)
+}
+
+func (t *thriftWriter) list(id int16, elem byte, size int) {
+	t.field(id, tList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elem)
+	} else {
+		t.buf.WriteByte(0xf0 | elem)
+		t.varint(uint64(size))
+	}
+}
+
+// structBegin starts a struct field. With id 0 it starts a struct element of a
+// list instead
+func (t *thriftWriter) structBegin(id int16) {
+	if id != 0 {
+		t.field(id, tStruct)
+	}
+	t.stack = append(t.stack, t.lastID)
+	t.lastID = 0
+}
+
+func (t *thriftWriter) structEnd() {
+	t.buf.WriteByte(0)
+	t.lastID = t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+}
@@ -0,0 +1,108 @@
+// Package sampling picks a small random fraction of the ordinary chat messages,
+// i.e. the ones that were never moderated, to be used as negative samples when
+// training heuristics.
+package sampling
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+// HashPrefix is prepended to the hashed bodies, so they are told apart from
+// the raw ones
+const HashPrefix = "hmac-sha256:"
+
+// QueueSize is the number of samples waiting to be stored before new ones are
+// dropped
+const QueueSize = 100
+
+// ErrNoSecret is returned when the bodies are hashed without a secret. Chat
+// messages are short and predictable, a plain hash is reversed by guessing
+var ErrNoSecret = errors.New("hashed samples require a secret")
+
+// Sample is a chat message that was not moderated
+type Sample struct {
+	// ID is the id of the chat message
+	ID      string
+	Channel string
+	At      time.Time
+	// Body is either the raw body, scrubbed, or its keyed hash. See Sampler.Body
+	Body       string
+	Length     int
+	Subscribed int
+}
+
+// Sampler decides which messages are sampled. A message is sampled with
+// probability rate, but never more than max messages per minute, whatever the
+// volume of the chats. It is safe for concurrent use.
+type Sampler struct {
+	rate   float64
+	max    int
+	raw    bool
+	secret []byte
+
+	mu     sync.Mutex
+	rand   *rand.Rand
+	window time.Time
+	taken  int
+}
+
+// Take reports whether the message received at `now` is sampled
+func (s *Sampler) Take(now time.Time) bool {
+	if s.rate <= 0 || s.max <= 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rand.Float64() >= s.rate {
+		return false
+	}
+	if w := now.Truncate(time.Minute); !w.Equal(s.window) {
+		s.window = w
+		s.taken = 0
+	}
+	if s.taken >= s.max {
+		return false
+	}
+	s.taken++
+	return true
+}
+
+// Body returns the body to store: the body itself if the sampler keeps raw
+// bodies, otherwise its HMAC with the secret of the sampler, so equal bodies
+// are still told apart without being readable
+func (s *Sampler) Body(body string) string {
+	if s.raw {
+		return body
+	}
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(body))
+	return HashPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Raw returns whether the sampler keeps the raw bodies
+func (s *Sampler) Raw() bool {
+	return s.raw
+}
+
+// New creates a sampler of a `rate` fraction of the messages, from 0 to 1, up
+// to `max` messages per minute. If `raw` is false only the HMACs of the bodies
+// with `secret` are kept, and it fails with ErrNoSecret without one
+func New(rate float64, max int, raw bool, secret string) (*Sampler, error) {
+	if !raw && secret == "" {
+		return nil, ErrNoSecret
+	}
+	return &Sampler{
+		rate:   rate,
+		max:    max,
+		raw:    raw,
+		secret: []byte(secret),
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
@@ -0,0 +1,69 @@
+package sampling
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTake(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)
+	later := now.Add(time.Minute)
+	tests := []struct {
+		desc string
+		rate float64
+		max  int
+		at   []time.Time
+		want int
+	}{
+		{desc: "disabled", rate: 0, max: 10, at: []time.Time{now, now, now}, want: 0},
+		{desc: "no cap", rate: 1, max: 0, at: []time.Time{now, now, now}, want: 0},
+		{desc: "capped", rate: 1, max: 2, at: []time.Time{now, now, now}, want: 2},
+		{desc: "next minute", rate: 1, max: 2, at: []time.Time{now, now, now, later, later}, want: 4},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			s, err := New(test.rate, test.max, true, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := 0
+			for _, at := range test.at {
+				if s.Take(at) {
+					got++
+				}
+			}
+			if got != test.want {
+				t.Fatalf("got: %d, want: %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBody(t *testing.T) {
+	t.Parallel()
+	sampler := func(raw bool, secret string) *Sampler {
+		s, err := New(1, 1, raw, secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	if got := sampler(true, "").Body("hola"); got != "hola" {
+		t.Fatalf("got: %q, want: %q", got, "hola")
+	}
+	got := sampler(false, "secret").Body("hola")
+	if !strings.HasPrefix(got, HashPrefix) || strings.Contains(got, "hola") {
+		t.Fatalf("got: %q, want: a hash", got)
+	}
+	if want := sampler(false, "secret").Body("hola"); got != want {
+		t.Fatalf("got: %q, want: %q", got, want)
+	}
+	if other := sampler(false, "other").Body("hola"); got == other {
+		t.Fatal("expected a different hash with another secret")
+	}
+	if _, err := New(1, 1, false, ""); err != ErrNoSecret {
+		t.Fatalf("got: %v, want: %v", err, ErrNoSecret)
+	}
+}
@@ -0,0 +1,134 @@
+package scoring
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+var (
+	ErrCircuitOpen      = errors.New("scorer circuit is open")
+	ErrUnexpectedStatus = errors.New("unexpected status code from scorer")
+)
+
+// Scorer scores the toxicity of a message body, from 0 (harmless) to 1 (toxic)
+type Scorer interface {
+	Score(ctx context.Context, body string) (float64, error)
+}
+
+// HTTPScorer scores messages with an external model behind an HTTP endpoint.
+// It POSTs `{"text": "<body>"}` and expects `{"score": <float>}`
+type HTTPScorer struct {
+	url    string
+	client *http.Client
+}
+
+func (s *HTTPScorer) Score(ctx context.Context, body string) (float64, error) {
+	b, err := json.Marshal(struct {
+		Text string `json:"text"`
+	}{body})
+	if err != nil {
+		return 0, errors.Wrap(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(b))
+	if err != nil {
+		return 0, errors.Wrap(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return 0, errors.WrapWithContext(ErrUnexpectedStatus, struct {
+			Status int
+		}{res.StatusCode})
+	}
+	var out struct {
+		Score float64 `json:"score"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return 0, errors.Wrap(err)
+	}
+	return out.Score, nil
+}
+
+func NewHTTPScorer(url string) *HTTPScorer {
+	return &HTTPScorer{url: url, client: &http.Client{}}
+}
+
+// Breaker is a circuit breaker. After `threshold` consecutive failures it
+// opens and rejects every call for `cooldown`, then lets a single call through
+// to probe whether the dependency is back.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	now       func() time.Time
+}
+
+// Allow returns whether a call can be made
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	now := b.now()
+	if now.Before(b.openUntil) {
+		return false
+	}
+	// half-open: let this call probe and keep the rest out until it reports
+	b.openUntil = now.Add(b.cooldown)
+	return true
+}
+
+// Report records the result of a call
+func (b *Breaker) Report(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.cooldown)
+	}
+}
+
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// Guarded wraps a Scorer with a timeout per call and a circuit breaker, so a
+// slow or dead model never slows down the storage of moderations for long.
+type Guarded struct {
+	scorer  Scorer
+	breaker *Breaker
+	timeout time.Duration
+}
+
+func (g *Guarded) Score(ctx context.Context, body string) (float64, error) {
+	if !g.breaker.Allow() {
+		return 0, ErrCircuitOpen
+	}
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+	score, err := g.scorer.Score(ctx, body)
+	g.breaker.Report(err)
+	return score, err
+}
+
+func NewGuarded(s Scorer, timeout time.Duration, breaker *Breaker) *Guarded {
+	return &Guarded{scorer: s, timeout: timeout, breaker: breaker}
+}
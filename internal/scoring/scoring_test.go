@@ -0,0 +1,37 @@
+package scoring
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+func TestBreaker(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	b := NewBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+	errFail := errors.New("fail")
+
+	b.Report(errFail)
+	if !b.Allow() {
+		t.Fatal("expected breaker to be closed below the threshold")
+	}
+	b.Report(errFail)
+	if b.Allow() {
+		t.Fatal("expected breaker to be open after reaching the threshold")
+	}
+
+	now = now.Add(time.Minute)
+	if !b.Allow() {
+		t.Fatal("expected breaker to let a probe through after the cooldown")
+	}
+	if b.Allow() {
+		t.Fatal("expected breaker to let a single probe through")
+	}
+	b.Report(nil)
+	if !b.Allow() {
+		t.Fatal("expected breaker to be closed after a successful probe")
+	}
+}
@@ -0,0 +1,185 @@
+package scrubber
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+var ErrMalformedPattern = errors.New("malformed pattern line, expected `name: expression`")
+
+// Pattern is a named regular expression whose matches are replaced with
+// `[redacted-<name>]`.
+type Pattern struct {
+	Name string
+	expr string
+	rg   *regexp.Regexp
+}
+
+// Compile compiles the regular expression. See heuristics.Rule for why
+// compilation is not done on creation.
+func (p *Pattern) Compile() error {
+	rg, err := regexp.Compile(p.expr)
+	if err != nil {
+		return errors.WrapWithContext(err, struct {
+			Pattern string
+		}{p.Name})
+	}
+	p.rg = rg
+	return nil
+}
+
+func (p *Pattern) replacement() string {
+	return "[redacted-" + p.Name + "]"
+}
+
+func NewPattern(name, expr string) *Pattern {
+	return &Pattern{Name: name, expr: expr}
+}
+
+// Built-in patterns. They are intentionally conservative (e.g. phones need
+// separators or an international prefix) because every false positive destroys
+// a piece of a message that can't be recovered.
+func PatternEmail() *Pattern {
+	return NewPattern("email", `[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+}
+
+func PatternIP() *Pattern {
+	return NewPattern("ip", `\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b|\b(?:[0-9A-Fa-f]{1,4}:){7}[0-9A-Fa-f]{1,4}\b`)
+}
+
+func PatternPhone() *Pattern {
+	return NewPattern("phone", `\+\d{8,15}\b|(?:\+\d{1,3}[\s.\-]?)?(?:\(\d{2,4}\)\s?|\b\d{2,4}[\s.\-])\d{3,4}[\s.\-]\d{3,4}\b`)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]func() *Pattern{
+		"email": PatternEmail,
+		"ip":    PatternIP,
+		"phone": PatternPhone,
+	}
+)
+
+// Register makes a pattern available by name to Builtin, so other packages can
+// plug in their own patterns next to the built-in ones. Registering an existing
+// name replaces it
+func Register(name string, fn func() *Pattern) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = fn
+}
+
+// Builtin returns a built-in or registered pattern by name or nil if it
+// doesn't exist
+func Builtin(name string) *Pattern {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	if fn, ok := registry[name]; ok {
+		return fn()
+	}
+	return nil
+}
+
+// ReadPatterns reads custom patterns from a file with a pattern per line, as
+// `name: expression`. Empty lines and lines starting with # are ignored. The
+// patterns are not compiled
+func ReadPatterns(path string) ([]*Pattern, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	defer f.Close()
+
+	var patterns []*Pattern
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, expr, ok := strings.Cut(line, ":")
+		name, expr = strings.TrimSpace(name), strings.TrimSpace(expr)
+		if !ok || name == "" || expr == "" {
+			return nil, errors.WrapWithContext(ErrMalformedPattern, struct{ Line int }{n})
+		}
+		patterns = append(patterns, NewPattern(name, expr))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return patterns, nil
+}
+
+// Redactions maps each pattern name to the number of matches redacted
+type Redactions map[string]int
+
+// Scrubber redacts personal data from message bodies by applying a set of
+// patterns in order. IPs should go before phones, otherwise some IPs would be
+// redacted as phones.
+type Scrubber struct {
+	patterns []*Pattern
+
+	mu    sync.Mutex
+	total Redactions
+}
+
+// Compile calls the Compile() method for every pattern, stopping at the first
+// invalid one.
+func (s *Scrubber) Compile() error {
+	for _, p := range s.patterns {
+		if err := p.Compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Scrub returns `body` with every match of every pattern redacted and the
+// number of redactions per pattern, which is nil if nothing was redacted.
+//
+// Scrub requires patterns to be compiled before with `Compile()`
+func (s *Scrubber) Scrub(body string) (string, Redactions) {
+	var r Redactions
+	for _, p := range s.patterns {
+		n := 0
+		body = p.rg.ReplaceAllStringFunc(body, func(string) string {
+			n++
+			return p.replacement()
+		})
+		if n > 0 {
+			if r == nil {
+				r = make(Redactions)
+			}
+			r[p.Name] += n
+		}
+	}
+	if r != nil {
+		s.mu.Lock()
+		for name, n := range r {
+			s.total[name] += n
+		}
+		s.mu.Unlock()
+	}
+	return body, r
+}
+
+// Total returns a copy of the redactions made since the creation of the
+// scrubber
+func (s *Scrubber) Total() Redactions {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := make(Redactions, len(s.total))
+	for name, n := range s.total {
+		total[name] = n
+	}
+	return total
+}
+
+func New(patterns []*Pattern) *Scrubber {
+	return &Scrubber{patterns: patterns, total: make(Redactions)}
+}
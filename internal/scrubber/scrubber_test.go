@@ -0,0 +1,117 @@
+package scrubber
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func createScrubber(patterns ...*Pattern) *Scrubber {
+	s := New(patterns)
+	if err := s.Compile(); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func TestScrub(t *testing.T) {
+	t.Parallel()
+	s := createScrubber(PatternEmail(), PatternIP(), PatternPhone())
+
+	tests := []struct {
+		input string
+		want  string
+		wantR Redactions
+	}{
+		{input: "hola que tal", want: "hola que tal"},
+		{input: "write me at foo.bar@example.com", want: "write me at [redacted-email]", wantR: Redactions{"email": 1}},
+		{input: "a@b.co and c@d.es", want: "[redacted-email] and [redacted-email]", wantR: Redactions{"email": 2}},
+		{input: "@streamer hi", want: "@streamer hi"},
+		{input: "his ip is 192.168.100.100 lol", want: "his ip is [redacted-ip] lol", wantR: Redactions{"ip": 1}},
+		{input: "1.1.1.1", want: "[redacted-ip]", wantR: Redactions{"ip": 1}},
+		{input: "2001:0db8:85a3:0000:0000:8a2e:0370:7334", want: "[redacted-ip]", wantR: Redactions{"ip": 1}},
+		{input: "v1.2.3", want: "v1.2.3"},
+		{input: "call 555-123-4567", want: "call [redacted-phone]", wantR: Redactions{"phone": 1}},
+		{input: "call (555) 123-4567", want: "call [redacted-phone]", wantR: Redactions{"phone": 1}},
+		{input: "+34600111222", want: "[redacted-phone]", wantR: Redactions{"phone": 1}},
+		{input: "+1 555 123 4567", want: "[redacted-phone]", wantR: Redactions{"phone": 1}},
+		{input: "at 12:30 on 2022-04-03", want: "at 12:30 on 2022-04-03"},
+		{input: "I have 1000000 points", want: "I have 1000000 points"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			got, gotR := s.Scrub(test.input)
+			if got != test.want {
+				t.Fatalf("got: %q, want: %q", got, test.want)
+			}
+			if !reflect.DeepEqual(gotR, test.wantR) {
+				t.Fatalf("redactions: got %v, want %v", gotR, test.wantR)
+			}
+		})
+	}
+}
+
+func TestTotal(t *testing.T) {
+	t.Parallel()
+	s := createScrubber(PatternEmail(), NewPattern("custom", `secret\d+`))
+
+	s.Scrub("a@b.co secret1")
+	s.Scrub("secret2 secret3")
+	got, want := s.Total(), Redactions{"email": 1, "custom": 3}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	t.Parallel()
+	s := New([]*Pattern{PatternEmail(), NewPattern("custom", `secret(\d+`)})
+	if err := s.Compile(); err == nil {
+		t.Fatal("got: nil, want: an error for the invalid expression")
+	}
+}
+
+func TestReadPatterns(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "patterns.txt")
+	content := "# custom patterns\n\ndiscord: [a-z]+#\\d{4}\ntoken:  tok_[a-z0-9]+ \n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	patterns, err := ReadPatterns(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := createScrubber(patterns...)
+	got, gotR := s.Scrub("add me foo#1234 tok_abc1")
+	if want := "add me [redacted-discord] [redacted-token]"; got != want {
+		t.Fatalf("got: %q, want: %q", got, want)
+	}
+	if want := (Redactions{"discord": 1, "token": 1}); !reflect.DeepEqual(gotR, want) {
+		t.Fatalf("redactions: got %v, want %v", gotR, want)
+	}
+
+	if err := os.WriteFile(path, []byte("no separator\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadPatterns(path); err == nil {
+		t.Fatal("got: nil, want: an error for the malformed line")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+	Register("iban", func() *Pattern {
+		return NewPattern("iban", `\b[A-Z]{2}\d{22}\b`)
+	})
+	p := Builtin("iban")
+	if p == nil {
+		t.Fatal("got: nil, want: the registered pattern")
+	}
+	got, _ := createScrubber(p).Scrub("ES9121000418450200051332")
+	if want := "[redacted-iban]"; got != want {
+		t.Fatalf("got: %q, want: %q", got, want)
+	}
+}
@@ -0,0 +1,104 @@
+// Package service integrates the tracker with the service managers that run
+// it outside containers, e.g. systemd: readiness notifications, a PID file and
+// the listening sockets passed by the manager (socket activation). Every
+// function is a no-op when the tracker is not run by such a manager.
+package service
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+// States sent with Notify, see sd_notify(3)
+const (
+	StateReady    = "READY=1"
+	StateStopping = "STOPPING=1"
+)
+
+// listenFDsStart is the first file descriptor passed by the service manager,
+// see sd_listen_fds(3)
+const listenFDsStart = 3
+
+var ErrNoListenFDs = errors.New("LISTEN_FDS is set but no file descriptor was passed")
+
+// Notify sends `state` to the service manager through the socket of
+// NOTIFY_SOCKET. It does nothing if it is not set
+func Notify(state string) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+	// abstract sockets start with @ in the variable and with a null byte in
+	// the address
+	if strings.HasPrefix(addr, "@") {
+		addr = "\x00" + addr[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// Status is the free-form status of the tracker shown by the service manager
+func Status(status string) error {
+	return Notify("STATUS=" + status)
+}
+
+// Listener returns the first listening socket passed by the service manager,
+// or nil if none was passed to this process
+func Listener() (net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil {
+		return nil, nil
+	}
+	if n < 1 {
+		return nil, ErrNoListenFDs
+	}
+	// the sockets must not be inherited by the children of the tracker
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	f := os.NewFile(uintptr(listenFDsStart), "LISTEN_FD_3")
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	// FileListener duplicates the descriptor
+	f.Close()
+	return l, nil
+}
+
+// WritePIDFile writes the PID of the process to `path`. It does nothing if
+// path is empty
+func WritePIDFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// RemovePIDFile removes the PID file written by WritePIDFile
+func RemovePIDFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrap(err)
+	}
+	return nil
+}
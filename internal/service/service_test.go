@@ -0,0 +1,60 @@
+package service
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestNotify(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", addr)
+
+	if err := Notify(StateReady); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != StateReady {
+		t.Fatalf("got: %q, want: %q", got, StateReady)
+	}
+}
+
+func TestPIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tracker.pid")
+	if err := WritePIDFile(path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.TrimSpace(string(b)), strconv.Itoa(os.Getpid()); got != want {
+		t.Fatalf("got: %q, want: %q", got, want)
+	}
+	if err := RemovePIDFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("PID file not removed: %v", err)
+	}
+}
+
+func TestListenerNotActivated(t *testing.T) {
+	t.Setenv("LISTEN_PID", "")
+	l, err := Listener()
+	if err != nil || l != nil {
+		t.Fatalf("got: %v, %v, want: nil, nil", l, err)
+	}
+}
@@ -0,0 +1,21 @@
+package service
+
+import "sync"
+
+var (
+	stopping = make(chan struct{})
+	stopOnce sync.Once
+)
+
+// Stopping is closed when the service manager asks the tracker to stop, e.g.
+// the Windows service manager. The signals of the rest of platforms are
+// handled apart, see StopSignals
+func Stopping() <-chan struct{} {
+	return stopping
+}
+
+func requestStop() {
+	stopOnce.Do(func() {
+		close(stopping)
+	})
+}
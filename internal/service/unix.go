@@ -0,0 +1,23 @@
+//go:build !windows
+
+package service
+
+import (
+	"os"
+	"syscall"
+)
+
+// StopSignals are the signals that stop the tracker gracefully
+var StopSignals = []os.Signal{
+	os.Interrupt,
+	syscall.SIGINT,
+	syscall.SIGTERM,
+	syscall.SIGABRT,
+	syscall.SIGQUIT,
+}
+
+// Run runs `run` under the service manager of the platform if the process was
+// started by it, and reports whether it was. Only Windows services need it
+func Run(name string, run func() error) (bool, error) {
+	return false, nil
+}
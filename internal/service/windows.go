@@ -0,0 +1,72 @@
+//go:build windows
+
+package service
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/windows/svc"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+// StopSignals are the signals that stop the tracker gracefully. Windows only
+// delivers the Ctrl+C of the console and the close of its window, the service
+// manager stops the services through Stopping instead
+var StopSignals = []os.Signal{
+	os.Interrupt,
+	syscall.SIGTERM,
+}
+
+// Run runs `run` as the Windows service `name` if the process was started by
+// the service manager, and reports whether it was. The service is stopped by
+// `sc stop`, or the manager, through Stopping, and run must return then
+func Run(name string, run func() error) (bool, error) {
+	ok, err := svc.IsWindowsService()
+	if err != nil {
+		return false, errors.Wrap(err)
+	}
+	if !ok {
+		return false, nil
+	}
+	h := &handler{run: run}
+	if err := svc.Run(name, h); err != nil {
+		return true, errors.Wrap(err)
+	}
+	return true, h.err
+}
+
+type handler struct {
+	run func() error
+	// err is the error returned by run
+	err error
+}
+
+func (h *handler) Execute(args []string, reqs <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	done := make(chan error, 1)
+	go func() {
+		done <- h.run()
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case err := <-done:
+			h.err = err
+			if err != nil {
+				// service specific exit code
+				return true, 1
+			}
+			return false, 0
+		case req := <-reqs:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				requestStop()
+			}
+		}
+	}
+}
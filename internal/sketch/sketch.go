@@ -0,0 +1,155 @@
+// Package sketch counts the occurrences of keys in bounded memory, e.g. the
+// messages of every user of a chat with millions of chatters, where exact
+// counters per key would grow without bound. The counts are estimates: they
+// are never lower than the real ones, and higher by at most epsilon times the
+// total count with a probability of 1 - delta.
+package sketch
+
+import (
+	"hash/maphash"
+	"math"
+	"time"
+)
+
+// CountMin is a count-min sketch with conservative updates, which only
+// increment the counters of a key that are at its minimum, reducing the
+// overestimation of the rest of keys. It is not safe for concurrent use
+type CountMin struct {
+	width uint64
+	// rows are depth rows of width counters
+	rows [][]uint32
+	seed maphash.Seed
+}
+
+// indexes returns the counter of the key in every row, derived from a single
+// hash by double hashing
+func (s *CountMin) indexes(key string, idx []uint64) {
+	var mh maphash.Hash
+	mh.SetSeed(s.seed)
+	mh.WriteString(key)
+	h := mh.Sum64()
+	h1, h2 := h&0xffffffff, h>>32|1
+	for i := range idx {
+		idx[i] = (h1 + uint64(i)*h2) % s.width
+	}
+}
+
+// Add adds `n` occurrences of the key
+func (s *CountMin) Add(key string, n uint32) {
+	idx := make([]uint64, len(s.rows))
+	s.indexes(key, idx)
+	min := s.count(idx)
+	for i, row := range s.rows {
+		if row[idx[i]] < min+n {
+			row[idx[i]] = min + n
+		}
+	}
+}
+
+// Count returns the estimated occurrences of the key
+func (s *CountMin) Count(key string) uint32 {
+	idx := make([]uint64, len(s.rows))
+	s.indexes(key, idx)
+	return s.count(idx)
+}
+
+func (s *CountMin) count(idx []uint64) uint32 {
+	min := uint32(math.MaxUint32)
+	for i, row := range s.rows {
+		if row[idx[i]] < min {
+			min = row[idx[i]]
+		}
+	}
+	return min
+}
+
+// Reset sets every count to 0
+func (s *CountMin) Reset() {
+	for _, row := range s.rows {
+		for i := range row {
+			row[i] = 0
+		}
+	}
+}
+
+// Bytes returns the memory of the counters
+func (s *CountMin) Bytes() int {
+	return len(s.rows) * int(s.width) * 4
+}
+
+// NewCountMin creates a sketch whose estimates are over by at most epsilon
+// times the total count with a probability of 1 - delta. Both are fractions
+// from 0 to 1, the lower the more memory it takes
+func NewCountMin(epsilon, delta float64) *CountMin {
+	width := uint64(math.Ceil(math.E / epsilon))
+	depth := int(math.Ceil(math.Log(1 / delta)))
+	if depth < 1 {
+		depth = 1
+	}
+	rows := make([][]uint32, depth)
+	for i := range rows {
+		rows[i] = make([]uint32, width)
+	}
+	return &CountMin{width: width, rows: rows, seed: maphash.MakeSeed()}
+}
+
+// Window counts the occurrences of the keys within a sliding window of time.
+// The window is split in buckets with a sketch each, the oldest one reset once
+// the window slides past it, so the counts are of the last window minus up to
+// a bucket. It is not safe for concurrent use
+type Window struct {
+	bucket  time.Duration
+	buckets []*CountMin
+	// starts are the number of the bucket since the unix epoch each sketch is
+	// counting
+	starts []int64
+}
+
+// slot returns the sketch of the bucket of `at`, reset if it was counting an
+// older bucket
+func (w *Window) slot(at time.Time) *CountMin {
+	n := at.UnixNano() / int64(w.bucket)
+	i := int(n % int64(len(w.buckets)))
+	if w.starts[i] != n {
+		w.buckets[i].Reset()
+		w.starts[i] = n
+	}
+	return w.buckets[i]
+}
+
+// Add adds an occurrence of the key at `at`
+func (w *Window) Add(key string, at time.Time) {
+	w.slot(at).Add(key, 1)
+}
+
+// Count returns the estimated occurrences of the key in the window until `at`
+func (w *Window) Count(key string, at time.Time) int {
+	n := at.UnixNano() / int64(w.bucket)
+	count := 0
+	for i, s := range w.buckets {
+		if start := w.starts[i]; start <= n && start > n-int64(len(w.buckets)) {
+			count += int(s.Count(key))
+		}
+	}
+	return count
+}
+
+// Bytes returns the memory of the counters
+func (w *Window) Bytes() int {
+	return len(w.buckets) * w.buckets[0].Bytes()
+}
+
+// NewWindow creates a window of `size` split in `buckets` buckets, with the
+// accuracy of NewCountMin
+func NewWindow(size time.Duration, buckets int, epsilon, delta float64) *Window {
+	w := &Window{
+		bucket:  size / time.Duration(buckets),
+		buckets: make([]*CountMin, buckets),
+		starts:  make([]int64, buckets),
+	}
+	for i := range w.buckets {
+		w.buckets[i] = NewCountMin(epsilon, delta)
+		w.starts[i] = -1
+	}
+	return w
+}
@@ -0,0 +1,58 @@
+package sketch
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCountMin(t *testing.T) {
+	t.Parallel()
+	s := NewCountMin(0.001, 0.01)
+	// a few heavy keys among many light ones
+	for i := 0; i < 10000; i++ {
+		s.Add("user"+strconv.Itoa(i), 1)
+	}
+	s.Add("flooder", 50)
+	total := 10050
+	for _, tt := range []struct {
+		key  string
+		want uint32
+	}{
+		{key: "flooder", want: 50},
+		{key: "user1", want: 1},
+		{key: "unknown", want: 0},
+	} {
+		got := s.Count(tt.key)
+		if got < tt.want || float64(got-tt.want) > 0.001*float64(total) {
+			t.Errorf("%s got: %v, want: %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestWindow(t *testing.T) {
+	t.Parallel()
+	w := NewWindow(30*time.Second, 3, 0.01, 0.01)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		w.Add("user", start.Add(time.Duration(i)*time.Second))
+	}
+	tests := []struct {
+		name string
+		at   time.Time
+		want int
+	}{
+		{name: "within the window", at: start.Add(15 * time.Second), want: 10},
+		{name: "slid past", at: start.Add(40 * time.Second), want: 0},
+	}
+	for _, tt := range tests {
+		if got := w.Count("user", tt.at); got != tt.want {
+			t.Errorf("%s got: %v, want: %v", tt.name, got, tt.want)
+		}
+	}
+	// the old bucket is reused for the new counts
+	w.Add("user", start.Add(31*time.Second))
+	if got := w.Count("user", start.Add(31*time.Second)); got != 1 {
+		t.Errorf("got: %v, want: %v", got, 1)
+	}
+}
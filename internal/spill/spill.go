@@ -0,0 +1,294 @@
+// Package spill is a bounded FIFO queue of records on disk. The records are
+// appended to segment files and read from the oldest one, which is removed
+// once all its records are popped. The read position is not persisted, so
+// after a restart the records of the oldest segment already popped are read
+// again: records are delivered at least once.
+package spill
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+const (
+	// SegmentBytes is the size after which the records are appended to a new
+	// segment file. It bounds the records read again after a restart
+	SegmentBytes = 1 << 20
+
+	ext = ".spill"
+	// header is the length prefix of every record
+	header = 4
+)
+
+var (
+	ErrFull  = errors.New("spill queue full")
+	ErrEmpty = errors.New("spill queue empty")
+)
+
+// Queue is safe for concurrent use
+type Queue struct {
+	dir      string
+	maxBytes int64
+
+	mu sync.Mutex
+	// segments are the sequence numbers of the segment files, the oldest
+	// first. The records are appended to the last one and read from the first
+	segments []int
+	w        *os.File
+	wsize    int64
+	rf       *os.File
+	r        *bufio.Reader
+	// head is the record read and not popped yet, nil if none
+	head []byte
+	size int64
+	n    int
+}
+
+// Push appends the record, or returns ErrFull if the queue would grow over its
+// maximum size
+func (q *Queue) Push(rec []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := int64(header + len(rec))
+	if q.size+n > q.maxBytes {
+		return ErrFull
+	}
+	if q.w == nil || q.wsize >= SegmentBytes {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+	}
+	b := make([]byte, n)
+	binary.BigEndian.PutUint32(b, uint32(len(rec)))
+	copy(b[header:], rec)
+	if _, err := q.w.Write(b); err != nil {
+		return errors.Wrap(err)
+	}
+	// the records outlive a crash of the process, that is what they are for
+	if err := q.w.Sync(); err != nil {
+		return errors.Wrap(err)
+	}
+	q.wsize += n
+	q.size += n
+	q.n++
+	return nil
+}
+
+// rotate appends the next records to a new segment
+func (q *Queue) rotate() error {
+	if q.w != nil {
+		if err := q.w.Close(); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	seq := 1
+	if len(q.segments) > 0 {
+		seq = q.segments[len(q.segments)-1] + 1
+	}
+	f, err := os.OpenFile(q.path(seq), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	q.segments = append(q.segments, seq)
+	q.w, q.wsize = f, 0
+	return nil
+}
+
+// Peek returns the oldest record without removing it, or ErrEmpty
+func (q *Queue) Peek() ([]byte, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.n == 0 {
+		return nil, ErrEmpty
+	}
+	if q.head != nil {
+		return q.head, nil
+	}
+	for {
+		if q.r == nil {
+			f, err := os.Open(q.path(q.segments[0]))
+			if err != nil {
+				return nil, errors.Wrap(err)
+			}
+			q.rf, q.r = f, bufio.NewReader(f)
+		}
+		rec, err := readRecord(q.r)
+		if err == nil {
+			q.head = rec
+			return rec, nil
+		}
+		// the last segment is still being written, the records counted are
+		// always there
+		if err != io.EOF || len(q.segments) == 1 {
+			return nil, errors.Wrap(err)
+		}
+		if err := q.removeOldest(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Pop removes the record returned by Peek
+func (q *Queue) Pop() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.head == nil {
+		return ErrEmpty
+	}
+	q.size -= int64(header + len(q.head))
+	q.n--
+	q.head = nil
+	if q.n > 0 {
+		return nil
+	}
+	// start over, so the segments don't pile up between outages
+	for len(q.segments) > 0 {
+		if err := q.removeOldest(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeOldest removes the oldest segment, whose records were all popped
+func (q *Queue) removeOldest() error {
+	if q.rf != nil {
+		q.rf.Close()
+		q.rf, q.r = nil, nil
+	}
+	if len(q.segments) == 1 && q.w != nil {
+		q.w.Close()
+		q.w, q.wsize = nil, 0
+	}
+	if err := os.Remove(q.path(q.segments[0])); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err)
+	}
+	q.segments = q.segments[1:]
+	return nil
+}
+
+// Len returns the number of records in the queue
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.n
+}
+
+// Size returns the bytes of the records in the queue
+func (q *Queue) Size() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
+
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.rf != nil {
+		q.rf.Close()
+	}
+	if q.w != nil {
+		return q.w.Close()
+	}
+	return nil
+}
+
+func (q *Queue) path(seq int) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, ext))
+}
+
+func readRecord(r io.Reader) ([]byte, error) {
+	var h [header]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return nil, err
+	}
+	rec := make([]byte, binary.BigEndian.Uint32(h[:]))
+	if _, err := io.ReadFull(r, rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// count returns the records and the bytes of a segment, truncating the record
+// partially written by a crash, if any
+func count(path string) (int, int64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return 0, 0, errors.Wrap(err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var (
+		n    int
+		size int64
+	)
+	for {
+		rec, err := readRecord(r)
+		if err == io.EOF {
+			return n, size, nil
+		}
+		if err == io.ErrUnexpectedEOF {
+			if err := f.Truncate(size); err != nil {
+				return 0, 0, errors.Wrap(err)
+			}
+			return n, size, nil
+		}
+		if err != nil {
+			return 0, 0, errors.Wrap(err)
+		}
+		n++
+		size += int64(header + len(rec))
+	}
+}
+
+// Open opens the queue of the directory, creating it if it doesn't exist, with
+// the records left by the previous run
+func Open(dir string, maxBytes int64) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	q := &Queue{dir: dir, maxBytes: maxBytes}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		seq, err := strconv.Atoi(strings.TrimSuffix(name, ext))
+		if err != nil {
+			continue
+		}
+		q.segments = append(q.segments, seq)
+	}
+	sort.Ints(q.segments)
+	for _, seq := range q.segments {
+		n, size, err := count(q.path(seq))
+		if err != nil {
+			return nil, errors.WrapWithContext(err, struct{ Segment string }{q.path(seq)})
+		}
+		q.n += n
+		q.size += size
+	}
+	if q.n == 0 {
+		for len(q.segments) > 0 {
+			if err := q.removeOldest(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// the records of this run are appended to a new segment, see rotate
+	return q, nil
+}
@@ -0,0 +1,125 @@
+package spill
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+func drain(t *testing.T, q *Queue) []string {
+	t.Helper()
+	var got []string
+	for {
+		rec, err := q.Peek()
+		if errors.Is(err, ErrEmpty) {
+			return got
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(rec))
+		if err := q.Pop(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestQueue(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	q, err := Open(dir, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// enough records to fill several segments
+	rec := make([]byte, SegmentBytes/4)
+	want := make([]string, 10)
+	for i := range want {
+		rec[0] = byte('0' + i)
+		want[i] = string(rec)
+		if err := q.Push(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if q.Len() != len(want) {
+		t.Fatalf("got: %v records, want: %v", q.Len(), len(want))
+	}
+	got := drain(t, q)
+	if len(got) != len(want) {
+		t.Fatalf("got: %v records, want: %v", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("record %d got: %q, want: %q", i, got[i][0], want[i][0])
+		}
+	}
+	if q.Size() != 0 {
+		t.Errorf("got: %v bytes, want: %v", q.Size(), 0)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("got: %v segments, want: %v", len(entries), 0)
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	t.Parallel()
+	q, err := Open(t.TempDir(), 2*(header+10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	for i := 0; i < 2; i++ {
+		if err := q.Push(make([]byte, 10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Push(make([]byte, 1)); !errors.Is(err, ErrFull) {
+		t.Errorf("got: %v, want: %v", err, ErrFull)
+	}
+}
+
+func TestQueueReopen(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	q, err := Open(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := q.Push([]byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q.Close()
+	// a record partially written by a crash
+	segment := filepath.Join(dir, "00000000000000000001"+ext)
+	f, err := os.OpenFile(segment, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 9, 'x'})
+	f.Close()
+
+	q, err = Open(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if err := q.Push([]byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	got := drain(t, q)
+	want := []string{"0", "1", "2", "3"}
+	if len(got) != len(want) {
+		t.Fatalf("got: %v, want: %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got: %v, want: %v", got, want)
+		}
+	}
+}
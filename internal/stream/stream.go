@@ -0,0 +1,101 @@
+// Package stream fans out events to many subscribers, keeping a backlog of the
+// recent ones for the subscribers that resume after reconnecting.
+package stream
+
+import "sync"
+
+// Event is a published event. IDs are increasing, starting at 1
+type Event struct {
+	ID uint64
+	// Topic is what the event is about, e.g. the channel of a moderation, so
+	// that subscribers only receive the events of their topics
+	Topic string
+	Data  []byte
+}
+
+// topics is the set of topics of a subscriber, nil for all of them
+type topics map[string]struct{}
+
+func (t topics) has(topic string) bool {
+	if t == nil {
+		return true
+	}
+	_, ok := t[topic]
+	return ok
+}
+
+// Hub fans out the published events to its subscribers. It is safe for
+// concurrent use.
+type Hub struct {
+	backlog int
+	buffer  int
+
+	mu     sync.Mutex
+	subs   map[chan *Event]topics
+	recent []*Event
+	lastID uint64
+}
+
+// Subscribe returns a channel receiving the new events and the events in the
+// backlog after `lastID`, if not zero, of the topics `only`. A nil `only`
+// subscribes to all the topics, an empty one to none
+func (h *Hub) Subscribe(lastID uint64, only []string) (chan *Event, []*Event) {
+	var ts topics
+	if only != nil {
+		ts = make(topics, len(only))
+		for _, topic := range only {
+			ts[topic] = struct{}{}
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch := make(chan *Event, h.buffer)
+	h.subs[ch] = ts
+	var missed []*Event
+	if lastID != 0 {
+		for _, e := range h.recent {
+			if e.ID > lastID && ts.has(e.Topic) {
+				missed = append(missed, e)
+			}
+		}
+	}
+	return ch, missed
+}
+
+func (h *Hub) Unsubscribe(ch chan *Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, ch)
+}
+
+// Publish sends the event to every subscriber of the topic. It never blocks,
+// the events are dropped for the subscribers not keeping up
+func (h *Hub) Publish(topic string, data []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastID++
+	e := &Event{ID: h.lastID, Topic: topic, Data: data}
+	h.recent = append(h.recent, e)
+	if len(h.recent) > h.backlog {
+		h.recent = h.recent[1:]
+	}
+	for ch, ts := range h.subs {
+		if !ts.has(topic) {
+			continue
+		}
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// New creates a hub keeping `backlog` recent events and buffering up to
+// `buffer` events per subscriber
+func New(backlog, buffer int) *Hub {
+	return &Hub{
+		backlog: backlog,
+		buffer:  buffer,
+		subs:    make(map[chan *Event]topics),
+	}
+}
@@ -0,0 +1,66 @@
+package stream
+
+import "testing"
+
+func TestReplay(t *testing.T) {
+	t.Parallel()
+	h := New(100, 32)
+	for i := 0; i < 110; i++ {
+		h.Publish("", nil)
+	}
+
+	_, missed := h.Subscribe(0, nil)
+	if len(missed) != 0 {
+		t.Fatalf("expected no replay for a new subscriber, got %d events", len(missed))
+	}
+	_, missed = h.Subscribe(105, nil)
+	if len(missed) != 5 || missed[0].ID != 106 {
+		t.Fatalf("expected the last 5 events, got %d", len(missed))
+	}
+	// older than the backlog, replays all of it
+	_, missed = h.Subscribe(1, nil)
+	if len(missed) != 100 {
+		t.Fatalf("expected the whole backlog, got %d events", len(missed))
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	t.Parallel()
+	h := New(100, 32)
+	ch, _ := h.Subscribe(0, nil)
+	// publishing never blocks, even with a subscriber not reading
+	for i := 0; i < 64; i++ {
+		h.Publish("", nil)
+	}
+	if len(ch) != 32 {
+		t.Fatalf("expected 32 buffered events, got %d", len(ch))
+	}
+	h.Unsubscribe(ch)
+	h.Publish("", nil)
+	if len(ch) != 32 {
+		t.Fatal("unsubscribed subscribers must not receive events")
+	}
+}
+
+func TestTopics(t *testing.T) {
+	t.Parallel()
+	h := New(100, 32)
+	foo, _ := h.Subscribe(0, []string{"foo"})
+	none, _ := h.Subscribe(0, []string{})
+	all, _ := h.Subscribe(0, nil)
+	h.Publish("foo", nil)
+	h.Publish("bar", nil)
+	if len(foo) != 1 || (<-foo).Topic != "foo" {
+		t.Fatal("expected only the events of the subscribed topic")
+	}
+	if len(none) != 0 {
+		t.Fatalf("expected no events without topics, got %d", len(none))
+	}
+	if len(all) != 2 {
+		t.Fatalf("expected the events of every topic, got %d", len(all))
+	}
+	_, missed := h.Subscribe(1, []string{"bar"})
+	if len(missed) != 1 || missed[0].Topic != "bar" {
+		t.Fatal("expected only the replayed events of the subscribed topic")
+	}
+}
@@ -0,0 +1,175 @@
+// Package tags infers the likely reason of a moderation from its messages and
+// the name of the user, e.g. link-spam or caps.
+package tags
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/links"
+)
+
+// Builtin reason categories. The keyword map can add any other category
+const (
+	LinkSpam  = "link-spam"
+	Caps      = "caps"
+	Slur      = "slur"
+	FollowBot = "follow-bot"
+	// Unknown is the tag of the moderations with no other tag
+	Unknown = "unknown"
+)
+
+const (
+	// Minimum letters of a message to be considered for Caps
+	MinCapsLetters = 10
+	// Minimum ratio of uppercase letters of a message tagged with Caps
+	MinCapsRatio = .7
+)
+
+var ErrMalformedKeywords = errors.New("malformed keywords line, expected `category: keyword, keyword`")
+
+// FollowBotPatterns are the default patterns of the names of the follow-bot
+// accounts
+var FollowBotPatterns = []string{
+	`^h[o0]ss[a-z]*\d{2,}_?$`,
+	`^(follow|viewer)s?_?(bot|4you|now)\d*$`,
+}
+
+// Classifier tags the moderations. It must be compiled before use
+type Classifier struct {
+	// Keywords are the keywords of every category, matched as whole words
+	// case-insensitively
+	Keywords map[string][]string
+	// NamePatterns are matched against the usernames to tag follow-bots
+	NamePatterns []string
+
+	keywords map[string]*regexp.Regexp
+	names    []*regexp.Regexp
+}
+
+// Compile compiles the keywords and the name patterns, stopping at the first
+// invalid name pattern
+func (c *Classifier) Compile() error {
+	c.keywords = make(map[string]*regexp.Regexp, len(c.Keywords))
+	for category, words := range c.Keywords {
+		if len(words) == 0 {
+			continue
+		}
+		quoted := make([]string, len(words))
+		for i, w := range words {
+			quoted[i] = regexp.QuoteMeta(w)
+		}
+		// quoted, it cannot fail
+		c.keywords[category] = regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`)
+	}
+	c.names = make([]*regexp.Regexp, len(c.NamePatterns))
+	for i, p := range c.NamePatterns {
+		rg, err := regexp.Compile(p)
+		if err != nil {
+			return errors.WrapWithContext(err, struct{ Pattern string }{p})
+		}
+		c.names[i] = rg
+	}
+	return nil
+}
+
+// Classify returns the sorted tags of a moderation of `username` with the
+// given messages, or only Unknown if none applies
+func (c *Classifier) Classify(username string, bodies []string) []string {
+	found := make(map[string]bool)
+	for _, p := range c.names {
+		if p.MatchString(strings.ToLower(username)) {
+			found[FollowBot] = true
+			break
+		}
+	}
+	for _, body := range bodies {
+		if len(links.Extract(body)) > 0 {
+			found[LinkSpam] = true
+		}
+		if isCaps(body) {
+			found[Caps] = true
+		}
+		for category, rg := range c.keywords {
+			if rg.MatchString(body) {
+				found[category] = true
+			}
+		}
+	}
+	if len(found) == 0 {
+		return []string{Unknown}
+	}
+	all := make([]string, 0, len(found))
+	for tag := range found {
+		all = append(all, tag)
+	}
+	sort.Strings(all)
+	return all
+}
+
+func isCaps(body string) bool {
+	var letters, upper int
+	for _, r := range body {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+	return letters >= MinCapsLetters && float64(upper)/float64(letters) >= MinCapsRatio
+}
+
+// ReadKeywords reads the keyword map from a file with a category per line, as
+// `category: keyword, keyword`. Empty lines and lines starting with # are
+// ignored
+func ReadKeywords(path string) (map[string][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	defer f.Close()
+
+	keywords := make(map[string][]string)
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		category, words, ok := strings.Cut(line, ":")
+		category = strings.TrimSpace(category)
+		if !ok || category == "" {
+			return nil, errors.WrapWithContext(ErrMalformedKeywords, struct{ Line int }{n})
+		}
+		for _, w := range strings.Split(words, ",") {
+			if w = strings.TrimSpace(w); w != "" {
+				keywords[category] = append(keywords[category], w)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return keywords, nil
+}
+
+// Has reports whether `tag` is one of `tags`
+func Has(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func New(keywords map[string][]string, namePatterns []string) *Classifier {
+	return &Classifier{Keywords: keywords, NamePatterns: namePatterns}
+}
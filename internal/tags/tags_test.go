@@ -0,0 +1,73 @@
+package tags
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+	c := New(map[string][]string{
+		Slur:    {"badword"},
+		"scam":  {"free nitro"},
+		"empty": nil,
+	}, FollowBotPatterns)
+	if err := c.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		username string
+		bodies   []string
+		want     []string
+	}{
+		{"foo", []string{"hello"}, []string{Unknown}},
+		{"foo", []string{"visit https://example.com now"}, []string{LinkSpam}},
+		{"foo", []string{"WHY IS NOBODY LISTENING"}, []string{Caps}},
+		{"foo", []string{"OK LOL"}, []string{Unknown}},
+		{"foo", []string{"you BadWord"}, []string{Slur}},
+		{"foo", []string{"badwords are fine"}, []string{Unknown}},
+		{"hoss00312_", []string{"hi"}, []string{FollowBot}},
+		{"foo", []string{"FREE NITRO FOR EVERYONE https://x.y"}, []string{Caps, LinkSpam, "scam"}},
+		{"foo", nil, []string{Unknown}},
+	}
+	for _, tt := range tests {
+		if got := c.Classify(tt.username, tt.bodies); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Classify(%q, %q) = %v, want %v", tt.username, tt.bodies, got, tt.want)
+		}
+	}
+}
+
+func TestReadKeywords(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "keywords")
+	content := "# comment\n\nslur: foo, bar ,\nscam:free nitro\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadKeywords(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"slur": {"foo", "bar"}, "scam": {"free nitro"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	if err := os.WriteFile(path, []byte("no category\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadKeywords(path); err == nil {
+		t.Fatal("expected an error with a malformed line")
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	t.Parallel()
+	c := New(nil, []string{`^bot\d+$`, `^(unclosed`})
+	if err := c.Compile(); err == nil {
+		t.Fatal("expected an error compiling an invalid name pattern")
+	}
+}
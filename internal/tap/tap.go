@@ -0,0 +1,137 @@
+// Package tap writes the raw IRC lines received from some channels to a file,
+// one per line, so parsing bugs can be reproduced offline. The lines are
+// written as they are received, and can be parsed again with
+// twitch.ParseMessage.
+package tap
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+// Tap appends the lines to a file, rotating it when it grows over a maximum
+// size. It is safe for concurrent use.
+type Tap struct {
+	path     string
+	maxBytes int64
+	backups  int
+	// channels are the channels tapped, nil for all of them
+	channels map[string]struct{}
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// Tapped reports whether the lines of channel `ch` are written
+func (t *Tap) Tapped(ch string) bool {
+	if t.channels == nil {
+		return true
+	}
+	_, ok := t.channels[strings.ToLower(ch)]
+	return ok
+}
+
+// Write appends the raw `line` received from channel `ch`, if the channel is
+// tapped
+func (t *Tap) Write(ch, line string) error {
+	if !t.Tapped(ch) {
+		return nil
+	}
+	line = strings.TrimRight(line, "\r\n") + "\n"
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.f == nil {
+		return os.ErrClosed
+	}
+	if t.size > 0 && t.size+int64(len(line)) > t.maxBytes {
+		if err := t.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := t.f.WriteString(line)
+	t.size += int64(n)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// rotate shifts the backups, i.e. path.1 to path.2 and so on, dropping the
+// oldest one, and starts a new file. It must be called with mu held
+func (t *Tap) rotate() error {
+	if err := t.f.Close(); err != nil {
+		return errors.Wrap(err)
+	}
+	for i := t.backups - 1; i >= 1; i-- {
+		if err := os.Rename(backup(t.path, i), backup(t.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err)
+		}
+	}
+	if t.backups > 0 {
+		if err := os.Rename(t.path, backup(t.path, 1)); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	f, err := os.OpenFile(t.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	t.f = f
+	t.size = 0
+	return nil
+}
+
+func backup(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// Close closes the file. Lines written after closing are discarded with an
+// error
+func (t *Tap) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.f == nil {
+		return nil
+	}
+	err := t.f.Close()
+	t.f = nil
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	return nil
+}
+
+// Open opens the file at `path` to append the lines of `channels`, all of them
+// if empty. The file is rotated when it would grow over `maxBytes`, keeping up
+// to `backups` old files
+func Open(path string, maxBytes int64, backups int, channels []string) (*Tap, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrap(err)
+	}
+	t := &Tap{
+		path:     path,
+		maxBytes: maxBytes,
+		backups:  backups,
+		f:        f,
+		size:     info.Size(),
+	}
+	if len(channels) > 0 {
+		t.channels = make(map[string]struct{}, len(channels))
+		for _, ch := range channels {
+			t.channels[strings.ToLower(strings.TrimSpace(ch))] = struct{}{}
+		}
+	}
+	return t, nil
+}
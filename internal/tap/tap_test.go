@@ -0,0 +1,50 @@
+package tap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestWrite(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "irc.log")
+	tp, err := Open(path, 10, 1, []string{"Foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tp.Close()
+
+	lines := []struct {
+		ch, line string
+	}{
+		{"foo", "line 1\r\n"},
+		{"bar", "ignored"},
+		{"foo", "line 2"},
+		{"foo", "line 3"},
+	}
+	for _, l := range lines {
+		if err := tp.Write(l.ch, l.line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := read(t, path), "line 3\n"; got != want {
+		t.Fatalf("got: %q, want: %q", got, want)
+	}
+	if got, want := read(t, path+".1"), "line 2\n"; got != want {
+		t.Fatalf("got: %q, want: %q", got, want)
+	}
+	if _, err := os.Stat(path + ".2"); !os.IsNotExist(err) {
+		t.Fatalf("got: %v, want: only 1 backup", err)
+	}
+}
@@ -0,0 +1,269 @@
+// Package webhook delivers signed JSON payloads to external HTTP endpoints.
+//
+// Every request carries the headers X-Hammertrack-Timestamp, the unix seconds
+// of the delivery, and X-Hammertrack-Signature, "sha256=" followed by the hex
+// HMAC-SHA256 of "<timestamp>.<body>" with the secret of the subscription.
+// Receivers should reject old timestamps to prevent replays. See Verify
+//
+// Deliveries that may be sent more than once carry the header X-Hammertrack-Event
+// with the id of their event, the same on every attempt, so receivers can drop
+// the duplicates
+//
+// Webhooks are only delivered over https to public addresses, so the tracker
+// cannot be used to reach the services of its own network. See ValidateURL
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+const (
+	HeaderSignature = "X-Hammertrack-Signature"
+	HeaderTimestamp = "X-Hammertrack-Timestamp"
+	HeaderEvent     = "X-Hammertrack-Event"
+	// MaxAttempts is the maximum number of attempts of a delivery
+	MaxAttempts = 3
+	// RetryDelay is the delay before the first retry, doubled on every retry
+	RetryDelay = time.Second
+)
+
+var (
+	ErrUnexpectedStatus = errors.New("unexpected status code from webhook")
+	ErrQueueFull        = errors.New("webhook queue full, delivery dropped")
+	ErrInsecureURL      = errors.New("webhook URLs must be absolute https URLs")
+	ErrForbiddenHost    = errors.New("webhook host is not a public address")
+)
+
+// nonPublic are the ranges not covered by the net.IP methods that must not be
+// reached either
+var nonPublic = []*net.IPNet{
+	cidr("0.0.0.0/8"),
+	// carrier-grade NAT
+	cidr("100.64.0.0/10"),
+}
+
+func cidr(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// public reports whether ip is a public unicast address
+func public(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range nonPublic {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateURL returns ErrInsecureURL if the URL is not an absolute https URL,
+// or ErrForbiddenHost if its host resolves to any address that is not public.
+// The addresses are checked again on every connection of the deliveries, so a
+// host resolving to another address later is still refused
+func ValidateURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return ErrInsecureURL
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	for _, addr := range addrs {
+		if !public(addr.IP) {
+			return ErrForbiddenHost
+		}
+	}
+	return nil
+}
+
+// guard refuses the connections to addresses that are not public. It runs
+// after the host is resolved, so neither DNS nor redirects bypass it
+func guard(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if ip := net.ParseIP(host); ip == nil || !public(ip) {
+		return errors.WrapWithContext(ErrForbiddenHost, struct{ Address string }{address})
+	}
+	return nil
+}
+
+// newClient returns the client of the deliveries, which only connects to
+// public addresses over https, also when redirected
+func newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: guard}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// no proxy, it would be the address checked by guard
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: 2,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Scheme != "https" {
+				return ErrInsecureURL
+			}
+			if len(via) >= 10 {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+}
+
+// Delivery is a payload to be sent to a webhook
+type Delivery struct {
+	URL    string
+	Secret string
+	Body   []byte
+	// Event is the id of the event delivered, sent in HeaderEvent if not empty
+	Event string
+	// Done is called, if not nil, with the result of the last attempt of a
+	// queued delivery
+	Done func(error)
+}
+
+// Sign returns the signature of the body sent at `ts`
+func Sign(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts, 10)))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether the signature of the body sent at `ts` is valid
+func Verify(secret string, ts int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature))
+}
+
+// Dispatcher sends the deliveries in background with a fixed number of
+// workers. Deliveries are dropped if the queue is full or they fail
+// MaxAttempts times
+type Dispatcher struct {
+	http    *http.Client
+	queue   chan *Delivery
+	workers int
+	// retryDelay is RetryDelay, shorter in tests
+	retryDelay time.Duration
+}
+
+// Enqueue schedules a delivery without blocking. It reports whether the
+// delivery was queued
+func (d *Dispatcher) Enqueue(del *Delivery) bool {
+	select {
+	case d.queue <- del:
+		return true
+	default:
+		return false
+	}
+}
+
+// Start runs the workers until ctx is done
+func (d *Dispatcher) Start(ctx context.Context) {
+	done := make(chan struct{})
+	for i := 0; i < d.workers; i++ {
+		go func() {
+			for {
+				select {
+				case del := <-d.queue:
+					err := d.deliver(ctx, del)
+					if err != nil {
+						errors.WrapAndLogWithContext(err, struct{ URL string }{del.URL})
+					}
+					if del.Done != nil {
+						del.Done(err)
+					}
+				case <-ctx.Done():
+					done <- struct{}{}
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < d.workers; i++ {
+		<-done
+	}
+}
+
+// deliver sends the delivery, retrying with an exponential backoff
+func (d *Dispatcher) deliver(ctx context.Context, del *Delivery) error {
+	var err error
+	delay := d.retryDelay
+	for attempt := 1; attempt <= MaxAttempts; attempt++ {
+		if err = d.send(ctx, del); err == nil {
+			return nil
+		}
+		if attempt == MaxAttempts {
+			break
+		}
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-ctx.Done():
+			return err
+		}
+	}
+	return err
+}
+
+func (d *Dispatcher) send(ctx context.Context, del *Delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, del.URL, bytes.NewReader(del.Body))
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(del.Secret, ts, del.Body))
+	if del.Event != "" {
+		req.Header.Set(HeaderEvent, del.Event)
+	}
+
+	res, err := d.http.Do(req)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1024))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errors.WrapWithContext(ErrUnexpectedStatus, struct{ Code int }{res.StatusCode})
+	}
+	return nil
+}
+
+// New creates a dispatcher with `workers` workers and room for `queue`
+// pending deliveries. Every request times out after `timeout`
+func New(workers, queue int, timeout time.Duration) *Dispatcher {
+	return &Dispatcher{
+		http:       newClient(timeout),
+		queue:      make(chan *Delivery, queue),
+		workers:    workers,
+		retryDelay: RetryDelay,
+	}
+}
@@ -0,0 +1,152 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+func TestDispatcher(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	received := make(chan bool, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first attempt fails so the delivery is retried
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		ts, _ := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		received <- Verify("secret", ts, body, r.Header.Get(HeaderSignature)) && string(body) == `{"a":1}`
+	}))
+	defer srv.Close()
+
+	d := New(1, 1, time.Second)
+	d.retryDelay = time.Millisecond
+	// the test server is plain http on a loopback address
+	d.http = &http.Client{Timeout: time.Second}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Start(ctx)
+
+	if !d.Enqueue(&Delivery{URL: srv.URL, Secret: "secret", Body: []byte(`{"a":1}`)}) {
+		t.Fatal("expected the delivery to be queued")
+	}
+	select {
+	case ok := <-received:
+		if !ok {
+			t.Fatal("invalid signature or body")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("delivery not received")
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("got %d calls, want 2", n)
+	}
+}
+
+func TestDispatcherDone(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(HeaderEvent) != "ok" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	d := New(1, 2, time.Second)
+	d.retryDelay = time.Millisecond
+	d.http = &http.Client{Timeout: time.Second}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Start(ctx)
+
+	tests := []struct {
+		event string
+		want  error
+	}{
+		{"ok", nil},
+		{"fail", ErrUnexpectedStatus},
+	}
+	for _, tt := range tests {
+		done := make(chan error, 1)
+		if !d.Enqueue(&Delivery{URL: srv.URL, Secret: "secret", Event: tt.event, Done: func(err error) { done <- err }}) {
+			t.Fatal("expected the delivery to be queued")
+		}
+		select {
+		case err := <-done:
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got: %v, want: %v", err, tt.want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("delivery not done")
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+	body := []byte("body")
+	sig := Sign("secret", 1, body)
+	tests := []struct {
+		secret string
+		ts     int64
+		body   []byte
+		want   bool
+	}{
+		{"secret", 1, body, true},
+		{"other", 1, body, false},
+		{"secret", 2, body, false},
+		{"secret", 1, []byte("other"), false},
+	}
+	for _, tt := range tests {
+		if got := Verify(tt.secret, tt.ts, tt.body, sig); got != tt.want {
+			t.Errorf("Verify(%q, %d, %q) = %t, want %t", tt.secret, tt.ts, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{"https://93.184.216.34/hook", nil},
+		{"http://93.184.216.34/hook", ErrInsecureURL},
+		{"/hook", ErrInsecureURL},
+		{"https://127.0.0.1/hook", ErrForbiddenHost},
+		{"https://[::1]:8443/hook", ErrForbiddenHost},
+		{"https://10.1.2.3/hook", ErrForbiddenHost},
+		{"https://192.168.0.10/hook", ErrForbiddenHost},
+		{"https://169.254.169.254/latest/meta-data", ErrForbiddenHost},
+		{"https://100.64.0.1/hook", ErrForbiddenHost},
+		{"https://0.0.0.0/hook", ErrForbiddenHost},
+	}
+	for _, tt := range tests {
+		if err := ValidateURL(context.Background(), tt.url); !errors.Is(err, tt.want) {
+			t.Errorf("ValidateURL(%q) = %v, want %v", tt.url, err, tt.want)
+		}
+	}
+}
+
+func TestGuard(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// the server is valid https, but it listens on a loopback address
+	d := New(1, 1, time.Second)
+	err := d.send(context.Background(), &Delivery{URL: srv.URL, Secret: "secret"})
+	if !errors.Is(err, ErrForbiddenHost) {
+		t.Fatalf("got %v, want %v", err, ErrForbiddenHost)
+	}
+}
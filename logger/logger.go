@@ -2,21 +2,139 @@ package logger
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/hammertrack/tracker/color"
+	"github.com/hammertrack/tracker/errors"
 	"github.com/hammertrack/tracker/utils"
 )
 
-type CustomLogger struct{}
+// Levels of the logs. At LevelError only the errors and the debug logs of the
+// subsystems are written, LevelDebug writes the debug logs of every subsystem
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelError = "error"
+)
 
-func (writer CustomLogger) Write(bytes []byte) (int, error) {
+// Subsystems with debug logs that can be turned on apart
+const (
+	IRC     = "irc"
+	Tracker = "tracker"
+	Storage = "storage"
+	API     = "api"
+)
+
+var Subsystems = []string{IRC, Tracker, Storage, API}
+
+var (
+	ErrLevel     = errors.New("unknown log level, expected debug, info or error")
+	ErrSubsystem = errors.New("unknown log subsystem, expected irc, tracker, storage or api")
+)
+
+// errorMark is how the lines of the errors start, see errors.Generic.Error
+var errorMark = string(color.Reset) + color.String(color.Red, "✗")
+
+// settings are the level and the subsystems with debug logs, changed at
+// runtime through the admin API
+var settings = struct {
+	mu    sync.RWMutex
+	level string
+	debug map[string]bool
+}{level: LevelInfo, debug: make(map[string]bool)}
+
+// SetLevel sets the level of the logs
+func SetLevel(level string) error {
+	level = strings.ToLower(strings.TrimSpace(level))
+	if level != LevelDebug && level != LevelInfo && level != LevelError {
+		return errors.WrapWithContext(ErrLevel, struct{ Level string }{level})
+	}
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	settings.level = level
+	return nil
+}
+
+func Level() string {
+	settings.mu.RLock()
+	defer settings.mu.RUnlock()
+	return settings.level
+}
+
+// SetDebug turns on or off the debug logs of the subsystem
+func SetDebug(subsystem string, on bool) error {
+	subsystem = strings.ToLower(strings.TrimSpace(subsystem))
+	if !IsSubsystem(subsystem) {
+		return errors.WrapWithContext(ErrSubsystem, struct{ Subsystem string }{subsystem})
+	}
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	settings.debug[subsystem] = on
+	return nil
+}
+
+// IsSubsystem reports whether `name` is one of Subsystems, in any case
+func IsSubsystem(name string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, s := range Subsystems {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Debugging returns the subsystems whose debug logs are on, sorted
+func Debugging() []string {
+	settings.mu.RLock()
+	defer settings.mu.RUnlock()
+	on := make([]string, 0, len(settings.debug))
+	for s, ok := range settings.debug {
+		if ok {
+			on = append(on, s)
+		}
+	}
+	sort.Strings(on)
+	return on
+}
+
+// Enabled reports whether the debug logs of the subsystem are written, so the
+// callers can skip building costly ones
+func Enabled(subsystem string) bool {
+	settings.mu.RLock()
+	defer settings.mu.RUnlock()
+	return settings.level == LevelDebug || settings.debug[subsystem]
+}
+
+// Debugf writes a debug log of the subsystem if its debug logs are on
+func Debugf(subsystem, format string, args ...interface{}) {
+	if !Enabled(subsystem) {
+		return
+	}
+	write(color.String(color.Cyan, subsystem) + " " + fmt.Sprintf(format, args...) + "\n")
+}
+
+func write(line string) (int, error) {
 	now := time.Now().Format(time.RFC3339)
 	return fmt.Printf("[%s] ► %s",
-		color.String(color.Yellow, now), color.String(color.Green, utils.ByteToStr(bytes)),
+		color.String(color.Yellow, now), color.String(color.Green, line),
 	)
 }
 
+type CustomLogger struct{}
+
+func (writer CustomLogger) Write(bytes []byte) (int, error) {
+	line := utils.ByteToStr(bytes)
+	if Level() == LevelError && !strings.HasPrefix(line, errorMark) {
+		// reported as written, the log package stops at the errors of the writer
+		return len(bytes), nil
+	}
+	return write(line)
+}
+
 func New() *CustomLogger {
 	return new(CustomLogger)
 }
@@ -4,43 +4,77 @@ import (
 	"log"
 	"os"
 	"os/signal"
-	"syscall"
+	"strings"
 
 	"github.com/davecgh/go-spew/spew"
 
-	"github.com/hammertrack/tracker/internal/bot"
+	"github.com/hammertrack/tracker/errors"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/service"
 	"github.com/hammertrack/tracker/logger"
 )
 
-func waitSignInt() {
+// ServiceName is the name of the Windows service that runs the tracker
+const ServiceName = "hammertrack"
+
+// waitSignInt waits for a signal to stop, for the service manager to stop the
+// tracker or for an error of `failed`, which is returned. See
+// service.StopSignals and service.Stopping
+func waitSignInt(failed <-chan error) error {
 	sigint := make(chan os.Signal, 1)
-	signal.Notify(
-		sigint,
-		os.Interrupt,
-		syscall.SIGINT,
-		syscall.SIGTERM,
-		syscall.SIGABRT,
-		syscall.SIGQUIT,
-	)
-	<-sigint
+	signal.Notify(sigint, service.StopSignals...)
+	var err error
+	select {
+	case <-sigint:
+	case <-service.Stopping():
+	case err = <-failed:
+	}
 	log.Print("Stopping hammertrack tracker")
+	return err
 }
 
 // TODO - Clean and re-structure some logs
 // TODO - Tests
 // TODO - Rename everything from hammertrace to hammertrack
 func main() {
-	b := bot.New()
-	go func() {
-		b.Start()
-	}()
-	waitSignInt()
-	b.Stop()
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		printUsage()
+		return
+	}
+	cmd := findCommand(name)
+	if cmd == nil {
+		printUsage()
+		os.Exit(2)
+	}
+	managed, err := service.Run(ServiceName, func() error {
+		return cmd.run(args)
+	})
+	if !managed {
+		err = cmd.run(args)
+	}
+	if err != nil {
+		errors.WrapFatal(err)
+	}
 }
 
 func init() {
 	spew.Config.Indent = "\t"
 	log.SetFlags(0)
 	log.SetOutput(logger.New())
+	if err := logger.SetLevel(cfg.LogLevel); err != nil {
+		errors.WrapFatal(err)
+	}
+	for _, subsystem := range strings.Split(cfg.LogDebug, ",") {
+		if subsystem = strings.TrimSpace(subsystem); subsystem == "" {
+			continue
+		}
+		if err := logger.SetDebug(subsystem, true); err != nil {
+			errors.WrapFatal(err)
+		}
+	}
 	printBanner()
 }
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"log"
+)
+
+func purgeUser(args []string) error {
+	fs := flag.NewFlagSet("purge-user", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would be deleted without deleting anything")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return ErrBadArguments
+	}
+
+	sto := openStorage()
+	defer sto.Stop()
+
+	report, err := sto.PurgeUser(fs.Arg(0), "cli", *dryRun)
+	if err != nil {
+		return err
+	}
+	if report.DryRun {
+		log.Print("dry-run, nothing was deleted")
+	}
+	log.Printf("user: %s", report.Username)
+	log.Printf("aliases: %v", report.Aliases)
+	log.Printf("channels: %v", report.Channels)
+	for table, n := range report.Rows {
+		log.Printf("  %s: %d rows", table, n)
+	}
+	return nil
+}
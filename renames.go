@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/hammertrack/tracker/internal/bot"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/helix"
+)
+
+func renames(args []string) error {
+	if len(args) == 0 || args[0] != "detect" {
+		return ErrBadArguments
+	}
+	fs := flag.NewFlagSet("renames detect", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "print the renames without recording them")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	sto := openStorage()
+	defer sto.Stop()
+	report, err := bot.DetectRenames(context.Background(), sto, helix.New(cfg.HelixClientID, cfg.HelixToken), *dryRun)
+	if err != nil {
+		return err
+	}
+	report.Log()
+	return nil
+}
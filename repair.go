@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/hammertrack/tracker/internal/bot"
+)
+
+func repair(args []string) error {
+	fs := flag.NewFlagSet("repair", flag.ExitOnError)
+	channel := fs.String("channel", "", "channel whose moderations are repaired")
+	from := fs.String("from", "", "first day to repair, as YYYY-MM-DD")
+	to := fs.String("to", time.Now().UTC().Format(dayLayout), "last day to repair, as YYYY-MM-DD")
+	dryRun := fs.Bool("dry-run", false, "report the missing rows without copying them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *channel == "" || *from == "" {
+		return ErrBadArguments
+	}
+	fromDay, err := time.Parse(dayLayout, *from)
+	if err != nil {
+		return err
+	}
+	toDay, err := time.Parse(dayLayout, *to)
+	if err != nil {
+		return err
+	}
+
+	// include the whole last day
+	toDay = toDay.Add(24*time.Hour - time.Millisecond)
+
+	sto := openStorage()
+	defer sto.Stop()
+
+	report, err := sto.Repair(bot.Channel(*channel), fromDay, toDay, *dryRun)
+	if err != nil {
+		return err
+	}
+	if report.DryRun {
+		log.Print("dry-run, nothing was repaired")
+	}
+	log.Printf("channel: %s, rows scanned: %d", report.Channel, report.Scanned)
+	log.Printf("  missing by user: %d", report.MissingByUser)
+	log.Printf("  missing by channel: %d", report.MissingByChannel)
+	return nil
+}
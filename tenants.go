@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hammertrack/tracker/internal/bot"
+)
+
+func tenants(args []string) error {
+	if len(args) == 0 {
+		return ErrBadArguments
+	}
+	fs := flag.NewFlagSet("tenants "+args[0], flag.ExitOnError)
+	name := fs.String("name", "", "name of the tenant or of the API key")
+	retention := fs.Int("retention-days", 0, "days the moderations of the tenant are kept, forever if 0")
+	role := fs.String("role", string(bot.RoleAdmin), "role of the API key: viewer, moderator or admin")
+	scope := fs.String("channels", "", "comma-separated channels the API key is scoped to, all the channels of the tenant if empty")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	nargs := map[string]int{
+		"create":         1,
+		"list":           0,
+		"add-channel":    2,
+		"remove-channel": 2,
+		"create-key":     1,
+		"revoke-key":     1,
+		"add-webhook":    2,
+		"remove-webhook": 2,
+	}
+	if n, ok := nargs[args[0]]; !ok || fs.NArg() != n {
+		return ErrBadArguments
+	}
+
+	sto := openStorage()
+	defer sto.Stop()
+
+	switch args[0] {
+	case "create":
+		return sto.CreateTenant(&bot.Tenant{
+			ID:            fs.Arg(0),
+			Name:          *name,
+			RetentionDays: *retention,
+		}, "cli")
+	case "list":
+		all, err := sto.Tenants()
+		if err != nil {
+			return err
+		}
+		for _, t := range all {
+			chs, err := sto.TenantChannels(t.ID)
+			if err != nil {
+				return err
+			}
+			hooks, err := sto.TenantWebhooks(t.ID)
+			if err != nil {
+				return err
+			}
+			log.Printf("%s (%s) retention=%dd channels=%v", t.ID, t.Name, t.RetentionDays, chs)
+			for _, h := range hooks {
+				log.Printf("\twebhook %s %s", h.ID, h.URL)
+			}
+		}
+		return nil
+	case "add-channel":
+		return sto.AddTenantChannel(fs.Arg(0), bot.Channel(fs.Arg(1)), "cli")
+	case "remove-channel":
+		return sto.RemoveTenantChannel(fs.Arg(0), bot.Channel(fs.Arg(1)), "cli")
+	case "create-key":
+		r, err := bot.ParseRole(*role)
+		if err != nil {
+			return err
+		}
+		var chs []bot.Channel
+		for _, ch := range strings.Split(*scope, ",") {
+			if ch = strings.TrimSpace(ch); ch != "" {
+				chs = append(chs, bot.Channel(ch))
+			}
+		}
+		key, err := sto.CreateAPIKey(fs.Arg(0), *name, r, chs, "cli")
+		if err != nil {
+			return err
+		}
+		// the key cannot be retrieved again, print it to stdout
+		fmt.Println(key)
+		return nil
+	case "revoke-key":
+		return sto.RevokeAPIKey(fs.Arg(0), "cli")
+	case "add-webhook":
+		h, err := sto.CreateTenantWebhook(fs.Arg(0), fs.Arg(1), "cli")
+		if err != nil {
+			return err
+		}
+		// the secret cannot be retrieved again, print it to stdout
+		fmt.Println(h.ID, h.Secret)
+		return nil
+	case "remove-webhook":
+		return sto.DeleteTenantWebhook(fs.Arg(0), fs.Arg(1), "cli")
+	}
+	return nil
+}
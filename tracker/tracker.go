@@ -0,0 +1,283 @@
+// Package tracker embeds the tracking of the moderations of twitch channels in
+// other Go programs, with the same pipeline as the tracker binary: the storage,
+// the bot reading from the source and, optionally, the API.
+//
+// The rest of the settings are read from the environment, like in the binary,
+// and are process-wide: there must be a single Tracker per process.
+package tracker
+
+import (
+	"context"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/hammertrack/tracker/errors"
+	"github.com/hammertrack/tracker/internal/api"
+	"github.com/hammertrack/tracker/internal/bot"
+	cfg "github.com/hammertrack/tracker/internal/config"
+	"github.com/hammertrack/tracker/internal/database"
+	"github.com/hammertrack/tracker/internal/helix"
+	"github.com/hammertrack/tracker/internal/heuristics"
+	"github.com/hammertrack/tracker/internal/message"
+	"github.com/hammertrack/tracker/internal/notify"
+)
+
+// Sources of the messages, see WithSource
+const (
+	SourceIRC      = bot.SourceIRC
+	SourceEventSub = bot.SourceEventSub
+)
+
+var (
+	ErrDriver  = errors.New("unknown storage driver, expected cassandra or memory")
+	ErrSource  = errors.New("unknown source, expected irc or eventsub")
+	ErrStarted = errors.New("the tracker was already started")
+)
+
+type (
+	// Driver stores the moderations. See NewDriver for the built-in ones
+	Driver = bot.Driver
+	// Message is a moderation, with the messages of the moderated user
+	Message = message.Message
+	Channel = bot.Channel
+	// Rule decides whether a moderation is stored from its Traits
+	Rule   = heuristics.Rule
+	Traits = heuristics.Traits
+	Health = bot.Health
+	// Notifier sends the daily digest and the incidents of a channel or a
+	// tenant, see WithNotifier
+	Notifier     = notify.Notifier
+	Notification = notify.Notification
+)
+
+// Config are the settings of a Tracker that are not read from the environment
+type Config struct {
+	// Storage is the built-in driver, "cassandra" or "memory". It is ignored
+	// with WithDriver
+	Storage string
+	// Channels are tracked on top of the stored ones
+	Channels []string
+	// APIAddr is the address the API listens on, empty for no API unless
+	// WithListener is given
+	APIAddr string
+}
+
+// DefaultConfig returns the Config of the environment, see STORAGE_DRIVER and
+// API_ADDR
+func DefaultConfig() Config {
+	return Config{
+		Storage: cfg.StorageDriver,
+		APIAddr: cfg.APIAddr,
+	}
+}
+
+// Option customizes a Tracker, see New
+type Option func(*Tracker)
+
+// WithDriver stores the moderations with `d` instead of Config.Storage
+func WithDriver(d Driver) Option {
+	return func(t *Tracker) {
+		t.driver = d
+	}
+}
+
+// WithRules replaces the default rules of the moderations with `rules`. The
+// pipelines of RULE_PIPELINES still apply to their message types
+func WithRules(rules ...Rule) Option {
+	return func(t *Tracker) {
+		t.rules = rules
+	}
+}
+
+// WithSource reads the messages from `source`, SourceIRC or SourceEventSub,
+// instead of the SOURCE of the environment
+func WithSource(source string) Option {
+	return func(t *Tracker) {
+		t.source = source
+	}
+}
+
+// WithNotifier sends the notifications of `scope`, "channel:<name>" or
+// "tenant:<id>", to `n` on top of the ones of NOTIFY_EMAILS
+func WithNotifier(scope string, n Notifier) Option {
+	return func(t *Tracker) {
+		t.notifiers = append(t.notifiers, scopedNotifier{scope, n})
+	}
+}
+
+// WithListener serves the API on `l` instead of Config.APIAddr
+func WithListener(l net.Listener) Option {
+	return func(t *Tracker) {
+		t.listener = l
+	}
+}
+
+type scopedNotifier struct {
+	scope string
+	n     Notifier
+}
+
+// Tracker tracks the moderations of the channels until it is stopped
+type Tracker struct {
+	conf      Config
+	driver    Driver
+	rules     []Rule
+	source    string
+	listener  net.Listener
+	notifiers []scopedNotifier
+
+	bot *bot.Bot
+	// srv is nil if the API is not served
+	srv    *api.Server
+	cancel context.CancelFunc
+	// failed carries the errors of the API server and of the startup or the
+	// source of the bot, which should stop the tracker
+	failed chan error
+}
+
+// NewDriver returns the built-in driver `name`, "cassandra" or "memory". The
+// cassandra driver connects to the database of the environment, migrating it
+// if DB_MIGRATE is set
+func NewDriver(name string) (Driver, error) {
+	switch name {
+	case "cassandra":
+		sess := database.New(cfg.DBMigrate)
+		return bot.NewCassandraStorage(sess, database.NewReader()), nil
+	case "memory":
+		log.Printf("storing up to %d moderations in memory, they are lost on exit", cfg.MemoryMaxModerations)
+		return bot.NewMemoryStorage(cfg.MemoryMaxModerations), nil
+	default:
+		return nil, errors.WrapWithContext(ErrDriver, struct{ Driver string }{name})
+	}
+}
+
+// Start opens the storage and starts tracking the channels. The startup goes on
+// in the background, see Ready and Failed
+func (t *Tracker) Start() error {
+	if t.bot != nil {
+		return ErrStarted
+	}
+	if t.source != "" {
+		if t.source != SourceIRC && t.source != SourceEventSub {
+			return errors.WrapWithContext(ErrSource, struct{ Source string }{t.source})
+		}
+		cfg.Source = t.source
+	}
+	if t.driver == nil {
+		log.Print("initializing storage...")
+		d, err := NewDriver(t.conf.Storage)
+		if err != nil {
+			return err
+		}
+		t.driver = d
+	}
+	sto := bot.NewStorage(t.driver)
+	if t.rules != nil {
+		if err := sto.SetRules(t.rules); err != nil {
+			sto.Stop()
+			return err
+		}
+	}
+	for _, sn := range t.notifiers {
+		sto.AddNotifier(sn.scope, sn.n)
+	}
+	for _, ch := range t.conf.Channels {
+		if ch = strings.ToLower(strings.TrimSpace(ch)); ch == "" {
+			continue
+		}
+		if err := sto.AddChannel(bot.Channel(ch), "config"); err != nil {
+			sto.Stop()
+			return err
+		}
+	}
+	t.bot = bot.New()
+	t.bot.SetStorage(sto)
+
+	if t.conf.APIAddr != "" || t.listener != nil {
+		t.srv = api.New(t.conf.APIAddr, sto, t.bot)
+		go func() {
+			if err := t.srv.Start(t.listener); err != nil {
+				t.failed <- err
+			}
+		}()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+	go func() {
+		if err := t.bot.Start(ctx); err != nil {
+			t.failed <- err
+		}
+	}()
+	if cfg.RenamesIntervalMinutes > 0 {
+		go detectRenames(ctx, sto)
+	}
+	return nil
+}
+
+// Ready is closed once the tracker is started and the source connected
+func (t *Tracker) Ready() <-chan struct{} {
+	return t.bot.Ready()
+}
+
+// Failed receives the errors of the API and of the startup or the source of
+// the tracker. The tracker should be stopped after any of them
+func (t *Tracker) Failed() <-chan error {
+	return t.failed
+}
+
+// Health returns the state of the tracker. It must be called after Start
+func (t *Tracker) Health() *Health {
+	return t.bot.Health()
+}
+
+// Stop stops the API and then the tracker, waiting for the moderations
+// received to be stored. It returns the first error
+func (t *Tracker) Stop() error {
+	if t.bot == nil {
+		return nil
+	}
+	if t.srv != nil {
+		if err := t.srv.Stop(); err != nil {
+			errors.WrapAndLog(err)
+		}
+	}
+	err := t.bot.Stop()
+	t.cancel()
+	return err
+}
+
+// detectRenames runs bot.DetectRenames every RENAMES_INTERVAL_MINUTES until
+// ctx is done
+func detectRenames(ctx context.Context, sto *bot.Storage) {
+	h := helix.New(cfg.HelixClientID, cfg.HelixToken)
+	t := time.NewTicker(time.Duration(cfg.RenamesIntervalMinutes) * time.Minute)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			report, err := bot.DetectRenames(ctx, sto, h, false)
+			if err != nil {
+				errors.WrapAndLog(err)
+				continue
+			}
+			report.Log()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// New creates a tracker with the given config, see DefaultConfig
+func New(conf Config, opts ...Option) *Tracker {
+	t := &Tracker{
+		conf: conf,
+		// the API server and the bot send an error at most
+		failed: make(chan error, 2),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
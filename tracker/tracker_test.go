@@ -0,0 +1,24 @@
+package tracker
+
+import (
+	"testing"
+
+	"github.com/hammertrack/tracker/errors"
+)
+
+func TestStartErrors(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		tr   *Tracker
+		want error
+	}{
+		{"driver", New(Config{Storage: "sqlite"}), ErrDriver},
+		{"source", New(Config{Storage: "memory"}, WithSource("pubsub")), ErrSource},
+	}
+	for _, tt := range tests {
+		if err := tt.tr.Start(); !errors.Is(err, tt.want) {
+			t.Errorf("%s got: %v, want: %v", tt.name, err, tt.want)
+		}
+	}
+}